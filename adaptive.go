@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"discoveryhosts/discovery"
+)
+
+// Janela mínima do modo adaptativo; menos que isso não junta hosts
+// suficientes para uma decisão.
+const minAdaptiveWindow = time.Second
+
+// AdaptiveWorkers configura o ajuste automático dos workers ativos de cada
+// etapa. Os workers configurados (workers, ping_workers...) passam a ser o
+// máximo; o run começa com min_workers e sobe ou desce a cada window.
+type AdaptiveWorkers struct {
+	Enabled    bool     `json:"enabled,omitempty" yaml:"enabled" toml:"enabled"`
+	MinWorkers int      `json:"min_workers" yaml:"min_workers" toml:"min_workers"`
+	Window     Duration `json:"window" yaml:"window" toml:"window"`
+}
+
+func (a AdaptiveWorkers) validate(c Config) []error {
+	if !a.Enabled {
+		return nil
+	}
+	var errs []error
+	if a.MinWorkers < 1 {
+		errs = append(errs, fmt.Errorf("adaptive_workers.min_workers deve ser no mínimo 1 (atual: %d)%s", a.MinWorkers, c.origin("adaptive_workers.min_workers")))
+	}
+	if time.Duration(a.Window) < minAdaptiveWindow {
+		errs = append(errs, fmt.Errorf("adaptive_workers.window deve ser no mínimo %s (atual: %s)%s", minAdaptiveWindow, a.Window, c.origin("adaptive_workers.window")))
+	}
+	return errs
+}
+
+// Configuração do pacote discovery; nil com o modo desligado.
+func (a AdaptiveWorkers) discovery() *discovery.Adaptive {
+	if !a.Enabled {
+		return nil
+	}
+	return &discovery.Adaptive{Min: a.MinWorkers, Window: time.Duration(a.Window)}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/probe"
+)
+
+// Caminho do endpoint que recebe os scans no modo agente.
+const agentScanPath = "/v1/scan"
+
+// O agente envia uma linha de heartbeat a cada agentHeartbeat enquanto o scan
+// roda; sem nenhuma linha por agentIdleTimeout o coordenador considera o
+// agente perdido.
+const (
+	agentHeartbeat   = 10 * time.Second
+	agentIdleTimeout = 3 * agentHeartbeat
+)
+
+// Tamanho máximo do pedido de scan e de cada linha da resposta.
+const (
+	maxAgentRequest = 1 << 20
+	maxAgentLine    = 1 << 20
+)
+
+// Agent configura o modo agente (-agent): o processo recebe ranges de um
+// coordenador por HTTP, faz o ping e o SNMP com as próprias communities e
+// workers e devolve os resultados, sem cadastrar nada no Zabbix.
+type Agent struct {
+	Token   string `json:"token,omitempty" yaml:"token" toml:"token"`
+	TLSCert string `json:"tls_cert,omitempty" yaml:"tls_cert" toml:"tls_cert"`
+	TLSKey  string `json:"tls_key,omitempty" yaml:"tls_key" toml:"tls_key"`
+}
+
+func (a Agent) validate(c Config) []error {
+	if (a.TLSCert == "") != (a.TLSKey == "") {
+		return []error{fmt.Errorf("agent.tls_cert e agent.tls_key devem ser definidos juntos%s", c.origin("agent.tls_cert"))}
+	}
+	return nil
+}
+
+// AgentEndpoint é um agente usado pelo coordenador, referenciado pelo nome
+// em agent_ranges.
+type AgentEndpoint struct {
+	URL   string `json:"url" yaml:"url" toml:"url"`
+	Token string `json:"token,omitempty" yaml:"token" toml:"token"`
+}
+
+func (e AgentEndpoint) redacted() AgentEndpoint {
+	e.Token = maskSecret(e.Token)
+	return e
+}
+
+// Confere os agentes e a atribuição de ranges do coordenador.
+func (c Config) validateAgents() []error {
+	var errs []error
+	for name, e := range c.Agents {
+		key := "agents." + name
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s.url deve ser uma URL http:// ou https:// (atual: %q)%s", key, e.URL, c.origin(key+".url")))
+		}
+		if e.Token == "" {
+			errs = append(errs, fmt.Errorf("%s.token é obrigatório%s", key, c.origin(key)))
+		}
+	}
+	ranges := map[string]bool{}
+	for _, r := range c.Ranges {
+		ranges[strings.TrimSpace(r)] = true
+	}
+	for r, name := range c.AgentRanges {
+		key := "agent_ranges." + r
+		if !ranges[strings.TrimSpace(r)] {
+			errs = append(errs, fmt.Errorf("agent_ranges: o range %q não está em ranges%s", r, c.origin(key)))
+		}
+		if _, ok := c.Agents[name]; !ok {
+			errs = append(errs, fmt.Errorf("agent_ranges: o range %q usa o agente %q, que não está em agents%s", r, name, c.origin(key)))
+		}
+	}
+	return errs
+}
+
+// Agente de cada range atribuído, com as chaves já normalizadas.
+func (c Config) rangeAgents() map[string]string {
+	owners := make(map[string]string, len(c.AgentRanges))
+	for r, name := range c.AgentRanges {
+		owners[strings.TrimSpace(r)] = name
+	}
+	return owners
+}
+
+// Workers reservados dos ranges processados por este processo; os dos ranges
+// de um agente vão no pedido de scan dele.
+func (c Config) localRangeWorkers() map[string]int {
+	if len(c.AgentRanges) == 0 {
+		return c.RangeWorkers
+	}
+	owners := c.rangeAgents()
+	local := map[string]int{}
+	for r, n := range c.RangeWorkers {
+		if _, remote := owners[strings.TrimSpace(r)]; !remote {
+			local[r] = n
+		}
+	}
+	return local
+}
+
+// Grupos remotos do run, um por agente com ranges atribuídos, em ordem de
+// nome.
+func (c Config) remotes(runID string) []discovery.Remote {
+	owners := c.rangeAgents()
+	byAgent := map[string][]string{}
+	var names []string
+	for _, r := range c.Ranges {
+		r = strings.TrimSpace(r)
+		name, ok := owners[r]
+		if !ok {
+			continue
+		}
+		if _, seen := byAgent[name]; !seen {
+			names = append(names, name)
+		}
+		byAgent[name] = append(byAgent[name], r)
+	}
+	sort.Strings(names)
+	var remotes []discovery.Remote
+	for _, name := range names {
+		req := agentRequest{
+			RunID:       runID,
+			Interleave:  c.InterleaveRanges,
+			PingTimeout: c.PingTimeout,
+			SNMPTimeout: c.SNMPTimeout,
+		}
+		for r, n := range c.RangeWorkers {
+			if owners[strings.TrimSpace(r)] == name {
+				if req.RangeWorkers == nil {
+					req.RangeWorkers = map[string]int{}
+				}
+				req.RangeWorkers[strings.TrimSpace(r)] = n
+			}
+		}
+		remotes = append(remotes, discovery.Remote{
+			Name:    name,
+			Ranges:  byAgent[name],
+			Scanner: &agentScanner{endpoint: c.Agents[name], req: req, client: &http.Client{}},
+		})
+	}
+	return remotes
+}
+
+// Pedido de scan do coordenador. Os ranges e a configuração por range vêm
+// do coordenador; communities, workers e retentativas são os do agente.
+type agentRequest struct {
+	RunID        string         `json:"run_id"`
+	Ranges       []string       `json:"ranges"`
+	RangeWorkers map[string]int `json:"range_workers,omitempty"`
+	Interleave   bool           `json:"interleave,omitempty"`
+	PingTimeout  Duration       `json:"ping_timeout"`
+	SNMPTimeout  Duration       `json:"snmp_timeout"`
+}
+
+// Linha da resposta do agente: "host" para cada IP concluído, "heartbeat"
+// periódico e, no fim, "end" ou "error".
+type agentLine struct {
+	Type    string     `json:"type"`
+	Host    *agentHost `json:"host,omitempty"`
+	Scanned int        `json:"scanned,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// Resultado de um IP no formato do checkpoint, com a community, que o
+// coordenador precisa para o cadastro no Zabbix.
+type agentHost struct {
+	checkpointHost
+	Community  string `json:"community,omitempty"`
+	PingError  string `json:"ping_error,omitempty"`
+	PingReason string `json:"ping_reason,omitempty"`
+}
+
+func newAgentHost(r discovery.HostResult) *agentHost {
+	h := &agentHost{checkpointHost: newCheckpointHost(r), Community: r.SNMP.Community}
+	if r.PingErr != nil {
+		h.PingError, h.PingReason = r.PingErr.Error(), r.PingReason
+	}
+	return h
+}
+
+func (h agentHost) result() discovery.HostResult {
+	r := h.checkpointHost.result()
+	r.SNMP.Community = h.Community
+	if h.PingError != "" {
+		r.PingErr = &probe.Error{Reason: h.PingReason, Err: errors.New(h.PingError)}
+		r.PingReason = h.PingReason
+	}
+	return r
+}
+
+// Cliente do coordenador para um agente.
+type agentScanner struct {
+	endpoint AgentEndpoint
+	req      agentRequest
+	client   *http.Client
+}
+
+var errAgentSilent = fmt.Errorf("agente sem resposta há %s", agentIdleTimeout)
+
+// Envia os ranges ao agente e entrega cada host da resposta. O scan termina
+// com a linha "end"; uma conexão encerrada antes dela, uma linha "error" ou
+// agentIdleTimeout sem nenhuma linha são falhas do agente.
+func (s *agentScanner) Scan(ctx context.Context, ranges []string, emit func(discovery.HostResult)) error {
+	req := s.req
+	req.Ranges = ranges
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	idle := time.AfterFunc(agentIdleTimeout, func() { cancel(errAgentSilent) })
+	defer idle.Stop()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.endpoint.URL, "/")+agentScanPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+s.endpoint.Token)
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return s.failure(ctx, fmt.Errorf("falha ao conectar: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("agente respondeu %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	lines.Buffer(make([]byte, 64*1024), maxAgentLine)
+	for lines.Scan() {
+		idle.Reset(agentIdleTimeout)
+		var line agentLine
+		if err := json.Unmarshal(lines.Bytes(), &line); err != nil {
+			return fmt.Errorf("resposta inválida do agente: %w", err)
+		}
+		switch line.Type {
+		case "host":
+			if line.Host != nil {
+				emit(line.Host.result())
+			}
+		case "end":
+			return nil
+		case "error":
+			return fmt.Errorf("scan falhou no agente: %s", line.Error)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return s.failure(ctx, fmt.Errorf("conexão com o agente perdida: %w", err))
+	}
+	return fmt.Errorf("o agente encerrou a conexão sem concluir o scan")
+}
+
+// Troca o erro de uma requisição cancelada pelo watchdog pela causa.
+func (s *agentScanner) failure(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), errAgentSilent) {
+		return errAgentSilent
+	}
+	return err
+}
+
+// Servidor HTTP do modo agente. Atende um scan por vez, com a configuração
+// carregada na inicialização.
+type agentServer struct {
+	cfg  Config
+	busy atomic.Bool
+}
+
+func (s *agentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != agentScanPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !bearerAuthorized(r, s.cfg.Agent.Token) {
+		logWarn("agent.unauthorized", r.RemoteAddr)
+		http.Error(w, "token inválido", http.StatusUnauthorized)
+		return
+	}
+	var req agentRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAgentRequest)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("pedido inválido: %v", err), http.StatusBadRequest)
+		return
+	}
+	cfg := s.cfg
+	cfg.Ranges, cfg.RangeWorkers, cfg.InterleaveRanges = req.Ranges, req.RangeWorkers, req.Interleave
+	cfg.Agents, cfg.AgentRanges = nil, nil
+	if req.PingTimeout > 0 {
+		cfg.PingTimeout = req.PingTimeout
+	}
+	if req.SNMPTimeout > 0 {
+		cfg.SNMPTimeout = req.SNMPTimeout
+	}
+	if len(cfg.Ranges) == 0 {
+		http.Error(w, "nenhum range no pedido", http.StatusBadRequest)
+		return
+	}
+	if err := cfg.validate(); err != nil {
+		http.Error(w, fmt.Sprintf("pedido inválido: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !s.busy.CompareAndSwap(false, true) {
+		logWarn("agent.busy", r.RemoteAddr, req.RunID)
+		http.Error(w, "agente ocupado com outro scan", http.StatusConflict)
+		return
+	}
+	defer s.busy.Store(false)
+
+	logInfo("agent.scan_start", r.RemoteAddr, req.RunID, len(req.Ranges))
+	start := time.Now()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	out := &agentStream{w: w}
+	out.send(agentLine{Type: "heartbeat"})
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(agentHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				out.send(agentLine{Type: "heartbeat"})
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	dc := cfg.discoveryConfig(RunOptions{RunID: req.RunID, DryRun: true})
+	dc.Zabbix = nil
+	dc.Logger = rootLog.Slog()
+	dc.OnResult = func(hr discovery.HostResult) {
+		out.send(agentLine{Type: "host", Host: newAgentHost(hr)})
+	}
+	report, err := discovery.Run(r.Context(), dc)
+	if err != nil {
+		logError("agent.scan_failed", req.RunID, err)
+		out.send(agentLine{Type: "error", Error: err.Error()})
+		return
+	}
+	logInfo("agent.scan_done", req.RunID, report.Summary.Scanned, time.Since(start).Round(time.Millisecond))
+	out.send(agentLine{Type: "end", Scanned: report.Summary.Scanned})
+}
+
+// Confere o token "Authorization: Bearer" do pedido em tempo constante.
+func bearerAuthorized(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// Resposta em streaming, escrita pelo coletor e pelo heartbeat. Falhas de
+// escrita (coordenador desconectado) cancelam o contexto da requisição, e o
+// run termina sozinho.
+type agentStream struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+}
+
+func (s *agentStream) send(line agentLine) {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(append(data, '\n'))
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Executa o modo agente até um SIGINT/SIGTERM, que interrompe o scan em
+// andamento; o coordenador o trata como falha do agente.
+func runAgent(addr string, cfg Config) (int, error) {
+	if cfg.Agent.Token == "" {
+		return exitFatal, fmt.Errorf("-agent requer agent.token na configuração")
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           &agentServer{cfg: cfg},
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	errc := make(chan error, 1)
+	go func() {
+		if cfg.Agent.TLSCert != "" {
+			logInfo("agent.listening", addr, "https")
+			errc <- srv.ListenAndServeTLS(cfg.Agent.TLSCert, cfg.Agent.TLSKey)
+			return
+		}
+		logWarn("agent.listening_plain", addr)
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return exitFatal, fmt.Errorf("modo agente: %w", err)
+	case <-ctx.Done():
+	}
+	logInfo("agent.stopping")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	return exitOK, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/snmpinfo"
+)
+
+// Formatos do -output-ansible.
+const (
+	ansibleYAML = "yaml"
+	ansibleINI  = "ini"
+)
+
+// Macro do Zabbix que guarda a community de cada host cadastrado.
+const snmpCommunityMacro = "{$SNMP_COMMUNITY}"
+
+// Caracteres que o Ansible não aceita em nomes de grupo.
+var ansibleGroupChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// Host do inventário: o nome no Zabbix e as variáveis.
+type ansibleHost struct {
+	name   string
+	ip     string
+	rng    string
+	vendor string
+	vars   map[string]string
+}
+
+// Grava no close um inventário do Ansible com os hosts identificados (com
+// sysName ou cadastrados pelo nome DNS), agrupados pelo range e, com
+// byVendor, pelo fabricante do sysObjectID. O nome de cada host é o do
+// Zabbix e ansible_host é o IP.
+type ansibleSink struct {
+	path     string
+	format   string
+	byVendor bool
+	hosts    []ansibleHost
+	names    map[string]bool
+}
+
+func newAnsibleSink(path, format string, byVendor bool) *ansibleSink {
+	return &ansibleSink{path: path, format: format, byVendor: byVendor, names: map[string]bool{}}
+}
+
+func (s *ansibleSink) write(r discovery.HostResult) error {
+	name := r.Name()
+	if name == "" {
+		return nil
+	}
+	// Dois IPs com o mesmo sysName: o segundo entra pelo IP
+	if s.names[name] {
+		name = r.IP
+	}
+	s.names[name] = true
+	vars := map[string]string{
+		"ansible_host":         r.IP,
+		"discovery_range":      r.Range,
+		"snmp_community_macro": snmpCommunityMacro,
+	}
+	if r.SNMP.SysName != "" {
+		vars["sysname"] = r.SNMP.SysName
+	}
+	if r.SNMP.SysDescr != "" {
+		vars["sysdescr"] = r.SNMP.SysDescr
+	}
+	if r.HostID != "" {
+		vars["zabbix_hostid"] = r.HostID
+	}
+	s.hosts = append(s.hosts, ansibleHost{name: name, ip: r.IP, rng: r.Range, vendor: snmpinfo.Vendor(r.SNMP.SysObjectID), vars: vars})
+	return nil
+}
+
+func (s *ansibleSink) close(discovery.Summary) error {
+	groups := s.groups()
+	var data []byte
+	var err error
+	if s.format == ansibleINI {
+		data = s.ini(groups)
+	} else if data, err = s.yaml(groups); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("falha ao gravar %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Hosts de cada grupo, na ordem em que terminaram.
+func (s *ansibleSink) groups() map[string][]ansibleHost {
+	groups := map[string][]ansibleHost{}
+	for _, h := range s.hosts {
+		g := ansibleGroup("range", h.rng)
+		groups[g] = append(groups[g], h)
+		if s.byVendor && h.vendor != "" {
+			g = ansibleGroup("vendor", h.vendor)
+			groups[g] = append(groups[g], h)
+		}
+	}
+	return groups
+}
+
+// Nome de grupo válido no Ansible: "range_10_91_50_1_14", "vendor_cisco".
+func ansibleGroup(prefix, name string) string {
+	return prefix + "_" + strings.Trim(ansibleGroupChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+// Inventário YAML. As variáveis ficam no grupo do range; nos grupos de
+// fabricante o host aparece sem variáveis.
+func (s *ansibleSink) yaml(groups map[string][]ansibleHost) ([]byte, error) {
+	children := map[string]interface{}{}
+	for g, hosts := range groups {
+		entries := map[string]interface{}{}
+		for _, h := range hosts {
+			if strings.HasPrefix(g, "range_") {
+				entries[h.name] = h.vars
+			} else {
+				entries[h.name] = map[string]string{}
+			}
+		}
+		children[g] = map[string]interface{}{"hosts": entries}
+	}
+	inventory := map[string]interface{}{"all": map[string]interface{}{"children": children}}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(inventory); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// Inventário INI, para ferramentas antigas: uma seção por grupo, com as
+// variáveis na linha do host na seção do range.
+func (s *ansibleSink) ini(groups map[string][]ansibleHost) []byte {
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	for i, g := range names {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", g)
+		for _, h := range groups[g] {
+			b.WriteString(h.name)
+			if strings.HasPrefix(g, "range_") {
+				keys := make([]string, 0, len(h.vars))
+				for k := range h.vars {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					fmt.Fprintf(&b, " %s=%s", k, iniValue(h.vars[k]))
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.Bytes()
+}
+
+// Valor de variável no INI do Ansible, entre aspas quando tiver espaços,
+// aspas ou caracteres especiais. Quebras de linha do sysDescr viram espaços.
+func iniValue(v string) string {
+	v = strings.Join(strings.Fields(v), " ")
+	if v != "" && !strings.ContainsAny(v, " \"'\\#;=") {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
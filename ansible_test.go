@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/snmpinfo"
+)
+
+// Hosts de teste: sysDescr com quebra de linha, aspas e dois-pontos, um
+// sysName repetido e um host sem nome, que fica fora do inventário.
+var ansibleResults = []discovery.HostResult{
+	{IP: "10.0.0.1", Range: "10.0.0.0/24", HostID: "10101", SNMP: snmpinfo.Info{SysName: "sw-core-01", SysDescr: "Cisco IOS Software\r\nVersion 15.2: \"release\" #1", SysObjectID: "1.3.6.1.4.1.9.1.1208"}},
+	{IP: "10.0.0.2", Range: "10.0.0.0/24", SNMP: snmpinfo.Info{SysName: "sw-core-01"}},
+	{IP: "10.1.0.5", Range: "10.1.0.1-10", SNMP: snmpinfo.Info{SysName: "fw-edge", SysDescr: "key=value; comentário"}},
+	{IP: "10.1.0.6", Range: "10.1.0.1-10"},
+}
+
+func writeAnsible(t *testing.T, format string) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "inventory")
+	sink := newAnsibleSink(path, format, true)
+	for _, r := range ansibleResults {
+		if err := sink.write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.close(discovery.Summary{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestAnsibleYAMLParses(t *testing.T) {
+	data := writeAnsible(t, ansibleYAML)
+	// O formato que o ansible-inventory aceita: all.children.<grupo>.hosts.<host> com as variáveis
+	var inv struct {
+		All struct {
+			Children map[string]struct {
+				Hosts map[string]map[string]string `yaml:"hosts"`
+			} `yaml:"children"`
+		} `yaml:"all"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&inv); err != nil {
+		t.Fatalf("inventário YAML inválido: %v\n%s", err, data)
+	}
+	groups := inv.All.Children
+	if len(groups) != 3 {
+		t.Errorf("esperava os grupos dos dois ranges e um de fabricante, obteve %v", groups)
+	}
+	core := groups["range_10_0_0_0_24"].Hosts
+	if len(core) != 2 || core["10.0.0.2"] == nil {
+		t.Errorf("esperava o sysName repetido pelo IP, obteve %v", core)
+	}
+	vars := core["sw-core-01"]
+	if vars["ansible_host"] != "10.0.0.1" || vars["sysdescr"] != ansibleResults[0].SNMP.SysDescr || vars["zabbix_hostid"] != "10101" || vars["snmp_community_macro"] != snmpCommunityMacro {
+		t.Errorf("variáveis do host incorretas: %v", vars)
+	}
+	edge := groups["range_10_1_0_1_10"].Hosts
+	if len(edge) != 1 || edge["fw-edge"]["sysdescr"] != "key=value; comentário" {
+		t.Errorf("grupo do segundo range incorreto: %v", edge)
+	}
+	if _, ok := groups["vendor_cisco"].Hosts["sw-core-01"]; !ok {
+		t.Errorf("esperava sw-core-01 no grupo do fabricante, obteve %v", groups["vendor_cisco"])
+	}
+}
+
+func TestAnsibleINI(t *testing.T) {
+	data := string(writeAnsible(t, ansibleINI))
+	for _, want := range []string{
+		"[range_10_0_0_0_24]\nsw-core-01 ansible_host=10.0.0.1 ",
+		`sysdescr="Cisco IOS Software Version 15.2: \"release\" #1"`,
+		"\n10.0.0.2 ansible_host=10.0.0.2 ",
+		`sysdescr="key=value; comentário"`,
+		"[vendor_cisco]\nsw-core-01\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("esperava %q no inventário INI:\n%s", want, data)
+		}
+	}
+	if strings.Contains(data, "10.1.0.6") {
+		t.Errorf("host sem nome não deveria entrar no inventário:\n%s", data)
+	}
+}
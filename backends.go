@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/logx"
+	"discoveryhosts/zabbix"
+)
+
+// Backend que só registra no log os hosts que seriam cadastrados, sem
+// cadastrar nada: os hosts saem como no dry-run. Útil para testar os ranges
+// e os filtros, sozinho ou ao lado dos outros backends.
+const backendLog = "log"
+
+// Backends de cadastro, pelo nome em backends, e o construtor de cada um; o
+// zabbix com zabbix_targets gera um backend por servidor. Os demais nomes de
+// backends (netbox, webhook, consul) são sinks, que recebem os resultados do
+// cadastro.
+var backendRegistry = map[string]func(Config) []discovery.Backend{
+	backendZabbix: func(c Config) []discovery.Backend {
+		var backends []discovery.Backend
+		for _, t := range c.zabbixServers() {
+			backends = append(backends, discovery.NewBackend(t))
+		}
+		if len(backends) == 0 {
+			backends = append(backends, discovery.NewBackend(discovery.ZabbixTarget{
+				Name:     backendZabbix,
+				Zabbix:   zabbix.NewClient(c.ZabbixURL, c.ZabbixUser, c.ZabbixPass, time.Duration(c.ZabbixTimeout)),
+				GroupIDs: c.ZabbixGroupIDs,
+				ProxyID:  c.ZabbixProxyID,
+			}))
+		}
+		return backends
+	},
+	backendLibreNMS: func(c Config) []discovery.Backend {
+		return []discovery.Backend{discovery.NewBackend(discovery.ZabbixTarget{Name: backendLibreNMS, Zabbix: newLibreNMSCreator(c.LibreNMS)})}
+	},
+	backendIcinga2: func(c Config) []discovery.Backend {
+		return []discovery.Backend{discovery.NewBackend(discovery.ZabbixTarget{Name: backendIcinga2, Zabbix: newIcinga2Creator(c.Icinga2)})}
+	},
+	backendLog: func(Config) []discovery.Backend {
+		return []discovery.Backend{logBackend{}}
+	},
+}
+
+// Nomes de backends que cadastram os hosts, na ordem da configuração.
+func (c Config) registrationNames() []string {
+	var names []string
+	for _, b := range c.Backends {
+		if backendRegistry[b] != nil {
+			names = append(names, b)
+		}
+	}
+	return names
+}
+
+// Indica se o cadastro passa pela lista de backends do discovery: com mais de
+// um backend de cadastro, com range_backends ou com o log. Um backend só vai
+// direto no cliente (ou nos servidores de zabbix_targets), como antes.
+func (c Config) multipleBackends() bool {
+	names := c.registrationNames()
+	return len(names) > 1 || len(c.RangeBackends) > 0 || (len(names) == 1 && names[0] == backendLog)
+}
+
+// Backends do cadastro no formato do discovery; nil sem multipleBackends.
+func (c Config) registrationBackends() []discovery.Backend {
+	if !c.multipleBackends() {
+		return nil
+	}
+	var backends []discovery.Backend
+	for _, name := range c.registrationNames() {
+		backends = append(backends, backendRegistry[name](c)...)
+	}
+	return backends
+}
+
+// range_backends pelos nomes dos backends do discovery: o zabbix com
+// zabbix_targets vira os seus servidores.
+func (c Config) rangeBackends() map[string][]string {
+	if len(c.RangeBackends) == 0 {
+		return nil
+	}
+	ranges := make(map[string][]string, len(c.RangeBackends))
+	for rng, names := range c.RangeBackends {
+		list := []string{}
+		for _, name := range names {
+			if name != backendZabbix || len(c.ZabbixTargets) == 0 {
+				list = append(list, name)
+				continue
+			}
+			for _, t := range c.ZabbixTargets {
+				list = append(list, strings.TrimSpace(t.Name))
+			}
+		}
+		ranges[strings.TrimSpace(rng)] = list
+	}
+	return ranges
+}
+
+// Confere range_backends: ranges de ranges e, em cada um, backends de
+// cadastro que estejam em backends, sem repetições.
+func (c Config) validateRangeBackends() []error {
+	var errs []error
+	ranges := map[string]bool{}
+	for _, r := range c.Ranges {
+		ranges[strings.TrimSpace(r)] = true
+	}
+	for rng, names := range c.RangeBackends {
+		key := "range_backends." + rng
+		if !ranges[strings.TrimSpace(rng)] {
+			errs = append(errs, fmt.Errorf("range_backends: o range %q não está em ranges%s", rng, c.origin(key)))
+		}
+		seen := map[string]bool{}
+		for _, name := range names {
+			switch {
+			case backendRegistry[name] == nil:
+				errs = append(errs, fmt.Errorf("range_backends: %q não é um backend de cadastro (use zabbix, librenms, icinga2 ou log)%s", name, c.origin(key)))
+			case !c.backend(name):
+				errs = append(errs, fmt.Errorf("range_backends: o backend %s do range %q não está em backends%s", name, rng, c.origin(key)))
+			case seen[name]:
+				errs = append(errs, fmt.Errorf("range_backends: backend %s repetido no range %q%s", name, rng, c.origin(key)))
+			}
+			seen[name] = true
+		}
+	}
+	return errs
+}
+
+// Backend log do registro: implementa discovery.Backend sem cadastrar nada.
+type logBackend struct{}
+
+func (logBackend) Name() string {
+	return backendLog
+}
+
+func (logBackend) Ensure(ctx context.Context, spec zabbix.HostSpec) (discovery.Outcome, error) {
+	iface := spec.Interface
+	if iface == "" {
+		iface = zabbix.InterfaceSNMP
+	}
+	var services []string
+	for _, t := range spec.Tags {
+		if t.Tag == "service" {
+			services = append(services, t.Value)
+		}
+	}
+	logx.FromContext(ctx, rootLog.With("ip", spec.IP, "range", spec.Range)).With("stage", backendLog).Infof("log.host", spec.Name, spec.IP, spec.Range, iface, strings.Join(services, ","))
+	return discovery.Outcome{Action: discovery.ZabbixDryRun}, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/snmpinfo"
+	"discoveryhosts/zabbix"
+)
+
+// Versão do formato do cache_file.
+const cacheVersion = 1
+
+// Hosts processados com sucesso (SNMP e cadastro no Zabbix) nos últimos runs.
+// Um host do cache dentro do cache_ttl só faz o ping no run seguinte.
+type hostCache struct {
+	Version    int                   `json:"version"`
+	ConfigHash string                `json:"config_hash"`
+	Hosts      map[string]cacheEntry `json:"hosts"`
+}
+
+type cacheEntry struct {
+	SysName     string    `json:"sysname"`
+	SysDescr    string    `json:"sysdescr,omitempty"`
+	SNMPVersion string    `json:"snmp_version,omitempty"`
+	HostID      string    `json:"hostid"`
+	Processed   time.Time `json:"processed"` // último processamento completo
+}
+
+func (c Config) validateCache() []error {
+	if c.CacheFile != "" && c.CacheTTL <= 0 {
+		return []error{fmt.Errorf("cache_ttl deve ser positivo com cache_file (atual: %s)%s", c.CacheTTL, c.origin("cache_ttl"))}
+	}
+	return nil
+}
+
+// Hash dos campos que mudam o resultado do SNMP ou do cadastro: se algum
+// mudar, o cache inteiro é descartado.
+func cacheHash(cfg Config) string {
+	h := sha256.New()
+	for _, v := range []string{
+		cfg.ZabbixURL,
+		strings.Join(cfg.SNMPCommunities, "\x00"),
+		strings.Join(cfg.ZabbixGroupIDs, ","),
+		cfg.ZabbixProxyID,
+		cfg.LibreNMS.URL,
+		cfg.Icinga2.URL,
+	} {
+		fmt.Fprintf(h, "%s\n", v)
+	}
+	for _, t := range cfg.ZabbixTargets {
+		fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n", t.Name, t.URL, strings.Join(t.GroupIDs, ","), t.ProxyID, strings.Join(t.TemplateIDs, ","))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Carrega o cache. Arquivo ausente, corrompido, de outra versão ou de outra
+// configuração resulta num cache vazio (um run completo), nunca num erro.
+func loadHostCache(path string, cfg Config) *hostCache {
+	empty := &hostCache{Version: cacheVersion, ConfigHash: cacheHash(cfg), Hosts: map[string]cacheEntry{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		logInfo("cache.none", path)
+		return empty
+	}
+	if err != nil {
+		logWarn("cache.unusable", path, err)
+		return empty
+	}
+	var c hostCache
+	switch err := json.Unmarshal(data, &c); {
+	case err != nil:
+		logWarn("cache.unusable", path, fmt.Errorf("arquivo corrompido: %w", err))
+		return empty
+	case c.Version != cacheVersion:
+		logWarn("cache.unusable", path, fmt.Errorf("versão %d (suportada: %d)", c.Version, cacheVersion))
+		return empty
+	case c.ConfigHash != empty.ConfigHash:
+		logInfo("cache.invalidated", path)
+		return empty
+	}
+	if c.Hosts == nil {
+		c.Hosts = map[string]cacheEntry{}
+	}
+	return &c
+}
+
+// Hosts do cache processados há menos de ttl, no formato do discovery.
+func (c *hostCache) fresh(ttl time.Duration) map[string]discovery.CachedHost {
+	hosts := map[string]discovery.CachedHost{}
+	for ip, e := range c.Hosts {
+		if time.Since(e.Processed) >= ttl || e.SysName == "" {
+			continue
+		}
+		hosts[ip] = discovery.CachedHost{
+			SNMP:   snmpinfo.Info{SysName: e.SysName, SysDescr: e.SysDescr, Version: e.SNMPVersion},
+			HostID: e.HostID,
+		}
+	}
+	return hosts
+}
+
+// Atualiza o cache com os hosts do run e o grava no close: os processados com
+// sucesso entram (ou têm o horário renovado), os que falharam saem, e os que
+// vieram do cache ficam como estavam, para que o ttl conte do último
+// processamento completo.
+type cacheSink struct {
+	path  string
+	ttl   time.Duration
+	cache *hostCache
+}
+
+func newCacheSink(path string, ttl time.Duration, cache *hostCache) *cacheSink {
+	return &cacheSink{path: path, ttl: ttl, cache: cache}
+}
+
+func (s *cacheSink) write(r discovery.HostResult) error {
+	switch {
+	case r.ZabbixAction == discovery.ZabbixCached:
+	case r.Err() == nil && (r.ZabbixAction == zabbix.Created || r.ZabbixAction == zabbix.Existing || r.ZabbixAction == zabbix.Upgraded):
+		s.cache.Hosts[r.IP] = cacheEntry{
+			SysName:     r.SNMP.SysName,
+			SysDescr:    r.SNMP.SysDescr,
+			SNMPVersion: r.SNMP.Version,
+			HostID:      r.HostID,
+			Processed:   time.Now(),
+		}
+	default:
+		delete(s.cache.Hosts, r.IP)
+	}
+	return nil
+}
+
+func (s *cacheSink) close(discovery.Summary) error {
+	for ip, e := range s.cache.Hosts {
+		if time.Since(e.Processed) >= s.ttl {
+			delete(s.cache.Hosts, ip)
+		}
+	}
+	if err := writeJSONFile(s.path, s.cache); err != nil {
+		return fmt.Errorf("falha ao gravar o cache %s: %w", s.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/snmpinfo"
+)
+
+// Versão do formato do arquivo de checkpoint.
+const checkpointVersion = 1
+
+// Estado de um run em andamento, gravado periodicamente para que um run
+// interrompido (reboot, OOM, sinal) possa continuar com -resume. Guarda todos
+// os IPs concluídos, inclusive os que não responderam.
+type checkpoint struct {
+	Version    int              `json:"version"`
+	RunID      string           `json:"run_id"`
+	ConfigHash string           `json:"config_hash"`
+	Updated    time.Time        `json:"updated"`
+	Hosts      []checkpointHost `json:"hosts"`
+}
+
+// Resultado de um IP no checkpoint. A community não é gravada; ela só é
+// necessária até o cadastro no Zabbix, que já aconteceu.
+type checkpointHost struct {
+	IP           string       `json:"ip"`
+	Range        string       `json:"range"`
+	Alive        bool         `json:"alive,omitempty"`
+	SysName      string       `json:"sysname,omitempty"`
+	SysDescr     string       `json:"sysdescr,omitempty"`
+	SysObjectID  string       `json:"sysobjectid,omitempty"`
+	SysLocation  string       `json:"syslocation,omitempty"`
+	SNMPVersion  string       `json:"snmp_version,omitempty"`
+	SNMPError    string       `json:"snmp_error,omitempty"`
+	SNMPReason   string       `json:"snmp_reason,omitempty"`
+	ZabbixAction string       `json:"zabbix_action,omitempty"`
+	HostID       string       `json:"hostid,omitempty"`
+	ZabbixError  string       `json:"zabbix_error,omitempty"`
+	PingMS       int64        `json:"ping_ms,omitempty"`
+	SNMPMS       int64        `json:"snmp_ms,omitempty"`
+	ZabbixMS     int64        `json:"zabbix_ms,omitempty"`
+	Attempts     int          `json:"attempts,omitempty"`
+	TimedOut     bool         `json:"timed_out,omitempty"`
+	Agent        string       `json:"agent,omitempty"`
+	FallbackName string       `json:"fallback_name,omitempty"`
+	Known        string       `json:"known,omitempty"`
+	PortScanned  bool         `json:"port_scanned,omitempty"`
+	OpenPorts    []int        `json:"open_ports,omitempty"`
+	ScanMS       int64        `json:"scan_ms,omitempty"`
+	Targets      []jsonTarget `json:"zabbix_targets,omitempty"`
+}
+
+func newCheckpointHost(r discovery.HostResult) checkpointHost {
+	h := checkpointHost{
+		IP:           r.IP,
+		Range:        r.Range,
+		Alive:        r.Alive,
+		SysName:      r.SNMP.SysName,
+		SysDescr:     r.SNMP.SysDescr,
+		SysObjectID:  r.SNMP.SysObjectID,
+		SysLocation:  r.SNMP.SysLocation,
+		SNMPVersion:  r.SNMP.Version,
+		SNMPReason:   r.SNMPReason,
+		ZabbixAction: r.ZabbixAction,
+		HostID:       r.HostID,
+		PingMS:       r.PingTime.Milliseconds(),
+		SNMPMS:       r.SNMPTime.Milliseconds(),
+		ZabbixMS:     r.ZabbixTime.Milliseconds(),
+		Attempts:     r.Attempts,
+		TimedOut:     r.TimedOut,
+		Agent:        r.Agent,
+		FallbackName: r.FallbackName,
+		Known:        r.Known,
+		PortScanned:  r.PortScanned,
+		OpenPorts:    r.OpenPorts,
+		ScanMS:       r.ScanTime.Milliseconds(),
+		Targets:      newJSONTargets(r.Targets),
+	}
+	if r.SNMPErr != nil {
+		h.SNMPError = r.SNMPErr.Error()
+	}
+	if r.ZabbixErr != nil {
+		h.ZabbixError = r.ZabbixErr.Error()
+	}
+	return h
+}
+
+func (h checkpointHost) result() discovery.HostResult {
+	r := discovery.HostResult{
+		IP:           h.IP,
+		Range:        h.Range,
+		Alive:        h.Alive,
+		SNMP:         snmpinfo.Info{SysName: h.SysName, SysDescr: h.SysDescr, SysObjectID: h.SysObjectID, SysLocation: h.SysLocation, Version: h.SNMPVersion},
+		SNMPReason:   h.SNMPReason,
+		ZabbixAction: h.ZabbixAction,
+		HostID:       h.HostID,
+		PingTime:     time.Duration(h.PingMS) * time.Millisecond,
+		SNMPTime:     time.Duration(h.SNMPMS) * time.Millisecond,
+		ZabbixTime:   time.Duration(h.ZabbixMS) * time.Millisecond,
+		Attempts:     h.Attempts,
+		TimedOut:     h.TimedOut,
+		Agent:        h.Agent,
+		FallbackName: h.FallbackName,
+		Known:        h.Known,
+		PortScanned:  h.PortScanned,
+		OpenPorts:    h.OpenPorts,
+		ScanTime:     time.Duration(h.ScanMS) * time.Millisecond,
+		Targets:      targetResults(h.Targets),
+	}
+	if h.SNMPError != "" {
+		r.SNMPErr = &snmpinfo.Error{Reason: h.SNMPReason, Err: errors.New(h.SNMPError)}
+	}
+	if h.ZabbixError != "" {
+		r.ZabbixErr = errors.New(h.ZabbixError)
+	}
+	return r
+}
+
+// Lê um checkpoint e confere se ele foi criado com a mesma configuração
+// efetiva; com force, a diferença só gera um aviso.
+func loadCheckpoint(path string, cfg Config, force bool) ([]discovery.HostResult, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao ler o checkpoint: %w", err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s inválido: %w", path, err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("checkpoint %s tem versão %d; esta versão lê apenas a %d", path, cp.Version, checkpointVersion)
+	}
+	if hash := configHash(cfg); cp.ConfigHash != hash {
+		if !force {
+			return nil, fmt.Errorf("checkpoint %s foi criado com outra configuração (%s, atual %s); use -force para retomar mesmo assim", path, cp.ConfigHash, hash)
+		}
+		logWarn("checkpoint.config_changed", path)
+	}
+	results := make([]discovery.HostResult, len(cp.Hosts))
+	for i, h := range cp.Hosts {
+		results[i] = h.result()
+	}
+	logInfo("checkpoint.resuming", path, cp.RunID, len(results), cp.Updated.Format(time.RFC3339))
+	return results, nil
+}
+
+// Acumula os resultados do run e grava o checkpoint a cada intervalo. Roda no
+// goroutine do coletor, que entrega os resultados um a um.
+type checkpointWriter struct {
+	path     string
+	interval time.Duration
+	cp       checkpoint
+	saved    time.Time
+}
+
+func newCheckpointWriter(path string, interval time.Duration, cfg Config, runID string) *checkpointWriter {
+	return &checkpointWriter{
+		path:     path,
+		interval: interval,
+		cp:       checkpoint{Version: checkpointVersion, RunID: runID, ConfigHash: configHash(cfg)},
+		saved:    time.Now(),
+	}
+}
+
+func (w *checkpointWriter) add(r discovery.HostResult) {
+	w.cp.Hosts = append(w.cp.Hosts, newCheckpointHost(r))
+	if time.Since(w.saved) < w.interval {
+		return
+	}
+	if err := w.save(); err != nil {
+		logError("checkpoint.save_failed", w.path, err)
+	}
+}
+
+func (w *checkpointWriter) save() error {
+	w.saved = time.Now()
+	w.cp.Updated = w.saved
+	data, err := json.Marshal(w.cp)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(w.path, data, 0600)
+}
+
+// No fim do run: um run interrompido ou cortado pelo max_run_duration grava o estado final para o -resume; um
+// run completo remove o checkpoint, que não tem mais o que retomar.
+func (w *checkpointWriter) finish(s discovery.Summary) {
+	if s.Partial() {
+		if err := w.save(); err != nil {
+			logError("checkpoint.save_failed", w.path, err)
+			return
+		}
+		logWarn("checkpoint.saved", w.path, len(w.cp.Hosts), s.TargetsExpanded)
+		return
+	}
+	if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+		logWarn("checkpoint.remove_failed", w.path, err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// Cores ANSI da saída no terminal.
+type termColor string
+
+const (
+	colorRed    termColor = "\033[31m"
+	colorYellow termColor = "\033[33m"
+	colorGreen  termColor = "\033[32m"
+	colorReset            = "\033[0m"
+)
+
+// Se a saída padrão e a de erro recebem cores; definido por setupColor.
+var colorStdout, colorStderr bool
+
+// Liga as cores nas saídas que são um terminal, exceto com -no-color ou com a
+// variável NO_COLOR definida (https://no-color.org).
+func setupColor(disabled bool) {
+	if disabled || os.Getenv("NO_COLOR") != "" {
+		colorStdout, colorStderr = false, false
+		return
+	}
+	colorStdout, colorStderr = isTerminal(os.Stdout), isTerminal(os.Stderr)
+}
+
+// Indica se w recebe cores: só a saída padrão e a de erro (também por trás da
+// barra de progresso), nunca um arquivo ou um destino duplicado para um.
+func colorFor(w io.Writer) bool {
+	switch w {
+	case os.Stdout:
+		return colorStdout
+	case os.Stderr:
+		return colorStderr
+	}
+	if b, ok := w.(*barLogWriter); ok {
+		return colorFor(b.w)
+	}
+	return false
+}
+
+// s na cor c, se on.
+func paint(on bool, c termColor, s string) string {
+	if !on || c == "" || s == "" {
+		return s
+	}
+	return string(c) + s + colorReset
+}
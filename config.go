@@ -0,0 +1,694 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"discoveryhosts/iprange"
+	"discoveryhosts/zabbix"
+)
+
+// Config representa o formato do arquivo discovery.conf
+type Config struct {
+	ConfigVersion        int                      `json:"config_version" yaml:"config_version" toml:"config_version"`
+	ZabbixURL            string                   `json:"zabbix_url" yaml:"zabbix_url" toml:"zabbix_url"`
+	ZabbixUser           string                   `json:"zabbix_user" yaml:"zabbix_user" toml:"zabbix_user"`
+	ZabbixPass           string                   `json:"zabbix_pass" yaml:"zabbix_pass" toml:"zabbix_pass"`
+	ZabbixGroupIDs       []string                 `json:"zabbix_group_ids" yaml:"zabbix_group_ids" toml:"zabbix_group_ids"`
+	ZabbixProxyID        string                   `json:"zabbix_proxy_id" yaml:"zabbix_proxy_id" toml:"zabbix_proxy_id"`
+	ZabbixTimeout        Duration                 `json:"zabbix_timeout" yaml:"zabbix_timeout" toml:"zabbix_timeout"`
+	ZabbixTargets        []ZabbixTarget           `json:"zabbix_targets,omitempty" yaml:"zabbix_targets" toml:"zabbix_targets"`
+	SNMPCommunities      []string                 `json:"snmp_communities" yaml:"snmp_communities" toml:"snmp_communities"`
+	PingTimeout          Duration                 `json:"ping_timeout" yaml:"ping_timeout" toml:"ping_timeout"`
+	SNMPTimeout          Duration                 `json:"snmp_timeout" yaml:"snmp_timeout" toml:"snmp_timeout"`
+	MaxRunDuration       Duration                 `json:"max_run_duration,omitempty" yaml:"max_run_duration" toml:"max_run_duration"`
+	MaxRetries           int                      `json:"max_retries" yaml:"max_retries" toml:"max_retries"`
+	RetryDelay           Duration                 `json:"retry_delay" yaml:"retry_delay" toml:"retry_delay"`
+	Workers              int                      `json:"workers" yaml:"workers" toml:"workers"`
+	PingWorkers          int                      `json:"ping_workers" yaml:"ping_workers" toml:"ping_workers"`
+	SNMPWorkers          int                      `json:"snmp_workers" yaml:"snmp_workers" toml:"snmp_workers"`
+	ZabbixWorkers        int                      `json:"zabbix_workers" yaml:"zabbix_workers" toml:"zabbix_workers"`
+	ZabbixQueue          int                      `json:"zabbix_queue" yaml:"zabbix_queue" toml:"zabbix_queue"`
+	Ranges               []string                 `json:"ranges" yaml:"ranges" toml:"ranges" merge:"append"`
+	RangeSources         []string                 `json:"range_sources,omitempty" yaml:"range_sources" toml:"range_sources"`
+	PHPIPAM              PHPIPAM                  `json:"phpipam" yaml:"phpipam" toml:"phpipam"`
+	InterleaveRanges     bool                     `json:"interleave_ranges,omitempty" yaml:"interleave_ranges" toml:"interleave_ranges"`
+	IncludeSelf          bool                     `json:"include_self,omitempty" yaml:"include_self" toml:"include_self"`
+	RangeWorkers         map[string]int           `json:"range_workers,omitempty" yaml:"range_workers" toml:"range_workers"`
+	Agents               map[string]AgentEndpoint `json:"agents,omitempty" yaml:"agents" toml:"agents"`
+	AgentRanges          map[string]string        `json:"agent_ranges,omitempty" yaml:"agent_ranges" toml:"agent_ranges"`
+	Agent                Agent                    `json:"agent" yaml:"agent" toml:"agent"`
+	API                  API                      `json:"api" yaml:"api" toml:"api"`
+	SNMPTrap             SNMPTrap                 `json:"snmp_trap" yaml:"snmp_trap" toml:"snmp_trap"`
+	LogFile              string                   `json:"log_file,omitempty" yaml:"log_file" toml:"log_file"`
+	LogMaxSizeMB         int                      `json:"log_max_size_mb" yaml:"log_max_size_mb" toml:"log_max_size_mb"`
+	LogMaxBackups        int                      `json:"log_max_backups" yaml:"log_max_backups" toml:"log_max_backups"`
+	LogFileOnly          bool                     `json:"log_file_only,omitempty" yaml:"log_file_only" toml:"log_file_only"`
+	SyslogAddress        string                   `json:"syslog_address,omitempty" yaml:"syslog_address" toml:"syslog_address"`
+	SyslogFacility       string                   `json:"syslog_facility" yaml:"syslog_facility" toml:"syslog_facility"`
+	Notifications        Notifications            `json:"notifications" yaml:"notifications" toml:"notifications"`
+	SMTP                 SMTP                     `json:"smtp" yaml:"smtp" toml:"smtp"`
+	Backends             []string                 `json:"backends" yaml:"backends" toml:"backends"`
+	RangeBackends        map[string][]string      `json:"range_backends,omitempty" yaml:"range_backends" toml:"range_backends"`
+	NetBox               NetBox                   `json:"netbox" yaml:"netbox" toml:"netbox"`
+	LibreNMS             LibreNMS                 `json:"librenms" yaml:"librenms" toml:"librenms"`
+	Icinga2              Icinga2                  `json:"icinga2" yaml:"icinga2" toml:"icinga2"`
+	Webhook              Webhook                  `json:"webhook" yaml:"webhook" toml:"webhook"`
+	Consul               Consul                   `json:"consul" yaml:"consul" toml:"consul"`
+	MQTT                 MQTT                     `json:"mqtt" yaml:"mqtt" toml:"mqtt"`
+	Kafka                Kafka                    `json:"kafka" yaml:"kafka" toml:"kafka"`
+	Grafana              Grafana                  `json:"grafana" yaml:"grafana" toml:"grafana"`
+	NameFallback         NameFallback             `json:"name_fallback" yaml:"name_fallback" toml:"name_fallback"`
+	ZabbixSender         ZabbixSender             `json:"zabbix_sender" yaml:"zabbix_sender" toml:"zabbix_sender"`
+	LLD                  LLD                      `json:"lld" yaml:"lld" toml:"lld"`
+	PortScan             PortScan                 `json:"port_scan" yaml:"port_scan" toml:"port_scan"`
+	AdaptiveWorkers      AdaptiveWorkers          `json:"adaptive_workers" yaml:"adaptive_workers" toml:"adaptive_workers"`
+	OnDiscoveredCommand  string                   `json:"on_discovered_command,omitempty" yaml:"on_discovered_command" toml:"on_discovered_command"`
+	OnRunFinishedCommand string                   `json:"on_run_finished_command,omitempty" yaml:"on_run_finished_command" toml:"on_run_finished_command"`
+	HookTimeout          Duration                 `json:"hook_timeout" yaml:"hook_timeout" toml:"hook_timeout"`
+	HookConcurrency      int                      `json:"hook_concurrency" yaml:"hook_concurrency" toml:"hook_concurrency"`
+	CacheFile            string                   `json:"cache_file,omitempty" yaml:"cache_file" toml:"cache_file"`
+	CacheTTL             Duration                 `json:"cache_ttl" yaml:"cache_ttl" toml:"cache_ttl"`
+	KnownHostsFile       string                   `json:"known_hosts_file,omitempty" yaml:"known_hosts_file" toml:"known_hosts_file"`
+	KnownHostsMatch      []string                 `json:"known_hosts_match,omitempty" yaml:"known_hosts_match" toml:"known_hosts_match"`
+	KnownHostsColumns    map[string]string        `json:"known_hosts_columns,omitempty" yaml:"known_hosts_columns" toml:"known_hosts_columns"` // regra -> cabeçalho da coluna
+	KnownHostsDelimiter  string                   `json:"known_hosts_delimiter" yaml:"known_hosts_delimiter" toml:"known_hosts_delimiter"`
+	SnapshotFile         string                   `json:"snapshot_file,omitempty" yaml:"snapshot_file" toml:"snapshot_file"`
+	HistoryDB            string                   `json:"history_db,omitempty" yaml:"history_db" toml:"history_db"`
+	LockFile             string                   `json:"lock_file,omitempty" yaml:"lock_file" toml:"lock_file"`
+	SecretsFile          string                   `json:"secrets_file,omitempty" yaml:"secrets_file" toml:"secrets_file"`
+	StrictPermissions    bool                     `json:"strict_permissions,omitempty" yaml:"strict_permissions" toml:"strict_permissions"`
+	Include              []string                 `json:"include,omitempty" yaml:"include" toml:"include"`
+
+	// Campos do esquema versão 1, convertidos por migrateSchema
+	ZabbixGroupID string `json:"zabbix_group_id,omitempty" yaml:"zabbix_group_id" toml:"zabbix_group_id"`
+	SNMPCommunity string `json:"snmp_community,omitempty" yaml:"snmp_community" toml:"snmp_community"`
+
+	// Perfis nomeados (selecionados com --profile) que sobrescrevem campos
+	Profiles map[string]Config `json:"profiles,omitempty" yaml:"profiles" toml:"profiles"`
+
+	// Arquivo de origem de cada campo após o merge (ver configmerge.go)
+	sources map[string]string
+	// Chaves escritas no documento decodificado, como "name_fallback.enabled":
+	// no merge elas valem mesmo com o valor zero (ver markPresent)
+	present map[string]bool
+	// IPs reservados no phpIPAM, fora do run (ver withRangeSources)
+	excluded map[string]bool
+}
+
+// Valores mínimos aceitos para os timeouts; abaixo disso praticamente nenhum
+// host consegue responder e o scan reportaria a rede inteira como morta.
+const (
+	minPingTimeout   = 100 * time.Millisecond
+	minSNMPTimeout   = 100 * time.Millisecond
+	minZabbixTimeout = time.Second
+)
+
+// Folga somada ao prazo de cada host, além dos timeouts das etapas.
+const hostTimeoutMargin = 5 * time.Second
+
+// Limites usados para o número de workers: o automático é 4 por CPU até
+// maxAutoWorkers, e acima de highWorkersWarning avisamos, já que cada worker
+// implica sockets e processos de ping simultâneos.
+const (
+	workersPerCPU      = 4
+	maxAutoWorkers     = 64
+	highWorkersWarning = 1000
+)
+
+// Workers do cadastro quando zabbix_workers é omitido: poucos, independente
+// dos workers de ping e SNMP, pois a API do Zabbix não aguenta rajadas de
+// host.create.
+const defaultZabbixWorkers = 4
+
+// Configuração com os valores padrão usados para campos omitidos no arquivo.
+func defaultConfig() Config {
+	return Config{
+		ConfigVersion:       currentConfigVersion,
+		PingTimeout:         Duration(time.Second),
+		SNMPTimeout:         Duration(2 * time.Second),
+		ZabbixTimeout:       Duration(30 * time.Second),
+		RetryDelay:          Duration(30 * time.Second),
+		HookTimeout:         Duration(30 * time.Second),
+		HookConcurrency:     4,
+		ZabbixQueue:         1000,
+		CacheTTL:            Duration(24 * time.Hour),
+		KnownHostsDelimiter: ",",
+		LogMaxSizeMB:        100,
+		LogMaxBackups:       5,
+		SyslogFacility:      "daemon",
+		Notifications: Notifications{
+			Format:   notifyFormatJSON,
+			MaxHosts: 20,
+			Timeout:  Duration(10 * time.Second),
+		},
+		SMTP: SMTP{
+			Port:     587,
+			Security: smtpSTARTTLS,
+			Timeout:  Duration(30 * time.Second),
+		},
+		Backends: []string{backendZabbix},
+		NetBox: NetBox{
+			Tag:     "discovered",
+			Timeout: Duration(10 * time.Second),
+			Workers: 2,
+		},
+		LibreNMS: LibreNMS{
+			Timeout: Duration(30 * time.Second),
+		},
+		Icinga2: Icinga2{
+			Timeout: Duration(30 * time.Second),
+		},
+		Webhook: Webhook{
+			Method:     http.MethodPost,
+			BatchSize:  1,
+			Timeout:    Duration(10 * time.Second),
+			Retries:    2,
+			RetryDelay: Duration(2 * time.Second),
+			Workers:    2,
+		},
+		SNMPTrap: SNMPTrap{
+			DedupWindow: Duration(15 * time.Minute),
+			RateLimit:   10,
+			BatchDelay:  Duration(5 * time.Second),
+			MaxBatch:    100,
+		},
+		Consul: Consul{
+			Source:  "discoveryhosts",
+			Timeout: Duration(10 * time.Second),
+			Workers: 2,
+		},
+		MQTT: MQTT{
+			Topic:          "discovery/{range}/{ip}",
+			SummaryTopic:   "discovery/summary",
+			QoS:            1,
+			Buffer:         1000,
+			Timeout:        Duration(10 * time.Second),
+			KeepAlive:      Duration(60 * time.Second),
+			ReconnectDelay: Duration(5 * time.Second),
+		},
+		PHPIPAM: PHPIPAM{
+			TagField: "custom_discovery",
+			PageSize: 500,
+			Timeout:  Duration(30 * time.Second),
+		},
+		Kafka: Kafka{
+			ClientID:       "discoveryhosts",
+			Acks:           kafkaAcksAll,
+			Buffer:         1000,
+			BatchSize:      100,
+			Timeout:        Duration(10 * time.Second),
+			ReconnectDelay: Duration(5 * time.Second),
+		},
+		Grafana: Grafana{
+			Tags:    []string{"discovery"},
+			Timeout: Duration(10 * time.Second),
+		},
+		NameFallback: NameFallback{
+			Interface:  zabbix.InterfaceICMP,
+			Tag:        "discovery-fallback",
+			DNSTimeout: Duration(2 * time.Second),
+		},
+		ZabbixSender: ZabbixSender{
+			KeyPrefix: "discovery",
+			Timeout:   Duration(10 * time.Second),
+		},
+		PortScan: PortScan{
+			Ports:       []int{22, 80, 443, 8443},
+			Timeout:     Duration(500 * time.Millisecond),
+			Concurrency: 32,
+			Rate:        200,
+		},
+		LLD: LLD{
+			Key:     "discovery.lld",
+			Timeout: Duration(10 * time.Second),
+		},
+		AdaptiveWorkers: AdaptiveWorkers{
+			MinWorkers: 4,
+			Window:     Duration(30 * time.Second),
+		},
+		API: API{
+			MaxConcurrent: 2,
+			KeepScans:     100,
+		},
+		sources: map[string]string{},
+	}
+}
+
+// Valida a configuração, retornando todos os problemas encontrados.
+func (c Config) validate() error {
+	var errs []error
+	checkTimeout := func(name string, d Duration, minimum time.Duration) {
+		if time.Duration(d) < minimum {
+			errs = append(errs, fmt.Errorf("%s deve ser no mínimo %s (atual: %s)%s", name, minimum, d, c.origin(name)))
+		}
+	}
+	checkTimeout("ping_timeout", c.PingTimeout, minPingTimeout)
+	checkTimeout("snmp_timeout", c.SNMPTimeout, minSNMPTimeout)
+	checkTimeout("zabbix_timeout", c.ZabbixTimeout, minZabbixTimeout)
+	if c.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("max_retries não pode ser negativo (atual: %d)%s", c.MaxRetries, c.origin("max_retries")))
+	}
+	if c.RetryDelay < 0 {
+		errs = append(errs, fmt.Errorf("retry_delay não pode ser negativo (atual: %s)%s", c.RetryDelay, c.origin("retry_delay")))
+	}
+	if c.MaxRunDuration < 0 {
+		errs = append(errs, fmt.Errorf("max_run_duration não pode ser negativo (atual: %s)%s", c.MaxRunDuration, c.origin("max_run_duration")))
+	}
+	for _, w := range []struct {
+		key string
+		n   int
+	}{{"workers", c.Workers}, {"ping_workers", c.PingWorkers}, {"snmp_workers", c.SNMPWorkers}, {"zabbix_workers", c.ZabbixWorkers}} {
+		if w.n < 0 {
+			errs = append(errs, fmt.Errorf("%s não pode ser negativo (atual: %d)%s", w.key, w.n, c.origin(w.key)))
+		}
+	}
+	if c.ZabbixQueue < 1 {
+		errs = append(errs, fmt.Errorf("zabbix_queue deve ser no mínimo 1 (atual: %d)%s", c.ZabbixQueue, c.origin("zabbix_queue")))
+	}
+	if c.LogMaxSizeMB < 1 {
+		errs = append(errs, fmt.Errorf("log_max_size_mb deve ser no mínimo 1 (atual: %d)%s", c.LogMaxSizeMB, c.origin("log_max_size_mb")))
+	}
+	if c.LogMaxBackups < 0 {
+		errs = append(errs, fmt.Errorf("log_max_backups não pode ser negativo (atual: %d)%s", c.LogMaxBackups, c.origin("log_max_backups")))
+	}
+	if !validSyslogFacility(c.SyslogFacility) {
+		errs = append(errs, fmt.Errorf("syslog_facility desconhecida: %q (use daemon, user, local0 a local7...)%s", c.SyslogFacility, c.origin("syslog_facility")))
+	}
+	errs = append(errs, c.Notifications.validate(c)...)
+	errs = append(errs, c.SMTP.validate(c)...)
+	errs = append(errs, c.ZabbixSender.validate(c)...)
+	errs = append(errs, c.LLD.validate(c)...)
+	errs = append(errs, c.PortScan.validate(c)...)
+	errs = append(errs, c.validateBackends()...)
+	errs = append(errs, c.validateRangeBackends()...)
+	errs = append(errs, c.validateRangeSources()...)
+	errs = append(errs, c.PHPIPAM.validate(c)...)
+	errs = append(errs, c.NetBox.validate(c)...)
+	errs = append(errs, c.LibreNMS.validate(c)...)
+	errs = append(errs, c.Icinga2.validate(c)...)
+	errs = append(errs, c.Webhook.validate(c)...)
+	errs = append(errs, c.Consul.validate(c)...)
+	errs = append(errs, c.MQTT.validate(c)...)
+	errs = append(errs, c.Kafka.validate(c)...)
+	errs = append(errs, c.Grafana.validate(c)...)
+	errs = append(errs, c.NameFallback.validate(c)...)
+	errs = append(errs, c.AdaptiveWorkers.validate(c)...)
+	errs = append(errs, c.Agent.validate(c)...)
+	errs = append(errs, c.API.validate(c)...)
+	errs = append(errs, c.SNMPTrap.validate(c)...)
+	errs = append(errs, c.validateHooks()...)
+	errs = append(errs, c.validateCache()...)
+	errs = append(errs, c.validateKnownHosts()...)
+	errs = append(errs, c.validateAgents()...)
+	errs = append(errs, c.validateZabbixTargets()...)
+	for i, r := range c.Ranges {
+		if _, err := iprange.Parse(strings.TrimSpace(r)); err != nil {
+			errs = append(errs, fmt.Errorf("range %q: %v%s", r, err, c.origin(fmt.Sprintf("ranges[%d]", i))))
+		}
+	}
+	ranges := map[string]bool{}
+	for _, r := range c.Ranges {
+		ranges[strings.TrimSpace(r)] = true
+	}
+	for r, n := range c.RangeWorkers {
+		key := "range_workers." + r
+		if !ranges[strings.TrimSpace(r)] {
+			errs = append(errs, fmt.Errorf("range_workers: o range %q não está em ranges%s", r, c.origin(key)))
+		}
+		if n < 1 {
+			errs = append(errs, fmt.Errorf("range_workers: o range %q deve ter pelo menos 1 worker (atual: %d)%s", r, n, c.origin(key)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Prazo de um host somando o pior caso de cada etapa: o ping, a varredura de
+// portas, duas tentativas SNMP por community e as três chamadas à API do
+// Zabbix (login, host.get e host.create), mais uma folga.
+func (c Config) hostTimeout() time.Duration {
+	communities := max(len(c.SNMPCommunities), 1)
+	return time.Duration(c.PingTimeout) + c.PortScan.hostTime() +
+		2*time.Duration(communities)*time.Duration(c.SNMPTimeout) +
+		3*time.Duration(c.ZabbixTimeout) +
+		hostTimeoutMargin
+}
+
+// Número de workers efetivo: workers omitido ou 0 é derivado do número de CPUs.
+func (c Config) effectiveWorkers() int {
+	if c.Workers > 0 {
+		if c.Workers > highWorkersWarning {
+			logWarn("config.workers_high", c.Workers)
+		}
+		return c.Workers
+	}
+	workers := min(runtime.NumCPU()*workersPerCPU, maxAutoWorkers)
+	logInfo("config.workers_auto", workers, workersPerCPU, maxAutoWorkers)
+	return workers
+}
+
+// Workers do cadastro no Zabbix: zabbix_workers omitido ou 0 usa até
+// defaultZabbixWorkers, sem passar dos workers do run.
+func (c Config) zabbixWorkers(workers int) int {
+	if c.ZabbixWorkers > 0 {
+		return c.ZabbixWorkers
+	}
+	return min(workers, defaultZabbixWorkers)
+}
+
+// Secrets contém apenas os campos de credenciais, lidos do secrets_file e
+// aplicados por cima da configuração principal.
+type Secrets struct {
+	ZabbixUser      string   `json:"zabbix_user" yaml:"zabbix_user" toml:"zabbix_user"`
+	ZabbixPass      string   `json:"zabbix_pass" yaml:"zabbix_pass" toml:"zabbix_pass"`
+	SNMPCommunities []string `json:"snmp_communities" yaml:"snmp_communities" toml:"snmp_communities"`
+	SMTPUser        string   `json:"smtp_user" yaml:"smtp_user" toml:"smtp_user"`
+	SMTPPass        string   `json:"smtp_pass" yaml:"smtp_pass" toml:"smtp_pass"`
+
+	// Nome do esquema versão 1, ainda aceito no arquivo de segredos
+	SNMPCommunity string `json:"snmp_community" yaml:"snmp_community" toml:"snmp_community"`
+}
+
+// Formatos de configuração suportados
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatTOML = "toml"
+)
+
+// Detecta o formato pelo nome do arquivo; extensões desconhecidas caem em JSON
+// para manter compatibilidade com o discovery.conf original.
+func detectConfigFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".toml":
+		return formatTOML
+	default:
+		return formatJSON
+	}
+}
+
+// Decodifica o conteúdo do arquivo para v conforme o formato informado.
+func parseConfig(data []byte, format string, v interface{}) error {
+	switch format {
+	case formatJSON:
+		return unmarshalJSONC(data, v)
+	case formatYAML:
+		return yaml.Unmarshal(data, v)
+	case formatTOML:
+		return toml.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("formato de configuração desconhecido: %s", format)
+	}
+}
+
+// Opções de carregamento da configuração vindas da linha de comando.
+type loadOptions struct {
+	Format       string // json, yaml ou toml; vazio detecta pela extensão
+	AllowUnknown bool   // apenas avisa sobre chaves desconhecidas
+	Profile      string // perfil de profiles a aplicar sobre a configuração base
+	Remote       remoteOptions
+	Overrides    []string // chave=valor aplicados após o carregamento (--set)
+}
+
+// Decodifica data em v rejeitando chaves desconhecidas, exceto se allowUnknown.
+func decodeStrict(data []byte, format string, v interface{}, file string, allowUnknown bool) error {
+	if err := checkUnknownKeys(data, format, v, file, allowUnknown); err != nil {
+		return err
+	}
+	return parseConfig(data, format, v)
+}
+
+// Carrega um ou mais arquivos de configuração, aplicados em ordem (ver
+// mergeConfig), e depois as credenciais do secrets_file e referências cmd://.
+func loadConfig(paths []string, opts loadOptions) (Config, error) {
+	cfg := defaultConfig()
+	loaded := map[string]bool{}
+	var order []string
+	for _, path := range paths {
+		if err := loadConfigFile(path, opts.Format, opts, &cfg, loaded, &order, nil); err != nil {
+			return cfg, err
+		}
+	}
+	if len(order) > 1 {
+		logInfo("config.merge_order", strings.Join(order, " -> "))
+	}
+	if err := cfg.applyProfile(opts.Profile); err != nil {
+		return cfg, err
+	}
+
+	credentials := append([]string(nil), order...)
+	if cfg.SecretsFile != "" {
+		origin := cfg.sources["secrets_file"]
+		secretsPath := cfg.SecretsFile
+		if !filepath.IsAbs(secretsPath) && !isConfigURL(origin) {
+			secretsPath = filepath.Join(filepath.Dir(origin), secretsPath)
+		}
+		if src, ok := cfg.sources["zabbix_pass"]; ok && isPlainSecret(cfg.ZabbixPass) {
+			logWarn("config.plain_zabbix_pass", src, secretsPath)
+		}
+		if src, ok := cfg.sources["smtp.password"]; ok && isPlainSecret(cfg.SMTP.Password) {
+			logWarn("config.plain_smtp_pass", src, secretsPath)
+		}
+		for i, community := range cfg.SNMPCommunities {
+			if src, ok := cfg.sources[fmt.Sprintf("snmp_communities[%d]", i)]; ok && isPlainSecret(community) {
+				logWarn("config.plain_snmp_communities", src, secretsPath)
+				break
+			}
+		}
+		secrets, err := loadSecrets(secretsPath, opts.AllowUnknown)
+		if err != nil {
+			return cfg, err
+		}
+		secrets.apply(&cfg, secretsPath)
+		credentials = append(credentials, secretsPath)
+	}
+	if err := applyOverrides(&cfg, opts.Overrides); err != nil {
+		return cfg, err
+	}
+	if err := checkFilePermissions(credentials, cfg.StrictPermissions); err != nil {
+		return cfg, err
+	}
+	if err := resolveSecretRefs(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Indica se o valor é uma credencial em texto puro (e não uma referência cmd://).
+func isPlainSecret(value string) bool {
+	return value != "" && !strings.HasPrefix(value, secretCmdPrefix)
+}
+
+// Chaves de configuração que guardam credenciais, nunca exibidas em logs ou
+// mensagens de erro.
+var secretKeys = map[string]bool{
+	"zabbix_pass":               true,
+	"snmp_communities":          true,
+	"snmp_community":            true,
+	"smtp.password":             true,
+	"notifications.webhook_url": true,
+	"agent.token":               true,
+	"api.token":                 true,
+	"netbox.token":              true,
+	"librenms.token":            true,
+	"icinga2.password":          true,
+	"webhook.token":             true,
+	"webhook.password":          true,
+	"webhook.headers":           true,
+	"consul.token":              true,
+	"snmp_trap.communities":     true,
+	"snmp_trap.users":           true,
+	"mqtt.password":             true,
+	"kafka.password":            true,
+	"phpipam.password":          true,
+	"phpipam.token":             true,
+	"grafana.token":             true,
+	"zabbix_targets":            true,
+}
+
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "***"
+}
+
+// Cópia da configuração com as credenciais mascaradas, para uso em logs.
+func (c Config) redacted() Config {
+	c.ZabbixPass = maskSecret(c.ZabbixPass)
+	c.Notifications = c.Notifications.redacted()
+	c.SMTP = c.SMTP.redacted()
+	c.SNMPCommunity = maskSecret(c.SNMPCommunity)
+	c.Agent.Token = maskSecret(c.Agent.Token)
+	c.API.Token = maskSecret(c.API.Token)
+	c.NetBox = c.NetBox.redacted()
+	c.LibreNMS = c.LibreNMS.redacted()
+	c.Icinga2 = c.Icinga2.redacted()
+	c.Webhook = c.Webhook.redacted()
+	c.Consul = c.Consul.redacted()
+	c.SNMPTrap = c.SNMPTrap.redacted()
+	c.MQTT = c.MQTT.redacted()
+	c.Kafka = c.Kafka.redacted()
+	c.PHPIPAM = c.PHPIPAM.redacted()
+	c.Grafana = c.Grafana.redacted()
+	if c.Agents != nil {
+		agents := make(map[string]AgentEndpoint, len(c.Agents))
+		for name, e := range c.Agents {
+			agents[name] = e.redacted()
+		}
+		c.Agents = agents
+	}
+	if c.ZabbixTargets != nil {
+		targets := make([]ZabbixTarget, len(c.ZabbixTargets))
+		for i, t := range c.ZabbixTargets {
+			targets[i] = t.redacted()
+		}
+		c.ZabbixTargets = targets
+	}
+	if c.SNMPCommunities != nil {
+		communities := make([]string, len(c.SNMPCommunities))
+		for i, community := range c.SNMPCommunities {
+			communities[i] = maskSecret(community)
+		}
+		c.SNMPCommunities = communities
+	}
+	if c.Profiles != nil {
+		profiles := make(map[string]Config, len(c.Profiles))
+		for name, p := range c.Profiles {
+			profiles[name] = p.redacted()
+		}
+		c.Profiles = profiles
+	}
+	return c
+}
+
+// String mostra a configuração em JSON com as credenciais mascaradas, para
+// que um %v em log nunca exponha senhas ou communities.
+func (c Config) String() string {
+	data, err := json.Marshal(c.redacted())
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// LogValue garante o mascaramento também quando a configuração é passada
+// como campo de log.
+func (c Config) LogValue() slog.Value {
+	return slog.StringValue(c.String())
+}
+
+func (n Notifications) redacted() Notifications {
+	n.WebhookURL = maskSecret(n.WebhookURL)
+	return n
+}
+
+func (n Notifications) String() string {
+	return fmt.Sprintf("%+v", notificationsFields(n.redacted()))
+}
+
+func (n Notifications) LogValue() slog.Value { return slog.StringValue(n.String()) }
+
+func (m SMTP) redacted() SMTP {
+	m.Password = maskSecret(m.Password)
+	return m
+}
+
+func (m SMTP) String() string {
+	return fmt.Sprintf("%+v", smtpFields(m.redacted()))
+}
+
+func (m SMTP) LogValue() slog.Value { return slog.StringValue(m.String()) }
+
+func (s Secrets) String() string {
+	communities := make([]string, len(s.SNMPCommunities))
+	for i, community := range s.SNMPCommunities {
+		communities[i] = maskSecret(community)
+	}
+	return fmt.Sprintf("{ZabbixUser:%s ZabbixPass:%s SNMPCommunities:%v SMTPUser:%s SMTPPass:%s}",
+		s.ZabbixUser, maskSecret(s.ZabbixPass), communities, s.SMTPUser, maskSecret(s.SMTPPass))
+}
+
+func (s Secrets) LogValue() slog.Value { return slog.StringValue(s.String()) }
+
+// Tipos sem os métodos String, usados para formatar os campos sem recursão.
+type (
+	notificationsFields Notifications
+	smtpFields          SMTP
+)
+
+// Escreve a configuração efetiva (após merge, perfil e overrides) em JSON, com
+// credenciais mascaradas.
+func (c Config) writeEffective(w io.Writer) error {
+	c = c.redacted()
+	c.Include = nil
+	c.Profiles = nil
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(c)
+}
+
+// Lê o arquivo de segredos, recusando arquivos legíveis por qualquer usuário.
+func loadSecrets(path string, allowUnknown bool) (Secrets, error) {
+	var secrets Secrets
+	info, err := os.Stat(path)
+	if err != nil {
+		return secrets, fmt.Errorf("falha ao ler secrets_file %s: %w", path, err)
+	}
+	if fileExposure(info) == worldReadable {
+		return secrets, fmt.Errorf("secrets_file %s pode ser lido por qualquer usuário (permissão %04o); ajuste com chmod o-r", path, info.Mode().Perm())
+	}
+	logInfo("config.loading_secrets", path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return secrets, fmt.Errorf("falha ao ler secrets_file %s: %w", path, err)
+	}
+	if err := decodeStrict(data, detectConfigFormat(path), &secrets, path, allowUnknown); err != nil {
+		return secrets, fmt.Errorf("falha ao parsear secrets_file %s: %w", path, err)
+	}
+	return secrets, nil
+}
+
+// Sobrescreve na configuração os campos preenchidos no arquivo de segredos,
+// lido de path (o secrets_file já resolvido), que fica como a origem deles.
+func (s Secrets) apply(cfg *Config, path string) {
+	if s.ZabbixUser != "" {
+		cfg.ZabbixUser = s.ZabbixUser
+		cfg.sources["zabbix_user"] = path
+	}
+	if s.ZabbixPass != "" {
+		cfg.ZabbixPass = s.ZabbixPass
+		cfg.sources["zabbix_pass"] = path
+	}
+	if s.SMTPUser != "" {
+		cfg.SMTP.Username = s.SMTPUser
+		cfg.sources["smtp.username"] = path
+	}
+	if s.SMTPPass != "" {
+		cfg.SMTP.Password = s.SMTPPass
+		cfg.sources["smtp.password"] = path
+	}
+	communities := s.SNMPCommunities
+	if len(communities) == 0 && s.SNMPCommunity != "" {
+		communities = []string{s.SNMPCommunity}
+	}
+	if len(communities) > 0 {
+		cfg.SNMPCommunities = communities
+		cfg.sources["snmp_communities"] = path
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Escreve um arquivo de configuração em dir com permissão restrita.
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// A mesma configuração escrita em cada formato.
+var configFormats = map[string]string{
+	"discovery.json": `{
+		"zabbix_url": "http://zabbix.example/api_jsonrpc.php",
+		"zabbix_user": "discovery",
+		"zabbix_pass": "secret",
+		"zabbix_group_ids": ["2", "15"],
+		"zabbix_timeout": "20s",
+		"snmp_communities": ["public", "private"],
+		"ping_timeout": "1500ms",
+		"snmp_timeout": "3s",
+		"max_retries": 2,
+		"workers": 12,
+		"ranges": ["10.0.0.0/24", "192.168.1.10-20"],
+		"range_workers": {"10.0.0.0/24": 4},
+		"backends": ["zabbix"],
+		"name_fallback": {"enabled": true, "interface": "icmp"},
+		"port_scan": {"ports": [22, 443]}
+	}`,
+	"discovery.yaml": `
+zabbix_url: http://zabbix.example/api_jsonrpc.php
+zabbix_user: discovery
+zabbix_pass: secret
+zabbix_group_ids: ["2", "15"]
+zabbix_timeout: 20s
+snmp_communities:
+  - public
+  - private
+ping_timeout: 1500ms
+snmp_timeout: 3s
+max_retries: 2
+workers: 12
+ranges:
+  - 10.0.0.0/24
+  - 192.168.1.10-20
+range_workers:
+  10.0.0.0/24: 4
+backends: [zabbix]
+name_fallback:
+  enabled: true
+  interface: icmp
+port_scan:
+  ports: [22, 443]
+`,
+	"discovery.toml": `
+zabbix_url = "http://zabbix.example/api_jsonrpc.php"
+zabbix_user = "discovery"
+zabbix_pass = "secret"
+zabbix_group_ids = ["2", "15"]
+zabbix_timeout = "20s"
+snmp_communities = ["public", "private"]
+ping_timeout = "1500ms"
+snmp_timeout = "3s"
+max_retries = 2
+workers = 12
+ranges = ["10.0.0.0/24", "192.168.1.10-20"]
+backends = ["zabbix"]
+
+[range_workers]
+"10.0.0.0/24" = 4
+
+[name_fallback]
+enabled = true
+interface = "icmp"
+
+[port_scan]
+ports = [22, 443]
+`,
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	dir := t.TempDir()
+	loaded := map[string]Config{}
+	for name, content := range configFormats {
+		cfg, err := loadConfig([]string{writeConfig(t, dir, name, content)}, loadOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// A origem de cada campo é o próprio arquivo, diferente em cada formato
+		cfg.sources = nil
+		loaded[name] = cfg
+	}
+	want := loaded["discovery.json"]
+	if want.Workers != 12 || len(want.Ranges) != 2 || len(want.SNMPCommunities) != 2 {
+		t.Fatalf("configuração JSON carregada incorretamente: %+v", want)
+	}
+	for name, cfg := range loaded {
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%s difere do JSON:\n%+v\n%+v", name, cfg, want)
+		}
+	}
+}
+
+func TestLoadConfigExplicitFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "discovery.conf", configFormats["discovery.yaml"])
+	if _, err := loadConfig([]string{path}, loadOptions{}); err == nil {
+		t.Fatal("esperava erro ao ler YAML como JSON, o formato padrão")
+	}
+	cfg, err := loadConfig([]string{path}, loadOptions{Format: "yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Workers != 12 || cfg.ZabbixUser != "discovery" {
+		t.Errorf("configuração YAML carregada incorretamente: %+v", cfg)
+	}
+}
+
+func TestLoadConfigSecretsFile(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "secrets.yaml", "zabbix_pass: from-secrets\nsnmp_communities: [s1, s2]\n")
+	main := writeConfig(t, dir, "discovery.json", `{
+		"zabbix_user": "discovery",
+		"zabbix_pass": "from-main",
+		"snmp_communities": ["public"],
+		"ranges": ["10.0.0.0/30"],
+		"secrets_file": "secrets.yaml"
+	}`)
+	cfg, err := loadConfig([]string{main}, loadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// O arquivo de segredos prevalece; o que ele não define vem do principal
+	if cfg.ZabbixPass != "from-secrets" || !reflect.DeepEqual(cfg.SNMPCommunities, []string{"s1", "s2"}) || cfg.ZabbixUser != "discovery" {
+		t.Errorf("merge do secrets_file incorreto: pass %q, communities %v, user %q", cfg.ZabbixPass, cfg.SNMPCommunities, cfg.ZabbixUser)
+	}
+	if src := cfg.sources["zabbix_pass"]; src != filepath.Join(dir, "secrets.yaml") {
+		t.Errorf("esperava zabbix_pass vindo do secrets_file, obteve %q", src)
+	}
+
+	// --set é aplicado depois dos segredos
+	cfg, err = loadConfig([]string{main}, loadOptions{Overrides: []string{"zabbix_pass=from-set"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ZabbixPass != "from-set" {
+		t.Errorf("esperava o valor do --set, obteve %q", cfg.ZabbixPass)
+	}
+}
+
+func TestLoadConfigSecretsFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := writeConfig(t, dir, "missing.json", `{"ranges": ["10.0.0.0/30"], "secrets_file": "nao-existe.json"}`)
+	if _, err := loadConfig([]string{missing}, loadOptions{}); err == nil || !strings.Contains(err.Error(), "nao-existe.json") {
+		t.Errorf("esperava erro com o secrets_file ausente, obteve %v", err)
+	}
+
+	open := writeConfig(t, dir, "open.json", `{"zabbix_pass": "x"}`)
+	if err := os.Chmod(open, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	main := writeConfig(t, dir, "discovery.json", `{"ranges": ["10.0.0.0/30"], "secrets_file": "open.json"}`)
+	if _, err := loadConfig([]string{main}, loadOptions{}); err == nil || !strings.Contains(err.Error(), "qualquer usuário") {
+		t.Errorf("esperava erro com o secrets_file legível por todos, obteve %v", err)
+	}
+
+	// Legível pelo grupo: só um aviso, ou um erro com strict_permissions
+	if err := os.Chmod(open, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig([]string{main}, loadOptions{}); err != nil {
+		t.Errorf("esperava só um aviso com o secrets_file legível pelo grupo, obteve %v", err)
+	}
+	strict := writeConfig(t, dir, "strict.json", `{"ranges": ["10.0.0.0/30"], "secrets_file": "open.json", "strict_permissions": true}`)
+	if _, err := loadConfig([]string{strict}, loadOptions{}); err == nil || !strings.Contains(err.Error(), "open.json tem permissão 0640") {
+		t.Errorf("esperava erro com strict_permissions, obteve %v", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"JSON inválido", "a.json", `{"workers": }`, "linha 1"},
+		{"YAML inválido", "b.yaml", "ranges: [10.0.0.0/30\n", "falha ao parsear"},
+		{"TOML inválido", "c.toml", "workers = = 1\n", "falha ao parsear"},
+		{"chave desconhecida", "d.json", `{"worker": 4}`, "worker"},
+		{"duração inválida", "e.json", `{"ping_timeout": "um segundo"}`, "duração inválida"},
+		// O nome antigo, mais próximo, é recusado na versão atual
+		{"sugestão sem o nome antigo", "f.json", `{"snmp_comunity": "public"}`, `você quis dizer "snmp_communities"`},
+	}
+	for _, tt := range tests {
+		path := writeConfig(t, dir, tt.file, tt.content)
+		_, err := loadConfig([]string{path}, loadOptions{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: esperava erro com %q, obteve %v", tt.name, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Chave presente no arquivo que não corresponde a nenhum campo conhecido.
+type unknownKey struct {
+	Path       string
+	Suggestion string
+}
+
+func (k unknownKey) String() string {
+	if k.Suggestion != "" {
+		return fmt.Sprintf("%q (você quis dizer %q?)", k.Path, k.Suggestion)
+	}
+	return fmt.Sprintf("%q", k.Path)
+}
+
+// Erro retornado quando a configuração contém chaves desconhecidas.
+type unknownKeysError struct {
+	Keys []unknownKey
+}
+
+func (e *unknownKeysError) Error() string {
+	return fmt.Sprintf("chaves desconhecidas: %s (use --allow-unknown-config para ignorar)", e.keyList())
+}
+
+func (e *unknownKeysError) keyList() string {
+	names := make([]string, len(e.Keys))
+	for i, k := range e.Keys {
+		names[i] = k.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// Nome da chave de um campo, conforme a tag json (as tags yaml/toml são iguais).
+func fieldKey(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// Compara recursivamente as chaves decodificadas de forma genérica com os
+// campos do tipo de destino, retornando as que não existem no tipo.
+func findUnknownKeys(raw interface{}, t reflect.Type, prefix string) []unknownKey {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var unknown []unknownKey
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if key := fieldKey(f); key != "" && f.IsExported() {
+				fields[key] = f.Type
+			}
+		}
+		for key, value := range m {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			ft, ok := fields[key]
+			if !ok {
+				unknown = append(unknown, unknownKey{Path: path, Suggestion: closestKey(key, fields)})
+				continue
+			}
+			unknown = append(unknown, findUnknownKeys(value, ft, path)...)
+		}
+	case reflect.Map:
+		if m, ok := raw.(map[string]interface{}); ok {
+			for key, value := range m {
+				unknown = append(unknown, findUnknownKeys(value, t.Elem(), prefix+"."+key)...)
+			}
+		}
+	case reflect.Slice:
+		if items, ok := raw.([]interface{}); ok {
+			for i, item := range items {
+				unknown = append(unknown, findUnknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", prefix, i))...)
+			}
+		}
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Path < unknown[j].Path })
+	return unknown
+}
+
+// Sugere o campo conhecido mais próximo (distância de edição), se houver um
+// razoavelmente parecido. Os nomes antigos dos campos renomeados ficam de
+// fora: a versão atual do esquema os recusa.
+func closestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDist := "", -1
+	for name := range fields {
+		if renamedKey(name) {
+			continue
+		}
+		d := editDistance(key, name)
+		if bestDist < 0 || d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	limit := max(len(key)/3, 2)
+	if bestDist < 0 || bestDist > limit {
+		return ""
+	}
+	return best
+}
+
+// Distância de Levenshtein entre duas strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Verifica se o conteúdo contém chaves que não existem em v. Com allowUnknown
+// as chaves são apenas registradas em log.
+func checkUnknownKeys(data []byte, format string, v interface{}, file string, allowUnknown bool) error {
+	var raw interface{}
+	if err := parseConfig(data, format, &raw); err != nil {
+		return err
+	}
+	keys := findUnknownKeys(raw, reflect.TypeOf(v), "")
+	if len(keys) == 0 {
+		return nil
+	}
+	err := &unknownKeysError{Keys: keys}
+	if allowUnknown {
+		logWarn("config.unknown_keys_ignored", file, err.keyList())
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Carrega um arquivo e seus includes sobre cfg. Os includes são aplicados
+// antes do próprio arquivo, que assim sobrescreve a base compartilhada; stack
+// contém os arquivos em carregamento para detectar ciclos.
+func loadConfigFile(path, format string, opts loadOptions, cfg *Config, loaded map[string]bool, order *[]string, stack []string) error {
+	abs := path
+	if !isConfigURL(path) {
+		var err error
+		if abs, err = filepath.Abs(path); err != nil {
+			return err
+		}
+	}
+	for _, s := range stack {
+		if s == abs {
+			return fmt.Errorf("ciclo de include na configuração: %s -> %s", strings.Join(stack, " -> "), abs)
+		}
+	}
+	if loaded[abs] {
+		logWarn("config.include_repeated", path)
+		return nil
+	}
+	loaded[abs] = true
+
+	data, format, err := readConfigSource(path, format, opts.Remote)
+	if err != nil {
+		return fmt.Errorf("falha ao ler %s: %w", path, err)
+	}
+	logInfo("config.loading", path, format)
+	var fileCfg Config
+	if err := decodeStrict(data, format, &fileCfg, path, opts.AllowUnknown); err != nil {
+		return fmt.Errorf("falha ao parsear %s: %w", path, err)
+	}
+	if err := fileCfg.migrateSchema(path); err != nil {
+		return err
+	}
+	var raw interface{}
+	if err := parseConfig(data, format, &raw); err == nil {
+		fileCfg.markPresent(raw)
+	}
+
+	for _, inc := range fileCfg.Include {
+		if err := loadConfigFile(resolveInclude(path, inc), "", opts, cfg, loaded, order, append(stack, abs)); err != nil {
+			return err
+		}
+	}
+	mergeConfig(cfg, fileCfg, path, true)
+	*order = append(*order, path)
+	return nil
+}
+
+// Aplica src sobre dst: campos preenchidos ou escritos em src (como um
+// include_self: false sobre um true) sobrescrevem, listas marcadas com
+// merge:"append" (como ranges) são concatenadas, a não ser sem appendLists,
+// mapas são combinados por chave e seções são combinadas campo a campo. A
+// origem de cada valor fica registrada em dst.sources.
+func mergeConfig(dst *Config, src Config, file string, appendLists bool) {
+	mergeFields(dst.sources, src.present, reflect.ValueOf(dst).Elem(), reflect.ValueOf(src), "", file, appendLists)
+}
+
+// Registra as chaves escritas no documento (decodificado de forma genérica),
+// as da configuração e as de cada perfil. Sem isso o merge não distingue um
+// false ou 0 escrito de um campo ausente.
+func (c *Config) markPresent(raw interface{}) {
+	c.present = map[string]bool{}
+	presentKeys(raw, "", c.present)
+	profiles, _ := raw.(map[string]interface{})["profiles"].(map[string]interface{})
+	for name, p := range c.Profiles {
+		p.present = map[string]bool{}
+		presentKeys(profiles[name], "", p.present)
+		c.Profiles[name] = p
+	}
+}
+
+func presentKeys(raw interface{}, prefix string, keys map[string]bool) {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for k, v := range m {
+		keys[prefix+k] = true
+		presentKeys(v, prefix+k+".", keys)
+	}
+}
+
+func mergeFields(sources map[string]string, present map[string]bool, dv, sv reflect.Value, prefix, file string, appendLists bool) {
+	t := dv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := fieldKey(f)
+		if !f.IsExported() || key == "" || key == "include" {
+			continue
+		}
+		key = prefix + key
+		value := sv.Field(i)
+		if value.IsZero() && !present[key] {
+			continue
+		}
+		switch {
+		case f.Type.Kind() == reflect.Struct:
+			mergeFields(sources, present, dv.Field(i), value, key+".", file, appendLists)
+			continue
+		case f.Type.Kind() == reflect.Map:
+			if dv.Field(i).IsNil() {
+				dv.Field(i).Set(reflect.MakeMap(f.Type))
+			}
+			iter := value.MapRange()
+			for iter.Next() {
+				dv.Field(i).SetMapIndex(iter.Key(), iter.Value())
+				sources[fmt.Sprintf("%s.%v", key, iter.Key())] = file
+			}
+			continue
+		case f.Type.Kind() == reflect.Slice && appendLists && f.Tag.Get("merge") == "append":
+			base := dv.Field(i).Len()
+			for j := 0; j < value.Len(); j++ {
+				sources[fmt.Sprintf("%s[%d]", key, base+j)] = file
+			}
+			dv.Field(i).Set(reflect.AppendSlice(dv.Field(i), value))
+			continue
+		case f.Type.Kind() == reflect.Slice:
+			for j := 0; j < value.Len(); j++ {
+				sources[fmt.Sprintf("%s[%d]", key, j)] = file
+			}
+		}
+		dv.Field(i).Set(value)
+		sources[key] = file
+	}
+}
+
+// Nomes dos perfis definidos, em ordem alfabética.
+func (c Config) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Aplica o perfil escolhido sobre a configuração base. Listas do perfil
+// substituem as da base (um perfil "lab" não herda os ranges de produção).
+func (c *Config) applyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		available := "nenhum perfil definido"
+		if len(c.Profiles) > 0 {
+			available = "perfis disponíveis: " + strings.Join(c.profileNames(), ", ")
+		}
+		return fmt.Errorf("perfil desconhecido %q (%s)", name, available)
+	}
+	if len(profile.Profiles) > 0 || len(profile.Include) > 0 {
+		return fmt.Errorf("perfil %q: profiles e include não podem ser usados dentro de um perfil", name)
+	}
+	logInfo("config.profile_applied", name)
+	mergeConfig(c, profile, c.sources["profiles."+name]+" (perfil "+name+")", false)
+	return nil
+}
+
+// Sufixo " (em arquivo)" indicando de onde veio um campo, usado nas mensagens
+// de validação quando a configuração combina mais de um arquivo.
+func (c Config) origin(key string) string {
+	files := map[string]bool{}
+	for _, f := range c.sources {
+		files[f] = true
+	}
+	src, ok := c.sources[key]
+	if !ok || len(files) < 2 {
+		return ""
+	}
+	return fmt.Sprintf(" (em %s)", src)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigIncludePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yaml", "workers: 4\nsnmp_timeout: 5s\nranges: [10.0.0.0/30]\nzabbix_group_ids: [\"1\"]\n")
+	main := writeConfig(t, dir, "site.yaml", "include: [base.yaml]\nworkers: 16\nranges: [10.0.1.0/30]\n")
+	override := writeConfig(t, dir, "override.yaml", "zabbix_group_ids: [\"9\"]\n")
+
+	cfg, err := loadConfig([]string{main, override}, loadOptions{Overrides: []string{"workers=32"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// O arquivo sobrescreve o include, o arquivo seguinte sobrescreve os
+	// anteriores e o --set vale sobre todos; ranges são concatenados
+	if cfg.Workers != 32 {
+		t.Errorf("esperava workers do --set, obteve %d", cfg.Workers)
+	}
+	if cfg.SNMPTimeout.String() != "5s" {
+		t.Errorf("esperava snmp_timeout do include, obteve %s", cfg.SNMPTimeout)
+	}
+	if !reflect.DeepEqual(cfg.ZabbixGroupIDs, []string{"9"}) {
+		t.Errorf("esperava os grupos do último arquivo, obteve %v", cfg.ZabbixGroupIDs)
+	}
+	if !reflect.DeepEqual(cfg.Ranges, []string{"10.0.0.0/30", "10.0.1.0/30"}) {
+		t.Errorf("esperava os ranges concatenados, obteve %v", cfg.Ranges)
+	}
+
+	cfg, err = loadConfig([]string{main}, loadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Workers != 16 {
+		t.Errorf("esperava workers do arquivo sobre o include, obteve %d", cfg.Workers)
+	}
+}
+
+func TestLoadConfigIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := writeConfig(t, dir, "missing.yaml", "include: [nao-existe.yaml]\n")
+	if _, err := loadConfig([]string{missing}, loadOptions{}); err == nil || !strings.Contains(err.Error(), "nao-existe.yaml") {
+		t.Errorf("esperava erro com o include ausente, obteve %v", err)
+	}
+
+	writeConfig(t, dir, "a.yaml", "include: [b.yaml]\n")
+	b := writeConfig(t, dir, "b.yaml", "include: [a.yaml]\n")
+	if _, err := loadConfig([]string{b}, loadOptions{}); err == nil || !strings.Contains(err.Error(), "ciclo") {
+		t.Errorf("esperava erro de ciclo de include, obteve %v", err)
+	}
+}
+
+// Um false ou 0 escrito num arquivo, num include ou num perfil sobrescreve o
+// valor anterior; um campo ausente não.
+func TestLoadConfigZeroOverrides(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yaml", `
+include_self: true
+interleave_ranges: true
+strict_permissions: true
+max_retries: 3
+workers: 8
+name_fallback:
+  enabled: true
+ranges: [10.0.0.0/30]
+`)
+	site := writeConfig(t, dir, "site.yaml", `
+include: [base.yaml]
+include_self: false
+max_retries: 0
+name_fallback:
+  enabled: false
+profiles:
+  lab:
+    strict_permissions: false
+    workers: 0
+`)
+	override := writeConfig(t, dir, "override.json", `{"interleave_ranges": false}`)
+
+	cfg, err := loadConfig([]string{site}, loadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.IncludeSelf || cfg.MaxRetries != 0 || cfg.NameFallback.Enabled {
+		t.Errorf("esperava include_self, max_retries e name_fallback.enabled zerados pelo arquivo, obteve %v, %d e %v", cfg.IncludeSelf, cfg.MaxRetries, cfg.NameFallback.Enabled)
+	}
+	if !cfg.InterleaveRanges || !cfg.StrictPermissions || cfg.Workers != 8 {
+		t.Errorf("campos ausentes no arquivo não deveriam mudar o include: interleave %v, strict %v, workers %d", cfg.InterleaveRanges, cfg.StrictPermissions, cfg.Workers)
+	}
+	if src := cfg.sources["include_self"]; src != site {
+		t.Errorf("esperava include_self vindo de %s, obteve %q", site, src)
+	}
+
+	cfg, err = loadConfig([]string{site, override}, loadOptions{Profile: "lab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.InterleaveRanges {
+		t.Error("esperava interleave_ranges desligado pelo arquivo seguinte")
+	}
+	if cfg.StrictPermissions || cfg.Workers != 0 {
+		t.Errorf("esperava strict_permissions e workers zerados pelo perfil, obteve %v e %d", cfg.StrictPermissions, cfg.Workers)
+	}
+	if !reflect.DeepEqual(cfg.Ranges, []string{"10.0.0.0/30"}) {
+		t.Errorf("o perfil sem ranges não deveria mudar os ranges, obteve %v", cfg.Ranges)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"discoveryhosts/discovery"
+)
+
+// Destino do cadastro de um host na tabela do -confirm.
+type confirmDest struct {
+	name      string
+	groups    []string
+	templates []string
+}
+
+// Backends de cadastro do range, com os grupos e templates dos servidores
+// Zabbix.
+func (c Config) confirmDestinations(rng string) []confirmDest {
+	targets := map[string]ZabbixTarget{}
+	for _, t := range c.ZabbixTargets {
+		targets[strings.TrimSpace(t.Name)] = t
+	}
+	var dests []confirmDest
+	for _, name := range c.planBackends(rng) {
+		d := confirmDest{name: name}
+		if t, ok := targets[name]; ok {
+			d.groups, d.templates = t.GroupIDs, t.TemplateIDs
+		} else if name == backendZabbix {
+			d.groups = c.ZabbixGroupIDs
+		}
+		dests = append(dests, d)
+	}
+	return dests
+}
+
+// Mostra em out os hosts que serão cadastrados, com um destino por linha, e
+// pergunta se o cadastro deve continuar. Qualquer resposta que não seja sim,
+// ou o cancelamento de ctx durante a pergunta, é uma recusa.
+func confirmRegistration(ctx context.Context, cfg Config, in io.Reader, out io.Writer, hosts []discovery.HostResult) bool {
+	sorted := sortByIP(hosts)
+	fmt.Fprintln(out)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NOME\tIP\tRANGE\tDESTINO\tGRUPOS\tTEMPLATES")
+	dash := func(ids []string) string {
+		if len(ids) == 0 {
+			return "-"
+		}
+		return strings.Join(ids, ",")
+	}
+	for _, r := range sorted {
+		for _, d := range cfg.confirmDestinations(r.Range) {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Name(), r.IP, r.Range, d.name, dash(d.groups), dash(d.templates))
+		}
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "\n%d host(s) a cadastrar; os que já existirem não são alterados. Continuar? [s/N] ", len(hosts))
+
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(in).ReadString('\n')
+		answer <- line
+	}()
+	select {
+	case line := <-answer:
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "s", "sim", "y", "yes":
+			logInfo("confirm.accepted", len(hosts))
+			return true
+		}
+	case <-ctx.Done():
+		fmt.Fprintln(out)
+	}
+	logWarn("confirm.declined", len(hosts))
+	return false
+}
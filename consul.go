@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"discoveryhosts/consul"
+	"discoveryhosts/discovery"
+)
+
+const backendConsul = "consul"
+
+// Hosts aguardando o registro no Consul; com a fila cheia o host é
+// descartado (e contado), como no NetBox.
+const consulQueue = 1000
+
+// Campo de meta com o consul.source, que marca os nós registrados pelo
+// discovery: só esses são atualizados ou removidos.
+const consulManagedBy = "managed-by"
+
+// Limite de um valor de meta no Consul.
+const consulMaxMeta = 512
+
+// Chaves de meta aceitas pelo Consul (o prefixo consul- é reservado).
+var consulMetaKey = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+
+// Consul configura o registro dos hosts identificados (SNMP ok) como nós
+// externos no catálogo do Consul, com backend consul: o nome do nó é o
+// sysName, o endereço é o IP e o meta leva o range e o sysDescr. Um nó já
+// igual não é registrado de novo, para não mexer no catálogo a cada run.
+type Consul struct {
+	Address    string `json:"address,omitempty" yaml:"address" toml:"address"` // http(s)://consul:8500
+	Token      string `json:"token,omitempty" yaml:"token" toml:"token"`       // ACL token com node:write
+	Datacenter string `json:"datacenter,omitempty" yaml:"datacenter" toml:"datacenter"`
+	// Valor do meta managed-by dos nós deste discovery; instâncias com
+	// valores diferentes não mexem nos nós uma da outra
+	Source string `json:"source" yaml:"source" toml:"source"`
+	// Meta fixo somado ao de cada nó
+	Meta map[string]string `json:"meta,omitempty" yaml:"meta" toml:"meta"`
+	// Remove no fim de um run completo os nós deste discovery, nos ranges do
+	// run, cujo host não respondeu
+	DeregisterMissing bool     `json:"deregister_missing,omitempty" yaml:"deregister_missing" toml:"deregister_missing"`
+	Timeout           Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+	Workers           int      `json:"workers" yaml:"workers" toml:"workers"`
+}
+
+func (c Consul) validate(cfg Config) []error {
+	if !cfg.backend(backendConsul) {
+		return nil
+	}
+	var errs []error
+	if !isConfigURL(c.Address) {
+		errs = append(errs, fmt.Errorf("consul.address é obrigatório com o backend consul e deve ser uma URL http(s)://%s", cfg.origin("consul.address")))
+	}
+	if strings.TrimSpace(c.Source) == "" || len(c.Source) > consulMaxMeta {
+		errs = append(errs, fmt.Errorf("consul.source não pode ser vazio nem passar de %d caracteres%s", consulMaxMeta, cfg.origin("consul.source")))
+	}
+	for k, v := range c.Meta {
+		switch {
+		case !consulMetaKey.MatchString(k) || strings.HasPrefix(k, "consul-"):
+			errs = append(errs, fmt.Errorf("consul.meta: chave inválida %q (letras, dígitos, '_' ou '-', sem o prefixo consul-)%s", k, cfg.origin("consul.meta."+k)))
+		case consulReservedMeta[k]:
+			errs = append(errs, fmt.Errorf("consul.meta: a chave %q é preenchida pelo discovery%s", k, cfg.origin("consul.meta."+k)))
+		case len(v) > consulMaxMeta:
+			errs = append(errs, fmt.Errorf("consul.meta.%s passa de %d caracteres%s", k, consulMaxMeta, cfg.origin("consul.meta."+k)))
+		}
+	}
+	if time.Duration(c.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("consul.timeout deve ser positivo%s", cfg.origin("consul.timeout")))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Errorf("consul.workers deve ser no mínimo 1 (atual: %d)%s", c.Workers, cfg.origin("consul.workers")))
+	}
+	return errs
+}
+
+func (c Consul) redacted() Consul {
+	c.Token = maskSecret(c.Token)
+	return c
+}
+
+// Campos de meta preenchidos a partir do host.
+var consulReservedMeta = map[string]bool{
+	consulManagedBy:   true,
+	"external-node":   true,
+	"external-probe":  true,
+	"discovery-range": true,
+	"sysdescr":        true,
+	"sysobjectid":     true,
+	"location":        true,
+}
+
+func (c Consul) client() *consul.Client {
+	return consul.NewClient(c.Address, c.Token, c.Datacenter, time.Duration(c.Timeout))
+}
+
+// Nó do catálogo de um host identificado.
+func (c Consul) node(r discovery.HostResult) consul.Node {
+	meta := maps.Clone(c.Meta)
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	meta[consulManagedBy] = c.Source
+	// Nó sem agente do Consul: o external-probe=false deixa o
+	// consul-esm fora dele, já que o monitoramento é do Zabbix
+	meta["external-node"] = "true"
+	meta["external-probe"] = "false"
+	meta["discovery-range"] = r.Range
+	for k, v := range map[string]string{"sysdescr": r.SNMP.SysDescr, "sysobjectid": r.SNMP.SysObjectID, "location": r.SNMP.SysLocation} {
+		if v = strings.Join(strings.Fields(v), " "); v != "" {
+			if len(v) > consulMaxMeta {
+				v = strings.ToValidUTF8(v[:consulMaxMeta], "")
+			}
+			meta[k] = v
+		}
+	}
+	return consul.Node{Node: strings.TrimSpace(r.SNMP.SysName), Address: r.IP, Meta: meta}
+}
+
+// Contadores dos registros no Consul de um run.
+type consulStats struct {
+	registered, updated, unchanged, conflicts, failed, deregistered, dropped int
+}
+
+// Registra no Consul os hosts identificados, por consul.workers goroutines.
+// Conflitos e falhas só geram log e contadores; não mudam o resultado dos
+// hosts nem o do cadastro no Zabbix. No close, com deregister_missing e um
+// run completo, remove os nós deste discovery que sumiram.
+type consulSink struct {
+	cfg    Consul
+	ranges map[string]bool
+	client *consul.Client
+
+	queue   chan discovery.HostResult
+	workers sync.WaitGroup
+	mu      sync.Mutex
+	stats   consulStats
+	names   map[string]string // nó -> IP registrado neste run
+	alive   map[string]bool   // IPs que responderam ao ping
+}
+
+func newConsulSink(cfg Config) *consulSink {
+	s := &consulSink{
+		cfg:    cfg.Consul,
+		ranges: map[string]bool{},
+		client: cfg.Consul.client(),
+		queue:  make(chan discovery.HostResult, consulQueue),
+		names:  map[string]string{},
+		alive:  map[string]bool{},
+	}
+	for _, r := range cfg.Ranges {
+		s.ranges[strings.TrimSpace(r)] = true
+	}
+	for i := 0; i < s.cfg.Workers; i++ {
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			for r := range s.queue {
+				s.sync(r)
+			}
+		}()
+	}
+	return s
+}
+
+func (s *consulSink) write(r discovery.HostResult) error {
+	if r.Alive {
+		s.mu.Lock()
+		s.alive[r.IP] = true
+		s.mu.Unlock()
+	}
+	if r.SNMPErr != nil || strings.TrimSpace(r.SNMP.SysName) == "" {
+		return nil
+	}
+	select {
+	case s.queue <- r:
+	default:
+		s.mu.Lock()
+		s.stats.dropped++
+		first := s.stats.dropped == 1
+		s.mu.Unlock()
+		if first {
+			logWarn("consul.queue_full", consulQueue)
+		}
+	}
+	return nil
+}
+
+func (s *consulSink) close(sum discovery.Summary) error {
+	close(s.queue)
+	s.workers.Wait()
+	if s.cfg.DeregisterMissing {
+		if sum.Partial() || sum.Targeted || s.stats.dropped > 0 {
+			logWarn("consul.deregister_skipped")
+		} else {
+			s.deregisterMissing()
+		}
+	}
+	st := s.stats
+	rootLog.Summaryf("summary.consul", st.registered, st.updated, st.unchanged, st.conflicts, st.failed, st.deregistered)
+	if st.dropped > 0 {
+		logWarn("consul.dropped", st.dropped)
+	}
+	return nil
+}
+
+// Registra o nó do host, se ainda não estiver igual no catálogo. Um nó com o
+// mesmo nome que não é deste discovery, ou que já foi registrado com outro IP
+// neste run (sysName repetido), não é alterado.
+func (s *consulSink) sync(r discovery.HostResult) {
+	hl := rootLog.With("ip", r.IP, "range", r.Range).With("stage", backendConsul)
+	node := s.cfg.node(r)
+	s.mu.Lock()
+	prev, dup := s.names[node.Node]
+	if !dup {
+		s.names[node.Node] = r.IP
+	}
+	s.mu.Unlock()
+	if dup {
+		s.count(func(st *consulStats) { st.conflicts++ })
+		hl.Warnf("consul.duplicate_name", node.Node, r.IP, prev)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.Timeout))
+	defer cancel()
+	current, err := s.client.Node(ctx, node.Node)
+	if err != nil {
+		s.count(func(st *consulStats) { st.failed++ })
+		hl.WithErr(err).Errorf("consul.failed", node.Node, r.IP, err)
+		return
+	}
+	switch {
+	case current != nil && current.Meta[consulManagedBy] != s.cfg.Source:
+		s.count(func(st *consulStats) { st.conflicts++ })
+		hl.Warnf("consul.conflict", node.Node, r.IP, current.Address)
+		return
+	case current != nil && current.Address == node.Address && maps.Equal(current.Meta, node.Meta):
+		s.count(func(st *consulStats) { st.unchanged++ })
+		hl.Debugf("consul.unchanged", node.Node, r.IP)
+		return
+	}
+	if err := s.client.Register(ctx, node); err != nil {
+		s.count(func(st *consulStats) { st.failed++ })
+		hl.WithErr(err).Errorf("consul.failed", node.Node, r.IP, err)
+		return
+	}
+	if current == nil {
+		s.count(func(st *consulStats) { st.registered++ })
+		hl.Infof("consul.registered", node.Node, r.IP)
+	} else {
+		s.count(func(st *consulStats) { st.updated++ })
+		hl.Infof("consul.updated", node.Node, r.IP)
+	}
+}
+
+func (s *consulSink) count(f func(*consulStats)) {
+	s.mu.Lock()
+	f(&s.stats)
+	s.mu.Unlock()
+}
+
+// Remove os nós deste discovery, em ranges do run, que não foram registrados
+// agora e cujo IP não respondeu. Um host que respondeu ao ping mas não ao
+// SNMP continua no catálogo.
+func (s *consulSink) deregisterMissing() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.Timeout))
+	defer cancel()
+	nodes, err := s.client.Nodes(ctx, consulManagedBy, s.cfg.Source)
+	if err != nil {
+		logError("consul.list_failed", err)
+		return
+	}
+	for _, n := range nodes {
+		if _, ok := s.names[n.Node]; ok || s.alive[n.Address] || !s.ranges[n.Meta["discovery-range"]] {
+			continue
+		}
+		if err := s.client.Deregister(ctx, n.Node); err != nil {
+			s.stats.failed++
+			logError("consul.deregister_failed", n.Node, n.Address, err)
+			continue
+		}
+		s.stats.deregistered++
+		logInfo("consul.deregistered", n.Node, n.Address)
+	}
+}
@@ -0,0 +1,156 @@
+// Package consul implementa o cliente mínimo da API de catálogo do Consul
+// usado para registrar os hosts descobertos como nós externos.
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPError é uma resposta de erro da API, com o início do corpo.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("API do Consul respondeu HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("API do Consul respondeu HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// Client é um cliente mínimo do catálogo do Consul, num datacenter.
+type Client struct {
+	url        string
+	token      string
+	datacenter string // vazio: o do agente consultado
+	http       *http.Client
+}
+
+// NewClient cria um cliente para o endereço HTTP do Consul
+// (http://consul:8500). token é o ACL token, enviado em X-Consul-Token.
+func NewClient(address, token, datacenter string, timeout time.Duration) *Client {
+	return &Client{url: strings.TrimRight(address, "/"), token: token, datacenter: datacenter, http: &http.Client{Timeout: timeout}}
+}
+
+// Node é um nó do catálogo.
+type Node struct {
+	Node    string            `json:"Node"`
+	Address string            `json:"Address"`
+	Meta    map[string]string `json:"Meta"`
+}
+
+// Faz uma chamada à API; result pode ser nil. O datacenter do cliente, se
+// houver, entra na query.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.datacenter != "" {
+		query.Set("dc", c.datacenter)
+	}
+	u := c.url + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("resposta inválida da API do Consul em %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// Leader retorna o endereço do líder do cluster (GET /v1/status/leader), para
+// conferir a conexão.
+func (c *Client) Leader(ctx context.Context) (string, error) {
+	var leader string
+	if err := c.do(ctx, http.MethodGet, "/v1/status/leader", nil, nil, &leader); err != nil {
+		return "", err
+	}
+	return leader, nil
+}
+
+// Node retorna o nó com esse nome, ou nil se não houver nenhum.
+func (c *Client) Node(ctx context.Context, name string) (*Node, error) {
+	// Um nó inexistente vem como null
+	var found *struct {
+		Node *Node `json:"Node"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/catalog/node/"+url.PathEscape(name), nil, nil, &found); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return found.Node, nil
+}
+
+// Nodes lista os nós com o valor no campo de meta.
+func (c *Client) Nodes(ctx context.Context, metaKey, metaValue string) ([]Node, error) {
+	var nodes []Node
+	q := url.Values{"node-meta": {metaKey + ":" + metaValue}}
+	if err := c.do(ctx, http.MethodGet, "/v1/catalog/nodes", q, nil, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// Register registra (ou substitui) o nó externo, sem serviços.
+func (c *Client) Register(ctx context.Context, n Node) error {
+	body := map[string]interface{}{
+		"Node":     n.Node,
+		"Address":  n.Address,
+		"NodeMeta": n.Meta,
+	}
+	if c.datacenter != "" {
+		body["Datacenter"] = c.datacenter
+	}
+	return c.do(ctx, http.MethodPut, "/v1/catalog/register", nil, body, nil)
+}
+
+// Deregister remove o nó do catálogo, com os serviços e checks dele.
+func (c *Client) Deregister(ctx context.Context, name string) error {
+	body := map[string]interface{}{"Node": name}
+	if c.datacenter != "" {
+		body["Datacenter"] = c.datacenter
+	}
+	return c.do(ctx, http.MethodPut, "/v1/catalog/deregister", nil, body, nil)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"discoveryhosts/discovery"
+)
+
+// Destino dos resultados por host. write recebe apenas os IPs que
+// responderam, sempre a partir de um único goroutine; close é chamado ao fim
+// do run com o resumo.
+type resultSink interface {
+	write(r discovery.HostResult) error
+	close(s discovery.Summary) error
+}
+
+// Sinks que seguram arquivos temporários, conexões ou goroutines implementam
+// abort, chamado no lugar do close quando o run falha antes de terminar: libera
+// tudo sem gravar as saídas.
+type sinkAborter interface {
+	abort()
+}
+
+// Libera os sinks de um run que não chegou ao fim.
+func abortSinks(sinks []resultSink) {
+	for _, sink := range sinks {
+		if a, ok := sink.(sinkAborter); ok {
+			a.abort()
+		}
+	}
+}
+
+var csvHeader = []string{
+	"ip", "alive_by", "sysname", "sysdescr", "snmp_version_used",
+	"zabbix_action", "zabbix_hostid", "error", "duration_ms", "range",
+	"ping_ms", "snmp_ms", "zabbix_ms", "attempts", "open_ports", "zabbix_targets",
+}
+
+// Exporta os resultados em CSV. As linhas vão para um temporário no mesmo
+// diretório, renomeado para o destino só no close.
+type csvSink struct {
+	path string
+	tmp  *os.File
+	w    *csv.Writer
+}
+
+func newCSVSink(path string) (*csvSink, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, fmt.Errorf("falha ao criar %s: %w", path, err)
+	}
+	s := &csvSink{path: path, tmp: tmp, w: csv.NewWriter(tmp)}
+	if err := s.w.Write(csvHeader); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *csvSink) write(r discovery.HostResult) error {
+	return s.w.Write(csvRecord(r))
+}
+
+// Linha do CSV de um host, na ordem de csvHeader.
+func csvRecord(r discovery.HostResult) []string {
+	errText := ""
+	if err := r.Err(); err != nil {
+		errText = err.Error()
+	}
+	return []string{
+		r.IP,
+		"ping",
+		r.SNMP.SysName,
+		r.SNMP.SysDescr,
+		r.SNMP.Version,
+		r.ZabbixAction,
+		r.HostID,
+		errText,
+		strconv.FormatInt(r.Duration().Milliseconds(), 10),
+		r.Range,
+		strconv.FormatInt(r.PingTime.Milliseconds(), 10),
+		strconv.FormatInt(r.SNMPTime.Milliseconds(), 10),
+		strconv.FormatInt(r.ZabbixTime.Milliseconds(), 10),
+		strconv.Itoa(r.Attempts),
+		joinPorts(r.OpenPorts, ";"),
+		targetActions(r),
+	}
+}
+
+func (s *csvSink) close(discovery.Summary) error {
+	s.w.Flush()
+	err := s.w.Error()
+	if err == nil {
+		err = s.tmp.Chmod(0o644)
+	}
+	if closeErr := s.tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(s.tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(s.tmp.Name())
+		return fmt.Errorf("falha ao gravar %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *csvSink) abort() {
+	s.tmp.Close()
+	os.Remove(s.tmp.Name())
+}
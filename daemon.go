@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/i18n"
+	"discoveryhosts/snmptrap"
+)
+
+// Processo residente do -daemon: um scan por ciclo da agenda, nunca dois ao
+// mesmo tempo. Todo o estado (configuração, ciclo atual) é alterado apenas
+// pelo loop de run; o scan roda em um goroutine próprio.
+type daemon struct {
+	cf     *configFlags
+	of     outputFlags
+	cfg    Config
+	sched  schedule
+	jitter time.Duration
+	strict bool
+
+	cycle   int     // ciclos iniciados
+	skipped int     // ciclos ignorados porque o anterior ainda rodava
+	pending *Config // configuração recarregada, aplicada no próximo ciclo
+
+	// Configuração do último ciclo, com os ranges do phpIPAM, usada nos
+	// scans por trap
+	resolved Config
+	// Receptor de traps (snmp_trap.listen), nil sem ele
+	traps     chan snmptrap.Trap
+	trap      *trapState
+	trapScans int // scans por trap iniciados
+
+	// Notificações ao systemd, nil fora de uma unidade Type=notify
+	notifier *systemdNotifier
+}
+
+// Estado de um scan em andamento.
+type daemonScan struct {
+	cycle    int
+	trap     bool // scan dirigido pelos traps, fora da agenda
+	start    time.Time
+	done     chan int // código de saída do ciclo
+	progress *discovery.Progress
+}
+
+// Intervalo das atualizações do STATUS= no systemd durante um scan.
+const systemdStatusInterval = 5 * time.Second
+
+// Executa os ciclos até um SIGINT/SIGTERM. O primeiro sinal para de agendar e
+// espera o scan atual terminar; o segundo interrompe o scan (resumo parcial,
+// exitInterrupted); o terceiro encerra na hora.
+func (d *daemon) run() int {
+	signals := make(chan os.Signal, 3)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	snapshots := make(chan os.Signal, 1)
+	notifyProgressSignal(snapshots)
+	defer signal.Stop(snapshots)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logInfo("daemon.started", d.sched, d.jitter)
+	d.resolved = d.cfg
+	if t := d.cfg.SNMPTrap; t.Listen != "" {
+		d.traps = make(chan snmptrap.Trap, trapQueue)
+		d.trap = &trapState{cfg: t, ranges: localRangeIndex(d.cfg), seen: map[string]time.Time{}}
+		listener, err := t.listen(d.traps)
+		if err != nil {
+			logError("trap.listen_failed", t.Listen, err)
+			return exitFatal
+		}
+		defer listener.Close()
+		logInfo("trap.listening", t.Listen, t.DedupWindow, t.RateLimit, t.BatchDelay)
+	}
+	base := time.Now()
+	if _, ok := d.sched.(intervalSchedule); !ok {
+		base = d.sched.next(base)
+	}
+	next := d.withJitter(base)
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	logInfo("daemon.next", d.cycle+1, next.Format(time.RFC3339))
+
+	// Pronto para o systemd com a configuração validada e o receptor de traps
+	// escutando; o watchdog só recebe pings com este loop respondendo
+	d.notifier = newSystemdNotifier()
+	alive, stopWatchdog := make(chan struct{}), make(chan struct{})
+	defer close(stopWatchdog)
+	go d.notifier.runWatchdog(alive, stopWatchdog)
+	var statusTick <-chan time.Time
+	if d.notifier != nil {
+		ticker := time.NewTicker(systemdStatusInterval)
+		defer ticker.Stop()
+		statusTick = ticker.C
+		logInfo("systemd.ready", d.notifier.watchdog)
+	}
+	d.notifier.notify("READY=1", "STATUS="+i18n.T("systemd.status_waiting", d.cycle+1, next.Format(time.RFC3339)))
+
+	var scan *daemonScan
+	var scanDone chan int          // nil sem scan em andamento
+	var trapBatch <-chan time.Time // espera do batch_delay, nil sem traps na fila
+	due := false                   // ciclo agendado aguardando o scan por trap
+	stopping, exit := 0, exitOK
+	for {
+		select {
+		case <-timer.C:
+			switch {
+			case scan != nil && scan.trap:
+				// Um scan por trap é curto: o ciclo espera em vez de ser perdido
+				due = true
+				logInfo("daemon.cycle_delayed", d.cycle+1)
+			case scan != nil:
+				d.skipped++
+				logWarn("daemon.skipped", scan.cycle, time.Since(scan.start).Round(time.Second))
+			default:
+				if scan = d.startCycle(ctx); scan != nil {
+					scanDone = scan.done
+				}
+			}
+			// Horários perdidos (scan longo, máquina suspensa) não se acumulam
+			if base = d.sched.next(base); !base.After(time.Now()) {
+				base = d.sched.next(time.Now())
+			}
+			next = d.withJitter(base)
+			timer.Reset(time.Until(next))
+			logInfo("daemon.next", d.cycle+1, next.Format(time.RFC3339))
+			if scan == nil {
+				d.notifier.status(i18n.T("systemd.status_waiting", d.cycle+1, next.Format(time.RFC3339)))
+			}
+
+		case code := <-scanDone:
+			if scan.trap {
+				logInfo("trap.scan_done", d.trapScans, time.Since(scan.start).Round(time.Second), code)
+			} else {
+				logInfo("daemon.cycle_done", scan.cycle, time.Since(scan.start).Round(time.Second), code, d.skipped)
+			}
+			scan, scanDone = nil, nil
+			if stopping > 0 {
+				if code == exitInterrupted {
+					exit = code
+				}
+				logInfo("daemon.stopped", d.cycle)
+				return exit
+			}
+			switch {
+			case due:
+				due = false
+				if scan = d.startCycle(ctx); scan != nil {
+					scanDone = scan.done
+				}
+			case d.trap != nil && len(d.trap.queued) > 0 && trapBatch == nil:
+				trapBatch = time.After(time.Duration(d.trap.cfg.BatchDelay))
+			}
+			if scan == nil {
+				d.notifier.status(i18n.T("systemd.status_waiting", d.cycle+1, next.Format(time.RFC3339)))
+			}
+
+		case <-statusTick:
+			if scan != nil {
+				d.notifier.status(d.scanStatus(scan))
+			}
+
+		case <-alive:
+			// Ping do watchdog: basta o loop ter recebido
+
+		case <-snapshots:
+			d.logSnapshot(scan, next)
+
+		case t := <-d.traps:
+			// Com um scan em andamento o IP fica na fila até ele terminar
+			if stopping == 0 && d.trap.add(t) && scan == nil && trapBatch == nil {
+				trapBatch = time.After(time.Duration(d.trap.cfg.BatchDelay))
+			}
+
+		case <-trapBatch:
+			trapBatch = nil
+			if scan != nil || stopping > 0 {
+				continue
+			}
+			if ips := d.trap.take(); len(ips) > 0 {
+				if scan = d.startTrapScan(ctx, ips); scan != nil {
+					scanDone = scan.done
+				}
+			}
+
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if stopping == 0 {
+					d.reload()
+				}
+				continue
+			}
+			stopping++
+			if stopping == 1 {
+				d.notifier.notify("STOPPING=1", "STATUS="+i18n.T("systemd.status_stopping"))
+			}
+			switch {
+			case stopping == 1 && scan == nil:
+				logInfo("daemon.stopped", d.cycle)
+				return exitOK
+			case stopping == 1:
+				timer.Stop()
+				logWarn("daemon.stopping", sig, scan.cycle)
+			case stopping == 2:
+				logWarn("run.interrupting", sig)
+				cancel()
+			default:
+				logError("run.forced_exit", sig)
+				return exitInterrupted
+			}
+		}
+	}
+}
+
+// Horário de início com o atraso aleatório do -jitter.
+func (d *daemon) withJitter(t time.Time) time.Time {
+	if d.jitter <= 0 {
+		return t
+	}
+	return t.Add(time.Duration(rand.Int63n(int64(d.jitter))))
+}
+
+// Inicia o scan de um novo ciclo, já com a configuração recarregada se houver.
+// Retorna nil se os sinks não puderem ser abertos; o ciclo conta como
+// executado e o daemon segue para o próximo.
+func (d *daemon) startCycle(ctx context.Context) *daemonScan {
+	d.cycle++
+	if d.pending != nil {
+		d.cfg, d.pending = *d.pending, nil
+		logInfo("daemon.reload_applied", d.cycle)
+	}
+	runID := newRunID()
+	setLogRunID(runID)
+	logInfo("daemon.cycle_start", d.cycle, runID)
+	// Os ranges do phpIPAM são relidos a cada ciclo
+	cfg, err := d.cfg.resolveRanges(ctx)
+	if err != nil {
+		logError("daemon.cycle_failed", d.cycle, err)
+		return nil
+	}
+	d.resolved = cfg
+	if d.trap != nil {
+		d.trap.ranges = localRangeIndex(cfg)
+		// O ciclo varre os ranges inteiros, inclusive os IPs dos traps
+		if n := len(d.trap.queued); n > 0 {
+			logInfo("trap.covered", n, d.cycle)
+			d.trap.queued = nil
+		}
+	}
+	opts, err := d.of.runOptions(cfg, runID, true)
+	if err != nil {
+		logError("daemon.cycle_failed", d.cycle, err)
+		return nil
+	}
+	scan := &daemonScan{cycle: d.cycle, start: time.Now(), done: make(chan int, 1), progress: &discovery.Progress{}}
+	opts.Live = scan.progress
+	d.notifier.status(d.scanStatus(scan))
+	go func() {
+		code, err := runCycle(ctx, cfg, opts, d.strict)
+		if err != nil {
+			logError("daemon.cycle_failed", scan.cycle, err)
+		}
+		scan.done <- code
+	}()
+	return scan
+}
+
+// Inicia um scan só dos IPs dos traps, sobre a configuração do último ciclo.
+// As saídas que descrevem todos os hosts (snapshot, inventários e
+// checkpoint) ficam para os ciclos completos; o SNMP é refeito mesmo nos
+// hosts do cache, já que o trap indica uma mudança no equipamento.
+func (d *daemon) startTrapScan(ctx context.Context, ips []string) *daemonScan {
+	d.trapScans++
+	runID := newRunID()
+	setLogRunID(runID)
+	logInfo("trap.scan_start", d.trapScans, len(ips), strings.Join(ips, ", "), runID)
+	cfg := d.resolved
+	cfg.SnapshotFile = ""
+	of := d.of
+	of.ansible, of.hostsFile, of.nagios, of.diff, of.checkpoint = "", "", "", "", ""
+	of.noCache = true
+	opts, err := of.runOptions(cfg, runID, true)
+	if err != nil {
+		logError("trap.scan_failed", d.trapScans, err)
+		return nil
+	}
+	opts.Trigger = triggerTrap
+	opts.Only = make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		opts.Only[ip] = true
+	}
+	scan := &daemonScan{cycle: d.cycle, trap: true, start: time.Now(), done: make(chan int, 1), progress: &discovery.Progress{}}
+	opts.Live = scan.progress
+	d.notifier.status(d.scanStatus(scan))
+	go func() {
+		code, err := runCycle(ctx, cfg, opts, d.strict)
+		if err != nil {
+			logError("trap.scan_failed", d.trapScans, err)
+		}
+		scan.done <- code
+	}()
+	return scan
+}
+
+// Snapshot do SIGUSR1 no daemon: a agenda e, com um scan em andamento, o
+// progresso dele.
+func (d *daemon) logSnapshot(scan *daemonScan, next time.Time) {
+	switch {
+	case scan == nil:
+		logInfo("usr1.daemon_idle", d.cycle, d.cycle+1, next.Format(time.RFC3339), d.skipped)
+	case scan.trap:
+		logInfo("usr1.daemon_trap", d.trapScans, time.Since(scan.start).Round(time.Second), d.cycle+1, next.Format(time.RFC3339))
+	default:
+		logInfo("usr1.daemon_cycle", scan.cycle, time.Since(scan.start).Round(time.Second), d.cycle+1, next.Format(time.RFC3339))
+	}
+	if scan != nil {
+		logProgressSnapshot(scan.progress)
+	}
+}
+
+// STATUS= do systemd com o progresso do scan em andamento.
+func (d *daemon) scanStatus(scan *daemonScan) string {
+	line := progressLine(scan.progress.Snapshot(), false)
+	if scan.trap {
+		return i18n.T("systemd.status_trap", d.trapScans, line)
+	}
+	return i18n.T("systemd.status_cycle", scan.cycle, line)
+}
+
+// Relê e revalida a configuração após um SIGHUP. Uma configuração inválida é
+// rejeitada e a atual continua valendo; uma válida fica pendente até o
+// próximo ciclo, para nunca mudar durante um scan.
+func (d *daemon) reload() {
+	logInfo("daemon.reloading", strings.Join(d.cf.files(), ", "))
+	cfg, err := d.cf.load()
+	if err == nil {
+		if err = cfg.validate(); err != nil {
+			err = fmt.Errorf("configuração inválida: %w", err)
+		}
+	}
+	if err == nil {
+		err = d.of.check(cfg)
+	}
+	if err != nil {
+		logError("daemon.reload_rejected", err)
+		return
+	}
+	current := d.cfg
+	if d.pending != nil {
+		current = *d.pending
+	}
+	changes := configChanges(current, cfg)
+	if len(changes) == 0 {
+		logInfo("daemon.reload_unchanged")
+		return
+	}
+	d.pending = &cfg
+	logInfo("daemon.reloaded", len(changes), d.cycle+1)
+	for _, c := range changes {
+		logInfo("daemon.reload_change", c)
+		// Os destinos dos logs são abertos uma vez, na inicialização
+		// e o receptor de traps, uma vez no início do daemon
+		if strings.HasPrefix(c, "log_") || strings.HasPrefix(c, "syslog_") || strings.HasPrefix(c, "snmp_trap.") {
+			logWarn("daemon.reload_restart", strings.SplitN(c, ":", 2)[0])
+		}
+	}
+}
+
+// Campos alterados entre duas configurações, um por linha no formato
+// "chave: antigo -> novo", em ordem alfabética. Credenciais aparecem
+// mascaradas; quando só o segredo mudou, a linha diz apenas que mudou.
+func configChanges(old, cur Config) []string {
+	before, after := flattenConfig(old), flattenConfig(cur)
+	maskedBefore, maskedAfter := flattenConfig(old.redacted()), flattenConfig(cur.redacted())
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	var changes []string
+	for k := range keys {
+		if before[k] == after[k] {
+			continue
+		}
+		a, b := maskedBefore[k], maskedAfter[k]
+		if a == "" {
+			a = "-"
+		}
+		if b == "" {
+			b = "-"
+		}
+		if a == b {
+			changes = append(changes, k+": "+i18n.T("daemon.secret_changed"))
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", k, a, b))
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// Configuração como chaves planas ("smtp.host") e valores em JSON.
+func flattenConfig(c Config) map[string]string {
+	out := map[string]string{}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return out
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return out
+	}
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		if m, ok := v.(map[string]interface{}); ok && prefix != "profiles" {
+			for k, child := range m {
+				key := k
+				if prefix != "" {
+					key = prefix + "." + k
+				}
+				walk(key, child)
+			}
+			return
+		}
+		b, _ := json.Marshal(v)
+		out[prefix] = string(b)
+	}
+	walk("", raw)
+	return out
+}
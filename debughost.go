@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"discoveryhosts/hosttrace"
+)
+
+// Hosts do -debug-host, que têm o rastro detalhado de cada etapa, e o
+// destino dele: a saída de erro ou, com -debug-dir, um arquivo <ip>.trace por
+// host, acrescentado a cada run.
+type debugHosts struct {
+	nets []*net.IPNet
+	dir  string
+
+	mu      sync.Mutex
+	tracers map[string]*hosttrace.Tracer
+	files   []*os.File
+}
+
+// Confere os IPs e CIDRs do -debug-host; nil sem nenhum.
+func parseDebugHosts(specs []string, dir string) (*debugHosts, error) {
+	if len(specs) == 0 {
+		if dir != "" {
+			return nil, fmt.Errorf("-debug-dir requer -debug-host")
+		}
+		return nil, nil
+	}
+	h := &debugHosts{dir: dir}
+	for _, s := range specs {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			s += "/32"
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil || n.IP.To4() == nil {
+			return nil, fmt.Errorf("-debug-host deve ser um IPv4 ou um CIDR (atual: %q)", strings.TrimSuffix(s, "/32"))
+		}
+		h.nets = append(h.nets, n)
+	}
+	if dir != "" {
+		// Os rastros têm os PDUs e as respostas da API de cada host
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("falha ao criar o -debug-dir %s: %w", dir, err)
+		}
+	}
+	return h, nil
+}
+
+func (h *debugHosts) String() string {
+	var s []string
+	for _, n := range h.nets {
+		if ones, _ := n.Mask.Size(); ones == 32 {
+			s = append(s, n.IP.String())
+		} else {
+			s = append(s, n.String())
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+// Config.Trace do discovery; nil sem -debug-host.
+func (h *debugHosts) matcher() func(string) *hosttrace.Tracer {
+	if h == nil {
+		return nil
+	}
+	return h.tracer
+}
+
+// Rastro de ip, criado no primeiro uso; nil fora dos hosts do -debug-host.
+func (h *debugHosts) tracer(ip string) *hosttrace.Tracer {
+	addr := net.ParseIP(ip)
+	match := false
+	for _, n := range h.nets {
+		if n.Contains(addr) {
+			match = true
+			break
+		}
+	}
+	if !match {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if t, ok := h.tracers[ip]; ok {
+		return t
+	}
+	var w io.Writer = os.Stderr
+	if h.dir != "" {
+		path := filepath.Join(h.dir, ip+".trace")
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			logError("debug.file_failed", path, err)
+		} else {
+			h.files = append(h.files, f)
+			w = f
+		}
+	}
+	if h.tracers == nil {
+		h.tracers = map[string]*hosttrace.Tracer{}
+	}
+	t := hosttrace.New(w, ip)
+	h.tracers[ip] = t
+	return t
+}
+
+// Fecha os arquivos do run; o próximo run (no -daemon) os abre de novo.
+func (h *debugHosts) close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, f := range h.files {
+		f.Close()
+	}
+	h.files, h.tracers = nil, nil
+}
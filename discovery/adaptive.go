@@ -0,0 +1,199 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Adaptive configura o ajuste automático dos workers ativos de cada etapa. A
+// etapa começa com Min workers ativos e, a cada Window, o controlador compara
+// a taxa de falhas da janela (erros do ping, timeouts do SNMP, erros do
+// Zabbix) com a menor taxa já vista: um salto acima dela corta os workers
+// pela metade; uma janela limpa acrescenta um quarto, até os workers
+// configurados da etapa.
+type Adaptive struct {
+	Min    int
+	Window time.Duration
+}
+
+// Parâmetros do controlador
+const (
+	adaptiveMinSamples  = 5    // hosts mínimos na janela para decidir
+	adaptiveSpikeMargin = 0.10 // aumento da taxa de falhas que conta como salto
+)
+
+// ConcurrencyChange é uma mudança nos workers ativos de uma etapa no modo
+// adaptativo, com as métricas da janela que a motivaram. A primeira de cada
+// etapa é o valor inicial.
+type ConcurrencyChange struct {
+	At       time.Duration // desde o início do run
+	Stage    string
+	Workers  int
+	Samples  int     // hosts concluídos na janela
+	FailRate float64 // fração com falha na janela
+}
+
+// Limita quantos workers de uma etapa processam ao mesmo tempo. Os goroutines
+// dos workers existem sempre; os que excedem o limite esperam em acquire.
+type limiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+func newLimiter(limit int) *limiter {
+	l := &limiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *limiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Signal()
+}
+
+func (l *limiter) setLimit(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = n
+	l.cond.Broadcast()
+}
+
+// Estado do controlador de uma etapa. Os contadores da janela são alterados
+// pelos workers; o limite, só pelo controlador.
+type adaptiveStage struct {
+	name     string
+	max      int
+	limit    int
+	baseline float64 // menor taxa de falhas já vista; -1 antes da primeira janela
+	limiters []*limiter
+	weights  []int // workers de cada limitador (pools de ping por range)
+
+	mu              sync.Mutex
+	samples, failed int
+}
+
+func (st *adaptiveStage) observe(failed bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.samples++
+	if failed {
+		st.failed++
+	}
+}
+
+// Distribui o limite da etapa entre os limitadores, proporcional aos workers
+// de cada um e com pelo menos um ativo em cada.
+func (st *adaptiveStage) apply() {
+	for i, l := range st.limiters {
+		l.setLimit(max(1, st.limit*st.weights[i]/st.max))
+	}
+}
+
+// Controlador do modo adaptativo.
+type adaptive struct {
+	cfg      Adaptive
+	start    time.Time
+	stages   map[string]*adaptiveStage
+	order    []string
+	progress *Progress
+}
+
+func newAdaptive(cfg Adaptive, start time.Time, progress *Progress) *adaptive {
+	return &adaptive{cfg: cfg, start: start, stages: map[string]*adaptiveStage{}, progress: progress}
+}
+
+// Cria o limitador de um pool da etapa. Sem o modo adaptativo (a nil) o
+// limite é o próprio número de workers.
+func (a *adaptive) limiter(stage string, workers, stageWorkers int) *limiter {
+	if a == nil {
+		return newLimiter(workers)
+	}
+	st, ok := a.stages[stage]
+	if !ok {
+		st = &adaptiveStage{name: stage, max: stageWorkers, limit: min(a.cfg.Min, stageWorkers), baseline: -1}
+		a.stages[stage] = st
+		a.order = append(a.order, stage)
+	}
+	l := newLimiter(workers)
+	st.limiters = append(st.limiters, l)
+	st.weights = append(st.weights, workers)
+	return l
+}
+
+func (a *adaptive) observe(stage string, failed bool) {
+	if a == nil {
+		return
+	}
+	if st, ok := a.stages[stage]; ok {
+		st.observe(failed)
+	}
+}
+
+// Aplica os limites iniciais e reavalia as etapas a cada janela até ctx
+// terminar.
+func (a *adaptive) run(ctx context.Context, d *discoverer) {
+	for _, name := range a.order {
+		st := a.stages[name]
+		st.apply()
+		a.progress.addConcurrency(ConcurrencyChange{At: time.Since(a.start), Stage: name, Workers: st.limit})
+	}
+	ticker := time.NewTicker(a.cfg.Window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, name := range a.order {
+			a.evaluate(d, a.stages[name])
+		}
+	}
+}
+
+func (a *adaptive) evaluate(d *discoverer, st *adaptiveStage) {
+	st.mu.Lock()
+	samples, failed := st.samples, st.failed
+	if samples >= adaptiveMinSamples {
+		st.samples, st.failed = 0, 0
+	}
+	st.mu.Unlock()
+	if samples < adaptiveMinSamples {
+		return
+	}
+	rate := float64(failed) / float64(samples)
+	if st.baseline < 0 || rate < st.baseline {
+		st.baseline = rate
+	}
+	from := st.limit
+	hl := d.log.With("stage", st.name)
+	switch {
+	case rate > st.baseline+adaptiveSpikeMargin:
+		st.limit = max(a.cfg.Min, st.limit/2, 1)
+		if st.limit == from {
+			return
+		}
+		hl.Warnf("adaptive.backoff", st.name, from, st.limit, failed, samples, 100*rate, 100*st.baseline)
+	case st.limit < st.max:
+		st.limit = min(st.max, st.limit+max(1, st.limit/4))
+		hl.Infof("adaptive.rampup", st.name, from, st.limit, failed, samples, 100*rate)
+	default:
+		return
+	}
+	st.apply()
+	a.progress.addConcurrency(ConcurrencyChange{At: time.Since(a.start), Stage: st.name, Workers: st.limit, Samples: samples, FailRate: rate})
+}
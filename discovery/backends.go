@@ -0,0 +1,124 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"discoveryhosts/probe"
+	"discoveryhosts/snmpinfo"
+	"discoveryhosts/zabbix"
+)
+
+// Pinger verifica se um IP responde. Um host que não respondeu retorna false
+// sem erro; o erro indica que o próprio ping não pôde ser executado. Um
+// *probe.Error tem o motivo dessa falha, que entra no resumo.
+type Pinger interface {
+	Probe(ctx context.Context, ip string) (bool, error)
+}
+
+// SNMPQuerier lê a identificação do sistema de um IP com uma community. Os
+// erros devem ser *snmpinfo.Error, cujo motivo entra no resumo.
+type SNMPQuerier interface {
+	SysInfo(ctx context.Context, ip, community string) (snmpinfo.Info, error)
+}
+
+// HostCreator garante que um host exista no Zabbix, retornando a ação
+// (zabbix.Created, zabbix.Existing, zabbix.Upgraded ou zabbix.Failed) e o
+// hostid.
+// *zabbix.Client implementa a interface.
+type HostCreator interface {
+	Ensure(ctx context.Context, spec zabbix.HostSpec) (string, string, error)
+}
+
+// Outcome é o cadastro de um host num Backend: a ação (zabbix.Created,
+// zabbix.Existing, zabbix.Upgraded, zabbix.Failed ou ZabbixDryRun, de um
+// backend que não cadastra nada) e o id do host no destino.
+type Outcome struct {
+	Action string
+	HostID string
+}
+
+// Backend é um destino do cadastro dos hosts identificados (Config.Backends).
+// Name identifica o backend nos logs, em Config.RangeBackends e em
+// HostResult.Targets. Ensure é chamado por vários goroutines; o spec chega sem
+// grupos, proxy e templates, que são do backend.
+type Backend interface {
+	Name() string
+	Ensure(ctx context.Context, spec zabbix.HostSpec) (Outcome, error)
+}
+
+// NewBackend adapta um servidor de Config.Targets (ou qualquer HostCreator,
+// com o nome do backend em Name) a Backend.
+func NewBackend(t ZabbixTarget) Backend {
+	return targetBackend{t}
+}
+
+type targetBackend struct {
+	t ZabbixTarget
+}
+
+func (b targetBackend) Name() string {
+	return b.t.Name
+}
+
+func (b targetBackend) Ensure(ctx context.Context, spec zabbix.HostSpec) (Outcome, error) {
+	spec.GroupIDs, spec.ProxyID, spec.TemplateIDs = b.t.GroupIDs, b.t.ProxyID, b.t.TemplateIDs
+	action, hostID, err := b.t.Zabbix.Ensure(ctx, spec)
+	return Outcome{Action: action, HostID: hostID}, err
+}
+
+// PortProber verifica se uma porta TCP aceita conexões. Qualquer falha conta
+// como porta fechada.
+type PortProber interface {
+	Open(ctx context.Context, ip string, port int) bool
+}
+
+// Resolver faz a consulta reversa (PTR) do NameFallback. *net.Resolver
+// implementa a interface.
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// Ping do sistema, usado quando Config.Pinger é nil.
+type systemPinger struct {
+	timeout time.Duration
+}
+
+func (p systemPinger) Probe(ctx context.Context, ip string) (bool, error) {
+	err := probe.Ping(ctx, ip, p.timeout)
+	if err == nil {
+		return true, nil
+	}
+	var pe *probe.Error
+	if errors.As(err, &pe) && pe.Reason == probe.ReasonUnreachable || ctx.Err() != nil {
+		return false, nil
+	}
+	return false, err
+}
+
+// Conexão TCP, usada quando PortScan.Prober é nil.
+type tcpProber struct {
+	timeout time.Duration
+}
+
+func (p tcpProber) Open(ctx context.Context, ip string, port int) bool {
+	d := net.Dialer{Timeout: p.timeout}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// SNMP v2c do snmpinfo, usado quando Config.SNMP é nil.
+type snmpQuerier struct {
+	timeout time.Duration
+}
+
+func (q snmpQuerier) SysInfo(ctx context.Context, ip, community string) (snmpinfo.Info, error) {
+	return snmpinfo.Query(ctx, ip, community, q.timeout)
+}
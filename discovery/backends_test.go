@@ -0,0 +1,34 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"discoveryhosts/discovery/discoverytest"
+	"discoveryhosts/zabbix"
+)
+
+func TestNewBackend(t *testing.T) {
+	zbx := &discoverytest.Zabbix{}
+	b := NewBackend(ZabbixTarget{Name: "dc2", Zabbix: zbx, GroupIDs: []string{"7"}, ProxyID: "3", TemplateIDs: []string{"10001"}})
+	if b.Name() != "dc2" {
+		t.Errorf("esperava o nome dc2, obteve %q", b.Name())
+	}
+	out, err := b.Ensure(context.Background(), zabbix.HostSpec{Name: "sw1", IP: "10.0.0.1", Community: "public"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Action != zabbix.Created || out.HostID == "" {
+		t.Errorf("esperava o host criado, obteve %+v", out)
+	}
+	specs := zbx.Specs()
+	if len(specs) != 1 {
+		t.Fatalf("esperava um cadastro, obteve %d", len(specs))
+	}
+	// Grupos, proxy e templates são do servidor, não do spec
+	got := specs[0]
+	if !reflect.DeepEqual(got.GroupIDs, []string{"7"}) || got.ProxyID != "3" || !reflect.DeepEqual(got.TemplateIDs, []string{"10001"}) {
+		t.Errorf("spec sem os dados do servidor: %+v", got)
+	}
+}
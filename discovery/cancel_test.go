@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+
+	"discoveryhosts/snmpinfo"
+)
+
+// Ping que leva delay e responde pelos IPs de final par, respeitando o
+// cancelamento.
+type slowPinger struct {
+	delay time.Duration
+	err   error
+}
+
+func (p slowPinger) Probe(ctx context.Context, ip string) (bool, error) {
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return false, nil
+	}
+	if p.err != nil {
+		return false, p.err
+	}
+	return strings.TrimRight(ip, "13579") != ip, nil
+}
+
+// SNMP que responde por qualquer IP, com o IP no sysName.
+type anySNMP struct{}
+
+func (anySNMP) SysInfo(ctx context.Context, ip, community string) (snmpinfo.Info, error) {
+	if err := ctx.Err(); err != nil {
+		return snmpinfo.Info{}, &snmpinfo.Error{Reason: snmpinfo.ReasonTimeout, Err: err}
+	}
+	return snmpinfo.Info{SysName: "host-" + ip, Community: community, Version: "2c"}, nil
+}
+
+// Cancelar o run no meio não deixa goroutines para trás: os workers das
+// etapas, os produtores e o coletor terminam antes de Run retornar.
+func TestRunCancelNoLeak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	cfg := testConfig("10.0.0.0/16")
+	cfg.Pinger = slowPinger{delay: time.Millisecond}
+	cfg.SNMP = anySNMP{}
+	cfg.MaxRetries, cfg.RetryDelay = 2, time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	report, err := Run(ctx, cfg)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("erro %v, esperava context.Canceled", err)
+	}
+	s := report.Summary
+	if !s.Interrupted || s.Scanned == 0 || s.Scanned >= s.TargetsExpanded {
+		t.Errorf("resumo: interrompido %t, %d de %d verificados", s.Interrupted, s.Scanned, s.TargetsExpanded)
+	}
+}
@@ -0,0 +1,1468 @@
+// Package discovery executa o discovery de hosts: expande os ranges, faz ping
+// em cada IP, lê o sysName via SNMP e cadastra no Zabbix os hosts que
+// responderam. O CLI do discoveryhosts é uma camada fina sobre Run.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os/exec"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"discoveryhosts/hosttrace"
+	"discoveryhosts/iprange"
+	"discoveryhosts/logx"
+	"discoveryhosts/probe"
+	"discoveryhosts/snmpinfo"
+	"discoveryhosts/zabbix"
+)
+
+// Config descreve um run. Diferente da configuração em arquivo do CLI, recebe
+// valores já resolvidos (workers, credenciais, cliente do Zabbix).
+type Config struct {
+	Ranges      []string // formatos aceitos por iprange.Parse
+	PingTimeout time.Duration
+	SNMPTimeout time.Duration
+	Communities []string // tentadas em ordem até uma responder
+
+	// IPs dos ranges que não são varridos (como os reservados no IPAM),
+	// contados em Summary.TargetsExcluded. Vale só para os ranges locais: os
+	// de Remote vão inteiros ao agente.
+	Exclude map[string]bool
+	// Se definido, indica os IPs do próprio scanner (interfaces locais e
+	// loopback), tirados dos ranges locais como no Exclude e contados em
+	// Summary.TargetsSelf. Vale para todos os alvos do run, venham eles dos
+	// ranges, de Only, de um trap ou da API.
+	Self func(ip netip.Addr) bool
+	// Se definido, só estes IPs dos ranges locais são varridos, como num
+	// scan dirigido a hosts específicos; os ranges sem nenhum deles ficam
+	// fora do resumo. Os de Remote vão inteiros ao agente, como no Exclude.
+	Only map[string]bool
+	// Run de um relatório anterior cujas falhas são refeitas neste, com os
+	// IPs delas em Only: os hosts que agora passam sem erro saem com
+	// HostResult.Recovered. Vai no resumo.
+	RetryOf string
+	// Se definido, é consultado em cada etapa de um IP: um Tracer não nil
+	// recebe o rastro detalhado do host nela (-debug-host).
+	Trace func(ip string) *hosttrace.Tracer
+	// Com HostLogBlock > 0, os eventos de log de cada host são guardados e
+	// escritos juntos, num bloco, quando ele termina (ou ao fim do run, se
+	// ele foi descartado por um cancelamento). Um host com HostLogBlock
+	// eventos guardados tem o bloco escrito antes, limitando a memória.
+	HostLogBlock int
+
+	// Cada IP passa por três etapas, cada uma com seus próprios workers:
+	// ping, consulta SNMP e cadastro no Zabbix. Uma etapa com zero workers
+	// usa Workers.
+	Workers       int
+	PingWorkers   int
+	SNMPWorkers   int
+	ZabbixWorkers int
+
+	// Hosts identificados aguardando o cadastro no Zabbix (zero usa
+	// ZabbixWorkers). Com a fila cheia o SNMP espera, sem aumentar a carga
+	// na API. No cancelamento os hosts que já estão na fila ainda são
+	// cadastrados.
+	ZabbixQueue int
+
+	// Workers de ping reservados para ranges específicos (chave igual à de
+	// Ranges). Cada um desses ranges tem um pool próprio; os demais dividem o
+	// restante de PingWorkers, que nunca é excedido no total.
+	RangeWorkers map[string]int
+
+	// Prazo de um IP somando o tempo de todas as etapas (zero para nenhum). A
+	// etapa que estourar o prazo é interrompida e o host sai com TimedOut.
+	HostTimeout time.Duration
+	// Tempo máximo do run (zero para nenhum): depois dele nenhum IP novo é
+	// iniciado, os que estão em andamento terminam e o resumo marca
+	// DeadlineReached.
+	MaxDuration time.Duration
+
+	// Tentativas extras para falhas passageiras de SNMP e Zabbix (timeout,
+	// rede), feitas em rodadas depois da fila principal, com RetryDelay de
+	// espera antes de cada rodada.
+	MaxRetries int
+	RetryDelay time.Duration
+
+	// Se definido, ajusta os workers ativos de cada etapa conforme a taxa de
+	// falhas; os workers configurados de cada etapa são o máximo.
+	Adaptive *Adaptive
+
+	// Se definido, os hosts que responderem ao ping nos ranges de
+	// PortScan.Ranges passam por uma varredura TCP antes do SNMP.
+	PortScan *PortScan
+
+	// Implementações das etapas. Pinger nil usa o ping do sistema com
+	// PingTimeout e SNMP nil usa snmpinfo.Query com SNMPTimeout.
+	Pinger Pinger
+	SNMP   SNMPQuerier
+
+	Zabbix   HostCreator // em geral um *zabbix.Client; pode ser nil com DryRun, SkipZabbix ou Targets
+	GroupIDs []string    // grupos dos hosts criados
+	ProxyID  string      // proxy que monitora os hosts criados; vazio ou "0" para nenhum
+	// Servidores do cadastro, no lugar de Zabbix, GroupIDs e ProxyID: cada
+	// host é cadastrado em todos e o resultado de cada um fica em
+	// HostResult.Targets.
+	Targets []ZabbixTarget
+	// Destinos do cadastro, no lugar de Zabbix e Targets: cada host é
+	// cadastrado nos backends do seu range, com o resultado de cada um em
+	// HostResult.Targets, como nos Targets.
+	Backends []Backend
+	// Backends (pelo Name) dos hosts de cada range, chave igual à de Ranges.
+	// Os ranges fora do mapa usam todos os de Backends; uma lista vazia não
+	// cadastra nada, como em SkipZabbixRanges.
+	RangeBackends map[string][]string
+	DryRun        bool // faz ping e SNMP mas não cadastra nada no Zabbix
+	// Sem cadastro no Zabbix, num run que não é um teste: os resultados vão
+	// para outros destinos (OnResult) e os hosts saem com ZabbixSkipped.
+	SkipZabbix bool
+	// Ranges (chave igual à de Ranges) cujos hosts identificados não são
+	// cadastrados neste run, como no SkipZabbix; os demais são.
+	SkipZabbixRanges map[string]bool
+	// Se definido, é consultado para cada host identificado antes do
+	// cadastro: uma descrição não vazia da entrada que casou (como "ip
+	// 10.0.0.1, linha 12") indica um host já conhecido, que sai com
+	// ZabbixKnown e não é cadastrado. Chamado por vários goroutines.
+	Known func(HostResult) string
+	// Se definido, é consultado para cada host identificado antes do Known:
+	// os hosts para os quais retorna false saem com ZabbixFiltered e não são
+	// cadastrados. Chamado por vários goroutines.
+	Filter func(HostResult) bool
+	// Se definido, os hosts que respondem ao ping mas não ao SNMP também são
+	// cadastrados, pelo nome DNS; veja NameFallback.
+	Fallback *NameFallback
+	// Se definido, nada é cadastrado antes do fim do ping e do SNMP de todos
+	// os IPs (com as retentativas): os hosts a cadastrar são passados a
+	// Confirm e, com false, saem com ZabbixSkipped. Chamado no máximo uma vez,
+	// e não com a lista vazia.
+	Confirm func([]HostResult) bool
+
+	// Alterna entre os ranges (um IP de cada, em rodízio) em vez de esgotar
+	// um range antes do próximo, para que todos os sites sejam cobertos desde
+	// o início do run.
+	Interleave bool
+
+	// Ranges atribuídos a agentes remotos, que fazem o ping e o SNMP e
+	// devolvem os resultados; o cadastro no Zabbix continua neste run. Os
+	// demais ranges são processados aqui.
+	Remote []Remote
+
+	// Máximo de hosts criados no run, somando todos os backends; os que
+	// chegarem ao cadastro depois disso saem com ZabbixLimited. Zero é sem
+	// limite.
+	CreateLimit int
+
+	RunID    string       // identificador do run nos logs e no resumo
+	Trigger  string       // origem do run (como trap), vazia num run normal; vai no resumo e em cada host
+	Logger   *slog.Logger // destino dos eventos por host; nil usa slog.Default()
+	Progress *Progress    // se definido, recebe o resumo em construção
+
+	// Hosts processados com sucesso recentemente, por IP. Um IP do cache que
+	// responder ao ping pula o SNMP e o cadastro e sai com ZabbixCached e os
+	// dados guardados; o ping continua sendo feito para notar os que sumiram.
+	Cache map[string]CachedHost
+
+	// Resultados de um run anterior interrompido. Esses IPs não são
+	// processados de novo; os resultados entram no resumo, no relatório e no
+	// OnResult antes dos novos, como se fizessem parte deste run.
+	Previous []HostResult
+
+	// OnResult, se definido, é chamado para cada IP concluído, na ordem em
+	// que terminam, por um único goroutine.
+	OnResult func(HostResult)
+}
+
+// CachedHost são os dados de um IP guardados do último processamento
+// completo.
+type CachedHost struct {
+	SNMP   snmpinfo.Info // sem a community
+	HostID string
+}
+
+// Report é o resultado de um run: o resumo e os hosts que responderam ao
+// ping, na ordem em que foram concluídos.
+type Report struct {
+	Summary Summary
+	Hosts   []HostResult
+}
+
+// Run expande os ranges e passa os IPs pelas etapas de ping, SNMP e Zabbix,
+// retornando quando todos terminarem. Todos os ranges são expandidos antes do
+// primeiro ping; se algum for inválido, Run retorna o erro sem processar
+// nenhum IP. Se ctx for cancelado, nenhum IP novo é iniciado, as etapas em
+// andamento são interrompidas e Run retorna o relatório parcial junto com
+// ctx.Err().
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	for _, w := range []*int{&cfg.PingWorkers, &cfg.SNMPWorkers, &cfg.ZabbixWorkers} {
+		if *w == 0 {
+			*w = cfg.Workers
+		}
+	}
+	for _, w := range []struct {
+		stage string
+		n     int
+	}{{StagePing, cfg.PingWorkers}, {StageSNMP, cfg.SNMPWorkers}, {StageZabbix, cfg.ZabbixWorkers}} {
+		if w.n < 1 {
+			return Report{}, fmt.Errorf("workers da etapa %s deve ser maior que zero: %d", w.stage, w.n)
+		}
+	}
+	if cfg.ZabbixQueue == 0 {
+		cfg.ZabbixQueue = cfg.ZabbixWorkers
+	}
+	if cfg.Pinger == nil {
+		cfg.Pinger = systemPinger{timeout: cfg.PingTimeout}
+	}
+	if cfg.SNMP == nil {
+		cfg.SNMP = snmpQuerier{timeout: cfg.SNMPTimeout}
+	}
+	if cfg.PortScan != nil {
+		ps := *cfg.PortScan
+		if ps.Prober == nil {
+			ps.Prober = tcpProber{timeout: ps.Timeout}
+		}
+		ps.Concurrency = max(ps.Concurrency, 1)
+		cfg.PortScan = &ps
+	}
+	if cfg.Fallback != nil && cfg.Fallback.Resolver == nil {
+		fb := *cfg.Fallback
+		fb.Resolver = net.DefaultResolver
+		cfg.Fallback = &fb
+	}
+	if cfg.Zabbix == nil && len(cfg.Targets) == 0 && len(cfg.Backends) == 0 && !cfg.DryRun && !cfg.SkipZabbix {
+		return Report{}, fmt.Errorf("cliente do Zabbix não definido (use DryRun ou SkipZabbix para não cadastrar)")
+	}
+	targets, err := expandRanges(cfg.Ranges)
+	if err != nil {
+		return Report{}, err
+	}
+	filter, invalid := newTargetFilter(logx.New(cfg.Logger), cfg)
+	backends, byRange, err := resolveBackends(cfg, targets)
+	if err != nil {
+		return Report{}, err
+	}
+	excluded, self := filterTargets(targets, filter, cfg.Remote)
+	if err := noTargets(targets); err != nil {
+		return Report{}, err
+	}
+	local, groups, err := splitRemote(targets, cfg.Remote)
+	if err != nil {
+		return Report{}, err
+	}
+	pools, err := pingPools(local, cfg.PingWorkers, cfg.RangeWorkers)
+	if err != nil {
+		return Report{}, err
+	}
+	runCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	d := &discoverer{cfg: cfg, log: logx.New(cfg.Logger), abort: abort, excluded: excluded, self: self, invalid: invalid, backends: backends, byRange: byRange}
+	if cfg.PortScan != nil {
+		d.scanSlots = make(chan struct{}, cfg.PortScan.Concurrency)
+		d.scanPace = newPacer(cfg.PortScan.Rate)
+	}
+	report := d.run(runCtx, targets, pools, groups)
+	if ctx.Err() == nil && runCtx.Err() != nil {
+		report.Summary.Aborted = true
+		report.Summary.AbortCause = context.Cause(runCtx).Error()
+		return report, context.Cause(runCtx)
+	}
+	return report, ctx.Err()
+}
+
+var (
+	// ErrHostTimeout indica que uma etapa foi interrompida pelo HostTimeout.
+	ErrHostTimeout = errors.New("prazo do host esgotado")
+	// ErrInternal é a falha de um host cuja etapa entrou em panic.
+	ErrInternal = errors.New("erro interno")
+	// ErrTooManyPanics é retornado por Run quando mais de maxPanics hosts
+	// entram em panic, sinal de um problema sistemático.
+	ErrTooManyPanics = errors.New("panics demais")
+	// ErrFatal envolve o erro de um host que impede todos os outros (login
+	// do Zabbix recusado, ping ausente). Run para de iniciar IPs, descarta a
+	// fila do cadastro e retorna o erro.
+	ErrFatal = errors.New("erro fatal")
+)
+
+// NoTargetsError é retornado por Run quando nenhum range tem um IP a
+// verificar depois das exclusões (sem ranges, todos os IPs excluídos ou fora
+// de Config.Only): o run nem começa, em vez de terminar sem nada verificado.
+type NoTargetsError struct {
+	Ranges []RangeExpansion
+}
+
+// RangeExpansion é um range e o número de IPs da expansão dele.
+type RangeExpansion struct {
+	Range string
+	IPs   int
+}
+
+func (e *NoTargetsError) Error() string {
+	if len(e.Ranges) == 0 {
+		return "nenhum alvo a verificar: nenhum range no run"
+	}
+	parts := make([]string, len(e.Ranges))
+	for i, r := range e.Ranges {
+		parts[i] = fmt.Sprintf("%s (%d IPs, nenhum após as exclusões)", r.Range, r.IPs)
+	}
+	return "nenhum alvo a verificar: " + strings.Join(parts, ", ")
+}
+
+// ReasonInternal é o SNMPReason (ou o PingReason) de um host cuja etapa SNMP
+// (ou de ping) entrou em panic.
+const ReasonInternal = "internal_error"
+
+// Falhas de permissão ou de execução do ping registradas host a host; a partir
+// daí elas são de todo o run (como um contêiner sem CAP_NET_RAW), que as
+// registra uma vez, e as dos hosts seguintes vão só para o debug.
+const pingErrorsLogged = 3
+
+// Panics recuperados aceitos antes de abortar o run.
+const maxPanics = 10
+
+// Limite de hosts aguardando retentativa; acima dele a falha é final.
+const retryQueueLimit = 10000
+
+type discoverer struct {
+	cfg      Config
+	log      logx.Logger
+	excluded int // IPs de Config.Exclude tirados dos ranges
+	self     int // IPs do próprio scanner (Config.Self) tirados dos ranges
+	invalid  int // alvos que não são um endereço IP, tirados dos ranges
+
+	// Backends do cadastro (de Config.Backends ou Config.Targets) e os de
+	// cada range de Config.RangeBackends; vazio com um servidor só
+	backends []Backend
+	byRange  map[string][]Backend
+
+	retryMu sync.Mutex
+	retry   []HostResult // falhas passageiras para a próxima rodada
+
+	// Hosts retidos para o Config.Confirm
+	holdMu  sync.Mutex
+	holding bool
+	held    []HostResult
+
+	// Eventos guardados de cada host com Config.HostLogBlock
+	hostLogMu   sync.Mutex
+	hostLogs    map[string]*hostLogs
+	hostWriteMu sync.Mutex
+
+	// Falhas do ping por motivo, para o erro do run quando elas se repetem
+	pingMu     sync.Mutex
+	pingFailed map[string]int
+
+	// Hosts criados e em criação, para o Config.CreateLimit. createDone é
+	// fechado (e trocado) a cada cadastro resolvido, acordando quem espera
+	// uma vaga
+	createMu   sync.Mutex
+	created    int
+	creating   int
+	createDone chan struct{}
+	limitHit   atomic.Bool
+
+	// IPs já enviados ao ping e ao cadastro: um IP de ranges sobrepostos (ou
+	// que um agente também verificou) é processado uma vez só
+	seen      seenSet
+	published seenSet
+
+	panics  atomic.Int32
+	abort   context.CancelCauseFunc
+	aborted atomic.Bool
+
+	progress    *Progress
+	adaptive    *adaptive // nil sem o modo adaptativo
+	snmpLimit   *limiter
+	zabbixLimit *limiter
+
+	// Limites da PortScan, somando todos os hosts
+	scanSlots chan struct{}
+	scanPace  *pacer
+}
+
+// IP a processar e o range de onde ele veio.
+type job struct {
+	ip  string
+	rng string
+}
+
+// Um range do run, percorrido sem expandir a lista de IPs. Nos ranges locais,
+// filter tira os IPs de Exclude, Self e Only; count são os IPs que sobram.
+type rangeTargets struct {
+	rng    string
+	addrs  iprange.Range
+	filter *targetFilter // nil nos ranges dos agentes, que vão inteiros
+	count  int
+}
+
+// IPs do range a verificar, em ordem.
+func (t rangeTargets) all() iter.Seq[uint32] {
+	if t.filter == nil {
+		return t.addrs.All()
+	}
+	return func(yield func(uint32) bool) {
+		for n := range t.filter.source(t.addrs) {
+			if t.filter.drop(n) == keepTarget && !yield(n) {
+				return
+			}
+		}
+	}
+}
+
+// Valida todos os ranges, juntando os erros de todos os inválidos.
+func expandRanges(ranges []string) ([]rangeTargets, error) {
+	var targets []rangeTargets
+	var errs []error
+	for _, r := range ranges {
+		r = strings.TrimSpace(r)
+		addrs, err := iprange.Parse(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("range %s inválido: %w", r, err))
+			continue
+		}
+		targets = append(targets, rangeTargets{rng: r, addrs: addrs, count: addrs.Len()})
+	}
+	return targets, errors.Join(errs...)
+}
+
+// NoTargetsError se não sobrou nenhum IP em nenhum range.
+func noTargets(targets []rangeTargets) error {
+	ranges := make([]RangeExpansion, len(targets))
+	for i, t := range targets {
+		if t.count > 0 {
+			return nil
+		}
+		ranges[i] = RangeExpansion{Range: t.rng, IPs: t.addrs.Len()}
+	}
+	return &NoTargetsError{Ranges: ranges}
+}
+
+// IPs tirados dos ranges locais: os de Config.Exclude e Config.Self e, com
+// Config.Only, os que não estão nele.
+type targetFilter struct {
+	exclude map[uint32]bool
+	self    func(netip.Addr) bool
+	only    []uint32 // em ordem; nil para os ranges inteiros
+}
+
+// Motivo de um IP sair dos ranges locais.
+const (
+	keepTarget = iota
+	dropExcluded
+	dropSelf
+)
+
+// Filtro dos ranges locais do run; nil se nenhum IP sai deles. Os alvos de
+// Only que não são um endereço IP são descartados antes de qualquer comando
+// ser montado com eles, e o segundo retorno é quantos foram.
+func newTargetFilter(log logx.Logger, cfg Config) (*targetFilter, int) {
+	if len(cfg.Exclude) == 0 && cfg.Self == nil && cfg.Only == nil {
+		return nil, 0
+	}
+	f := &targetFilter{self: cfg.Self}
+	for ip, ok := range cfg.Exclude {
+		if n, v4 := iprange.Uint32(ip); ok && v4 {
+			if f.exclude == nil {
+				f.exclude = map[uint32]bool{}
+			}
+			f.exclude[n] = true
+		}
+	}
+	invalid := 0
+	if cfg.Only != nil {
+		f.only = []uint32{}
+		for ip, ok := range cfg.Only {
+			if !ok {
+				continue
+			}
+			if !probe.ValidTarget(ip) {
+				log.Warnf("target.invalid", ip)
+				invalid++
+				continue
+			}
+			// IPv6 não está em nenhum range
+			if n, v4 := iprange.Uint32(ip); v4 {
+				f.only = append(f.only, n)
+			}
+		}
+		slices.Sort(f.only)
+		f.only = slices.Compact(f.only)
+	}
+	return f, invalid
+}
+
+// IPs do range antes de Exclude e Self: com Only, só os dele que estão no
+// range, sem percorrer o range inteiro.
+func (f *targetFilter) source(addrs iprange.Range) iter.Seq[uint32] {
+	if f.only == nil {
+		return addrs.All()
+	}
+	return func(yield func(uint32) bool) {
+		for _, n := range f.only {
+			if addrs.Contains(n) && !yield(n) {
+				return
+			}
+		}
+	}
+}
+
+// Motivo de o IP sair do range, ou keepTarget.
+func (f *targetFilter) drop(n uint32) int {
+	switch {
+	case f.exclude[n]:
+		return dropExcluded
+	case f.self != nil && f.self(netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})):
+		return dropSelf
+	}
+	return keepTarget
+}
+
+// Aplica o filtro aos ranges locais (os de remotes seguem inteiros para o
+// agente), contando os IPs que ficam em cada um. Retorna quantos foram
+// tirados por Exclude e por Self.
+func filterTargets(targets []rangeTargets, f *targetFilter, remotes []Remote) (int, int) {
+	if f == nil {
+		return 0, 0
+	}
+	remote := map[string]bool{}
+	for _, g := range remotes {
+		for _, rng := range g.Ranges {
+			remote[strings.TrimSpace(rng)] = true
+		}
+	}
+	excluded, self := 0, 0
+	for i, t := range targets {
+		if remote[t.rng] {
+			continue
+		}
+		kept := 0
+		for n := range f.source(t.addrs) {
+			switch f.drop(n) {
+			case dropExcluded:
+				excluded++
+			case dropSelf:
+				self++
+			default:
+				kept++
+			}
+		}
+		targets[i].filter, targets[i].count = f, kept
+	}
+	return excluded, self
+}
+
+// Pool de workers da etapa de ping e os ranges que ele atende.
+type pingPool struct {
+	workers int
+	targets []rangeTargets
+}
+
+// Divide os workers de ping entre os ranges com workers reservados, cada um
+// no seu pool, e um pool compartilhado com o restante para os outros ranges.
+func pingPools(targets []rangeTargets, workers int, reserved map[string]int) ([]pingPool, error) {
+	ranges := map[string]bool{}
+	for _, t := range targets {
+		ranges[t.rng] = true
+	}
+	total := 0
+	for rng, n := range reserved {
+		if !ranges[strings.TrimSpace(rng)] {
+			return nil, fmt.Errorf("workers reservados para o range %s, que não está nos ranges do run", rng)
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("workers do range %s deve ser maior que zero: %d", rng, n)
+		}
+		total += n
+	}
+	if total > workers {
+		return nil, fmt.Errorf("workers reservados por range (%d) excedem os workers de ping (%d)", total, workers)
+	}
+	byRange := make(map[string]int, len(reserved))
+	for rng, n := range reserved {
+		byRange[strings.TrimSpace(rng)] = n
+	}
+	var pools []pingPool
+	shared := pingPool{workers: workers - total}
+	for _, t := range targets {
+		if n, ok := byRange[t.rng]; ok {
+			pools = append(pools, pingPool{workers: n, targets: []rangeTargets{t}})
+			continue
+		}
+		shared.targets = append(shared.targets, t)
+	}
+	if len(shared.targets) > 0 {
+		if shared.workers == 0 {
+			return nil, fmt.Errorf("os workers de ping (%d) estão todos reservados por range; não sobra nenhum para os demais ranges", workers)
+		}
+		pools = append(pools, shared)
+	}
+	return pools, nil
+}
+
+func (d *discoverer) run(ctx context.Context, targets []rangeTargets, pools []pingPool, groups [][]rangeTargets) Report {
+	summary := newSummary(d.cfg.RunID)
+	summary.Trigger = d.cfg.Trigger
+	summary.Targeted = d.cfg.Only != nil
+	summary.CreateLimit = d.cfg.CreateLimit
+	summary.RetryOf = d.cfg.RetryOf
+	for _, b := range d.backends {
+		summary.Targets = append(summary.Targets, TargetSummary{Target: b.Name()})
+	}
+	var hosts []HostResult
+	summary.TargetsExcluded = d.excluded
+	summary.TargetsSelf = d.self
+	summary.TargetsInvalid = d.invalid
+	for _, t := range targets {
+		if summary.Targeted && t.count == 0 {
+			continue
+		}
+		summary.rangeCounts(t.rng).Targets += t.count
+		summary.TargetsExpanded += t.count
+	}
+	for _, r := range d.cfg.Previous {
+		summary.add(r)
+		if d.cfg.OnResult != nil {
+			d.cfg.OnResult(r)
+		}
+		if r.Alive {
+			hosts = append(hosts, r)
+		}
+	}
+	summary.Stages = []StageSummary{
+		{Stage: StagePing, Workers: d.cfg.PingWorkers},
+		{Stage: StageSNMP, Workers: d.cfg.SNMPWorkers},
+	}
+	if d.registers() {
+		summary.Stages = append(summary.Stages, StageSummary{Stage: StageZabbix, Workers: d.cfg.ZabbixWorkers, QueueSize: d.cfg.ZabbixQueue})
+	}
+	progress := d.cfg.Progress
+	if progress == nil {
+		progress = &Progress{}
+	}
+	progress.begin(summary)
+	d.progress = progress
+	if d.cfg.Adaptive != nil {
+		d.adaptive = newAdaptive(*d.cfg.Adaptive, summary.Start, progress)
+	}
+
+	// Cada etapa entrega à seguinte os hosts que continuam e ao coletor os
+	// que terminaram nela. O canal de entrada de uma etapa é fechado quando
+	// todos os workers da anterior saem. A etapa de ping tem um pool por
+	// grupo de ranges, cada um com o seu produtor; os hosts dos agentes
+	// remotos entram direto no cadastro.
+	snmpIn := make(chan HostResult, d.cfg.SNMPWorkers)
+	results := make(chan HostResult, d.cfg.PingWorkers)
+	var pingDone []<-chan struct{}
+	feedCtx := ctx
+	if d.cfg.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		feedCtx, cancel = context.WithTimeout(ctx, d.cfg.MaxDuration)
+		defer cancel()
+		stop := context.AfterFunc(feedCtx, func() {
+			if ctx.Err() == nil && errors.Is(feedCtx.Err(), context.DeadlineExceeded) {
+				d.log.Warnf("run.deadline_reached", d.cfg.MaxDuration)
+			}
+		})
+		defer stop()
+	}
+	for _, p := range pools {
+		jobs := make(chan job, p.workers)
+		go d.produce(feedCtx, p.targets, jobs)
+		lim := d.adaptive.limiter(StagePing, p.workers, d.cfg.PingWorkers)
+		pingDone = append(pingDone, d.stage(p.workers, func() {
+			for j := range jobs {
+				// Os IPs que ficaram na fila também não são iniciados
+				if feedCtx.Err() == nil {
+					lim.acquire()
+					d.pingHost(ctx, j, snmpIn, results)
+					lim.release()
+				}
+			}
+		}))
+	}
+	d.holding = d.cfg.Confirm != nil && d.registers()
+	d.snmpLimit = d.adaptive.limiter(StageSNMP, d.cfg.SNMPWorkers, d.cfg.SNMPWorkers)
+	d.zabbixLimit = newLimiter(d.cfg.ZabbixWorkers)
+	if d.registers() {
+		d.zabbixLimit = d.adaptive.limiter(StageZabbix, d.cfg.ZabbixWorkers, d.cfg.ZabbixWorkers)
+	}
+	if d.adaptive != nil {
+		actx, stop := context.WithCancel(ctx)
+		defer stop()
+		go d.adaptive.run(actx, d)
+	}
+	fromAgents := make(chan HostResult, d.cfg.ZabbixWorkers)
+	agents := d.runRemote(ctx, feedCtx, groups, fromAgents, results)
+	lateDone := d.lateStages(ctx, snmpIn, fromAgents, results, true)
+
+	// Apenas o coletor altera o resumo; o progresso lê cópias
+	collected := make(chan struct{})
+	go func() {
+		for r := range results {
+			r.Trigger = d.cfg.Trigger
+			r.Recovered = d.cfg.RetryOf != "" && r.Alive && r.Err() == nil
+			progress.add(r)
+			if d.cfg.OnResult != nil {
+				d.cfg.OnResult(r)
+			}
+			if r.Alive {
+				hosts = append(hosts, r)
+			}
+		}
+		close(collected)
+	}()
+
+	for _, done := range pingDone {
+		<-done
+	}
+	close(snmpIn)
+	<-lateDone
+	d.retryRounds(ctx, results)
+	d.confirm(ctx, results)
+	close(results)
+	<-collected
+	d.flushAllHostLogs()
+	final := progress.Snapshot()
+	final.End = time.Now()
+	final.Interrupted = ctx.Err() != nil
+	final.DeadlineReached = !final.Interrupted && feedCtx.Err() != nil && final.NotScanned() > 0
+	final.Panics = int(d.panics.Load())
+	final.Agents = agents
+	return Report{Summary: final, Hosts: hosts}
+}
+
+// Envia os IPs à etapa de ping, na ordem dos ranges ou em rodízio com
+// Interleave, pulando os que já vieram de um run anterior. Para no
+// cancelamento; jobs é fechado sempre, e só aqui.
+func (d *discoverer) produce(ctx context.Context, targets []rangeTargets, jobs chan<- job) {
+	defer close(jobs)
+	done := d.previous()
+	send := func(n uint32, rng string) bool {
+		ip := iprange.String(n)
+		if done[ip] {
+			return true
+		}
+		if !d.seen.addV4(n) {
+			d.duplicate(ip, rng)
+			return true
+		}
+		select {
+		case jobs <- job{ip: ip, rng: rng}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	if !d.cfg.Interleave {
+		for _, t := range targets {
+			for n := range t.all() {
+				if !send(n, t.rng) {
+					return
+				}
+			}
+		}
+		return
+	}
+	next := make([]func() (uint32, bool), len(targets))
+	for i, t := range targets {
+		var stop func()
+		next[i], stop = iter.Pull(t.all())
+		defer stop()
+	}
+	for more := true; more; {
+		more = false
+		for i, t := range targets {
+			n, ok := next[i]()
+			if !ok {
+				continue
+			}
+			more = true
+			if !send(n, t.rng) {
+				return
+			}
+		}
+	}
+}
+
+// Inicia as etapas de SNMP e Zabbix sobre os hosts de snmpIn; os de
+// toZabbix (hosts dos agentes, retentativas de falhas no Zabbix) entram
+// direto no cadastro. O canal retornado é fechado quando as duas etapas
+// terminam, depois que snmpIn e toZabbix forem fechados. Com dedup (a
+// primeira passagem), um IP que já entrou no cadastro é descartado como
+// duplicado; as retentativas e os hosts confirmados repetem o IP de
+// propósito.
+//
+// O cadastro não para com o cancelamento de ctx: os hosts que já passaram
+// pelo SNMP e estão na fila são cadastrados antes de as etapas terminarem.
+func (d *discoverer) lateStages(ctx context.Context, snmpIn, toZabbix <-chan HostResult, results chan<- HostResult, dedup bool) <-chan struct{} {
+	zabbixIn := make(chan HostResult, d.cfg.ZabbixQueue)
+	enqueue := func(r HostResult) {
+		if dedup && !d.published.add(r.IP) {
+			d.duplicate(r.IP, r.Range)
+			return
+		}
+		if d.hold(r) {
+			return
+		}
+		d.progress.queue(StageZabbix, 1)
+		zabbixIn <- r
+	}
+	snmpDone := d.stage(d.cfg.SNMPWorkers, func() {
+		for r := range snmpIn {
+			d.snmpLimit.acquire()
+			d.snmpHost(ctx, r, enqueue, results)
+			d.snmpLimit.release()
+		}
+	})
+	zabbixWorkers := d.cfg.ZabbixWorkers
+	if !d.registers() {
+		zabbixWorkers = 0
+	}
+	drainCtx := context.WithoutCancel(ctx)
+	zabbixDone := d.stage(zabbixWorkers, func() {
+		for r := range zabbixIn {
+			d.progress.queue(StageZabbix, -1)
+			// Abortado, a fila só é esvaziada
+			if d.aborted.Load() {
+				continue
+			}
+			d.zabbixLimit.acquire()
+			d.zabbixHost(drainCtx, r, results)
+			d.zabbixLimit.release()
+		}
+	})
+	stop := context.AfterFunc(ctx, func() {
+		if n := len(zabbixIn); n > 0 {
+			d.log.Warnf("zabbix.draining", n)
+		}
+	})
+	done := make(chan struct{})
+	go func() {
+		for r := range toZabbix {
+			enqueue(r)
+		}
+		<-snmpDone
+		close(zabbixIn)
+		<-zabbixDone
+		stop()
+		close(done)
+	}()
+	return done
+}
+
+// Depois da fila principal, repete as falhas passageiras em rodadas
+// separadas por RetryDelay, até MaxRetries tentativas extras por host. Os
+// hosts que sobrarem (ou todos, se o run for cancelado durante a espera) são
+// entregues com a última falha.
+func (d *discoverer) retryRounds(ctx context.Context, results chan<- HostResult) {
+	for round := 1; ; round++ {
+		d.retryMu.Lock()
+		pending := d.retry
+		d.retry = nil
+		d.retryMu.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+		d.log.Infof("retry.round", round, len(pending), d.cfg.RetryDelay)
+		select {
+		case <-time.After(d.cfg.RetryDelay):
+		case <-ctx.Done():
+			for _, r := range pending {
+				results <- r
+			}
+			return
+		}
+		snmpIn := make(chan HostResult, d.cfg.SNMPWorkers)
+		toZabbix := make(chan HostResult, d.cfg.ZabbixQueue)
+		done := d.lateStages(ctx, snmpIn, toZabbix, results, false)
+		for _, r := range pending {
+			if r.SNMPErr != nil {
+				snmpIn <- r.resetSNMP()
+			} else {
+				toZabbix <- r.resetZabbix()
+			}
+		}
+		close(snmpIn)
+		close(toZabbix)
+		<-done
+	}
+}
+
+// Retém o host até o Config.Confirm, se ele ainda não foi chamado.
+func (d *discoverer) hold(r HostResult) bool {
+	d.holdMu.Lock()
+	defer d.holdMu.Unlock()
+	if d.holding {
+		d.held = append(d.held, r)
+	}
+	return d.holding
+}
+
+// Passa os hosts retidos ao Config.Confirm e, se aceitos, faz o cadastro
+// deles, com as retentativas. Recusados (ou com o run interrompido antes da
+// pergunta), saem com ZabbixSkipped.
+func (d *discoverer) confirm(ctx context.Context, results chan<- HostResult) {
+	d.holdMu.Lock()
+	held := d.held
+	d.holding, d.held = false, nil
+	d.holdMu.Unlock()
+	if len(held) == 0 {
+		return
+	}
+	if ctx.Err() != nil || d.aborted.Load() || !d.cfg.Confirm(held) {
+		for _, r := range held {
+			r.ZabbixAction = ZabbixSkipped
+			results <- r
+		}
+		return
+	}
+	snmpIn := make(chan HostResult)
+	toZabbix := make(chan HostResult, d.cfg.ZabbixQueue)
+	done := d.lateStages(ctx, snmpIn, toZabbix, results, false)
+	close(snmpIn)
+	for _, r := range held {
+		toZabbix <- r
+	}
+	close(toZabbix)
+	<-done
+	d.retryRounds(ctx, results)
+}
+
+// Indica se a falha do host parece passageira e vale uma nova tentativa.
+// Timeouts e falhas ao abrir o socket SNMP, o prazo por host e falhas de rede
+// ou HTTP 5xx da API são repetidos; sysName ausente, porta recusada e erros
+// retornados pela API do Zabbix, que se repetiriam, não. No SNMP v2c uma
+// community errada costuma aparecer como timeout e não há como distingui-la.
+func retryable(r HostResult) bool {
+	switch {
+	case r.SNMPErr != nil:
+		return r.SNMPReason == snmpinfo.ReasonTimeout || r.SNMPReason == snmpinfo.ReasonConnect
+	case r.ZabbixErr != nil:
+		return errors.Is(r.ZabbixErr, ErrHostTimeout) || zabbix.Transient(r.ZabbixErr)
+	}
+	return false
+}
+
+// Guarda o host para a próxima rodada de retentativas, se a falha for
+// passageira e ainda houver tentativas e espaço na fila.
+func (d *discoverer) deferRetry(hl logx.Logger, r HostResult) bool {
+	if !d.willRetry(r) {
+		return false
+	}
+	d.retryMu.Lock()
+	defer d.retryMu.Unlock()
+	if len(d.retry) >= retryQueueLimit {
+		hl.Warnf("retry.queue_full", r.IP, retryQueueLimit)
+		return false
+	}
+	hl.WithErr(r.Err()).Debugf("retry.queued", r.IP, r.Attempts, d.cfg.MaxRetries+1)
+	d.retry = append(d.retry, r)
+	return true
+}
+
+// Indica se a falha do host ainda tem tentativas pela frente.
+func (d *discoverer) willRetry(r HostResult) bool {
+	return r.Attempts <= d.cfg.MaxRetries && retryable(r)
+}
+
+// Inicia os workers de uma etapa; o canal retornado é fechado quando todos
+// saírem.
+func (d *discoverer) stage(workers int, work func()) <-chan struct{} {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// Entrega ao coletor um host concluído. Etapas que falharam por causa do
+// cancelamento não contam como concluídas; falhas passageiras esperam a
+// rodada de retentativas.
+func (d *discoverer) finish(ctx context.Context, r HostResult, results chan<- HostResult) {
+	d.progress.leave(r.IP)
+	d.flushHostLogs(r.IP)
+	if ctx.Err() != nil && (!r.Alive || r.Err() != nil) {
+		return
+	}
+	if r.Alive && r.Err() != nil && d.deferRetry(d.hostLog(r.IP, r.Range), r) {
+		return
+	}
+	results <- r
+}
+
+// Indica se os hosts identificados são cadastrados no Zabbix.
+func (d *discoverer) registers() bool {
+	return !d.cfg.DryRun && !d.cfg.SkipZabbix
+}
+
+// Indica se os hosts identificados de um range são cadastrados no Zabbix.
+func (d *discoverer) registersRange(rng string) bool {
+	if b, ok := d.byRange[rng]; ok && len(b) == 0 {
+		return false
+	}
+	return d.registers() && !d.cfg.SkipZabbixRanges[rng]
+}
+
+// Ação de um host identificado que não é cadastrado.
+func (d *discoverer) unregistered(hl logx.Logger, r HostResult) string {
+	if !d.cfg.DryRun {
+		return ZabbixSkipped
+	}
+	hl.With("stage", "zabbix").Infof("zabbix.dry_run", r.SNMP.SysName, r.IP)
+	return ZabbixDryRun
+}
+
+// Indica se o host identificado foi descartado pelo Config.Filter ou está em
+// Config.Known; nesse caso ele sai com ZabbixFiltered ou ZabbixKnown, sem
+// cadastro.
+func (d *discoverer) known(hl logx.Logger, r *HostResult) bool {
+	if d.cfg.Filter != nil && !d.cfg.Filter(*r) {
+		r.ZabbixAction = ZabbixFiltered
+		hl.With("stage", "zabbix").Debugf("filter.skipped", r.Name(), r.IP)
+		return true
+	}
+	if d.cfg.Known == nil {
+		return false
+	}
+	match := d.cfg.Known(*r)
+	if match == "" {
+		return false
+	}
+	r.ZabbixAction, r.Known = ZabbixKnown, match
+	hl.With("stage", "zabbix").Infof("known.skipped", r.Name(), r.IP, match)
+	return true
+}
+
+// Registra a segunda ocorrência de um IP, que não é processada; ela sai dos
+// alvos do range, que não fica esperando por ela.
+func (d *discoverer) duplicate(ip, rng string) {
+	d.hostLog(ip, rng).Debugf("target.duplicate", ip, rng)
+	d.progress.duplicate(rng)
+}
+
+// Etapa de ping: os hosts que responderam seguem para o SNMP.
+func (d *discoverer) pingHost(ctx context.Context, j job, next, results chan<- HostResult) {
+	if ctx.Err() != nil {
+		return
+	}
+	r := HostResult{IP: j.ip, Range: j.rng, Attempts: 1}
+	d.progress.enter(j.ip, StagePing)
+	defer d.recoverHost(ctx, StagePing, r, results)
+	hctx, cancel := d.hostContext(ctx, r)
+	defer cancel()
+	hl := d.hostLog(j.ip, j.rng)
+	start := time.Now()
+	r.Alive, r.PingErr = d.ping(hctx, hl, j.ip)
+	r.PingTime = time.Since(start)
+	if !r.Alive && hostExpired(ctx, hctx) {
+		d.timedOut(hl, &r, StagePing)
+		r.PingErr = ErrHostTimeout
+	}
+	if r.PingErr != nil {
+		r.PingReason = pingReason(r.PingErr)
+	}
+	d.adaptive.observe(StagePing, r.PingErr != nil)
+	if !r.Alive {
+		d.finish(ctx, r, results)
+		return
+	}
+	if c, ok := d.cfg.Cache[j.ip]; ok {
+		hl.Debugf("cache.hit", j.ip, c.SNMP.SysName, c.HostID)
+		r.SNMP, r.HostID, r.ZabbixAction = c.SNMP, c.HostID, ZabbixCached
+		d.finish(ctx, r, results)
+		return
+	}
+	d.scanPorts(hctx, hl, &r)
+	next <- r
+}
+
+// Etapa SNMP: os hosts identificados seguem para o cadastro no Zabbix, exceto
+// no DryRun. Com o Fallback, os que falharam também seguem, pelo nome DNS.
+func (d *discoverer) snmpHost(ctx context.Context, r HostResult, next func(HostResult), results chan<- HostResult) {
+	if ctx.Err() != nil {
+		return
+	}
+	d.progress.enter(r.IP, StageSNMP)
+	defer d.recoverHost(ctx, StageSNMP, r, results)
+	hctx, cancel := d.hostContext(ctx, r)
+	defer cancel()
+	hl := d.hostLog(r.IP, r.Range)
+	start := time.Now()
+	info, err := d.getSNMPInfo(hctx, hl, r.IP)
+	r.SNMPTime = time.Since(start)
+	d.adaptive.observe(StageSNMP, err != nil && (hostExpired(ctx, hctx) || isSNMPTimeout(err)))
+	if err != nil {
+		hl.With("stage", "snmp").WithErr(err).Infof("snmp.failed_after_ping", r.IP, err)
+		r.SNMPErr = err
+		r.SNMPReason = snmpinfo.ReasonOther
+		var se *snmpinfo.Error
+		if errors.As(err, &se) {
+			r.SNMPReason = se.Reason
+		}
+		if hostExpired(ctx, hctx) {
+			d.timedOut(hl, &r, StageSNMP)
+			r.SNMPErr = &snmpinfo.Error{Reason: snmpinfo.ReasonTimeout, Err: ErrHostTimeout}
+			r.SNMPReason = snmpinfo.ReasonTimeout
+		}
+		if d.nameFallback(hctx, hl, &r) {
+			if d.known(hl, &r) {
+				d.finish(ctx, r, results)
+				return
+			}
+			next(r)
+			return
+		}
+		d.finish(ctx, r, results)
+		return
+	}
+	r.SNMP = info
+	if d.known(hl, &r) {
+		d.finish(ctx, r, results)
+		return
+	}
+	if !d.registersRange(r.Range) {
+		r.ZabbixAction = d.unregistered(hl, r)
+		d.finish(ctx, r, results)
+		return
+	}
+	next(r)
+}
+
+// Etapa do Zabbix: cadastra o host e o entrega ao coletor.
+func (d *discoverer) zabbixHost(ctx context.Context, r HostResult, results chan<- HostResult) {
+	if ctx.Err() != nil {
+		return
+	}
+	d.progress.enter(r.IP, StageZabbix)
+	defer d.recoverHost(ctx, StageZabbix, r, results)
+	hctx, cancel := d.hostContext(ctx, r)
+	defer cancel()
+	hl := d.hostLog(r.IP, r.Range)
+	if !d.reserveCreate(ctx) {
+		if ctx.Err() != nil {
+			return
+		}
+		if d.limitHit.CompareAndSwap(false, true) {
+			d.log.Warnf("limit.reached", d.cfg.CreateLimit)
+		}
+		r.ZabbixAction = ZabbixLimited
+		hl.With("stage", "zabbix").Infof("limit.skipped", r.Name(), r.IP, d.cfg.CreateLimit)
+		d.finish(ctx, r, results)
+		return
+	}
+	// Resolvida também se o cadastro entrar em panic, para não prender a
+	// vaga de quem espera por ela
+	defer func() { d.resolveCreate(r.ZabbixAction == zabbix.Created || r.ZabbixAction == ZabbixPartial) }()
+	start := time.Now()
+	if len(d.backends) > 0 {
+		d.createInTargets(hctx, hl, &r)
+	} else {
+		r.ZabbixAction, r.HostID, r.ZabbixErr = d.createZabbixHost(hctx, hl, r, d.primary())
+	}
+	r.ZabbixTime = time.Since(start)
+	d.adaptive.observe(StageZabbix, r.ZabbixErr != nil)
+	if errors.Is(r.ZabbixErr, zabbix.ErrAuth) {
+		d.fatal(hl, r.ZabbixErr)
+	}
+	if r.ZabbixErr != nil && hostExpired(ctx, hctx) {
+		d.timedOut(hl, &r, StageZabbix)
+		r.ZabbixErr = fmt.Errorf("%w: %w", ErrHostTimeout, r.ZabbixErr)
+	}
+	d.finish(ctx, r, results)
+}
+
+// Reserva a vaga de um host no Config.CreateLimit antes do cadastro; false
+// quando o limite já foi atingido pelos hosts criados, ou com ctx cancelado.
+// Com as vagas restantes todas em cadastros em andamento, espera que eles se
+// resolvam: um host que já existia devolve a vaga, e o próximo host novo não
+// pode sair como ZabbixLimited por causa dele.
+func (d *discoverer) reserveCreate(ctx context.Context) bool {
+	if d.cfg.CreateLimit <= 0 {
+		return true
+	}
+	d.createMu.Lock()
+	for {
+		if d.created >= d.cfg.CreateLimit {
+			d.createMu.Unlock()
+			return false
+		}
+		if d.created+d.creating < d.cfg.CreateLimit {
+			d.creating++
+			d.createMu.Unlock()
+			return true
+		}
+		if d.createDone == nil {
+			d.createDone = make(chan struct{})
+		}
+		done := d.createDone
+		d.createMu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return false
+		}
+		d.createMu.Lock()
+	}
+}
+
+// Resolve a vaga reservada por reserveCreate: conta o host se ele foi criado
+// ou a devolve para os próximos.
+func (d *discoverer) resolveCreate(created bool) {
+	if d.cfg.CreateLimit <= 0 {
+		return
+	}
+	d.createMu.Lock()
+	defer d.createMu.Unlock()
+	d.creating--
+	if created {
+		d.created++
+	}
+	if d.createDone != nil {
+		close(d.createDone)
+		d.createDone = nil
+	}
+}
+
+// Recupera um panic na etapa de um host, usado com defer no início de cada
+// etapa com o host como ele entrou nela. O host sai com ErrInternal e o
+// worker segue para o próximo; mais de maxPanics abortam o run.
+func (d *discoverer) recoverHost(ctx context.Context, stage string, r HostResult, results chan<- HostResult) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	n := int(d.panics.Add(1))
+	hl := d.hostLog(r.IP, r.Range).With("stage", stage)
+	hl.With("stack", string(debug.Stack())).Errorf("worker.panic", r.IP, stage, p)
+	err := fmt.Errorf("%w: panic: %v", ErrInternal, p)
+	switch stage {
+	case StagePing:
+		r.PingErr, r.PingReason = err, ReasonInternal
+	case StageSNMP:
+		r.SNMPErr, r.SNMPReason = err, ReasonInternal
+	case StageZabbix:
+		r.ZabbixAction, r.ZabbixErr = zabbix.Failed, err
+	}
+	if n == maxPanics+1 {
+		hl.Errorf("run.too_many_panics", n, maxPanics)
+		d.stop(fmt.Errorf("%w (%d)", ErrTooManyPanics, n))
+	}
+	d.finish(ctx, r, results)
+}
+
+// Aborta o run pelo erro fatal de um host. Só o primeiro é registrado; os
+// workers que falharem junto com ele encontram o run já abortado.
+func (d *discoverer) fatal(hl logx.Logger, err error) {
+	if d.aborted.Load() {
+		return
+	}
+	hl.WithErr(err).Errorf("run.fatal", err)
+	d.stop(fmt.Errorf("%w: %w", ErrFatal, err))
+}
+
+func (d *discoverer) stop(cause error) {
+	if d.aborted.CompareAndSwap(false, true) {
+		d.abort(cause)
+	}
+}
+
+// Contexto de uma etapa do host, limitado ao que sobra do HostTimeout depois
+// das etapas anteriores. A espera nas filas entre as etapas não conta.
+func (d *discoverer) hostContext(ctx context.Context, r HostResult) (context.Context, context.CancelFunc) {
+	if d.cfg.Trace != nil {
+		ctx = hosttrace.With(ctx, d.cfg.Trace(r.IP))
+	}
+	ctx = logx.NewContext(ctx, d.hostLog(r.IP, r.Range))
+	if d.cfg.HostTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d.cfg.HostTimeout-r.Duration())
+}
+
+func isSNMPTimeout(err error) bool {
+	var se *snmpinfo.Error
+	return errors.As(err, &se) && se.Reason == snmpinfo.ReasonTimeout
+}
+
+// Indica se a etapa parou pelo prazo do host, e não pelo cancelamento do run.
+func hostExpired(ctx, hctx context.Context) bool {
+	return ctx.Err() == nil && errors.Is(hctx.Err(), context.DeadlineExceeded)
+}
+
+func (d *discoverer) timedOut(hl logx.Logger, r *HostResult, stage string) {
+	r.TimedOut = true
+	hl.With("stage", stage).Warnf("host.timeout", r.IP, d.cfg.HostTimeout, stage)
+}
+
+// Faz o ping do IP. Um host que não respondeu não é um erro; o erro só é
+// retornado quando o próprio ping não pôde ser executado.
+func (d *discoverer) ping(ctx context.Context, hl logx.Logger, ip string) (bool, error) {
+	hl = hl.With("stage", "ping")
+	hl.Debugf("ping.testing", ip)
+	start := time.Now()
+	alive, err := d.cfg.Pinger.Probe(ctx, ip)
+	hl = hl.WithDuration(time.Since(start))
+	hosttrace.From(ctx).Printf("ping: resposta %t, erro %v, em %s", alive, err, time.Since(start).Round(time.Microsecond))
+	switch {
+	case err != nil:
+		d.pingFailure(hl, ip, err)
+		if errors.Is(err, exec.ErrNotFound) {
+			d.fatal(hl, err)
+		}
+	case alive:
+		hl.Infof("ping.alive", ip)
+	default:
+		hl.Debugf("ping.dead", ip)
+	}
+	return alive, err
+}
+
+// Motivo probe.Reason* da falha do ping, ou probe.ReasonOther de um erro sem
+// motivo, como o ErrHostTimeout.
+func pingReason(err error) string {
+	var pe *probe.Error
+	if errors.As(err, &pe) {
+		return pe.Reason
+	}
+	return probe.ReasonOther
+}
+
+// Registra a falha do ping de um host. As de permissão e de execução não
+// dependem do host: passadas as pingErrorsLogged primeiras, viram um erro do
+// run, registrado uma vez.
+func (d *discoverer) pingFailure(hl logx.Logger, ip string, err error) {
+	reason := pingReason(err)
+	d.pingMu.Lock()
+	if d.pingFailed == nil {
+		d.pingFailed = map[string]int{}
+	}
+	d.pingFailed[reason]++
+	n := d.pingFailed[reason]
+	d.pingMu.Unlock()
+	hl = hl.WithErr(err).With("reason", reason)
+	if reason != probe.ReasonPermission && reason != probe.ReasonInvocation {
+		hl.Errorf("ping.failed", ip, reason, err)
+		return
+	}
+	switch {
+	case n < pingErrorsLogged:
+		hl.Errorf("ping.failed", ip, reason, err)
+	case n == pingErrorsLogged:
+		hl.Errorf("ping.failed", ip, reason, err)
+		code := "ping.permission_denied"
+		if reason == probe.ReasonInvocation {
+			code = "ping.invocation_failed"
+		}
+		d.log.With("stage", "ping").WithErr(err).Errorf(code, n)
+	default:
+		hl.Debugf("ping.failed", ip, reason, err)
+	}
+}
+
+// Consulta o sistema tentando cada community configurada, na ordem.
+func (d *discoverer) getSNMPInfo(ctx context.Context, hl logx.Logger, ip string) (snmpinfo.Info, error) {
+	hl = hl.With("stage", "snmp")
+	var lastErr error
+	for _, community := range d.cfg.Communities {
+		hl.Debugf("snmp.connecting", ip)
+		start := time.Now()
+		info, err := d.cfg.SNMP.SysInfo(ctx, ip, community)
+		if err == nil {
+			hl.WithDuration(time.Since(start)).Infof("snmp.sysname", ip, info.SysName)
+			return info, nil
+		}
+		var se *snmpinfo.Error
+		errors.As(err, &se)
+		switch {
+		case se != nil && se.Reason == snmpinfo.ReasonConnect:
+			hl.WithErr(err).Debugf("snmp.connect_failed", ip, err)
+		case se != nil && se.Reason == snmpinfo.ReasonNoString:
+			hl.Debugf("snmp.no_string", ip)
+		default:
+			hl.WithErr(err).WithDuration(time.Since(start)).Debugf("snmp.query_failed", ip, err)
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = &snmpinfo.Error{Reason: snmpinfo.ReasonNoCommunity, Err: fmt.Errorf("nenhuma community SNMP configurada")}
+	}
+	return snmpinfo.Info{}, lastErr
+}
+
+// Cadastra o host no backend se ainda não existir, retornando a ação
+// (zabbix.Created, zabbix.Existing, zabbix.Upgraded, zabbix.Failed ou
+// ZabbixDryRun) e o hostid.
+func (d *discoverer) createZabbixHost(ctx context.Context, hl logx.Logger, r HostResult, b Backend) (string, string, error) {
+	hl = hl.With("stage", "zabbix")
+	if b.Name() != "" {
+		hl = hl.With("target", b.Name())
+	}
+	start := time.Now()
+	name, ip := r.Name(), r.IP
+	spec := zabbix.HostSpec{
+		Name:        name,
+		IP:          ip,
+		Community:   r.SNMP.Community,
+		Range:       r.Range,
+		Description: r.SNMP.SysDescr,
+		Location:    r.SNMP.SysLocation,
+	}
+	for _, port := range r.OpenPorts {
+		spec.Tags = append(spec.Tags, zabbix.Tag{Tag: "service", Value: ServiceName(port)})
+	}
+	if fb := d.cfg.Fallback; fb != nil {
+		spec.FallbackTag = fb.Tag
+		if r.FallbackName != "" {
+			spec.Interface = fb.Interface
+		}
+	}
+	if tb, ok := b.(targetBackend); ok {
+		if host := zabbix.TechnicalName(name); host != name {
+			hl.Infof("zabbix.name_sanitized", ip, name, host)
+		}
+		hl.Debugf("zabbix.ensuring", name, ip, strings.Join(tb.t.GroupIDs, ","), tb.t.ProxyID)
+	} else {
+		hl.Debugf("backend.ensuring", name, ip, b.Name())
+	}
+	t := hosttrace.From(ctx)
+	t.Printf("cadastro: %s (%s) no backend %q", name, ip, b.Name())
+	outcome, err := b.Ensure(ctx, spec)
+	action, hostID := outcome.Action, outcome.HostID
+	if err != nil && action == "" {
+		action = zabbix.Failed
+	}
+	t.Printf("cadastro: %s, hostid %q, erro %v, em %s", action, hostID, err, time.Since(start).Round(time.Millisecond))
+	hl = hl.WithDuration(time.Since(start))
+	switch {
+	case err != nil && b.Name() != "":
+		hl.WithErr(err).Errorf("zabbix.target_create_failed", name, ip, b.Name(), err)
+	case err != nil:
+		hl.WithErr(err).Errorf("zabbix.create_failed", name, ip, err)
+	case action == zabbix.Existing:
+		hl.Infof("zabbix.exists", name, hostID)
+	case action == zabbix.Upgraded:
+		hl.Infof("zabbix.upgraded", name, hostID)
+	case action == ZabbixDryRun:
+		// O próprio backend registra o que faria
+	default:
+		hl.Infof("zabbix.created", name, hostID)
+	}
+	return action, hostID, err
+}
@@ -0,0 +1,125 @@
+package discovery
+
+import (
+	"io"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"discoveryhosts/discovery/discoverytest"
+	"discoveryhosts/iprange"
+	"discoveryhosts/logx"
+)
+
+// Ranges que não são endereços nem intervalos: o run falha antes do ping.
+func TestRunHostileRanges(t *testing.T) {
+	for _, rng := range []string{"-f", "--help", "10.0.0.1 -f", "10.0.0.1;reboot", "$(id)", "localhost"} {
+		cfg := testConfig("10.0.0.0/30", rng)
+		pinger := &discoverytest.Pinger{Alive: map[string]bool{"10.0.0.1": true}}
+		cfg.Pinger = pinger
+		if _, err := Run(t.Context(), cfg); err == nil {
+			t.Errorf("range %q: esperava erro", rng)
+		}
+		if calls := pinger.Calls(); len(calls) > 0 {
+			t.Errorf("range %q: o ping foi chamado para %v", rng, calls)
+		}
+	}
+}
+
+// Alvos de Only que não são IPs são descartados e contados à parte; Exclude
+// e Self saem dos ranges locais, e os ranges dos agentes vão inteiros.
+func TestTargetFilter(t *testing.T) {
+	targets, err := expandRanges([]string{"10.0.0.0/29", "10.0.1.0/29", "10.0.2.0/29"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Exclude: map[string]bool{"10.0.0.1": true, "10.0.2.1": true, "10.0.0.2": false},
+		Self:    func(ip netip.Addr) bool { return ip == netip.MustParseAddr("10.0.0.6") },
+		Only:    map[string]bool{"10.0.0.1": true, "10.0.0.3": true, "10.0.0.6": true, "10.0.2.1": true, "2001:db8::1": true, "-f": true, "$(id)": true, "10.0.1.1 -c 9": true},
+		Remote:  []Remote{{Name: "a1", Ranges: []string{"10.0.2.0/29"}}},
+	}
+	log := logx.New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	f, invalid := newTargetFilter(log, cfg)
+	if invalid != 3 {
+		t.Errorf("esperava 3 alvos inválidos, obteve %d", invalid)
+	}
+	excluded, self := filterTargets(targets, f, cfg.Remote)
+	if excluded != 1 || self != 1 {
+		t.Errorf("esperava 1 excluído e 1 do scanner, obteve %d e %d", excluded, self)
+	}
+	var got []string
+	for i, want := range []int{1, 0, 6} {
+		if targets[i].count != want {
+			t.Errorf("%s: esperava %d IPs, obteve %d", targets[i].rng, want, targets[i].count)
+		}
+	}
+	for n := range targets[0].all() {
+		got = append(got, iprange.String(n))
+	}
+	if !slices.Equal(got, []string{"10.0.0.3"}) {
+		t.Errorf("alvos restantes incorretos: %v", got)
+	}
+}
+
+// Configurações que nunca fariam progresso (workers 0 numa etapa, nenhum
+// alvo) retornam erro em vez de travar o run.
+func TestRunNoProgress(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*Config)
+	}{
+		{"workers 0", func(c *Config) { c.Workers = 0 }},
+		{"ping sem workers", func(c *Config) { c.Workers, c.SNMPWorkers, c.ZabbixWorkers = 0, 2, 2 }},
+		{"zabbix sem workers", func(c *Config) { c.Workers, c.PingWorkers, c.SNMPWorkers = 0, 2, 2 }},
+		{"workers negativo", func(c *Config) { c.Workers = -1 }},
+		{"sem ranges", func(c *Config) { c.Ranges = nil }},
+		{"tudo excluído", func(c *Config) { c.Exclude = map[string]bool{"10.0.0.1": true, "10.0.0.2": true} }},
+	}
+	for _, tt := range tests {
+		cfg := testConfig("10.0.0.0/30")
+		cfg.Pinger = &discoverytest.Pinger{Alive: map[string]bool{"10.0.0.1": true}}
+		tt.setup(&cfg)
+		done := make(chan error, 1)
+		go func() {
+			_, err := Run(t.Context(), cfg)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("%s: esperava erro", tt.name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: Run não retornou", tt.name)
+		}
+	}
+}
+
+// Um /8 é filtrado e percorrido sem alocar nada por IP.
+func TestRangeStreamsWithoutExpanding(t *testing.T) {
+	if testing.Short() {
+		t.Skip("percorre 16 milhões de IPs")
+	}
+	targets, err := expandRanges([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &targetFilter{self: netip.Addr.IsLoopback}
+	var walked int
+	allocs := testing.AllocsPerRun(1, func() {
+		filterTargets(targets, f, nil)
+		walked = 0
+		for range targets[0].all() {
+			walked++
+		}
+	})
+	if walked != 1<<24-2 || targets[0].count != walked {
+		t.Errorf("esperava %d IPs, obteve %d (contados %d)", 1<<24-2, walked, targets[0].count)
+	}
+	if allocs > 100 {
+		t.Errorf("esperava alocações constantes, obteve %.0f", allocs)
+	}
+}
@@ -0,0 +1,189 @@
+// Package discoverytest fornece implementações em memória das etapas do
+// discovery (Pinger, SNMPQuerier, HostCreator e Resolver), para exercitar Run sem rede
+// e sem um Zabbix de verdade. Os valores zero estão prontos para uso e podem
+// ser usados por vários workers ao mesmo tempo.
+package discoverytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"discoveryhosts/snmpinfo"
+	"discoveryhosts/zabbix"
+)
+
+// Pinger responde pelos IPs de Alive e falha com o erro de Errs, se houver;
+// os demais não respondem.
+type Pinger struct {
+	Alive map[string]bool
+	Errs  map[string]error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (p *Pinger) Probe(ctx context.Context, ip string) (bool, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, ip)
+	p.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return false, nil
+	}
+	if err := p.Errs[ip]; err != nil {
+		return false, err
+	}
+	return p.Alive[ip], nil
+}
+
+// Calls são os IPs consultados, na ordem das chamadas.
+func (p *Pinger) Calls() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.calls...)
+}
+
+// SNMP responde pelos IPs de Hosts com a community de Communities (qualquer
+// uma, se o IP não estiver lá) e falha com o erro de Errs, se houver. Os
+// demais IPs dão timeout, como um host sem SNMP.
+type SNMP struct {
+	Hosts       map[string]snmpinfo.Info
+	Communities map[string]string
+	Errs        map[string]error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (s *SNMP) SysInfo(ctx context.Context, ip, community string) (snmpinfo.Info, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, ip+"/"+community)
+	s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return snmpinfo.Info{}, &snmpinfo.Error{Reason: snmpinfo.ReasonTimeout, Err: err}
+	}
+	if err := s.Errs[ip]; err != nil {
+		var se *snmpinfo.Error
+		if !errors.As(err, &se) {
+			err = &snmpinfo.Error{Reason: snmpinfo.ReasonOther, Err: err}
+		}
+		return snmpinfo.Info{}, err
+	}
+	info, ok := s.Hosts[ip]
+	if want, set := s.Communities[ip]; !ok || (set && want != community) {
+		return snmpinfo.Info{}, &snmpinfo.Error{Reason: snmpinfo.ReasonTimeout, Err: fmt.Errorf("request timeout (%s)", ip)}
+	}
+	info.Community = community
+	if info.Version == "" {
+		info.Version = "2c"
+	}
+	return info, nil
+}
+
+// Calls são as consultas feitas, como "ip/community", na ordem das chamadas.
+func (s *SNMP) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// Zabbix guarda os hosts cadastrados em memória. Hosts já cadastrados pelo
+// nome retornam zabbix.Existing; os nomes de Errs falham com o erro (use
+// *zabbix.HTTPError para uma falha passageira). Os hosts cadastrados sem
+// SNMP com FallbackTag são encontrados pelo IP e atualizados como no Zabbix.
+type Zabbix struct {
+	Errs map[string]error
+
+	mu       sync.Mutex
+	hosts    map[string]string // nome -> hostid
+	fallback map[string]string // IP -> nome dos cadastrados sem SNMP
+	specs    []zabbix.HostSpec
+}
+
+// Add cadastra um host existente antes do run.
+func (z *Zabbix) Add(name, hostID string) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.hosts == nil {
+		z.hosts = map[string]string{}
+	}
+	z.hosts[name] = hostID
+}
+
+func (z *Zabbix) Ensure(ctx context.Context, spec zabbix.HostSpec) (string, string, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.specs = append(z.specs, spec)
+	if err := ctx.Err(); err != nil {
+		return zabbix.Failed, "", err
+	}
+	if err := z.Errs[spec.Name]; err != nil {
+		return zabbix.Failed, "", err
+	}
+	snmp := spec.Interface == "" || spec.Interface == zabbix.InterfaceSNMP
+	old, tagged := z.fallback[spec.IP]
+	tagged = tagged && spec.FallbackTag != ""
+	if !snmp && tagged {
+		return zabbix.Existing, z.hosts[old], nil
+	}
+	if id, ok := z.hosts[spec.Name]; ok {
+		return zabbix.Existing, id, nil
+	}
+	if snmp && tagged {
+		id := z.hosts[old]
+		delete(z.hosts, old)
+		delete(z.fallback, spec.IP)
+		z.hosts[spec.Name] = id
+		return zabbix.Upgraded, id, nil
+	}
+	if z.hosts == nil {
+		z.hosts = map[string]string{}
+	}
+	id := strconv.Itoa(10000 + len(z.hosts))
+	z.hosts[spec.Name] = id
+	if !snmp && spec.FallbackTag != "" {
+		if z.fallback == nil {
+			z.fallback = map[string]string{}
+		}
+		z.fallback[spec.IP] = spec.Name
+	}
+	return zabbix.Created, id, nil
+}
+
+// Hosts são os hosts cadastrados, nome -> hostid.
+func (z *Zabbix) Hosts() map[string]string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	hosts := make(map[string]string, len(z.hosts))
+	for name, id := range z.hosts {
+		hosts[name] = id
+	}
+	return hosts
+}
+
+// Specs são as chamadas a Ensure, na ordem em que foram feitas.
+func (z *Zabbix) Specs() []zabbix.HostSpec {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return append([]zabbix.HostSpec(nil), z.specs...)
+}
+
+// Resolver responde às consultas reversas pelos nomes de Names (sem o ponto
+// final); os demais IPs não têm PTR.
+type Resolver struct {
+	Names map[string]string
+}
+
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	name, ok := r.Names[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return []string{name + "."}, nil
+}
@@ -0,0 +1,54 @@
+package discovery
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"discoveryhosts/logx"
+)
+
+// NameFallback cadastra no Zabbix os hosts que respondem ao ping mas não ao
+// SNMP, com o nome do registro PTR do IP (ou "unknown-<ip>", sem PTR) e uma
+// interface sem SNMP. Os hosts levam a tag Tag com o IP como valor: ela
+// separa os hosts para revisão e faz com que um run em que o SNMP responda
+// atualize o host em vez de criar outro.
+type NameFallback struct {
+	Interface string        // zabbix.InterfaceICMP ou zabbix.InterfaceAgent
+	Tag       string        // nome da tag no Zabbix
+	Timeout   time.Duration // da consulta reversa; zero limita só pelo HostTimeout
+	Resolver  Resolver      // nil usa net.DefaultResolver
+}
+
+// Prefixo do nome dos hosts sem registro PTR.
+const fallbackPrefix = "unknown-"
+
+// Nome do host sem SNMP, com a falha SNMP já definitiva (sem retentativas
+// pendentes). Retorna false se o host não deve ser cadastrado pelo fallback.
+// A consulta reversa conta no tempo do SNMP.
+func (d *discoverer) nameFallback(ctx context.Context, hl logx.Logger, r *HostResult) bool {
+	fb := d.cfg.Fallback
+	if fb == nil || !d.registersRange(r.Range) || ctx.Err() != nil || r.TimedOut || d.willRetry(*r) {
+		return false
+	}
+	hl = hl.With("stage", "dns")
+	if fb.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fb.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	names, err := fb.Resolver.LookupAddr(ctx, r.IP)
+	elapsed := time.Since(start)
+	r.SNMPTime += elapsed
+	hl = hl.WithDuration(elapsed)
+	if err == nil && len(names) > 0 {
+		r.FallbackName = strings.TrimSuffix(names[0], ".")
+	}
+	if r.FallbackName == "" {
+		hl.WithErr(err).Debugf("fallback.no_ptr", r.IP, err)
+		r.FallbackName = fallbackPrefix + r.IP
+	}
+	hl.Infof("fallback.named", r.IP, r.FallbackName)
+	return true
+}
@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+
+	"discoveryhosts/zabbix"
+)
+
+// Cadastro que sempre falha com err.
+type failingZabbix struct {
+	err error
+}
+
+func (z failingZabbix) Ensure(ctx context.Context, spec zabbix.HostSpec) (string, string, error) {
+	return zabbix.Failed, "", z.err
+}
+
+// Um erro fatal no início de um range grande (login do Zabbix recusado, ping
+// ausente) encerra o run logo, sem passar pelos demais IPs.
+func TestRunFatalStopsPromptly(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(cfg *Config)
+		cause error
+	}{
+		{
+			name: "login do Zabbix recusado",
+			setup: func(cfg *Config) {
+				cfg.Pinger = slowPinger{delay: 100 * time.Microsecond}
+				cfg.Zabbix = failingZabbix{err: fmt.Errorf("%w: senha incorreta", zabbix.ErrAuth)}
+			},
+			cause: zabbix.ErrAuth,
+		},
+		{
+			name: "ping ausente",
+			setup: func(cfg *Config) {
+				cfg.Pinger = slowPinger{delay: 100 * time.Microsecond, err: &exec.Error{Name: "ping", Err: exec.ErrNotFound}}
+			},
+			cause: exec.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+			cfg := testConfig("10.0.0.0/16")
+			cfg.SNMP = anySNMP{}
+			tt.setup(&cfg)
+			start := time.Now()
+			report, err := Run(context.Background(), cfg)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("run levou %s depois do erro fatal", elapsed)
+			}
+			if !errors.Is(err, ErrFatal) || !errors.Is(err, tt.cause) {
+				t.Fatalf("erro %v, esperava ErrFatal com %v", err, tt.cause)
+			}
+			s := report.Summary
+			if !s.Aborted {
+				t.Error("resumo sem Aborted")
+			}
+			if s.Scanned > s.TargetsExpanded/10 {
+				t.Errorf("%d de %d IPs verificados depois do erro fatal", s.Scanned, s.TargetsExpanded)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package discovery
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"discoveryhosts/discovery/discoverytest"
+)
+
+// Configuração de um run de teste com as etapas em memória: sem rede, sem
+// logs e com timeouts curtos.
+func testConfig(ranges ...string) Config {
+	return Config{
+		Ranges:      ranges,
+		PingTimeout: 100 * time.Millisecond,
+		SNMPTimeout: 100 * time.Millisecond,
+		Communities: []string{"public"},
+		Workers:     4,
+		Pinger:      &discoverytest.Pinger{},
+		SNMP:        &discoverytest.SNMP{},
+		Zabbix:      &discoverytest.Zabbix{},
+		GroupIDs:    []string{"1"},
+		RunID:       "test",
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// Executa o run e retorna, além do relatório, o resultado de todos os IPs
+// concluídos (os sem resposta ao ping não vão no Report), pelo OnResult.
+func runAll(t *testing.T, cfg Config) (Report, map[string]HostResult, error) {
+	t.Helper()
+	var all []HostResult
+	cfg.OnResult = func(r HostResult) { all = append(all, r) }
+	report, err := Run(context.Background(), cfg)
+	return report, resultsByIP(t, Report{Hosts: all}), err
+}
+
+// Resultado de cada IP do relatório, falhando o teste se algum se repetir.
+func resultsByIP(t *testing.T, report Report) map[string]HostResult {
+	t.Helper()
+	byIP := map[string]HostResult{}
+	for _, r := range report.Hosts {
+		if _, dup := byIP[r.IP]; dup {
+			t.Errorf("%s aparece mais de uma vez no relatório", r.IP)
+		}
+		byIP[r.IP] = r
+	}
+	return byIP
+}
@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"log/slog"
+
+	"discoveryhosts/logx"
+)
+
+// Eventos guardados de um host com Config.HostLogBlock, escritos juntos num
+// bloco quando ele termina.
+type hostLogs struct {
+	entries []hostLogEntry
+}
+
+// Evento guardado e o handler que o escreveria, com os campos já anexados.
+type hostLogEntry struct {
+	h slog.Handler
+	r slog.Record
+}
+
+// Handler dos loggers de host no modo em bloco: guarda os eventos do host em
+// vez de escrevê-los.
+type hostLogHandler struct {
+	next slog.Handler
+	d    *discoverer
+	ip   string
+}
+
+func (h *hostLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *hostLogHandler) Handle(_ context.Context, r slog.Record) error {
+	h.d.bufferLog(h.ip, hostLogEntry{h: h.next, r: r.Clone()})
+	return nil
+}
+
+func (h *hostLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &hostLogHandler{next: h.next.WithAttrs(attrs), d: h.d, ip: h.ip}
+}
+
+func (h *hostLogHandler) WithGroup(name string) slog.Handler {
+	return &hostLogHandler{next: h.next.WithGroup(name), d: h.d, ip: h.ip}
+}
+
+// Logger dos eventos de um host, com o IP e o range; no modo em bloco, os
+// eventos ficam guardados até flushHostLogs.
+func (d *discoverer) hostLog(ip, rng string) logx.Logger {
+	l := d.log
+	if d.cfg.HostLogBlock > 0 {
+		l = logx.New(slog.New(&hostLogHandler{next: d.log.Slog().Handler(), d: d, ip: ip}))
+	}
+	return l.With("ip", ip, "range", rng)
+}
+
+// Guarda o evento do host. Com HostLogBlock eventos guardados, o bloco é
+// escrito antes da hora: a memória de um host em andamento fica limitada.
+func (d *discoverer) bufferLog(ip string, e hostLogEntry) {
+	d.hostLogMu.Lock()
+	if d.hostLogs == nil {
+		d.hostLogs = map[string]*hostLogs{}
+	}
+	hl, ok := d.hostLogs[ip]
+	if !ok {
+		hl = &hostLogs{}
+		d.hostLogs[ip] = hl
+	}
+	hl.entries = append(hl.entries, e)
+	var full []hostLogEntry
+	if len(hl.entries) >= d.cfg.HostLogBlock {
+		full, hl.entries = hl.entries, nil
+	}
+	d.hostLogMu.Unlock()
+	d.writeHostLogs(full)
+}
+
+// Escreve o bloco de eventos guardados do host.
+func (d *discoverer) flushHostLogs(ip string) {
+	if d.cfg.HostLogBlock <= 0 {
+		return
+	}
+	d.hostLogMu.Lock()
+	hl := d.hostLogs[ip]
+	delete(d.hostLogs, ip)
+	d.hostLogMu.Unlock()
+	if hl != nil {
+		d.writeHostLogs(hl.entries)
+	}
+}
+
+// Escreve os blocos de todos os hosts que ainda têm eventos guardados, como os
+// descartados por um cancelamento; chamado ao fim do run.
+func (d *discoverer) flushAllHostLogs() {
+	d.hostLogMu.Lock()
+	pending := d.hostLogs
+	d.hostLogs = nil
+	d.hostLogMu.Unlock()
+	for _, hl := range pending {
+		d.writeHostLogs(hl.entries)
+	}
+}
+
+// Os blocos saem um de cada vez, para que dois hosts não se intercalem.
+func (d *discoverer) writeHostLogs(entries []hostLogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	d.hostWriteMu.Lock()
+	defer d.hostWriteMu.Unlock()
+	for _, e := range entries {
+		e.h.Handle(context.Background(), e.r)
+	}
+}
@@ -0,0 +1,97 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"discoveryhosts/discovery/discoverytest"
+	"discoveryhosts/snmpinfo"
+	"discoveryhosts/zabbix"
+)
+
+// SNMP que demora delay nos IPs de slow, para ordenar a chegada dos hosts ao
+// cadastro.
+type slowSNMP struct {
+	SNMPQuerier
+	slow  map[string]bool
+	delay time.Duration
+}
+
+func (s slowSNMP) SysInfo(ctx context.Context, ip, community string) (snmpinfo.Info, error) {
+	if s.slow[ip] {
+		time.Sleep(s.delay)
+	}
+	return s.SNMPQuerier.SysInfo(ctx, ip, community)
+}
+
+// Cadastro que demora delay nos nomes de slow, mantendo a vaga reservada
+// enquanto isso.
+type slowZabbix struct {
+	HostCreator
+	slow  map[string]bool
+	delay time.Duration
+}
+
+func (z slowZabbix) Ensure(ctx context.Context, spec zabbix.HostSpec) (string, string, error) {
+	if z.slow[spec.Name] {
+		time.Sleep(z.delay)
+	}
+	return z.HostCreator.Ensure(ctx, spec)
+}
+
+// Com CreateLimit 1, um host já existente ainda em cadastro não pode tirar a
+// vaga de um host novo que chega enquanto isso.
+func TestCreateLimitPendingExisting(t *testing.T) {
+	z := &discoverytest.Zabbix{}
+	z.Add("existing", "10001")
+	cfg := testConfig("10.0.0.1-2")
+	cfg.CreateLimit = 1
+	cfg.Pinger = &discoverytest.Pinger{Alive: map[string]bool{"10.0.0.1": true, "10.0.0.2": true}}
+	cfg.SNMP = slowSNMP{
+		SNMPQuerier: &discoverytest.SNMP{Hosts: map[string]snmpinfo.Info{
+			"10.0.0.1": {SysName: "existing"},
+			"10.0.0.2": {SysName: "new"},
+		}},
+		slow:  map[string]bool{"10.0.0.2": true},
+		delay: 20 * time.Millisecond,
+	}
+	cfg.Zabbix = slowZabbix{HostCreator: z, slow: map[string]bool{"existing": true}, delay: 100 * time.Millisecond}
+
+	report, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := resultsByIP(t, report)
+	if got := hosts["10.0.0.1"].ZabbixAction; got != zabbix.Existing {
+		t.Errorf("10.0.0.1: ação %q, esperava %q", got, zabbix.Existing)
+	}
+	if got := hosts["10.0.0.2"].ZabbixAction; got != zabbix.Created {
+		t.Errorf("10.0.0.2: ação %q, esperava %q", got, zabbix.Created)
+	}
+	if report.Summary.HostsCreated != 1 || report.Summary.HostsLimited != 0 {
+		t.Errorf("resumo: %d criados e %d limitados, esperava 1 e 0", report.Summary.HostsCreated, report.Summary.HostsLimited)
+	}
+}
+
+// Com o limite atingido pelos hosts criados, os seguintes saem limitados,
+// mesmo com cadastros simultâneos.
+func TestCreateLimitReached(t *testing.T) {
+	cfg := testConfig("10.0.0.1-20")
+	cfg.CreateLimit = 3
+	pinger := &discoverytest.Pinger{Alive: map[string]bool{}}
+	snmp := &discoverytest.SNMP{Hosts: map[string]snmpinfo.Info{}}
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7", "10.0.0.8"} {
+		pinger.Alive[ip] = true
+		snmp.Hosts[ip] = snmpinfo.Info{SysName: "host-" + ip}
+	}
+	cfg.Pinger, cfg.SNMP = pinger, snmp
+
+	report, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Summary.HostsCreated != 3 || report.Summary.HostsLimited != 5 {
+		t.Errorf("resumo: %d criados e %d limitados, esperava 3 e 5", report.Summary.HostsCreated, report.Summary.HostsLimited)
+	}
+}
@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"discoveryhosts/discovery/discoverytest"
+	"discoveryhosts/snmpinfo"
+	"discoveryhosts/zabbix"
+)
+
+// Um IP pelas etapas com as implementações em memória, do ping ao cadastro.
+func TestPipeline(t *testing.T) {
+	errPing := errors.New("ping: socket: Operation not permitted")
+	tests := []struct {
+		name     string
+		pinger   *discoverytest.Pinger
+		snmp     *discoverytest.SNMP
+		existing map[string]string // já cadastrados, nome -> hostid
+		want     map[string]HostResult
+		check    func(t *testing.T, s Summary)
+	}{
+		{
+			name:   "ping falha",
+			pinger: &discoverytest.Pinger{Errs: map[string]error{"10.0.0.1": errPing}},
+			snmp:   &discoverytest.SNMP{},
+			want: map[string]HostResult{
+				"10.0.0.1": {PingErr: errPing},
+			},
+			check: func(t *testing.T, s Summary) {
+				if s.Alive != 0 || s.PingFailures() != 1 {
+					t.Errorf("resumo: %d responderam e %d falhas de ping, esperava 0 e 1", s.Alive, s.PingFailures())
+				}
+			},
+		},
+		{
+			name:   "sem resposta ao ping",
+			pinger: &discoverytest.Pinger{},
+			snmp:   &discoverytest.SNMP{},
+			want: map[string]HostResult{
+				"10.0.0.1": {},
+			},
+			check: func(t *testing.T, s Summary) {
+				if s.Alive != 0 || s.PingFailures() != 0 {
+					t.Errorf("resumo: %d responderam e %d falhas de ping, esperava 0 e 0", s.Alive, s.PingFailures())
+				}
+			},
+		},
+		{
+			name:   "SNMP falha depois do ping",
+			pinger: &discoverytest.Pinger{Alive: map[string]bool{"10.0.0.1": true}},
+			snmp: &discoverytest.SNMP{Errs: map[string]error{
+				"10.0.0.1": &snmpinfo.Error{Reason: snmpinfo.ReasonRefused, Err: errors.New("connection refused")},
+			}},
+			want: map[string]HostResult{
+				"10.0.0.1": {Alive: true, SNMPReason: snmpinfo.ReasonRefused},
+			},
+			check: func(t *testing.T, s Summary) {
+				if s.SNMPFailed[snmpinfo.ReasonRefused] != 1 || s.HostsCreated != 0 {
+					t.Errorf("resumo: %v falhas SNMP e %d criados, esperava refused: 1 e 0", s.SNMPFailed, s.HostsCreated)
+				}
+			},
+		},
+		{
+			name:   "host criado",
+			pinger: &discoverytest.Pinger{Alive: map[string]bool{"10.0.0.1": true}},
+			snmp:   &discoverytest.SNMP{Hosts: map[string]snmpinfo.Info{"10.0.0.1": {SysName: "sw-01"}}},
+			want: map[string]HostResult{
+				"10.0.0.1": {Alive: true, ZabbixAction: zabbix.Created},
+			},
+			check: func(t *testing.T, s Summary) {
+				if s.HostsCreated != 1 {
+					t.Errorf("resumo: %d criados, esperava 1", s.HostsCreated)
+				}
+			},
+		},
+		{
+			name:     "host já cadastrado no Zabbix",
+			pinger:   &discoverytest.Pinger{Alive: map[string]bool{"10.0.0.1": true}},
+			snmp:     &discoverytest.SNMP{Hosts: map[string]snmpinfo.Info{"10.0.0.1": {SysName: "sw-01"}}},
+			existing: map[string]string{"sw-01": "10500"},
+			want: map[string]HostResult{
+				"10.0.0.1": {Alive: true, ZabbixAction: zabbix.Existing, HostID: "10500"},
+			},
+			check: func(t *testing.T, s Summary) {
+				if s.HostsCreated != 0 || s.HostsExisting != 1 {
+					t.Errorf("resumo: %d criados e %d existentes, esperava 0 e 1", s.HostsCreated, s.HostsExisting)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := &discoverytest.Zabbix{}
+			for name, id := range tt.existing {
+				z.Add(name, id)
+			}
+			cfg := testConfig("10.0.0.1")
+			cfg.Pinger, cfg.SNMP, cfg.Zabbix = tt.pinger, tt.snmp, z
+			report, hosts, err := runAll(t, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ip, want := range tt.want {
+				got, ok := hosts[ip]
+				if !ok {
+					t.Errorf("%s fora do relatório", ip)
+					continue
+				}
+				if got.Alive != want.Alive {
+					t.Errorf("%s: Alive %t, esperava %t", ip, got.Alive, want.Alive)
+				}
+				if !errors.Is(got.PingErr, want.PingErr) {
+					t.Errorf("%s: PingErr %v, esperava %v", ip, got.PingErr, want.PingErr)
+				}
+				if got.SNMPReason != want.SNMPReason {
+					t.Errorf("%s: SNMPReason %q, esperava %q", ip, got.SNMPReason, want.SNMPReason)
+				}
+				if got.ZabbixAction != want.ZabbixAction {
+					t.Errorf("%s: ZabbixAction %q, esperava %q", ip, got.ZabbixAction, want.ZabbixAction)
+				}
+				if want.HostID != "" && got.HostID != want.HostID {
+					t.Errorf("%s: HostID %q, esperava %q", ip, got.HostID, want.HostID)
+				}
+			}
+			tt.check(t, report.Summary)
+		})
+	}
+}
+
+// Dois IPs com o mesmo sysName: o segundo encontra o host já criado pelo
+// primeiro, que é cadastrado uma vez só.
+func TestPipelineDuplicateSysName(t *testing.T) {
+	z := &discoverytest.Zabbix{}
+	cfg := testConfig("10.0.0.1-2")
+	cfg.Pinger = &discoverytest.Pinger{Alive: map[string]bool{"10.0.0.1": true, "10.0.0.2": true}}
+	cfg.SNMP = &discoverytest.SNMP{Hosts: map[string]snmpinfo.Info{
+		"10.0.0.1": {SysName: "core"},
+		"10.0.0.2": {SysName: "core"},
+	}}
+	cfg.Zabbix = z
+	report, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := report.Summary; s.HostsCreated != 1 || s.HostsExisting != 1 {
+		t.Errorf("resumo: %d criados e %d existentes, esperava 1 e 1", s.HostsCreated, s.HostsExisting)
+	}
+	if hosts := z.Hosts(); len(hosts) != 1 {
+		t.Errorf("%d hosts no Zabbix, esperava 1: %v", len(hosts), hosts)
+	}
+}
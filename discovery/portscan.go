@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"discoveryhosts/logx"
+)
+
+// PortScan configura a varredura TCP (connect) opcional dos hosts que
+// responderam ao ping, só nos ranges de Ranges. As portas abertas entram no
+// resultado (OpenPorts) e nas tags service:<nome> dos hosts criados. Os
+// limites valem para o run inteiro, somando todos os hosts.
+type PortScan struct {
+	Ranges      map[string]bool // chave igual à de Config.Ranges
+	Ports       []int
+	Timeout     time.Duration // de cada conexão
+	Concurrency int           // conexões simultâneas
+	Rate        int           // conexões novas por segundo; zero sem limite
+	Prober      PortProber    // nil usa uma conexão TCP com Timeout
+}
+
+// Nomes das portas mais comuns, usados nas tags service:<nome>.
+var serviceNames = map[int]string{
+	21:   "ftp",
+	22:   "ssh",
+	23:   "telnet",
+	25:   "smtp",
+	53:   "dns",
+	80:   "http",
+	443:  "https",
+	445:  "smb",
+	554:  "rtsp",
+	623:  "ipmi",
+	3389: "rdp",
+	5900: "vnc",
+	8080: "http-alt",
+	8443: "https-alt",
+	9100: "jetdirect",
+}
+
+// ServiceName é o nome do serviço de uma porta TCP, ou "tcp-<porta>" se ela
+// não for conhecida.
+func ServiceName(port int) string {
+	if name, ok := serviceNames[port]; ok {
+		return name
+	}
+	return "tcp-" + strconv.Itoa(port)
+}
+
+// Espaça as conexões novas para no máximo uma a cada interval, somando
+// todos os workers.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(rate int) *pacer {
+	if rate <= 0 {
+		return nil
+	}
+	return &pacer{interval: time.Second / time.Duration(rate)}
+}
+
+// Espera a vez da próxima conexão; nil não limita.
+func (p *pacer) wait(ctx context.Context) error {
+	if p == nil {
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Varre as portas do host, se o range estiver na PortScan. Conexões
+// recusadas, sem resposta ou interrompidas contam como porta fechada.
+func (d *discoverer) scanPorts(ctx context.Context, hl logx.Logger, r *HostResult) {
+	ps := d.cfg.PortScan
+	if ps == nil || !ps.Ranges[r.Range] {
+		return
+	}
+	hl = hl.With("stage", StagePortScan)
+	start := time.Now()
+	open := make([]bool, len(ps.Ports))
+	var wg sync.WaitGroup
+	for i, port := range ps.Ports {
+		if d.scanPace.wait(ctx) != nil {
+			break
+		}
+		d.scanSlots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-d.scanSlots }()
+			open[i] = ps.Prober.Open(ctx, r.IP, port)
+		}()
+	}
+	wg.Wait()
+	r.OpenPorts = nil
+	var services []string
+	for i, ok := range open {
+		if ok {
+			r.OpenPorts = append(r.OpenPorts, ps.Ports[i])
+			services = append(services, strconv.Itoa(ps.Ports[i])+"/"+ServiceName(ps.Ports[i]))
+		}
+	}
+	r.PortScanned = true
+	r.ScanTime = time.Since(start)
+	hl.WithDuration(r.ScanTime).Debugf("portscan.done", r.IP, len(ps.Ports), strings.Join(services, ", "))
+}
@@ -0,0 +1,162 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"discoveryhosts/iprange"
+)
+
+// Scanner faz o ping e o SNMP de um grupo de ranges fora deste processo, em um
+// agente mais próximo da rede. Scan entrega cada IP concluído a emit (de um
+// goroutine por vez) e retorna quando o agente terminar; um erro indica que o
+// agente falhou e os IPs que ele não entregou ficam sem verificação.
+type Scanner interface {
+	Scan(ctx context.Context, ranges []string, emit func(HostResult)) error
+}
+
+// Remote atribui ranges do run a um Scanner. Os hosts que o agente
+// identificar são cadastrados no Zabbix por este run, como os locais.
+type Remote struct {
+	Name    string   // nome do agente nos logs e no resumo
+	Ranges  []string // chaves iguais às de Config.Ranges
+	Scanner Scanner
+}
+
+// AgentSummary reúne o trabalho de um agente remoto no run.
+type AgentSummary struct {
+	Name    string
+	Ranges  []string
+	Targets int    // IPs atribuídos, sem os que vieram de um run anterior
+	Scanned int    // IPs entregues pelo agente
+	Error   string // falha do agente; vazio se ele concluiu
+}
+
+// NotScanned é o número de IPs atribuídos que o agente não entregou.
+func (a AgentSummary) NotScanned() int {
+	return a.Targets - a.Scanned
+}
+
+// Confere os grupos remotos e separa os alvos locais dos de cada agente.
+func splitRemote(targets []rangeTargets, remotes []Remote) ([]rangeTargets, [][]rangeTargets, error) {
+	byRange := make(map[string]int, len(targets))
+	for i, t := range targets {
+		byRange[t.rng] = i
+	}
+	owner := map[string]string{}
+	groups := make([][]rangeTargets, len(remotes))
+	for i, g := range remotes {
+		if g.Scanner == nil {
+			return nil, nil, fmt.Errorf("agente %s sem Scanner", g.Name)
+		}
+		for _, rng := range g.Ranges {
+			rng = strings.TrimSpace(rng)
+			ti, ok := byRange[rng]
+			if !ok {
+				return nil, nil, fmt.Errorf("range %s atribuído ao agente %s não está nos ranges do run", rng, g.Name)
+			}
+			if prev, ok := owner[rng]; ok {
+				return nil, nil, fmt.Errorf("range %s atribuído aos agentes %s e %s", rng, prev, g.Name)
+			}
+			owner[rng] = g.Name
+			groups[i] = append(groups[i], targets[ti])
+		}
+	}
+	var local []rangeTargets
+	for _, t := range targets {
+		if _, ok := owner[t.rng]; !ok {
+			local = append(local, t)
+		}
+	}
+	return local, groups, nil
+}
+
+// Envia cada grupo ao seu agente em paralelo. Os hosts com SNMP ok seguem para
+// toZabbix, fechado quando todos os agentes terminarem; os demais vão direto
+// ao coletor. Retorna os contadores de cada agente, completos depois que
+// toZabbix for fechado.
+func (d *discoverer) runRemote(ctx, feedCtx context.Context, groups [][]rangeTargets, toZabbix chan<- HostResult, results chan<- HostResult) []AgentSummary {
+	done := d.previous()
+	agents := make([]AgentSummary, len(groups))
+	var wg sync.WaitGroup
+	for i, targets := range groups {
+		g := d.cfg.Remote[i]
+		as := &agents[i]
+		as.Name = g.Name
+		inGroup, seen := map[string]bool{}, map[string]bool{}
+		for _, t := range targets {
+			as.Ranges = append(as.Ranges, t.rng)
+			inGroup[t.rng] = true
+			as.Targets += t.count
+			for ip := range done {
+				if n, ok := iprange.Uint32(ip); ok && t.addrs.Contains(n) {
+					as.Targets--
+				}
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			al := d.log.With("agent", g.Name)
+			al.Infof("agent.dispatch", len(as.Ranges), g.Name, as.Targets)
+			emit := func(r HostResult) {
+				if !inGroup[r.Range] || done[r.IP] || seen[r.IP] {
+					al.Warnf("agent.unexpected_host", g.Name, r.IP, r.Range)
+					return
+				}
+				seen[r.IP] = true
+				as.Scanned++
+				r.Agent = g.Name
+				if r.Attempts == 0 {
+					r.Attempts = 1
+				}
+				// O agente não cadastra nada; o cadastro é deste run
+				r.ZabbixAction = ""
+				hl := d.hostLog(r.IP, r.Range).With("agent", g.Name)
+				switch {
+				case r.Alive && r.Err() == nil && d.known(hl, &r):
+				case r.Alive && r.Err() == nil:
+					if d.registersRange(r.Range) {
+						toZabbix <- r
+						return
+					}
+					r.ZabbixAction = d.unregistered(al, r)
+				case r.Alive && r.SNMPErr != nil && d.nameFallback(feedCtx, d.hostLog(r.IP, r.Range), &r) && !d.known(hl, &r):
+					toZabbix <- r
+					return
+				}
+				d.finish(ctx, r, results)
+			}
+			err := g.Scanner.Scan(feedCtx, as.Ranges, emit)
+			switch {
+			case err == nil && as.NotScanned() > 0 && feedCtx.Err() == nil:
+				err = fmt.Errorf("o agente concluiu sem entregar %d IP(s)", as.NotScanned())
+			case err != nil && feedCtx.Err() != nil:
+				// Cancelamento ou max_run_duration, não uma falha do agente
+				err = nil
+			}
+			if err != nil {
+				as.Error = err.Error()
+				al.WithErr(err).Errorf("agent.failed", g.Name, err, as.NotScanned())
+				return
+			}
+			al.Infof("agent.done", g.Name, as.Scanned, as.Targets)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(toZabbix)
+	}()
+	return agents
+}
+
+// IPs que vieram de um run anterior e não são processados de novo.
+func (d *discoverer) previous() map[string]bool {
+	done := make(map[string]bool, len(d.cfg.Previous))
+	for _, r := range d.cfg.Previous {
+		done[r.IP] = true
+	}
+	return done
+}
@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+// Conjunto dos IPs já vistos num run, seguro para vários goroutines. Os IPv4
+// ficam num bitmap por bloco /16 (8 KiB cada), criado no primeiro IP do
+// bloco: um range de milhões de IPs ocupa poucos MiB, sem uma entrada de mapa
+// por IP. Os demais endereços vão num mapa.
+type seenSet struct {
+	mu     sync.Mutex
+	blocks map[uint16]*[1 << 13]byte
+	other  map[string]struct{}
+}
+
+// Marca o IP como visto; false se ele já estava no conjunto.
+func (s *seenSet) add(ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v4 := net.ParseIP(ip).To4()
+	if v4 == nil {
+		if s.other == nil {
+			s.other = map[string]struct{}{}
+		}
+		if _, ok := s.other[ip]; ok {
+			return false
+		}
+		s.other[ip] = struct{}{}
+		return true
+	}
+	return s.addLocked(binary.BigEndian.Uint32(v4))
+}
+
+// Como add, para um IPv4 já convertido por iprange.
+func (s *seenSet) addV4(n uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addLocked(n)
+}
+
+func (s *seenSet) addLocked(n uint32) bool {
+	if s.blocks == nil {
+		s.blocks = map[uint16]*[1 << 13]byte{}
+	}
+	b := s.blocks[uint16(n>>16)]
+	if b == nil {
+		b = new([1 << 13]byte)
+		s.blocks[uint16(n>>16)] = b
+	}
+	i, bit := (n&0xffff)>>3, byte(1)<<(n&7)
+	if b[i]&bit != 0 {
+		return false
+	}
+	b[i] |= bit
+	return true
+}
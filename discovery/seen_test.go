@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"discoveryhosts/discovery/discoverytest"
+	"discoveryhosts/snmpinfo"
+)
+
+// Vários produtores marcam os mesmos IPs ao mesmo tempo: cada IP é aceito uma
+// vez só.
+func TestSeenSetConcurrent(t *testing.T) {
+	var ips []string
+	for i := 0; i < 2048; i++ {
+		ips = append(ips, fmt.Sprintf("10.%d.%d.%d", i>>10, (i>>8)&3, i&0xff))
+	}
+	ips = append(ips, "2001:db8::1", "2001:db8::2")
+
+	var s seenSet
+	accepted := make([]atomic.Int32, len(ips))
+	var wg sync.WaitGroup
+	for p := 0; p < 8; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, ip := range ips {
+				if s.add(ip) {
+					accepted[i].Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for i, ip := range ips {
+		if n := accepted[i].Load(); n != 1 {
+			t.Errorf("%s aceito %d vezes", ip, n)
+		}
+	}
+	// Um bitmap por /16 e o mapa só para os IPv6
+	if len(s.blocks) != 2 || len(s.other) != 2 {
+		t.Errorf("esperava 2 blocos e 2 outros endereços, obteve %d e %d", len(s.blocks), len(s.other))
+	}
+}
+
+// O mesmo IP em ranges sobrepostos, varridos em paralelo, passa uma vez só
+// pelo ping e pelo cadastro.
+func TestRunOverlappingRanges(t *testing.T) {
+	ranges := []string{"10.0.0.0/24", "10.0.0.0/25", "10.0.0.100-200", "10.0.0.7", "10.0.0.0/24"}
+	cfg := testConfig(ranges...)
+	cfg.Workers = 16
+	cfg.Interleave = true
+	cfg.RangeWorkers = map[string]int{"10.0.0.0/25": 4, "10.0.0.100-200": 4}
+	alive := map[string]bool{}
+	for i := 0; i < 256; i++ {
+		alive[fmt.Sprintf("10.0.0.%d", i)] = true
+	}
+	pinger := &discoverytest.Pinger{Alive: alive}
+	cfg.Pinger = pinger
+	zbx := &discoverytest.Zabbix{}
+	cfg.Zabbix = zbx
+	cfg.SNMP = &discoverytest.SNMP{Hosts: map[string]snmpinfo.Info{"10.0.0.7": {SysName: "sw7"}, "10.0.0.150": {SysName: "sw150"}}}
+
+	report, byIP, err := runAll(t, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := map[string]int{}
+	for _, ip := range pinger.Calls() {
+		calls[ip]++
+	}
+	for ip, n := range calls {
+		if n != 1 {
+			t.Errorf("%s: %d pings", ip, n)
+		}
+	}
+	// Sem os endereços de rede e de broadcast, o /24 tem 254 IPs e o /25, 126
+	if len(calls) != 254 || len(byIP) != 254 {
+		t.Errorf("esperava 254 IPs verificados, obteve %d pings e %d resultados", len(calls), len(byIP))
+	}
+	if want := 126 + 101 + 1 + 254; report.Summary.TargetsDuplicate != want {
+		t.Errorf("esperava %d alvos duplicados, obteve %d", want, report.Summary.TargetsDuplicate)
+	}
+	if specs := zbx.Specs(); len(specs) != 2 {
+		t.Errorf("esperava 2 cadastros, obteve %d", len(specs))
+	}
+}
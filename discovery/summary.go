@@ -0,0 +1,613 @@
+package discovery
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"discoveryhosts/probe"
+	"discoveryhosts/snmpinfo"
+	"discoveryhosts/zabbix"
+)
+
+// ZabbixDryRun é a ação dos hosts não cadastrados por causa do DryRun.
+const ZabbixDryRun = "dry-run"
+
+// ZabbixSkipped é a ação dos hosts identificados num run com SkipZabbix ou
+// de um range de SkipZabbixRanges.
+const ZabbixSkipped = "skipped"
+
+// ZabbixKnown é a ação dos hosts identificados que Config.Known reconhece
+// como já conhecidos (gerenciados por outro sistema): não são cadastrados e
+// HostResult.Known diz qual entrada casou.
+const ZabbixKnown = "known"
+
+// ZabbixFiltered é a ação dos hosts identificados que Config.Filter
+// descartou: não são cadastrados.
+const ZabbixFiltered = "filtered"
+
+// ZabbixLimited é a ação dos hosts que chegaram ao cadastro depois de
+// Config.CreateLimit hosts criados no run: não são cadastrados.
+const ZabbixLimited = "limited"
+
+// ZabbixCached é a ação dos hosts de Config.Cache que responderam ao ping:
+// o SNMP e o cadastro foram pulados e os dados vêm do cache.
+const ZabbixCached = "cached"
+
+// HostResult é o resultado do processamento de um IP.
+type HostResult struct {
+	IP           string
+	Range        string
+	Alive        bool
+	PingErr      error  // o ping não pôde ser executado (não é o caso de um host que não respondeu)
+	PingReason   string // motivo probe.Reason* quando PingErr != nil
+	SNMP         snmpinfo.Info
+	SNMPErr      error
+	SNMPReason   string // motivo snmpinfo.Reason* quando SNMPErr != nil
+	ZabbixAction string // zabbix.Created, zabbix.Existing, zabbix.Upgraded, zabbix.Failed, ZabbixPartial, ZabbixDryRun, ZabbixSkipped, ZabbixKnown, ZabbixFiltered, ZabbixLimited ou ZabbixCached
+	HostID       string
+	ZabbixErr    error
+	TimedOut     bool   // uma etapa foi interrompida pelo HostTimeout
+	Attempts     int    // tentativas feitas, contando a primeira
+	Agent        string // agente remoto que fez o ping e o SNMP; vazio se foi este processo
+	FallbackName string // nome DNS do cadastro de um host sem SNMP (Config.Fallback)
+	Known        string // entrada de Config.Known que casou com o host, com ZabbixKnown
+	Trigger      string // Config.Trigger do run
+	Recovered    bool   // falhou no run de Config.RetryOf e agora passou sem erro
+	PortScanned  bool   // passou pela varredura de Config.PortScan
+	OpenPorts    []int  // portas TCP abertas na varredura, na ordem de PortScan.Ports
+	// Cadastro em cada backend do range (de Config.Backends ou
+	// Config.Targets), na mesma ordem; vazio com um servidor só
+	Targets []TargetResult
+
+	PingTime   time.Duration
+	ScanTime   time.Duration
+	SNMPTime   time.Duration
+	ZabbixTime time.Duration
+}
+
+// Prepara o host para repetir o SNMP, descartando a tentativa anterior.
+func (r HostResult) resetSNMP() HostResult {
+	r.Attempts++
+	r.SNMPErr, r.SNMPReason, r.SNMPTime, r.TimedOut, r.FallbackName = nil, "", 0, false, ""
+	return r
+}
+
+// Prepara o host para repetir o cadastro no Zabbix.
+func (r HostResult) resetZabbix() HostResult {
+	r.Attempts++
+	r.ZabbixAction, r.HostID, r.ZabbixErr, r.ZabbixTime, r.TimedOut = "", "", nil, 0, false
+	return r
+}
+
+// Name é o nome do host no Zabbix: o sysName, ou o FallbackName de um host
+// cadastrado sem SNMP.
+func (r HostResult) Name() string {
+	if r.FallbackName != "" {
+		return r.FallbackName
+	}
+	return r.SNMP.SysName
+}
+
+// Duration é a duração total do processamento do IP.
+func (r HostResult) Duration() time.Duration {
+	return r.PingTime + r.ScanTime + r.SNMPTime + r.ZabbixTime
+}
+
+// Err é o primeiro erro que interrompeu o processamento do IP, se houver.
+func (r HostResult) Err() error {
+	if r.PingErr != nil {
+		return r.PingErr
+	}
+	if r.SNMPErr != nil {
+		return r.SNMPErr
+	}
+	return r.ZabbixErr
+}
+
+// Summary reúne os contadores de um run. É montado por um único coletor a
+// partir dos resultados dos workers e retornado por Run.
+type Summary struct {
+	RunID       string
+	Start       time.Time
+	End         time.Time
+	Interrupted bool // cancelado antes de verificar todos os alvos
+	// MaxDuration atingido com alvos ainda não iniciados
+	DeadlineReached bool
+	// Abortado por panics demais (ErrTooManyPanics) ou por um erro fatal
+	// (ErrFatal); AbortCause é o motivo
+	Aborted    bool
+	AbortCause string
+	// Origem do run (Config.Trigger) e se ele varreu só os IPs de
+	// Config.Only: um run dirigido não diz nada sobre os demais hosts
+	Trigger  string
+	Targeted bool
+	// Config.CreateLimit do run, zero sem limite
+	CreateLimit int
+	// Config.RetryOf do run e os hosts dele recuperados
+	RetryOf        string
+	HostsRecovered int
+	// Segundas ocorrências de um IP (ranges sobrepostos), não processadas e
+	// fora de TargetsExpanded
+	TargetsDuplicate int
+
+	TargetsExpanded int
+	TargetsExcluded int
+	TargetsSelf     int // endereços do próprio scanner (Config.Self), fora do scan
+	TargetsInvalid  int // alvos que não são um endereço IP, descartados antes do ping
+	Scanned         int
+	Alive           int
+	SNMPOK          int
+	PingFailed      map[string]int // pings que não testaram o host, por motivo
+	SNMPFailed      map[string]int // por motivo
+	HostsCreated    int
+	HostsExisting   int
+	ZabbixErrors    int
+	HostsDryRun     int         // não cadastrados por causa do DryRun
+	HostsCached     int         // que responderam e vieram do cache, sem SNMP nem cadastro
+	HostsSkipped    int         // identificados mas não cadastrados por causa do SkipZabbix
+	HostsKnown      int         // identificados mas não cadastrados por estarem em Config.Known
+	HostsFiltered   int         // identificados mas descartados por Config.Filter
+	HostsLimited    int         // não cadastrados por já haver Config.CreateLimit hosts criados
+	HostsFallback   int         // sem SNMP, cadastrados (ou já existentes) pelo nome DNS
+	HostsUpgraded   int         // cadastrados antes sem SNMP, atualizados com o SNMP
+	HostsPartial    int         // cadastrados em só parte dos servidores de Config.Targets
+	HostsTimedOut   int         // interrompidos pelo HostTimeout
+	HostsRetried    int         // com mais de uma tentativa
+	Panics          int         // panics recuperados nas etapas
+	RetriesOK       int         // que tiveram sucesso numa retentativa
+	PortScanned     int         // que passaram pela varredura de portas
+	OpenPorts       map[int]int // hosts com cada porta aberta
+
+	// Tempo gasto em cada etapa, somado entre os workers
+	PingTime   time.Duration
+	SNMPTime   time.Duration
+	ZabbixTime time.Duration
+
+	// Hosts que mais demoraram em cada etapa, do mais lento ao mais rápido
+	SlowestPing   []HostTiming
+	SlowestSNMP   []HostTiming
+	SlowestZabbix []HostTiming
+
+	// Contadores de cada etapa do pipeline, na ordem em que o host as
+	// percorre. Só contam os IPs processados neste run.
+	Stages []StageSummary
+
+	// Workers ativos ao longo do run no modo adaptativo, em ordem de tempo
+	Concurrency []ConcurrencyChange
+
+	// Backends do cadastro, na ordem de Config.Backends ou Config.Targets
+	Targets []TargetSummary
+
+	// Agentes remotos do run, na ordem de Config.Remote
+	Agents []AgentSummary
+
+	// Contadores por range, na ordem da configuração
+	Ranges         []RangeSummary
+	rangeIndex     map[string]int
+	rangesFinished int
+}
+
+// RangeSummary reúne os contadores de um range do run.
+type RangeSummary struct {
+	Range         string
+	Targets       int
+	Scanned       int
+	Alive         int
+	SNMPOK        int
+	SNMPFailed    int
+	HostsCreated  int
+	HostsExisting int
+	ZabbixErrors  int
+
+	// Tempo desde o início do run até o último IP do range ser concluído e a
+	// posição do range na ordem de conclusão (1 para o primeiro); zero se o
+	// range não terminou.
+	Duration time.Duration
+	Order    int
+}
+
+// Etapas do pipeline de cada IP.
+const (
+	StagePing   = "ping"
+	StageSNMP   = "snmp"
+	StageZabbix = "zabbix"
+
+	// Varredura de portas, dentro da etapa de ping (sem workers próprios)
+	StagePortScan = "portscan"
+)
+
+// StageSummary reúne os contadores de uma etapa do pipeline.
+type StageSummary struct {
+	Stage     string
+	Workers   int
+	Processed int           // hosts que passaram pela etapa
+	Errors    int           // hosts em que a etapa falhou
+	Busy      time.Duration // tempo gasto na etapa, somado entre os workers
+
+	// Fila de entrada da etapa, só no cadastro no Zabbix
+	QueueSize int // capacidade
+	Queued    int // hosts aguardando no momento do snapshot
+	QueuePeak int // maior fila do run
+}
+
+// Throughput é a taxa de hosts processados por segundo no tempo total do run.
+func (st StageSummary) Throughput(elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(st.Processed) / elapsed.Seconds()
+}
+
+// Utilization é a fração do tempo em que os workers da etapa estiveram
+// ocupados; perto de 1 indica que a etapa é o gargalo do run.
+func (st StageSummary) Utilization(elapsed time.Duration) float64 {
+	if elapsed <= 0 || st.Workers == 0 {
+		return 0
+	}
+	return float64(st.Busy) / (float64(elapsed) * float64(st.Workers))
+}
+
+// Quantidade de hosts mais lentos guardados por etapa.
+const slowestHosts = 10
+
+// HostTiming é o tempo de um host numa etapa.
+type HostTiming struct {
+	IP       string
+	Duration time.Duration
+}
+
+func newSummary(runID string) *Summary {
+	return &Summary{RunID: runID, Start: time.Now(), PingFailed: map[string]int{}, SNMPFailed: map[string]int{}, OpenPorts: map[int]int{}, rangeIndex: map[string]int{}}
+}
+
+// Contadores do range, criados na primeira vez que ele aparece.
+func (s *Summary) rangeCounts(rng string) *RangeSummary {
+	i, ok := s.rangeIndex[rng]
+	if !ok {
+		i = len(s.Ranges)
+		s.rangeIndex[rng] = i
+		s.Ranges = append(s.Ranges, RangeSummary{Range: rng})
+	}
+	return &s.Ranges[i]
+}
+
+// Marca o range como concluído quando todos os alvos dele foram verificados.
+func (s *Summary) finishRange(rc *RangeSummary) {
+	if rc.Order == 0 && rc.Scanned == rc.Targets {
+		s.rangesFinished++
+		rc.Order = s.rangesFinished
+		rc.Duration = time.Since(s.Start)
+	}
+}
+
+// Insere o host na lista dos mais lentos, mantendo no máximo slowestHosts.
+func addSlowest(list []HostTiming, ip string, d time.Duration) []HostTiming {
+	i := sort.Search(len(list), func(i int) bool { return list[i].Duration < d })
+	if i >= slowestHosts {
+		return list
+	}
+	list = append(list, HostTiming{})
+	copy(list[i+1:], list[i:])
+	list[i] = HostTiming{IP: ip, Duration: d}
+	if len(list) > slowestHosts {
+		list = list[:slowestHosts]
+	}
+	return list
+}
+
+func (s *Summary) add(r HostResult) {
+	rc := s.rangeCounts(r.Range)
+	s.Scanned++
+	rc.Scanned++
+	s.finishRange(rc)
+	s.PingTime += r.PingTime
+	s.SNMPTime += r.SNMPTime
+	s.ZabbixTime += r.ZabbixTime
+	if r.TimedOut {
+		s.HostsTimedOut++
+	}
+	if r.Recovered {
+		s.HostsRecovered++
+	}
+	if r.Attempts > 1 {
+		s.HostsRetried++
+		if r.Err() == nil {
+			s.RetriesOK++
+		}
+	}
+	if r.PingErr != nil {
+		s.PingFailed[r.PingReason]++
+	}
+	if !r.Alive {
+		return
+	}
+	s.Alive++
+	rc.Alive++
+	if r.PortScanned {
+		s.PortScanned++
+		for _, port := range r.OpenPorts {
+			s.OpenPorts[port]++
+		}
+	}
+	s.SlowestPing = addSlowest(s.SlowestPing, r.IP, r.PingTime)
+	s.SlowestSNMP = addSlowest(s.SlowestSNMP, r.IP, r.SNMPTime)
+	if r.ZabbixTime > 0 {
+		s.SlowestZabbix = addSlowest(s.SlowestZabbix, r.IP, r.ZabbixTime)
+	}
+	if r.ZabbixAction == ZabbixCached {
+		s.HostsCached++
+		return
+	}
+	s.addTargets(r)
+	if r.SNMPErr != nil {
+		s.SNMPFailed[r.SNMPReason]++
+		rc.SNMPFailed++
+		switch {
+		case r.FallbackName == "":
+		case r.ZabbixAction == ZabbixKnown:
+			s.HostsKnown++
+		case r.ZabbixAction == ZabbixFiltered:
+			s.HostsFiltered++
+		case r.ZabbixAction == ZabbixLimited:
+			s.HostsLimited++
+		case r.ZabbixAction == ZabbixPartial:
+			s.HostsPartial++
+		case r.ZabbixAction == zabbix.Failed:
+			s.ZabbixErrors++
+			rc.ZabbixErrors++
+		default:
+			s.HostsFallback++
+		}
+		return
+	}
+	s.SNMPOK++
+	rc.SNMPOK++
+	switch r.ZabbixAction {
+	case ZabbixDryRun:
+		s.HostsDryRun++
+	case ZabbixSkipped:
+		s.HostsSkipped++
+	case ZabbixKnown:
+		s.HostsKnown++
+	case ZabbixFiltered:
+		s.HostsFiltered++
+	case ZabbixLimited:
+		s.HostsLimited++
+	case zabbix.Created:
+		s.HostsCreated++
+		rc.HostsCreated++
+	case zabbix.Existing:
+		s.HostsExisting++
+		rc.HostsExisting++
+	case zabbix.Upgraded:
+		s.HostsUpgraded++
+	case ZabbixPartial:
+		s.HostsPartial++
+	case zabbix.Failed:
+		s.ZabbixErrors++
+		rc.ZabbixErrors++
+	}
+}
+
+// Contabiliza o host nas etapas por onde ele passou. O ping e o SNMP dos
+// hosts de um agente remoto não passaram pelos workers deste processo.
+func (s *Summary) addStages(r HostResult) {
+	for i := range s.Stages {
+		st := &s.Stages[i]
+		if r.Agent != "" && st.Stage != StageZabbix {
+			continue
+		}
+		switch st.Stage {
+		case StagePing:
+			st.Processed++
+			st.Busy += r.PingTime
+			if r.PingErr != nil {
+				st.Errors++
+			}
+		case StageSNMP:
+			if !r.Alive || r.ZabbixAction == ZabbixCached {
+				continue
+			}
+			st.Processed++
+			st.Busy += r.SNMPTime
+			if r.SNMPErr != nil {
+				st.Errors++
+			}
+		case StageZabbix:
+			if r.ZabbixAction == "" || r.ZabbixAction == ZabbixDryRun || r.ZabbixAction == ZabbixSkipped || r.ZabbixAction == ZabbixKnown || r.ZabbixAction == ZabbixFiltered || r.ZabbixAction == ZabbixLimited || r.ZabbixAction == ZabbixCached {
+				continue
+			}
+			st.Processed++
+			st.Busy += r.ZabbixTime
+			if r.ZabbixErr != nil {
+				st.Errors++
+			}
+		}
+	}
+}
+
+// PingFailures é o total de pings que não testaram o host, entre todos os
+// motivos.
+func (s Summary) PingFailures() int {
+	total := 0
+	for _, n := range s.PingFailed {
+		total += n
+	}
+	return total
+}
+
+// PingUnusable é o número de pings que falharam por permissão ou execução:
+// o ping do sistema não pôde testar nenhum host (como num contêiner sem
+// CAP_NET_RAW), e o run não diz nada sobre quem está fora do ar.
+func (s Summary) PingUnusable() int {
+	return s.PingFailed[probe.ReasonPermission] + s.PingFailed[probe.ReasonInvocation]
+}
+
+// SNMPFailures é o total de falhas SNMP entre todos os motivos.
+func (s Summary) SNMPFailures() int {
+	total := 0
+	for _, n := range s.SNMPFailed {
+		total += n
+	}
+	return total
+}
+
+// NotScanned é o número de alvos que o run não chegou a verificar.
+func (s Summary) NotScanned() int {
+	return s.TargetsExpanded - s.Scanned
+}
+
+// Partial indica que o run terminou sem verificar todos os alvos, por
+// cancelamento, por MaxDuration ou pela falha de um agente.
+func (s Summary) Partial() bool {
+	return s.Interrupted || s.DeadlineReached || s.AgentsFailed() > 0
+}
+
+// AgentsFailed é o número de agentes remotos que falharam no run.
+func (s Summary) AgentsFailed() int {
+	n := 0
+	for _, a := range s.Agents {
+		if a.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Elapsed é a duração total do run.
+func (s Summary) Elapsed() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Progress expõe o resumo em construção enquanto Run executa, para relatórios
+// de progresso. O valor zero está pronto para uso.
+type Progress struct {
+	mu      sync.Mutex
+	summary *Summary
+	active  map[string]ActiveHost
+}
+
+// ActiveHost é um IP em processamento numa das etapas.
+type ActiveHost struct {
+	IP    string
+	Stage string
+	Since time.Time // início da primeira etapa do host
+}
+
+// Marca o IP como em processamento na etapa; Since fica o da primeira.
+func (p *Progress) enter(ip, stage string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active == nil {
+		p.active = map[string]ActiveHost{}
+	}
+	a, ok := p.active[ip]
+	if !ok {
+		a = ActiveHost{IP: ip, Since: time.Now()}
+	}
+	a.Stage = stage
+	p.active[ip] = a
+}
+
+// Tira o IP dos em processamento, ao concluir ou ao esperar uma retentativa.
+func (p *Progress) leave(ip string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.active, ip)
+}
+
+// Active retorna os IPs em processamento, do que está há mais tempo ao mais
+// recente.
+func (p *Progress) Active() []ActiveHost {
+	p.mu.Lock()
+	hosts := make([]ActiveHost, 0, len(p.active))
+	for _, a := range p.active {
+		hosts = append(hosts, a)
+	}
+	p.mu.Unlock()
+	sort.Slice(hosts, func(i, j int) bool {
+		if !hosts[i].Since.Equal(hosts[j].Since) {
+			return hosts[i].Since.Before(hosts[j].Since)
+		}
+		return hosts[i].IP < hosts[j].IP
+	})
+	return hosts
+}
+
+// Passa a acompanhar o resumo do run, já com os alvos expandidos.
+func (p *Progress) begin(s *Summary) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary = s
+}
+
+func (p *Progress) add(r HostResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary.add(r)
+	p.summary.addStages(r)
+}
+
+// Tira dos alvos a segunda ocorrência de um IP do range.
+func (p *Progress) duplicate(rng string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rc := p.summary.rangeCounts(rng)
+	rc.Targets--
+	p.summary.TargetsExpanded--
+	p.summary.TargetsDuplicate++
+	p.summary.finishRange(rc)
+}
+
+// Atualiza a fila de entrada de uma etapa, com delta +1 ao entrar um host e
+// -1 ao sair.
+func (p *Progress) queue(stage string, delta int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.summary.Stages {
+		if st := &p.summary.Stages[i]; st.Stage == stage {
+			st.Queued += delta
+			st.QueuePeak = max(st.QueuePeak, st.Queued)
+			return
+		}
+	}
+}
+
+func (p *Progress) addConcurrency(c ConcurrencyChange) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary.Concurrency = append(p.summary.Concurrency, c)
+}
+
+// Snapshot é uma cópia do resumo atual, sem compartilhar mapas e listas com o
+// coletor. Antes de Run começar retorna um resumo vazio.
+func (p *Progress) Snapshot() Summary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.summary == nil {
+		return Summary{PingFailed: map[string]int{}, SNMPFailed: map[string]int{}, OpenPorts: map[int]int{}}
+	}
+	c := *p.summary
+	c.PingFailed = make(map[string]int, len(p.summary.PingFailed))
+	for reason, n := range p.summary.PingFailed {
+		c.PingFailed[reason] = n
+	}
+	c.SNMPFailed = make(map[string]int, len(p.summary.SNMPFailed))
+	for reason, n := range p.summary.SNMPFailed {
+		c.SNMPFailed[reason] = n
+	}
+	c.OpenPorts = make(map[int]int, len(p.summary.OpenPorts))
+	for port, n := range p.summary.OpenPorts {
+		c.OpenPorts[port] = n
+	}
+	c.SlowestPing = append([]HostTiming(nil), p.summary.SlowestPing...)
+	c.SlowestSNMP = append([]HostTiming(nil), p.summary.SlowestSNMP...)
+	c.SlowestZabbix = append([]HostTiming(nil), p.summary.SlowestZabbix...)
+	c.Ranges = append([]RangeSummary(nil), p.summary.Ranges...)
+	c.Stages = append([]StageSummary(nil), p.summary.Stages...)
+	c.Concurrency = append([]ConcurrencyChange(nil), p.summary.Concurrency...)
+	c.Targets = append([]TargetSummary(nil), p.summary.Targets...)
+	c.rangeIndex = nil
+	return c
+}
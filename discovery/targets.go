@@ -0,0 +1,198 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"discoveryhosts/logx"
+	"discoveryhosts/zabbix"
+)
+
+// ZabbixPartial é a ação de um host cadastrado em parte dos servidores de
+// Config.Targets; ZabbixErr junta as falhas dos demais.
+const ZabbixPartial = "partial"
+
+// ZabbixTarget é um dos servidores de Config.Targets, com os grupos, o proxy
+// e os templates dos hosts criados nele.
+type ZabbixTarget struct {
+	Name        string // identifica o servidor nos logs e nos resultados
+	Zabbix      HostCreator
+	GroupIDs    []string
+	ProxyID     string // vazio ou "0" para nenhum
+	TemplateIDs []string
+}
+
+// TargetResult é o cadastro de um host num dos servidores de Config.Targets.
+type TargetResult struct {
+	Target string
+	Action string // zabbix.Created, zabbix.Existing, zabbix.Upgraded ou zabbix.Failed
+	HostID string
+	Err    error
+	Time   time.Duration
+}
+
+// TargetSummary reúne os contadores de um backend (ou servidor de
+// Config.Targets).
+type TargetSummary struct {
+	Target   string
+	Created  int
+	Existing int
+	Upgraded int
+	Errors   int
+	DryRun   int // entregues a um backend que não cadastra nada
+}
+
+// Servidor único do cadastro quando não há Config.Backends nem
+// Config.Targets.
+func (d *discoverer) primary() Backend {
+	return NewBackend(ZabbixTarget{Zabbix: d.cfg.Zabbix, GroupIDs: d.cfg.GroupIDs, ProxyID: d.cfg.ProxyID})
+}
+
+// Backends do run: os de Config.Backends ou, sem eles, os servidores de
+// Config.Targets, e os de cada range de Config.RangeBackends.
+func resolveBackends(cfg Config, targets []rangeTargets) ([]Backend, map[string][]Backend, error) {
+	if len(cfg.Backends) > 0 && len(cfg.Targets) > 0 {
+		return nil, nil, fmt.Errorf("use Backends ou Targets, não os dois")
+	}
+	backends := cfg.Backends
+	for _, t := range cfg.Targets {
+		backends = append(backends, NewBackend(t))
+	}
+	byName := map[string]Backend{}
+	for _, b := range cfg.Backends {
+		switch {
+		case b.Name() == "":
+			return nil, nil, fmt.Errorf("backend sem nome")
+		case byName[b.Name()] != nil:
+			return nil, nil, fmt.Errorf("backend %s repetido", b.Name())
+		}
+		byName[b.Name()] = b
+	}
+	for _, t := range cfg.Targets {
+		byName[t.Name] = NewBackend(t)
+	}
+	if len(cfg.RangeBackends) == 0 {
+		return backends, nil, nil
+	}
+	if len(backends) == 0 {
+		return nil, nil, fmt.Errorf("backends por range sem Backends nem Targets")
+	}
+	ranges := map[string]bool{}
+	for _, t := range targets {
+		ranges[t.rng] = true
+	}
+	byRange := make(map[string][]Backend, len(cfg.RangeBackends))
+	for rng, names := range cfg.RangeBackends {
+		rng = strings.TrimSpace(rng)
+		if !ranges[rng] {
+			return nil, nil, fmt.Errorf("backends para o range %s, que não está nos ranges do run", rng)
+		}
+		list := []Backend{}
+		for _, name := range names {
+			b, ok := byName[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("backend %s do range %s não está entre os backends do run", name, rng)
+			}
+			list = append(list, b)
+		}
+		byRange[rng] = list
+	}
+	return backends, byRange, nil
+}
+
+// Backends do cadastro dos hosts do range.
+func (d *discoverer) backendsFor(rng string) []Backend {
+	if b, ok := d.byRange[rng]; ok {
+		return b
+	}
+	return d.backends
+}
+
+// Cadastra o host em todos os backends do seu range ao mesmo tempo, cada um
+// com o seu resultado. Numa retentativa, os backends em que o host já foi
+// cadastrado não são chamados de novo.
+func (d *discoverer) createInTargets(ctx context.Context, hl logx.Logger, r *HostResult) {
+	backends := d.backendsFor(r.Range)
+	if len(backends) == 0 {
+		// Host do NameFallback num range sem backends
+		r.ZabbixAction = ZabbixSkipped
+		return
+	}
+	if r.Targets == nil {
+		r.Targets = make([]TargetResult, len(backends))
+	}
+	host := *r
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		tr := &r.Targets[i]
+		if tr.Action != "" && tr.Err == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			action, hostID, err := d.createZabbixHost(ctx, hl, host, b)
+			*tr = TargetResult{Target: b.Name(), Action: action, HostID: hostID, Err: err, Time: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+	r.ZabbixAction, r.HostID, r.ZabbixErr = mergeTargets(r.Targets)
+}
+
+// Resultado do host a partir do cadastro em cada servidor. O hostid é o do
+// primeiro servidor com sucesso e a ação, a mais forte entre eles (Created,
+// Upgraded, Existing e ZabbixDryRun, nessa ordem); com falhas em só parte dos
+// servidores a ação é ZabbixPartial.
+func mergeTargets(results []TargetResult) (string, string, error) {
+	var action, hostID string
+	var errs []error
+	for _, tr := range results {
+		if tr.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tr.Target, tr.Err))
+			continue
+		}
+		if hostID == "" {
+			hostID = tr.HostID
+		}
+		if action == "" || action == ZabbixDryRun || tr.Action == zabbix.Created || (tr.Action == zabbix.Upgraded && action == zabbix.Existing) {
+			action = tr.Action
+		}
+	}
+	switch {
+	case len(errs) == len(results):
+		action = zabbix.Failed
+	case len(errs) > 0:
+		action = ZabbixPartial
+	}
+	return action, hostID, errors.Join(errs...)
+}
+
+// Contabiliza o cadastro do host em cada servidor, pelo nome; servidores que
+// não estão no run (de um checkpoint com outra configuração) são ignorados.
+func (s *Summary) addTargets(r HostResult) {
+	for _, tr := range r.Targets {
+		for i := range s.Targets {
+			ts := &s.Targets[i]
+			if ts.Target != tr.Target {
+				continue
+			}
+			switch tr.Action {
+			case zabbix.Created:
+				ts.Created++
+			case zabbix.Existing:
+				ts.Existing++
+			case zabbix.Upgraded:
+				ts.Upgraded++
+			case zabbix.Failed:
+				ts.Errors++
+			case ZabbixDryRun:
+				ts.DryRun++
+			}
+		}
+	}
+}
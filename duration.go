@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration aceita tanto o formato legado (número inteiro de segundos) quanto
+// strings no formato de time.ParseDuration ("750ms", "2s", "1.5s").
+type Duration time.Duration
+
+// Interpreta um valor decodificado genericamente (número ou string).
+func (d *Duration) set(v interface{}) error {
+	switch val := v.(type) {
+	case int64:
+		*d = Duration(time.Duration(val) * time.Second)
+	case float64:
+		*d = Duration(val * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(val)
+		if err != nil {
+			// Strings numéricas ("2") continuam significando segundos
+			secs, errNum := strconv.ParseFloat(val, 64)
+			if errNum != nil {
+				return fmt.Errorf("duração inválida %q: use segundos ou um valor como \"750ms\", \"2s\"", val)
+			}
+			parsed = time.Duration(secs * float64(time.Second))
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("duração inválida %v: use segundos ou um valor como \"750ms\", \"2s\"", v)
+	}
+	return nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if f, ok := v.(float64); ok && f == float64(int64(f)) {
+		return d.set(int64(f))
+	}
+	return d.set(v)
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var v interface{}
+	if err := node.Decode(&v); err != nil {
+		return err
+	}
+	if i, ok := v.(int); ok {
+		v = int64(i)
+	}
+	return d.set(v)
+}
+
+func (d *Duration) UnmarshalTOML(v interface{}) error {
+	return d.set(v)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
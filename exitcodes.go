@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"discoveryhosts/discovery"
+)
+
+// Códigos de saída do scan, para cron e pipelines reagirem ao resultado.
+const (
+	exitOK          = 0 // run concluído sem erros
+	exitFatal       = 1 // erro fatal de configuração ou inicialização, run abortado (panics, login do Zabbix) ou ping sem permissão
+	exitZabbixError = 2 // run concluído com erros no Zabbix (ou, com -strict, qualquer erro por host: ping, SNMP ou cadastro parcial)
+	exitNoTargets   = 3 // run sem nenhum alvo a verificar, ou concluído sem nenhum verificado
+	exitInterrupted = 4 // interrompido por sinal
+	exitAgentFailed = 5 // um agente remoto falhou e os IPs dele ficaram sem verificação
+	exitLocked      = 6 // outra instância tem o lock_file
+)
+
+const exitCodesHelp = `
+Códigos de saída:
+  0  run concluído sem erros
+  1  erro fatal de configuração ou inicialização, ou run abortado (panics demais,
+     login do Zabbix recusado, ping ausente), ou pings que falharam por falta de
+     permissão ou por um comando ping inutilizável
+  2  run concluído com erros no Zabbix, inclusive hosts criados só em parte
+     dos zabbix_targets (com -strict, também falhas do ping e do SNMP)
+  3  nenhum alvo a verificar (ranges vazios ou com todos os IPs excluídos; o
+     run nem começa) ou run concluído sem nenhum alvo verificado
+  4  interrompido por sinal
+  5  um agente remoto falhou; os IPs restantes dele não foram verificados
+  6  outra instância está em execução (lock_file em uso após o -lock-wait)
+`
+
+// Código de saída do run a partir dos contadores do resumo. Com strict,
+// qualquer erro por host conta como falha.
+func exitCode(s discovery.Summary, strict bool) int {
+	switch {
+	case s.Aborted:
+		return exitFatal
+	case s.Interrupted:
+		return exitInterrupted
+	case s.AgentsFailed() > 0:
+		return exitAgentFailed
+	case s.PingUnusable() > 0:
+		return exitFatal
+	case s.Scanned == 0:
+		return exitNoTargets
+	case s.ZabbixErrors > 0 || s.HostsPartial > 0:
+		// Um host criado num servidor e com falha em outro também é um erro
+		return exitZabbixError
+	case strict && (s.PingFailures() > 0 || s.SNMPFailures() > 0 || s.HostsPartial > 0):
+		return exitZabbixError
+	}
+	return exitOK
+}
+
+// Uso do scan: as opções do flag seguidas da tabela de códigos de saída.
+func usageWithExitCodes() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Uso: discoveryhosts scan [opções]\n\nOpções:")
+	flag.PrintDefaults()
+	fmt.Fprint(out, exitCodesHelp)
+}
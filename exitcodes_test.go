@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"discoveryhosts/discovery"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      discovery.Summary
+		strict bool
+		want   int
+	}{
+		{name: "sem erros", s: discovery.Summary{Scanned: 10, HostsCreated: 2}, want: exitOK},
+		{name: "abortado", s: discovery.Summary{Scanned: 10, Aborted: true}, want: exitFatal},
+		{name: "interrompido", s: discovery.Summary{Scanned: 3, Interrupted: true}, want: exitInterrupted},
+		{name: "nada verificado", s: discovery.Summary{}, want: exitNoTargets},
+		{name: "erro no Zabbix", s: discovery.Summary{Scanned: 10, ZabbixErrors: 1}, want: exitZabbixError},
+		{name: "cadastro parcial", s: discovery.Summary{Scanned: 10, HostsPartial: 1}, want: exitZabbixError},
+		{name: "falha SNMP sem strict", s: discovery.Summary{Scanned: 10, SNMPFailed: map[string]int{"timeout": 1}}, want: exitOK},
+		{name: "falha SNMP com strict", s: discovery.Summary{Scanned: 10, SNMPFailed: map[string]int{"timeout": 1}}, strict: true, want: exitZabbixError},
+		{name: "falha do ping sem strict", s: discovery.Summary{Scanned: 10, PingFailed: map[string]int{"other": 1}}, want: exitOK},
+		{name: "falha do ping com strict", s: discovery.Summary{Scanned: 10, PingFailed: map[string]int{"other": 1}}, strict: true, want: exitZabbixError},
+		{name: "ping sem permissão", s: discovery.Summary{Scanned: 10, PingFailed: map[string]int{"permission": 10}}, want: exitFatal},
+		{name: "ping inutilizável", s: discovery.Summary{Scanned: 10, PingFailed: map[string]int{"invocation": 1}}, want: exitFatal},
+		{name: "cadastro parcial com strict", s: discovery.Summary{Scanned: 10, HostsPartial: 1}, strict: true, want: exitZabbixError},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.s, tt.strict); got != tt.want {
+			t.Errorf("%s: código %d, esperava %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/zabbix"
+)
+
+// NameFallback configura o cadastro dos hosts que respondem ao ping mas não ao
+// SNMP: o nome vem do registro PTR do IP (ou "unknown-<ip>") e o host é
+// criado com uma interface sem SNMP e a tag, cujo valor é o IP. Num run em
+// que o SNMP responda, o host é renomeado para o sysName e passa à interface
+// SNMP, sem duplicar.
+type NameFallback struct {
+	Enabled     bool     `json:"enabled,omitempty" yaml:"enabled" toml:"enabled"`
+	Interface   string   `json:"interface" yaml:"interface" toml:"interface"` // icmp ou agent
+	Tag         string   `json:"tag" yaml:"tag" toml:"tag"`
+	DNSTimeout  Duration `json:"dns_timeout" yaml:"dns_timeout" toml:"dns_timeout"`
+	DNSResolver string   `json:"dns_resolver,omitempty" yaml:"dns_resolver" toml:"dns_resolver"` // host[:porta]; vazio usa o do sistema
+}
+
+func (f NameFallback) validate(c Config) []error {
+	if !f.Enabled {
+		return nil
+	}
+	var errs []error
+	if !c.backend(backendZabbix) {
+		errs = append(errs, fmt.Errorf("name_fallback exige o backend zabbix%s", c.origin("name_fallback.enabled")))
+	}
+	if f.Interface != zabbix.InterfaceICMP && f.Interface != zabbix.InterfaceAgent {
+		errs = append(errs, fmt.Errorf("name_fallback.interface desconhecida: %q (use icmp ou agent)%s", f.Interface, c.origin("name_fallback.interface")))
+	}
+	if strings.TrimSpace(f.Tag) == "" {
+		errs = append(errs, fmt.Errorf("name_fallback.tag não pode ser vazio%s", c.origin("name_fallback.tag")))
+	}
+	if time.Duration(f.DNSTimeout) <= 0 {
+		errs = append(errs, fmt.Errorf("name_fallback.dns_timeout deve ser positivo (atual: %s)%s", f.DNSTimeout, c.origin("name_fallback.dns_timeout")))
+	}
+	if f.DNSResolver != "" {
+		if _, _, err := net.SplitHostPort(f.resolverAddr()); err != nil {
+			errs = append(errs, fmt.Errorf("name_fallback.dns_resolver inválido: %q (use host ou host:porta)%s", f.DNSResolver, c.origin("name_fallback.dns_resolver")))
+		}
+	}
+	return errs
+}
+
+// Endereço do dns_resolver, com a porta 53 se omitida.
+func (f NameFallback) resolverAddr() string {
+	if _, _, err := net.SplitHostPort(f.DNSResolver); err == nil {
+		return f.DNSResolver
+	}
+	return net.JoinHostPort(f.DNSResolver, "53")
+}
+
+// Configuração do pacote discovery; nil com o fallback desligado.
+func (f NameFallback) discovery() *discovery.NameFallback {
+	if !f.Enabled {
+		return nil
+	}
+	fb := &discovery.NameFallback{Interface: f.Interface, Tag: f.Tag, Timeout: time.Duration(f.DNSTimeout)}
+	if f.DNSResolver != "" {
+		addr := f.resolverAddr()
+		fb.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	return fb
+}
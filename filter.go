@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"discoveryhosts/discovery"
+)
+
+// Filtro de -match-sysname e -match-sysdescr, aplicado aos hosts identificados
+// depois do SNMP: os que não casam saem como filtrados, sem cadastro.
+type hostFilter struct {
+	sysName  *regexp.Regexp
+	sysDescr *regexp.Regexp
+}
+
+// Compila as expressões das flags, sem diferenciar maiúsculas de minúsculas
+// (um (?-i) no início da expressão volta a diferenciar). Nil sem nenhuma.
+func newHostFilter(sysName, sysDescr string) (*hostFilter, error) {
+	var f hostFilter
+	var err error
+	if f.sysName, err = compileMatch("-match-sysname", sysName); err != nil {
+		return nil, err
+	}
+	if f.sysDescr, err = compileMatch("-match-sysdescr", sysDescr); err != nil {
+		return nil, err
+	}
+	if f.sysName == nil && f.sysDescr == nil {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+func compileMatch(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	// Compilada antes sem o (?i), para o erro mostrar a expressão da flag
+	if _, err := regexp.Compile(expr); err != nil {
+		return nil, fmt.Errorf("%s inválido: %v", name, strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+	}
+	return regexp.MustCompile("(?i)" + expr), nil
+}
+
+// Indica se o host casa com todas as expressões definidas. Os hosts sem SNMP,
+// cadastrados pelo nome DNS, só têm o nome para o -match-sysname.
+func (f *hostFilter) match(r discovery.HostResult) bool {
+	if f.sysName != nil && !f.sysName.MatchString(r.Name()) {
+		return false
+	}
+	if f.sysDescr != nil && !f.sysDescr.MatchString(r.SNMP.SysDescr) {
+		return false
+	}
+	return true
+}
+
+// Config.Filter do discovery; nil sem filtro.
+func (f *hostFilter) matcher() func(discovery.HostResult) bool {
+	if f == nil {
+		return nil
+	}
+	return f.match
+}
+
+func (f *hostFilter) String() string {
+	var parts []string
+	if f.sysName != nil {
+		parts = append(parts, "sysName ~ "+strings.TrimPrefix(f.sysName.String(), "(?i)"))
+	}
+	if f.sysDescr != nil {
+		parts = append(parts, "sysDescr ~ "+strings.TrimPrefix(f.sysDescr.String(), "(?i)"))
+	}
+	return strings.Join(parts, ", ")
+}
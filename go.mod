@@ -3,11 +3,23 @@ module discoveryhosts
 go 1.25.1
 
 require (
-	github.com/claranet/go-zabbix-api v1.0.2 // indirect
-	github.com/go-ping/ping v1.2.0 // indirect
-	github.com/google/uuid v1.2.0 // indirect
-	github.com/gosnmp/gosnmp v1.42.1 // indirect
-	golang.org/x/net v0.15.0 // indirect
-	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
-	golang.org/x/sys v0.13.0 // indirect
+	github.com/BurntSushi/toml v1.4.0
+	github.com/gosnmp/gosnmp v1.42.1
+	github.com/mattn/go-isatty v0.0.20
+	go.uber.org/goleak v1.3.0
+	golang.org/x/sys v0.34.0
+	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.38.2
+)
+
+require (
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
+	modernc.org/libc v1.66.3 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.11.0 // indirect
 )
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/i18n"
+)
+
+// Grafana configura a anotação criada ao fim de cada run, marcando o
+// intervalo do run (do início ao fim) na linha do tempo dos dashboards.
+type Grafana struct {
+	URL   string `json:"url,omitempty" yaml:"url" toml:"url"`       // URL base do Grafana, sem o /api
+	Token string `json:"token,omitempty" yaml:"token" toml:"token"` // service account com permissão de anotações
+	// Tags da anotação; site acrescenta a tag site:<nome>
+	Tags []string `json:"tags" yaml:"tags" toml:"tags"`
+	Site string   `json:"site,omitempty" yaml:"site" toml:"site"`
+	// Dashboard (e painel) da anotação; vazio para uma anotação da
+	// organização, visível em todos os dashboards que a consultarem
+	DashboardUID string `json:"dashboard_uid,omitempty" yaml:"dashboard_uid" toml:"dashboard_uid"`
+	PanelID      int    `json:"panel_id,omitempty" yaml:"panel_id" toml:"panel_id"`
+	// Só anota os runs que criaram hosts ou em que algum host sumiu
+	OnlyOnChanges bool     `json:"only_on_changes,omitempty" yaml:"only_on_changes" toml:"only_on_changes"`
+	Timeout       Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+func (g Grafana) validate(c Config) []error {
+	if g.URL == "" {
+		return nil
+	}
+	var errs []error
+	if !isConfigURL(g.URL) {
+		errs = append(errs, fmt.Errorf("grafana.url deve ser uma URL http(s)://%s", c.origin("grafana.url")))
+	}
+	if g.Token == "" {
+		errs = append(errs, fmt.Errorf("grafana.token é obrigatório com grafana.url%s", c.origin("grafana.url")))
+	}
+	for i, t := range g.Tags {
+		if strings.TrimSpace(t) == "" {
+			errs = append(errs, fmt.Errorf("grafana.tags[%d] não pode ser vazio%s", i, c.origin("grafana.tags")))
+		}
+	}
+	if g.PanelID < 0 {
+		errs = append(errs, fmt.Errorf("grafana.panel_id não pode ser negativo (atual: %d)%s", g.PanelID, c.origin("grafana.panel_id")))
+	}
+	if g.PanelID > 0 && g.DashboardUID == "" {
+		errs = append(errs, fmt.Errorf("grafana.panel_id requer grafana.dashboard_uid%s", c.origin("grafana.panel_id")))
+	}
+	if time.Duration(g.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("grafana.timeout deve ser positivo%s", c.origin("grafana.timeout")))
+	}
+	return errs
+}
+
+func (g Grafana) redacted() Grafana {
+	g.Token = maskSecret(g.Token)
+	return g
+}
+
+// Tags da anotação, com a do site e a de dry-run.
+func (g Grafana) tags(dryRun bool) []string {
+	tags := []string{}
+	for _, t := range g.Tags {
+		tags = append(tags, strings.TrimSpace(t))
+	}
+	if g.Site != "" {
+		tags = append(tags, "site:"+g.Site)
+	}
+	if dryRun {
+		tags = append(tags, "dry-run")
+	}
+	return tags
+}
+
+// Cria a anotação do run no close. Com snapshot_file, os hosts do run
+// anterior que não responderam neste entram no texto como sumidos. Falhas só
+// geram log: o Grafana fora do ar não muda o código de saída do run.
+type grafanaSink struct {
+	cfg    Grafana
+	dryRun bool
+	prev   *snapshot // run anterior; nil sem snapshot_file ou sem snapshot
+	seen   map[string]bool
+}
+
+// O snapshot anterior é lido já no início, antes que o run grave o dele.
+func newGrafanaSink(cfg Config, dryRun bool) *grafanaSink {
+	s := &grafanaSink{cfg: cfg.Grafana, dryRun: dryRun, seen: map[string]bool{}}
+	if cfg.SnapshotFile != "" {
+		s.prev, _ = loadSnapshot(cfg.SnapshotFile)
+	}
+	return s
+}
+
+func (s *grafanaSink) write(r discovery.HostResult) error {
+	s.seen[r.IP] = true
+	return nil
+}
+
+// Hosts do run anterior que não responderam; -1 se não der para saber (sem
+// snapshot, com um run parcial ou com um scan só de alguns IPs).
+func (s *grafanaSink) missing(sum discovery.Summary) int {
+	if s.prev == nil || sum.Partial() || sum.Targeted {
+		return -1
+	}
+	n := 0
+	for _, h := range s.prev.Hosts {
+		if !s.seen[h.IP] {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *grafanaSink) close(sum discovery.Summary) error {
+	missing := s.missing(sum)
+	if s.cfg.OnlyOnChanges && sum.HostsCreated == 0 && missing <= 0 {
+		logInfo("grafana.skipped")
+		return nil
+	}
+	text := i18n.T("grafana.text", sum.RunID, sum.HostsCreated, sum.Alive, sum.SNMPOK)
+	if missing >= 0 {
+		text += "; " + i18n.T("grafana.text_missing", missing)
+	}
+	if sum.ZabbixErrors > 0 {
+		text += "; " + i18n.T("grafana.text_errors", sum.ZabbixErrors)
+	}
+	annotation := map[string]interface{}{
+		"time":    sum.Start.UnixMilli(),
+		"timeEnd": sum.End.UnixMilli(),
+		"tags":    s.cfg.tags(s.dryRun),
+		"text":    text,
+	}
+	if s.cfg.DashboardUID != "" {
+		annotation["dashboardUID"] = s.cfg.DashboardUID
+	}
+	if s.cfg.PanelID > 0 {
+		annotation["panelId"] = s.cfg.PanelID
+	}
+	if err := s.post(annotation); err != nil {
+		logError("grafana.failed", s.cfg.URL, err)
+		return nil
+	}
+	logInfo("grafana.sent", s.cfg.URL)
+	return nil
+}
+
+func (s *grafanaSink) post(annotation map[string]interface{}) error {
+	body, err := json.Marshal(annotation)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(s.cfg.URL, "/")+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := (&http.Client{Timeout: time.Duration(s.cfg.Timeout)}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &msg) == nil && msg.Message != "" {
+			return fmt.Errorf("API do Grafana respondeu HTTP %d: %s", resp.StatusCode, msg.Message)
+		}
+		return fmt.Errorf("API do Grafana respondeu HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"discoveryhosts/discovery"
+)
+
+// Formato dos horários gravados no histórico: UTC, comparável como texto.
+const historyTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// Migrações do banco de histórico, aplicadas em ordem. A versão atual fica
+// em PRAGMA user_version; novas versões só acrescentam itens ao fim.
+var historyMigrations = []string{
+	`CREATE TABLE runs (
+		id            INTEGER PRIMARY KEY,
+		run_id        TEXT NOT NULL UNIQUE,
+		started_at    TEXT NOT NULL,
+		ended_at      TEXT,
+		dry_run       INTEGER NOT NULL,
+		targets       INTEGER NOT NULL DEFAULT 0,
+		scanned       INTEGER NOT NULL DEFAULT 0,
+		alive         INTEGER NOT NULL DEFAULT 0,
+		snmp_ok       INTEGER NOT NULL DEFAULT 0,
+		hosts_created INTEGER NOT NULL DEFAULT 0,
+		zabbix_errors INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE run_ranges (
+		run      INTEGER NOT NULL REFERENCES runs(id),
+		ip_range TEXT NOT NULL,
+		targets  INTEGER NOT NULL,
+		scanned  INTEGER NOT NULL,
+		alive    INTEGER NOT NULL,
+		snmp_ok  INTEGER NOT NULL
+	);
+	CREATE TABLE results (
+		run           INTEGER NOT NULL REFERENCES runs(id),
+		ip            TEXT NOT NULL,
+		ip_range      TEXT NOT NULL,
+		sysname       TEXT NOT NULL,
+		snmp_ok       INTEGER NOT NULL,
+		zabbix_action TEXT NOT NULL,
+		seen_at       TEXT NOT NULL
+	);
+	CREATE INDEX results_ip ON results(ip, seen_at);
+	CREATE INDEX results_run ON results(run);`,
+}
+
+// Abre o banco de histórico, criando-o se preciso, e aplica as migrações
+// pendentes.
+func openHistory(path string) (*sql.DB, error) {
+	// Espera o lock de outro run gravando em vez de falhar na hora
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(10000)")
+	if err != nil {
+		return nil, fmt.Errorf("falha ao abrir history_db %s: %w", path, err)
+	}
+	if err := migrateHistory(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("falha ao migrar history_db %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func migrateHistory(db *sql.DB) error {
+	var current int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&current); err != nil {
+		return err
+	}
+	if current > len(historyMigrations) {
+		return fmt.Errorf("banco na versão %d, mais nova que a suportada (%d)", current, len(historyMigrations))
+	}
+	for v := current; v < len(historyMigrations); v++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(historyMigrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migração %d: %w", v+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", v+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func historyTime(t time.Time) string {
+	return t.UTC().Format(historyTimeFormat)
+}
+
+// Grava o run e os hosts que responderam no banco de histórico. Os hosts
+// ficam em memória e tudo é gravado numa única transação no close, para não
+// segurar o lock do banco durante o scan.
+type historySink struct {
+	db     *sql.DB
+	path   string
+	runID  string
+	dryRun bool
+	hosts  []historyHost
+}
+
+type historyHost struct {
+	r      discovery.HostResult
+	seenAt time.Time
+}
+
+// O banco é aberto e migrado já na criação, para que problemas apareçam antes
+// do scan.
+func newHistorySink(path, runID string, dryRun bool) (*historySink, error) {
+	db, err := openHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	return &historySink{db: db, path: path, runID: runID, dryRun: dryRun}, nil
+}
+
+func (s *historySink) write(r discovery.HostResult) error {
+	s.hosts = append(s.hosts, historyHost{r: r, seenAt: time.Now()})
+	return nil
+}
+
+func (s *historySink) abort() {
+	s.db.Close()
+}
+
+func (s *historySink) close(sum discovery.Summary) error {
+	defer s.db.Close()
+	tx, err := s.db.Begin()
+	if err == nil {
+		if err = s.save(tx, sum); err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("falha ao gravar o run em %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *historySink) save(tx *sql.Tx, sum discovery.Summary) error {
+	res, err := tx.Exec(`INSERT INTO runs (run_id, started_at, ended_at, dry_run, targets, scanned, alive,
+		snmp_ok, hosts_created, zabbix_errors) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.runID, historyTime(sum.Start), historyTime(sum.End), s.dryRun, sum.TargetsExpanded, sum.Scanned,
+		sum.Alive, sum.SNMPOK, sum.HostsCreated, sum.ZabbixErrors)
+	if err != nil {
+		return err
+	}
+	run, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, rc := range sum.Ranges {
+		_, err := tx.Exec("INSERT INTO run_ranges (run, ip_range, targets, scanned, alive, snmp_ok) VALUES (?, ?, ?, ?, ?, ?)",
+			run, rc.Range, rc.Targets, rc.Scanned, rc.Alive, rc.SNMPOK)
+		if err != nil {
+			return err
+		}
+	}
+	stmt, err := tx.Prepare(`INSERT INTO results (run, ip, ip_range, sysname, snmp_ok, zabbix_action, seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, h := range s.hosts {
+		r := h.r
+		if _, err := stmt.Exec(run, r.IP, r.Range, r.SNMP.SysName, r.SNMPErr == nil, r.ZabbixAction, historyTime(h.seenAt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subcomando history: consultas simples ao history_db.
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	dbPath := fs.String("db", "", "banco de histórico (padrão: history_db da configuração)")
+	since := fs.String("since", "", "início do período (AAAA-MM-DD) para new-hosts e trends")
+	until := fs.String("until", "", "fim do período, exclusivo (AAAA-MM-DD)")
+	rng := fs.String("range", "", "limita trends a um range")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Uso: discoveryhosts history [opções] <consulta>")
+		fmt.Fprintln(out, "\nConsultas:")
+		fmt.Fprintln(out, "  last-seen <ip>   primeira e última vez que o IP respondeu e runs sem resposta desde então")
+		fmt.Fprintln(out, "  new-hosts        hosts que responderam pela primeira vez no período (-since/-until)")
+		fmt.Fprintln(out, "  trends           hosts que responderam por range em cada run (-range, -since/-until)")
+		fmt.Fprintln(out, "\nOpções:")
+		fs.PrintDefaults()
+	}
+	// Aceita as opções antes ou depois do nome da consulta
+	fs.Parse(args)
+	query := fs.Arg(0)
+	if fs.NArg() > 0 {
+		fs.Parse(fs.Args()[1:])
+	}
+	if query == "" {
+		fs.Usage()
+		return fmt.Errorf("informe a consulta: last-seen, new-hosts ou trends")
+	}
+
+	if *dbPath == "" {
+		cfg, err := cf.load()
+		if err != nil {
+			return err
+		}
+		if cfg.HistoryDB == "" {
+			return fmt.Errorf("history_db não configurado; use -db")
+		}
+		*dbPath = cfg.HistoryDB
+	}
+	if _, err := os.Stat(*dbPath); err != nil {
+		return fmt.Errorf("falha ao abrir history_db %s: %w", *dbPath, err)
+	}
+	for _, d := range []*string{since, until} {
+		if *d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", *d); err != nil {
+			return fmt.Errorf("data inválida: %s (use AAAA-MM-DD)", *d)
+		}
+	}
+	db, err := openHistory(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	switch query {
+	case "last-seen":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("uso: discoveryhosts history last-seen <ip>")
+		}
+		return historyLastSeen(db, w, fs.Arg(0))
+	case "new-hosts":
+		return historyNewHosts(db, w, *since, *until)
+	case "trends":
+		return historyTrends(db, w, *rng, *since, *until)
+	}
+	return fmt.Errorf("consulta desconhecida: %s (use last-seen, new-hosts ou trends)", query)
+}
+
+// Filtro de período sobre uma coluna de horário; until é exclusivo.
+func periodFilter(column, since, until string) (string, []interface{}) {
+	where, args := "", []interface{}{}
+	if since != "" {
+		where += " AND " + column + " >= ?"
+		args = append(args, since)
+	}
+	if until != "" {
+		where += " AND " + column + " < ?"
+		args = append(args, until)
+	}
+	return where, args
+}
+
+func historyLastSeen(db *sql.DB, w io.Writer, ip string) error {
+	var first, last, sysname, rng sql.NullString
+	var runs int
+	err := db.QueryRow(`SELECT MIN(seen_at), MAX(seen_at), COUNT(DISTINCT run),
+		(SELECT sysname FROM results WHERE ip = ?1 ORDER BY seen_at DESC LIMIT 1),
+		(SELECT ip_range FROM results WHERE ip = ?1 ORDER BY seen_at DESC LIMIT 1)
+		FROM results WHERE ip = ?1`, ip).Scan(&first, &last, &runs, &sysname, &rng)
+	if err != nil {
+		return err
+	}
+	if !last.Valid {
+		fmt.Fprintf(w, "%s nunca respondeu nos runs registrados\n", ip)
+		return nil
+	}
+	// Runs posteriores que varreram o mesmo range sem resposta do IP
+	var missed int
+	var firstMissed sql.NullString
+	err = db.QueryRow(`SELECT COUNT(*), MIN(r.started_at) FROM runs r
+		JOIN run_ranges rr ON rr.run = r.id AND rr.ip_range = ?
+		WHERE r.started_at > ?`, rng.String, last.String).Scan(&missed, &firstMissed)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "ip:\t%s\n", ip)
+	fmt.Fprintf(w, "sysname:\t%s\n", sysname.String)
+	fmt.Fprintf(w, "range:\t%s\n", rng.String)
+	fmt.Fprintf(w, "primeira resposta:\t%s\n", first.String)
+	fmt.Fprintf(w, "última resposta:\t%s\n", last.String)
+	fmt.Fprintf(w, "runs com resposta:\t%d\n", runs)
+	if missed > 0 {
+		fmt.Fprintf(w, "sem resposta desde:\t%s (%d runs)\n", firstMissed.String, missed)
+	}
+	return nil
+}
+
+func historyNewHosts(db *sql.DB, w io.Writer, since, until string) error {
+	where, args := periodFilter("first_seen", since, until)
+	rows, err := db.Query(`SELECT ip, first_seen, sysname, ip_range FROM (
+			SELECT ip, MIN(seen_at) AS first_seen,
+				(SELECT sysname FROM results r2 WHERE r2.ip = r.ip ORDER BY seen_at LIMIT 1) AS sysname,
+				(SELECT ip_range FROM results r2 WHERE r2.ip = r.ip ORDER BY seen_at LIMIT 1) AS ip_range
+			FROM results r GROUP BY ip
+		) WHERE 1 = 1`+where+` ORDER BY first_seen, ip`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	fmt.Fprintln(w, "IP\tPRIMEIRA RESPOSTA\tSYSNAME\tRANGE")
+	for rows.Next() {
+		var ip, first, sysname, rng string
+		if err := rows.Scan(&ip, &first, &sysname, &rng); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ip, first, sysname, rng)
+	}
+	return rows.Err()
+}
+
+func historyTrends(db *sql.DB, w io.Writer, rng, since, until string) error {
+	where, args := periodFilter("r.started_at", since, until)
+	if rng != "" {
+		where += " AND rr.ip_range = ?"
+		args = append(args, rng)
+	}
+	rows, err := db.Query(`SELECT rr.ip_range, r.run_id, r.started_at, rr.targets, rr.alive, rr.snmp_ok
+		FROM run_ranges rr JOIN runs r ON r.id = rr.run
+		WHERE 1 = 1`+where+` ORDER BY rr.ip_range, r.started_at`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	fmt.Fprintln(w, "RANGE\tRUN\tINÍCIO\tALVOS\tRESPONDERAM\tSNMP OK")
+	for rows.Next() {
+		var rangeName, runID, started string
+		var targets, alive, snmpOK int
+		if err := rows.Scan(&rangeName, &runID, &started, &targets, &alive, &snmpOK); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\n", rangeName, runID, started, targets, alive, snmpOK)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"discoveryhosts/discovery"
+)
+
+// Hosts aguardando um on_discovered_command. Com a fila cheia o host é
+// descartado (e contado), para que hooks lentos não segurem o coletor.
+const hookQueue = 1000
+
+// Quanto da saída de um hook com falha entra no log.
+const hookOutputLimit = 512
+
+// Confere os comandos dos hooks e os limites de execução.
+func (c Config) validateHooks() []error {
+	var errs []error
+	for _, h := range []struct{ key, command string }{
+		{"on_discovered_command", c.OnDiscoveredCommand},
+		{"on_run_finished_command", c.OnRunFinishedCommand},
+	} {
+		if h.command == "" {
+			continue
+		}
+		if args, err := splitCommandLine(h.command); err != nil || len(args) == 0 {
+			errs = append(errs, fmt.Errorf("%s: comando inválido: %q%s", h.key, h.command, c.origin(h.key)))
+		}
+	}
+	if time.Duration(c.HookTimeout) <= 0 {
+		errs = append(errs, fmt.Errorf("hook_timeout deve ser positivo (atual: %s)%s", c.HookTimeout, c.origin("hook_timeout")))
+	}
+	if c.HookConcurrency < 1 {
+		errs = append(errs, fmt.Errorf("hook_concurrency deve ser no mínimo 1 (atual: %d)%s", c.HookConcurrency, c.origin("hook_concurrency")))
+	}
+	return errs
+}
+
+// Executa os hooks do run: on_discovered_command para cada host que
+// respondeu, por até hook_concurrency goroutines, e on_run_finished_command
+// no close, depois que a fila esvaziar. Falhas dos hooks só geram log e
+// contadores; não mudam o resultado dos hosts.
+type hookSink struct {
+	discovered []string
+	finished   []string
+	timeout    time.Duration
+	cfg        Config
+	runID      string
+	dryRun     bool
+
+	queue   chan discovery.HostResult
+	workers sync.WaitGroup
+	ran     atomic.Int32
+	failed  atomic.Int32
+	dropped int // só alterado pelo coletor
+}
+
+func newHookSink(cfg Config, runID string, dryRun bool) (*hookSink, error) {
+	h := &hookSink{timeout: time.Duration(cfg.HookTimeout), cfg: cfg, runID: runID, dryRun: dryRun}
+	var err error
+	if cfg.OnDiscoveredCommand != "" {
+		if h.discovered, err = splitCommandLine(cfg.OnDiscoveredCommand); err != nil {
+			return nil, fmt.Errorf("on_discovered_command: %w", err)
+		}
+		h.queue = make(chan discovery.HostResult, hookQueue)
+		for i := 0; i < cfg.HookConcurrency; i++ {
+			h.workers.Add(1)
+			go func() {
+				defer h.workers.Done()
+				for r := range h.queue {
+					h.runDiscovered(r)
+				}
+			}()
+		}
+	}
+	if cfg.OnRunFinishedCommand != "" {
+		if h.finished, err = splitCommandLine(cfg.OnRunFinishedCommand); err != nil {
+			return nil, fmt.Errorf("on_run_finished_command: %w", err)
+		}
+	}
+	return h, nil
+}
+
+func (h *hookSink) write(r discovery.HostResult) error {
+	if h.queue == nil {
+		return nil
+	}
+	select {
+	case h.queue <- r:
+	default:
+		h.dropped++
+		if h.dropped == 1 {
+			logWarn("hook.queue_full", hookQueue)
+		}
+	}
+	return nil
+}
+
+func (h *hookSink) close(sum discovery.Summary) error {
+	if h.queue != nil {
+		close(h.queue)
+		h.workers.Wait()
+	}
+	if h.finished != nil {
+		run := newJSONRun(sum, h.cfg, h.dryRun)
+		stdin, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		env := []string{
+			"DISCOVERY_RUN_ID=" + sum.RunID,
+			"DISCOVERY_TARGETS=" + strconv.Itoa(sum.TargetsExpanded),
+			"DISCOVERY_SCANNED=" + strconv.Itoa(sum.Scanned),
+			"DISCOVERY_ALIVE=" + strconv.Itoa(sum.Alive),
+			"DISCOVERY_SNMP_OK=" + strconv.Itoa(sum.SNMPOK),
+			"DISCOVERY_CREATED=" + strconv.Itoa(sum.HostsCreated),
+			"DISCOVERY_EXISTING=" + strconv.Itoa(sum.HostsExisting),
+			"DISCOVERY_ZABBIX_ERRORS=" + strconv.Itoa(sum.ZabbixErrors),
+			"DISCOVERY_DURATION_MS=" + strconv.FormatInt(sum.Elapsed().Milliseconds(), 10),
+			"DISCOVERY_PARTIAL=" + strconv.FormatBool(sum.Partial()),
+			"DISCOVERY_TRIGGER=" + sum.Trigger,
+			"DISCOVERY_DRY_RUN=" + strconv.FormatBool(h.dryRun),
+		}
+		if err := h.run(h.finished, env, stdin); err != nil {
+			h.failed.Add(1)
+			logWarn("hook.run_finished_failed", h.finished[0], err)
+		}
+	}
+	if ran := h.ran.Load(); ran > 0 || h.dropped > 0 {
+		logInfo("hook.stats", ran, h.failed.Load(), h.dropped)
+	}
+	return nil
+}
+
+// Executa o on_discovered_command de um host, com o resultado nas variáveis
+// DISCOVERY_* e em JSON (o mesmo do -output-json) na entrada padrão.
+func (h *hookSink) runDiscovered(r discovery.HostResult) {
+	stdin, err := json.Marshal(newJSONHost(r))
+	if err != nil {
+		return
+	}
+	var errText string
+	if err := r.Err(); err != nil {
+		errText = err.Error()
+	}
+	env := []string{
+		"DISCOVERY_RUN_ID=" + h.runID,
+		"DISCOVERY_IP=" + r.IP,
+		"DISCOVERY_RANGE=" + r.Range,
+		"DISCOVERY_SYSNAME=" + r.SNMP.SysName,
+		"DISCOVERY_SYSDESCR=" + r.SNMP.SysDescr,
+		"DISCOVERY_SNMP_OK=" + strconv.FormatBool(r.SNMPErr == nil),
+		"DISCOVERY_SNMP_VERSION=" + r.SNMP.Version,
+		"DISCOVERY_ACTION=" + r.ZabbixAction,
+		"DISCOVERY_HOSTID=" + r.HostID,
+		"DISCOVERY_ERROR=" + errText,
+		"DISCOVERY_AGENT=" + r.Agent,
+		"DISCOVERY_FALLBACK_NAME=" + r.FallbackName,
+		"DISCOVERY_OPEN_PORTS=" + joinPorts(r.OpenPorts, ","),
+		"DISCOVERY_TRIGGER=" + r.Trigger,
+		"DISCOVERY_DRY_RUN=" + strconv.FormatBool(h.dryRun),
+	}
+	hl := rootLog.With("ip", r.IP, "range", r.Range)
+	if err := h.run(h.discovered, env, stdin); err != nil {
+		h.failed.Add(1)
+		hl.WithErr(err).Warnf("hook.discovered_failed", h.discovered[0], r.IP, err)
+		return
+	}
+	hl.Debugf("hook.discovered_ok", h.discovered[0], r.IP)
+}
+
+// Executa o comando do hook com o timeout configurado. Sem shell: os
+// argumentos vêm de splitCommandLine.
+func (h *hookSink) run(args, env []string, stdin []byte) error {
+	h.ran.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Processos filhos que herdaram a saída não seguram o hook além do timeout
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("excedeu o timeout de %s", h.timeout)
+	}
+	if err == nil {
+		return nil
+	}
+	msg := strings.TrimSpace(output.String())
+	if len(msg) > hookOutputLimit {
+		msg = msg[:hookOutputLimit] + "..."
+	}
+	if msg != "" {
+		return fmt.Errorf("%v: %s", err, msg)
+	}
+	return err
+}
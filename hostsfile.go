@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+)
+
+// Formatos do -output-hosts.
+const (
+	hostsFormatHosts   = "hosts"
+	hostsFormatDnsmasq = "dnsmasq"
+)
+
+// Limites de nomes do RFC 1123.
+const (
+	maxLabelLen = 63
+	maxNameLen  = 253
+)
+
+type hostsEntry struct {
+	ip   netip.Addr
+	name string // nome completo, já com o domínio
+}
+
+// Grava no close um arquivo no formato hosts(5) com os hosts identificados
+// por SNMP: o sysName, com o domínio acrescentado se ele não tiver um,
+// resolve para o IP. Nomes inválidos são corrigidos pelo RFC 952/1123 e nomes
+// repetidos ganham um sufixo numérico ("sw-core-2"). O arquivo é trocado de uma vez, para que um
+// dnsmasq lendo o arquivo nunca veja uma versão pela metade.
+//
+// No formato hosts cada linha tem o nome completo e o curto, como alias; no
+// dnsmasq (addn-hosts) só o nome completo, ou só o curto sem domínio, que o
+// dnsmasq completa com expand-hosts e domain.
+type hostsFileSink struct {
+	path    string
+	format  string
+	domain  string
+	runID   string
+	entries []hostsEntry
+	names   map[string]bool
+}
+
+func newHostsFileSink(path, format, domain, runID string) *hostsFileSink {
+	return &hostsFileSink{path: path, format: format, domain: strings.Trim(strings.ToLower(domain), "."), runID: runID, names: map[string]bool{}}
+}
+
+func (s *hostsFileSink) write(r discovery.HostResult) error {
+	if r.SNMPErr != nil || r.SNMP.SysName == "" {
+		return nil
+	}
+	ip, err := netip.ParseAddr(r.IP)
+	if err != nil {
+		return nil
+	}
+	name := sanitizeHostname(r.SNMP.SysName)
+	if name == "" {
+		name = "host-" + strings.NewReplacer(".", "-", ":", "-").Replace(r.IP)
+	}
+	if s.domain != "" && !strings.Contains(name, ".") {
+		name += "." + s.domain
+	}
+	short, rest, _ := strings.Cut(name, ".")
+	for n := 2; s.names[name]; n++ {
+		name = short + "-" + strconv.Itoa(n)
+		if rest != "" {
+			name += "." + rest
+		}
+	}
+	s.names[name] = true
+	s.entries = append(s.entries, hostsEntry{ip: ip, name: name})
+	return nil
+}
+
+func (s *hostsFileSink) close(discovery.Summary) error {
+	sort.SliceStable(s.entries, func(i, j int) bool { return s.entries[i].ip.Less(s.entries[j].ip) })
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Gerado pelo discoveryhosts (run %s, %s); não edite\n", s.runID, time.Now().Format(time.RFC3339))
+	for _, e := range s.entries {
+		short, _, _ := strings.Cut(e.name, ".")
+		switch {
+		case s.format == hostsFormatDnsmasq:
+			fmt.Fprintf(&b, "%s %s\n", e.ip, e.name)
+		case short != e.name:
+			fmt.Fprintf(&b, "%s\t%s %s\n", e.ip, e.name, short)
+		default:
+			fmt.Fprintf(&b, "%s\t%s\n", e.ip, e.name)
+		}
+	}
+	if err := writeFileAtomic(s.path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("falha ao gravar %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Nome válido pelo RFC 952/1123: rótulos de letras minúsculas, dígitos e
+// hífens, sem hífen nas pontas, com até 63 caracteres cada e 253 no total.
+// Outros caracteres viram hífen; vazio se não sobrar nada.
+func sanitizeHostname(name string) string {
+	var labels []string
+	for _, label := range strings.Split(strings.ToLower(strings.TrimSpace(name)), ".") {
+		var b strings.Builder
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+				b.WriteRune(c)
+			default:
+				b.WriteByte('-')
+			}
+		}
+		l := strings.Trim(b.String(), "-")
+		for strings.Contains(l, "--") {
+			l = strings.ReplaceAll(l, "--", "-")
+		}
+		if len(l) > maxLabelLen {
+			l = strings.TrimRight(l[:maxLabelLen], "-")
+		}
+		if l != "" {
+			labels = append(labels, l)
+		}
+	}
+	full := strings.Join(labels, ".")
+	if len(full) > maxNameLen {
+		full = strings.TrimRight(full[:maxNameLen], "-.")
+	}
+	return full
+}
@@ -0,0 +1,84 @@
+// Package hosttrace leva pelo context o rastro detalhado de um host
+// (-debug-host): o comando do ping e a saída dele, os PDUs SNMP do gosnmp e as
+// chamadas à API do Zabbix. As credenciais registradas com Secret saem
+// mascaradas.
+package hosttrace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer escreve as linhas do rastro de um IP. Pode ser usado por vários
+// goroutines; os métodos aceitam um Tracer nil, que não escreve nada.
+type Tracer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	ip      string
+	secrets []string
+}
+
+// New cria o rastro de ip, escrito em w.
+func New(w io.Writer, ip string) *Tracer {
+	return &Tracer{w: w, ip: ip}
+}
+
+type ctxKey struct{}
+
+// With retorna um context que leva t às etapas do host.
+func With(ctx context.Context, t *Tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// From é o rastro levado por ctx; nil se o host não é rastreado.
+func From(ctx context.Context) *Tracer {
+	t, _ := ctx.Value(ctxKey{}).(*Tracer)
+	return t
+}
+
+// Secret registra um valor que não pode aparecer no rastro, como uma
+// community ou uma senha.
+func (t *Tracer) Secret(s string) {
+	if t == nil || s == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, v := range t.secrets {
+		if v == s {
+			return
+		}
+	}
+	t.secrets = append(t.secrets, s)
+}
+
+// Printf escreve uma linha do rastro, com a hora e o IP.
+func (t *Tracer) Printf(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	msg := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.secrets {
+		msg = strings.ReplaceAll(msg, s, "***")
+	}
+	var b strings.Builder
+	prefix := time.Now().Format("2006/01/02 15:04:05.000") + " [TRACE " + t.ip + "] "
+	for _, line := range strings.Split(msg, "\n") {
+		b.WriteString(prefix + line + "\n")
+	}
+	io.WriteString(t.w, b.String())
+}
+
+// Print é o Printf com os argumentos do fmt.Sprint, para o logger do gosnmp.
+func (t *Tracer) Print(args ...interface{}) {
+	t.Printf("%s", fmt.Sprint(args...))
+}
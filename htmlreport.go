@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/zabbix"
+)
+
+// Template padrão do --output-html; -html-template troca por outro arquivo
+// que recebe os mesmos dados (htmlReport).
+//
+//go:embed report.html.tmpl
+var defaultHTMLTemplate string
+
+// Dados passados ao template do relatório.
+type htmlReport struct {
+	Summary  discovery.Summary
+	Version  string
+	Build    buildInfo
+	DryRun   bool
+	Created  []htmlHost
+	Failures []htmlHost
+}
+
+type htmlHost struct {
+	IP       string
+	Range    string
+	SysName  string
+	HostID   string
+	Stage    string // snmp ou zabbix, para falhas
+	Reason   string
+	Error    string
+	Attempts int
+}
+
+var htmlFuncs = template.FuncMap{
+	"ms": func(d time.Duration) int64 { return d.Milliseconds() },
+	"round": func(d time.Duration) time.Duration {
+		return d.Round(time.Millisecond)
+	},
+	"pct": func(n, total int) string {
+		if total == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+	},
+}
+
+// Gera o relatório HTML ao fim do run, com os hosts criados e as falhas
+// coletados como um resultSink.
+type htmlSink struct {
+	path     string
+	tmpl     *template.Template
+	dryRun   bool
+	created  []htmlHost
+	failures []htmlHost
+}
+
+// O template é lido e validado já na criação, para que um template inválido
+// falhe antes do scan.
+func newHTMLSink(path, templatePath string, dryRun bool) (*htmlSink, error) {
+	name, text := "report.html.tmpl", defaultHTMLTemplate
+	if templatePath != "" {
+		data, err := ioutil.ReadFile(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao ler o template %s: %w", templatePath, err)
+		}
+		name, text = filepath.Base(templatePath), string(data)
+	}
+	tmpl, err := template.New(name).Funcs(htmlFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template HTML inválido: %w", err)
+	}
+	return &htmlSink{path: path, tmpl: tmpl, dryRun: dryRun}, nil
+}
+
+func (s *htmlSink) write(r discovery.HostResult) error {
+	h := htmlHost{IP: r.IP, Range: r.Range, SysName: r.SNMP.SysName, HostID: r.HostID, Attempts: r.Attempts}
+	switch {
+	case r.PingErr != nil:
+		h.Stage, h.Reason, h.Error = "ping", r.PingReason, r.PingErr.Error()
+		s.failures = append(s.failures, h)
+	case r.SNMPErr != nil:
+		h.Stage, h.Reason, h.Error = "snmp", r.SNMPReason, r.SNMPErr.Error()
+		s.failures = append(s.failures, h)
+	case r.ZabbixErr != nil:
+		h.Stage, h.Reason, h.Error = "zabbix", r.ZabbixAction, r.ZabbixErr.Error()
+		s.failures = append(s.failures, h)
+	case r.ZabbixAction == zabbix.Created:
+		s.created = append(s.created, h)
+	}
+	return nil
+}
+
+func (s *htmlSink) close(sum discovery.Summary) error {
+	var buf bytes.Buffer
+	err := s.tmpl.Execute(&buf, htmlReport{
+		Summary:  sum,
+		Version:  version,
+		Build:    currentBuild(),
+		DryRun:   s.dryRun,
+		Created:  s.created,
+		Failures: s.failures,
+	})
+	if err == nil {
+		err = writeFileAtomic(s.path, buf.Bytes(), 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("falha ao gravar %s: %w", s.path, err)
+	}
+	return nil
+}
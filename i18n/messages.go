@@ -0,0 +1,1302 @@
+// Package i18n guarda o catálogo das mensagens de log e do resumo, em
+// português e inglês, indexado por códigos estáveis.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Idiomas das mensagens
+const (
+	PT = "pt-BR"
+	EN = "en"
+)
+
+// Idioma das mensagens de log e do resumo; Set sobrescreve a detecção.
+var lang = Detect()
+
+// Detect escolhe o idioma pelas variáveis de ambiente de locale. Sem locale
+// definido (ou C/POSIX) mantém o português.
+func Detect() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := strings.ToLower(os.Getenv(name))
+		if v == "" {
+			continue
+		}
+		if strings.HasPrefix(v, "en") {
+			return EN
+		}
+		return PT
+	}
+	return PT
+}
+
+// Parse interpreta o nome de um idioma informado pelo usuário.
+func Parse(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "pt", "pt-br", "pt_br":
+		return PT, nil
+	case "en":
+		return EN, nil
+	}
+	return "", fmt.Errorf("idioma inválido: %s (use pt-BR ou en)", s)
+}
+
+// Set troca o idioma das mensagens. Deve ser chamado antes de iniciar os
+// goroutines que escrevem logs.
+func Set(l string) { lang = l }
+
+// Current é o idioma atual das mensagens.
+func Current() string { return lang }
+
+// T é o texto da mensagem no idioma atual. Códigos sem tradução caem no
+// português e, se desconhecidos, são usados como o próprio formato.
+func T(code string, args ...interface{}) string {
+	format := code
+	if m, ok := messages[code]; ok {
+		format = m[PT]
+		if t, ok := m[lang]; ok {
+			format = t
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Catálogo das mensagens por código. Os códigos são estáveis e saem no campo
+// code dos logs JSON, para que alertas não dependam do idioma.
+var messages = map[string]map[string]string{
+	"config.workers_high": {
+		PT: "workers=%d é muito alto; cada worker abre sockets e processos de ping simultâneos",
+		EN: "workers=%d is very high; each worker opens sockets and ping processes concurrently",
+	},
+	"config.workers_auto": {
+		PT: "workers não configurado, usando %d (%d por CPU, máximo %d)",
+		EN: "workers not set, using %d (%d per CPU, max %d)",
+	},
+	"config.merge_order": {
+		PT: "Ordem de merge da configuração: %s",
+		EN: "Configuration merge order: %s",
+	},
+	"self.interfaces_failed": {
+		PT: "Falha ao ler os endereços das interfaces locais: %v; os que não foram lidos continuam nos ranges",
+		EN: "Failed to read the local interface addresses: %v; the ones not read stay in the ranges",
+	},
+	"self.addresses": {
+		PT: "Endereços do próprio scanner, fora dos ranges: %s",
+		EN: "Scanner's own addresses, left out of the ranges: %s",
+	},
+	"config.insecure_permissions": {
+		PT: "%s tem permissão %04o e pode ser lido pelo grupo ou por outros usuários, com as credenciais dele; use chmod 600 (ou strict_permissions para recusar o arquivo)",
+		EN: "%s has mode %04o and can be read by its group or other users, credentials included; use chmod 600 (or strict_permissions to refuse the file)",
+	},
+	"config.plain_zabbix_pass": {
+		PT: "%s contém zabbix_pass mesmo com secrets_file configurado; mova para %s",
+		EN: "%s contains zabbix_pass even though secrets_file is set; move it to %s",
+	},
+	"config.plain_snmp_communities": {
+		PT: "%s contém snmp_communities mesmo com secrets_file configurado; mova para %s",
+		EN: "%s contains snmp_communities even though secrets_file is set; move it to %s",
+	},
+	"config.loading_secrets": {
+		PT: "Carregando credenciais de: %s",
+		EN: "Loading credentials from: %s",
+	},
+	"config.unknown_keys_ignored": {
+		PT: "Ignorando chaves desconhecidas em %s: %s",
+		EN: "Ignoring unknown keys in %s: %s",
+	},
+	"config.include_repeated": {
+		PT: "%s já foi carregado, ignorando include repetido",
+		EN: "%s was already loaded, ignoring repeated include",
+	},
+	"config.loading": {
+		PT: "Carregando arquivo de configuração: %s (%s)",
+		EN: "Loading configuration file: %s (%s)",
+	},
+	"config.profile_applied": {
+		PT: "Aplicando perfil %s",
+		EN: "Applying profile %s",
+	},
+	"report.result_write_failed": {
+		PT: "Falha ao gravar resultado de %s: %v",
+		EN: "Failed to write result for %s: %v",
+	},
+	"report.close_failed": {
+		PT: "%v",
+		EN: "%v",
+	},
+	"ping.testing": {
+		PT: "Testando IP %s",
+		EN: "Testing IP %s",
+	},
+	"ping.alive": {
+		PT: "IP %s respondeu",
+		EN: "IP %s answered",
+	},
+	"ping.dead": {
+		PT: "IP %s não respondeu",
+		EN: "IP %s did not answer",
+	},
+	"snmp.connecting": {
+		PT: "Conectando ao host %s",
+		EN: "Connecting to host %s",
+	},
+	"snmp.connect_failed": {
+		PT: "Falha ao conectar em %s: %v",
+		EN: "Failed to connect to %s: %v",
+	},
+	"snmp.query_failed": {
+		PT: "Falha na consulta em %s: %v",
+		EN: "Query failed on %s: %v",
+	},
+	"snmp.no_string": {
+		PT: "OID não retornou string em %s",
+		EN: "OID did not return a string on %s",
+	},
+	"snmp.sysname": {
+		PT: "Host %s respondeu sysName: %s",
+		EN: "Host %s answered sysName: %s",
+	},
+	"zabbix.ensuring": {
+		PT: "Criando/verificando host %s (%s) nos grupos %s via proxy %s",
+		EN: "Creating/checking host %s (%s) in groups %s via proxy %s",
+	},
+	"backend.ensuring": {
+		PT: "Criando/verificando host %s (%s) no backend %s",
+		EN: "Creating/checking host %s (%s) in backend %s",
+	},
+	"log.host": {
+		PT: "Backend log: host %s (%s) do range %s seria cadastrado (interface %s, serviços: %s)",
+		EN: "Log backend: host %s (%s) from range %s would be registered (interface %s, services: %s)",
+	},
+	"zabbix.create_failed": {
+		PT: "Falha ao cadastrar %s (%s) no Zabbix: %v",
+		EN: "Failed to register %s (%s) in Zabbix: %v",
+	},
+	"zabbix.target_create_failed": {
+		PT: "Falha ao cadastrar %s (%s) em %s: %v",
+		EN: "Failed to register %s (%s) in %s: %v",
+	},
+	"zabbix.name_sanitized": {
+		PT: "Host %s: o nome %q tem caracteres que o Zabbix recusa; cadastrado como %q, com o original no nome visível",
+		EN: "Host %s: name %q has characters Zabbix rejects; registered as %q, with the original as the visible name",
+	},
+	"zabbix.exists": {
+		PT: "Host %s já existe (hostid %s)",
+		EN: "Host %s already exists (hostid %s)",
+	},
+	"zabbix.created": {
+		PT: "Host %s criado (hostid %s)",
+		EN: "Host %s created (hostid %s)",
+	},
+	"zabbix.upgraded": {
+		PT: "Host %s cadastrado antes sem SNMP foi atualizado para SNMP (hostid %s)",
+		EN: "Host %s previously registered without SNMP was upgraded to SNMP (hostid %s)",
+	},
+	"fallback.named": {
+		PT: "Sem SNMP em %s: cadastrando como %s",
+		EN: "No SNMP on %s: registering as %s",
+	},
+	"fallback.no_ptr": {
+		PT: "Sem registro PTR para %s: %v",
+		EN: "No PTR record for %s: %v",
+	},
+	"snmp.failed_after_ping": {
+		PT: "Ping OK mas falha SNMP em %s: %v",
+		EN: "Ping OK but SNMP failed on %s: %v",
+	},
+	"zabbix.dry_run": {
+		PT: "Dry-run: host %s (%s) não foi cadastrado",
+		EN: "Dry-run: host %s (%s) was not registered",
+	},
+	"init.written": {
+		PT: "Configuração inicial escrita em %s (%s)",
+		EN: "Starter configuration written to %s (%s)",
+	},
+	"log.file_failed": {
+		PT: "%v; continuando apenas na saída de erro",
+		EN: "%v; continuing on stderr only",
+	},
+	"log.file_active": {
+		PT: "Gravando logs em %s (rotação a cada %d MB, %d backups)",
+		EN: "Writing logs to %s (rotating every %d MB, %d backups)",
+	},
+	"log.syslog_failed": {
+		PT: "%v; continuando sem syslog",
+		EN: "%v; continuing without syslog",
+	},
+	"log.syslog_active": {
+		PT: "Enviando logs ao syslog (facility %s)",
+		EN: "Sending logs to syslog (facility %s)",
+	},
+	"build.info": {
+		PT: "Build: %v",
+		EN: "Build: %v",
+	},
+	"cli.no_subcommand": {
+		PT: "Executando o scan sem subcomando: essa forma será removida; use discoveryhosts scan",
+		EN: "Running the scan without a subcommand: this form will be removed; use discoveryhosts scan",
+	},
+	"confirm.accepted": {
+		PT: "Cadastro de %d host(s) confirmado",
+		EN: "Registration of %d host(s) confirmed",
+	},
+	"confirm.declined": {
+		PT: "Cadastro de %d host(s) recusado: nada foi cadastrado; os relatórios são gravados mesmo assim",
+		EN: "Registration of %d host(s) declined: nothing was registered; reports are still written",
+	},
+	"config.loaded": {
+		PT: "Configuração carregada com sucesso: %v",
+		EN: "Configuration loaded successfully: %v",
+	},
+	"run.start": {
+		PT: "Iniciando discovery (run %s)...",
+		EN: "Starting discovery (run %s)...",
+	},
+	"run.no_targets": {
+		PT: "Run cancelado antes do ping: %v",
+		EN: "Run cancelled before ping: %v",
+	},
+	"run.finished": {
+		PT: "Discovery finalizado!",
+		EN: "Discovery finished!",
+	},
+	"notify.skipped": {
+		PT: "Nenhum host criado, notificação não enviada",
+		EN: "No hosts created, notification not sent",
+	},
+	"grafana.skipped": {
+		PT: "Nenhum host criado ou sumido, anotação do Grafana não criada",
+		EN: "No hosts created or missing, Grafana annotation not created",
+	},
+	"grafana.sent": {
+		PT: "Anotação do run criada no Grafana %s",
+		EN: "Run annotation created in Grafana %s",
+	},
+	"grafana.failed": {
+		PT: "Falha ao criar a anotação no Grafana %s: %v",
+		EN: "Failed to create the annotation in Grafana %s: %v",
+	},
+	"grafana.text": {
+		PT: "Discovery %s: %d hosts criados (%d responderam, %d com SNMP)",
+		EN: "Discovery %s: %d hosts created (%d answered, %d with SNMP)",
+	},
+	"grafana.text_missing": {
+		PT: "%d sumiram desde o run anterior",
+		EN: "%d missing since the previous run",
+	},
+	"grafana.text_errors": {
+		PT: "%d erros no cadastro",
+		EN: "%d registration errors",
+	},
+	"notify.sent": {
+		PT: "Notificação enviada",
+		EN: "Notification sent",
+	},
+	"notify.retry": {
+		PT: "Falha ao enviar notificação (tentativa %d de %d): %v",
+		EN: "Failed to send notification (attempt %d of %d): %v",
+	},
+	"notify.failed": {
+		PT: "Notificação não entregue após %d tentativas: %v",
+		EN: "Notification not delivered after %d attempts: %v",
+	},
+	"run.progress": {
+		PT: "Progresso: %s",
+		EN: "Progress: %s",
+	},
+	"config.remote_not_modified": {
+		PT: "Configuração remota %s não mudou desde %s, usando cópia em cache",
+		EN: "Remote configuration %s unchanged since %s, using cached copy",
+	},
+	"config.remote_fallback": {
+		PT: "Falha ao buscar configuração em %s: %v; usando cópia em cache de %s",
+		EN: "Failed to fetch configuration from %s: %v; using cached copy from %s",
+	},
+	"config.cache_dir_failed": {
+		PT: "Falha ao criar diretório de cache %s: %v",
+		EN: "Failed to create cache directory %s: %v",
+	},
+	"config.cache_write_failed": {
+		PT: "Falha ao gravar cache da configuração remota: %v",
+		EN: "Failed to write remote configuration cache: %v",
+	},
+	"config.legacy_schema": {
+		PT: "%s usa o esquema de configuração versão %d (atual: %d); atualize as chaves: %s, ou rode \"discoveryhosts migrate-config %s\"",
+		EN: "%s uses configuration schema version %d (current: %d); update the keys: %s, or run \"discoveryhosts migrate-config %s\"",
+	},
+	"migrate.up_to_date": {
+		PT: "%s já está na versão %d do esquema",
+		EN: "%s is already at schema version %d",
+	},
+	"migrate.done": {
+		PT: "%s migrado da versão %d para %d (original em %s.bak); chaves alteradas: %s",
+		EN: "%s migrated from version %d to %d (original in %s.bak); changed keys: %s",
+	},
+	"migrate.comments_lost": {
+		PT: "Comentários do arquivo original não são preservados; confira %s.bak",
+		EN: "Comments in the original file are not preserved; check %s.bak",
+	},
+	"migrate.order_lost": {
+		PT: "A ordem das chaves do original não é preservada: o arquivo é regravado com as chaves ordenadas; confira %s.bak",
+		EN: "The original key order is not preserved: the file is rewritten with sorted keys; check %s.bak",
+	},
+	"summary.targets": {
+		PT: "Alvos: %d expandidos, %d excluídos, %d verificados",
+		EN: "Targets: %d expanded, %d excluded, %d scanned",
+	},
+	"summary.invalid_targets": {
+		PT: "Alvos inválidos: %d descartados sem ping (não são um endereço IP)",
+		EN: "Invalid targets: %d dropped without ping (not an IP address)",
+	},
+	"summary.self_targets": {
+		PT: "Alvos do próprio scanner: %d IPs das interfaces locais ou de loopback fora do scan (include_self para varrê-los)",
+		EN: "Scanner's own targets: %d local interface or loopback IPs left out of the scan (include_self to scan them)",
+	},
+	"summary.duplicate_targets": {
+		PT: "Alvos duplicados: %d IPs repetidos nos ranges, processados uma vez só",
+		EN: "Duplicate targets: %d IPs repeated across ranges, processed only once",
+	},
+	"summary.ping": {
+		PT: "Ping: %d responderam",
+		EN: "Ping: %d answered",
+	},
+	"summary.ping_failures": {
+		PT: "Ping: %d host(s) não testados por falha do próprio ping (%s)",
+		EN: "Ping: %d host(s) not tested because ping itself failed (%s)",
+	},
+	"summary.snmp": {
+		PT: "SNMP: %d sucesso, %s",
+		EN: "SNMP: %d succeeded, %s",
+	},
+	"summary.zabbix_dry_run": {
+		PT: "Zabbix: dry-run, %d host(s) não cadastrados",
+		EN: "Zabbix: dry-run, %d host(s) not registered",
+	},
+	"summary.zabbix": {
+		PT: "Zabbix: %d criados, %d já existentes, %d erros",
+		EN: "Zabbix: %d created, %d already existing, %d errors",
+	},
+	"summary.time": {
+		PT: "Tempo: total %s; ping %s, SNMP %s, Zabbix %s (somados entre os workers)",
+		EN: "Time: total %s; ping %s, SNMP %s, Zabbix %s (summed across workers)",
+	},
+	"summary.deadline": {
+		PT: "Run cortado pelo max_run_duration: %d de %d alvo(s) não verificados",
+		EN: "Run cut by max_run_duration: %d of %d target(s) not scanned",
+	},
+	"summary.timed_out": {
+		PT: "Prazo por host esgotado em %d host(s)",
+		EN: "Per-host deadline exceeded on %d host(s)",
+	},
+	"run.deadline_reached": {
+		PT: "max_run_duration (%s) atingido; nenhum IP novo será iniciado, aguardando os hosts em andamento",
+		EN: "max_run_duration (%s) reached; no new IPs will be started, waiting for in-flight hosts",
+	},
+	"host.timeout": {
+		PT: "Prazo do host %s (%s) esgotado na etapa %s",
+		EN: "Deadline for host %s (%s) exceeded in stage %s",
+	},
+	"summary.retries": {
+		PT: "Retentativas: %d host(s) repetidos, %d recuperados",
+		EN: "Retries: %d host(s) retried, %d recovered",
+	},
+	"retry.round": {
+		PT: "Rodada %d de retentativas: %d host(s) com falha passageira, aguardando %s",
+		EN: "Retry round %d: %d host(s) with transient failures, waiting %s",
+	},
+	"retry.queued": {
+		PT: "Falha passageira em %s (tentativa %d de %d); será repetido",
+		EN: "Transient failure on %s (attempt %d of %d); will be retried",
+	},
+	"retry.queue_full": {
+		PT: "Fila de retentativas cheia (%[2]d); falha de %[1]s não será repetida",
+		EN: "Retry queue full (%[2]d); failure on %[1]s will not be retried",
+	},
+	"summary.concurrency": {
+		PT: "Workers ativos no %s: %s; pico %d",
+		EN: "Active workers in %s: %s; peak %d",
+	},
+	"adaptive.backoff": {
+		PT: "Etapa %s: workers %d -> %d; %d de %d hosts com falha na janela (%.0f%%, base %.0f%%)",
+		EN: "Stage %s: workers %d -> %d; %d of %d hosts failed in the window (%.0f%%, baseline %.0f%%)",
+	},
+	"adaptive.rampup": {
+		PT: "Etapa %s: workers %d -> %d; %d de %d hosts com falha na janela (%.0f%%)",
+		EN: "Stage %s: workers %d -> %d; %d of %d hosts failed in the window (%.0f%%)",
+	},
+	"summary.panics": {
+		PT: "Erros internos: %d panic(s) recuperados; veja o stack no log",
+		EN: "Internal errors: %d panic(s) recovered; see the stack in the log",
+	},
+	"summary.aborted": {
+		PT: "Run abortado (%s); os hosts restantes não foram verificados",
+		EN: "Run aborted (%s); the remaining hosts were not scanned",
+	},
+	"worker.panic": {
+		PT: "Panic ao processar %s na etapa %s: %v",
+		EN: "Panic while processing %s in stage %s: %v",
+	},
+	"run.fatal": {
+		PT: "Erro fatal, abortando o run: %v",
+		EN: "Fatal error, aborting the run: %v",
+	},
+	"run.too_many_panics": {
+		PT: "%d panics recuperados (limite %d); abortando o run",
+		EN: "%d panics recovered (limit %d); aborting the run",
+	},
+	"phpipam.ranges": {
+		PT: "phpIPAM: %d range(s) somados aos da configuração (seções: %s; %d endereços reservados fora do scan)",
+		EN: "phpIPAM: %d range(s) added to the configured ones (sections: %s; %d reserved addresses left out of the scan)",
+	},
+	"phpipam.failed": {
+		PT: "phpIPAM: falha ao ler os ranges de %s: %v; seguindo com os %d range(s) da configuração",
+		EN: "phpIPAM: failed to read the ranges from %s: %v; continuing with the %d configured range(s)",
+	},
+	"librenms.zabbix_ignored": {
+		PT: "Backend librenms ativo: %s ignorados",
+		EN: "librenms backend enabled: %s ignored",
+	},
+	"icinga2.zabbix_ignored": {
+		PT: "Backend icinga2 ativo: %s ignorados",
+		EN: "icinga2 backend enabled: %s ignored",
+	},
+	"summary.zabbix_target": {
+		PT: "Cadastro em %s: %d criados, %d já existentes, %d atualizados, %d erros",
+		EN: "Registration in %s: %d created, %d already existing, %d upgraded, %d errors",
+	},
+	"summary.target_dry_run": {
+		PT: "Cadastro em %s: %d hosts só registrados no log",
+		EN: "Registration in %s: %d hosts only logged",
+	},
+	"summary.zabbix_partial": {
+		PT: "Zabbix: %d host(s) cadastrados em só parte dos servidores (veja zabbix_targets no relatório)",
+		EN: "Zabbix: %d host(s) registered in only some of the servers (see zabbix_targets in the report)",
+	},
+	"summary.agent": {
+		PT: "Agente %s: %d/%d IPs entregues (%s)",
+		EN: "Agent %s: %d/%d IPs delivered (%s)",
+	},
+	"summary.agent_failed": {
+		PT: "Agente %s falhou com %d/%d IPs entregues; os demais não foram verificados: %s",
+		EN: "Agent %s failed with %d/%d IPs delivered; the rest were not scanned: %s",
+	},
+	"agent.dispatch": {
+		PT: "Enviando %d range(s) ao agente %s (%d IPs)",
+		EN: "Sending %d range(s) to agent %s (%d IPs)",
+	},
+	"agent.done": {
+		PT: "Agente %s concluiu: %d de %d IPs",
+		EN: "Agent %s finished: %d of %d IPs",
+	},
+	"agent.failed": {
+		PT: "Agente %s falhou: %v; %d IP(s) atribuídos a ele não foram verificados",
+		EN: "Agent %s failed: %v; %d IP(s) assigned to it were not scanned",
+	},
+	"agent.unexpected_host": {
+		PT: "Agente %s entregou %s (range %s), que não foi atribuído a ele ou já foi concluído; ignorado",
+		EN: "Agent %s delivered %s (range %s), which was not assigned to it or is already done; ignored",
+	},
+	"agent.listening": {
+		PT: "Modo agente: escutando em %s (%s)",
+		EN: "Agent mode: listening on %s (%s)",
+	},
+	"agent.listening_plain": {
+		PT: "Modo agente: escutando em %s sem TLS; o token e as communities trafegam em texto puro (defina agent.tls_cert e agent.tls_key)",
+		EN: "Agent mode: listening on %s without TLS; the token and communities travel in plain text (set agent.tls_cert and agent.tls_key)",
+	},
+	"agent.unauthorized": {
+		PT: "Pedido de scan de %s recusado: token inválido",
+		EN: "Scan request from %s rejected: invalid token",
+	},
+	"agent.busy": {
+		PT: "Pedido de scan de %s (run %s) recusado: outro scan em andamento",
+		EN: "Scan request from %s (run %s) rejected: another scan in progress",
+	},
+	"agent.scan_start": {
+		PT: "Scan recebido de %s (run %s): %d range(s)",
+		EN: "Scan received from %s (run %s): %d range(s)",
+	},
+	"agent.scan_done": {
+		PT: "Scan do run %s concluído: %d IPs em %s",
+		EN: "Scan for run %s finished: %d IPs in %s",
+	},
+	"agent.scan_failed": {
+		PT: "Scan do run %s falhou: %v",
+		EN: "Scan for run %s failed: %v",
+	},
+	"agent.stopping": {
+		PT: "Modo agente encerrando",
+		EN: "Agent mode shutting down",
+	},
+	"api.listening": {
+		PT: "Modo servidor: API escutando em %s (%s)",
+		EN: "Server mode: API listening on %s (%s)",
+	},
+	"api.listening_plain": {
+		PT: "Modo servidor: API escutando em %s sem TLS; o token trafega em texto puro (defina api.tls_cert e api.tls_key)",
+		EN: "Server mode: API listening on %s without TLS; the token travels in plain text (set api.tls_cert and api.tls_key)",
+	},
+	"api.unauthorized": {
+		PT: "Pedido de %s recusado (%s %s): token inválido",
+		EN: "Request from %s rejected (%s %s): invalid token",
+	},
+	"api.scan_start": {
+		PT: "Scan %s iniciado por %s: %s",
+		EN: "Scan %s started by %s: %s",
+	},
+	"api.scan_done": {
+		PT: "Scan %s concluído: %d verificados, %d responderam, %d criados em %s",
+		EN: "Scan %s finished: %d scanned, %d answered, %d created in %s",
+	},
+	"api.scan_failed": {
+		PT: "Scan %s falhou: %v",
+		EN: "Scan %s failed: %v",
+	},
+	"api.scan_cancel": {
+		PT: "Scan %s cancelado por %s",
+		EN: "Scan %s cancelled by %s",
+	},
+	"api.stopping": {
+		PT: "Modo servidor encerrando; aguardando os scans em andamento",
+		EN: "Server mode shutting down; waiting for running scans",
+	},
+	"hook.discovered_failed": {
+		PT: "Hook %s falhou para %s: %v",
+		EN: "Hook %s failed for %s: %v",
+	},
+	"hook.discovered_ok": {
+		PT: "Hook %s executado para %s",
+		EN: "Hook %s ran for %s",
+	},
+	"hook.run_finished_failed": {
+		PT: "Hook de fim de run %s falhou: %v",
+		EN: "Run-finished hook %s failed: %v",
+	},
+	"hook.queue_full": {
+		PT: "Fila do on_discovered_command cheia (%d hosts); os próximos hosts ficam sem hook enquanto ela não esvaziar",
+		EN: "on_discovered_command queue full (%d hosts); further hosts skip the hook until it drains",
+	},
+	"hook.stats": {
+		PT: "Hooks: %d execuções, %d com falha, %d host(s) descartados com a fila cheia",
+		EN: "Hooks: %d runs, %d failed, %d host(s) dropped with the queue full",
+	},
+	"summary.stage": {
+		PT: "Etapa %s: %d workers, %d processados, %d erros, %.1f hosts/s, %.0f%% ocupada",
+		EN: "Stage %s: %d workers, %d processed, %d errors, %.1f hosts/s, %.0f%% busy",
+	},
+	"summary.fallback": {
+		PT: "Sem SNMP: %d host(s) cadastrados pelo nome DNS, %d atualizados para SNMP",
+		EN: "Without SNMP: %d host(s) registered by DNS name, %d upgraded to SNMP",
+	},
+	"summary.portscan": {
+		PT: "Portas: %d host(s) varridos; abertas: %s",
+		EN: "Ports: %d host(s) scanned; open: %s",
+	},
+	"summary.portscan_none": {
+		PT: "nenhuma",
+		EN: "none",
+	},
+	"portscan.enabled": {
+		PT: "Varredura de portas ativa em %d range(s): portas %s, até %d conexões simultâneas e %d/s",
+		EN: "Port scan enabled on %d range(s): ports %s, up to %d concurrent connections and %d/s",
+	},
+	"portscan.done": {
+		PT: "Varredura de %s: %d porta(s) verificadas, abertas: %s",
+		EN: "Scan of %s: %d port(s) checked, open: %s",
+	},
+	"summary.cached": {
+		PT: "Cache: %d host(s) responderam e vieram do cache, sem SNMP nem cadastro",
+		EN: "Cache: %d host(s) answered and came from the cache, without SNMP or registration",
+	},
+	"cache.hit": {
+		PT: "%s no cache (%s, hostid %s); SNMP e cadastro pulados",
+		EN: "%s is cached (%s, hostid %s); skipping SNMP and registration",
+	},
+	"known.loaded": {
+		PT: "Hosts conhecidos: %d entradas de %s (regras: %s)",
+		EN: "Known hosts: %d entries from %s (rules: %s)",
+	},
+	"known.invalid_row": {
+		PT: "Hosts conhecidos: %s: %v; linha ignorada",
+		EN: "Known hosts: %s: %v; row ignored",
+	},
+	"known.skipped": {
+		PT: "Host %s (%s) já conhecido por %s; não cadastrado",
+		EN: "Host %s (%s) already known by %s; not registered",
+	},
+	"filter.enabled": {
+		PT: "Filtro: só os hosts com %v são cadastrados e relatados",
+		EN: "Filter: only hosts with %v are registered and reported",
+	},
+	"filter.skipped": {
+		PT: "Host %s (%s) não casa com o filtro; não cadastrado",
+		EN: "Host %s (%s) does not match the filter; not registered",
+	},
+	"debug.enabled": {
+		PT: "Rastro detalhado dos hosts %v em %s",
+		EN: "Detailed trace of hosts %v to %s",
+	},
+	"debug.file_failed": {
+		PT: "Falha ao abrir o rastro %s (%v); usando a saída de erro",
+		EN: "Failed to open trace %s (%v); using stderr",
+	},
+	"lock.busy": {
+		PT: "Outra instância já está em execução, saindo: lock %v",
+		EN: "Another instance is already running, exiting: lock %v",
+	},
+	"lock.stale": {
+		PT: "Lock %s deixado por um run que não terminou normalmente (%s); assumindo",
+		EN: "Lock %s left by a run that did not finish cleanly (%s); taking over",
+	},
+	"retry.loaded": {
+		PT: "Relatório %s (run %s): %d host(s) a refazer (%s), %d mantidos sem mudança",
+		EN: "Report %s (run %s): %d host(s) to retry (%s), %d kept unchanged",
+	},
+	"limit.reached": {
+		PT: "Limite de %d hosts criados no run atingido; os demais são descobertos sem cadastro",
+		EN: "Limit of %d hosts created per run reached; remaining hosts are discovered without registration",
+	},
+	"limit.skipped": {
+		PT: "Host %s (%s) não cadastrado: limite de %d hosts criados no run atingido",
+		EN: "Host %s (%s) not registered: limit of %d hosts created per run reached",
+	},
+	"cache.loaded": {
+		PT: "Cache: %d host(s) de %s processados há menos de %s só farão o ping",
+		EN: "Cache: %d host(s) from %s processed within %s will only be pinged",
+	},
+	"cache.none": {
+		PT: "Cache %s ainda não existe; run completo",
+		EN: "Cache %s does not exist yet; full run",
+	},
+	"cache.unusable": {
+		PT: "Cache %s ignorado (%v); run completo",
+		EN: "Cache %s ignored (%v); full run",
+	},
+	"cache.invalidated": {
+		PT: "Cache %s descartado: communities, grupos, proxy ou URL do Zabbix mudaram; run completo",
+		EN: "Cache %s discarded: communities, groups, proxy or Zabbix URL changed; full run",
+	},
+	"summary.zabbix_skipped": {
+		PT: "Zabbix: %d host(s) identificados sem cadastro direto (fora dos backends ou enviados por LLD)",
+		EN: "Zabbix: %d identified host(s) not registered directly (not a backend or sent via LLD)",
+	},
+	"summary.known": {
+		PT: "Zabbix: %d host(s) já conhecidos (known_hosts_file) não cadastrados",
+		EN: "Zabbix: %d already known host(s) (known_hosts_file) not registered",
+	},
+	"summary.limit_reached": {
+		PT: "Zabbix: limite de %d hosts criados atingido; %d host(s) identificados ficaram sem cadastro (a rede tem mais hosts do que os criados)",
+		EN: "Zabbix: limit of %d hosts created reached; %d identified host(s) left unregistered (the network has more hosts than were created)",
+	},
+	"summary.filtered": {
+		PT: "Zabbix: %d host(s) identificados fora do filtro (-match-sysname/-match-sysdescr) não cadastrados",
+		EN: "Zabbix: %d identified host(s) outside the filter (-match-sysname/-match-sysdescr) not registered",
+	},
+	"summary.netbox": {
+		PT: "NetBox: %d IPs criados, %d atualizados, %d sem mudança, %d conflitos, %d erros; %d devices criados",
+		EN: "NetBox: %d IPs created, %d updated, %d unchanged, %d conflicts, %d errors; %d devices created",
+	},
+	"netbox.conflict": {
+		PT: "NetBox: IP %s já atribuído a %s; não alterado",
+		EN: "NetBox: IP %s already assigned to %s; left untouched",
+	},
+	"netbox.ip_failed": {
+		PT: "Falha ao gravar o IP %s no NetBox: %v",
+		EN: "Failed to write IP %s to NetBox: %v",
+	},
+	"netbox.ip_synced": {
+		PT: "NetBox: IP %s %s (id %d)",
+		EN: "NetBox: IP %s %s (id %d)",
+	},
+	"netbox.device_failed": {
+		PT: "Falha ao criar o device %s (%s) no NetBox: %v",
+		EN: "Failed to create device %s (%s) in NetBox: %v",
+	},
+	"netbox.device_created": {
+		PT: "NetBox: device %s criado (%s, id %d)",
+		EN: "NetBox: device %s created (%s, id %d)",
+	},
+	"netbox.queue_full": {
+		PT: "Fila do NetBox cheia (%d hosts); os próximos hosts não serão gravados enquanto ela não esvaziar",
+		EN: "NetBox queue full (%d hosts); further hosts are skipped until it drains",
+	},
+	"netbox.dropped": {
+		PT: "NetBox: %d host(s) descartados com a fila cheia",
+		EN: "NetBox: %d host(s) dropped with the queue full",
+	},
+	"summary.mqtt": {
+		PT: "MQTT: %d eventos publicados em %s",
+		EN: "MQTT: %d events published to %s",
+	},
+	"mqtt.connected": {
+		PT: "MQTT: conectado a %s (client id %s)",
+		EN: "MQTT: connected to %s (client id %s)",
+	},
+	"mqtt.reconnected": {
+		PT: "MQTT: reconectado a %s",
+		EN: "MQTT: reconnected to %s",
+	},
+	"mqtt.connect_failed": {
+		PT: "MQTT: falha ao conectar a %s: %v; nova tentativa em %s",
+		EN: "MQTT: failed to connect to %s: %v; retrying in %s",
+	},
+	"mqtt.connection_lost": {
+		PT: "MQTT: conexão com %s perdida: %v",
+		EN: "MQTT: connection to %s lost: %v",
+	},
+	"mqtt.publish_failed": {
+		PT: "MQTT: falha ao publicar em %s: %v; o evento será publicado de novo após reconectar",
+		EN: "MQTT: failed to publish to %s: %v; the event will be republished after reconnecting",
+	},
+	"mqtt.queue_full": {
+		PT: "MQTT: buffer cheio (%d eventos); os próximos eventos serão descartados enquanto o broker não os receber",
+		EN: "MQTT: buffer full (%d events); further events are dropped until the broker catches up",
+	},
+	"mqtt.shutdown_timeout": {
+		PT: "MQTT: eventos pendentes não publicados em %s; desistindo do broker",
+		EN: "MQTT: pending events not published within %s; giving up on the broker",
+	},
+	"mqtt.dropped": {
+		PT: "MQTT: %d evento(s) descartados",
+		EN: "MQTT: %d event(s) dropped",
+	},
+	"summary.kafka": {
+		PT: "Kafka: %d mensagens entregues em %s (%d falhas de envio, %d descartadas)",
+		EN: "Kafka: %d messages delivered to %s (%d send failures, %d dropped)",
+	},
+	"kafka.produce_failed": {
+		PT: "Kafka: %d mensagem(ns) não entregues: %v; nova tentativa em %s",
+		EN: "Kafka: %d message(s) not delivered: %v; retrying in %s",
+	},
+	"kafka.recovered": {
+		PT: "Kafka: entregas retomadas em %s",
+		EN: "Kafka: deliveries resumed to %s",
+	},
+	"kafka.queue_full": {
+		PT: "Kafka: buffer cheio (%d mensagens); as próximas serão descartadas enquanto os brokers não as receberem",
+		EN: "Kafka: buffer full (%d messages); further messages are dropped until the brokers catch up",
+	},
+	"kafka.shutdown_timeout": {
+		PT: "Kafka: mensagens pendentes não entregues em %s; desistindo dos brokers",
+		EN: "Kafka: pending messages not delivered within %s; giving up on the brokers",
+	},
+	"kafka.dropped": {
+		PT: "Kafka: %d mensagem(ns) descartadas",
+		EN: "Kafka: %d message(s) dropped",
+	},
+	"summary.webhook": {
+		PT: "Webhook: %d hosts enviados, %d erros (%d requisições)",
+		EN: "Webhook: %d hosts sent, %d errors (%d requests)",
+	},
+	"webhook.sent": {
+		PT: "Webhook: host %s enviado",
+		EN: "Webhook: host %s sent",
+	},
+	"webhook.failed": {
+		PT: "Falha ao enviar o host %s ao webhook: %v",
+		EN: "Failed to send host %s to the webhook: %v",
+	},
+	"webhook.document_failed": {
+		PT: "Falha ao gerar o documento do host %s para o webhook: %v",
+		EN: "Failed to build the webhook document for host %s: %v",
+	},
+	"webhook.retry": {
+		PT: "Webhook: lote de %d host(s) sem sucesso (tentativa %d de %d novas): %v",
+		EN: "Webhook: batch of %d host(s) failed (retry %d of %d): %v",
+	},
+	"webhook.queue_full": {
+		PT: "Fila do webhook cheia (%d lotes); os próximos hosts não serão enviados enquanto ela não esvaziar",
+		EN: "Webhook queue full (%d batches); further hosts are skipped until it drains",
+	},
+	"webhook.dropped": {
+		PT: "Webhook: %d host(s) descartados com a fila cheia",
+		EN: "Webhook: %d host(s) dropped with the queue full",
+	},
+	"summary.consul": {
+		PT: "Consul: %d nós registrados, %d atualizados, %d sem mudança, %d conflitos, %d erros; %d removidos",
+		EN: "Consul: %d nodes registered, %d updated, %d unchanged, %d conflicts, %d errors; %d deregistered",
+	},
+	"consul.registered": {
+		PT: "Consul: nó %s (%s) registrado",
+		EN: "Consul: node %s (%s) registered",
+	},
+	"consul.updated": {
+		PT: "Consul: nó %s (%s) atualizado",
+		EN: "Consul: node %s (%s) updated",
+	},
+	"consul.unchanged": {
+		PT: "Consul: nó %s (%s) sem mudança",
+		EN: "Consul: node %s (%s) unchanged",
+	},
+	"consul.conflict": {
+		PT: "Consul: o nó %s (host %s) já existe com o endereço %s e não é deste discovery; não alterado",
+		EN: "Consul: node %s (host %s) already exists with address %s and is not managed by this discovery; left untouched",
+	},
+	"consul.duplicate_name": {
+		PT: "Consul: o nó %s do host %s já foi registrado neste run pelo host %s; não alterado",
+		EN: "Consul: node %s for host %s was already registered in this run by host %s; left untouched",
+	},
+	"consul.failed": {
+		PT: "Falha ao registrar o nó %s (%s) no Consul: %v",
+		EN: "Failed to register node %s (%s) in Consul: %v",
+	},
+	"consul.list_failed": {
+		PT: "Falha ao listar os nós deste discovery no Consul; nenhum removido: %v",
+		EN: "Failed to list this discovery's nodes in Consul; none deregistered: %v",
+	},
+	"consul.deregistered": {
+		PT: "Consul: nó %s (%s) removido, o host não respondeu",
+		EN: "Consul: node %s (%s) deregistered, the host did not respond",
+	},
+	"consul.deregister_failed": {
+		PT: "Falha ao remover o nó %s (%s) do Consul: %v",
+		EN: "Failed to deregister node %s (%s) from Consul: %v",
+	},
+	"consul.deregister_skipped": {
+		PT: "Consul: run incompleto (interrompido, com hosts descartados ou só de alguns IPs); nenhum nó removido",
+		EN: "Consul: incomplete run (interrupted, with dropped hosts or of a few IPs only); no node deregistered",
+	},
+	"consul.queue_full": {
+		PT: "Fila do Consul cheia (%d hosts); os próximos hosts não serão registrados enquanto ela não esvaziar",
+		EN: "Consul queue full (%d hosts); further hosts are skipped until it drains",
+	},
+	"consul.dropped": {
+		PT: "Consul: %d host(s) descartados com a fila cheia",
+		EN: "Consul: %d host(s) dropped with the queue full",
+	},
+	"summary.stage_queue": {
+		PT: "Fila da etapa %s: pico de %d de %d hosts",
+		EN: "Stage %s queue: peak of %d out of %d hosts",
+	},
+	"target.invalid": {
+		PT: "Alvo %q não é um endereço IP; descartado sem ping",
+		EN: "Target %q is not an IP address; dropped without ping",
+	},
+	"target.duplicate": {
+		PT: "Alvo duplicado: %s (range %s) já foi processado neste run; ignorado",
+		EN: "Duplicate target: %s (range %s) was already processed in this run; skipped",
+	},
+	"ping.flavor": {
+		PT: "Ping do sistema: variante %s",
+		EN: "System ping: %s flavor",
+	},
+	"ping.failed": {
+		PT: "Falha ao executar o ping em %s (%s): %v",
+		EN: "Failed to run ping on %s (%s): %v",
+	},
+	"ping.permission_denied": {
+		PT: "O ping falhou por falta de permissão em %d hosts: o processo não consegue abrir o socket ICMP (contêiner sem CAP_NET_RAW ou ping sem setuid?). Esses hosts não foram testados e não estão fora do ar; as próximas falhas vão só para o debug",
+		EN: "Ping failed for lack of permission on %d hosts: the process cannot open the ICMP socket (container without CAP_NET_RAW or ping without setuid?). Those hosts were not tested and are not down; further failures are logged at debug only",
+	},
+	"ping.invocation_failed": {
+		PT: "O comando ping não executou ou recusou os argumentos em %d hosts (veja a variante detectada no início do log). Esses hosts não foram testados e não estão fora do ar; as próximas falhas vão só para o debug",
+		EN: "The ping command failed to run or rejected its arguments on %d hosts (see the flavor detected at the start of the log). Those hosts were not tested and are not down; further failures are logged at debug only",
+	},
+	"summary.range": {
+		PT: "Range %s: %d/%d verificados, %d responderam, concluído em %s (%dº)",
+		EN: "Range %s: %d/%d scanned, %d answered, finished in %s (#%d)",
+	},
+	"summary.range_unfinished": {
+		PT: "Range %s: %d/%d verificados, %d responderam, não concluído",
+		EN: "Range %s: %d/%d scanned, %d answered, not finished",
+	},
+	"summary.slowest": {
+		PT: "Mais lentos no %s: %s",
+		EN: "Slowest in %s: %s",
+	},
+	"summary.snmp_no_failures": {
+		PT: "nenhuma falha",
+		EN: "no failures",
+	},
+	"summary.snmp_failures": {
+		PT: "%d falha(s) (%s)",
+		EN: "%d failure(s) (%s)",
+	},
+	"progress.counts": {
+		PT: ", %d responderam, %s criados",
+		EN: ", %d answered, %s created",
+	},
+	"progress.errors": {
+		PT: ", %d erros",
+		EN: ", %d errors",
+	},
+	"progress.queued": {
+		PT: ", %d na fila do %s",
+		EN: ", %d queued for %s",
+	},
+	"usr1.not_started": {
+		PT: "Snapshot (SIGUSR1): o run ainda não começou o scan",
+		EN: "Snapshot (SIGUSR1): the run has not started scanning yet",
+	},
+	"usr1.progress": {
+		PT: "Snapshot (SIGUSR1): %s; %s decorridos",
+		EN: "Snapshot (SIGUSR1): %s; %s elapsed",
+	},
+	"usr1.stage": {
+		PT: "Snapshot: etapa %s com %d processados, %d erros, %d na fila",
+		EN: "Snapshot: stage %s with %d processed, %d errors, %d queued",
+	},
+	"usr1.active": {
+		PT: "Snapshot: %d IP(s) em andamento",
+		EN: "Snapshot: %d IP(s) in flight",
+	},
+	"usr1.active_host": {
+		PT: "Snapshot:   %s na etapa %s há %s",
+		EN: "Snapshot:   %s in stage %s for %s",
+	},
+	"usr1.active_more": {
+		PT: "Snapshot:   ... e mais %d",
+		EN: "Snapshot:   ... and %d more",
+	},
+	"usr1.daemon_idle": {
+		PT: "Snapshot (SIGUSR1): daemon sem scan em andamento após %d ciclo(s); ciclo %d às %s (%d ciclo(s) ignorado(s))",
+		EN: "Snapshot (SIGUSR1): daemon idle after %d cycle(s); cycle %d at %s (%d cycle(s) skipped)",
+	},
+	"usr1.daemon_trap": {
+		PT: "Snapshot (SIGUSR1): scan por trap %d em andamento há %s; ciclo %d às %s",
+		EN: "Snapshot (SIGUSR1): trap scan %d running for %s; cycle %d at %s",
+	},
+	"usr1.daemon_cycle": {
+		PT: "Snapshot (SIGUSR1): ciclo %d em andamento há %s; ciclo %d às %s",
+		EN: "Snapshot (SIGUSR1): cycle %d running for %s; cycle %d at %s",
+	},
+	"tui.too_small": {
+		PT: "Terminal de %dx%d pequeno demais para o -tui (mínimo %dx%d); mostrando o progresso na linha de sempre",
+		EN: "Terminal of %dx%d too small for -tui (minimum %dx%d); showing the usual progress line",
+	},
+	"tui.unavailable": {
+		PT: "O -tui requer a saída padrão num terminal (sem -output ndjson, -daemon, -verbose ou -debug-host sem -debug-dir); seguindo com o log normal",
+		EN: "-tui needs standard output on a terminal (without -output ndjson, -daemon, -verbose or -debug-host without -debug-dir); continuing with normal logging",
+	},
+	"tui.title": {
+		PT: "discoveryhosts — run %s — %s",
+		EN: "discoveryhosts — run %s — %s",
+	},
+	"tui.counts": {
+		PT: "Responderam %d   SNMP ok %d   Criados %s   Erros %s",
+		EN: "Alive %d   SNMP ok %d   Created %s   Errors %s",
+	},
+	"tui.ranges": {
+		PT: "Ranges",
+		EN: "Ranges",
+	},
+	"tui.range_counts": {
+		PT: "%d/%d, %d responderam",
+		EN: "%d/%d, %d alive",
+	},
+	"tui.more_ranges": {
+		PT: "… mais %d ranges",
+		EN: "… %d more ranges",
+	},
+	"tui.stage": {
+		PT: "Etapa",
+		EN: "Stage",
+	},
+	"tui.rate": {
+		PT: "hosts/s",
+		EN: "hosts/s",
+	},
+	"tui.processed": {
+		PT: "total",
+		EN: "total",
+	},
+	"tui.queue": {
+		PT: "fila",
+		EN: "queue",
+	},
+	"tui.warnings": {
+		PT: "Avisos recentes",
+		EN: "Recent warnings",
+	},
+	"tui.no_warnings": {
+		PT: "nenhum aviso",
+		EN: "no warnings",
+	},
+	"tui.warnings_hidden": {
+		PT: "(%d avisos anteriores omitidos; veja o -log-file)",
+		EN: "(%d earlier warnings omitted; see -log-file)",
+	},
+	"zabbix.draining": {
+		PT: "Cadastrando no Zabbix os %d host(s) que já estavam na fila antes de encerrar",
+		EN: "Registering in Zabbix the %d queued host(s) before stopping",
+	},
+	"notify.slack_title": {
+		PT: "*Discovery finalizado* (run %s) em %s",
+		EN: "*Discovery finished* (run %s) in %s",
+	},
+	"notify.slack_totals": {
+		PT: "%d alvos, %d responderam, %d com SNMP",
+		EN: "%d targets, %d answered, %d with SNMP",
+	},
+	"notify.slack_omitted": {
+		PT: "… e mais %d",
+		EN: "… and %d more",
+	},
+	"diff.no_previous": {
+		PT: "Sem snapshot anterior em %s; diff indisponível neste run",
+		EN: "No previous snapshot at %s; no diff available for this run",
+	},
+	"diff.unavailable": {
+		PT: "%v; diff indisponível neste run",
+		EN: "%v; no diff available for this run",
+	},
+	"diff.none": {
+		PT: "Diff: nenhuma mudança desde o run %s",
+		EN: "Diff: no changes since run %s",
+	},
+	"diff.totals": {
+		PT: "Diff desde o run %s: %d novos, %d sumiram, %d renomeados, SNMP voltou em %d, SNMP parou em %d",
+		EN: "Diff since run %s: %d new, %d missing, %d renamed, SNMP started on %d, SNMP stopped on %d",
+	},
+	"diff.new": {
+		PT: "Host novo: %s",
+		EN: "New host: %s",
+	},
+	"diff.missing": {
+		PT: "Host sumiu: %s",
+		EN: "Missing host: %s",
+	},
+	"diff.renamed": {
+		PT: "Host %s renomeado: %s -> %s",
+		EN: "Host %s renamed: %s -> %s",
+	},
+	"diff.snmp_started": {
+		PT: "SNMP passou a responder em: %s",
+		EN: "SNMP started answering on: %s",
+	},
+	"diff.snmp_stopped": {
+		PT: "SNMP parou de responder em: %s",
+		EN: "SNMP stopped answering on: %s",
+	},
+	"config.plain_smtp_pass": {
+		PT: "%s contém smtp.password mesmo com secrets_file configurado; mova para smtp_pass em %s",
+		EN: "%s contains smtp.password even though secrets_file is set; move it to smtp_pass in %s",
+	},
+	"mail.subject": {
+		PT: "Discovery %s: %d hosts criados, %d erros no Zabbix",
+		EN: "Discovery %s: %d hosts created, %d Zabbix errors",
+	},
+	"mail.skipped": {
+		PT: "Nenhum host criado nem erro, e-mail não enviado",
+		EN: "No hosts created and no errors, email not sent",
+	},
+	"mail.sent": {
+		PT: "Resumo enviado por e-mail para %s",
+		EN: "Summary emailed to %s",
+	},
+	"mail.failed": {
+		PT: "Falha ao enviar o e-mail do resumo: %v",
+		EN: "Failed to email the summary: %v",
+	},
+	"sender.sent": {
+		PT: "Estatísticas do run enviadas ao trapper %s (%s)",
+		EN: "Run statistics sent to trapper %s (%s)",
+	},
+	"lld.partial": {
+		PT: "LLD não enviado: run parcial ou só de alguns IPs (%d host(s)); os demais seriam tratados como perdidos",
+		EN: "LLD not sent: partial run or of a few IPs only (%d host(s)); the others would be treated as lost",
+	},
+	"lld.failed": {
+		PT: "Falha ao enviar %d host(s) ao LLD no trapper %s: %v",
+		EN: "Failed to send %d host(s) to LLD on trapper %s: %v",
+	},
+	"summary.lld": {
+		PT: "LLD: %d host(s) enviados a %s:%s (%s)",
+		EN: "LLD: %d host(s) sent to %s:%s (%s)",
+	},
+	"sender.failed": {
+		PT: "Falha ao enviar estatísticas ao trapper %s: %v",
+		EN: "Failed to send statistics to trapper %s: %v",
+	},
+	"ndjson.dropped": {
+		PT: "%d linha(s) NDJSON descartadas porque o consumidor não acompanhou (-ndjson-policy drop)",
+		EN: "%d NDJSON line(s) dropped because the consumer could not keep up (-ndjson-policy drop)",
+	},
+	"summary.recovered": {
+		PT: "Retentativa das falhas do run %s: %d de %d host(s) recuperados",
+		EN: "Retry of the failures of run %s: %d of %d host(s) recovered",
+	},
+	"summary.trigger": {
+		PT: "Run disparado por %s: %d alvo(s)",
+		EN: "Run triggered by %s: %d target(s)",
+	},
+	"summary.interrupted": {
+		PT: "Run interrompido: %d de %d alvos verificados",
+		EN: "Run interrupted: %d of %d targets scanned",
+	},
+	"run.interrupting": {
+		PT: "Recebido %s; aguardando os hosts em andamento (repita para sair imediatamente)",
+		EN: "Received %s; waiting for in-flight hosts (repeat to exit immediately)",
+	},
+	"run.forced_exit": {
+		PT: "Recebido %s novamente; saindo sem concluir o run",
+		EN: "Received %s again; exiting without finishing the run",
+	},
+	"diff.interrupted": {
+		PT: "Run parcial (interrompido ou cortado pelo max_run_duration); diff não calculado e %s mantido",
+		EN: "Partial run (interrupted or cut by max_run_duration); diff not computed and %s kept",
+	},
+	"daemon.started": {
+		PT: "Modo daemon: agenda %s, jitter de até %s",
+		EN: "Daemon mode: schedule %s, jitter up to %s",
+	},
+	"daemon.next": {
+		PT: "Próximo scan (ciclo %d) em %s",
+		EN: "Next scan (cycle %d) at %s",
+	},
+	"daemon.skipped": {
+		PT: "Ciclo agendado ignorado: o scan do ciclo %d ainda está em andamento há %s",
+		EN: "Scheduled cycle skipped: the cycle %d scan has been running for %s",
+	},
+	"daemon.cycle_start": {
+		PT: "Ciclo %d iniciado (run %s)",
+		EN: "Cycle %d started (run %s)",
+	},
+	"daemon.cycle_done": {
+		PT: "Ciclo %d concluído em %s com código de saída %d (%d ciclo(s) ignorado(s) desde o início)",
+		EN: "Cycle %d finished in %s with exit code %d (%d cycle(s) skipped since start)",
+	},
+	"daemon.cycle_failed": {
+		PT: "Falha no ciclo %d: %v",
+		EN: "Cycle %d failed: %v",
+	},
+	"daemon.stopping": {
+		PT: "Sinal %v recebido: aguardando o scan do ciclo %d terminar (outro sinal interrompe o scan)",
+		EN: "Received %v: waiting for the cycle %d scan to finish (another signal interrupts the scan)",
+	},
+	"daemon.stopped": {
+		PT: "Daemon encerrado após %d ciclo(s)",
+		EN: "Daemon stopped after %d cycle(s)",
+	},
+	"systemd.ready": {
+		PT: "Notificando o systemd (NOTIFY_SOCKET), watchdog de %v",
+		EN: "Notifying systemd (NOTIFY_SOCKET), watchdog of %v",
+	},
+	"systemd.notify_failed": {
+		PT: "Falha ao notificar o systemd: %v",
+		EN: "Failed to notify systemd: %v",
+	},
+	"systemd.status_waiting": {
+		PT: "aguardando o ciclo %d às %s",
+		EN: "waiting for cycle %d at %s",
+	},
+	"systemd.status_cycle": {
+		PT: "ciclo %d: %s",
+		EN: "cycle %d: %s",
+	},
+	"systemd.status_trap": {
+		PT: "scan por trap %d: %s",
+		EN: "trap scan %d: %s",
+	},
+	"systemd.status_stopping": {
+		PT: "encerrando, esperando o scan em andamento",
+		EN: "stopping, waiting for the running scan",
+	},
+	"daemon.reloading": {
+		PT: "SIGHUP recebido: relendo a configuração (%s)",
+		EN: "Received SIGHUP: reloading configuration (%s)",
+	},
+	"daemon.reload_rejected": {
+		PT: "Nova configuração rejeitada, a atual continua valendo: %v",
+		EN: "New configuration rejected, keeping the current one: %v",
+	},
+	"daemon.reload_unchanged": {
+		PT: "Configuração relida sem alterações",
+		EN: "Configuration reloaded with no changes",
+	},
+	"daemon.reloaded": {
+		PT: "Configuração recarregada com %d alteração(ões); vale a partir do ciclo %d",
+		EN: "Configuration reloaded with %d change(s); takes effect from cycle %d",
+	},
+	"daemon.reload_change": {
+		PT: "Alterado: %s",
+		EN: "Changed: %s",
+	},
+	"daemon.reload_restart": {
+		PT: "%s só passa a valer após reiniciar o processo",
+		EN: "%s only takes effect after restarting the process",
+	},
+	"daemon.reload_applied": {
+		PT: "Ciclo %d usa a configuração recarregada",
+		EN: "Cycle %d uses the reloaded configuration",
+	},
+	"daemon.cycle_delayed": {
+		PT: "Ciclo %d aguardando o scan por trap em andamento terminar",
+		EN: "Cycle %d waiting for the running trap scan to finish",
+	},
+	"trap.listening": {
+		PT: "Recebendo traps em %s (dedup de %s, até %d trap(s) por origem por minuto, batch de %s)",
+		EN: "Receiving traps on %s (dedup %s, up to %d trap(s) per source per minute, batch %s)",
+	},
+	"trap.listen_failed": {
+		PT: "Não foi possível receber traps em %s: %v",
+		EN: "Cannot receive traps on %s: %v",
+	},
+	"trap.rejected": {
+		PT: "Trap de %s recusado: %s",
+		EN: "Trap from %s rejected: %s",
+	},
+	"trap.rate_limited": {
+		PT: "Traps de %s acima do limite de %d por minuto; descartados até o fim do minuto",
+		EN: "Traps from %s over the limit of %d per minute; dropped until the end of the minute",
+	},
+	"trap.queue_full": {
+		PT: "Trap de %s descartado: %d traps aguardando o daemon",
+		EN: "Trap from %s dropped: %d traps waiting for the daemon",
+	},
+	"trap.out_of_range": {
+		PT: "Trap de %s (enviado por %s, v%s) ignorado: IP fora dos ranges locais",
+		EN: "Trap from %s (sent by %s, v%s) ignored: IP outside the local ranges",
+	},
+	"trap.duplicate": {
+		PT: "Trap de %s ignorado: IP já varrido por trap em %s",
+		EN: "Trap from %s ignored: IP already scanned by a trap at %s",
+	},
+	"trap.queued": {
+		PT: "Trap de %s (range %s, v%s, %s): IP na fila do scan por trap",
+		EN: "Trap from %s (range %s, v%s, %s): IP queued for a trap scan",
+	},
+	"trap.covered": {
+		PT: "%d IP(s) da fila de traps varridos pelo ciclo %d",
+		EN: "%d IP(s) from the trap queue scanned by cycle %d",
+	},
+	"trap.scan_start": {
+		PT: "Scan por trap %d iniciado: %d IP(s) (%s), run %s",
+		EN: "Trap scan %d started: %d IP(s) (%s), run %s",
+	},
+	"trap.scan_done": {
+		PT: "Scan por trap %d concluído em %s com código de saída %d",
+		EN: "Trap scan %d finished in %s with exit code %d",
+	},
+	"trap.scan_failed": {
+		PT: "Falha no scan por trap %d: %v",
+		EN: "Trap scan %d failed: %v",
+	},
+	"daemon.secret_changed": {
+		PT: "alterado (valor mascarado)",
+		EN: "changed (value masked)",
+	},
+	"checkpoint.resuming": {
+		PT: "Retomando o checkpoint %s do run %s: %d alvo(s) já concluído(s), gravado em %s",
+		EN: "Resuming checkpoint %s from run %s: %d target(s) already done, saved at %s",
+	},
+	"checkpoint.config_changed": {
+		PT: "Checkpoint %s criado com outra configuração; retomando mesmo assim por causa do -force",
+		EN: "Checkpoint %s was created with a different configuration; resuming anyway because of -force",
+	},
+	"checkpoint.saved": {
+		PT: "Checkpoint gravado em %s com %d de %d alvo(s) concluído(s); use -resume para continuar",
+		EN: "Checkpoint written to %s with %d of %d target(s) done; use -resume to continue",
+	},
+	"checkpoint.save_failed": {
+		PT: "Falha ao gravar o checkpoint %s: %v",
+		EN: "Failed to write checkpoint %s: %v",
+	},
+	"checkpoint.remove_failed": {
+		PT: "Falha ao remover o checkpoint %s do run concluído: %v",
+		EN: "Failed to remove checkpoint %s of the finished run: %v",
+	},
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"discoveryhosts/icinga2"
+	"discoveryhosts/zabbix"
+)
+
+const backendIcinga2 = "icinga2"
+
+// Icinga2 configura o cadastro dos hosts identificados como objetos Host do
+// Icinga 2, pela API REST do master, com icinga2 em backends, junto ou no
+// lugar de zabbix.
+type Icinga2 struct {
+	URL      string `json:"url,omitempty" yaml:"url" toml:"url"` // https://master:5665
+	Username string `json:"username,omitempty" yaml:"username" toml:"username"`
+	Password string `json:"password,omitempty" yaml:"password" toml:"password"`
+	// CA do Icinga (/var/lib/icinga2/certs/ca.crt), que assina o certificado
+	// da API
+	CAFile string `json:"ca_file,omitempty" yaml:"ca_file" toml:"ca_file"`
+	// Certificado de cliente de um ApiUser com client_cn, no lugar da senha
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file" toml:"key_file"`
+	// Nome do certificado da API (o do node), quando a URL usa outro nome ou
+	// o IP
+	ServerName         string   `json:"server_name,omitempty" yaml:"server_name" toml:"server_name"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+	Templates          []string `json:"templates,omitempty" yaml:"templates" toml:"templates"`
+	// check_command dos hosts; vazio usa o dos templates (ou hostalive, sem
+	// templates)
+	CheckCommand string `json:"check_command,omitempty" yaml:"check_command" toml:"check_command"`
+	// Zona e endpoint dos hosts, como o zabbix_proxy_id; range_zones troca os
+	// dois nos ranges listados
+	Zone            string                      `json:"zone,omitempty" yaml:"zone" toml:"zone"`
+	CommandEndpoint string                      `json:"command_endpoint,omitempty" yaml:"command_endpoint" toml:"command_endpoint"`
+	RangeZones      map[string]Icinga2Placement `json:"range_zones,omitempty" yaml:"range_zones" toml:"range_zones"`
+	Timeout         Duration                    `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+// Icinga2Placement é a zona (e o endpoint dos checks) dos hosts de um range,
+// como a de um satélite.
+type Icinga2Placement struct {
+	Zone            string `json:"zone,omitempty" yaml:"zone" toml:"zone"`
+	CommandEndpoint string `json:"command_endpoint,omitempty" yaml:"command_endpoint" toml:"command_endpoint"`
+}
+
+func (i Icinga2) validate(c Config) []error {
+	if !c.backend(backendIcinga2) {
+		return nil
+	}
+	var errs []error
+	if u, err := url.Parse(i.URL); i.URL == "" || err != nil || u.Scheme != "https" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("icinga2.url deve ser a URL https:// da API do Icinga2 (atual: %q)%s", i.URL, c.origin("icinga2.url")))
+	}
+	if (i.CertFile == "") != (i.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("icinga2.cert_file e icinga2.key_file devem ser usados juntos%s", c.origin("icinga2")))
+	}
+	if i.Username == "" && i.CertFile == "" {
+		errs = append(errs, fmt.Errorf("icinga2.username e icinga2.password (ou icinga2.cert_file) são obrigatórios com o backend icinga2%s", c.origin("backends")))
+	}
+	if _, err := i.tlsConfig(); err != nil {
+		errs = append(errs, fmt.Errorf("%w%s", err, c.origin("icinga2")))
+	}
+	if time.Duration(i.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("icinga2.timeout deve ser positivo%s", c.origin("icinga2.timeout")))
+	}
+	ranges := map[string]bool{}
+	for _, r := range c.Ranges {
+		ranges[strings.TrimSpace(r)] = true
+	}
+	for r, p := range i.RangeZones {
+		key := "icinga2.range_zones." + r
+		if !ranges[strings.TrimSpace(r)] {
+			errs = append(errs, fmt.Errorf("icinga2.range_zones: o range %q não está em ranges%s", r, c.origin(key)))
+		}
+		if p.Zone == "" && p.CommandEndpoint == "" {
+			errs = append(errs, fmt.Errorf("icinga2.range_zones: o range %q não tem zone nem command_endpoint%s", r, c.origin(key)))
+		}
+	}
+	return errs
+}
+
+func (i Icinga2) redacted() Icinga2 {
+	i.Password = maskSecret(i.Password)
+	return i
+}
+
+// TLS da API: a CA do Icinga (a do sistema não assina os certificados dos
+// nodes), o nome do certificado e o certificado de cliente.
+func (i Icinga2) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: i.ServerName, InsecureSkipVerify: i.InsecureSkipVerify}
+	if i.CAFile != "" {
+		pem, err := ioutil.ReadFile(i.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao ler a CA do Icinga2 %s: %w", i.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("nenhum certificado válido em %s", i.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if i.CertFile != "" && i.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(i.CertFile, i.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao ler o certificado de cliente do Icinga2 %s: %w", i.CertFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Zona e endpoint dos hosts de um range: os de range_zones, se houver, ou os
+// globais.
+func (i Icinga2) placement(r string) Icinga2Placement {
+	for key, p := range i.RangeZones {
+		if strings.TrimSpace(key) == r {
+			return p
+		}
+	}
+	return Icinga2Placement{Zone: i.Zone, CommandEndpoint: i.CommandEndpoint}
+}
+
+// Cadastro do discovery no Icinga 2: implementa discovery.HostCreator com o
+// nome do host como nome do objeto (e hostid) e o IP como address, para que
+// os resultados e os relatórios sejam os mesmos do Zabbix. sysDescr,
+// sysLocation, a community e os serviços abertos vão como custom vars.
+type icinga2Creator struct {
+	client *icinga2.Client
+	cfg    Icinga2
+	err    error // TLS inválido: todos os cadastros falham
+}
+
+func newIcinga2Creator(cfg Icinga2) icinga2Creator {
+	tlsConfig, err := cfg.tlsConfig()
+	return icinga2Creator{
+		client: icinga2.NewClient(cfg.URL, cfg.Username, cfg.Password, tlsConfig, time.Duration(cfg.Timeout)),
+		cfg:    cfg,
+		err:    err,
+	}
+}
+
+func (i icinga2Creator) Ensure(ctx context.Context, spec zabbix.HostSpec) (string, string, error) {
+	if i.err != nil {
+		return zabbix.Failed, "", i.err
+	}
+	vars := map[string]interface{}{"discovery_range": spec.Range}
+	if spec.Description != "" {
+		vars["sysdescr"] = spec.Description
+	}
+	if spec.Location != "" {
+		vars["location"] = spec.Location
+	}
+	if spec.Community != "" {
+		vars["snmp_community"] = spec.Community
+	}
+	var services []string
+	for _, t := range spec.Tags {
+		if t.Tag == "service" {
+			services = append(services, t.Value)
+		}
+	}
+	if len(services) > 0 {
+		vars["services"] = services
+	}
+	check := i.cfg.CheckCommand
+	if check == "" && len(i.cfg.Templates) == 0 {
+		check = "hostalive"
+	}
+	p := i.cfg.placement(spec.Range)
+	action, id, err := i.client.Ensure(ctx, icinga2.HostSpec{
+		Name:            spec.Name,
+		Address:         spec.IP,
+		Templates:       i.cfg.Templates,
+		CheckCommand:    check,
+		Zone:            p.Zone,
+		CommandEndpoint: p.CommandEndpoint,
+		Vars:            vars,
+	})
+	switch action {
+	case icinga2.Created:
+		return zabbix.Created, id, nil
+	case icinga2.Existing:
+		return zabbix.Existing, id, nil
+	}
+	return zabbix.Failed, id, err
+}
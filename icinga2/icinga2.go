@@ -0,0 +1,219 @@
+// Package icinga2 implementa o cliente mínimo da API REST do Icinga 2 (v1)
+// usado para cadastrar os hosts descobertos como objetos Host.
+package icinga2
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Resultado de Ensure
+const (
+	Created  = "created"
+	Existing = "existing"
+	Failed   = "failed"
+)
+
+// HTTPError é uma resposta de erro da API, com a mensagem do Icinga (ou o
+// início do corpo, se não for JSON).
+type HTTPError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API do Icinga2 respondeu HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("API do Icinga2 respondeu HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// exists indica a recusa de um objeto que já existe: HTTP 409 nas versões
+// atuais e HTTP 500 com "already exists" nas anteriores à 2.12.
+func (e *HTTPError) exists() bool {
+	return e.StatusCode == http.StatusConflict ||
+		(e.StatusCode == http.StatusInternalServerError && strings.Contains(strings.ToLower(e.Message), "already exists"))
+}
+
+// Client é um cliente mínimo da API do Icinga 2, autenticado por um ApiUser
+// com senha (basic auth) ou pelo certificado de cliente do TLS.
+type Client struct {
+	url      string
+	username string
+	password string
+	http     *http.Client
+}
+
+// NewClient cria um cliente para a URL base da API (https://master:5665, sem o
+// /v1). A API só aceita HTTPS com os certificados da CA do próprio Icinga, por
+// isso tlsConfig costuma trazer essa CA (e, sem senha, o certificado do
+// cliente); nil usa a configuração padrão.
+func NewClient(baseURL, username, password string, tlsConfig *tls.Config, timeout time.Duration) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		url:      strings.TrimRight(baseURL, "/"),
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: timeout, Transport: transport},
+	}
+}
+
+// Corpo das respostas da API: os erros gerais vêm em error/status e os de
+// cada objeto, em results.
+type apiResponse struct {
+	Error   float64        `json:"error"`
+	Status  string         `json:"status"`
+	Results []objectResult `json:"results"`
+}
+
+type objectResult struct {
+	Code   float64  `json:"code"`
+	Status string   `json:"status"`
+	Errors []string `json:"errors"`
+}
+
+// Mensagem de erro de uma resposta, juntando os erros dos objetos.
+func (r apiResponse) message() string {
+	var parts []string
+	if r.Status != "" {
+		parts = append(parts, r.Status)
+	}
+	for _, res := range r.Results {
+		if res.Status != "" {
+			parts = append(parts, res.Status)
+		}
+		parts = append(parts, res.Errors...)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Faz uma chamada à API; result pode ser nil.
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+"/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	// Obrigatório em todas as chamadas da API
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		var ar apiResponse
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &ar) == nil && ar.message() != "" {
+			msg = ar.message()
+		}
+		if len(msg) > 512 {
+			msg = msg[:512] + "..."
+		}
+		return &HTTPError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("resposta inválida da API do Icinga2 em %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// Version consulta a versão do Icinga 2 (GET /status/IcingaApplication).
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var resp struct {
+		Results []struct {
+			Status struct {
+				IcingaApplication struct {
+					App struct {
+						Version string `json:"version"`
+					} `json:"app"`
+				} `json:"icingaapplication"`
+			} `json:"status"`
+		} `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/status/IcingaApplication", nil, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Results) == 0 || resp.Results[0].Status.IcingaApplication.App.Version == "" {
+		return "", fmt.Errorf("resposta sem a versão do Icinga2")
+	}
+	return resp.Results[0].Status.IcingaApplication.App.Version, nil
+}
+
+// HostSpec descreve o objeto Host de um host descoberto. Name é o nome do
+// objeto, que também identifica o host nas respostas.
+type HostSpec struct {
+	Name      string
+	Address   string
+	Templates []string // importados pelo objeto, na ordem
+	// check_command do objeto; vazio deixa o dos templates
+	CheckCommand string
+	// Zona do objeto e endpoint que executa os checks (como um satélite);
+	// vazios usam os do master
+	Zone            string
+	CommandEndpoint string
+	// Custom vars, somadas às dos templates
+	Vars map[string]interface{}
+}
+
+// Ensure cria o objeto Host (PUT /objects/hosts/<nome>). Um objeto com o
+// mesmo nome já cadastrado não é alterado e retorna Existing, com o nome como
+// id, assim como na criação.
+func (c *Client) Ensure(ctx context.Context, spec HostSpec) (string, string, error) {
+	attrs := map[string]interface{}{"address": spec.Address}
+	if spec.CheckCommand != "" {
+		attrs["check_command"] = spec.CheckCommand
+	}
+	if spec.Zone != "" {
+		attrs["zone"] = spec.Zone
+	}
+	if spec.CommandEndpoint != "" {
+		attrs["command_endpoint"] = spec.CommandEndpoint
+	}
+	// vars.<nome> em vez de um dicionário vars, que substituiria as vars
+	// herdadas dos templates
+	for name, value := range spec.Vars {
+		attrs["vars."+name] = value
+	}
+	body := map[string]interface{}{"attrs": attrs}
+	if len(spec.Templates) > 0 {
+		body["templates"] = spec.Templates
+	}
+	err := c.do(ctx, http.MethodPut, "/objects/hosts/"+url.PathEscape(spec.Name), body, nil)
+	var he *HTTPError
+	if errors.As(err, &he) && he.exists() {
+		return Existing, spec.Name, nil
+	}
+	if err != nil {
+		return Failed, "", err
+	}
+	return Created, spec.Name, nil
+}
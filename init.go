@@ -0,0 +1,463 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Entrada da configuração de exemplo gerada pelo init. Entradas com Optional
+// são escritas comentadas; Fields define uma subseção.
+type starterEntry struct {
+	Key      string
+	Comment  string
+	Value    interface{}
+	Optional bool
+	Fields   []starterEntry
+}
+
+// Configuração de exemplo com todas as chaves suportadas.
+var starterConfig = []starterEntry{
+	{Key: "config_version", Comment: "Versão do esquema deste arquivo", Value: currentConfigVersion},
+	{Key: "zabbix_url", Comment: "URL da API do Zabbix", Value: "http://zabbix.example/api_jsonrpc.php"},
+	{Key: "zabbix_user", Comment: "Usuário da API do Zabbix", Value: "discovery"},
+	{Key: "zabbix_pass", Comment: "Senha da API do Zabbix (prefira secrets_file)", Value: "troque-me"},
+	{Key: "zabbix_group_ids", Comment: "IDs dos grupos onde os hosts são criados", Value: []string{"1"}},
+	{Key: "zabbix_proxy_id", Comment: "ID do proxy que monitora os hosts criados", Value: "0"},
+	{Key: "zabbix_timeout", Comment: "Timeout das chamadas à API do Zabbix (mínimo 1s)", Value: "30s"},
+	{Key: "snmp_communities", Comment: "Communities SNMP v2c usadas para ler o sysName, tentadas em ordem", Value: []string{"public"}},
+	{Key: "ping_timeout", Comment: "Timeout do ping (segundos ou duração como \"750ms\"; mínimo 100ms)", Value: "1s"},
+	{Key: "snmp_timeout", Comment: "Timeout das consultas SNMP (mínimo 100ms)", Value: "2s"},
+	{Key: "max_retries", Comment: "Tentativas extras para falhas passageiras de SNMP e Zabbix (timeout, rede), depois da fila principal", Value: 0, Optional: true},
+	{Key: "retry_delay", Comment: "Espera antes de cada rodada de retentativas", Value: "30s", Optional: true},
+	{Key: "max_run_duration", Comment: "Tempo máximo do run; depois dele nenhum IP novo é iniciado e o resumo lista os não verificados", Value: "4h", Optional: true},
+	{Key: "workers", Comment: "Número de workers em paralelo; 0 calcula pelo número de CPUs", Value: 0},
+	{Key: "ping_workers", Comment: "Workers da etapa de ping; 0 usa workers", Value: 0, Optional: true},
+	{Key: "snmp_workers", Comment: "Workers da etapa SNMP; 0 usa workers", Value: 0, Optional: true},
+	{Key: "zabbix_workers", Comment: "Workers do cadastro no Zabbix, independentes dos de ping e SNMP; 0 usa até 4 (a API costuma ser o gargalo)", Value: 0, Optional: true},
+	{Key: "zabbix_queue", Comment: "Hosts identificados aguardando o cadastro no Zabbix; com a fila cheia o SNMP espera", Value: 1000, Optional: true},
+	{Key: "ranges", Comment: "Ranges a varrer, ex.: 10.91.50.1-14 ou 10.91.50-51.1-14", Value: []string{"192.168.0.1-254"}},
+	{Key: "range_workers", Comment: "Workers de ping reservados por range, tirados do total da etapa de ping; os demais ranges dividem o restante", Optional: true, Fields: []starterEntry{
+		{Key: "10.0.0.0/16", Comment: "Range lento (link de satélite) com pool próprio", Value: 4},
+	}},
+	{Key: "range_sources", Comment: "Fontes de ranges somadas a ranges, relidas a cada run: phpipam", Value: []string{"phpipam"}, Optional: true},
+	{Key: "phpipam", Comment: "Subnets IPv4 do phpIPAM usadas como ranges (com phpipam em range_sources); as que contêm outras selecionadas ficam de fora", Optional: true, Fields: []starterEntry{
+		{Key: "url", Comment: "URL base do phpIPAM, sem o /api", Value: "https://ipam.example"},
+		{Key: "app_id", Comment: "App id criado em Administration > API", Value: "discovery"},
+		{Key: "username", Comment: "Login da API; aceita cmd://", Value: "discovery"},
+		{Key: "password", Comment: "Senha do login; aceita cmd://", Value: "troque-me"},
+		{Key: "sections", Comment: "Seções (nome ou id) de onde vêm as subnets; vazio para todas", Value: []string{"Datacenter"}},
+		{Key: "tags", Comment: "Só as subnets com um destes valores no campo tag_field; vazio para todas", Value: []string{"discovery"}},
+		{Key: "tag_field", Comment: "Campo personalizado das subnets com as tags, separadas por vírgula", Value: "custom_discovery"},
+		{Key: "exclude_reserved", Comment: "Não varre os endereços com a tag Reserved", Value: true},
+		{Key: "page_size", Comment: "Itens pedidos por página nas listagens da API", Value: 500},
+		{Key: "timeout", Comment: "Timeout de cada chamada à API", Value: "30s"},
+	}},
+	{Key: "agents", Comment: "Agentes remotos (discoveryhosts -agent) usados como coordenador; o cadastro no Zabbix continua aqui", Optional: true, Fields: []starterEntry{
+		{Key: "site-a", Comment: "Nome do agente, usado em agent_ranges", Fields: []starterEntry{
+			{Key: "url", Comment: "Endereço do agente", Value: "https://scanner-a.example:8443"},
+			{Key: "token", Comment: "Token do agente (o agent.token dele); aceita cmd://", Value: "troque-me"},
+		}},
+	}},
+	{Key: "agent_ranges", Comment: "Agente de cada range; os ranges sem agente são varridos por este processo", Optional: true, Fields: []starterEntry{
+		{Key: "10.0.0.0/16", Comment: "Range varrido pelo agente site-a", Value: "site-a"},
+	}},
+	{Key: "agent", Comment: "Modo agente (-agent): recebe ranges de um coordenador e devolve o ping e o SNMP", Optional: true, Fields: []starterEntry{
+		{Key: "token", Comment: "Token exigido do coordenador; aceita cmd://", Value: "troque-me"},
+		{Key: "tls_cert", Comment: "Certificado TLS do servidor (sem ele a conexão não é criptografada)", Value: "/etc/discoveryhosts/agent.crt"},
+		{Key: "tls_key", Comment: "Chave privada do certificado", Value: "/etc/discoveryhosts/agent.key"},
+	}},
+	{Key: "interleave_ranges", Comment: "Alterna entre os ranges em rodízio em vez de varrer um de cada vez", Value: false, Optional: true},
+	{Key: "include_self", Comment: "Varre também os endereços do próprio scanner (das interfaces locais e de loopback), que por padrão saem dos ranges", Value: true, Optional: true},
+	{Key: "log_file", Comment: "Arquivo de log, gravado além da saída de erro", Value: "/var/log/discoveryhosts.log", Optional: true},
+	{Key: "log_max_size_mb", Comment: "Tamanho em MB a partir do qual o log_file é rotacionado", Value: 100, Optional: true},
+	{Key: "log_max_backups", Comment: "Quantidade de arquivos rotacionados mantidos (log_file.1, .2, ...)", Value: 5, Optional: true},
+	{Key: "log_file_only", Comment: "Grava os logs apenas no log_file, sem a saída de erro", Value: false, Optional: true},
+	{Key: "syslog_address", Comment: "Servidor syslog remoto (udp://host:514 ou tcp://host:514) para -log-target syslog; vazio usa o daemon local", Value: "udp://syslog.example:514", Optional: true},
+	{Key: "syslog_facility", Comment: "Facility usada no syslog", Value: "daemon", Optional: true},
+	{Key: "notifications", Comment: "Notificação via webhook ao fim de cada run", Optional: true, Fields: []starterEntry{
+		{Key: "webhook_url", Comment: "URL que recebe o POST (genérico ou Incoming Webhook do Slack)", Value: "https://hooks.slack.com/services/..."},
+		{Key: "format", Comment: "Formato do corpo: json ou slack", Value: "slack"},
+		{Key: "max_hosts", Comment: "Máximo de hosts criados listados na mensagem", Value: 20},
+		{Key: "notify_only_on_changes", Comment: "Só notifica quando algum host foi criado", Value: true},
+		{Key: "timeout", Comment: "Timeout de cada tentativa de envio", Value: "10s"},
+	}},
+	{Key: "grafana", Comment: "Anotação no Grafana ao fim de cada run, do início ao fim dele, com os hosts criados e sumidos", Optional: true, Fields: []starterEntry{
+		{Key: "url", Comment: "URL base do Grafana, sem o /api", Value: "https://grafana.example"},
+		{Key: "token", Comment: "Token de uma service account com permissão de anotações; aceita cmd://", Value: "troque-me"},
+		{Key: "tags", Comment: "Tags da anotação", Value: []string{"discovery"}},
+		{Key: "site", Comment: "Acrescenta a tag site:<nome>", Value: "matriz"},
+		{Key: "dashboard_uid", Comment: "Dashboard da anotação; vazio para uma anotação da organização", Value: ""},
+		{Key: "only_on_changes", Comment: "Só anota os runs que criaram hosts ou em que algum host sumiu (os sumidos requerem snapshot_file)", Value: false},
+		{Key: "timeout", Comment: "Timeout do envio", Value: "10s"},
+	}},
+	{Key: "smtp", Comment: "Envio do resumo por e-mail ao fim de cada run", Optional: true, Fields: []starterEntry{
+		{Key: "host", Comment: "Servidor SMTP", Value: "smtp.example"},
+		{Key: "port", Comment: "Porta do servidor (587 para starttls, 465 para tls)", Value: 587},
+		{Key: "security", Comment: "Segurança da conexão: starttls, tls ou none", Value: "starttls"},
+		{Key: "username", Comment: "Usuário SMTP (prefira smtp_user no secrets_file)", Value: "discovery"},
+		{Key: "password", Comment: "Senha SMTP; aceita cmd:// (prefira smtp_pass no secrets_file)", Value: "troque-me"},
+		{Key: "from", Comment: "Remetente", Value: "discovery@example.com"},
+		{Key: "to", Comment: "Destinatários", Value: []string{"noc@example.com"}},
+		{Key: "attach", Comment: "Relatório anexado: csv, json ou vazio para nenhum", Value: "csv"},
+		{Key: "only_on_changes", Comment: "Só envia quando algum host foi criado ou houve erros", Value: true},
+		{Key: "timeout", Comment: "Timeout da conexão e do envio", Value: "30s"},
+	}},
+	{Key: "backends", Comment: "Destinos do cadastro dos hosts identificados: zabbix, librenms, icinga2 ou log (só registra no log), um ou mais, com ou sem netbox, webhook e consul", Value: []string{"zabbix", "netbox"}, Optional: true},
+	{Key: "range_backends", Comment: "Backends de cadastro dos hosts de cada range, no lugar dos de backends (que precisam incluí-los); uma lista vazia não cadastra o range", Optional: true, Fields: []starterEntry{
+		{Key: "10.0.0.0/16", Comment: "Range cadastrado só no Zabbix", Value: []string{"zabbix"}},
+	}},
+	{Key: "netbox", Comment: "Reflexo dos hosts no NetBox (com netbox em backends): endereço IP com dns_name e device stub dos modelos conhecidos", Optional: true, Fields: []starterEntry{
+		{Key: "url", Comment: "URL base do NetBox, sem o /api", Value: "https://netbox.example"},
+		{Key: "token", Comment: "Token da API; aceita cmd://", Value: "troque-me"},
+		{Key: "tag", Comment: "Tag aplicada aos endereços e devices criados ou atualizados", Value: "discovered"},
+		{Key: "timeout", Comment: "Timeout de cada host (endereço e device)", Value: "10s"},
+		{Key: "workers", Comment: "Escritas simultâneas no NetBox", Value: 2},
+		{Key: "device_types", Comment: "sysObjectID -> slug do device type; só esses modelos viram device", Value: map[string]string{"1.3.6.1.4.1.9.1.2066": "cisco-c9300-48p"}},
+		{Key: "device_site", Comment: "Slug do site dos devices criados", Value: "matriz"},
+		{Key: "device_role", Comment: "Slug do role dos devices criados", Value: "access-switch"},
+	}},
+	{Key: "librenms", Comment: "Cadastro dos hosts como devices do LibreNMS (com librenms em backends, no lugar de zabbix); os campos zabbix_* são ignorados", Optional: true, Fields: []starterEntry{
+		{Key: "url", Comment: "URL base do LibreNMS, sem o /api/v0", Value: "https://librenms.example"},
+		{Key: "token", Comment: "Token da API (X-Auth-Token); aceita cmd://", Value: "troque-me"},
+		{Key: "force_add", Comment: "Cadastra sem os testes de ICMP e SNMP feitos pelo LibreNMS", Value: false},
+		{Key: "timeout", Comment: "Timeout das chamadas à API", Value: "30s"},
+	}},
+	{Key: "icinga2", Comment: "Cadastro dos hosts como objetos Host do Icinga 2 (com icinga2 em backends, no lugar de zabbix); os campos zabbix_* são ignorados", Optional: true, Fields: []starterEntry{
+		{Key: "url", Comment: "URL da API do master (HTTPS, porta 5665)", Value: "https://icinga-master.example:5665"},
+		{Key: "username", Comment: "ApiUser com permissão objects/create/host; aceita cmd://", Value: "discovery"},
+		{Key: "password", Comment: "Senha do ApiUser; aceita cmd:// (ou cert_file e key_file de um ApiUser com client_cn)", Value: "troque-me"},
+		{Key: "ca_file", Comment: "CA do Icinga, que assina o certificado da API", Value: "/var/lib/icinga2/certs/ca.crt"},
+		{Key: "server_name", Comment: "Nome do certificado da API, se a URL usar outro nome ou o IP", Value: "icinga-master.example"},
+		{Key: "templates", Comment: "Templates importados pelos hosts criados", Value: []string{"generic-host"}},
+		{Key: "zone", Comment: "Zona dos hosts; vazio para a do master", Value: "master"},
+		{Key: "range_zones", Comment: "Zona e endpoint dos checks por range, como um satélite", Fields: []starterEntry{
+			{Key: "10.0.0.0/16", Comment: "Range monitorado pelo satélite da filial", Fields: []starterEntry{
+				{Key: "zone", Comment: "Zona do satélite", Value: "filial"},
+				{Key: "command_endpoint", Comment: "Endpoint que executa os checks", Value: "sat-filial.example"},
+			}},
+		}},
+		{Key: "timeout", Comment: "Timeout das chamadas à API", Value: "30s"},
+	}},
+	{Key: "webhook", Comment: "Envio de cada host identificado a uma API HTTP (com webhook em backends, junto ou no lugar do zabbix)", Optional: true, Fields: []starterEntry{
+		{Key: "url", Comment: "URL que recebe os documentos", Value: "https://cmdb.example/api/hosts"},
+		{Key: "method", Comment: "POST, PUT ou PATCH", Value: "POST"},
+		{Key: "headers", Comment: "Headers extras de cada requisição; os valores aceitam cmd://", Value: map[string]string{"X-Source": "discovery"}},
+		{Key: "token", Comment: "Enviado como Authorization: Bearer; aceita cmd:// (ou username e password para Basic)", Value: "troque-me"},
+		{Key: "template", Comment: "text/template do documento de cada host (.IP, .Name, .SysDescr, .Action, .HostID...; json escapa um campo); vazio para o JSON do -output-json", Value: `{"name": {{json .Name}}, "ip": {{json .IP}}, "description": {{json .SysDescr}}}`},
+		{Key: "batch_size", Comment: "Hosts por requisição; acima de 1 o corpo é a lista dos documentos (ou um objeto com a lista em batch_key)", Value: 1},
+		{Key: "timeout", Comment: "Timeout de cada requisição", Value: "10s"},
+		{Key: "retries", Comment: "Novas tentativas de uma requisição sem resposta 2xx", Value: 2},
+		{Key: "retry_delay", Comment: "Espera entre as tentativas", Value: "2s"},
+		{Key: "workers", Comment: "Requisições simultâneas", Value: 2},
+	}},
+	{Key: "consul", Comment: "Registro dos hosts identificados como nós externos no catálogo do Consul (com consul em backends); nós já iguais não são registrados de novo", Optional: true, Fields: []starterEntry{
+		{Key: "address", Comment: "Endereço HTTP do Consul", Value: "http://consul.example:8500"},
+		{Key: "token", Comment: "ACL token com node:write; aceita cmd://", Value: "troque-me"},
+		{Key: "datacenter", Comment: "Datacenter dos nós; vazio para o do servidor", Value: "dc1"},
+		{Key: "source", Comment: "Valor do meta managed-by dos nós deste discovery; só esses são alterados ou removidos", Value: "discoveryhosts"},
+		{Key: "meta", Comment: "Meta fixo somado ao de cada nó (além de sysdescr, discovery-range...)", Value: map[string]string{"env": "prod"}},
+		{Key: "deregister_missing", Comment: "Remove, no fim de um run completo, os nós deste discovery cujo host sumiu dos ranges do run", Value: false},
+		{Key: "timeout", Comment: "Timeout de cada chamada à API", Value: "10s"},
+		{Key: "workers", Comment: "Registros simultâneos", Value: 2},
+	}},
+	{Key: "mqtt", Comment: "Publicação de um evento JSON por host concluído e do resumo do run num broker MQTT; com o broker fora do ar, os eventos esperam num buffer limitado", Optional: true, Fields: []starterEntry{
+		{Key: "broker", Comment: "mqtt://host:1883 ou mqtts://host:8883 (TLS)", Value: "mqtts://mqtt.example:8883"},
+		{Key: "username", Comment: "Login no broker; aceita cmd://", Value: "discovery"},
+		{Key: "password", Comment: "Senha do login; aceita cmd://", Value: "troque-me"},
+		{Key: "ca_file", Comment: "CA adicional para validar o broker (mqtts://)", Value: "/etc/discoveryhosts/mqtt-ca.pem"},
+		{Key: "topic", Comment: "Tópico de cada host, com {range}, {ip}, {name}, {action} e {run_id}", Value: "discovery/{range}/{ip}"},
+		{Key: "summary_topic", Comment: "Tópico do resumo no fim do run", Value: "discovery/summary"},
+		{Key: "qos", Comment: "QoS das publicações: 0, 1 ou 2", Value: 1},
+		{Key: "buffer", Comment: "Eventos aguardando o broker; além disso são descartados, com aviso", Value: 1000},
+		{Key: "timeout", Comment: "Timeout da conexão e das confirmações; também o tempo dado aos eventos pendentes no fim do run", Value: "10s"},
+		{Key: "reconnect_delay", Comment: "Espera antes de reconectar, dobrada a cada falha (até 1m)", Value: "5s"},
+	}},
+	{Key: "kafka", Comment: "Produção de uma mensagem por host concluído (chave: o IP) e do resumo do run num cluster Kafka, no formato do -output ndjson; com os brokers fora do ar, as mensagens esperam num buffer limitado", Optional: true, Fields: []starterEntry{
+		{Key: "brokers", Comment: "Brokers de bootstrap, host:porta", Value: []string{"kafka1.example:9093", "kafka2.example:9093"}},
+		{Key: "topic", Comment: "Tópico das mensagens dos hosts", Value: "discovery.hosts"},
+		{Key: "summary_topic", Comment: "Tópico do resumo; vazio para o mesmo dos hosts", Value: "discovery.runs"},
+		{Key: "acks", Comment: "Confirmação esperada: none (fire-and-forget), leader ou all", Value: "all"},
+		{Key: "tls", Comment: "Conexão com TLS", Value: true},
+		{Key: "ca_file", Comment: "CA adicional para validar os brokers", Value: "/etc/discoveryhosts/kafka-ca.pem"},
+		{Key: "sasl_mechanism", Comment: "PLAIN, SCRAM-SHA-256 ou SCRAM-SHA-512; vazio sem autenticação", Value: "SCRAM-SHA-512"},
+		{Key: "username", Comment: "Usuário SASL; aceita cmd://", Value: "discovery"},
+		{Key: "password", Comment: "Senha SASL; aceita cmd://", Value: "troque-me"},
+		{Key: "buffer", Comment: "Mensagens aguardando os brokers; além disso são descartadas, com aviso", Value: 1000},
+		{Key: "batch_size", Comment: "Mensagens por pedido de Produce", Value: 100},
+		{Key: "timeout", Comment: "Timeout da conexão e de cada pedido; também o tempo dado às mensagens pendentes no fim do run", Value: "10s"},
+		{Key: "reconnect_delay", Comment: "Espera antes de reenviar após uma falha, dobrada a cada falha (até 1m)", Value: "5s"},
+	}},
+	{Key: "name_fallback", Comment: "Cadastro dos hosts que respondem ao ping mas não ao SNMP, com o nome do PTR (ou unknown-<ip>)", Optional: true, Fields: []starterEntry{
+		{Key: "enabled", Comment: "Liga o cadastro sem SNMP", Value: true},
+		{Key: "interface", Comment: "Interface dos hosts criados: icmp (nenhuma, só simple checks) ou agent", Value: "icmp"},
+		{Key: "tag", Comment: "Tag dos hosts criados, com o IP como valor; um run com SNMP atualiza o host em vez de duplicar", Value: "discovery-fallback"},
+		{Key: "dns_timeout", Comment: "Timeout da consulta reversa", Value: "2s"},
+		{Key: "dns_resolver", Comment: "Servidor DNS (host ou host:porta); vazio usa o do sistema", Value: "10.0.0.53"},
+	}},
+	{Key: "zabbix_sender", Comment: "Envio das estatísticas do run a itens trapper do Zabbix", Optional: true, Fields: []starterEntry{
+		{Key: "server", Comment: "Zabbix server ou proxy que recebe os dados (porta padrão 10051)", Value: "zabbix.example:10051"},
+		{Key: "host", Comment: "Host do Zabbix com os itens trapper", Value: "discoveryhosts"},
+		{Key: "key_prefix", Comment: "Prefixo das chaves: <prefixo>.hosts_alive, .hosts_created, .errors e .duration", Value: "discovery"},
+		{Key: "timeout", Comment: "Timeout da conexão e do envio", Value: "10s"},
+	}},
+	{Key: "port_scan", Comment: "Varredura TCP opcional (connect) dos hosts vivos, só nos ranges listados; as portas abertas viram tags service:<nome>", Optional: true, Fields: []starterEntry{
+		{Key: "ranges", Comment: "Ranges varridos; vazio desliga a varredura", Value: []string{"10.91.50.1-14"}},
+		{Key: "ports", Comment: "Portas TCP verificadas (até 32)", Value: []int{22, 80, 443, 8443}},
+		{Key: "timeout", Comment: "Timeout de cada conexão (até 5s)", Value: "500ms"},
+		{Key: "concurrency", Comment: "Conexões simultâneas no run", Value: 32},
+		{Key: "rate", Comment: "Conexões novas por segundo no run; 0 sem limite", Value: 200},
+	}},
+	{Key: "lld", Comment: "Envio dos hosts identificados a uma regra de LLD (item trapper) em vez do cadastro direto", Optional: true, Fields: []starterEntry{
+		{Key: "server", Comment: "Zabbix server ou proxy que recebe o valor (porta padrão 10051)", Value: "zabbix.example:10051"},
+		{Key: "host", Comment: "Host do Zabbix com a regra de discovery do tipo trapper", Value: "discoveryhosts"},
+		{Key: "key", Comment: "Chave da regra; o valor traz {#IP}, {#SYSNAME}, {#SYSDESCR} e {#RANGE}", Value: "discovery.lld"},
+		{Key: "timeout", Comment: "Timeout da conexão e do envio", Value: "10s"},
+		{Key: "ranges", Comment: "Ranges enviados pelo LLD; os demais continuam cadastrados pela API", Value: []string{"10.91.50.1-14"}},
+	}},
+	{Key: "adaptive_workers", Comment: "Ajuste automático dos workers ativos conforme a taxa de falhas e timeouts; os workers configurados viram o máximo", Optional: true, Fields: []starterEntry{
+		{Key: "enabled", Comment: "Liga o modo adaptativo", Value: true},
+		{Key: "min_workers", Comment: "Workers ativos no início e no mínimo, por etapa", Value: 4},
+		{Key: "window", Comment: "Intervalo entre as reavaliações", Value: "30s"},
+	}},
+	{Key: "api", Comment: "API HTTP do modo servidor (-serve) para iniciar e acompanhar scans sob demanda", Optional: true, Fields: []starterEntry{
+		{Key: "token", Comment: "Token exigido em Authorization: Bearer; aceita cmd://", Value: "troque-me"},
+		{Key: "tls_cert", Comment: "Certificado TLS do servidor (sem ele a conexão não é criptografada)", Value: "/etc/discoveryhosts/api.crt"},
+		{Key: "tls_key", Comment: "Chave privada do certificado", Value: "/etc/discoveryhosts/api.key"},
+		{Key: "max_concurrent", Comment: "Scans simultâneos; pedidos além disso recebem 429", Value: 2},
+		{Key: "keep_scans", Comment: "Scans mantidos em memória para consulta; os concluídos mais antigos são descartados", Value: 100},
+	}},
+	{Key: "snmp_trap", Comment: "Receptor de traps do -daemon: um trap de um IP dos ranges dispara o scan só desse IP, fora da agenda", Optional: true, Fields: []starterEntry{
+		{Key: "listen", Comment: "Endereço UDP dos traps", Value: "0.0.0.0:162"},
+		{Key: "communities", Comment: "Communities aceitas em v1 e v2c; usuários v3 vão em users (user, auth_protocol, auth_password, priv_protocol, priv_password)", Value: []string{"traps"}},
+		{Key: "dedup_window", Comment: "Um IP já varrido por trap é ignorado por esse tempo", Value: "15m"},
+		{Key: "rate_limit", Comment: "Traps aceitos por origem por minuto; os demais são descartados", Value: 10},
+		{Key: "batch_delay", Comment: "Espera após o primeiro trap para juntar os seguintes num só scan", Value: "5s"},
+		{Key: "max_batch", Comment: "IPs por scan; os demais ficam para o seguinte", Value: 100},
+	}},
+	{Key: "on_discovered_command", Comment: "Comando executado para cada host que respondeu, com o resultado em DISCOVERY_IP, DISCOVERY_SYSNAME, DISCOVERY_ACTION... e em JSON na entrada padrão; sem shell", Value: "/usr/local/bin/radius-add-client", Optional: true},
+	{Key: "on_run_finished_command", Comment: "Comando executado no fim do run, com o resumo em DISCOVERY_* e em JSON na entrada padrão", Value: "/usr/local/bin/discovery-finished", Optional: true},
+	{Key: "hook_timeout", Comment: "Tempo máximo de cada execução de um hook", Value: "30s", Optional: true},
+	{Key: "hook_concurrency", Comment: "Execuções simultâneas do on_discovered_command", Value: 4, Optional: true},
+	{Key: "cache_file", Comment: "Cache dos hosts já processados: dentro do cache_ttl eles só fazem o ping, sem SNMP nem consulta ao Zabbix (-no-cache ignora)", Value: "/var/lib/discoveryhosts/cache.json", Optional: true},
+	{Key: "cache_ttl", Comment: "Tempo até um host do cache ser processado por completo de novo", Value: "24h", Optional: true},
+	{Key: "known_hosts_file", Comment: "CSV (export do CMDB) dos hosts gerenciados por outro sistema: os que casarem saem como known e não são cadastrados; relido a cada run", Value: "/etc/discoveryhosts/cmdb.csv", Optional: true},
+	{Key: "known_hosts_match", Comment: "Como um host casa com uma linha: ip, mac (da tabela ARP local, quando houver) e/ou name (sysName, sem diferenciar maiúsculas)", Value: []string{"ip", "name"}, Optional: true},
+	{Key: "known_hosts_columns", Comment: "Cabeçalho da coluna de cada regra; sem ele, a coluna com o nome da regra", Value: map[string]string{"ip": "IP Address", "name": "Hostname"}, Optional: true},
+	{Key: "known_hosts_delimiter", Comment: "Separador das colunas do CSV", Value: ";", Optional: true},
+	{Key: "snapshot_file", Comment: "Snapshot dos hosts que responderam, comparado com o run seguinte para o diff", Value: "/var/lib/discoveryhosts/snapshot.json", Optional: true},
+	{Key: "history_db", Comment: "Banco SQLite com o histórico dos runs, consultado com o subcomando history", Value: "/var/lib/discoveryhosts/history.db", Optional: true},
+	{Key: "lock_file", Comment: "Lock que impede dois scans ao mesmo tempo (cron, -daemon): o segundo sai com o código 6, ou espera o -lock-wait", Value: "/run/discoveryhosts.lock", Optional: true},
+	{Key: "strict_permissions", Comment: "Recusa carregar a configuração ou o secrets_file se o grupo ou outros usuários puderem lê-los", Value: true, Optional: true},
+	{Key: "secrets_file", Comment: "Arquivo separado só com as credenciais (zabbix_user, zabbix_pass, snmp_communities, smtp_user, smtp_pass)", Value: "discovery.secrets.yaml", Optional: true},
+}
+
+// Formata um valor escalar ou lista de strings; a sintaxe JSON serve para os
+// três formatos suportados.
+func starterValue(v interface{}) string {
+	if list, ok := v.([]string); ok {
+		quoted := make([]string, len(list))
+		for i, s := range list {
+			quoted[i] = starterValue(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// Campos da subseção; numa seção opcional todos saem comentados.
+func (e starterEntry) fields() []starterEntry {
+	if !e.Optional {
+		return e.Fields
+	}
+	fields := make([]starterEntry, len(e.Fields))
+	for i, f := range e.Fields {
+		f.Optional = true
+		fields[i] = f
+	}
+	return fields
+}
+
+func renderStarterJSON(b *strings.Builder, entries []starterEntry, indent string) {
+	last := -1
+	for i, e := range entries {
+		if !e.Optional {
+			last = i
+		}
+	}
+	for i, e := range entries {
+		fmt.Fprintf(b, "%s// %s\n", indent, e.Comment)
+		prefix := indent
+		if e.Optional {
+			prefix += "// "
+		}
+		comma := ","
+		if i >= last && !e.Optional {
+			comma = ""
+		}
+		if e.Fields != nil {
+			fmt.Fprintf(b, "%s%q: {\n", prefix, e.Key)
+			renderStarterJSON(b, e.fields(), indent+"    ")
+			fmt.Fprintf(b, "%s}%s\n", prefix, comma)
+			continue
+		}
+		fmt.Fprintf(b, "%s%q: %s%s\n", prefix, e.Key, starterValue(e.Value), comma)
+	}
+}
+
+func renderStarterYAML(b *strings.Builder, entries []starterEntry, indent string) {
+	for _, e := range entries {
+		fmt.Fprintf(b, "%s# %s\n", indent, e.Comment)
+		prefix := indent
+		if e.Optional {
+			prefix += "# "
+		}
+		if e.Fields != nil {
+			fmt.Fprintf(b, "%s%s:\n", prefix, e.Key)
+			renderStarterYAML(b, e.fields(), indent+"  ")
+			continue
+		}
+		fmt.Fprintf(b, "%s%s: %s\n", prefix, e.Key, starterValue(e.Value))
+	}
+}
+
+// Chaves com caracteres além de letras, dígitos, _ e - (como um range com
+// pontos) precisam de aspas em TOML.
+func tomlKey(k string) string {
+	for _, r := range k {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return strconv.Quote(k)
+		}
+	}
+	return k
+}
+
+func renderStarterTOML(b *strings.Builder, entries []starterEntry, table string) {
+	// Em TOML as chaves simples precisam vir antes das tabelas
+	for _, e := range entries {
+		if e.Fields != nil {
+			continue
+		}
+		fmt.Fprintf(b, "# %s\n", e.Comment)
+		prefix := ""
+		if e.Optional {
+			prefix = "# "
+		}
+		fmt.Fprintf(b, "%s%s = %s\n", prefix, tomlKey(e.Key), starterValue(e.Value))
+	}
+	for _, e := range entries {
+		if e.Fields == nil {
+			continue
+		}
+		name := tomlKey(e.Key)
+		if table != "" {
+			name = table + "." + tomlKey(e.Key)
+		}
+		fmt.Fprintf(b, "\n# %s\n", e.Comment)
+		if e.Optional {
+			fmt.Fprintf(b, "# [%s]\n", name)
+		} else {
+			fmt.Fprintf(b, "[%s]\n", name)
+		}
+		renderStarterTOML(b, e.fields(), name)
+	}
+}
+
+// Gera a configuração de exemplo no formato pedido.
+func renderStarterConfig(format string) (string, error) {
+	var b strings.Builder
+	switch format {
+	case formatJSON:
+		b.WriteString("// Configuração do discoveryhosts (JSON com comentários)\n{\n")
+		renderStarterJSON(&b, starterConfig, "    ")
+		b.WriteString("}\n")
+	case formatYAML:
+		b.WriteString("# Configuração do discoveryhosts\n")
+		renderStarterYAML(&b, starterConfig, "")
+	case formatTOML:
+		b.WriteString("# Configuração do discoveryhosts\n")
+		renderStarterTOML(&b, starterConfig, "")
+	default:
+		return "", fmt.Errorf("formato de configuração desconhecido: %s", format)
+	}
+	return b.String(), nil
+}
+
+// Subcomando init: escreve uma configuração inicial comentada.
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	format := fs.String("format", "", "formato do arquivo (json, yaml, toml); detectado pela extensão se vazio")
+	force := fs.Bool("force", false, "sobrescreve o arquivo se ele já existir")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: discoveryhosts init [-format json|yaml|toml] [-force] [caminho]")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+	if len(positional) > 1 {
+		fs.Usage()
+		return fmt.Errorf("apenas um caminho pode ser informado")
+	}
+	path := "discovery.conf"
+	if len(positional) == 1 {
+		path = positional[0]
+	}
+	if *format == "" {
+		*format = detectConfigFormat(path)
+	}
+
+	content, err := renderStarterConfig(*format)
+	if err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o600)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s já existe; use -force para sobrescrever", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// O arquivo gerado precisa passar pela própria validação da ferramenta
+	cfg, err := loadConfig([]string{path}, loadOptions{Format: *format})
+	if err == nil {
+		err = cfg.validate()
+	}
+	if err != nil {
+		return fmt.Errorf("configuração gerada em %s é inválida: %w", path, err)
+	}
+	logInfo("init.written", path, *format)
+	return nil
+}
+
+// Faz o parse das flags permitindo argumentos posicionais intercalados
+// (ex.: "init arquivo.yaml -force"), retornando os posicionais.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunInitLoads(t *testing.T) {
+	for _, name := range []string{"discovery.conf", "discovery.json", "discovery.yaml", "discovery.toml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := runInit([]string{path}); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := loadConfig([]string{path}, loadOptions{})
+			if err != nil {
+				t.Fatalf("init gerou configuração que não carrega: %v", err)
+			}
+			if err := cfg.validate(); err != nil {
+				t.Fatalf("init gerou configuração inválida: %v", err)
+			}
+			if len(cfg.Ranges) == 0 || cfg.ZabbixURL == "" {
+				t.Errorf("esperava ranges e zabbix_url de exemplo, obteve %v e %q", cfg.Ranges, cfg.ZabbixURL)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm&0o077 != 0 {
+				t.Errorf("esperava o arquivo legível só pelo dono, obteve %04o", perm)
+			}
+		})
+	}
+}
+
+func TestRunInitExplicitFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "discovery.conf")
+	if err := runInit([]string{"-format", "yaml", path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig([]string{path}, loadOptions{Format: formatYAML}); err != nil {
+		t.Fatalf("init -format yaml gerou configuração que não carrega: %v", err)
+	}
+}
+
+func TestRunInitExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "discovery.yaml")
+	if err := os.WriteFile(path, []byte("workers: 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := runInit([]string{path}); err == nil || !strings.Contains(err.Error(), "já existe") {
+		t.Errorf("esperava recusa sem -force, obteve %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "workers: 1\n" {
+		t.Errorf("arquivo existente foi alterado sem -force: %q", data)
+	}
+	if err := runInit([]string{path, "-force"}); err != nil {
+		t.Fatalf("esperava sobrescrever com -force: %v", err)
+	}
+}
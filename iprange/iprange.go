@@ -0,0 +1,202 @@
+// Package iprange expande os formatos de range IPv4 aceitos na configuração.
+package iprange
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Range é um range IPv4 validado, percorrido endereço a endereço sem montar a
+// lista: mesmo um /8 ocupa alguns bytes. Os endereços são uint32 (10.0.0.1 é
+// 0x0a000001), na ordem da expansão.
+type Range struct {
+	// Primeiro e último endereço. No formato por octetos (10.91.50-51.1-14)
+	// nem todo endereço entre os dois faz parte do range; aí valem os limites
+	// de cada octeto em lo e hi
+	start, end uint32
+	octets     bool
+	lo, hi     [4]uint8
+}
+
+// Parse valida um range nos formatos 10.91.50.1-14, 10.91.50-51.1-14 ou CIDR
+// (10.91.50.0/24).
+func Parse(ipRange string) (Range, error) {
+	if strings.Contains(ipRange, "/") {
+		return parseCIDR(ipRange)
+	}
+	parts := strings.Split(ipRange, ".")
+	if len(parts) != 4 {
+		return Range{}, fmt.Errorf("formato inválido: %s", ipRange)
+	}
+	r := Range{octets: true}
+	for i, s := range parts {
+		lo, hi := s, s
+		if strings.Contains(s, "-") {
+			bounds := strings.Split(s, "-")
+			if len(bounds) != 2 {
+				return Range{}, fmt.Errorf("octeto inválido: %s", s)
+			}
+			lo, hi = bounds[0], bounds[1]
+		}
+		start, err := parseOctet(lo)
+		if err != nil {
+			return Range{}, err
+		}
+		end, err := parseOctet(hi)
+		if err != nil {
+			return Range{}, err
+		}
+		if start > end {
+			return Range{}, fmt.Errorf("intervalo invertido: %s", s)
+		}
+		r.lo[i], r.hi[i] = uint8(start), uint8(end)
+	}
+	r.start = binary.BigEndian.Uint32(r.lo[:])
+	r.end = binary.BigEndian.Uint32(r.hi[:])
+	return r, nil
+}
+
+// Expand expande o range (nos formatos de Parse) na lista de endereços, em
+// ordem. Para ranges grandes, prefira Parse e Range.All.
+func Expand(ipRange string) ([]string, error) {
+	r, err := Parse(ipRange)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, 0, r.Len())
+	for n := range r.All() {
+		ips = append(ips, String(n))
+	}
+	return ips, nil
+}
+
+// Len é o número de endereços do range.
+func (r Range) Len() int {
+	if !r.octets {
+		return int(r.end-r.start) + 1
+	}
+	n := 1
+	for i := range r.lo {
+		n *= int(r.hi[i]-r.lo[i]) + 1
+	}
+	return n
+}
+
+// At é o i-ésimo endereço do range, 0 <= i < Len.
+func (r Range) At(i int) uint32 {
+	if !r.octets {
+		return r.start + uint32(i)
+	}
+	var ip [4]byte
+	for o := 3; o >= 0; o-- {
+		size := int(r.hi[o]-r.lo[o]) + 1
+		ip[o] = r.lo[o] + uint8(i%size)
+		i /= size
+	}
+	return binary.BigEndian.Uint32(ip[:])
+}
+
+// Contains indica se o endereço faz parte do range.
+func (r Range) Contains(n uint32) bool {
+	if n < r.start || n > r.end {
+		return false
+	}
+	if !r.octets {
+		return true
+	}
+	for o := range r.lo {
+		b := uint8(n >> (24 - 8*o))
+		if b < r.lo[o] || b > r.hi[o] {
+			return false
+		}
+	}
+	return true
+}
+
+// All percorre os endereços do range, em ordem.
+func (r Range) All() iter.Seq[uint32] {
+	return func(yield func(uint32) bool) {
+		for i, n := 0, r.Len(); i < n; i++ {
+			if !yield(r.At(i)) {
+				return
+			}
+		}
+	}
+}
+
+// String formata o endereço como 10.0.0.1.
+func String(n uint32) string {
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}).String()
+}
+
+// Uint32 converte um endereço IPv4 (também na forma ::ffff:10.0.0.1); false
+// se s não é um.
+func Uint32(s string) (uint32, bool) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return 0, false
+	}
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return 0, false
+	}
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:]), true
+}
+
+func parseOctet(s string) (int, error) {
+	val, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("octeto inválido: %s", s)
+	}
+	if val < 0 || val > 255 {
+		return 0, fmt.Errorf("octeto fora do intervalo 0-255: %d", val)
+	}
+	return val, nil
+}
+
+// Menor prefixo CIDR aceito: um /8 já são 16 milhões de endereços a verificar,
+// e um /0 levaria dias.
+const minCIDRPrefix = 8
+
+// Valida um bloco CIDR IPv4. Em redes maiores que /31 os endereços de rede e
+// broadcast são omitidos.
+func parseCIDR(cidr string) (Range, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return Range{}, fmt.Errorf("CIDR inválido: %s", cidr)
+	}
+	base := network.IP.To4()
+	if base == nil {
+		return Range{}, fmt.Errorf("apenas CIDR IPv4 é suportado: %s", cidr)
+	}
+	ones, bits := network.Mask.Size()
+	// Na forma mapeada (::ffff:10.0.0.0/104) o prefixo conta os 96 bits do
+	// IPv6; os bits de host são os mesmos
+	hostBits := bits - ones
+	if hostBits > 32-minCIDRPrefix {
+		return Range{}, fmt.Errorf("CIDR grande demais: %s (o menor prefixo aceito é /%d)", cidr, minCIDRPrefix)
+	}
+	size := uint32(1) << uint(hostBits)
+	start := binary.BigEndian.Uint32(base)
+	first, last := start, start+size-1
+	if size > 2 {
+		first, last = first+1, last-1
+	}
+	return Range{start: first, end: last}, nil
+}
+
+// Less ordena endereços IPv4 numericamente (10.0.0.2 antes de 10.0.0.10).
+func Less(a, b string) bool {
+	ia, ib := net.ParseIP(a).To4(), net.ParseIP(b).To4()
+	if ia == nil || ib == nil {
+		return a < b
+	}
+	return bytes.Compare(ia, ib) < 0
+}
@@ -0,0 +1,95 @@
+package iprange
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCIDR(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		want    int
+		wantErr bool
+	}{
+		{cidr: "10.0.0.0/30", want: 2},
+		{cidr: "10.0.0.0/31", want: 2},
+		{cidr: "10.0.0.1/32", want: 1},
+		{cidr: "::ffff:10.0.0.0/120", want: 254},
+		{cidr: "10.0.0.0/8", want: 1<<24 - 2},
+		{cidr: "0.0.0.0/0", wantErr: true},
+		{cidr: "10.0.0.0/7", wantErr: true},
+		{cidr: "::ffff:0:0/96", wantErr: true},
+		{cidr: "2001:db8::/64", wantErr: true},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.cidr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q): %d IPs, esperava um erro", tt.cidr, r.Len())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.cidr, err)
+			continue
+		}
+		if r.Len() != tt.want {
+			t.Errorf("Parse(%q): %d IPs, esperava %d", tt.cidr, r.Len(), tt.want)
+		}
+	}
+}
+
+// A ordem de All, At e Contains em cada formato, sem expandir o /8.
+func TestRangeIteration(t *testing.T) {
+	tests := []struct {
+		rng  string
+		want []string
+	}{
+		{"10.0.0.7", []string{"10.0.0.7"}},
+		{"10.0.0.254-255", []string{"10.0.0.254", "10.0.0.255"}},
+		{"10.0.0-1.1-2", []string{"10.0.0.1", "10.0.0.2", "10.0.1.1", "10.0.1.2"}},
+		{"10.0.0.0/30", []string{"10.0.0.1", "10.0.0.2"}},
+		{"10.0.0.255/31", []string{"10.0.0.254", "10.0.0.255"}},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rng)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.rng, err)
+		}
+		var got []string
+		for n := range r.All() {
+			got = append(got, String(n))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: esperava %v, obteve %v", tt.rng, tt.want, got)
+		}
+		for i, ip := range tt.want {
+			n, _ := Uint32(ip)
+			if r.At(i) != n || !r.Contains(n) {
+				t.Errorf("%s: %s fora da posição %d", tt.rng, ip, i)
+			}
+		}
+	}
+
+	r, _ := Parse("10.0.0-1.1-2")
+	for _, ip := range []string{"10.0.0.3", "10.0.0.255", "10.0.1.0", "10.0.2.1"} {
+		if n, _ := Uint32(ip); r.Contains(n) {
+			t.Errorf("10.0.0-1.1-2 não deveria conter %s", ip)
+		}
+	}
+	r, _ = Parse("10.0.0.0/8")
+	if first, last := String(r.At(0)), String(r.At(r.Len()-1)); first != "10.0.0.1" || last != "10.255.255.254" {
+		t.Errorf("/8: esperava 10.0.0.1 a 10.255.255.254, obteve %s a %s", first, last)
+	}
+}
+
+func TestUint32(t *testing.T) {
+	if n, ok := Uint32("::ffff:10.0.0.1"); !ok || n != 0x0a000001 {
+		t.Errorf("esperava 0x0a000001, obteve %#x (%v)", n, ok)
+	}
+	for _, s := range []string{"2001:db8::1", "-f", "10.0.0.256", ""} {
+		if _, ok := Uint32(s); ok {
+			t.Errorf("Uint32(%q) aceito", s)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Remove comentários // , # e /* */ de um JSON, ignorando o que estiver dentro
+// de strings. Os comentários são trocados por espaços (mantendo as quebras de
+// linha) para que offsets e números de linha dos erros continuem corretos.
+func stripJSONComments(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	inString, escaped := false, false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+		case c == '#' || (c == '/' && i+1 < len(out) && out[i+1] == '/'):
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			start := i
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				line, col := lineCol(data, int64(start))
+				return nil, fmt.Errorf("linha %d, coluna %d: comentário /* não fechado", line, col)
+			}
+			end += i + 2 + 2
+			for ; i < end; i++ {
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+			i--
+		}
+	}
+	return out, nil
+}
+
+// Decodifica JSON com comentários, informando linha e coluna nos erros.
+func unmarshalJSONC(data []byte, v interface{}) error {
+	clean, err := stripJSONComments(data)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(clean, v)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		// Offset já conta o caractere inválido
+		line, col := lineCol(data, max(syntaxErr.Offset-1, 0))
+		return fmt.Errorf("linha %d, coluna %d: %w", line, col, err)
+	case errors.As(err, &typeErr):
+		line, col := lineCol(data, typeErr.Offset)
+		return fmt.Errorf("linha %d, coluna %d: %w", line, col, err)
+	}
+	return err
+}
+
+// Converte um offset em bytes para linha e coluna (base 1).
+func lineCol(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, col := 1, 1
+	for _, c := range data[:offset] {
+		if c == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
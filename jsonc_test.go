@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStripJSONComments(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"a": 1} // fim`, `{"a": 1}       `},
+		{`{"a": 1} # fim`, `{"a": 1}      `},
+		{"{/* x\ny */\"a\": 1}", "{    \n    \"a\": 1}"},
+		{`{"url": "http://zabbix/api", "c": "# não é comentário /* */"}`, `{"url": "http://zabbix/api", "c": "# não é comentário /* */"}`},
+		{`{"s": "aspas \" // dentro"}`, `{"s": "aspas \" // dentro"}`},
+	}
+	for _, tt := range tests {
+		got, err := stripJSONComments([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%q: esperava %q, obteve %q", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestUnmarshalJSONCErrorPosition(t *testing.T) {
+	tests := []struct {
+		name, in string
+		want     string
+	}{
+		{"valor inválido após comentário", "{\n  // comentário\n  \"a\": 1,\n  \"b\": x\n}", "linha 4, coluna 8:"},
+		{"vírgula faltando após bloco", "{\n  /* bloco\n  de duas linhas */ \"a\": 1\n  \"b\": 2\n}", "linha 4, coluna 3:"},
+		{"comentário não fechado", "{\n  \"a\": 1, # fim\n  /* aberto\n}", "linha 3, coluna 3: comentário /* não fechado"},
+		{"fim inesperado", "{\n  \"a\": 1, // fim\n", "linha 2, coluna"},
+	}
+	for _, tt := range tests {
+		var v map[string]interface{}
+		err := unmarshalJSONC([]byte(tt.in), &v)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: esperava erro começando com %q, obteve %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+const commentedConfig = `{
+  // Zabbix de produção
+  "zabbix_url": "http://zabbix.example/api_jsonrpc.php", # com comentário no fim
+  "zabbix_group_ids": ["2"],
+  "snmp_communities": ["public"],
+  /* DC2 storage VLAN
+     não remover */
+  "ranges": ["10.0.0.0/30"],
+  "workers": %s
+}`
+
+func TestLoadConfigCommented(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := loadConfig([]string{writeConfig(t, dir, "discovery.json", fmt.Sprintf(commentedConfig, "10"))}, loadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("configuração comentada não passou na validação: %v", err)
+	}
+
+	path := writeConfig(t, dir, "bad.json", fmt.Sprintf(commentedConfig, `"dez"`))
+	_, err = loadConfig([]string{path}, loadOptions{})
+	if err == nil || !strings.Contains(err.Error(), "linha 9,") || !strings.Contains(err.Error(), "workers") {
+		t.Errorf("esperava erro de tipo do workers na linha 9, obteve %v", err)
+	}
+}
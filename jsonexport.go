@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"discoveryhosts/discovery"
+)
+
+// Versão do formato do arquivo de --output-json. Campos novos podem ser
+// acrescentados; remover ou mudar o significado de um campo exige incrementar.
+const resultsSchemaVersion = 1
+
+type jsonRun struct {
+	RunID       string    `json:"run_id"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	DurationMS  int64     `json:"duration_ms"`
+	ConfigHash  string    `json:"config_hash"`
+	Version     string    `json:"tool_version"`
+	Commit      string    `json:"tool_commit"`
+	BuildDate   string    `json:"tool_build_date"`
+	DryRun      bool      `json:"dry_run"`
+	Interrupted bool      `json:"interrupted"`
+	Deadline    bool      `json:"deadline_reached"`
+	Aborted     bool      `json:"aborted"`
+	AbortCause  string    `json:"abort_cause,omitempty"`
+	// Origem de um run fora da agenda, como trap
+	Trigger string `json:"trigger,omitempty"`
+	// Run do relatório cujas falhas este refez (-retry-from)
+	RetryOf string      `json:"retry_of,omitempty"`
+	Totals  jsonTotals  `json:"totals"`
+	Timings jsonTimings `json:"timings_ms"`
+	// Workers ativos ao longo do run no modo adaptativo
+	Concurrency []jsonConcurrency `json:"concurrency,omitempty"`
+	// Agentes remotos que fizeram o ping e o SNMP de parte dos ranges
+	Agents []jsonAgent `json:"agents,omitempty"`
+	// Servidores de zabbix_targets
+	ZabbixTargets []jsonTargetTotals `json:"zabbix_targets,omitempty"`
+}
+
+type jsonTargetTotals struct {
+	Target   string `json:"target"`
+	Created  int    `json:"created"`
+	Existing int    `json:"existing"`
+	Upgraded int    `json:"upgraded"`
+	Errors   int    `json:"errors"`
+	DryRun   int    `json:"dry_run,omitempty"`
+}
+
+type jsonAgent struct {
+	Name       string   `json:"name"`
+	Ranges     []string `json:"ranges"`
+	Targets    int      `json:"targets"`
+	Scanned    int      `json:"scanned"`
+	NotScanned int      `json:"not_scanned"`
+	Error      string   `json:"error,omitempty"`
+}
+
+type jsonConcurrency struct {
+	AtMS     int64   `json:"at_ms"`
+	Stage    string  `json:"stage"`
+	Workers  int     `json:"workers"`
+	Samples  int     `json:"samples"`
+	FailRate float64 `json:"fail_rate"`
+}
+
+type jsonTotals struct {
+	TargetsExpanded  int            `json:"targets_expanded"`
+	TargetsExcluded  int            `json:"targets_excluded"`
+	TargetsSelf      int            `json:"targets_self,omitempty"`
+	TargetsInvalid   int            `json:"targets_invalid,omitempty"`
+	TargetsDuplicate int            `json:"targets_duplicate,omitempty"`
+	Alive            int            `json:"alive"`
+	SNMPOK           int            `json:"snmp_ok"`
+	PingFailed       map[string]int `json:"ping_failed,omitempty"`
+	SNMPFailed       map[string]int `json:"snmp_failed"`
+	HostsCreated     int            `json:"hosts_created"`
+	HostsExisting    int            `json:"hosts_existing"`
+	HostsDryRun      int            `json:"hosts_dry_run"`
+	HostsCached      int            `json:"hosts_cached"`
+	HostsFallback    int            `json:"hosts_fallback"`
+	HostsUpgraded    int            `json:"hosts_upgraded"`
+	HostsPartial     int            `json:"hosts_partial"`
+	HostsKnown       int            `json:"hosts_known"`
+	HostsFiltered    int            `json:"hosts_filtered"`
+	HostsLimited     int            `json:"hosts_limited"`
+	HostsRecovered   int            `json:"hosts_recovered,omitempty"`
+	CreateLimit      int            `json:"create_limit,omitempty"`
+	PortScanned      int            `json:"ports_scanned"`
+	OpenPorts        map[string]int `json:"open_ports,omitempty"`
+	ZabbixErrors     int            `json:"zabbix_errors"`
+	HostsTimedOut    int            `json:"hosts_timed_out"`
+	NotScanned       int            `json:"not_scanned"`
+	HostsRetried     int            `json:"hosts_retried"`
+	RetriesOK        int            `json:"retries_ok"`
+	Panics           int            `json:"panics"`
+}
+
+func newJSONTotals(s discovery.Summary) jsonTotals {
+	return jsonTotals{
+		TargetsExpanded:  s.TargetsExpanded,
+		TargetsExcluded:  s.TargetsExcluded,
+		TargetsSelf:      s.TargetsSelf,
+		TargetsInvalid:   s.TargetsInvalid,
+		TargetsDuplicate: s.TargetsDuplicate,
+		Alive:            s.Alive,
+		SNMPOK:           s.SNMPOK,
+		PingFailed:       s.PingFailed,
+		SNMPFailed:       s.SNMPFailed,
+		HostsCreated:     s.HostsCreated,
+		HostsExisting:    s.HostsExisting,
+		HostsDryRun:      s.HostsDryRun,
+		HostsCached:      s.HostsCached,
+		HostsFallback:    s.HostsFallback,
+		HostsUpgraded:    s.HostsUpgraded,
+		HostsPartial:     s.HostsPartial,
+		HostsKnown:       s.HostsKnown,
+		HostsFiltered:    s.HostsFiltered,
+		HostsLimited:     s.HostsLimited,
+		HostsRecovered:   s.HostsRecovered,
+		CreateLimit:      s.CreateLimit,
+		PortScanned:      s.PortScanned,
+		OpenPorts:        jsonOpenPorts(s.OpenPorts),
+		ZabbixErrors:     s.ZabbixErrors,
+		HostsTimedOut:    s.HostsTimedOut,
+		NotScanned:       s.NotScanned(),
+		HostsRetried:     s.HostsRetried,
+		RetriesOK:        s.RetriesOK,
+		Panics:           s.Panics,
+	}
+}
+
+type jsonTimings struct {
+	Ping   int64 `json:"ping"`
+	SNMP   int64 `json:"snmp"`
+	Zabbix int64 `json:"zabbix"`
+	Total  int64 `json:"total"`
+}
+
+type jsonHost struct {
+	IP      string      `json:"ip"`
+	Range   string      `json:"range"`
+	AliveBy string      `json:"alive_by"`
+	SNMP    jsonSNMP    `json:"snmp"`
+	Zabbix  *jsonZabbix `json:"zabbix"`
+	Timings jsonTimings `json:"timings_ms"`
+	// Alguma etapa foi interrompida pelo prazo por host
+	TimedOut bool `json:"timed_out,omitempty"`
+	Attempts int  `json:"attempts"`
+	// Agente remoto que fez o ping e o SNMP
+	Agent string `json:"agent,omitempty"`
+	// Portas TCP abertas, só nos ranges do port_scan
+	OpenPorts []int `json:"open_ports,omitempty"`
+	// Origem do run, como trap
+	Trigger string `json:"trigger,omitempty"`
+	// Falhou no run de retry_of e passou sem erro neste
+	Recovered bool `json:"recovered,omitempty"`
+	// Falha do próprio ping, que não testou o host, e o motivo dela
+	PingError  string `json:"ping_error,omitempty"`
+	PingReason string `json:"ping_reason,omitempty"`
+}
+
+type jsonSNMP struct {
+	OK          bool   `json:"ok"`
+	Version     string `json:"version,omitempty"`
+	SysName     string `json:"sysname,omitempty"`
+	SysDescr    string `json:"sysdescr,omitempty"`
+	SysObjectID string `json:"sysobjectid,omitempty"`
+	SysLocation string `json:"syslocation,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorReason string `json:"error_reason,omitempty"`
+}
+
+type jsonZabbix struct {
+	Action string `json:"action"`
+	HostID string `json:"hostid,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Nome DNS de um host cadastrado sem SNMP
+	FallbackName string `json:"fallback_name,omitempty"`
+	// Entrada do known_hosts_file que casou com um host não cadastrado
+	Known string `json:"known,omitempty"`
+	// Cadastro em cada servidor de zabbix_targets
+	Targets []jsonTarget `json:"targets,omitempty"`
+}
+
+type jsonTarget struct {
+	Target     string `json:"target"`
+	Action     string `json:"action"`
+	HostID     string `json:"hostid,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+func newJSONTargets(results []discovery.TargetResult) []jsonTarget {
+	var targets []jsonTarget
+	for _, tr := range results {
+		t := jsonTarget{Target: tr.Target, Action: tr.Action, HostID: tr.HostID, DurationMS: tr.Time.Milliseconds()}
+		if tr.Err != nil {
+			t.Error = tr.Err.Error()
+		}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// Resultados por servidor de volta ao formato do discovery, como no checkpoint.
+func targetResults(targets []jsonTarget) []discovery.TargetResult {
+	var results []discovery.TargetResult
+	for _, t := range targets {
+		tr := discovery.TargetResult{Target: t.Target, Action: t.Action, HostID: t.HostID, Time: time.Duration(t.DurationMS) * time.Millisecond}
+		if t.Error != "" {
+			tr.Err = errors.New(t.Error)
+		}
+		results = append(results, tr)
+	}
+	return results
+}
+
+func msTimings(ping, snmp, zabbix time.Duration) jsonTimings {
+	return jsonTimings{
+		Ping:   ping.Milliseconds(),
+		SNMP:   snmp.Milliseconds(),
+		Zabbix: zabbix.Milliseconds(),
+		Total:  (ping + snmp + zabbix).Milliseconds(),
+	}
+}
+
+func newJSONHost(r discovery.HostResult) jsonHost {
+	h := jsonHost{
+		IP:      r.IP,
+		Range:   r.Range,
+		AliveBy: "ping",
+		SNMP: jsonSNMP{
+			OK:          r.SNMPErr == nil,
+			Version:     r.SNMP.Version,
+			SysName:     r.SNMP.SysName,
+			SysDescr:    r.SNMP.SysDescr,
+			SysObjectID: r.SNMP.SysObjectID,
+			SysLocation: r.SNMP.SysLocation,
+		},
+		Timings:   msTimings(r.PingTime, r.SNMPTime, r.ZabbixTime),
+		TimedOut:  r.TimedOut,
+		Attempts:  r.Attempts,
+		Agent:     r.Agent,
+		OpenPorts: r.OpenPorts,
+		Trigger:   r.Trigger,
+		Recovered: r.Recovered,
+	}
+	if r.PingErr != nil {
+		h.PingError, h.PingReason = r.PingErr.Error(), r.PingReason
+	}
+	if r.SNMPErr != nil {
+		h.SNMP.Error = r.SNMPErr.Error()
+		h.SNMP.ErrorReason = r.SNMPReason
+	}
+	if r.ZabbixAction != "" {
+		h.Zabbix = &jsonZabbix{Action: r.ZabbixAction, HostID: r.HostID, FallbackName: r.FallbackName, Known: r.Known, Targets: newJSONTargets(r.Targets)}
+		if r.ZabbixErr != nil {
+			h.Zabbix.Error = r.ZabbixErr.Error()
+		}
+	}
+	return h
+}
+
+// Hosts com cada porta aberta, com a porta como chave; nil sem nenhuma.
+func jsonOpenPorts(open map[int]int) map[string]int {
+	if len(open) == 0 {
+		return nil
+	}
+	m := make(map[string]int, len(open))
+	for port, n := range open {
+		m[strconv.Itoa(port)] = n
+	}
+	return m
+}
+
+func newJSONRun(s discovery.Summary, cfg Config, dryRun bool) jsonRun {
+	var concurrency []jsonConcurrency
+	for _, c := range s.Concurrency {
+		concurrency = append(concurrency, jsonConcurrency{AtMS: c.At.Milliseconds(), Stage: c.Stage, Workers: c.Workers, Samples: c.Samples, FailRate: c.FailRate})
+	}
+	var agents []jsonAgent
+	for _, a := range s.Agents {
+		agents = append(agents, jsonAgent{Name: a.Name, Ranges: a.Ranges, Targets: a.Targets, Scanned: a.Scanned, NotScanned: a.NotScanned(), Error: a.Error})
+	}
+	var targets []jsonTargetTotals
+	for _, t := range s.Targets {
+		targets = append(targets, jsonTargetTotals{Target: t.Target, Created: t.Created, Existing: t.Existing, Upgraded: t.Upgraded, Errors: t.Errors, DryRun: t.DryRun})
+	}
+	build := currentBuild()
+	return jsonRun{
+		RunID:         s.RunID,
+		Start:         s.Start,
+		End:           s.End,
+		DurationMS:    s.Elapsed().Milliseconds(),
+		ConfigHash:    configHash(cfg),
+		Version:       build.Version,
+		Commit:        build.Commit,
+		BuildDate:     build.BuildDate,
+		DryRun:        dryRun,
+		Interrupted:   s.Interrupted,
+		Deadline:      s.DeadlineReached,
+		Aborted:       s.Aborted,
+		AbortCause:    s.AbortCause,
+		Trigger:       s.Trigger,
+		RetryOf:       s.RetryOf,
+		Totals:        newJSONTotals(s),
+		Timings:       msTimings(s.PingTime, s.SNMPTime, s.ZabbixTime),
+		Concurrency:   concurrency,
+		Agents:        agents,
+		ZabbixTargets: targets,
+	}
+}
+
+// Hash da configuração efetiva (com credenciais mascaradas), para identificar
+// runs feitos com a mesma configuração.
+func configHash(cfg Config) string {
+	var buf bytes.Buffer
+	if err := cfg.writeEffective(&buf); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Grava os resultados em JSON. Os hosts são codificados um a um num arquivo
+// temporário conforme chegam, e o documento final (cabeçalho do run seguido
+// dos hosts) é montado no close, sem manter os resultados em memória.
+type jsonSink struct {
+	path   string
+	cfg    Config
+	dryRun bool
+	spool  *os.File
+	enc    *json.Encoder
+	count  int
+	// Hosts do relatório do -retry-from que não foram refeitos, acrescentados
+	// sem mudança depois dos deste run
+	carried []jsonHost
+}
+
+func newJSONSink(path string, cfg Config, dryRun bool) (*jsonSink, error) {
+	spool, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".hosts*")
+	if err != nil {
+		return nil, fmt.Errorf("falha ao criar %s: %w", path, err)
+	}
+	return &jsonSink{path: path, cfg: cfg, dryRun: dryRun, spool: spool, enc: json.NewEncoder(spool)}, nil
+}
+
+func (s *jsonSink) write(r discovery.HostResult) error {
+	if s.count > 0 {
+		if _, err := s.spool.WriteString(","); err != nil {
+			return err
+		}
+	}
+	s.count++
+	return s.enc.Encode(newJSONHost(r))
+}
+
+func (s *jsonSink) close(sum discovery.Summary) error {
+	for _, h := range s.carried {
+		if s.count > 0 {
+			if _, err := s.spool.WriteString(","); err != nil {
+				return err
+			}
+		}
+		s.count++
+		if err := s.enc.Encode(h); err != nil {
+			return err
+		}
+	}
+	return s.writeDocument(sum)
+}
+
+func (s *jsonSink) abort() {
+	s.spool.Close()
+	os.Remove(s.spool.Name())
+}
+
+func (s *jsonSink) writeDocument(sum discovery.Summary) error {
+	defer os.Remove(s.spool.Name())
+	defer s.spool.Close()
+	if _, err := s.spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("falha ao gravar %s: %w", s.path, err)
+	}
+
+	run, err := json.Marshal(newJSONRun(sum, s.cfg, s.dryRun))
+	if err != nil {
+		return err
+	}
+
+	out, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("falha ao gravar %s: %w", s.path, err)
+	}
+	_, err = fmt.Fprintf(out, "{\"schema_version\":%d,\"run\":%s,\"hosts\":[\n", resultsSchemaVersion, run)
+	if err == nil {
+		_, err = io.Copy(out, s.spool)
+	}
+	if err == nil {
+		_, err = out.WriteString("]}\n")
+	}
+	if err == nil {
+		err = out.Chmod(0o644)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return fmt.Errorf("falha ao gravar %s: %w", s.path, err)
+	}
+	return nil
+}
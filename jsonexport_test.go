@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/snmpinfo"
+	"discoveryhosts/zabbix"
+)
+
+var updateGolden = flag.Bool("update", false, "regrava os arquivos golden de testdata")
+
+// Campos que dependem do binário e da configuração padrão, trocados por um
+// valor fixo antes da comparação.
+var volatileRunFields = regexp.MustCompile(`"(config_hash|tool_version|tool_commit|tool_build_date)": "[^"]*"`)
+
+func TestJSONSinkGolden(t *testing.T) {
+	start := time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)
+	cfg := defaultConfig()
+	cfg.Ranges = []string{"10.0.0.0/29"}
+
+	path := filepath.Join(t.TempDir(), "results.json")
+	sink, err := newJSONSink(path, cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []discovery.HostResult{{
+		IP: "10.0.0.1", Range: "10.0.0.0/29", Alive: true, Attempts: 1,
+		SNMP:         snmpinfo.Info{SysName: "sw-core-01", SysDescr: "Cisco IOS", SysObjectID: "1.3.6.1.4.1.9.1.1", SysLocation: "DC1", Community: "public", Version: "2c"},
+		ZabbixAction: zabbix.Created, HostID: "10101",
+		PingTime: 12 * time.Millisecond, SNMPTime: 40 * time.Millisecond, ZabbixTime: 150 * time.Millisecond,
+	}, {
+		IP: "10.0.0.2", Range: "10.0.0.0/29", Alive: true, Attempts: 2,
+		SNMPErr: errors.New("request timeout"), SNMPReason: snmpinfo.ReasonTimeout,
+		PingTime: 3 * time.Millisecond, SNMPTime: 2 * time.Second,
+	}, {
+		IP: "10.0.0.3", Range: "10.0.0.0/29", Alive: true, Attempts: 1,
+		SNMP:         snmpinfo.Info{SysName: "sw-edge-02", Version: "2c"},
+		ZabbixAction: zabbix.Failed, ZabbixErr: errors.New("Invalid params."),
+		OpenPorts: []int{22, 443},
+	}}
+	for _, r := range results {
+		if err := sink.write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum := discovery.Summary{
+		RunID: "a1b2c3d4", Start: start, End: start.Add(95 * time.Second),
+		TargetsExpanded: 6, Scanned: 6, Alive: 3, SNMPOK: 2,
+		SNMPFailed:   map[string]int{snmpinfo.ReasonTimeout: 1},
+		HostsCreated: 1, ZabbixErrors: 1,
+		PingTime: 18 * time.Millisecond, SNMPTime: 2040 * time.Millisecond, ZabbixTime: 150 * time.Millisecond,
+	}
+	if err := sink.close(sum); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		t.Fatalf("documento não é JSON válido: %v\n%s", err, data)
+	}
+	got := volatileRunFields.ReplaceAll(indented.Bytes(), []byte(`"$1": "<fixo>"`))
+
+	golden := filepath.Join("testdata", "results.golden.json")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("documento difere de %s (rode com -update após uma mudança intencional):\n%s", golden, got)
+	}
+}
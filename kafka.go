@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/kafka"
+)
+
+// Espera máxima entre as tentativas de envio ao Kafka, que dobram a partir
+// de kafka.reconnect_delay.
+const kafkaMaxBackoff = time.Minute
+
+// Valores de kafka.acks
+const (
+	kafkaAcksNone   = "none"   // fire-and-forget
+	kafkaAcksLeader = "leader" // confirmado pelo líder da partição
+	kafkaAcksAll    = "all"    // confirmado por todas as réplicas sincronizadas
+)
+
+// Nomes de tópico aceitos pelo Kafka.
+var kafkaTopicName = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// Kafka configura a produção dos eventos do discovery num cluster Kafka: uma
+// mensagem por host concluído, com o IP como chave, e uma com o resumo no
+// fim do run, ambas no formato do -output ndjson. Problemas com os brokers
+// viram avisos e contadores, nunca interrompem o scan: as mensagens esperam
+// num buffer limitado e as que não couberem são descartadas.
+type Kafka struct {
+	Brokers []string `json:"brokers,omitempty" yaml:"brokers" toml:"brokers"` // host:porta de bootstrap
+	Topic   string   `json:"topic,omitempty" yaml:"topic" toml:"topic"`
+	// Tópico da mensagem de resumo; vazio para o mesmo dos hosts
+	SummaryTopic string `json:"summary_topic,omitempty" yaml:"summary_topic" toml:"summary_topic"`
+	ClientID     string `json:"client_id" yaml:"client_id" toml:"client_id"`
+	// none (fire-and-forget), leader ou all
+	Acks               string `json:"acks" yaml:"acks" toml:"acks"`
+	TLS                bool   `json:"tls,omitempty" yaml:"tls" toml:"tls"`
+	CAFile             string `json:"ca_file,omitempty" yaml:"ca_file" toml:"ca_file"`
+	CertFile           string `json:"cert_file,omitempty" yaml:"cert_file" toml:"cert_file"`
+	KeyFile            string `json:"key_file,omitempty" yaml:"key_file" toml:"key_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+	// PLAIN, SCRAM-SHA-256 ou SCRAM-SHA-512; vazio sem autenticação
+	SASLMechanism  string   `json:"sasl_mechanism,omitempty" yaml:"sasl_mechanism" toml:"sasl_mechanism"`
+	Username       string   `json:"username,omitempty" yaml:"username" toml:"username"`
+	Password       string   `json:"password,omitempty" yaml:"password" toml:"password"`
+	Buffer         int      `json:"buffer" yaml:"buffer" toml:"buffer"`
+	BatchSize      int      `json:"batch_size" yaml:"batch_size" toml:"batch_size"`
+	Timeout        Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+	ReconnectDelay Duration `json:"reconnect_delay" yaml:"reconnect_delay" toml:"reconnect_delay"`
+}
+
+func (k Kafka) validate(c Config) []error {
+	if len(k.Brokers) == 0 {
+		return nil
+	}
+	var errs []error
+	for i, b := range k.Brokers {
+		if _, port, err := net.SplitHostPort(strings.TrimSpace(b)); err != nil || port == "" {
+			errs = append(errs, fmt.Errorf("kafka.brokers[%d] deve ser host:porta (atual: %q)%s", i, b, c.origin("kafka.brokers")))
+		}
+	}
+	if !kafkaTopicName.MatchString(k.Topic) {
+		errs = append(errs, fmt.Errorf("kafka.topic é obrigatório, com letras, dígitos, '.', '_' ou '-' (atual: %q)%s", k.Topic, c.origin("kafka.topic")))
+	}
+	if k.SummaryTopic != "" && !kafkaTopicName.MatchString(k.SummaryTopic) {
+		errs = append(errs, fmt.Errorf("kafka.summary_topic inválido: %q%s", k.SummaryTopic, c.origin("kafka.summary_topic")))
+	}
+	if _, err := k.acks(); err != nil {
+		errs = append(errs, fmt.Errorf("%w%s", err, c.origin("kafka.acks")))
+	}
+	switch k.SASLMechanism {
+	case "":
+	case kafka.SASLPlain, kafka.SASLScramSHA256, kafka.SASLScramSHA512:
+		if k.Username == "" || k.Password == "" {
+			errs = append(errs, fmt.Errorf("kafka.username e kafka.password são obrigatórios com kafka.sasl_mechanism%s", c.origin("kafka.sasl_mechanism")))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("kafka.sasl_mechanism desconhecido: %q (use PLAIN, SCRAM-SHA-256 ou SCRAM-SHA-512)%s", k.SASLMechanism, c.origin("kafka.sasl_mechanism")))
+	}
+	if (k.CertFile == "") != (k.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("kafka.cert_file e kafka.key_file devem ser usados juntos%s", c.origin("kafka")))
+	}
+	if !k.TLS && (k.CAFile != "" || k.CertFile != "" || k.InsecureSkipVerify) {
+		errs = append(errs, fmt.Errorf("kafka.ca_file, kafka.cert_file e kafka.insecure_skip_verify só valem com kafka.tls%s", c.origin("kafka.tls")))
+	}
+	if k.Buffer < 1 {
+		errs = append(errs, fmt.Errorf("kafka.buffer deve ser no mínimo 1 (atual: %d)%s", k.Buffer, c.origin("kafka.buffer")))
+	}
+	if k.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("kafka.batch_size deve ser no mínimo 1 (atual: %d)%s", k.BatchSize, c.origin("kafka.batch_size")))
+	}
+	if time.Duration(k.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("kafka.timeout deve ser positivo%s", c.origin("kafka.timeout")))
+	}
+	if time.Duration(k.ReconnectDelay) <= 0 {
+		errs = append(errs, fmt.Errorf("kafka.reconnect_delay deve ser positivo%s", c.origin("kafka.reconnect_delay")))
+	}
+	return errs
+}
+
+func (k Kafka) redacted() Kafka {
+	k.Password = maskSecret(k.Password)
+	return k
+}
+
+func (k Kafka) acks() (int16, error) {
+	switch k.Acks {
+	case kafkaAcksNone:
+		return kafka.AcksNone, nil
+	case kafkaAcksLeader:
+		return kafka.AcksLeader, nil
+	case kafkaAcksAll:
+		return kafka.AcksAll, nil
+	}
+	return 0, fmt.Errorf("kafka.acks inválido: %q (use none, leader ou all)", k.Acks)
+}
+
+// Opções do produtor, com o TLS (a CA somada às do sistema) e o SASL.
+func (k Kafka) options() (kafka.Options, error) {
+	acks, err := k.acks()
+	if err != nil {
+		return kafka.Options{}, err
+	}
+	opts := kafka.Options{ClientID: k.ClientID, Acks: acks, Timeout: time.Duration(k.Timeout)}
+	if k.SASLMechanism != "" {
+		opts.SASL = &kafka.SASL{Mechanism: k.SASLMechanism, Username: k.Username, Password: k.Password}
+	}
+	if !k.TLS {
+		return opts, nil
+	}
+	opts.TLS = &tls.Config{InsecureSkipVerify: k.InsecureSkipVerify}
+	if k.CAFile != "" {
+		pem, err := ioutil.ReadFile(k.CAFile)
+		if err != nil {
+			return opts, fmt.Errorf("falha ao ler a CA do Kafka %s: %w", k.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return opts, fmt.Errorf("nenhum certificado válido em %s", k.CAFile)
+		}
+		opts.TLS.RootCAs = pool
+	}
+	if k.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(k.CertFile, k.KeyFile)
+		if err != nil {
+			return opts, fmt.Errorf("falha ao ler o certificado de cliente do Kafka %s: %w", k.CertFile, err)
+		}
+		opts.TLS.Certificates = []tls.Certificate{cert}
+	}
+	return opts, nil
+}
+
+type kafkaMessage struct {
+	topic string
+	msg   kafka.Message
+}
+
+// Produz os eventos do run por um único goroutine, em lotes de até
+// kafka.batch_size mensagens. Uma falha (broker fora do ar, líder trocado)
+// gera um aviso e as mensagens não confirmadas são reenviadas, com espera
+// crescente; o write nunca bloqueia e, com o buffer cheio, a mensagem é
+// descartada. No close, as pendentes têm até kafka.timeout para sair antes
+// que as conexões sejam fechadas.
+type kafkaSink struct {
+	cfg      Kafka
+	cfgAll   Config
+	runID    string
+	dryRun   bool
+	producer *kafka.Producer
+
+	queue     chan kafkaMessage
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	delivered atomic.Int32
+	failures  atomic.Int32
+	dropped   atomic.Int32
+}
+
+func newKafkaSink(cfg Config, runID string, dryRun bool) (*kafkaSink, error) {
+	opts, err := cfg.Kafka.options()
+	if err != nil {
+		return nil, err
+	}
+	var brokers []string
+	for _, b := range cfg.Kafka.Brokers {
+		brokers = append(brokers, strings.TrimSpace(b))
+	}
+	s := &kafkaSink{
+		cfg:      cfg.Kafka,
+		cfgAll:   cfg,
+		runID:    runID,
+		dryRun:   dryRun,
+		producer: kafka.NewProducer(brokers, opts),
+		queue:    make(chan kafkaMessage, cfg.Kafka.Buffer),
+		done:     make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go s.run()
+	return s, nil
+}
+
+func (s *kafkaSink) write(r discovery.HostResult) error {
+	value, err := json.Marshal(ndjsonHost{Type: "host", jsonHost: newJSONHost(r)})
+	if err != nil {
+		return err
+	}
+	s.enqueue(kafkaMessage{topic: s.cfg.Topic, msg: kafka.Message{Key: []byte(r.IP), Value: value, Time: time.Now()}})
+	return nil
+}
+
+func (s *kafkaSink) close(sum discovery.Summary) error {
+	value, err := json.Marshal(ndjsonSummary{
+		Type:          "summary",
+		SchemaVersion: resultsSchemaVersion,
+		jsonRun:       newJSONRun(sum, s.cfgAll, s.dryRun),
+		Dropped:       int(s.dropped.Load()),
+	})
+	if err == nil {
+		topic := s.cfg.SummaryTopic
+		if topic == "" {
+			topic = s.cfg.Topic
+		}
+		s.enqueue(kafkaMessage{topic: topic, msg: kafka.Message{Key: []byte(s.runID), Value: value, Time: time.Now()}})
+	}
+	close(s.queue)
+	select {
+	case <-s.done:
+	case <-time.After(time.Duration(s.cfg.Timeout)):
+		logWarn("kafka.shutdown_timeout", s.cfg.Timeout)
+		s.cancel()
+		<-s.done
+	}
+	s.cancel()
+	s.producer.Close()
+	rootLog.Summaryf("summary.kafka", s.delivered.Load(), strings.Join(s.cfg.Brokers, ","), s.failures.Load(), s.dropped.Load())
+	if n := s.dropped.Load(); n > 0 {
+		logWarn("kafka.dropped", n)
+	}
+	return nil
+}
+
+// Desiste dos brokers sem a mensagem do resumo.
+func (s *kafkaSink) abort() {
+	s.cancel()
+	<-s.done
+	s.producer.Close()
+}
+
+// Coloca a mensagem no buffer, descartando-a se estiver cheio.
+func (s *kafkaSink) enqueue(m kafkaMessage) {
+	select {
+	case s.queue <- m:
+	default:
+		if s.dropped.Add(1) == 1 {
+			logWarn("kafka.queue_full", s.cfg.Buffer)
+		}
+	}
+}
+
+// Produtor: esvazia o buffer até o close, em lotes.
+func (s *kafkaSink) run() {
+	defer close(s.done)
+	delay := time.Duration(s.cfg.ReconnectDelay)
+	failing := false
+	closed := false
+	var pending []kafkaMessage
+	for {
+		if len(pending) == 0 {
+			if closed {
+				return
+			}
+			select {
+			case m, ok := <-s.queue:
+				if !ok {
+					return
+				}
+				pending = append(pending, m)
+			case <-s.ctx.Done():
+				s.discard(nil)
+				return
+			}
+		}
+		// Completa o lote com o que já estiver no buffer
+	fill:
+		for !closed && len(pending) < s.cfg.BatchSize {
+			select {
+			case m, ok := <-s.queue:
+				if !ok {
+					closed = true
+					break fill
+				}
+				pending = append(pending, m)
+			default:
+				break fill
+			}
+		}
+		failed, err := s.produce(pending)
+		s.delivered.Add(int32(len(pending) - len(failed)))
+		if err != nil {
+			s.failures.Add(1)
+			failing = true
+			logWarn("kafka.produce_failed", len(failed), err, delay)
+			pending = failed
+			select {
+			case <-time.After(delay):
+			case <-s.ctx.Done():
+				s.discard(pending)
+				return
+			}
+			delay = min(2*delay, kafkaMaxBackoff)
+			continue
+		}
+		if failing {
+			logInfo("kafka.recovered", strings.Join(s.cfg.Brokers, ","))
+			failing = false
+		}
+		pending, delay = nil, time.Duration(s.cfg.ReconnectDelay)
+	}
+}
+
+// Envia o lote, um Produce por tópico, retornando as mensagens não
+// confirmadas.
+func (s *kafkaSink) produce(batch []kafkaMessage) ([]kafkaMessage, error) {
+	var topics []string
+	byTopic := map[string][]kafka.Message{}
+	for _, m := range batch {
+		if _, ok := byTopic[m.topic]; !ok {
+			topics = append(topics, m.topic)
+		}
+		byTopic[m.topic] = append(byTopic[m.topic], m.msg)
+	}
+	var failed []kafkaMessage
+	var firstErr error
+	for _, topic := range topics {
+		undelivered, err := s.producer.Produce(s.ctx, topic, byTopic[topic])
+		for _, m := range undelivered {
+			failed = append(failed, kafkaMessage{topic: topic, msg: m})
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return failed, firstErr
+}
+
+// Conta como descartadas as mensagens em andamento e as que restam no
+// buffer, quando o close desiste de esperar os brokers.
+func (s *kafkaSink) discard(pending []kafkaMessage) {
+	s.dropped.Add(int32(len(s.queue) + len(pending)))
+}
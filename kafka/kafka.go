@@ -0,0 +1,390 @@
+// Package kafka implementa o produtor mínimo de Kafka usado para emitir os
+// eventos do discovery: metadados do tópico, Produce (RecordBatch v2, sem
+// compressão) para o líder de cada partição, TLS e SASL PLAIN ou SCRAM. Não
+// há consumo nem transações; o produtor não é seguro para uso por vários
+// goroutines ao mesmo tempo.
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Confirmações pedidas ao broker (acks do Produce)
+const (
+	AcksNone   = 0  // fire-and-forget: o broker não responde
+	AcksLeader = 1  // gravado no líder da partição
+	AcksAll    = -1 // gravado em todas as réplicas sincronizadas
+)
+
+// Limite de uma resposta do broker.
+const maxResponse = 16 << 20
+
+// Options configura o produtor.
+type Options struct {
+	ClientID string
+	Acks     int16
+	Timeout  time.Duration // da conexão, de cada pedido e do Produce no broker
+	TLS      *tls.Config   // nil sem TLS
+	SASL     *SASL         // nil sem autenticação
+}
+
+// SASL é a autenticação de cada conexão: PLAIN, SCRAM-SHA-256 ou
+// SCRAM-SHA-512.
+type SASL struct {
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// Mecanismos de SASL suportados
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// Partições de um tópico: o id do broker líder de cada uma, pelo índice.
+type topicMeta struct {
+	leaders []int32
+}
+
+// Producer envia mensagens a um cluster a partir dos brokers de bootstrap,
+// conectando sob demanda ao líder de cada partição.
+type Producer struct {
+	bootstrap []string
+	opts      Options
+	brokers   map[int32]string // endereço de cada broker, dos metadados
+	topics    map[string]topicMeta
+	conns     map[string]*conn // por endereço
+	nextID    int32
+}
+
+// NewProducer cria o produtor; nenhuma conexão é aberta antes do primeiro
+// Produce.
+func NewProducer(bootstrap []string, opts Options) *Producer {
+	return &Producer{
+		bootstrap: bootstrap,
+		opts:      opts,
+		brokers:   map[int32]string{},
+		topics:    map[string]topicMeta{},
+		conns:     map[string]*conn{},
+	}
+}
+
+// Produce envia as mensagens ao tópico, um pedido por broker líder, e
+// retorna as que não foram confirmadas (todas as de um broker que falhou)
+// com o primeiro erro. Com AcksNone uma mensagem escrita na conexão conta
+// como entregue. Depois de um erro os metadados do tópico são relidos no
+// próximo Produce.
+func (p *Producer) Produce(ctx context.Context, topic string, msgs []Message) ([]Message, error) {
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	meta, err := p.metadata(ctx, topic)
+	if err != nil {
+		return msgs, err
+	}
+	// Mensagens de cada partição, agrupadas pelo líder
+	byLeader := map[int32]map[int32][]Message{}
+	for _, m := range msgs {
+		partition := int32(partitionFor(m.Key, len(meta.leaders)))
+		leader := meta.leaders[partition]
+		if byLeader[leader] == nil {
+			byLeader[leader] = map[int32][]Message{}
+		}
+		byLeader[leader][partition] = append(byLeader[leader][partition], m)
+	}
+	var failed []Message
+	var firstErr error
+	for leader, partitions := range byLeader {
+		undelivered, err := p.produceTo(ctx, leader, topic, partitions)
+		if err != nil {
+			failed = append(failed, undelivered...)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		delete(p.topics, topic)
+	}
+	return failed, firstErr
+}
+
+func (p *Producer) produceTo(ctx context.Context, leader int32, topic string, partitions map[int32][]Message) ([]Message, error) {
+	var all []Message
+	for _, msgs := range partitions {
+		all = append(all, msgs...)
+	}
+	addr, ok := p.brokers[leader]
+	if !ok {
+		return all, fmt.Errorf("partição sem líder disponível (broker %d)", leader)
+	}
+	c, err := p.conn(ctx, addr)
+	if err != nil {
+		return all, err
+	}
+	var e encoder
+	e.nullableString("") // transactional id
+	e.int16(p.opts.Acks)
+	// O broker desiste na metade do timeout, para que o erro dele chegue
+	// antes do prazo da leitura
+	e.int32(int32(p.opts.Timeout / 2 / time.Millisecond))
+	e.int32(1)
+	e.string(topic)
+	e.int32(int32(len(partitions)))
+	for partition, msgs := range partitions {
+		e.int32(partition)
+		e.bytes(recordBatch(msgs))
+	}
+	if p.opts.Acks == AcksNone {
+		if err := c.send(apiProduce, versionProduce, e); err != nil {
+			p.drop(addr)
+			return all, err
+		}
+		return nil, nil
+	}
+	d, err := c.call(apiProduce, versionProduce, e)
+	if err != nil {
+		p.drop(addr)
+		return all, err
+	}
+	var failed []Message
+	var firstErr error
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		d.string()
+		for j, parts := 0, d.arrayLen(); j < parts; j++ {
+			partition := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if code != 0 && d.err == nil {
+				failed = append(failed, partitions[partition]...)
+				if firstErr == nil {
+					firstErr = Error(code)
+				}
+			}
+		}
+	}
+	if d.err != nil {
+		p.drop(addr)
+		return all, d.err
+	}
+	return failed, firstErr
+}
+
+// Metadados do tópico, consultados num broker de bootstrap (ou num já
+// conhecido) quando ainda não estiverem em cache.
+func (p *Producer) metadata(ctx context.Context, topic string) (topicMeta, error) {
+	if meta, ok := p.topics[topic]; ok {
+		return meta, nil
+	}
+	addrs := append([]string{}, p.bootstrap...)
+	for _, addr := range p.brokers {
+		addrs = append(addrs, addr)
+	}
+	var lastErr error
+	for _, addr := range addrs {
+		meta, err := p.fetchMetadata(ctx, addr, topic)
+		if err == nil {
+			p.topics[topic] = meta
+			return meta, nil
+		}
+		if e, ok := err.(Error); ok && !e.stale() {
+			return topicMeta{}, fmt.Errorf("tópico %s: %w", topic, err)
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return topicMeta{}, fmt.Errorf("metadados do tópico %s indisponíveis: %w", topic, lastErr)
+}
+
+func (p *Producer) fetchMetadata(ctx context.Context, addr, topic string) (topicMeta, error) {
+	c, err := p.conn(ctx, addr)
+	if err != nil {
+		return topicMeta{}, err
+	}
+	var e encoder
+	e.int32(1)
+	e.string(topic)
+	d, err := c.call(apiMetadata, versionMetadata, e)
+	if err != nil {
+		p.drop(addr)
+		return topicMeta{}, err
+	}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		if d.err == nil {
+			p.brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+	}
+	d.int32() // controller
+	var meta topicMeta
+	var topicErr int16
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		code := d.int16()
+		name := d.string()
+		d.int8() // interno
+		for j, parts := 0, d.arrayLen(); j < parts; j++ {
+			d.int16() // erro da partição: o líder ainda pode estar ausente
+			index := d.int32()
+			leader := d.int32()
+			for k, replicas := 0, d.arrayLen(); k < replicas; k++ {
+				d.int32()
+			}
+			for k, isr := 0, d.arrayLen(); k < isr; k++ {
+				d.int32()
+			}
+			if name != topic || index < 0 || d.err != nil {
+				continue
+			}
+			for int(index) >= len(meta.leaders) {
+				meta.leaders = append(meta.leaders, -1)
+			}
+			meta.leaders[index] = leader
+		}
+		if name == topic {
+			topicErr = code
+		}
+	}
+	if d.err != nil {
+		p.drop(addr)
+		return topicMeta{}, d.err
+	}
+	if topicErr != 0 {
+		return topicMeta{}, Error(topicErr)
+	}
+	if len(meta.leaders) == 0 {
+		return topicMeta{}, Error(3)
+	}
+	return meta, nil
+}
+
+// Conexão aberta (e autenticada) com o broker.
+func (p *Producer) conn(ctx context.Context, addr string) (*conn, error) {
+	if c, ok := p.conns[addr]; ok {
+		return c, nil
+	}
+	c, err := dial(ctx, addr, p.opts, &p.nextID)
+	if err != nil {
+		return nil, fmt.Errorf("broker %s: %w", addr, err)
+	}
+	p.conns[addr] = c
+	return c, nil
+}
+
+// Fecha a conexão com um broker que falhou; a próxima é aberta de novo.
+func (p *Producer) drop(addr string) {
+	if c, ok := p.conns[addr]; ok {
+		c.close()
+		delete(p.conns, addr)
+	}
+}
+
+// Close fecha as conexões com os brokers.
+func (p *Producer) Close() error {
+	for addr := range p.conns {
+		p.drop(addr)
+	}
+	return nil
+}
+
+// Conexão com um broker.
+type conn struct {
+	c        net.Conn
+	r        *bufio.Reader
+	clientID string
+	timeout  time.Duration
+	nextID   *int32
+}
+
+func dial(ctx context.Context, addr string, opts Options, nextID *int32) (*conn, error) {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var nc net.Conn
+	var err error
+	if opts.TLS != nil {
+		cfg := opts.TLS
+		if cfg.ServerName == "" {
+			host, _, _ := net.SplitHostPort(addr)
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: cfg}).DialContext(ctx, "tcp", addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{c: nc, r: bufio.NewReader(nc), clientID: opts.ClientID, timeout: opts.Timeout, nextID: nextID}
+	if opts.SASL != nil {
+		if err := c.authenticate(*opts.SASL); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("autenticação SASL: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (c *conn) close() { c.c.Close() }
+
+// Envia um pedido sem esperar resposta, retornando o correlation id.
+func (c *conn) write(api, version int16, body []byte) (int32, error) {
+	*c.nextID++
+	id := *c.nextID
+	var e encoder
+	e.int32(0) // tamanho, preenchido abaixo
+	e.int16(api)
+	e.int16(version)
+	e.int32(id)
+	e.string(c.clientID)
+	e = append(e, body...)
+	binary.BigEndian.PutUint32(e, uint32(len(e)-4))
+	c.c.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.c.Write(e)
+	return id, err
+}
+
+func (c *conn) send(api, version int16, body []byte) error {
+	_, err := c.write(api, version, body)
+	return err
+}
+
+// Envia o pedido e lê a resposta, sem o header.
+func (c *conn) call(api, version int16, body []byte) (*decoder, error) {
+	id, err := c.write(api, version, body)
+	if err != nil {
+		return nil, err
+	}
+	c.c.SetReadDeadline(time.Now().Add(c.timeout))
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > maxResponse {
+		return nil, fmt.Errorf("resposta de %d bytes do broker", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return nil, err
+	}
+	d := &decoder{b: data}
+	if got := d.int32(); got != id {
+		return nil, fmt.Errorf("resposta de outro pedido (correlation id %d, esperava %d)", got, id)
+	}
+	return d, nil
+}
@@ -0,0 +1,229 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Pedido recebido pelo broker falso, sem o header.
+type request struct {
+	api, version int16
+	body         *decoder
+}
+
+// Atende os pedidos de uma conexão com handle até ela fechar; uma resposta
+// nil não é enviada, como no Produce com AcksNone.
+func serveConn(t *testing.T, c net.Conn, handle func(request) []byte) {
+	t.Helper()
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return
+		}
+		d := &decoder{b: data}
+		req := request{api: d.int16(), version: d.int16(), body: d}
+		id := d.int32()
+		d.string() // client id
+		reply := handle(req)
+		if reply == nil {
+			continue
+		}
+		var e encoder
+		e.int32(int32(4 + len(reply)))
+		e.int32(id)
+		e = append(e, reply...)
+		if _, err := c.Write(e); err != nil {
+			return
+		}
+	}
+}
+
+// Broker falso num endereço local, líder de todas as partições do tópico.
+type fakeBroker struct {
+	t          *testing.T
+	addr       string
+	partitions int
+	produceErr int16 // código devolvido em cada partição do Produce
+
+	mu       sync.Mutex
+	produced []producedBatch
+}
+
+type producedBatch struct {
+	acks      int16
+	partition int32
+	batch     []byte
+}
+
+func newFakeBroker(t *testing.T, partitions int) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	b := &fakeBroker{t: t, addr: ln.Addr().String(), partitions: partitions}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(t, c, b.handle)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) handle(req request) []byte {
+	var e encoder
+	switch req.api {
+	case apiMetadata:
+		req.body.arrayLen()
+		topic := req.body.string()
+		host, port, _ := net.SplitHostPort(b.addr)
+		n, _ := strconv.Atoi(port)
+		e.int32(1)
+		e.int32(1) // id do broker
+		e.string(host)
+		e.int32(int32(n))
+		e.int16(-1) // rack
+		e.int32(1)  // controller
+		e.int32(1)
+		e.int16(0)
+		e.string(topic)
+		e.int8(0)
+		e.int32(int32(b.partitions))
+		for p := 0; p < b.partitions; p++ {
+			e.int16(0)
+			e.int32(int32(p))
+			e.int32(1) // líder
+			e.int32(1)
+			e.int32(1)
+			e.int32(1)
+			e.int32(1)
+		}
+	case apiProduce:
+		d := req.body
+		d.string() // transactional id
+		acks := d.int16()
+		d.int32()
+		d.arrayLen()
+		topic := d.string()
+		var parts []int32
+		for i, n := 0, d.arrayLen(); i < n; i++ {
+			partition := d.int32()
+			batch := d.bytes()
+			b.mu.Lock()
+			b.produced = append(b.produced, producedBatch{acks: acks, partition: partition, batch: batch})
+			b.mu.Unlock()
+			parts = append(parts, partition)
+		}
+		if d.err != nil {
+			b.t.Errorf("Produce malformado: %v", d.err)
+		}
+		if acks == AcksNone {
+			return nil
+		}
+		e.int32(1)
+		e.string(topic)
+		e.int32(int32(len(parts)))
+		for _, p := range parts {
+			e.int32(p)
+			e.int16(b.produceErr)
+			e.int64(0)
+			e.int64(-1)
+		}
+		e.int32(0) // throttle
+	default:
+		b.t.Errorf("API inesperada: %d", req.api)
+	}
+	return e
+}
+
+func (b *fakeBroker) batches() []producedBatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]producedBatch{}, b.produced...)
+}
+
+// Mensagens de IPs diferentes, para cair em mais de uma partição.
+func testMessages() []Message {
+	var msgs []Message
+	for i := 1; i <= 8; i++ {
+		msgs = append(msgs, Message{Key: []byte("10.0.0." + strconv.Itoa(i)), Value: []byte("{}"), Time: time.UnixMilli(1700000000000)})
+	}
+	return msgs
+}
+
+func TestProduceAcks(t *testing.T) {
+	for _, acks := range []int16{AcksLeader, AcksAll, AcksNone} {
+		b := newFakeBroker(t, 3)
+		p := NewProducer([]string{b.addr}, Options{ClientID: "test", Acks: acks, Timeout: 2 * time.Second})
+		failed, err := p.Produce(context.Background(), "discovery", testMessages())
+		if err != nil || len(failed) != 0 {
+			t.Fatalf("acks %d: %d mensagens não entregues: %v", acks, len(failed), err)
+		}
+		// Sem resposta do broker, o Produce retorna antes de ele ler o pedido
+		var got []producedBatch
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if got = b.batches(); len(got) > 0 {
+				break
+			}
+		}
+		want := map[int32]int{}
+		for _, m := range testMessages() {
+			want[int32(partitionFor(m.Key, 3))]++
+		}
+		if len(got) != len(want) {
+			t.Errorf("acks %d: esperava %d partições, obteve %d", acks, len(want), len(got))
+		}
+		for _, pb := range got {
+			if pb.acks != acks {
+				t.Errorf("acks %d: pedido com acks %d", acks, pb.acks)
+			}
+			// CRC do attributes ao fim e o número de records, depois dos
+			// timestamps, do produtor e da sequência
+			if crc := binary.BigEndian.Uint32(pb.batch[17:]); crc32.Checksum(pb.batch[21:], castagnoli) != crc {
+				t.Errorf("acks %d: CRC inválido na partição %d", acks, pb.partition)
+			}
+			if n := int(binary.BigEndian.Uint32(pb.batch[57:])); n != want[pb.partition] {
+				t.Errorf("acks %d: partição %d com %d mensagens, esperava %d", acks, pb.partition, n, want[pb.partition])
+			}
+		}
+		p.Close()
+	}
+}
+
+// Um erro do broker devolve as mensagens da partição, e o Produce seguinte
+// relê os metadados.
+func TestProduceBrokerError(t *testing.T) {
+	b := newFakeBroker(t, 1)
+	b.produceErr = 6 // NOT_LEADER_OR_FOLLOWER
+	p := NewProducer([]string{b.addr}, Options{Acks: AcksLeader, Timeout: 2 * time.Second})
+	defer p.Close()
+	msgs := testMessages()
+	failed, err := p.Produce(context.Background(), "discovery", msgs)
+	var kerr Error
+	if !errors.As(err, &kerr) || kerr != 6 || len(failed) != len(msgs) {
+		t.Fatalf("esperava as %d mensagens com NOT_LEADER_OR_FOLLOWER, obteve %d: %v", len(msgs), len(failed), err)
+	}
+	if _, ok := p.topics["discovery"]; ok {
+		t.Error("esperava os metadados descartados depois do erro")
+	}
+}
@@ -0,0 +1,272 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// Chaves das APIs usadas (o header de cada pedido).
+const (
+	apiProduce          = 0
+	apiMetadata         = 3
+	apiSaslHandshake    = 17
+	apiSaslAuthenticate = 36
+)
+
+// Versões usadas de cada API: as mais antigas ainda aceitas pelo Kafka 4,
+// todas sem o formato "flexible" (tagged fields).
+const (
+	versionProduce          = 3
+	versionMetadata         = 1
+	versionSaslHandshake    = 1
+	versionSaslAuthenticate = 0
+)
+
+// Códigos de erro do Kafka com nome na mensagem; os demais aparecem pelo
+// número.
+var errorNames = map[int16]string{
+	1:  "OFFSET_OUT_OF_RANGE",
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	8:  "BROKER_NOT_AVAILABLE",
+	10: "MESSAGE_TOO_LARGE",
+	17: "INVALID_TOPIC_EXCEPTION",
+	18: "RECORD_LIST_TOO_LARGE",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	31: "CLUSTER_AUTHORIZATION_FAILED",
+	33: "UNSUPPORTED_SASL_MECHANISM",
+	34: "ILLEGAL_SASL_STATE",
+	35: "UNSUPPORTED_VERSION",
+	58: "SASL_AUTHENTICATION_FAILED",
+}
+
+// Error é um código de erro devolvido pelo broker.
+type Error int16
+
+func (e Error) Error() string {
+	if name, ok := errorNames[int16(e)]; ok {
+		return fmt.Sprintf("erro do Kafka %d (%s)", int16(e), name)
+	}
+	return fmt.Sprintf("erro do Kafka %d", int16(e))
+}
+
+// Indica um erro resolvido com metadados novos (outro líder, tópico recém
+// criado).
+func (e Error) stale() bool {
+	return e == 3 || e == 5 || e == 6
+}
+
+var errShort = errors.New("resposta truncada do broker")
+
+// Escrita dos tipos do protocolo, em big-endian.
+type encoder []byte
+
+func (e *encoder) int8(v int8)   { *e = append(*e, byte(v)) }
+func (e *encoder) int16(v int16) { *e = binary.BigEndian.AppendUint16(*e, uint16(v)) }
+func (e *encoder) int32(v int32) { *e = binary.BigEndian.AppendUint32(*e, uint32(v)) }
+func (e *encoder) int64(v int64) { *e = binary.BigEndian.AppendUint64(*e, uint64(v)) }
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	*e = append(*e, s...)
+}
+
+// String anulável: vazia vira null.
+func (e *encoder) nullableString(s string) {
+	if s == "" {
+		e.int16(-1)
+		return
+	}
+	e.string(s)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	*e = append(*e, b...)
+}
+
+// Leitura das respostas; o primeiro erro fica em err e as leituras seguintes
+// retornam zero.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShort
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// Quantidade de itens de um array, limitada ao que ainda cabe na resposta.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.b) {
+		d.err = errShort
+		return 0
+	}
+	return int(n)
+}
+
+// Message é uma mensagem a produzir. Mensagens com a mesma chave vão para a
+// mesma partição, pelo mesmo hash (murmur2) do produtor Java.
+type Message struct {
+	Key   []byte
+	Value []byte
+	Time  time.Time
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// RecordBatch (formato v2, sem compressão e sem produtor idempotente) com as
+// mensagens de uma partição.
+func recordBatch(msgs []Message) []byte {
+	base := msgs[0].Time.UnixMilli()
+	maxTime := base
+	var records []byte
+	for i, m := range msgs {
+		ts := m.Time.UnixMilli()
+		maxTime = max(maxTime, ts)
+		var r []byte
+		r = append(r, 0) // attributes
+		r = binary.AppendVarint(r, ts-base)
+		r = binary.AppendVarint(r, int64(i))
+		if m.Key == nil {
+			r = binary.AppendVarint(r, -1)
+		} else {
+			r = binary.AppendVarint(r, int64(len(m.Key)))
+			r = append(r, m.Key...)
+		}
+		r = binary.AppendVarint(r, int64(len(m.Value)))
+		r = append(r, m.Value...)
+		r = binary.AppendVarint(r, 0) // headers
+		records = binary.AppendVarint(records, int64(len(r)))
+		records = append(records, r...)
+	}
+
+	// Do attributes ao fim: a parte coberta pelo CRC
+	var tail encoder
+	tail.int16(0) // attributes: sem compressão, CreateTime
+	tail.int32(int32(len(msgs) - 1))
+	tail.int64(base)
+	tail.int64(maxTime)
+	tail.int64(-1) // producer id
+	tail.int16(-1) // producer epoch
+	tail.int32(-1) // base sequence
+	tail.int32(int32(len(msgs)))
+	tail = append(tail, records...)
+
+	var b encoder
+	b.int64(0)                            // base offset
+	b.int32(int32(4 + 1 + 4 + len(tail))) // leader epoch, magic, crc e o resto
+	b.int32(-1)                           // partition leader epoch
+	b.int8(2)                             // magic
+	b = binary.BigEndian.AppendUint32(b, crc32.Checksum(tail, castagnoli))
+	return append(b, tail...)
+}
+
+// Hash murmur2 do particionador padrão do produtor Java, para que as
+// mensagens de um IP caiam na mesma partição que cairiam com ele.
+func murmur2(data []byte) uint32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	n := len(data)
+	h := uint32(seed) ^ uint32(n)
+	for i := 0; i+4 <= n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	rest := data[n&^3:]
+	switch len(rest) {
+	case 3:
+		h ^= uint32(rest[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(rest[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(rest[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// Partição de uma chave; sem chave, a primeira.
+func partitionFor(key []byte, partitions int) int {
+	if len(key) == 0 || partitions <= 1 {
+		return 0
+	}
+	return int(murmur2(key)&0x7fffffff) % partitions
+}
@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// RecordBatch v2 de uma mensagem, montado campo a campo; o CRC-32C (0xba948bb7)
+// foi calculado à parte, bit a bit.
+const goldenBatch = "0000000000000000" + // base offset
+	"00000047" + // tamanho do batch
+	"ffffffff" + // partition leader epoch
+	"02" + // magic
+	"ba948bb7" + // CRC-32C do attributes ao fim
+	"0000" + // attributes
+	"00000000" + // last offset delta
+	"0000018bcfe56800" + // base timestamp (1700000000000)
+	"0000018bcfe56800" + // max timestamp
+	"ffffffffffffffff" + // producer id
+	"ffff" + // producer epoch
+	"ffffffff" + // base sequence
+	"00000001" + // número de records
+	"2a" + // tamanho do record (21)
+	"00" + // attributes
+	"00" + // timestamp delta
+	"00" + // offset delta
+	"10" + "31302e302e302e31" + // chave 10.0.0.1
+	"0e" + "7b2261223a317d" + // valor {"a":1}
+	"00" // headers
+
+func TestRecordBatchGolden(t *testing.T) {
+	want, err := hex.DecodeString(goldenBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := recordBatch([]Message{{Key: []byte("10.0.0.1"), Value: []byte(`{"a":1}`), Time: time.UnixMilli(1700000000000)}})
+	if !bytes.Equal(got, want) {
+		t.Errorf("batch incorreto:\nobteve   %x\nesperava %x", got, want)
+	}
+}
+
+func TestRecordBatchCRC(t *testing.T) {
+	// Valor de verificação do CRC-32C
+	if got := crc32.Checksum([]byte("123456789"), castagnoli); got != 0xe3069283 {
+		t.Errorf("CRC-32C: esperava 0xe3069283, obteve %#x", got)
+	}
+	base := time.UnixMilli(1700000000000)
+	batch := recordBatch([]Message{
+		{Key: []byte("a"), Value: []byte("1"), Time: base},
+		{Value: []byte("2"), Time: base.Add(5 * time.Millisecond)},
+	})
+	d := decoder{b: batch}
+	d.int64()
+	if n := d.int32(); int(n) != len(batch)-12 {
+		t.Errorf("tamanho do batch: esperava %d, obteve %d", len(batch)-12, n)
+	}
+	d.int32()
+	d.int8()
+	crc := uint32(d.int32())
+	if got := crc32.Checksum(d.b, castagnoli); got != crc {
+		t.Errorf("CRC do batch: gravado %#x, calculado %#x", crc, got)
+	}
+	d.int16()
+	if last := d.int32(); last != 1 {
+		t.Errorf("last offset delta: esperava 1, obteve %d", last)
+	}
+	if first, last := d.int64(), d.int64(); first != base.UnixMilli() || last != base.UnixMilli()+5 {
+		t.Errorf("timestamps: obteve %d e %d", first, last)
+	}
+}
+
+// Valores do Utils.murmur2 do cliente Java (UtilsTest.testMurmur2).
+func TestMurmur2(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int32
+	}{
+		{"21", -973932308},
+		{"foobar", -790332482},
+		{"a-little-bit-long-string", -985981536},
+		{"a-little-bit-longer-string", -1486304829},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+		{"abc", 479470107},
+	}
+	for _, tt := range tests {
+		if got := int32(murmur2([]byte(tt.in))); got != tt.want {
+			t.Errorf("murmur2(%q): esperava %d, obteve %d", tt.in, tt.want, got)
+		}
+	}
+	if p := partitionFor(nil, 6); p != 0 {
+		t.Errorf("sem chave: esperava a partição 0, obteve %d", p)
+	}
+	// toPositive(murmur2) % partições, como no DefaultPartitioner
+	if p := partitionFor([]byte("foobar"), 7); p != int((-790332482&0x7fffffff)%7) {
+		t.Errorf("foobar: partição %d", p)
+	}
+}
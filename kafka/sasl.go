@@ -0,0 +1,145 @@
+package kafka
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// Autentica a conexão: SaslHandshake com o mecanismo e as trocas do
+// SaslAuthenticate (uma no PLAIN, duas no SCRAM).
+func (c *conn) authenticate(s SASL) error {
+	var e encoder
+	e.string(s.Mechanism)
+	d, err := c.call(apiSaslHandshake, versionSaslHandshake, e)
+	if err != nil {
+		return err
+	}
+	code := d.int16()
+	var enabled []string
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		enabled = append(enabled, d.string())
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if code != 0 {
+		return fmt.Errorf("%w; o broker aceita: %s", Error(code), strings.Join(enabled, ", "))
+	}
+	switch s.Mechanism {
+	case SASLPlain:
+		_, err := c.saslAuthenticate([]byte("\x00" + s.Username + "\x00" + s.Password))
+		return err
+	case SASLScramSHA256:
+		return c.scram(s, sha256.New)
+	case SASLScramSHA512:
+		return c.scram(s, sha512.New)
+	}
+	return fmt.Errorf("mecanismo SASL não suportado: %s", s.Mechanism)
+}
+
+func (c *conn) saslAuthenticate(auth []byte) ([]byte, error) {
+	var e encoder
+	e.bytes(auth)
+	d, err := c.call(apiSaslAuthenticate, versionSaslAuthenticate, e)
+	if err != nil {
+		return nil, err
+	}
+	code := d.int16()
+	msg := d.string()
+	reply := d.bytes()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if code != 0 {
+		if msg != "" {
+			return nil, fmt.Errorf("%w: %s", Error(code), msg)
+		}
+		return nil, Error(code)
+	}
+	return reply, nil
+}
+
+// SCRAM (RFC 5802), sem channel binding.
+func (c *conn) scram(s SASL, h func() hash.Hash) error {
+	raw := make([]byte, 18)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	return c.scramExchange(s, h, base64.RawStdEncoding.EncodeToString(raw))
+}
+
+// Trocas do SCRAM com o nonce do cliente.
+func (c *conn) scramExchange(s SASL, h func() hash.Hash, nonce string) error {
+	user := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s.Username)
+	clientFirst := "n=" + user + ",r=" + nonce
+	reply, err := c.saslAuthenticate([]byte("n,," + clientFirst))
+	if err != nil {
+		return err
+	}
+	serverFirst := string(reply)
+	fields := scramFields(serverFirst)
+	if !strings.HasPrefix(fields["r"], nonce) {
+		return fmt.Errorf("SCRAM: nonce do broker inválido")
+	}
+	salt, err := base64.StdEncoding.DecodeString(fields["s"])
+	if err != nil {
+		return fmt.Errorf("SCRAM: salt inválido: %w", err)
+	}
+	iterations, err := strconv.Atoi(fields["i"])
+	if err != nil || iterations < 1 {
+		return fmt.Errorf("SCRAM: número de iterações inválido: %q", fields["i"])
+	}
+	salted, err := pbkdf2.Key(h, s.Password, salt, iterations, h().Size())
+	if err != nil {
+		return err
+	}
+	clientKey := scramHMAC(h, salted, "Client Key")
+	stored := h()
+	stored.Write(clientKey)
+	finalBare := "c=biws,r=" + fields["r"]
+	authMessage := clientFirst + "," + serverFirst + "," + finalBare
+	signature := scramHMAC(h, stored.Sum(nil), authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	reply, err = c.saslAuthenticate([]byte(finalBare + ",p=" + base64.StdEncoding.EncodeToString(proof)))
+	if err != nil {
+		return err
+	}
+	final := scramFields(string(reply))
+	if e := final["e"]; e != "" {
+		return fmt.Errorf("SCRAM: %s", e)
+	}
+	expected := scramHMAC(h, scramHMAC(h, salted, "Server Key"), authMessage)
+	got, err := base64.StdEncoding.DecodeString(final["v"])
+	if err != nil || !hmac.Equal(got, expected) {
+		return fmt.Errorf("SCRAM: assinatura do broker inválida")
+	}
+	return nil
+}
+
+func scramHMAC(h func() hash.Hash, key []byte, msg string) []byte {
+	mac := hmac.New(h, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// Atributos de uma mensagem SCRAM, como "r=...,s=...,i=4096".
+func scramFields(msg string) map[string]string {
+	fields := map[string]string{}
+	for _, part := range strings.Split(msg, ",") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Conexão com uma ponta do net.Pipe; a outra é atendida por handle.
+func pipeConn(t *testing.T, handle func(request) []byte) *conn {
+	t.Helper()
+	client, server := net.Pipe()
+	go serveConn(t, server, handle)
+	t.Cleanup(func() { client.Close() })
+	return &conn{c: client, r: bufio.NewReader(client), timeout: 2 * time.Second, nextID: new(int32)}
+}
+
+// Broker SASL que confere cada mensagem do cliente e responde a seguinte da
+// troca.
+func saslBroker(t *testing.T, mechanism string, exchange []string) func(request) []byte {
+	step := 0
+	return func(req request) []byte {
+		var e encoder
+		switch req.api {
+		case apiSaslHandshake:
+			if got := req.body.string(); got != mechanism {
+				t.Errorf("esperava o mecanismo %s, obteve %s", mechanism, got)
+			}
+			e.int16(0)
+			e.int32(1)
+			e.string(mechanism)
+		case apiSaslAuthenticate:
+			got := string(req.body.bytes())
+			if step+1 >= len(exchange) || got != exchange[step] {
+				t.Errorf("troca %d: obteve %q", step, got)
+				e.int16(58)
+				e.string("falhou")
+				e.bytes(nil)
+				return e
+			}
+			e.int16(0)
+			e.int16(-1)
+			e.bytes([]byte(exchange[step+1]))
+			step += 2
+		}
+		return e
+	}
+}
+
+func TestSASLPlain(t *testing.T) {
+	c := pipeConn(t, saslBroker(t, SASLPlain, []string{"\x00discovery\x00s3nha", ""}))
+	if err := c.authenticate(SASL{Mechanism: SASLPlain, Username: "discovery", Password: "s3nha"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Exemplos do RFC 5802 (SCRAM-SHA-1) e do RFC 7677 (SCRAM-SHA-256).
+var scramVectors = []struct {
+	name   string
+	hash   func() hash.Hash
+	nonce  string
+	server []string // server-first e server-final
+	final  string   // client-final
+}{
+	{
+		"RFC 5802", sha1.New, "fyko+d2lbbFgONRv9qkxdawL",
+		[]string{"r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096", "v=rmF9pqV8S7suAoZWja4dJRkFsKQ="},
+		"c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+	},
+	{
+		"RFC 7677", sha256.New, "rOprNGfwEbeRWgbNEkqO",
+		[]string{"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096", "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="},
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+	},
+}
+
+func TestSCRAMVectors(t *testing.T) {
+	user := SASL{Mechanism: SASLScramSHA256, Username: "user", Password: "pencil"}
+	for _, v := range scramVectors {
+		exchange := []string{"n,,n=user,r=" + v.nonce, v.server[0], v.final, v.server[1]}
+		c := pipeConn(t, saslBroker(t, "", exchange))
+		if err := c.scramExchange(user, v.hash, v.nonce); err != nil {
+			t.Errorf("%s: %v", v.name, err)
+		}
+	}
+}
+
+// Uma assinatura do broker que não confere é recusada, mesmo com a troca
+// aceita.
+func TestSCRAMBadServerSignature(t *testing.T) {
+	v := scramVectors[1]
+	exchange := []string{"n,,n=user,r=" + v.nonce, v.server[0], v.final, "v=" + strings.Repeat("A", 43) + "="}
+	c := pipeConn(t, saslBroker(t, "", exchange))
+	err := c.scramExchange(SASL{Username: "user", Password: "pencil"}, v.hash, v.nonce)
+	if err == nil || !strings.Contains(err.Error(), "assinatura") {
+		t.Errorf("esperava erro da assinatura do broker, obteve %v", err)
+	}
+}
+
+// O nonce do broker precisa começar com o do cliente.
+func TestSCRAMBadNonce(t *testing.T) {
+	exchange := []string{"n,,n=user,r=abc", "r=xyz123,s=QSXCR+Q6sek8bf92,i=4096", "", ""}
+	c := pipeConn(t, saslBroker(t, "", exchange))
+	if err := c.scramExchange(SASL{Username: "user", Password: "pencil"}, sha256.New, "abc"); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("esperava erro do nonce, obteve %v", err)
+	}
+}
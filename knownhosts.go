@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"discoveryhosts/discovery"
+)
+
+// Regras de known_hosts_match: como um host descoberto casa com uma linha do
+// known_hosts_file.
+const (
+	knownByIP   = "ip"   // o IP do host
+	knownByMAC  = "mac"  // o MAC do host na tabela ARP local, quando houver
+	knownByName = "name" // o sysName (ou o nome DNS do fallback), sem diferenciar maiúsculas
+)
+
+// Tabela ARP do Linux, com o MAC dos vizinhos que responderam ao ping.
+const arpTable = "/proc/net/arp"
+
+// Confere o known_hosts_file e as regras de comparação, que precisam ser
+// explícitas.
+func (c Config) validateKnownHosts() []error {
+	if c.KnownHostsFile == "" {
+		return nil
+	}
+	var errs []error
+	if len(c.KnownHostsMatch) == 0 {
+		errs = append(errs, fmt.Errorf("known_hosts_match é obrigatório com known_hosts_file (use ip, mac e/ou name)%s", c.origin("known_hosts_file")))
+	}
+	seen := map[string]bool{}
+	for _, rule := range c.KnownHostsMatch {
+		switch {
+		case !validKnownRule(rule):
+			errs = append(errs, fmt.Errorf("known_hosts_match: regra desconhecida: %q (use ip, mac ou name)%s", rule, c.origin("known_hosts_match")))
+		case seen[rule]:
+			errs = append(errs, fmt.Errorf("known_hosts_match: regra %s repetida%s", rule, c.origin("known_hosts_match")))
+		}
+		seen[rule] = true
+	}
+	for rule, column := range c.KnownHostsColumns {
+		if !validKnownRule(rule) {
+			errs = append(errs, fmt.Errorf("known_hosts_columns: chave desconhecida: %q (use ip, mac ou name)%s", rule, c.origin("known_hosts_columns")))
+		}
+		if strings.TrimSpace(column) == "" {
+			errs = append(errs, fmt.Errorf("known_hosts_columns.%s não pode ser vazio%s", rule, c.origin("known_hosts_columns")))
+		}
+	}
+	if _, err := c.knownDelimiter(); err != nil {
+		errs = append(errs, fmt.Errorf("%w%s", err, c.origin("known_hosts_delimiter")))
+	}
+	return errs
+}
+
+func validKnownRule(rule string) bool {
+	return rule == knownByIP || rule == knownByMAC || rule == knownByName
+}
+
+// Separador das colunas do known_hosts_file: um único caractere.
+func (c Config) knownDelimiter() (rune, error) {
+	d, size := utf8.DecodeRuneInString(c.KnownHostsDelimiter)
+	if size == 0 || size != len(c.KnownHostsDelimiter) || d == '"' || d == '\r' || d == '\n' || d == utf8.RuneError {
+		return 0, fmt.Errorf("known_hosts_delimiter deve ser um único caractere (atual: %q)", c.KnownHostsDelimiter)
+	}
+	return d, nil
+}
+
+// Cabeçalho da coluna de uma regra: o de known_hosts_columns ou o nome da
+// própria regra.
+func (c Config) knownColumn(rule string) string {
+	if column := strings.TrimSpace(c.KnownHostsColumns[rule]); column != "" {
+		return column
+	}
+	return rule
+}
+
+// Hosts do known_hosts_file (um export do CMDB), que não são cadastrados.
+// Cada valor aponta para a linha do arquivo em que aparece primeiro.
+type knownHosts struct {
+	rules []string
+	ips   map[string]int
+	macs  map[string]int
+	names map[string]int
+}
+
+// Carrega o known_hosts_file. A primeira linha é o cabeçalho, com as colunas
+// das regras de known_hosts_match; um arquivo ilegível ou sem uma dessas
+// colunas é um erro. Linhas malformadas não impedem o run: são retornadas,
+// com o número da linha, para que apareçam no log e no validate em vez de
+// serem ignoradas sem aviso.
+func loadKnownHosts(c Config) (*knownHosts, []error, error) {
+	delimiter, err := c.knownDelimiter()
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(c.KnownHostsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("known_hosts_file: %w", err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("known_hosts_file %s: cabeçalho ilegível: %w", c.KnownHostsFile, err)
+	}
+	if len(header) > 0 {
+		// Exports de planilhas costumam começar com o BOM do UTF-8
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	columns := map[string]int{}
+	for _, rule := range c.KnownHostsMatch {
+		name := c.knownColumn(rule)
+		columns[rule] = -1
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				columns[rule] = i
+				break
+			}
+		}
+		if columns[rule] < 0 {
+			return nil, nil, fmt.Errorf("known_hosts_file %s: coluna %q (da regra %s) não encontrada no cabeçalho", c.KnownHostsFile, name, rule)
+		}
+	}
+
+	k := &knownHosts{rules: c.KnownHostsMatch, ips: map[string]int{}, macs: map[string]int{}, names: map[string]int{}}
+	var problems []error
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			problems = append(problems, fmt.Errorf("linha %d: %v", pe.StartLine, pe.Err))
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("known_hosts_file %s: %w", c.KnownHostsFile, err)
+		}
+		line, _ := r.FieldPos(0)
+		if err := k.add(record, columns, line); err != nil {
+			problems = append(problems, fmt.Errorf("linha %d: %w", line, err))
+		}
+	}
+	return k, problems, nil
+}
+
+// Registra uma linha do arquivo; uma linha com algum valor inválido não entra.
+func (k *knownHosts) add(record []string, columns map[string]int, line int) error {
+	values := map[string]string{}
+	empty := true
+	for _, rule := range k.rules {
+		i := columns[rule]
+		if i >= len(record) {
+			return fmt.Errorf("%d campos, sem a coluna da regra %s", len(record), rule)
+		}
+		values[rule] = strings.TrimSpace(record[i])
+		if values[rule] != "" {
+			empty = false
+		}
+	}
+	if empty {
+		return fmt.Errorf("sem valor para nenhuma das regras (%s)", strings.Join(k.rules, ", "))
+	}
+	if v := values[knownByIP]; v != "" {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return fmt.Errorf("IP inválido: %q", v)
+		}
+		values[knownByIP] = ip.String()
+	}
+	if v := values[knownByMAC]; v != "" {
+		mac, err := parseMAC(v)
+		if err != nil {
+			return fmt.Errorf("MAC inválido: %q", v)
+		}
+		values[knownByMAC] = mac
+	}
+	for rule, index := range map[string]map[string]int{knownByIP: k.ips, knownByMAC: k.macs, knownByName: k.names} {
+		v := values[rule]
+		if rule == knownByName {
+			v = strings.ToLower(v)
+		}
+		if _, dup := index[v]; v != "" && !dup {
+			index[v] = line
+		}
+	}
+	return nil
+}
+
+// MAC no formato aa:bb:cc:dd:ee:ff, aceitando também o formato sem
+// separadores de alguns CMDBs (aabbccddeeff).
+func parseMAC(s string) (string, error) {
+	if len(s) == 12 && !strings.ContainsAny(s, ":-.") {
+		var b strings.Builder
+		for i := 0; i < 12; i += 2 {
+			if i > 0 {
+				b.WriteByte(':')
+			}
+			b.WriteString(s[i : i+2])
+		}
+		s = b.String()
+	}
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		return "", err
+	}
+	return mac.String(), nil
+}
+
+// Entrada que casa com o host, na ordem de known_hosts_match, como "ip
+// 10.0.0.1 (linha 12)"; vazio se nenhuma casar.
+func (k *knownHosts) match(r discovery.HostResult) string {
+	for _, rule := range k.rules {
+		var value string
+		var index map[string]int
+		switch rule {
+		case knownByIP:
+			if ip := net.ParseIP(r.IP); ip != nil {
+				value = ip.String()
+			}
+			index = k.ips
+		case knownByMAC:
+			value, index = neighborMAC(r.IP), k.macs
+		case knownByName:
+			value, index = strings.ToLower(strings.TrimSpace(r.Name())), k.names
+		}
+		if line, ok := index[value]; ok && value != "" {
+			return fmt.Sprintf("%s %s (linha %d)", rule, value, line)
+		}
+	}
+	return ""
+}
+
+// Função de Config.Known do discovery; nil sem known_hosts_file.
+func (k *knownHosts) matcher() func(discovery.HostResult) string {
+	if k == nil {
+		return nil
+	}
+	return k.match
+}
+
+// Quantidade de entradas carregadas, somando as regras.
+func (k *knownHosts) entries() int {
+	return len(k.ips) + len(k.macs) + len(k.names)
+}
+
+// MAC do IP na tabela ARP local. Só os hosts do mesmo segmento de rede (e
+// não os dos agentes remotos) aparecem nela, depois do ping; vazio se o IP
+// não estiver lá ou fora do Linux.
+func neighborMAC(ip string) string {
+	f, err := os.Open(arpTable)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // cabeçalho
+	for scanner.Scan() {
+		// IP address, HW type, Flags, HW address, Mask, Device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != ip {
+			continue
+		}
+		// Flags 0x0: entrada incompleta, sem resposta ao ARP
+		if fields[2] == "0x0" {
+			return ""
+		}
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil {
+			return ""
+		}
+		return mac.String()
+	}
+	return ""
+}
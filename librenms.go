@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"discoveryhosts/librenms"
+	"discoveryhosts/zabbix"
+)
+
+// LibreNMS configura o cadastro dos hosts identificados como devices do
+// LibreNMS, com librenms em backends, junto ou no lugar de zabbix.
+type LibreNMS struct {
+	URL   string `json:"url,omitempty" yaml:"url" toml:"url"`
+	Token string `json:"token,omitempty" yaml:"token" toml:"token"`
+	// Cadastra sem os testes de ICMP e SNMP que o LibreNMS faz a partir do
+	// poller dele
+	ForceAdd bool     `json:"force_add" yaml:"force_add" toml:"force_add"`
+	Timeout  Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+func (l LibreNMS) validate(c Config) []error {
+	if !c.backend(backendLibreNMS) {
+		return nil
+	}
+	var errs []error
+	if l.URL == "" || l.Token == "" {
+		errs = append(errs, fmt.Errorf("librenms.url e librenms.token são obrigatórios com o backend librenms%s", c.origin("backends")))
+	}
+	if time.Duration(l.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("librenms.timeout deve ser positivo%s", c.origin("librenms.timeout")))
+	}
+	return errs
+}
+
+func (l LibreNMS) redacted() LibreNMS {
+	l.Token = maskSecret(l.Token)
+	return l
+}
+
+// Campos do Zabbix preenchidos na configuração, ignorados num run sem o
+// backend zabbix.
+func (c Config) ignoredZabbixKeys() []string {
+	var keys []string
+	for _, f := range []struct {
+		key string
+		set bool
+	}{
+		{"zabbix_url", c.ZabbixURL != ""},
+		{"zabbix_user", c.ZabbixUser != ""},
+		{"zabbix_pass", c.ZabbixPass != ""},
+		{"zabbix_group_ids", len(c.ZabbixGroupIDs) > 0},
+		{"zabbix_proxy_id", c.ZabbixProxyID != "" && c.ZabbixProxyID != "0"},
+		{"zabbix_targets", len(c.ZabbixTargets) > 0},
+	} {
+		if f.set {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
+}
+
+// Cadastro do discovery no LibreNMS: implementa discovery.HostCreator com o
+// IP como hostname do device e o nome do host como display, para que os
+// resultados e os relatórios sejam os mesmos do Zabbix (o hostid é o
+// device_id). Hosts cadastrados sem SNMP viram devices só de ping.
+type librenmsCreator struct {
+	client   *librenms.Client
+	forceAdd bool
+}
+
+func newLibreNMSCreator(cfg LibreNMS) librenmsCreator {
+	return librenmsCreator{client: librenms.NewClient(cfg.URL, cfg.Token, time.Duration(cfg.Timeout)), forceAdd: cfg.ForceAdd}
+}
+
+func (l librenmsCreator) Ensure(ctx context.Context, spec zabbix.HostSpec) (string, string, error) {
+	action, id, err := l.client.EnsureDevice(ctx, librenms.DeviceSpec{
+		Hostname:    spec.IP,
+		Display:     spec.Name,
+		Community:   spec.Community,
+		SNMPDisable: spec.Interface != "" && spec.Interface != zabbix.InterfaceSNMP,
+		ForceAdd:    l.forceAdd,
+	})
+	switch action {
+	case librenms.Created:
+		return zabbix.Created, id, nil
+	case librenms.Existing:
+		return zabbix.Existing, id, nil
+	}
+	return zabbix.Failed, id, err
+}
+
+// Avisa, no início do run, dos campos do Zabbix que os backends librenms e
+// icinga2 ignoram, quando o zabbix não está junto deles.
+func (c Config) warnIgnoredZabbix() {
+	keys := c.ignoredZabbixKeys()
+	switch {
+	case len(keys) == 0 || c.backend(backendZabbix):
+	case c.backend(backendLibreNMS):
+		logWarn("librenms.zabbix_ignored", strings.Join(keys, ", "))
+	case c.backend(backendIcinga2):
+		logWarn("icinga2.zabbix_ignored", strings.Join(keys, ", "))
+	}
+}
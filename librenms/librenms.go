@@ -0,0 +1,199 @@
+// Package librenms implementa o cliente mínimo da API do LibreNMS (v0) usado
+// para cadastrar os hosts descobertos como devices.
+package librenms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resultado de EnsureDevice
+const (
+	Created  = "created"
+	Existing = "existing"
+	Failed   = "failed"
+)
+
+// HTTPError é uma resposta de erro da API, com a mensagem do LibreNMS (ou o
+// início do corpo, se não for JSON).
+type HTTPError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API do LibreNMS respondeu HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("API do LibreNMS respondeu HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Client é um cliente mínimo da API do LibreNMS, autenticado pelo token
+// (X-Auth-Token).
+type Client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+// NewClient cria um cliente para a URL base do LibreNMS (sem o /api/v0).
+func NewClient(baseURL, token string, timeout time.Duration) *Client {
+	return &Client{url: strings.TrimRight(baseURL, "/"), token: token, http: &http.Client{Timeout: timeout}}
+}
+
+// Corpo comum das respostas da API.
+type apiResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// Faz uma chamada à API; result pode ser nil.
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+"/api/v0"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		var ar apiResponse
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &ar) == nil && ar.Message != "" {
+			msg = ar.Message
+		}
+		return &HTTPError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("resposta inválida da API do LibreNMS em %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// Version consulta a versão do LibreNMS (GET /system).
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var resp struct {
+		System []struct {
+			LocalVer string `json:"local_ver"`
+		} `json:"system"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/system", nil, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.System) == 0 {
+		return "", fmt.Errorf("resposta sem a versão do LibreNMS")
+	}
+	return resp.System[0].LocalVer, nil
+}
+
+// DeviceSpec descreve o device de um host descoberto. Hostname é o endereço
+// consultado pelo LibreNMS (aqui, o IP) e Display, o nome exibido.
+type DeviceSpec struct {
+	Hostname  string
+	Display   string
+	Community string // SNMP v2c; vazio com SNMPDisable
+	// Sem SNMP o device é monitorado só por ping
+	SNMPDisable bool
+	// Cadastra sem os testes de ICMP e SNMP que o LibreNMS faz antes
+	ForceAdd bool
+}
+
+type device struct {
+	DeviceID int `json:"device_id"`
+}
+
+// Lookup retorna o id do device com esse hostname (ou IP), ou 0 se não
+// houver nenhum.
+func (c *Client) Lookup(ctx context.Context, hostname string) (int, error) {
+	var found struct {
+		Devices []device `json:"devices"`
+	}
+	err := c.do(ctx, http.MethodGet, "/devices/"+url.PathEscape(hostname), nil, &found)
+	var he *HTTPError
+	if errors.As(err, &he) && he.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(found.Devices) == 0 {
+		return 0, nil
+	}
+	return found.Devices[0].DeviceID, nil
+}
+
+// Id na mensagem do cadastro das versões que não devolvem o device, como
+// "Device 10.0.0.1 (57) has been added successfully".
+var addedID = regexp.MustCompile(`\((\d+)\) has been added`)
+
+// EnsureDevice cadastra o device se ainda não houver um com o mesmo
+// hostname, retornando Existing com o id do atual caso contrário. Os campos
+// de um device existente não são alterados.
+func (c *Client) EnsureDevice(ctx context.Context, spec DeviceSpec) (string, string, error) {
+	id, err := c.Lookup(ctx, spec.Hostname)
+	if err != nil {
+		return Failed, "", err
+	}
+	if id > 0 {
+		return Existing, strconv.Itoa(id), nil
+	}
+	body := map[string]interface{}{
+		"hostname":  spec.Hostname,
+		"force_add": spec.ForceAdd,
+	}
+	if spec.Display != "" {
+		body["display"] = spec.Display
+	}
+	if spec.SNMPDisable {
+		body["snmp_disable"] = true
+		body["os"] = "ping"
+	} else {
+		body["version"] = "v2c"
+		body["community"] = spec.Community
+	}
+	var added struct {
+		apiResponse
+		Devices []device `json:"devices"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/devices", body, &added); err != nil {
+		return Failed, "", err
+	}
+	if len(added.Devices) > 0 {
+		return Created, strconv.Itoa(added.Devices[0].DeviceID), nil
+	}
+	if m := addedID.FindStringSubmatch(added.Message); m != nil {
+		return Created, m[1], nil
+	}
+	// Cadastrado, mas sem o id na resposta
+	return Created, "", nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"discoveryhosts/iprange"
+)
+
+// Subcomando list: mostra, um por linha e sem enviar nenhum pacote, os IPs que
+// o scan verificaria — os ranges expandidos (sem rede e broadcast), sem os
+// reservados no phpIPAM e sem repetições entre ranges. A saída é ordenada,
+// para comparar revisões da configuração com diff. Retorna o código de saída.
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	lf := addLogFlags(fs)
+	var ranges stringList
+	fs.Var(&ranges, "range", "range a listar no lugar dos da configuração, ex.: 10.91.50-51.1-14; pode ser repetido")
+	countOnly := fs.Bool("count-only", false, "mostra só a quantidade de IPs")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: discoveryhosts list [-config arquivo | -range range...] [-count-only]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := lf.setup(logFormatText, false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Com -range a configuração só é lida se informada, pelos reservados
+	var cfg Config
+	if len(ranges) == 0 || len(cf.paths) > 0 {
+		var err error
+		cfg, err = cf.load()
+		if err == nil {
+			if err = cfg.validate(); err != nil {
+				err = fmt.Errorf("configuração inválida: %w", err)
+			}
+		}
+		if err == nil {
+			cfg, err = cfg.resolveRanges(context.Background())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ERRO] %v\n", err)
+			return 1
+		}
+	}
+	owners := cfg.rangeAgents()
+	if len(ranges) > 0 {
+		cfg.Ranges = ranges
+	}
+
+	seen := map[string]bool{}
+	self := cfg.selfTargets()
+	var ips []string
+	failed := false
+	for _, r := range cfg.Ranges {
+		r = strings.TrimSpace(r)
+		expanded, err := iprange.Expand(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ERRO] range %s inválido: %v\n", r, err)
+			failed = true
+			continue
+		}
+		// Os ranges dos agentes vão inteiros, como no run
+		_, remote := owners[r]
+		for _, ip := range expanded {
+			if seen[ip] || !remote && (cfg.excluded[ip] || self != nil && self(netip.MustParseAddr(ip))) {
+				continue
+			}
+			seen[ip] = true
+			ips = append(ips, ip)
+		}
+	}
+	if failed {
+		return 1
+	}
+	sort.Slice(ips, func(i, j int) bool { return iprange.Less(ips[i], ips[j]) })
+
+	if *countOnly {
+		fmt.Println(len(ips))
+		return 0
+	}
+	for _, ip := range ips {
+		fmt.Println(ip)
+	}
+	return 0
+}
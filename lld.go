@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/zabbix"
+)
+
+// LLD configura o envio dos hosts identificados a uma regra de low-level
+// discovery (item trapper), no protocolo do zabbix_sender, em vez do cadastro
+// direto: os host prototypes da regra definem templates e nomes. Só os ranges
+// de ranges vão para o LLD; os demais seguem cadastrados pela API.
+type LLD struct {
+	Server  string   `json:"server,omitempty" yaml:"server" toml:"server"`
+	Host    string   `json:"host,omitempty" yaml:"host" toml:"host"` // host do Zabbix com a regra
+	Key     string   `json:"key" yaml:"key" toml:"key"`
+	Timeout Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+	Ranges  []string `json:"ranges,omitempty" yaml:"ranges" toml:"ranges"`
+}
+
+func (l LLD) validate(c Config) []error {
+	if len(l.Ranges) == 0 {
+		return nil
+	}
+	var errs []error
+	if l.Server == "" || l.Host == "" {
+		errs = append(errs, fmt.Errorf("lld.server e lld.host são obrigatórios com lld.ranges%s", c.origin("lld.ranges")))
+	}
+	if strings.TrimSpace(l.Key) == "" {
+		errs = append(errs, fmt.Errorf("lld.key não pode ser vazio%s", c.origin("lld.key")))
+	}
+	if time.Duration(l.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("lld.timeout deve ser positivo%s", c.origin("lld.timeout")))
+	}
+	ranges := map[string]bool{}
+	for _, r := range c.Ranges {
+		ranges[strings.TrimSpace(r)] = true
+	}
+	for i, r := range l.Ranges {
+		if !ranges[strings.TrimSpace(r)] {
+			errs = append(errs, fmt.Errorf("lld.ranges: o range %q não está em ranges%s", r, c.origin(fmt.Sprintf("lld.ranges[%d]", i))))
+		}
+	}
+	return errs
+}
+
+// Endereço do trapper, com a porta padrão se omitida.
+func (l LLD) address() string {
+	if _, _, err := net.SplitHostPort(l.Server); err == nil {
+		return l.Server
+	}
+	return net.JoinHostPort(l.Server, zabbixSenderPort)
+}
+
+// Ranges do LLD, que ficam fora do cadastro direto; nil sem nenhum.
+func (l LLD) rangeSet() map[string]bool {
+	if len(l.Ranges) == 0 {
+		return nil
+	}
+	set := map[string]bool{}
+	for _, r := range l.Ranges {
+		set[strings.TrimSpace(r)] = true
+	}
+	return set
+}
+
+// Junta os hosts identificados dos ranges do LLD e os envia, num único valor,
+// ao item trapper no close. O LLD trata os hosts ausentes do valor como
+// perdidos, então um run parcial não envia nada.
+type lldSink struct {
+	cfg    LLD
+	ranges map[string]bool
+	rows   []map[string]string
+}
+
+func newLLDSink(cfg LLD) *lldSink {
+	return &lldSink{cfg: cfg, ranges: cfg.rangeSet()}
+}
+
+func (s *lldSink) write(r discovery.HostResult) error {
+	if !s.ranges[r.Range] || r.SNMPErr != nil || r.SNMP.SysName == "" {
+		return nil
+	}
+	s.rows = append(s.rows, map[string]string{
+		"{#IP}":       r.IP,
+		"{#SYSNAME}":  r.SNMP.SysName,
+		"{#SYSDESCR}": r.SNMP.SysDescr,
+		"{#RANGE}":    r.Range,
+	})
+	return nil
+}
+
+func (s *lldSink) close(sum discovery.Summary) error {
+	if sum.Partial() || sum.Aborted || sum.Targeted {
+		logWarn("lld.partial", len(s.rows))
+		return nil
+	}
+	rows := s.rows
+	if rows == nil {
+		rows = []map[string]string{}
+	}
+	value, err := json.Marshal(map[string]interface{}{"data": rows})
+	if err != nil {
+		return err
+	}
+	item := zabbix.SenderItem{Host: s.cfg.Host, Key: s.cfg.Key, Value: string(value), Clock: sum.End.Unix()}
+	info, err := zabbix.Send(s.cfg.address(), time.Duration(s.cfg.Timeout), []zabbix.SenderItem{item})
+	if err != nil {
+		logError("lld.failed", len(rows), s.cfg.address(), err)
+		return nil
+	}
+	rootLog.Summaryf("summary.lld", len(rows), s.cfg.Host, s.cfg.Key, info)
+	return nil
+}
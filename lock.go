@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Intervalo entre as tentativas de pegar o lock com -lock-wait.
+const lockRetryInterval = 500 * time.Millisecond
+
+// Lock do lock_file, que impede dois scans (do cron, do -daemon) ao mesmo
+// tempo. É um flock: o sistema o solta quando o processo termina, mesmo num
+// crash ou num kill -9, então um arquivo que sobrou de um run anterior nunca
+// bloqueia o seguinte.
+type runLock struct {
+	f    *os.File
+	path string
+}
+
+// Erro de acquireLock com o lock em uso por outra instância.
+type lockBusyError struct {
+	path   string
+	holder string // PID e início de quem tem o lock, como gravados no arquivo
+}
+
+func (e *lockBusyError) Error() string {
+	if e.holder == "" {
+		return e.path + " em uso"
+	}
+	return fmt.Sprintf("%s em uso (%s)", e.path, e.holder)
+}
+
+// Pega o lock de path, esperando até wait se outra instância o tiver. O
+// arquivo passa a ter o PID e o início deste processo.
+func acquireLock(path string, wait time.Duration) (*runLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao abrir o lock_file %s: %w", path, err)
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("falha ao travar o lock_file %s: %w", path, err)
+		}
+		if ok {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, &lockBusyError{path: path, holder: lockHolder(path)}
+		}
+		time.Sleep(min(lockRetryInterval, time.Until(deadline)))
+	}
+	// Um PID no arquivo sem o flock é de um run que terminou sem soltá-lo
+	if prev := lockHolder(path); prev != "" {
+		logInfo("lock.stale", path, prev)
+	}
+	l := &runLock{f: f, path: path}
+	f.Truncate(0)
+	fmt.Fprintf(f, "pid %d, desde %s\n", os.Getpid(), time.Now().Format(time.RFC3339))
+	f.Sync()
+	return l, nil
+}
+
+// Dono do lock como gravado no arquivo; vazio sem nenhum.
+func lockHolder(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Solta o lock. O arquivo fica, vazio: apagá-lo deixaria outra instância
+// travar o arquivo antigo enquanto uma terceira cria um novo.
+func (l *runLock) release() {
+	if l == nil {
+		return
+	}
+	l.f.Truncate(0)
+	unlock(l.f)
+	l.f.Close()
+}
+
+// Indica se err é o de um lock em uso por outra instância.
+func isLockBusy(err error) bool {
+	var busy *lockBusyError
+	return errors.As(err, &busy)
+}
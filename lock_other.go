@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func tryLock(*os.File) (bool, error) {
+	return false, fmt.Errorf("lock_file não é suportado neste sistema operacional")
+}
+
+func unlock(*os.File) {}
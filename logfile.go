@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Arquivo de log com rotação por tamanho: ao passar de maxSize, o atual vira
+// <arquivo>.1, o .1 vira .2 e assim por diante até maxBackups. Seguro para
+// escrita concorrente.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSizeMB, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: int64(maxSizeMB) << 20, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if r.maxBackups == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", r.path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Writer que para de escrever no arquivo após a primeira falha, avisando uma
+// única vez em fallback, para que um disco cheio não derrube o scan. Com
+// redirect, as linhas seguintes passam a ir para fallback.
+type degradingWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	fallback io.Writer
+	redirect bool
+	name     string
+	failed   bool
+}
+
+func (d *degradingWriter) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.failed {
+		_, err := d.w.Write(p)
+		if err == nil {
+			return len(p), nil
+		}
+		d.failed = true
+		fmt.Fprintf(d.fallback, "[WARN] Falha ao gravar no arquivo de log %s, continuando apenas na saída de erro: %v\n", d.name, err)
+	}
+	if d.redirect {
+		d.fallback.Write(p)
+	}
+	return len(p), nil
+}
+
+// Arquivo do -log-file, que o painel do -tui continua a receber; nil sem ele.
+var logFile io.Writer
+
+// Passa a gravar os logs também (ou apenas, com fileOnly) em path, com rotação.
+func attachLogFile(path string, maxSizeMB, maxBackups int, fileOnly bool) error {
+	f, err := openRotatingFile(path, maxSizeMB, maxBackups)
+	if err != nil {
+		return fmt.Errorf("falha ao abrir arquivo de log %s: %w", path, err)
+	}
+	var w io.Writer = &degradingWriter{w: f, fallback: os.Stderr, redirect: fileOnly, name: path}
+	logFile = w
+	if !fileOnly {
+		w = io.MultiWriter(os.Stderr, w)
+	}
+	setLogOutput(w)
+	return nil
+}
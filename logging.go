@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"discoveryhosts/i18n"
+	"discoveryhosts/logx"
+)
+
+var logLevelNames = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// Nível mínimo das mensagens escritas, ajustado pelas flags.
+var logLevel = new(slog.LevelVar)
+
+// Logger usado por toda a ferramenta; o formato é escolhido em setupLogging.
+var rootLog = logx.New(slog.New(newTextHandler(os.Stderr, logLevel)))
+
+func parseLogLevel(s string) (slog.Level, error) {
+	level, ok := logLevelNames[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("nível de log inválido: %s (use debug, info, warn ou error)", s)
+	}
+	return level, nil
+}
+
+// Formatos de log suportados
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Formato, destino e identificador do run atuais dos logs.
+var (
+	logFormat           = logFormatText
+	logOutput io.Writer = os.Stderr
+	logRunID  string
+	logSyslog slog.Handler // enviado também ao syslog, se configurado
+)
+
+// Gera um identificador curto para o run, anexado a cada linha de log para
+// separar execuções agendadas que se sobrepõem.
+func newRunID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Passa a incluir o run ID em todas as mensagens.
+func setLogRunID(id string) {
+	logRunID = id
+	setLogOutput(logOutput)
+}
+
+// Configura o nível e o formato dos logs.
+func setupLogging(format string, level slog.Level) error {
+	if format != logFormatText && format != logFormatJSON {
+		return fmt.Errorf("formato de log inválido: %s (use text ou json)", format)
+	}
+	logLevel.Set(level)
+	logFormat = format
+	setLogOutput(logOutput)
+	return nil
+}
+
+// Troca o destino dos logs, mantendo formato e nível.
+func setLogOutput(w io.Writer) {
+	logOutput = w
+	if logFormat == logFormatJSON {
+		h := newJSONLogHandler(w, logLevel)
+		rootLog = newRootLog(h)
+		// Erros fatais ainda usam o pacote log; também saem como JSON
+		log.SetFlags(0)
+		log.SetOutput(slog.NewLogLogger(h, slog.LevelError).Writer())
+		return
+	}
+	rootLog = newRootLog(newTextHandler(w, logLevel))
+	log.SetOutput(w)
+}
+
+func newRootLog(h slog.Handler) logx.Logger {
+	if logSyslog != nil {
+		h = multiHandler{h, logSyslog}
+	}
+	l := logx.New(slog.New(h))
+	if logRunID != "" {
+		l = l.With("run_id", logRunID)
+	}
+	return l
+}
+
+func logDebug(code string, args ...interface{}) { rootLog.Debugf(code, args...) }
+
+func logInfo(code string, args ...interface{}) { rootLog.Infof(code, args...) }
+
+func logWarn(code string, args ...interface{}) { rootLog.Warnf(code, args...) }
+
+func logError(code string, args ...interface{}) { rootLog.Errorf(code, args...) }
+
+// Etiqueta da linha no formato texto: [WARN]/[ERRO] para avisos e erros e,
+// nos demais níveis, a etapa ([PING], [SNMP], [ZABBIX]) quando houver.
+func textTag(level slog.Level, stage string) string {
+	switch {
+	case level >= logx.LevelSummary && i18n.Current() == i18n.EN:
+		return "[SUMMARY]"
+	case level >= logx.LevelSummary:
+		return "[RESUMO]"
+	case level >= slog.LevelError && i18n.Current() == i18n.EN:
+		return "[ERROR]"
+	case level >= slog.LevelError:
+		return "[ERRO]"
+	case level >= slog.LevelWarn:
+		return "[WARN]"
+	case stage != "":
+		return "[" + strings.ToUpper(stage) + "]"
+	case level >= slog.LevelInfo:
+		return "[INFO]"
+	default:
+		return "[DEBUG]"
+	}
+}
+
+// Handler do formato texto, que mantém as linhas "data hora [TAG] mensagem"
+// de sempre; os campos só aparecem na saída JSON. Num terminal, erros saem em
+// vermelho, avisos em amarelo e os hosts criados em verde.
+type textHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	stage string
+	runID string
+	color bool
+}
+
+func newTextHandler(w io.Writer, level slog.Leveler) *textHandler {
+	return &textHandler{mu: &sync.Mutex{}, w: w, level: level, color: colorFor(w)}
+}
+
+// Cor da mensagem do evento, vazia para as sem destaque.
+func levelColor(level slog.Level, code string) termColor {
+	switch {
+	case level >= logx.LevelSummary:
+		return ""
+	case level >= slog.LevelError:
+		return colorRed
+	case level >= slog.LevelWarn:
+		return colorYellow
+	case code == "zabbix.created":
+		return colorGreen
+	}
+	return ""
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	stage, code := h.stage, ""
+	r.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "stage":
+			stage = a.Value.String()
+		case "code":
+			code = a.Value.String()
+		}
+		return true
+	})
+	prefix := r.Time.Format("2006/01/02 15:04:05")
+	if h.runID != "" {
+		prefix += " " + h.runID
+	}
+	msg := textTag(r.Level, stage) + " " + r.Message
+	if c := levelColor(r.Level, code); c != "" {
+		msg = paint(h.color, c, msg)
+	}
+	line := fmt.Sprintf("%s %s\n", prefix, msg)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, line)
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	for _, a := range attrs {
+		switch a.Key {
+		case "stage":
+			c.stage = a.Value.String()
+		case "run_id":
+			c.runID = a.Value.String()
+		}
+	}
+	return &c
+}
+
+func (h *textHandler) WithGroup(string) slog.Handler { return h }
+
+// Passa a enviar os logs também ao syslog.
+func attachSyslog(h slog.Handler) {
+	logSyslog = h
+	setLogOutput(logOutput)
+}
+
+// Handler que repassa cada evento a todos os handlers.
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, h := range m {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := make(multiHandler, len(m))
+	for i, h := range m {
+		c[i] = h.WithAttrs(attrs)
+	}
+	return c
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	c := make(multiHandler, len(m))
+	for i, h := range m {
+		c[i] = h.WithGroup(name)
+	}
+	return c
+}
+
+// Handler JSON com as chaves fixas ts, level e msg.
+func newJSONLogHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.TimeKey:
+				a.Key = "ts"
+			case slog.LevelKey:
+				level := a.Value.Any().(slog.Level)
+				name := strings.ToLower(level.String())
+				if level >= logx.LevelSummary {
+					name = "summary"
+				}
+				a.Value = slog.StringValue(name)
+			}
+			return a
+		},
+	})
+}
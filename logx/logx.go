@@ -0,0 +1,95 @@
+// Package logx escreve os eventos de log como códigos do catálogo (pacote
+// i18n) com campos estruturados, sobre um *slog.Logger.
+package logx
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"discoveryhosts/i18n"
+)
+
+// LevelSummary é o nível do resumo final, escrito mesmo com -quiet ou
+// -log-level error.
+const LevelSummary = slog.Level(12)
+
+// Logger anexa campos fixos (ip, range, stage...) a cada evento. As mensagens
+// são códigos do catálogo com argumentos printf; o código sai também no campo
+// code.
+type Logger struct {
+	l *slog.Logger
+}
+
+// New cria um Logger sobre l; nil usa slog.Default().
+func New(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return Logger{l: l}
+}
+
+type ctxKey struct{}
+
+// NewContext retorna um context que leva l, o logger do host, às chamadas
+// feitas em nome dele (como o Ensure de um backend).
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext é o logger levado por ctx, ou fallback se não houver.
+func FromContext(ctx context.Context, fallback Logger) Logger {
+	if l, ok := ctx.Value(ctxKey{}).(Logger); ok {
+		return l
+	}
+	return fallback
+}
+
+// Slog é o *slog.Logger por baixo, com os campos já anexados.
+func (f Logger) Slog() *slog.Logger { return f.l }
+
+// With anexa campos a todos os eventos seguintes.
+func (f Logger) With(args ...interface{}) Logger {
+	return Logger{l: f.l.With(args...)}
+}
+
+// WithErr anexa o erro do evento no campo error.
+func (f Logger) WithErr(err error) Logger {
+	return f.With("error", err.Error())
+}
+
+// WithDuration anexa a duração da etapa no campo duration_ms.
+func (f Logger) WithDuration(d time.Duration) Logger {
+	return f.With("duration_ms", d.Milliseconds())
+}
+
+// Logf escreve a mensagem do código no nível informado.
+func (f Logger) Logf(level slog.Level, code string, args ...interface{}) {
+	ctx := context.Background()
+	if !f.l.Enabled(ctx, level) {
+		return
+	}
+	f.l.Log(ctx, level, i18n.T(code, args...), "code", code)
+}
+
+// Debugf é usado nas mensagens por IP de cada tentativa (ping, conexão SNMP).
+func (f Logger) Debugf(code string, args ...interface{}) {
+	f.Logf(slog.LevelDebug, code, args...)
+}
+
+// Infof é usado nas mudanças de estado e no progresso do run.
+func (f Logger) Infof(code string, args ...interface{}) {
+	f.Logf(slog.LevelInfo, code, args...)
+}
+
+func (f Logger) Warnf(code string, args ...interface{}) {
+	f.Logf(slog.LevelWarn, code, args...)
+}
+
+func (f Logger) Errorf(code string, args ...interface{}) {
+	f.Logf(slog.LevelError, code, args...)
+}
+
+func (f Logger) Summaryf(code string, args ...interface{}) {
+	f.Logf(LevelSummary, code, args...)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/i18n"
+)
+
+// Modos de segurança da conexão SMTP
+const (
+	smtpSTARTTLS = "starttls" // texto puro seguido de STARTTLS obrigatório (porta 587)
+	smtpTLS      = "tls"      // TLS desde o início (porta 465)
+	smtpNone     = "none"     // sem criptografia, só para relays locais
+)
+
+// Formatos do relatório anexado ao e-mail
+const (
+	mailAttachCSV  = "csv"
+	mailAttachJSON = "json"
+)
+
+// SMTP configura o envio do resumo por e-mail ao fim de cada run. A senha
+// segue as mesmas regras do zabbix_pass: aceita cmd:// e pode vir do
+// secrets_file (smtp_user, smtp_pass).
+type SMTP struct {
+	Host          string   `json:"host,omitempty" yaml:"host" toml:"host"`
+	Port          int      `json:"port" yaml:"port" toml:"port"`
+	Security      string   `json:"security" yaml:"security" toml:"security"`
+	Username      string   `json:"username,omitempty" yaml:"username" toml:"username"`
+	Password      string   `json:"password,omitempty" yaml:"password" toml:"password"`
+	From          string   `json:"from,omitempty" yaml:"from" toml:"from"`
+	To            []string `json:"to,omitempty" yaml:"to" toml:"to"`
+	Attach        string   `json:"attach,omitempty" yaml:"attach" toml:"attach"`
+	OnlyOnChanges bool     `json:"only_on_changes,omitempty" yaml:"only_on_changes" toml:"only_on_changes"`
+	Timeout       Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+func (m SMTP) validate(c Config) []error {
+	if m.Host == "" {
+		return nil
+	}
+	var errs []error
+	if m.Port < 1 || m.Port > 65535 {
+		errs = append(errs, fmt.Errorf("smtp.port inválida: %d%s", m.Port, c.origin("smtp.port")))
+	}
+	if m.Security != smtpSTARTTLS && m.Security != smtpTLS && m.Security != smtpNone {
+		errs = append(errs, fmt.Errorf("smtp.security inválido: %q (use starttls, tls ou none)%s", m.Security, c.origin("smtp.security")))
+	}
+	if m.From == "" {
+		errs = append(errs, fmt.Errorf("smtp.from é obrigatório quando smtp.host está definido%s", c.origin("smtp.host")))
+	}
+	if len(m.To) == 0 {
+		errs = append(errs, fmt.Errorf("smtp.to precisa de ao menos um destinatário%s", c.origin("smtp.host")))
+	}
+	if m.Attach != "" && m.Attach != mailAttachCSV && m.Attach != mailAttachJSON {
+		errs = append(errs, fmt.Errorf("smtp.attach inválido: %q (use csv, json ou vazio)%s", m.Attach, c.origin("smtp.attach")))
+	}
+	if m.Password != "" && m.Username == "" {
+		errs = append(errs, fmt.Errorf("smtp.password definido sem smtp.username%s", c.origin("smtp.password")))
+	}
+	if time.Duration(m.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("smtp.timeout deve ser positivo%s", c.origin("smtp.timeout")))
+	}
+	return errs
+}
+
+// Envia o resumo por e-mail ao fim do run. Coleta os hosts como um
+// resultSink para o anexo; falhas de entrega só geram log.
+type mailer struct {
+	cfg    SMTP
+	run    Config
+	dryRun bool
+	hosts  []discovery.HostResult
+}
+
+func newMailer(cfg Config, dryRun bool) *mailer {
+	return &mailer{cfg: cfg.SMTP, run: cfg, dryRun: dryRun}
+}
+
+func (m *mailer) write(r discovery.HostResult) error {
+	if m.cfg.Attach != "" {
+		m.hosts = append(m.hosts, r)
+	}
+	return nil
+}
+
+func (m *mailer) close(s discovery.Summary) error {
+	if m.cfg.OnlyOnChanges && s.HostsCreated == 0 && s.ZabbixErrors == 0 && s.SNMPFailures() == 0 {
+		logInfo("mail.skipped")
+		return nil
+	}
+	msg, err := m.message(s)
+	if err == nil {
+		err = m.send(msg)
+	}
+	if err != nil {
+		logError("mail.failed", err)
+		return nil
+	}
+	logInfo("mail.sent", strings.Join(m.cfg.To, ", "))
+	return nil
+}
+
+// Mensagem MIME com o resumo no corpo e, se configurado, o relatório anexo.
+func (m *mailer) message(s discovery.Summary) ([]byte, error) {
+	var body strings.Builder
+	for _, l := range summaryLines(s) {
+		body.WriteString(i18n.T(l.code, l.args...) + "\n")
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", i18n.T("mail.subject", s.RunID, s.HostsCreated, s.ZabbixErrors)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(part, []byte(body.String()))
+
+	if m.cfg.Attach != "" {
+		data, err := m.attachment(s)
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("discovery-%s.%s", s.RunID, m.cfg.Attach)
+		ctype := "text/csv"
+		if m.cfg.Attach == mailAttachJSON {
+			ctype = "application/json"
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {ctype + "; charset=utf-8"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", name)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, data)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Relatório anexado, no mesmo formato do -output-csv ou do -output-json.
+func (m *mailer) attachment(s discovery.Summary) ([]byte, error) {
+	var buf bytes.Buffer
+	if m.cfg.Attach == mailAttachCSV {
+		w := csv.NewWriter(&buf)
+		w.Write(csvHeader)
+		for _, r := range m.hosts {
+			w.Write(csvRecord(r))
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	}
+	hosts := make([]jsonHost, len(m.hosts))
+	for i, r := range m.hosts {
+		hosts[i] = newJSONHost(r)
+	}
+	return json.Marshal(struct {
+		SchemaVersion int        `json:"schema_version"`
+		Run           jsonRun    `json:"run"`
+		Hosts         []jsonHost `json:"hosts"`
+	}{resultsSchemaVersion, newJSONRun(s, m.run, m.dryRun), hosts})
+}
+
+// Base64 em linhas de 76 caracteres, como pede o RFC 2045.
+func writeBase64(w io.Writer, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		w.Write([]byte(enc[:76] + "\r\n"))
+		enc = enc[76:]
+	}
+	w.Write([]byte(enc + "\r\n"))
+}
+
+func (m *mailer) send(msg []byte) error {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	timeout := time.Duration(m.cfg.Timeout)
+	dialer := &net.Dialer{Timeout: timeout}
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	if m.cfg.Security == smtpTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("falha ao conectar em %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("falha ao iniciar SMTP com %s: %w", addr, err)
+	}
+	defer c.Close()
+
+	if m.cfg.Security == smtpSTARTTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("falha no STARTTLS com %s: %w", addr, err)
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("falha na autenticação SMTP: %w", err)
+		}
+	}
+	if err := c.Mail(m.cfg.From); err != nil {
+		return fmt.Errorf("remetente %s recusado: %w", m.cfg.From, err)
+	}
+	for _, to := range m.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("destinatário %s recusado: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
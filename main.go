@@ -1,198 +1,732 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
-	"os/exec"
-	"strconv"
+	"log/slog"
+	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/gosnmp/gosnmp"
+	"discoveryhosts/discovery"
+	"discoveryhosts/i18n"
 )
 
-// Config representa o formato do arquivo discovery.conf
-type Config struct {
-	ZabbixURL     string   `json:"zabbix_url"`
-	ZabbixUser    string   `json:"zabbix_user"`
-	ZabbixPass    string   `json:"zabbix_pass"`
-	ZabbixGroupID string   `json:"zabbix_group_id"`
-	ZabbixProxyID string   `json:"zabbix_proxy_id"`
-	SNMPCommunity string   `json:"snmp_community"`
-	PingTimeout   int      `json:"ping_timeout"`
-	SNMPTimeout   int      `json:"snmp_timeout"`
-	Workers       int      `json:"workers"`
-	Ranges        []string `json:"ranges"`
-}
-
-var config Config
-
-func loadConfig(path string) {
-	log.Printf("[INFO] Carregando arquivo de configuração: %s", path)
-	data, err := ioutil.ReadFile(path)
+// Flag que pode ser repetida, acumulando os valores em ordem.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// Flags de carregamento da configuração, compartilhadas entre os subcomandos.
+type configFlags struct {
+	paths        stringList
+	format       string
+	allowUnknown bool
+	profile      string
+	remote       remoteOptions
+	overrides    stringList
+}
+
+func addConfigFlags(fs *flag.FlagSet) *configFlags {
+	f := &configFlags{}
+	fs.Var(&f.paths, "config", "arquivo ou URL http(s):// de configuração (padrão discovery.conf); pode ser repetido, os seguintes sobrescrevem os anteriores")
+	fs.StringVar(&f.format, "config-format", "", "formato da configuração (json, yaml, toml); detectado pela extensão se vazio")
+	fs.BoolVar(&f.allowUnknown, "allow-unknown-config", false, "apenas avisa sobre chaves desconhecidas na configuração em vez de falhar")
+	fs.StringVar(&f.profile, "profile", "", "perfil da seção profiles a aplicar sobre a configuração")
+	fs.Var(&f.overrides, "set", "sobrescreve um campo da configuração, ex.: -set workers=50 -set ranges='[\"10.0.0.1-20\"]'; pode ser repetido")
+	fs.DurationVar(&f.remote.Timeout, "config-timeout", 10*time.Second, "timeout para buscar configurações http(s)://")
+	fs.StringVar(&f.remote.TokenEnv, "config-token-env", "DISCOVERY_CONFIG_TOKEN", "variável de ambiente com o bearer token para configurações http(s)://")
+	fs.StringVar(&f.remote.CAFile, "config-ca", "", "arquivo PEM com a CA do servidor de configuração")
+	fs.StringVar(&f.remote.CacheDir, "config-cache-dir", "", "diretório para guardar a última configuração remota obtida, usada se a busca falhar")
+	return f
+}
+
+// Arquivos de configuração informados, ou o discovery.conf padrão.
+func (f *configFlags) files() []string {
+	if len(f.paths) == 0 {
+		return []string{"discovery.conf"}
+	}
+	return f.paths
+}
+
+func (f *configFlags) load() (Config, error) {
+	return loadConfig(f.files(), loadOptions{Format: f.format, AllowUnknown: f.allowUnknown, Profile: f.profile, Remote: f.remote, Overrides: f.overrides})
+}
+
+// Flags de log compartilhadas entre os subcomandos que carregam a
+// configuração.
+type logFlags struct {
+	level   string
+	lang    string
+	noColor bool
+}
+
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	f := &logFlags{}
+	fs.StringVar(&f.level, "log-level", "info", "nível de log: debug (inclui cada ping e tentativa SNMP), info, warn ou error")
+	fs.StringVar(&f.lang, "lang", "", "idioma dos logs e do resumo: pt-BR ou en (padrão: detectado por LC_ALL/LC_MESSAGES/LANG)")
+	fs.BoolVar(&f.noColor, "no-color", false, "não usa cores no terminal (o mesmo que a variável NO_COLOR); fora de um terminal elas nunca são usadas")
+	return f
+}
+
+// Aplica o idioma, as cores e o nível; com quiet, o nível é no mínimo warn.
+func (f *logFlags) setup(format string, quiet bool) error {
+	if f.lang != "" {
+		l, err := i18n.Parse(f.lang)
+		if err != nil {
+			return err
+		}
+		i18n.Set(l)
+	}
+	level, err := parseLogLevel(f.level)
 	if err != nil {
-		log.Fatalf("[ERRO] Falha ao ler discovery.conf: %v", err)
+		return err
 	}
-	if err := json.Unmarshal(data, &config); err != nil {
-		log.Fatalf("[ERRO] Falha ao parsear discovery.conf: %v", err)
+	if quiet {
+		level = max(level, slog.LevelWarn)
 	}
-	log.Printf("[INFO] Configuração carregada com sucesso: %+v", config)
+	setupColor(f.noColor)
+	return setupLogging(format, level)
 }
 
-func ping(ip string, timeout int) bool {
-	log.Printf("[PING] Testando IP %s", ip)
-	cmd := exec.Command("ping", "-c", "1", "-W", fmt.Sprintf("%d", timeout), ip)
-	err := cmd.Run()
-	if err == nil {
-		log.Printf("[PING] IP %s respondeu", ip)
-		return true
+// Subcomandos, na ordem da ajuda; sem subcomando (ou com uma opção no lugar
+// dele) o scan é executado, como nas versões anteriores.
+var subcommands = []struct {
+	name, help string
+}{
+	{"scan", "executa o scan dos ranges e o cadastro dos hosts"},
+	{"validate", "confere a configuração sem enviar nenhum pacote"},
+	{"plan", "mostra os alvos de cada range e para onde eles vão, sem enviar nenhum pacote"},
+	{"list", "lista os IPs que o scan verificaria, ordenados, sem enviar nenhum pacote"},
+	{"init", "gera um arquivo de configuração inicial comentado"},
+	{"migrate-config", "atualiza um arquivo de configuração para o esquema atual"},
+	{"history", "consulta o banco de histórico dos runs"},
+	{"version", "mostra a versão, o commit e a data do build e sai"},
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprintln(out, "Uso: discoveryhosts <subcomando> [opções]\n\nSubcomandos:")
+	for _, c := range subcommands {
+		fmt.Fprintf(out, "  %-16s %s\n", c.name, c.help)
 	}
-	log.Printf("[PING] IP %s não respondeu", ip)
-	return false
+	fmt.Fprintln(out, "\nUse discoveryhosts <subcomando> -h para as opções de cada um.")
+}
+
+func main() {
+	os.Exit(runMain(os.Args[1:]))
 }
 
-func getSNMPName(ip string) (string, error) {
-	log.Printf("[SNMP] Conectando ao host %s", ip)
-	g := &gosnmp.GoSNMP{
-		Target:    ip,
-		Port:      161,
-		Community: config.SNMPCommunity,
-		Version:   gosnmp.Version2c,
-		Timeout:   time.Duration(config.SNMPTimeout) * time.Second,
-		Retries:   1,
+// Executa o subcomando e retorna o código de saída. É o único ponto de saída:
+// os subcomandos retornam os erros, e os defers deles (lock, arquivos de saída,
+// sinks) já rodaram quando o processo termina.
+func runMain(args []string) int {
+	cmd := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	} else if len(args) > 0 && (args[0] == "-version" || args[0] == "--version") {
+		cmd, args = "version", args[1:]
 	}
-	err := g.Connect()
-	if err != nil {
-		log.Printf("[ERRO] Falha ao conectar SNMP em %s: %v", ip, err)
-		return "", err
+	switch cmd {
+	case "", "scan":
+		return exitStatus(runScan(args, cmd == ""))
+	case "validate":
+		return runValidate(args)
+	case "plan":
+		return runPlan(args)
+	case "list":
+		return runList(args)
+	case "init":
+		return exitStatus(exitOK, runInit(args))
+	case "migrate-config":
+		return exitStatus(exitOK, runMigrateConfig(args))
+	case "history":
+		return exitStatus(exitOK, runHistory(args))
+	case "version":
+		return exitStatus(exitOK, runVersion(args))
+	case "help":
+		printUsage(os.Stdout)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "subcomando desconhecido: %s\n\n", cmd)
+		printUsage(os.Stderr)
+		return exitFatal
 	}
-	defer g.Conn.Close()
+}
 
-	oid := "1.3.6.1.2.1.1.5.0"
-	result, err := g.Get([]string{oid})
+// Código de saída de um subcomando: o erro, se houver, é registrado e vira
+// exitFatal.
+func exitStatus(code int, err error) int {
 	if err != nil {
-		log.Printf("[ERRO] Falha na consulta SNMP em %s: %v", ip, err)
-		return "", err
+		log.Printf("[ERRO] %v", err)
+		return exitFatal
 	}
-	for _, variable := range result.Variables {
-		if variable.Type == gosnmp.OctetString {
-			sysName := string(variable.Value.([]byte))
-			log.Printf("[SNMP] Host %s respondeu sysName: %s", ip, sysName)
-			return sysName, nil
-		}
-	}
-	log.Printf("[ERRO] OID não retornou string em %s", ip)
-	return "", fmt.Errorf("OID não retornou string")
+	return code
+}
+
+// Flags que definem os sinks e o progresso de cada run.
+type outputFlags struct {
+	dryRun           bool
+	noCache          bool
+	csv              string
+	json             string
+	html             string
+	htmlTemplate     string
+	ansible          string
+	ansibleFormat    string
+	ansibleByVendor  bool
+	hostsFile        string
+	hostsFormat      string
+	hostsDomain      string
+	nagios           string
+	nagiosTemplate   string
+	stream           string
+	ndjsonPolicy     string
+	diff             string
+	forceProgress    bool
+	progressInterval time.Duration
+	tui              bool
+
+	checkpoint         string
+	checkpointInterval time.Duration
+
+	matchSysName  string
+	matchSysDescr string
+	showFiltered  bool
+	filter        *hostFilter // compilado de matchSysName e matchSysDescr
+
+	limit int
+	retry *retryReport // relatório do -retry-from
+
+	debugHosts stringList
+	debugDir   string
+	debug      *debugHosts // compilado de debugHosts e debugDir
+
+	groupHostLogs bool
 }
 
-func createZabbixHost(name, ip string) error {
-	log.Printf("[ZABBIX] Criando/verificando host %s (%s) no grupo %s via proxy %s", name, ip, config.ZabbixGroupID, config.ZabbixProxyID)
+// Combinações das flags com a configuração que impedem o run.
+func (f outputFlags) check(cfg Config) error {
+	if f.diff != "" && cfg.SnapshotFile == "" {
+		return fmt.Errorf("-output-diff requer snapshot_file na configuração")
+	}
+	if f.ansibleFormat != ansibleYAML && f.ansibleFormat != ansibleINI {
+		return fmt.Errorf("-ansible-format desconhecido: %q (use yaml ou ini)", f.ansibleFormat)
+	}
+	if f.hostsFormat != hostsFormatHosts && f.hostsFormat != hostsFormatDnsmasq {
+		return fmt.Errorf("-hosts-format desconhecido: %q (use hosts ou dnsmasq)", f.hostsFormat)
+	}
 	return nil
 }
 
-func worker(wg *sync.WaitGroup, jobs <-chan string) {
-	defer wg.Done()
-	for ip := range jobs {
-		if ping(ip, config.PingTimeout) {
-			sysName, err := getSNMPName(ip)
-			if err != nil {
-				log.Printf("[WARN] Ping OK mas falha SNMP em %s: %v", ip, err)
-				continue
-			}
-			_ = createZabbixHost(sysName, ip)
-		}
-	}
-}
-
-// Expande formatos de range como 10.91.50.1-14 ou 10.91.50-51.1-14
-func expandRange(ipRange string) ([]string, error) {
-	parts := strings.Split(ipRange, ".")
-	if len(parts) != 4 {
-		return nil, fmt.Errorf("formato inválido: %s", ipRange)
-	}
-
-	expandOctet := func(s string) ([]int, error) {
-		if strings.Contains(s, "-") {
-			bounds := strings.Split(s, "-")
-			start, err := strconv.Atoi(bounds[0])
-			if err != nil {
-				return nil, err
-			}
-			end, err := strconv.Atoi(bounds[1])
-			if err != nil {
-				return nil, err
-			}
-			var res []int
-			for i := start; i <= end; i++ {
-				res = append(res, i)
-			}
-			return res, nil
-		}
-		val, err := strconv.Atoi(s)
+// Opções do run com os sinks das flags e da configuração. Os arquivos de saída
+// são abertos aqui; no -daemon, a cada ciclo. Num erro, os sinks já abertos
+// são liberados.
+func (f outputFlags) runOptions(cfg Config, runID string, daemon bool) (opts RunOptions, err error) {
+	defer func() {
+		if err != nil {
+			abortSinks(opts.Sinks)
+		}
+	}()
+	opts = RunOptions{RunID: runID, DryRun: f.dryRun, Progress: detectProgressMode(f.forceProgress), ProgressInterval: f.progressInterval}
+	opts.Filter, opts.ShowFiltered = f.filter, f.showFiltered
+	opts.CreateLimit = f.limit
+	opts.DebugHosts = f.debug
+	opts.HostLogs = f.groupHostLogs
+	// A saída padrão é do stream e, no daemon, não há um terminal dedicado ao
+	// run; a barra de progresso não pode usá-la
+	if opts.Progress == progressBar && (f.stream == outputNDJSON || daemon) {
+		opts.Progress = progressOff
+		if f.forceProgress {
+			opts.Progress = progressLog
+		}
+	}
+	// O rastro do -debug-host na saída de erro desmontaria o painel
+	if f.tui {
+		if opts.Progress == progressBar && (f.debug == nil || f.debugDir != "") {
+			opts.Progress = progressTUI
+		} else {
+			logInfo("tui.unavailable")
+		}
+	}
+	if f.checkpoint != "" {
+		opts.Checkpoint = newCheckpointWriter(f.checkpoint, f.checkpointInterval, cfg, runID)
+	}
+	switch f.stream {
+	case outputNDJSON:
+		sink, err := newNDJSONSink(os.Stdout, cfg, f.dryRun, f.ndjsonPolicy)
 		if err != nil {
-			return nil, err
+			return opts, err
 		}
-		return []int{val}, nil
+		opts.Sinks = append(opts.Sinks, sink)
+	case outputTable, outputJSON, outputCSV:
+		opts.Sinks = append(opts.Sinks, newStdoutSink(f.stream, cfg, f.dryRun))
+	}
+	if f.csv != "" {
+		sink, err := newCSVSink(f.csv)
+		if err != nil {
+			return opts, err
+		}
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	if cfg.Notifications.WebhookURL != "" {
+		opts.Sinks = append(opts.Sinks, newNotifier(cfg.Notifications))
+	}
+	if cfg.SMTP.Host != "" {
+		opts.Sinks = append(opts.Sinks, newMailer(cfg, f.dryRun))
+	}
+	if cfg.ZabbixSender.Server != "" {
+		opts.Sinks = append(opts.Sinks, newSenderSink(cfg.ZabbixSender))
+	}
+	if len(cfg.LLD.Ranges) > 0 && !f.dryRun {
+		opts.Sinks = append(opts.Sinks, newLLDSink(cfg.LLD))
+	}
+	if cfg.HistoryDB != "" {
+		sink, err := newHistorySink(cfg.HistoryDB, runID, f.dryRun)
+		if err != nil {
+			return opts, err
+		}
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	if cfg.backend(backendNetBox) && !f.dryRun {
+		opts.Sinks = append(opts.Sinks, newNetBoxSink(cfg.NetBox))
+	}
+	if cfg.backend(backendWebhook) && !f.dryRun {
+		sink, err := newWebhookSink(cfg.Webhook, runID)
+		if err != nil {
+			return opts, err
+		}
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	if cfg.backend(backendConsul) && !f.dryRun {
+		opts.Sinks = append(opts.Sinks, newConsulSink(cfg))
 	}
+	if cfg.MQTT.Broker != "" {
+		sink, err := newMQTTSink(cfg, runID, f.dryRun)
+		if err != nil {
+			return opts, err
+		}
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	if len(cfg.Kafka.Brokers) > 0 {
+		sink, err := newKafkaSink(cfg, runID, f.dryRun)
+		if err != nil {
+			return opts, err
+		}
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	if cfg.Grafana.URL != "" {
+		opts.Sinks = append(opts.Sinks, newGrafanaSink(cfg, f.dryRun))
+	}
+	if cfg.SnapshotFile != "" {
+		opts.Sinks = append(opts.Sinks, newSnapshotSink(cfg.SnapshotFile, f.diff))
+	}
+	if cfg.KnownHostsFile != "" {
+		known, problems, err := loadKnownHosts(cfg)
+		if err != nil {
+			return opts, err
+		}
+		for _, p := range problems {
+			logWarn("known.invalid_row", cfg.KnownHostsFile, p)
+		}
+		logInfo("known.loaded", known.entries(), cfg.KnownHostsFile, strings.Join(cfg.KnownHostsMatch, ", "))
+		opts.Known = known
+	}
+	// Com -no-cache o run é completo, mas o cache ainda é renovado; no
+	// dry-run nada é cadastrado e o cache não muda
+	if cfg.CacheFile != "" && !(f.noCache && f.dryRun) {
+		cache := loadHostCache(cfg.CacheFile, cfg)
+		if !f.noCache {
+			opts.Cache = cache.fresh(time.Duration(cfg.CacheTTL))
+			logInfo("cache.loaded", len(opts.Cache), cfg.CacheFile, cfg.CacheTTL)
+		}
+		if !f.dryRun {
+			opts.Sinks = append(opts.Sinks, newCacheSink(cfg.CacheFile, time.Duration(cfg.CacheTTL), cache))
+		}
+	}
+	if f.json != "" {
+		sink, err := newJSONSink(f.json, cfg, f.dryRun)
+		if err != nil {
+			return opts, err
+		}
+		if f.retry != nil {
+			sink.carried = f.retry.kept
+		}
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	if f.html != "" {
+		sink, err := newHTMLSink(f.html, f.htmlTemplate, f.dryRun)
+		if err != nil {
+			return opts, err
+		}
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	if f.ansible != "" {
+		opts.Sinks = append(opts.Sinks, newAnsibleSink(f.ansible, f.ansibleFormat, f.ansibleByVendor))
+	}
+	if f.hostsFile != "" {
+		opts.Sinks = append(opts.Sinks, newHostsFileSink(f.hostsFile, f.hostsFormat, f.hostsDomain, runID))
+	}
+	if f.nagios != "" {
+		sink, err := newNagiosSink(f.nagios, f.nagiosTemplate, cfg, f.dryRun)
+		if err != nil {
+			return opts, err
+		}
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	// Por último, para que o on_run_finished_command encontre os arquivos de
+	// saída já fechados
+	if cfg.OnDiscoveredCommand != "" || cfg.OnRunFinishedCommand != "" {
+		sink, err := newHookSink(cfg, runID, f.dryRun)
+		if err != nil {
+			return opts, err
+		}
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	return opts, nil
+}
 
-	o1, err := expandOctet(parts[0])
-	if err != nil {
-		return nil, err
+// Subcomando scan, retornando o código de saída; legacy indica a chamada sem
+// subcomando, que ainda executa o scan mas gera um aviso. Erros retornados são
+// fatais (exitFatal) e ainda não geraram log.
+func runScan(args []string, legacy bool) (int, error) {
+	// Erros de uso saem com exitFatal, não com o 2 padrão do flag. O FlagSet é
+	// novo a cada chamada, para o scan poder rodar de novo no mesmo processo
+	flag.CommandLine = flag.NewFlagSet("scan", flag.ContinueOnError)
+	cf := addConfigFlags(flag.CommandLine)
+	lf := addLogFlags(flag.CommandLine)
+	var of outputFlags
+	listProfiles := flag.Bool("list-profiles", false, "lista os perfis definidos na configuração e sai")
+	showConfig := flag.Bool("show-config", false, "mostra a configuração efetiva (credenciais mascaradas) e sai")
+	flag.BoolVar(&of.dryRun, "dry-run", false, "faz ping e SNMP mas não cadastra nada no Zabbix")
+	flag.BoolVar(&of.noCache, "no-cache", false, "ignora o cache_file: faz o SNMP e o cadastro de todos os hosts (o cache é renovado com o resultado)")
+	flag.StringVar(&of.csv, "output-csv", "", "grava os hosts que responderam em um arquivo CSV")
+	flag.StringVar(&of.json, "output-json", "", "grava o resultado do run (resumo e hosts que responderam) em um arquivo JSON")
+	flag.StringVar(&of.html, "output-html", "", "grava um relatório HTML do run (resumo, ranges, hosts criados e falhas)")
+	flag.StringVar(&of.htmlTemplate, "html-template", "", "template html/template usado no -output-html no lugar do embutido")
+	flag.StringVar(&of.ansible, "output-ansible", "", "grava um inventário do Ansible com os hosts identificados, agrupados por range (ansible_host é o IP)")
+	flag.StringVar(&of.ansibleFormat, "ansible-format", ansibleYAML, "formato do -output-ansible: yaml ou ini")
+	flag.BoolVar(&of.ansibleByVendor, "ansible-vendor-groups", false, "com -output-ansible, agrupa também pelo fabricante do sysObjectID (vendor_cisco, vendor_juniper...)")
+	flag.StringVar(&of.hostsFile, "output-hosts", "", "grava os hosts identificados (IP e sysName) num arquivo no formato /etc/hosts, trocado de uma vez")
+	flag.StringVar(&of.hostsFormat, "hosts-format", hostsFormatHosts, "formato do -output-hosts: hosts (nome completo e curto) ou dnsmasq (addn-hosts, um nome por IP)")
+	flag.StringVar(&of.hostsDomain, "hosts-domain", "", "com -output-hosts, domínio acrescentado aos sysNames (ex.: lab.local)")
+	flag.StringVar(&of.nagios, "output-nagios", "", "grava os hosts identificados num arquivo de configuração do Nagios/Icinga 1 (define host e define hostgroup por range)")
+	flag.StringVar(&of.nagiosTemplate, "nagios-template", "", "template text/template usado no -output-nagios no lugar do embutido (recebe .Hosts, com o resultado completo de cada host, e .Ranges)")
+	flag.StringVar(&of.stream, "output", "", "o que escrever na saída padrão: table (tabela dos hosts e contadores no fim), json ou csv (o conteúdo de -output-json ou -output-csv, no fim) ou ndjson (cada host concluído como uma linha JSON, com um \"type\":\"summary\" no fim); os logs vão sempre na saída de erro")
+	flag.StringVar(&of.stream, "o", "", "o mesmo que -output")
+	flag.StringVar(&of.ndjsonPolicy, "ndjson-policy", ndjsonBlock, "com -output ndjson, o que fazer quando o consumidor não acompanha: block (o scan espera, nada é perdido) ou drop (descarta e conta no resumo)")
+	flag.StringVar(&of.diff, "output-diff", "", "grava em um arquivo JSON as diferenças em relação ao run anterior (requer snapshot_file)")
+	quiet := flag.Bool("quiet", false, "mostra apenas avisos, erros e o resumo final (o mesmo que -log-level warn)")
+	flag.BoolVar(&of.forceProgress, "progress", false, "mostra o progresso mesmo quando a saída não é um terminal (linhas de log a cada -progress-interval)")
+	flag.DurationVar(&of.progressInterval, "progress-interval", 10*time.Second, "intervalo entre as linhas de progresso com -progress")
+	flag.BoolVar(&of.tui, "tui", false, "mostra um painel no terminal com o progresso de cada range, os contadores, a vazão das etapas e os últimos avisos; os demais logs vão só para o -log-file. Sem um terminal (ou num pequeno demais), segue com o log normal")
+	logTarget := flag.String("log-target", "stderr", "destino adicional dos logs: stderr (apenas a saída de erro) ou syslog (também envia ao syslog)")
+	logFormat := flag.String("log-format", logFormatText, "formato dos logs: text ou json (um objeto por evento)")
+	strict := flag.Bool("strict", false, "sai com código 2 se houver qualquer erro por host (ping, SNMP ou Zabbix), não só erros no Zabbix")
+	daemonSchedule := flag.String("daemon", "", "fica residente e executa um scan por ciclo: intervalo (ex.: 6h) ou expressão cron de 5 campos (ex.: \"0 */6 * * *\"); SIGHUP recarrega a configuração para o próximo ciclo")
+	agentAddr := flag.String("agent", "", "modo agente: escuta neste endereço (ex.: :8443) e executa o ping e o SNMP dos ranges enviados por um coordenador, sem cadastrar nada no Zabbix (requer agent.token)")
+	serveAddr := flag.String("serve", "", "modo servidor: escuta neste endereço (ex.: :8080) com uma API HTTP para iniciar (POST /scans), acompanhar (GET /scans/{id}, /scans/{id}/results) e cancelar (DELETE /scans/{id}) scans (requer api.token)")
+	jitter := flag.Duration("jitter", 0, "com -daemon, atraso aleatório de até este valor no início de cada ciclo")
+	flag.StringVar(&of.checkpoint, "checkpoint", "", "grava periodicamente os alvos concluídos neste arquivo, para retomar um run interrompido com -resume; removido quando o run termina")
+	flag.DurationVar(&of.checkpointInterval, "checkpoint-interval", time.Minute, "intervalo entre as gravações do -checkpoint")
+	resume := flag.String("resume", "", "retoma o run interrompido salvo neste checkpoint, pulando os alvos concluídos (continua gravando nele se -checkpoint não for informado)")
+	force := flag.Bool("force", false, "com -resume, retoma mesmo que a configuração tenha mudado desde o checkpoint")
+	var targetList stringList
+	flag.Var(&targetList, "target", "executa o pipeline só para este IP, fora dos ranges da configuração (as opções do range que o contém continuam valendo); pode ser repetido")
+	confirm := flag.Bool("confirm", false, "faz o ping e o SNMP de todos os IPs, mostra os hosts a cadastrar e só cadastra após a confirmação no terminal; recusado, os relatórios são gravados sem o cadastro")
+	flag.StringVar(&of.matchSysName, "match-sysname", "", "só cadastra e relata os hosts cujo sysName (ou nome DNS) casa com esta expressão regular, sem diferenciar maiúsculas (use (?-i) para diferenciar); os demais ficam como filtered")
+	flag.StringVar(&of.matchSysDescr, "match-sysdescr", "", "só cadastra e relata os hosts cujo sysDescr casa com esta expressão regular, sem diferenciar maiúsculas (use (?-i) para diferenciar); os demais ficam como filtered")
+	flag.BoolVar(&of.showFiltered, "show-filtered", false, "com -match-sysname ou -match-sysdescr, mantém os hosts filtrados nos relatórios e saídas (continuam sem cadastro)")
+	retryFrom := flag.String("retry-from", "", "refaz só os hosts que falharam no relatório de -output-json deste arquivo, com a configuração atual (ex.: timeouts maiores); o novo -output-json traz os demais hosts do relatório sem mudança e os recuperados com recovered")
+	retryOnly := flag.String("retry-only", defaultRetryOutcomes, "com -retry-from, os resultados refeitos, separados por vírgula: "+strings.Join(retryOutcomes, ", "))
+	flag.IntVar(&of.limit, "limit", 0, "cria no máximo este número de hosts no run (somando os backends); os demais são descobertos e relatados como limited, sem cadastro. 0 é sem limite")
+	flag.Var(&of.debugHosts, "debug-host", "rastro detalhado das etapas deste IP ou CIDR (comando e saída do ping, PDUs SNMP, pedidos e respostas da API do Zabbix, com as credenciais mascaradas), sem mudar o log dos demais hosts; pode ser repetido")
+	flag.BoolVar(&of.groupHostLogs, "group-host-logs", false, "escreve os eventos de log de cada host juntos, num bloco, quando ele termina, em vez de intercalados com os dos outros workers")
+	flag.StringVar(&of.debugDir, "debug-dir", "", "com -debug-host, grava o rastro de cada host em <dir>/<ip>.trace em vez da saída de erro")
+	lockFile := flag.String("lock-file", "", "lock que impede dois scans ao mesmo tempo, no lugar do lock_file da configuração")
+	lockWait := flag.Duration("lock-wait", 0, "com o lock em uso, espera até este tempo que a outra instância termine em vez de sair na hora com o código 6")
+	verbose := flag.Bool("verbose", false, "mostra o rastro de cada host (etapas, tempos e valores SNMP recebidos) e o log em debug; pensado para uso com -target")
+	flag.CommandLine.Usage = usageWithExitCodes
+	if err := flag.CommandLine.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, nil
+		}
+		return exitFatal, nil
 	}
-	o2, err := expandOctet(parts[1])
-	if err != nil {
-		return nil, err
+
+	if *verbose {
+		lf.level = "debug"
+	}
+	if err := lf.setup(*logFormat, *quiet); err != nil {
+		return exitFatal, err
+	}
+	logInfo("build.info", currentBuild())
+	if legacy {
+		logWarn("cli.no_subcommand")
+	}
+	var err error
+	runID := newRunID()
+	setLogRunID(runID)
+	if *logTarget != "stderr" && *logTarget != "syslog" {
+		return exitFatal, fmt.Errorf("-log-target inválido: %s (use stderr ou syslog)", *logTarget)
+	}
+	if of.progressInterval <= 0 {
+		return exitFatal, fmt.Errorf("-progress-interval deve ser positivo")
+	}
+	switch of.stream {
+	case "", outputTable, outputJSON, outputCSV, outputNDJSON:
+	default:
+		return exitFatal, fmt.Errorf("-output inválido: %s (use table, json, csv ou ndjson)", of.stream)
+	}
+	if of.debug, err = parseDebugHosts(of.debugHosts, of.debugDir); err != nil {
+		return exitFatal, err
 	}
-	o3, err := expandOctet(parts[2])
+	if of.debug != nil {
+		dest := of.debugDir
+		if dest == "" {
+			dest = "stderr"
+		}
+		logInfo("debug.enabled", of.debug, dest)
+	}
+	if of.limit < 0 {
+		return exitFatal, fmt.Errorf("-limit não pode ser negativo")
+	}
+	if *lockWait < 0 {
+		return exitFatal, fmt.Errorf("-lock-wait não pode ser negativo")
+	}
+	if of.filter, err = newHostFilter(of.matchSysName, of.matchSysDescr); err != nil {
+		return exitFatal, err
+	}
+	if of.filter != nil {
+		// Os hosts do cache não passam pelo SNMP e não teriam como ser filtrados
+		of.noCache = true
+		logInfo("filter.enabled", of.filter)
+	}
+	var sched schedule
+	if *daemonSchedule != "" {
+		if sched, err = parseSchedule(*daemonSchedule); err != nil {
+			return exitFatal, err
+		}
+	}
+	if *jitter < 0 {
+		return exitFatal, fmt.Errorf("-jitter não pode ser negativo")
+	}
+	if of.checkpointInterval <= 0 {
+		return exitFatal, fmt.Errorf("-checkpoint-interval deve ser positivo")
+	}
+	if *resume != "" && sched != nil {
+		return exitFatal, fmt.Errorf("-resume não pode ser usado com -daemon")
+	}
+	if *agentAddr != "" && (sched != nil || *resume != "") {
+		return exitFatal, fmt.Errorf("-agent não pode ser usado com -daemon ou -resume")
+	}
+	if *serveAddr != "" && (sched != nil || *resume != "" || *agentAddr != "") {
+		return exitFatal, fmt.Errorf("-serve não pode ser usado com -daemon, -resume ou -agent")
+	}
+	targets, err := parseTargets(targetList)
 	if err != nil {
-		return nil, err
+		return exitFatal, err
+	}
+	if len(targets) > 0 && (sched != nil || *resume != "" || *agentAddr != "" || *serveAddr != "") {
+		return exitFatal, fmt.Errorf("-target não pode ser usado com -daemon, -resume, -agent ou -serve")
+	}
+	if *retryFrom != "" && (len(targets) > 0 || sched != nil || *resume != "" || *agentAddr != "" || *serveAddr != "") {
+		return exitFatal, fmt.Errorf("-retry-from não pode ser usado com -target, -daemon, -resume, -agent ou -serve")
+	}
+	if *retryFrom != "" {
+		if of.retry, err = loadRetryReport(*retryFrom, *retryOnly); err != nil {
+			return exitFatal, err
+		}
+		logInfo("retry.loaded", *retryFrom, of.retry.runID, len(of.retry.ips), *retryOnly, len(of.retry.kept))
+		if len(of.retry.ips) == 0 {
+			return exitOK, nil
+		}
+		targets = of.retry.ips
+	}
+	if *confirm && (of.dryRun || sched != nil || *agentAddr != "" || *serveAddr != "") {
+		return exitFatal, fmt.Errorf("-confirm não pode ser usado com -dry-run, -daemon, -agent ou -serve")
+	}
+	if *confirm && !isTerminal(os.Stdin) {
+		return exitFatal, fmt.Errorf("-confirm requer um terminal para a confirmação; use -dry-run para ver os hosts sem cadastrar, ou remova -confirm")
 	}
-	o4, err := expandOctet(parts[3])
+	if *resume != "" && of.checkpoint == "" {
+		of.checkpoint = *resume
+	}
+
+	cfg, err := cf.load()
 	if err != nil {
-		return nil, err
+		return exitFatal, err
+	}
+	if *listProfiles {
+		for _, name := range cfg.profileNames() {
+			fmt.Println(name)
+		}
+		return exitOK, nil
+	}
+	if err := cfg.validate(); err != nil {
+		return exitFatal, fmt.Errorf("configuração inválida: %w", err)
+	}
+	if *showConfig {
+		if err := cfg.writeEffective(os.Stdout); err != nil {
+			return exitFatal, err
+		}
+		return exitOK, nil
+	}
+	if cfg.LogFile != "" {
+		if err := attachLogFile(cfg.LogFile, cfg.LogMaxSizeMB, cfg.LogMaxBackups, cfg.LogFileOnly); err != nil {
+			logWarn("log.file_failed", err)
+		} else {
+			logInfo("log.file_active", cfg.LogFile, cfg.LogMaxSizeMB, cfg.LogMaxBackups)
+		}
+	}
+	if *logTarget == "syslog" {
+		h, err := dialSyslog(cfg.SyslogAddress, cfg.SyslogFacility)
+		if err != nil {
+			logWarn("log.syslog_failed", err)
+		} else {
+			attachSyslog(h)
+			logInfo("log.syslog_active", cfg.SyslogFacility)
+		}
+	}
+	logInfo("config.loaded", cfg)
+	if *agentAddr != "" {
+		return runAgent(*agentAddr, cfg)
+	}
+	if *serveAddr != "" {
+		return runServe(*serveAddr, cfg)
+	}
+	if err := of.check(cfg); err != nil {
+		return exitFatal, err
+	}
+	if *lockFile != "" {
+		cfg.LockFile = *lockFile
+	}
+	if cfg.LockFile != "" {
+		lock, err := acquireLock(cfg.LockFile, *lockWait)
+		if isLockBusy(err) {
+			logError("lock.busy", err)
+			return exitLocked, nil
+		}
+		if err != nil {
+			return exitFatal, err
+		}
+		// Nos sinais o run termina e retorna por aqui; num os.Exit, o
+		// sistema solta o flock
+		defer lock.release()
 	}
 
-	var ips []string
-	for _, a := range o1 {
-		for _, b := range o2 {
-			for _, c := range o3 {
-				for _, d := range o4 {
-					ips = append(ips, fmt.Sprintf("%d.%d.%d.%d", a, b, c, d))
-				}
-			}
+	if sched != nil {
+		d := &daemon{cf: cf, of: of, cfg: cfg, sched: sched, jitter: *jitter, strict: *strict}
+		return d.run(), nil
+	}
+	if len(targets) > 0 {
+		// O host passa pelo SNMP e pelo cadastro mesmo que esteja no cache
+		cfg = cfg.withTargets(targets)
+		of.noCache = true
+	} else if cfg, err = cfg.resolveRanges(context.Background()); err != nil {
+		return exitFatal, err
+	}
+	var previous []discovery.HostResult
+	if *resume != "" {
+		if previous, err = loadCheckpoint(*resume, cfg, *force); err != nil {
+			return exitFatal, err
+		}
+	}
+	opts, err := of.runOptions(cfg, runID, false)
+	if err != nil {
+		return exitFatal, err
+	}
+	opts.Previous = previous
+	if len(targets) > 0 {
+		opts.Trigger = triggerTarget
+		opts.Only = make(map[string]bool, len(targets))
+		for _, ip := range targets {
+			opts.Only[ip] = true
+		}
+	}
+	if of.retry != nil {
+		opts.Trigger, opts.RetryOf = triggerRetry, of.retry.runID
+	}
+	// O rastro e a pergunta do -confirm vão na saída padrão, a menos que ela
+	// seja de um -output para outro programa
+	out := io.Writer(os.Stdout)
+	if of.stream != "" && of.stream != outputTable {
+		out = os.Stderr
+	}
+	if *verbose {
+		opts.Trace = &hostTracer{out: out}
+		if opts.Progress == progressTUI {
+			logInfo("tui.unavailable")
 		}
+		opts.Progress = progressOff
 	}
-	return ips, nil
+	if *confirm {
+		opts.Confirm = func(ctx context.Context, hosts []discovery.HostResult) bool {
+			return confirmRegistration(ctx, cfg, os.Stdin, out, hosts)
+		}
+	}
+	opts.SignalSnapshot = true
+	ctx, stop := interruptContext()
+	defer stop()
+	return runCycle(ctx, cfg, opts, *strict)
 }
 
-func main() {
-	log.Println("[INFO] Iniciando discovery...")
-	loadConfig("discovery.conf")
-
-	jobs := make(chan string, config.Workers)
-	var wg sync.WaitGroup
-
-	for w := 0; w < config.Workers; w++ {
-		wg.Add(1)
-		go worker(&wg, jobs)
+// Executa um run completo: discovery, sinks e resumo no log.
+func runCycle(ctx context.Context, cfg Config, opts RunOptions, strict bool) (int, error) {
+	logInfo("run.start", opts.RunID)
+	summary, err := runDiscovery(ctx, cfg, opts)
+	var noTargets *discovery.NoTargetsError
+	if errors.As(err, &noTargets) {
+		logError("run.no_targets", err)
+		return exitNoTargets, nil
 	}
+	if err != nil {
+		return exitFatal, err
+	}
+	logInfo("run.finished")
+	logSummary(summary)
+	return exitCode(summary, strict), nil
+}
 
-	for _, r := range config.Ranges {
-		r = strings.TrimSpace(r)
-		ips, err := expandRange(r)
-		if err != nil {
-			log.Printf("[ERRO] Erro expandindo range %s: %v", r, err)
-			continue
+// Contexto cancelado no primeiro SIGINT/SIGTERM, para o run terminar os hosts
+// em andamento e gerar o resumo; um segundo sinal encerra na hora.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			logWarn("run.interrupting", sig)
+			cancel()
+		case <-done:
+			return
 		}
-		for _, ip := range ips {
-			jobs <- ip
+		select {
+		case sig := <-signals:
+			logError("run.forced_exit", sig)
+			os.Exit(exitInterrupted)
+		case <-done:
 		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+			cancel()
+		})
 	}
-
-	close(jobs)
-	wg.Wait()
-	log.Println("[INFO] Discovery finalizado!")
 }
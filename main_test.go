@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Passa os logs para um buffer até o fim do teste.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var logs bytes.Buffer
+	prevOut, prevFormat, prevLevel := logOutput, logFormat, logLevel.Level()
+	t.Cleanup(func() {
+		logLevel.Set(prevLevel)
+		logFormat = prevFormat
+		setLogOutput(prevOut)
+	})
+	setLogOutput(&logs)
+	return &logs
+}
+
+// Coloca no PATH um ping que sempre responde.
+func fakePing(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("o ping falso é um script sh")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ping"), []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+}
+
+// Scan completo pelo CLI: ping do PATH, SNMP real nos IPs de loopback (sem
+// agente, falha) e a API do Zabbix falsa.
+func TestScanEndToEnd(t *testing.T) {
+	fakePing(t)
+	zbx := fakeZabbixAPI(t)
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "discovery.json", fmt.Sprintf(`{
+		"zabbix_url": %q,
+		"zabbix_group_ids": ["2"],
+		"snmp_communities": ["public"],
+		"snmp_timeout": "200ms",
+		"max_retries": 0,
+		"ranges": ["127.0.0.1-3"],
+		"include_self": true
+	}`, zbx.URL))
+	out := filepath.Join(dir, "results.json")
+	logs := captureLogs(t)
+
+	for _, tt := range []struct {
+		args []string
+		want int
+	}{
+		{nil, exitOK},
+		{[]string{"-strict"}, exitZabbixError},
+	} {
+		args := append([]string{"scan", "-config", path, "-output-json", out}, tt.args...)
+		if code := runMain(args); code != tt.want {
+			t.Fatalf("%v: esperava o código %d, obteve %d\n%s", tt.args, tt.want, code, logs)
+		}
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Run struct {
+			Totals jsonTotals `json:"totals"`
+		} `json:"run"`
+		Hosts []jsonHost `json:"hosts"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	totals := doc.Run.Totals
+	if totals.TargetsExpanded != 3 || totals.Alive != 3 || totals.SNMPOK != 0 || totals.HostsCreated != 0 {
+		t.Errorf("totais inesperados: %+v", totals)
+	}
+	if len(doc.Hosts) != 3 {
+		t.Fatalf("esperava 3 hosts no JSON, obteve %d", len(doc.Hosts))
+	}
+	for _, h := range doc.Hosts {
+		if h.SNMP.OK || h.SNMP.ErrorReason == "" || h.Zabbix != nil {
+			t.Errorf("%s: esperava falha de SNMP sem cadastro, obteve %+v", h.IP, h)
+		}
+	}
+}
+
+// -show-config e -list-profiles saem sem executar o ping, nem o -V da
+// detecção da variante.
+func TestScanShowConfigSkipsPing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("o ping falso é um script sh")
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> '" + calls + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "ping"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	path := writeConfig(t, dir, "discovery.json", `{
+		"zabbix_url": "http://zabbix.example",
+		"zabbix_group_ids": ["2"],
+		"snmp_communities": ["public"],
+		"ranges": ["10.0.0.0/30"]
+	}`)
+	logs := captureLogs(t)
+	for _, flag := range []string{"-show-config", "-list-profiles"} {
+		if code := runMain([]string{"scan", "-config", path, flag}); code != exitOK {
+			t.Fatalf("%s: esperava o código %d, obteve %d\n%s", flag, exitOK, code, logs)
+		}
+	}
+	if data, err := os.ReadFile(calls); err == nil {
+		t.Errorf("o ping foi executado:\n%s", data)
+	}
+}
+
+// Uma configuração inválida vira um código de saída, sem encerrar o processo.
+func TestScanBadConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"JSON inválido", `{"ranges": ["10.0.0.0/30"`},
+		{"chave desconhecida", `{"ranges": ["10.0.0.0/30"], "worker": 4}`},
+		{"tipo errado", `{"ranges": "10.0.0.0/30"}`},
+		{"range inválido", `{"zabbix_url": "http://zabbix.example", "zabbix_group_ids": ["2"], "snmp_communities": ["public"], "ranges": ["10.0.0.0/33"]}`},
+		{"workers negativo", `{"zabbix_url": "http://zabbix.example", "zabbix_group_ids": ["2"], "snmp_communities": ["public"], "ranges": ["10.0.0.0/30"], "workers": -1}`},
+	}
+	logs := captureLogs(t)
+	for _, tt := range tests {
+		path := writeConfig(t, dir, "discovery.json", tt.content)
+		if code := runMain([]string{"scan", "-config", path}); code != exitFatal {
+			t.Errorf("%s: esperava o código %d, obteve %d\n%s", tt.name, exitFatal, code, logs)
+		}
+	}
+	if code := runMain([]string{"scan", "-config", filepath.Join(dir, "nao-existe.json")}); code != exitFatal {
+		t.Errorf("arquivo ausente: esperava o código %d, obteve %d", exitFatal, code)
+	}
+}
+
+// O lock é solto mesmo quando o scan termina com erro depois de obtê-lo.
+func TestScanErrorReleasesLock(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "discovery.lock")
+	// Só o próprio endereço de loopback: nenhum alvo sobra para o scan
+	path := writeConfig(t, dir, "discovery.json", fmt.Sprintf(`{
+		"zabbix_url": "http://zabbix.example",
+		"zabbix_group_ids": ["2"],
+		"snmp_communities": ["public"],
+		"ranges": ["127.0.0.1"],
+		"lock_file": %q
+	}`, lockPath))
+	logs := captureLogs(t)
+	if code := runMain([]string{"scan", "-config", path}); code != exitNoTargets {
+		t.Fatalf("esperava o código %d, obteve %d\n%s", exitNoTargets, code, logs)
+	}
+	lock, err := acquireLock(lockPath, 0)
+	if err != nil {
+		t.Fatalf("lock não foi solto: %v", err)
+	}
+	lock.release()
+}
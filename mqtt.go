@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/mqtt"
+)
+
+// Espera máxima entre as tentativas de reconexão ao broker, que dobram a
+// partir de mqtt.reconnect_delay.
+const mqttMaxBackoff = time.Minute
+
+// MQTT configura a publicação dos eventos do discovery num broker MQTT: um
+// evento JSON por host concluído e um com o resumo no fim do run. O broker
+// fora do ar não atrasa o run: os eventos ficam num buffer limitado e os que
+// não couberem são descartados, com aviso.
+type MQTT struct {
+	Broker             string `json:"broker,omitempty" yaml:"broker" toml:"broker"` // mqtt://host:1883 ou mqtts://host:8883
+	ClientID           string `json:"client_id,omitempty" yaml:"client_id" toml:"client_id"`
+	Username           string `json:"username,omitempty" yaml:"username" toml:"username"`
+	Password           string `json:"password,omitempty" yaml:"password" toml:"password"`
+	CAFile             string `json:"ca_file,omitempty" yaml:"ca_file" toml:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+	// Tópicos dos eventos, com {range}, {ip}, {name}, {action} e {run_id}
+	Topic          string   `json:"topic" yaml:"topic" toml:"topic"`
+	SummaryTopic   string   `json:"summary_topic" yaml:"summary_topic" toml:"summary_topic"`
+	QoS            int      `json:"qos" yaml:"qos" toml:"qos"`
+	Retain         bool     `json:"retain,omitempty" yaml:"retain" toml:"retain"`
+	Buffer         int      `json:"buffer" yaml:"buffer" toml:"buffer"`
+	Timeout        Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+	KeepAlive      Duration `json:"keepalive" yaml:"keepalive" toml:"keepalive"`
+	ReconnectDelay Duration `json:"reconnect_delay" yaml:"reconnect_delay" toml:"reconnect_delay"`
+}
+
+// Campos dos tópicos, como {ip}.
+var mqttPlaceholder = regexp.MustCompile(`\{([a-z_]*)\}`)
+
+var mqttTopicFields = map[string]bool{"range": true, "ip": true, "name": true, "action": true, "run_id": true}
+
+func (m MQTT) validate(c Config) []error {
+	if m.Broker == "" {
+		return nil
+	}
+	var errs []error
+	broker, err := mqtt.ParseBroker(m.Broker)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("mqtt.broker inválido: %w%s", err, c.origin("mqtt.broker")))
+	}
+	if (m.CAFile != "" || m.InsecureSkipVerify) && err == nil && !broker.TLS {
+		errs = append(errs, fmt.Errorf("mqtt.ca_file e mqtt.insecure_skip_verify só valem com um broker mqtts://%s", c.origin("mqtt.broker")))
+	}
+	for _, t := range []struct{ key, topic string }{{"mqtt.topic", m.Topic}, {"mqtt.summary_topic", m.SummaryTopic}} {
+		if err := validTopic(t.topic); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w%s", t.key, err, c.origin(t.key)))
+		}
+	}
+	if m.QoS < 0 || m.QoS > 2 {
+		errs = append(errs, fmt.Errorf("mqtt.qos deve ser 0, 1 ou 2 (atual: %d)%s", m.QoS, c.origin("mqtt.qos")))
+	}
+	if m.Buffer < 1 {
+		errs = append(errs, fmt.Errorf("mqtt.buffer deve ser no mínimo 1 (atual: %d)%s", m.Buffer, c.origin("mqtt.buffer")))
+	}
+	if time.Duration(m.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("mqtt.timeout deve ser positivo%s", c.origin("mqtt.timeout")))
+	}
+	if time.Duration(m.KeepAlive) < 0 {
+		errs = append(errs, fmt.Errorf("mqtt.keepalive não pode ser negativo%s", c.origin("mqtt.keepalive")))
+	}
+	if time.Duration(m.ReconnectDelay) <= 0 {
+		errs = append(errs, fmt.Errorf("mqtt.reconnect_delay deve ser positivo%s", c.origin("mqtt.reconnect_delay")))
+	}
+	return errs
+}
+
+// Confere um tópico de publicação: sem curingas e só com campos conhecidos.
+func validTopic(topic string) error {
+	if strings.TrimSpace(topic) == "" {
+		return fmt.Errorf("o tópico não pode ser vazio")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("tópico %q com curinga (+ ou #)", topic)
+	}
+	for _, m := range mqttPlaceholder.FindAllStringSubmatch(topic, -1) {
+		if !mqttTopicFields[m[1]] {
+			return fmt.Errorf("campo desconhecido no tópico: %s (use {range}, {ip}, {name}, {action} ou {run_id})", m[0])
+		}
+	}
+	return nil
+}
+
+func (m MQTT) redacted() MQTT {
+	m.Password = maskSecret(m.Password)
+	return m
+}
+
+// Opções da conexão, com o client id padrão discoveryhosts-<máquina>-<pid>.
+func (m MQTT) options() (mqtt.Options, error) {
+	opts := mqtt.Options{
+		ClientID:  m.ClientID,
+		Username:  m.Username,
+		Password:  m.Password,
+		KeepAlive: time.Duration(m.KeepAlive),
+		Timeout:   time.Duration(m.Timeout),
+	}
+	if opts.ClientID == "" {
+		host, _ := os.Hostname()
+		opts.ClientID = fmt.Sprintf("discoveryhosts-%s-%d", host, os.Getpid())
+	}
+	if m.CAFile != "" || m.InsecureSkipVerify {
+		opts.TLS = &tls.Config{InsecureSkipVerify: m.InsecureSkipVerify}
+	}
+	if m.CAFile != "" {
+		pem, err := ioutil.ReadFile(m.CAFile)
+		if err != nil {
+			return opts, fmt.Errorf("falha ao ler a CA do MQTT %s: %w", m.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return opts, fmt.Errorf("nenhum certificado válido em %s", m.CAFile)
+		}
+		opts.TLS.RootCAs = pool
+	}
+	return opts, nil
+}
+
+// Tópico com os campos preenchidos. Barras e curingas dos valores (como o
+// "/" de um CIDR) viram "_", para não criar níveis nem assinaturas.
+func mqttTopic(topic string, fields map[string]string) string {
+	level := strings.NewReplacer("/", "_", "+", "_", "#", "_")
+	return mqttPlaceholder.ReplaceAllStringFunc(topic, func(m string) string {
+		v := level.Replace(fields[m[1:len(m)-1]])
+		if v == "" {
+			return "_"
+		}
+		return v
+	})
+}
+
+// Evento publicado: host, com o resultado no formato do -output-json, ou
+// run_finished, com o resumo.
+type mqttEvent struct {
+	Event  string    `json:"event"`
+	RunID  string    `json:"run_id"`
+	Time   time.Time `json:"time"`
+	DryRun bool      `json:"dry_run,omitempty"`
+	Host   *jsonHost `json:"host,omitempty"`
+	Run    *jsonRun  `json:"run,omitempty"`
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+// Publica os eventos do run no broker por um único goroutine, que conecta
+// ao receber o primeiro evento e reconecta (com espera crescente) quando a
+// conexão cai; um evento que falhou é publicado de novo na nova conexão. O
+// write nunca bloqueia: com o buffer cheio o evento é descartado. No close,
+// os eventos pendentes têm até mqtt.timeout para sair antes do DISCONNECT.
+type mqttSink struct {
+	cfg    MQTT
+	broker mqtt.Broker
+	opts   mqtt.Options
+	cfgAll Config
+	runID  string
+	dryRun bool
+
+	queue     chan mqttMessage
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	published atomic.Int32
+	dropped   atomic.Int32
+}
+
+func newMQTTSink(cfg Config, runID string, dryRun bool) (*mqttSink, error) {
+	broker, err := mqtt.ParseBroker(cfg.MQTT.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt.broker: %w", err)
+	}
+	opts, err := cfg.MQTT.options()
+	if err != nil {
+		return nil, err
+	}
+	s := &mqttSink{
+		cfg:    cfg.MQTT,
+		broker: broker,
+		opts:   opts,
+		cfgAll: cfg,
+		runID:  runID,
+		dryRun: dryRun,
+		queue:  make(chan mqttMessage, cfg.MQTT.Buffer),
+		done:   make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go s.run()
+	return s, nil
+}
+
+func (s *mqttSink) write(r discovery.HostResult) error {
+	host := newJSONHost(r)
+	topic := mqttTopic(s.cfg.Topic, map[string]string{
+		"range": r.Range, "ip": r.IP, "name": r.Name(), "action": r.ZabbixAction, "run_id": s.runID,
+	})
+	s.publish(topic, mqttEvent{Event: "host", RunID: s.runID, Time: time.Now(), DryRun: s.dryRun, Host: &host})
+	return nil
+}
+
+func (s *mqttSink) close(sum discovery.Summary) error {
+	run := newJSONRun(sum, s.cfgAll, s.dryRun)
+	s.publish(mqttTopic(s.cfg.SummaryTopic, map[string]string{"run_id": s.runID}),
+		mqttEvent{Event: "run_finished", RunID: s.runID, Time: time.Now(), DryRun: s.dryRun, Run: &run})
+	close(s.queue)
+	select {
+	case <-s.done:
+	case <-time.After(time.Duration(s.cfg.Timeout)):
+		logWarn("mqtt.shutdown_timeout", s.cfg.Timeout)
+		s.cancel()
+		<-s.done
+	}
+	s.cancel()
+	rootLog.Summaryf("summary.mqtt", s.published.Load(), s.cfg.Broker)
+	if n := s.dropped.Load(); n > 0 {
+		logWarn("mqtt.dropped", n)
+	}
+	return nil
+}
+
+// Desiste do broker sem o evento do fim do run.
+func (s *mqttSink) abort() {
+	s.cancel()
+	<-s.done
+}
+
+// Coloca o evento no buffer, descartando-o se estiver cheio.
+func (s *mqttSink) publish(topic string, event mqttEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	select {
+	case s.queue <- mqttMessage{topic: topic, payload: payload}:
+	default:
+		if s.dropped.Add(1) == 1 {
+			logWarn("mqtt.queue_full", s.cfg.Buffer)
+		}
+	}
+}
+
+// Publicador: esvazia o buffer até o close, mantendo a conexão viva com o
+// PINGREQ do keepalive.
+func (s *mqttSink) run() {
+	defer close(s.done)
+	var client *mqtt.Client
+	disconnect := func() {
+		if client != nil {
+			client.Close()
+			client = nil
+		}
+	}
+	defer disconnect()
+	var ping <-chan time.Time
+	if s.opts.KeepAlive > 0 {
+		ticker := time.NewTicker(s.opts.KeepAlive)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	delay := time.Duration(s.cfg.ReconnectDelay)
+	// Espera antes de uma nova conexão; false se o close desistiu do broker
+	backoff := func() bool {
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			return false
+		}
+		delay = min(2*delay, mqttMaxBackoff)
+		return true
+	}
+	connected := false
+	var pending *mqttMessage
+	for {
+		if pending == nil {
+			select {
+			case msg, ok := <-s.queue:
+				if !ok {
+					return
+				}
+				pending = &msg
+			case <-ping:
+				if client != nil {
+					if err := client.Ping(); err != nil {
+						logWarn("mqtt.connection_lost", s.cfg.Broker, err)
+						disconnect()
+					}
+				}
+				continue
+			case <-s.ctx.Done():
+				s.discard(nil)
+				return
+			}
+		}
+		if client == nil {
+			c, err := mqtt.Dial(s.ctx, s.broker, s.opts)
+			if err != nil {
+				if s.ctx.Err() != nil {
+					s.discard(pending)
+					return
+				}
+				logWarn("mqtt.connect_failed", s.cfg.Broker, err, delay)
+				if !backoff() {
+					s.discard(pending)
+					return
+				}
+				continue
+			}
+			client = c
+			if connected {
+				logInfo("mqtt.reconnected", s.cfg.Broker)
+			} else {
+				logInfo("mqtt.connected", s.cfg.Broker, s.opts.ClientID)
+				connected = true
+			}
+		}
+		if err := client.Publish(pending.topic, pending.payload, byte(s.cfg.QoS), s.cfg.Retain); err != nil {
+			logWarn("mqtt.publish_failed", pending.topic, err)
+			disconnect()
+			if !backoff() {
+				s.discard(pending)
+				return
+			}
+			continue
+		}
+		s.published.Add(1)
+		pending, delay = nil, time.Duration(s.cfg.ReconnectDelay)
+	}
+}
+
+// Conta como descartados o evento em andamento e os que restam no buffer,
+// quando o close desiste de esperar o broker.
+func (s *mqttSink) discard(pending *mqttMessage) {
+	n := len(s.queue)
+	if pending != nil {
+		n++
+	}
+	s.dropped.Add(int32(n))
+}
@@ -0,0 +1,306 @@
+// Package mqtt implementa o cliente mínimo de MQTT 3.1.1 usado para publicar
+// os eventos do discovery: conexão (com TLS e login), PUBLISH com QoS 0, 1 ou
+// 2, PINGREQ e DISCONNECT. Não há assinaturas; o cliente não é seguro para
+// uso por vários goroutines ao mesmo tempo.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Tipos dos pacotes de controle (os 4 bits altos do primeiro byte).
+const (
+	packetConnect    = 1
+	packetConnAck    = 2
+	packetPublish    = 3
+	packetPubAck     = 4
+	packetPubRec     = 5
+	packetPubRel     = 6
+	packetPubComp    = 7
+	packetPingReq    = 12
+	packetPingResp   = 13
+	packetDisconnect = 14
+)
+
+// Limite de um pacote recebido; o broker só manda confirmações.
+const maxIncoming = 1 << 16
+
+// Motivos de recusa do CONNACK, pelo código de retorno.
+var connectRefused = map[byte]string{
+	1: "versão do protocolo não suportada",
+	2: "client id recusado",
+	3: "broker indisponível",
+	4: "usuário ou senha inválidos",
+	5: "não autorizado",
+}
+
+// ErrRefused indica uma conexão recusada pelo broker (CONNACK com código
+// diferente de zero).
+var ErrRefused = errors.New("conexão recusada pelo broker")
+
+// Options configura a conexão com o broker.
+type Options struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration // zero desliga o keepalive no broker
+	Timeout   time.Duration // da conexão e de cada confirmação
+	// TLS das URLs mqtts://; nil usa a configuração padrão, com o host da URL
+	TLS *tls.Config
+}
+
+// Broker é o endereço de uma URL de broker: mqtt:// ou tcp:// (porta 1883)
+// e mqtts://, ssl:// ou tls:// (porta 8883, com TLS).
+type Broker struct {
+	Addr string
+	Host string
+	TLS  bool
+}
+
+// ParseBroker interpreta a URL do broker.
+func ParseBroker(raw string) (Broker, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Broker{}, err
+	}
+	if u.Hostname() == "" {
+		return Broker{}, fmt.Errorf("URL sem host: %q", raw)
+	}
+	b := Broker{Host: u.Hostname()}
+	port := "1883"
+	switch strings.ToLower(u.Scheme) {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl", "tls":
+		b.TLS, port = true, "8883"
+	default:
+		return Broker{}, fmt.Errorf("esquema desconhecido: %q (use mqtt:// ou mqtts://)", u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	b.Addr = net.JoinHostPort(b.Host, port)
+	return b, nil
+}
+
+// Client é uma conexão com o broker.
+type Client struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	nextID  uint16
+}
+
+// Dial conecta ao broker e envia o CONNECT com clean session, esperando o
+// CONNACK.
+func Dial(ctx context.Context, broker Broker, opts Options) (*Client, error) {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var conn net.Conn
+	var err error
+	if broker.TLS {
+		cfg := opts.TLS
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName = broker.Host
+		}
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: cfg}).DialContext(ctx, "tcp", broker.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", broker.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn, r: bufio.NewReader(conn), timeout: opts.Timeout}
+	if err := c.connect(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) connect(opts Options) error {
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4) // 3.1.1
+	flags := byte(0x02)    // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = appendString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		body = appendString(body, opts.Password)
+	}
+	if err := c.send(packetConnect<<4, body); err != nil {
+		return err
+	}
+	kind, payload, err := c.receive()
+	if err != nil {
+		return fmt.Errorf("sem CONNACK do broker: %w", err)
+	}
+	if kind != packetConnAck || len(payload) != 2 {
+		return fmt.Errorf("resposta inesperada ao CONNECT (pacote %d)", kind)
+	}
+	if code := payload[1]; code != 0 {
+		if reason, ok := connectRefused[code]; ok {
+			return fmt.Errorf("%w: %s", ErrRefused, reason)
+		}
+		return fmt.Errorf("%w: código %d", ErrRefused, code)
+	}
+	return nil
+}
+
+// Publish publica a mensagem e, com QoS 1 ou 2, espera a confirmação do
+// broker.
+func (c *Client) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	if qos > 2 {
+		return fmt.Errorf("QoS inválido: %d", qos)
+	}
+	header := byte(packetPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	var id uint16
+	if qos > 0 {
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+		id = c.nextID
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+	if err := c.send(header, body); err != nil {
+		return err
+	}
+	switch qos {
+	case 1:
+		return c.expect(packetPubAck, id)
+	case 2:
+		if err := c.expect(packetPubRec, id); err != nil {
+			return err
+		}
+		if err := c.send(packetPubRel<<4|0x02, binary.BigEndian.AppendUint16(nil, id)); err != nil {
+			return err
+		}
+		return c.expect(packetPubComp, id)
+	}
+	return nil
+}
+
+// Ping envia um PINGREQ e espera o PINGRESP, mantendo a conexão viva.
+func (c *Client) Ping() error {
+	if err := c.send(packetPingReq<<4, nil); err != nil {
+		return err
+	}
+	return c.expect(packetPingResp, 0)
+}
+
+// Close envia o DISCONNECT e fecha a conexão.
+func (c *Client) Close() error {
+	c.send(packetDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+// Espera a confirmação do tipo e id, ignorando PINGRESPs atrasados.
+func (c *Client) expect(kind byte, id uint16) error {
+	for {
+		got, payload, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if got == packetPingResp && kind != packetPingResp {
+			continue
+		}
+		if got != kind {
+			return fmt.Errorf("resposta inesperada do broker (pacote %d, esperava %d)", got, kind)
+		}
+		if kind == packetPingResp {
+			return nil
+		}
+		if len(payload) < 2 || binary.BigEndian.Uint16(payload) != id {
+			return fmt.Errorf("confirmação de outra mensagem (pacote %d)", got)
+		}
+		return nil
+	}
+}
+
+func (c *Client) send(header byte, body []byte) error {
+	packet := []byte{header}
+	packet = appendLength(packet, len(body))
+	packet = append(packet, body...)
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+func (c *Client) receive() (byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("tamanho de pacote inválido")
+		}
+		multiplier *= 128
+	}
+	if length > maxIncoming {
+		return 0, nil, fmt.Errorf("pacote de %d bytes do broker", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, payload, nil
+}
+
+// Tamanho restante do pacote, em até 4 bytes de 7 bits.
+func appendLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,203 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"discoveryhosts/mqtt/mqtttest"
+)
+
+func TestAppendLength(t *testing.T) {
+	// Exemplos da seção 2.2.3 do MQTT 3.1.1
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{268435455, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, tt := range tests {
+		if got := appendLength(nil, tt.n); !bytes.Equal(got, tt.want) {
+			t.Errorf("appendLength(%d): esperava % x, obteve % x", tt.n, tt.want, got)
+		}
+	}
+}
+
+// Cliente numa ponta do net.Pipe; o broker do roteiro atende a outra, lendo
+// os pacotes com expectPacket e respondendo com Write.
+func pipeClient(t *testing.T, broker func(server net.Conn, r *bufio.Reader)) *Client {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		broker(server, bufio.NewReader(server))
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	return &Client{conn: client, r: bufio.NewReader(client), timeout: 2 * time.Second}
+}
+
+// Lê o próximo pacote e o compara, byte a byte, com want.
+func expectPacket(t *testing.T, r *bufio.Reader, want []byte) {
+	t.Helper()
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Errorf("esperava % x: %v", want, err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("pacote incorreto:\nobteve   % x\nesperava % x", got, want)
+	}
+}
+
+func TestConnectPacket(t *testing.T) {
+	c := pipeClient(t, func(server net.Conn, r *bufio.Reader) {
+		expectPacket(t, r, []byte{
+			0x10, 0x14, // CONNECT, 20 bytes
+			0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, // protocolo 3.1.1
+			0xc2,       // usuário, senha e clean session
+			0x00, 0x1e, // keepalive de 30s
+			0x00, 0x02, 'c', '1',
+			0x00, 0x01, 'u',
+			0x00, 0x01, 'p',
+		})
+		server.Write([]byte{0x20, 0x02, 0x00, 0x00})
+	})
+	if err := c.connect(Options{ClientID: "c1", Username: "u", Password: "p", KeepAlive: 30 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	c := pipeClient(t, func(server net.Conn, r *bufio.Reader) {
+		expectPacket(t, r, []byte{0x10, 0x0e, 0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x00, 0x00, 0x02, 'c', '1'})
+		server.Write([]byte{0x20, 0x02, 0x00, 0x04})
+	})
+	err := c.connect(Options{ClientID: "c1"})
+	if !errors.Is(err, ErrRefused) || !strings.Contains(err.Error(), "usuário ou senha") {
+		t.Errorf("esperava ErrRefused por usuário ou senha, obteve %v", err)
+	}
+}
+
+// O QoS 1 espera o PUBACK do próprio packet id, ignorando PINGRESPs
+// atrasados.
+func TestPublishQoS1(t *testing.T) {
+	c := pipeClient(t, func(server net.Conn, r *bufio.Reader) {
+		expectPacket(t, r, []byte{0x32, 0x0b, 0x00, 0x05, 'a', '/', 'b', '/', 'c', 0x00, 0x01, 'h', 'i'})
+		server.Write([]byte{0xd0, 0x00, 0x40, 0x02, 0x00, 0x01})
+		expectPacket(t, r, []byte{0x33, 0x0b, 0x00, 0x05, 'a', '/', 'b', '/', 'c', 0x00, 0x02, 'h', 'i'})
+		// Confirmação de outra mensagem
+		server.Write([]byte{0x40, 0x02, 0x00, 0x01})
+	})
+	if err := c.Publish("a/b/c", []byte("hi"), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish("a/b/c", []byte("hi"), 1, true); err == nil || !strings.Contains(err.Error(), "outra mensagem") {
+		t.Errorf("esperava erro do PUBACK de outro packet id, obteve %v", err)
+	}
+}
+
+func TestPublishQoS2(t *testing.T) {
+	c := pipeClient(t, func(server net.Conn, r *bufio.Reader) {
+		expectPacket(t, r, []byte{0x34, 0x06, 0x00, 0x01, 't', 0x00, 0x01, 'x'})
+		server.Write([]byte{0x50, 0x02, 0x00, 0x01})
+		expectPacket(t, r, []byte{0x62, 0x02, 0x00, 0x01})
+		server.Write([]byte{0x70, 0x02, 0x00, 0x01})
+	})
+	if err := c.Publish("t", []byte("x"), 2, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Sem confirmação no QoS 0; o Close manda o DISCONNECT.
+func TestPublishQoS0AndClose(t *testing.T) {
+	c := pipeClient(t, func(server net.Conn, r *bufio.Reader) {
+		expectPacket(t, r, []byte{0x31, 0x04, 0x00, 0x01, 't', 'x'})
+		expectPacket(t, r, []byte{0xe0, 0x00})
+		if _, err := r.ReadByte(); err != io.EOF {
+			t.Errorf("esperava a conexão fechada depois do DISCONNECT, obteve %v", err)
+		}
+	})
+	if err := c.Publish("t", []byte("x"), 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Sem PUBACK dentro do timeout, o Publish falha em vez de travar.
+func TestPublishTimeout(t *testing.T) {
+	c := pipeClient(t, func(server net.Conn, r *bufio.Reader) {
+		mqtttest.ReadPacket(r)
+		io.Copy(io.Discard, r)
+	})
+	c.timeout = 50 * time.Millisecond
+	if err := c.Publish("t", []byte("x"), 1, false); err == nil {
+		t.Error("esperava erro sem o PUBACK")
+	}
+}
+
+// Dial conecta pelo endereço da URL e publica no broker falso.
+func TestDial(t *testing.T) {
+	b := &mqtttest.Broker{}
+	b.Start(t)
+	broker, err := ParseBroker(b.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Dial(context.Background(), broker, Options{ClientID: "c1", Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish("discovery/host", []byte("{}"), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if msgs := b.Messages(); len(msgs) != 1 || msgs[0].Topic != "discovery/host" || msgs[0].QoS != 1 {
+		t.Errorf("mensagens recebidas incorretas: %+v", msgs)
+	}
+}
+
+func TestParseBroker(t *testing.T) {
+	tests := []struct {
+		url, addr string
+		tls       bool
+	}{
+		{"mqtt://broker", "broker:1883", false},
+		{"tcp://broker:1884", "broker:1884", false},
+		{"mqtts://broker", "broker:8883", true},
+		{"ssl://[::1]:9000", "[::1]:9000", true},
+	}
+	for _, tt := range tests {
+		b, err := ParseBroker(tt.url)
+		if err != nil || b.Addr != tt.addr || b.TLS != tt.tls {
+			t.Errorf("%s: obteve %+v, %v", tt.url, b, err)
+		}
+	}
+	for _, bad := range []string{"http://broker", "mqtt://", "broker:1883"} {
+		if _, err := ParseBroker(bad); err == nil {
+			t.Errorf("%s: esperava erro", bad)
+		}
+	}
+}
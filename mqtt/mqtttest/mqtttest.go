@@ -0,0 +1,195 @@
+// Package mqtttest fornece um broker MQTT 3.1.1 mínimo num endereço local,
+// para exercitar o cliente e a publicação dos eventos sem um broker de
+// verdade.
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// Message é um PUBLISH recebido pelo broker.
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// Broker aceita conexões e confirma cada PUBLISH conforme o QoS. Os campos de
+// configuração valem a partir do Start.
+type Broker struct {
+	// Código de retorno do CONNACK; diferente de zero recusa a conexão
+	ConnAck byte
+	// As primeiras Drops conexões são fechadas ao receber um PUBLISH, sem
+	// confirmá-lo, como um broker que caiu
+	Drops int
+	// Aceita as conexões sem nunca responder ao CONNECT
+	Stall bool
+
+	ln          net.Listener
+	mu          sync.Mutex
+	messages    []Message
+	connects    int
+	disconnects int
+}
+
+// Start inicia o broker, fechado no fim do teste.
+func (b *Broker) Start(t testing.TB) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ln = ln
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c)
+		}
+	}()
+}
+
+// URL é o endereço do broker, como mqtt://127.0.0.1:1883.
+func (b *Broker) URL() string {
+	return "mqtt://" + b.ln.Addr().String()
+}
+
+// Messages são os PUBLISH confirmados (ou, com QoS 0, recebidos), em ordem.
+func (b *Broker) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message{}, b.messages...)
+}
+
+// Connects é o número de CONNECTs recebidos.
+func (b *Broker) Connects() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.connects
+}
+
+// Disconnects é o número de DISCONNECTs recebidos.
+func (b *Broker) Disconnects() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.disconnects
+}
+
+func (b *Broker) serve(c net.Conn) {
+	defer c.Close()
+	if b.Stall {
+		io.Copy(io.Discard, c)
+		return
+	}
+	r := bufio.NewReader(c)
+	for {
+		header, body, err := ReadPacket(r)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: // CONNECT
+			b.mu.Lock()
+			b.connects++
+			b.mu.Unlock()
+			c.Write([]byte{0x20, 0x02, 0x00, b.ConnAck})
+			if b.ConnAck != 0 {
+				return
+			}
+		case 3: // PUBLISH
+			m, id, err := parsePublish(header, body)
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			drop := b.Drops > 0
+			if drop {
+				b.Drops--
+			} else {
+				b.messages = append(b.messages, m)
+			}
+			b.mu.Unlock()
+			if drop {
+				return
+			}
+			switch m.QoS {
+			case 1:
+				c.Write(append([]byte{0x40, 0x02}, id...))
+			case 2:
+				c.Write(append([]byte{0x50, 0x02}, id...))
+				if h, _, err := ReadPacket(r); err != nil || h != 0x62 {
+					return
+				}
+				c.Write(append([]byte{0x70, 0x02}, id...))
+			}
+		case 12: // PINGREQ
+			c.Write([]byte{0xd0, 0x00})
+		case 14: // DISCONNECT
+			b.mu.Lock()
+			b.disconnects++
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// ReadPacket lê um pacote de controle: o primeiro byte e o restante.
+func ReadPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(d&0x7f) * multiplier
+		if d&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("tamanho de pacote inválido")
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// O PUBLISH e o packet id (vazio com QoS 0).
+func parsePublish(header byte, body []byte) (Message, []byte, error) {
+	m := Message{QoS: header >> 1 & 3, Retain: header&1 != 0}
+	if len(body) < 2 {
+		return m, nil, fmt.Errorf("PUBLISH truncado")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	if len(body) < n {
+		return m, nil, fmt.Errorf("PUBLISH truncado")
+	}
+	m.Topic, body = string(body[:n]), body[n:]
+	var id []byte
+	if m.QoS > 0 {
+		if len(body) < 2 {
+			return m, nil, fmt.Errorf("PUBLISH sem packet id")
+		}
+		id, body = body[:2], body[2:]
+	}
+	m.Payload = append([]byte{}, body...)
+	return m, id, nil
+}
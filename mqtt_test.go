@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/mqtt/mqtttest"
+	"discoveryhosts/snmpinfo"
+)
+
+// Publicação no broker falso, com reconexão rápida e sem keepalive.
+func testMQTTSink(t *testing.T, b *mqtttest.Broker, buffer int) *mqttSink {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.MQTT.Broker = b.URL()
+	cfg.MQTT.Buffer = buffer
+	cfg.MQTT.Timeout = Duration(300 * time.Millisecond)
+	cfg.MQTT.KeepAlive = 0
+	cfg.MQTT.ReconnectDelay = Duration(10 * time.Millisecond)
+	s, err := newMQTTSink(cfg, "r1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func mqttHosts() []discovery.HostResult {
+	var hosts []discovery.HostResult
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		hosts = append(hosts, discovery.HostResult{IP: ip, Range: "10.0.0.0/24", Alive: true, SNMP: snmpinfo.Info{SysName: "sw-" + ip}})
+	}
+	return hosts
+}
+
+// Espera até cond ser verdadeira, por até 2s.
+func eventually(cond func() bool) bool {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+// Os eventos saem em ordem, com o resumo por último, e o close termina com
+// o DISCONNECT.
+func TestMQTTSinkPublishes(t *testing.T) {
+	captureLogs(t)
+	b := &mqtttest.Broker{}
+	b.Start(t)
+	s := testMQTTSink(t, b, 10)
+	for _, r := range mqttHosts() {
+		s.write(r)
+	}
+	s.close(discovery.Summary{RunID: "r1"})
+
+	msgs := b.Messages()
+	if len(msgs) != 4 || s.published.Load() != 4 || s.dropped.Load() != 0 {
+		t.Fatalf("esperava 4 eventos publicados, obteve %d (%d publicados, %d descartados)", len(msgs), s.published.Load(), s.dropped.Load())
+	}
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		var ev mqttEvent
+		if err := json.Unmarshal(msgs[i].Payload, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if want := "discovery/10.0.0.0_24/" + ip; msgs[i].Topic != want || ev.Event != "host" || ev.Host == nil || ev.Host.IP != ip || msgs[i].QoS != 1 {
+			t.Errorf("evento %d: tópico %s, %+v", i, msgs[i].Topic, ev)
+		}
+	}
+	if msgs[3].Topic != "discovery/summary" || !strings.Contains(string(msgs[3].Payload), `"event":"run_finished"`) {
+		t.Errorf("esperava o resumo por último, obteve %s: %s", msgs[3].Topic, msgs[3].Payload)
+	}
+	if !eventually(func() bool { return b.Disconnects() == 1 }) {
+		t.Error("esperava o DISCONNECT no close")
+	}
+}
+
+// Com a conexão perdida num PUBLISH, o evento é publicado de novo depois de
+// reconectar.
+func TestMQTTSinkReconnects(t *testing.T) {
+	logs := captureLogs(t)
+	b := &mqtttest.Broker{Drops: 1}
+	b.Start(t)
+	s := testMQTTSink(t, b, 10)
+	for _, r := range mqttHosts() {
+		s.write(r)
+	}
+	s.close(discovery.Summary{RunID: "r1"})
+
+	msgs := b.Messages()
+	if len(msgs) != 4 || s.dropped.Load() != 0 {
+		t.Fatalf("esperava os 4 eventos depois da reconexão, obteve %d (%d descartados)\n%s", len(msgs), s.dropped.Load(), logs)
+	}
+	if !strings.HasSuffix(msgs[0].Topic, "/10.0.0.1") {
+		t.Errorf("esperava o evento perdido publicado primeiro, obteve %s", msgs[0].Topic)
+	}
+	if b.Connects() != 2 || !strings.Contains(logs.String(), "reconectado") {
+		t.Errorf("esperava uma reconexão, obteve %d conexões\n%s", b.Connects(), logs)
+	}
+}
+
+// Com o broker travado, o buffer enche: os eventos seguintes são descartados
+// com um aviso só, e o close desiste no mqtt.timeout contando todos eles.
+func TestMQTTSinkBufferFull(t *testing.T) {
+	logs := captureLogs(t)
+	b := &mqtttest.Broker{Stall: true}
+	b.Start(t)
+	s := testMQTTSink(t, b, 2)
+	for i := 0; i < 10; i++ {
+		s.write(mqttHosts()[0])
+	}
+	if n := s.dropped.Load(); n < 7 {
+		t.Errorf("esperava ao menos 7 eventos descartados com o buffer de 2, obteve %d", n)
+	}
+	start := time.Now()
+	s.close(discovery.Summary{RunID: "r1"})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("close levou %s com o broker travado", elapsed)
+	}
+	if s.published.Load() != 0 || s.dropped.Load() != 11 {
+		t.Errorf("esperava os 11 eventos descartados, obteve %d publicados e %d descartados", s.published.Load(), s.dropped.Load())
+	}
+	out := logs.String()
+	if strings.Count(out, "buffer cheio") != 1 || !strings.Contains(out, "desistindo do broker") || !strings.Contains(out, "11 evento(s) descartados") {
+		t.Errorf("avisos do buffer cheio e do close incorretos:\n%s", out)
+	}
+}
+
+// O abort desiste do broker sem publicar o resumo.
+func TestMQTTSinkAbort(t *testing.T) {
+	captureLogs(t)
+	b := &mqtttest.Broker{}
+	b.Start(t)
+	s := testMQTTSink(t, b, 10)
+	s.write(mqttHosts()[0])
+	if !eventually(func() bool { return s.published.Load() == 1 }) {
+		t.Fatal("evento não publicado")
+	}
+	done := make(chan struct{})
+	go func() {
+		s.abort()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("abort não retornou")
+	}
+	for _, m := range b.Messages() {
+		if m.Topic == "discovery/summary" {
+			t.Error("o abort publicou o resumo")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io/ioutil"
+	"net/netip"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/snmpinfo"
+)
+
+//go:embed nagios.cfg.tmpl
+var defaultNagiosTemplate string
+
+// Caracteres que o Nagios (e o Icinga 1) não aceita em nomes de objetos, além
+// dos espaços: os de illegal_object_name_chars do nagios.cfg padrão.
+const nagiosIllegalChars = "`~!$%^&*|'\"<>?,()="
+
+// nagiosHost é um host do -output-nagios: o resultado completo do discovery,
+// com o host_name já corrigido e sem repetições.
+type nagiosHost struct {
+	discovery.HostResult
+	HostName string
+}
+
+// Dados do template do -output-nagios.
+type nagiosExport struct {
+	Summary   discovery.Summary
+	Version   string
+	DryRun    bool
+	Generated time.Time
+	Hosts     []nagiosHost // em ordem de IP
+	Ranges    []string     // ranges com algum host, na ordem de ranges
+}
+
+var nagiosFuncs = template.FuncMap{
+	// Grupo do range, como range_10_91_50_1_14
+	"hostgroup": func(r string) string { return ansibleGroup("range", r) },
+	// Valor numa linha só, para as diretivas do arquivo
+	"oneline": func(s string) string { return strings.Join(strings.Fields(s), " ") },
+	"services": func(ports []int) []string {
+		names := make([]string, len(ports))
+		for i, p := range ports {
+			names[i] = discovery.ServiceName(p)
+		}
+		return names
+	},
+	"join":   func(s []string, sep string) string { return strings.Join(s, sep) },
+	"vendor": snmpinfo.Vendor,
+}
+
+// Grava no close um único arquivo de configuração para pollers legados
+// (Nagios, Icinga 1), com os hosts identificados (com sysName ou cadastrados
+// pelo nome DNS) passados por um text/template. O template padrão gera um
+// define host por host e um define hostgroup por range.
+type nagiosSink struct {
+	path   string
+	tmpl   *template.Template
+	ranges []string
+	dryRun bool
+	hosts  []nagiosHost
+	names  map[string]bool
+}
+
+// Carrega e confere o template já no início: além do parse, ele é executado
+// com um host de exemplo, para que um campo inexistente apareça antes do
+// scan, e não no fim.
+func newNagiosSink(path, templatePath string, cfg Config, dryRun bool) (*nagiosSink, error) {
+	name, text := "nagios.cfg.tmpl", defaultNagiosTemplate
+	if templatePath != "" {
+		data, err := ioutil.ReadFile(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao ler o template %s: %w", templatePath, err)
+		}
+		name, text = filepath.Base(templatePath), string(data)
+	}
+	tmpl, err := template.New(name).Funcs(nagiosFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template do -output-nagios inválido: %w", err)
+	}
+	s := &nagiosSink{path: path, tmpl: tmpl, dryRun: dryRun, names: map[string]bool{}}
+	for _, r := range cfg.Ranges {
+		s.ranges = append(s.ranges, strings.TrimSpace(r))
+	}
+	sample := nagiosHost{HostName: "sw-exemplo", HostResult: discovery.HostResult{
+		IP: "192.0.2.10", Range: "192.0.2.0/24", Alive: true, OpenPorts: []int{22, 443},
+		SNMP: snmpinfo.Info{SysName: "sw-exemplo", SysDescr: "Exemplo", SysObjectID: "1.3.6.1.4.1.9.1.2066", SysLocation: "Exemplo", Version: "2c"},
+	}}
+	if _, err := s.render([]nagiosHost{sample}, []string{sample.Range}, discovery.Summary{RunID: "exemplo"}); err != nil {
+		return nil, fmt.Errorf("template do -output-nagios inválido: %w", err)
+	}
+	return s, nil
+}
+
+func (s *nagiosSink) write(r discovery.HostResult) error {
+	name := nagiosName(r.Name())
+	if name == "" {
+		return nil
+	}
+	// Dois IPs com o mesmo nome: o segundo ganha um sufixo ("sw-core-2")
+	base := name
+	for n := 2; s.names[name]; n++ {
+		name = base + "-" + strconv.Itoa(n)
+	}
+	s.names[name] = true
+	s.hosts = append(s.hosts, nagiosHost{HostResult: r, HostName: name})
+	return nil
+}
+
+func (s *nagiosSink) close(sum discovery.Summary) error {
+	sort.SliceStable(s.hosts, func(i, j int) bool {
+		a, errA := netip.ParseAddr(s.hosts[i].IP)
+		b, errB := netip.ParseAddr(s.hosts[j].IP)
+		if errA != nil || errB != nil {
+			return s.hosts[i].IP < s.hosts[j].IP
+		}
+		return a.Less(b)
+	})
+	used := map[string]bool{}
+	for _, h := range s.hosts {
+		used[h.Range] = true
+	}
+	var ranges []string
+	for _, r := range s.ranges {
+		if used[r] {
+			ranges = append(ranges, r)
+			delete(used, r)
+		}
+	}
+	data, err := s.render(s.hosts, ranges, sum)
+	if err != nil {
+		return fmt.Errorf("falha ao gerar %s: %w", s.path, err)
+	}
+	if err := writeFileAtomic(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("falha ao gravar %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *nagiosSink) render(hosts []nagiosHost, ranges []string, sum discovery.Summary) ([]byte, error) {
+	var buf bytes.Buffer
+	err := s.tmpl.Execute(&buf, nagiosExport{
+		Summary:   sum,
+		Version:   version,
+		DryRun:    s.dryRun,
+		Generated: time.Now(),
+		Hosts:     hosts,
+		Ranges:    ranges,
+	})
+	return buf.Bytes(), err
+}
+
+// Nome de objeto válido no Nagios: espaços e caracteres proibidos viram "_".
+func nagiosName(name string) string {
+	var b strings.Builder
+	for _, c := range strings.TrimSpace(name) {
+		if c <= ' ' || strings.ContainsRune(nagiosIllegalChars, c) {
+			b.WriteByte('_')
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
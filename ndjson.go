@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"discoveryhosts/discovery"
+)
+
+// Linhas pendentes no -output ndjson antes de aplicar a política de
+// consumidor lento.
+const ndjsonBuffer = 1024
+
+// Políticas quando o consumidor do stdout não acompanha o scan
+const (
+	ndjsonBlock = "block" // o coletor espera; nenhuma linha é perdida, o scan desacelera
+	ndjsonDrop  = "drop"  // linhas excedentes são descartadas e contadas no resumo
+)
+
+type ndjsonHost struct {
+	Type string `json:"type"`
+	jsonHost
+}
+
+type ndjsonSummary struct {
+	Type          string `json:"type"`
+	SchemaVersion int    `json:"schema_version"`
+	jsonRun
+	Dropped int `json:"dropped"`
+}
+
+// Emite cada host concluído como uma linha JSON assim que o coletor o
+// recebe, e uma linha "type":"summary" no fim. As linhas passam por um
+// buffer limitado escrito por um goroutine próprio, para que um consumidor
+// lento não trave o coletor além do que a política permite.
+type ndjsonSink struct {
+	w       io.Writer
+	cfg     Config
+	dryRun  bool
+	drop    bool
+	lines   chan []byte
+	done    sync.WaitGroup
+	dropped int
+	err     error // primeiro erro de escrita, lido após done
+}
+
+func newNDJSONSink(w io.Writer, cfg Config, dryRun bool, policy string) (*ndjsonSink, error) {
+	if policy != ndjsonBlock && policy != ndjsonDrop {
+		return nil, fmt.Errorf("-ndjson-policy inválida: %s (use block ou drop)", policy)
+	}
+	s := &ndjsonSink{w: w, cfg: cfg, dryRun: dryRun, drop: policy == ndjsonDrop, lines: make(chan []byte, ndjsonBuffer)}
+	s.done.Add(1)
+	go func() {
+		defer s.done.Done()
+		for line := range s.lines {
+			if s.err != nil {
+				continue
+			}
+			if _, err := s.w.Write(line); err != nil {
+				s.err = err
+			}
+		}
+	}()
+	return s, nil
+}
+
+func (s *ndjsonSink) write(r discovery.HostResult) error {
+	line, err := json.Marshal(ndjsonHost{Type: "host", jsonHost: newJSONHost(r)})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if !s.drop {
+		s.lines <- line
+		return nil
+	}
+	select {
+	case s.lines <- line:
+	default:
+		s.dropped++
+	}
+	return nil
+}
+
+func (s *ndjsonSink) close(sum discovery.Summary) error {
+	close(s.lines)
+	s.done.Wait()
+	if s.dropped > 0 {
+		logWarn("ndjson.dropped", s.dropped)
+	}
+	line, err := json.Marshal(ndjsonSummary{
+		Type:          "summary",
+		SchemaVersion: resultsSchemaVersion,
+		jsonRun:       newJSONRun(sum, s.cfg, s.dryRun),
+		Dropped:       s.dropped,
+	})
+	if err != nil {
+		return err
+	}
+	if s.err == nil {
+		_, s.err = s.w.Write(append(line, '\n'))
+	}
+	if s.err != nil {
+		return fmt.Errorf("falha ao escrever o NDJSON na saída padrão: %w", s.err)
+	}
+	return nil
+}
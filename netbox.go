@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/netbox"
+)
+
+// Destinos do cadastro dos hosts identificados, em backends.
+const (
+	backendZabbix   = "zabbix"
+	backendNetBox   = "netbox"
+	backendLibreNMS = "librenms"
+)
+
+// Hosts aguardando a escrita no NetBox; com a fila cheia o host é descartado
+// (e contado), como nos hooks.
+const netboxQueue = 1000
+
+// NetBox configura o reflexo dos hosts descobertos no NetBox: o endereço IP
+// com dns_name igual ao sysName e, se o sysObjectID estiver em device_types,
+// um device stub.
+type NetBox struct {
+	URL         string            `json:"url,omitempty" yaml:"url" toml:"url"`
+	Token       string            `json:"token,omitempty" yaml:"token" toml:"token"`
+	Tag         string            `json:"tag" yaml:"tag" toml:"tag"`
+	Timeout     Duration          `json:"timeout" yaml:"timeout" toml:"timeout"`
+	Workers     int               `json:"workers" yaml:"workers" toml:"workers"`
+	DeviceTypes map[string]string `json:"device_types,omitempty" yaml:"device_types" toml:"device_types"` // sysObjectID -> slug do device type
+	DeviceSite  string            `json:"device_site,omitempty" yaml:"device_site" toml:"device_site"`
+	DeviceRole  string            `json:"device_role,omitempty" yaml:"device_role" toml:"device_role"`
+}
+
+func (n NetBox) validate(c Config) []error {
+	if !c.backend(backendNetBox) {
+		return nil
+	}
+	var errs []error
+	if n.URL == "" || n.Token == "" {
+		errs = append(errs, fmt.Errorf("netbox.url e netbox.token são obrigatórios com o backend netbox%s", c.origin("backends")))
+	}
+	if strings.TrimSpace(n.Tag) == "" {
+		errs = append(errs, fmt.Errorf("netbox.tag não pode ser vazio%s", c.origin("netbox.tag")))
+	}
+	if time.Duration(n.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("netbox.timeout deve ser positivo%s", c.origin("netbox.timeout")))
+	}
+	if n.Workers < 1 {
+		errs = append(errs, fmt.Errorf("netbox.workers deve ser no mínimo 1 (atual: %d)%s", n.Workers, c.origin("netbox.workers")))
+	}
+	if len(n.DeviceTypes) > 0 && (n.DeviceSite == "" || n.DeviceRole == "") {
+		errs = append(errs, fmt.Errorf("netbox.device_site e netbox.device_role são obrigatórios com netbox.device_types%s", c.origin("netbox.device_types")))
+	}
+	return errs
+}
+
+func (n NetBox) redacted() NetBox {
+	n.Token = maskSecret(n.Token)
+	return n
+}
+
+// Confere a lista de backends: pelo menos um, sem repetições ou nomes
+// desconhecidos.
+func (c Config) validateBackends() []error {
+	if len(c.Backends) == 0 {
+		return []error{fmt.Errorf("backends não pode ser vazio (use zabbix, librenms, icinga2 ou log, com ou sem netbox, webhook e consul)%s", c.origin("backends"))}
+	}
+	var errs []error
+	seen := map[string]bool{}
+	for _, b := range c.Backends {
+		switch {
+		case b != backendZabbix && b != backendNetBox && b != backendLibreNMS && b != backendIcinga2 && b != backendWebhook && b != backendConsul && b != backendLog:
+			errs = append(errs, fmt.Errorf("backend desconhecido: %q (use zabbix, librenms, icinga2, log, netbox, webhook ou consul)%s", b, c.origin("backends")))
+		case seen[b]:
+			errs = append(errs, fmt.Errorf("backend %s repetido%s", b, c.origin("backends")))
+		}
+		seen[b] = true
+	}
+	return errs
+}
+
+// Indica se o cadastro vai para o backend.
+func (c Config) backend(name string) bool {
+	for _, b := range c.Backends {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Contadores das escritas no NetBox de um run.
+type netboxStats struct {
+	created, updated, unchanged, conflicts, failed, devices, dropped int
+}
+
+// Escreve no NetBox os hosts identificados (SNMP ok), por netbox.workers
+// goroutines. Conflitos e falhas só geram log e contadores; não mudam o
+// resultado dos hosts nem o do cadastro no Zabbix.
+type netboxSink struct {
+	cfg    NetBox
+	client *netbox.Client
+
+	queue   chan discovery.HostResult
+	workers sync.WaitGroup
+	mu      sync.Mutex
+	stats   netboxStats
+}
+
+func newNetBoxSink(cfg NetBox) *netboxSink {
+	s := &netboxSink{
+		cfg:    cfg,
+		client: netbox.NewClient(cfg.URL, cfg.Token, cfg.Tag, time.Duration(cfg.Timeout)),
+		queue:  make(chan discovery.HostResult, netboxQueue),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			for r := range s.queue {
+				s.sync(r)
+			}
+		}()
+	}
+	return s
+}
+
+func (s *netboxSink) write(r discovery.HostResult) error {
+	if r.SNMPErr != nil || r.SNMP.SysName == "" {
+		return nil
+	}
+	select {
+	case s.queue <- r:
+	default:
+		s.mu.Lock()
+		s.stats.dropped++
+		first := s.stats.dropped == 1
+		s.mu.Unlock()
+		if first {
+			logWarn("netbox.queue_full", netboxQueue)
+		}
+	}
+	return nil
+}
+
+func (s *netboxSink) close(discovery.Summary) error {
+	close(s.queue)
+	s.workers.Wait()
+	st := s.stats
+	rootLog.Summaryf("summary.netbox", st.created, st.updated, st.unchanged, st.conflicts, st.failed, st.devices)
+	if st.dropped > 0 {
+		logWarn("netbox.dropped", st.dropped)
+	}
+	return nil
+}
+
+// Escreve o endereço do host e, se o modelo for conhecido, o device stub.
+func (s *netboxSink) sync(r discovery.HostResult) {
+	hl := rootLog.With("ip", r.IP, "range", r.Range).With("stage", backendNetBox)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.Timeout))
+	defer cancel()
+	action, id, err := s.client.UpsertIP(ctx, netbox.IPSpec{IP: r.IP, DNSName: r.SNMP.SysName, Description: r.SNMP.SysDescr})
+	s.mu.Lock()
+	switch action {
+	case netbox.Created:
+		s.stats.created++
+	case netbox.Updated:
+		s.stats.updated++
+	case netbox.Unchanged:
+		s.stats.unchanged++
+	case netbox.Conflict:
+		s.stats.conflicts++
+	default:
+		s.stats.failed++
+	}
+	s.mu.Unlock()
+	var conflict *netbox.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		hl.WithErr(err).Warnf("netbox.conflict", r.IP, conflict.Object)
+	case err != nil:
+		hl.WithErr(err).Errorf("netbox.ip_failed", r.IP, err)
+		return
+	default:
+		hl.Debugf("netbox.ip_synced", r.IP, action, id)
+	}
+
+	deviceType, ok := s.cfg.DeviceTypes[r.SNMP.SysObjectID]
+	if !ok {
+		return
+	}
+	action, id, err = s.client.EnsureDevice(ctx, netbox.DeviceSpec{
+		Name:        r.SNMP.SysName,
+		DeviceType:  deviceType,
+		Role:        s.cfg.DeviceRole,
+		Site:        s.cfg.DeviceSite,
+		Description: r.SNMP.SysDescr,
+	})
+	if err != nil {
+		hl.WithErr(err).Errorf("netbox.device_failed", r.SNMP.SysName, r.IP, err)
+		return
+	}
+	if action == netbox.Created {
+		s.mu.Lock()
+		s.stats.devices++
+		s.mu.Unlock()
+		hl.Infof("netbox.device_created", r.SNMP.SysName, deviceType, id)
+	}
+}
@@ -0,0 +1,265 @@
+// Package netbox implementa o cliente mínimo da API REST do NetBox usado para
+// refletir os hosts descobertos no IPAM (endereços IP) e no DCIM (devices).
+package netbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resultado de UpsertIP e EnsureDevice
+const (
+	Created   = "created"
+	Updated   = "updated"
+	Unchanged = "unchanged"
+	Existing  = "existing"
+	Conflict  = "conflict"
+	Failed    = "failed"
+)
+
+// Limite do campo description do NetBox.
+const maxDescription = 200
+
+// HTTPError é uma resposta de erro da API, com o início do corpo.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("API do NetBox respondeu HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("API do NetBox respondeu HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// ConflictError indica que o IP já pertence a outro objeto no NetBox; o
+// endereço não é alterado.
+type ConflictError struct {
+	IP     string
+	Object string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("IP %s já atribuído a %s no NetBox", e.IP, e.Object)
+}
+
+// Client é um cliente mínimo da API REST do NetBox. A tag aplicada aos
+// objetos é criada na primeira escrita, se ainda não existir.
+type Client struct {
+	url   string
+	token string
+	tag   string
+	http  *http.Client
+
+	mu       sync.Mutex
+	tagReady bool
+}
+
+// NewClient cria um cliente para a URL base do NetBox (sem o /api).
+func NewClient(baseURL, token, tag string, timeout time.Duration) *Client {
+	return &Client{url: strings.TrimRight(baseURL, "/"), token: token, tag: tag, http: &http.Client{Timeout: timeout}}
+}
+
+// Faz uma chamada à API; result pode ser nil.
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("resposta inválida da API do NetBox em %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// Referência a uma tag pelo slug, no formato aceito nas escritas.
+type tagRef struct {
+	Slug string `json:"slug"`
+}
+
+// Garante que a tag exista antes da primeira escrita.
+func (c *Client) ensureTag(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tagReady {
+		return nil
+	}
+	var found struct {
+		Count int `json:"count"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/extras/tags/?slug="+url.QueryEscape(c.tag), nil, &found); err != nil {
+		return fmt.Errorf("falha ao consultar a tag %s: %w", c.tag, err)
+	}
+	if found.Count == 0 {
+		tag := map[string]string{"name": c.tag, "slug": c.tag}
+		if err := c.do(ctx, http.MethodPost, "/api/extras/tags/", tag, nil); err != nil {
+			return fmt.Errorf("falha ao criar a tag %s: %w", c.tag, err)
+		}
+	}
+	c.tagReady = true
+	return nil
+}
+
+// IPSpec descreve o endereço IP de um host descoberto.
+type IPSpec struct {
+	IP          string
+	DNSName     string
+	Description string
+}
+
+type ipAddress struct {
+	ID                 int      `json:"id"`
+	Address            string   `json:"address"`
+	DNSName            string   `json:"dns_name"`
+	AssignedObjectType string   `json:"assigned_object_type"`
+	AssignedObjectID   *int     `json:"assigned_object_id"`
+	Tags               []tagRef `json:"tags"`
+}
+
+// UpsertIP cria o endereço (como /32 ou /128) com dns_name e a tag, ou
+// atualiza dns_name e a tag de um endereço existente. Um endereço atribuído
+// a uma interface, ou presente mais de uma vez (VRFs diferentes), retorna
+// Conflict com *ConflictError e não é alterado. Retorna a ação e o id.
+func (c *Client) UpsertIP(ctx context.Context, spec IPSpec) (string, int, error) {
+	if err := c.ensureTag(ctx); err != nil {
+		return Failed, 0, err
+	}
+	var found struct {
+		Results []ipAddress `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/ipam/ip-addresses/?address="+url.QueryEscape(spec.IP), nil, &found); err != nil {
+		return Failed, 0, err
+	}
+	switch len(found.Results) {
+	case 0:
+		prefix := "/32"
+		if strings.Contains(spec.IP, ":") {
+			prefix = "/128"
+		}
+		var created ipAddress
+		body := map[string]interface{}{
+			"address":     spec.IP + prefix,
+			"dns_name":    spec.DNSName,
+			"status":      "active",
+			"description": truncate(spec.Description),
+			"tags":        []tagRef{{Slug: c.tag}},
+		}
+		if err := c.do(ctx, http.MethodPost, "/api/ipam/ip-addresses/", body, &created); err != nil {
+			return Failed, 0, err
+		}
+		return Created, created.ID, nil
+	case 1:
+	default:
+		return Conflict, 0, &ConflictError{IP: spec.IP, Object: fmt.Sprintf("%d endereços (VRFs diferentes)", len(found.Results))}
+	}
+	ip := found.Results[0]
+	if ip.AssignedObjectID != nil {
+		return Conflict, ip.ID, &ConflictError{IP: spec.IP, Object: fmt.Sprintf("%s %d", ip.AssignedObjectType, *ip.AssignedObjectID)}
+	}
+	tagged := false
+	for _, t := range ip.Tags {
+		tagged = tagged || t.Slug == c.tag
+	}
+	if tagged && ip.DNSName == spec.DNSName {
+		return Unchanged, ip.ID, nil
+	}
+	tags := ip.Tags
+	if !tagged {
+		tags = append(tags, tagRef{Slug: c.tag})
+	}
+	body := map[string]interface{}{"dns_name": spec.DNSName, "tags": tags}
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/ipam/ip-addresses/%d/", ip.ID), body, nil); err != nil {
+		return Failed, ip.ID, err
+	}
+	return Updated, ip.ID, nil
+}
+
+// DeviceSpec descreve o device stub de um host cujo sysObjectID corresponde a
+// um device type conhecido. DeviceType, Role e Site são slugs.
+type DeviceSpec struct {
+	Name        string
+	DeviceType  string
+	Role        string
+	Site        string
+	Description string
+}
+
+// EnsureDevice cria o device com a tag se ainda não houver um com o mesmo
+// nome, retornando Existing com o id do atual caso contrário. Os campos de
+// um device existente não são alterados. Requer NetBox 3.6 ou mais novo
+// (campo role).
+func (c *Client) EnsureDevice(ctx context.Context, spec DeviceSpec) (string, int, error) {
+	if err := c.ensureTag(ctx); err != nil {
+		return Failed, 0, err
+	}
+	var found struct {
+		Results []struct {
+			ID int `json:"id"`
+		} `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/dcim/devices/?name="+url.QueryEscape(spec.Name), nil, &found); err != nil {
+		return Failed, 0, err
+	}
+	if len(found.Results) > 0 {
+		return Existing, found.Results[0].ID, nil
+	}
+	var created struct {
+		ID int `json:"id"`
+	}
+	body := map[string]interface{}{
+		"name":        spec.Name,
+		"device_type": map[string]string{"slug": spec.DeviceType},
+		"role":        map[string]string{"slug": spec.Role},
+		"site":        map[string]string{"slug": spec.Site},
+		"status":      "active",
+		"description": truncate(spec.Description),
+		"tags":        []tagRef{{Slug: c.tag}},
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/dcim/devices/", body, &created); err != nil {
+		return Failed, 0, err
+	}
+	return Created, created.ID, nil
+}
+
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= maxDescription {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxDescription], "")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/i18n"
+	"discoveryhosts/zabbix"
+)
+
+// Formatos do corpo da notificação
+const (
+	notifyFormatJSON  = "json"
+	notifyFormatSlack = "slack"
+)
+
+// Tentativas de entrega da notificação e espera entre elas
+const (
+	notifyAttempts = 3
+	notifyBackoff  = 2 * time.Second
+)
+
+// Notifications configura o webhook chamado ao fim de cada run.
+type Notifications struct {
+	WebhookURL          string   `json:"webhook_url,omitempty" yaml:"webhook_url" toml:"webhook_url"`
+	Format              string   `json:"format" yaml:"format" toml:"format"`
+	MaxHosts            int      `json:"max_hosts" yaml:"max_hosts" toml:"max_hosts"`
+	NotifyOnlyOnChanges bool     `json:"notify_only_on_changes,omitempty" yaml:"notify_only_on_changes" toml:"notify_only_on_changes"`
+	Timeout             Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+func (n Notifications) validate(c Config) []error {
+	var errs []error
+	if n.WebhookURL != "" && !isConfigURL(n.WebhookURL) {
+		errs = append(errs, fmt.Errorf("notifications.webhook_url deve ser uma URL http(s)://%s", c.origin("notifications.webhook_url")))
+	}
+	if n.Format != notifyFormatJSON && n.Format != notifyFormatSlack {
+		errs = append(errs, fmt.Errorf("notifications.format inválido: %q (use json ou slack)%s", n.Format, c.origin("notifications.format")))
+	}
+	if n.MaxHosts < 0 {
+		errs = append(errs, fmt.Errorf("notifications.max_hosts não pode ser negativo (atual: %d)%s", n.MaxHosts, c.origin("notifications.max_hosts")))
+	}
+	if time.Duration(n.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("notifications.timeout deve ser positivo%s", c.origin("notifications.timeout")))
+	}
+	return errs
+}
+
+// Host criado no run, listado na notificação.
+type createdHost struct {
+	Name   string `json:"name"`
+	IP     string `json:"ip"`
+	HostID string `json:"hostid"`
+}
+
+// Envia a notificação ao fim do run. Coleta os hosts criados como um
+// resultSink; falhas de entrega só geram log.
+type notifier struct {
+	cfg     Notifications
+	created []createdHost
+}
+
+func newNotifier(cfg Notifications) *notifier {
+	return &notifier{cfg: cfg}
+}
+
+func (n *notifier) write(r discovery.HostResult) error {
+	if r.ZabbixAction == zabbix.Created && len(n.created) < n.cfg.MaxHosts {
+		n.created = append(n.created, createdHost{Name: r.Name(), IP: r.IP, HostID: r.HostID})
+	}
+	return nil
+}
+
+func (n *notifier) close(s discovery.Summary) error {
+	if n.cfg.NotifyOnlyOnChanges && s.HostsCreated == 0 {
+		logInfo("notify.skipped")
+		return nil
+	}
+	body, err := n.payload(s)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: time.Duration(n.cfg.Timeout)}
+	for attempt := 1; ; attempt++ {
+		err = postWebhook(client, n.cfg.WebhookURL, body)
+		if err == nil {
+			logInfo("notify.sent")
+			return nil
+		}
+		if attempt == notifyAttempts {
+			break
+		}
+		logWarn("notify.retry", attempt, notifyAttempts, err)
+		time.Sleep(notifyBackoff * time.Duration(attempt))
+	}
+	logError("notify.failed", notifyAttempts, err)
+	return nil
+}
+
+func postWebhook(client *http.Client, webhookURL string, body []byte) error {
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// A URL do webhook costuma conter o token; fica fora da mensagem
+		if uerr, ok := err.(*url.Error); ok {
+			return fmt.Errorf("%s webhook: %w", uerr.Op, uerr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook respondeu HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Corpo da notificação no formato configurado.
+func (n *notifier) payload(s discovery.Summary) ([]byte, error) {
+	omitted := s.HostsCreated - len(n.created)
+	if n.cfg.Format == notifyFormatSlack {
+		var b strings.Builder
+		b.WriteString(i18n.T("notify.slack_title", s.RunID, s.Elapsed().Round(time.Second)) + "\n")
+		b.WriteString(i18n.T("notify.slack_totals", s.TargetsExpanded, s.Alive, s.SNMPOK) + "\n")
+		b.WriteString(i18n.T("summary.zabbix", s.HostsCreated, s.HostsExisting, s.ZabbixErrors))
+		for _, h := range n.created {
+			fmt.Fprintf(&b, "\n• %s (%s)", h.Name, h.IP)
+		}
+		if omitted > 0 {
+			b.WriteString("\n" + i18n.T("notify.slack_omitted", omitted))
+		}
+		return json.Marshal(map[string]string{"text": b.String()})
+	}
+	return json.Marshal(struct {
+		Event        string        `json:"event"`
+		RunID        string        `json:"run_id"`
+		Start        time.Time     `json:"start"`
+		End          time.Time     `json:"end"`
+		Totals       jsonTotals    `json:"totals"`
+		CreatedHosts []createdHost `json:"created_hosts"`
+		Omitted      int           `json:"created_hosts_omitted"`
+	}{
+		Event:        "discovery_finished",
+		RunID:        s.RunID,
+		Start:        s.Start,
+		End:          s.End,
+		Totals:       newJSONTotals(s),
+		CreatedHosts: append([]createdHost{}, n.created...),
+		Omitted:      omitted,
+	})
+}
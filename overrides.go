@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Aplica overrides no formato chave=valor (flag --set) sobre a configuração.
+// As chaves são os nomes JSON dos campos, com "." para subcampos; o valor é
+// interpretado como JSON e, se não for JSON válido, como string. Listas são
+// sempre substituídas por inteiro.
+func applyOverrides(cfg *Config, overrides []string) error {
+	for _, o := range overrides {
+		key, value, ok := strings.Cut(o, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("--set %q: use o formato chave=valor", o)
+		}
+		field, err := lookupField(reflect.ValueOf(cfg).Elem(), key)
+		if err != nil {
+			return fmt.Errorf("--set %s: %w", key, err)
+		}
+		if err := coerceInto(field, value); err != nil {
+			if secretKeys[key] {
+				// A mensagem de coerceInto repete o valor
+				return fmt.Errorf("--set %s: valor inválido para o tipo %s", key, describeType(field.Type()))
+			}
+			return fmt.Errorf("--set %s: %w", key, err)
+		}
+		cfg.sources[key] = "--set"
+		if field.Kind() == reflect.Slice {
+			for i := 0; i < field.Len(); i++ {
+				cfg.sources[fmt.Sprintf("%s[%d]", key, i)] = "--set"
+			}
+		}
+	}
+	return nil
+}
+
+// Encontra o campo correspondente a uma chave como "ping_timeout" ou
+// "secao.campo".
+func lookupField(v reflect.Value, key string) (reflect.Value, error) {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("%s não é uma seção", strings.Join(parts[:i], "."))
+		}
+		fields := map[string]reflect.Type{}
+		found := -1
+		for j := 0; j < v.NumField(); j++ {
+			f := v.Type().Field(j)
+			name := fieldKey(f)
+			if !f.IsExported() || name == "" {
+				continue
+			}
+			fields[name] = f.Type
+			if name == part {
+				found = j
+			}
+		}
+		if found < 0 {
+			if s := closestKey(part, fields); s != "" {
+				return reflect.Value{}, fmt.Errorf("chave desconhecida (você quis dizer %q?)", s)
+			}
+			return reflect.Value{}, fmt.Errorf("chave desconhecida")
+		}
+		v = v.Field(found)
+	}
+	return v, nil
+}
+
+// Converte o texto para o tipo do campo: primeiro como JSON, depois como
+// string JSON (para durações e textos sem aspas) e, em listas de strings,
+// como valores separados por vírgula.
+func coerceInto(field reflect.Value, value string) error {
+	target := reflect.New(field.Type())
+	err := json.Unmarshal([]byte(value), target.Interface())
+	if err != nil {
+		quoted, _ := json.Marshal(value)
+		err = json.Unmarshal(quoted, target.Interface())
+	}
+	if err != nil && field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		target.Elem().Set(reflect.ValueOf(items).Convert(field.Type()))
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("valor %q inválido para o tipo %s", value, describeType(field.Type()))
+	}
+	field.Set(target.Elem())
+	return nil
+}
+
+func describeType(t reflect.Type) string {
+	switch {
+	case t == reflect.TypeOf(Duration(0)):
+		return "duração (ex.: 500ms, 2s)"
+	case t.Kind() == reflect.Slice:
+		return "lista (ex.: [\"a\",\"b\"] ou a,b)"
+	case t.Kind() == reflect.Int:
+		return "inteiro"
+	case t.Kind() == reflect.Bool:
+		return "booleano"
+	default:
+		return t.Kind().String()
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Quem além do dono pode ler um arquivo com credenciais. É a única política
+// de permissões: o secrets_file recusa worldReadable e checkFilePermissions
+// avisa (ou, com strict_permissions, recusa) de qualquer uma além de
+// ownerOnly.
+type exposure int
+
+const (
+	ownerOnly exposure = iota
+	groupReadable
+	worldReadable
+)
+
+// Avisa dos arquivos com credenciais (os da configuração e o secrets_file)
+// que o grupo ou outros usuários podem ler; com strict (strict_permissions),
+// recusa carregá-los. As URLs da configuração remota ficam de fora.
+func checkFilePermissions(paths []string, strict bool) error {
+	var errs []error
+	for _, path := range paths {
+		if isConfigURL(path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if fileExposure(info) == ownerOnly {
+			continue
+		}
+		mode := info.Mode().Perm()
+		if strict {
+			errs = append(errs, fmt.Errorf("%s tem permissão %04o e pode ser lido pelo grupo ou por outros usuários (strict_permissions); use chmod 600", path, mode))
+			continue
+		}
+		logWarn("config.insecure_permissions", path, mode)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package main
+
+import "os"
+
+// Sem os modos POSIX não há o que verificar; o acesso fica com as ACLs.
+func fileExposure(info os.FileInfo) exposure {
+	return ownerOnly
+}
@@ -0,0 +1,17 @@
+//go:build !windows && !plan9
+
+package main
+
+import "os"
+
+// Quem além do dono pode ler o arquivo, pelos bits de leitura do modo.
+func fileExposure(info os.FileInfo) exposure {
+	mode := info.Mode().Perm()
+	switch {
+	case mode&0o004 != 0:
+		return worldReadable
+	case mode&0o040 != 0:
+		return groupReadable
+	}
+	return ownerOnly
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"discoveryhosts/phpipam"
+)
+
+// Fontes de ranges aceitas em range_sources, somadas aos ranges estáticos.
+const rangeSourcePHPIPAM = "phpipam"
+
+// App ids aceitos pelo phpIPAM.
+var phpipamAppID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// PHPIPAM configura a leitura dos ranges do phpIPAM (range_sources:
+// ["phpipam"]): as subnets IPv4 das seções escolhidas viram ranges CIDR,
+// somados aos de ranges. As subnets que contêm outras selecionadas ficam de
+// fora, para que cada IP seja varrido uma vez só.
+type PHPIPAM struct {
+	URL   string `json:"url,omitempty" yaml:"url" toml:"url"`          // URL base do phpIPAM, sem o /api
+	AppID string `json:"app_id,omitempty" yaml:"app_id" toml:"app_id"` // app id de Administration > API
+	// Login da API; o token da sessão é renovado quando expira
+	Username string `json:"username,omitempty" yaml:"username" toml:"username"`
+	Password string `json:"password,omitempty" yaml:"password" toml:"password"`
+	// App code de um app com segurança "SSL with App code token", no lugar
+	// do login
+	Token string `json:"token,omitempty" yaml:"token" toml:"token"`
+	// Seções (nome ou id) de onde vêm as subnets; vazio para todas
+	Sections []string `json:"sections,omitempty" yaml:"sections" toml:"sections"`
+	// Só as subnets com um destes valores (separados por vírgula) no campo
+	// personalizado tag_field; vazio para todas
+	Tags     []string `json:"tags,omitempty" yaml:"tags" toml:"tags"`
+	TagField string   `json:"tag_field" yaml:"tag_field" toml:"tag_field"`
+	// Tira do scan os endereços com a tag Reserved no phpIPAM
+	ExcludeReserved bool     `json:"exclude_reserved,omitempty" yaml:"exclude_reserved" toml:"exclude_reserved"`
+	PageSize        int      `json:"page_size" yaml:"page_size" toml:"page_size"`
+	Timeout         Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+func (p PHPIPAM) validate(c Config) []error {
+	if !c.rangeSource(rangeSourcePHPIPAM) {
+		return nil
+	}
+	var errs []error
+	if !isConfigURL(p.URL) {
+		errs = append(errs, fmt.Errorf("phpipam.url é obrigatório com range_sources phpipam e deve ser uma URL http(s)://%s", c.origin("phpipam.url")))
+	}
+	if !phpipamAppID.MatchString(p.AppID) {
+		errs = append(errs, fmt.Errorf("phpipam.app_id é obrigatório, com letras, dígitos, '_' ou '-' (atual: %q)%s", p.AppID, c.origin("phpipam.app_id")))
+	}
+	switch {
+	case p.Token != "" && (p.Username != "" || p.Password != ""):
+		errs = append(errs, fmt.Errorf("use phpipam.token ou phpipam.username e phpipam.password, não os dois%s", c.origin("phpipam.token")))
+	case p.Token == "" && (p.Username == "" || p.Password == ""):
+		errs = append(errs, fmt.Errorf("phpipam.username e phpipam.password (ou phpipam.token) são obrigatórios%s", c.origin("phpipam")))
+	}
+	for i, s := range p.Sections {
+		if strings.TrimSpace(s) == "" {
+			errs = append(errs, fmt.Errorf("phpipam.sections[%d] não pode ser vazio%s", i, c.origin("phpipam.sections")))
+		}
+	}
+	if len(p.Tags) > 0 && !strings.HasPrefix(p.TagField, "custom_") {
+		errs = append(errs, fmt.Errorf("phpipam.tag_field deve ser um campo personalizado (custom_...) (atual: %q)%s", p.TagField, c.origin("phpipam.tag_field")))
+	}
+	if p.PageSize < 1 {
+		errs = append(errs, fmt.Errorf("phpipam.page_size deve ser no mínimo 1 (atual: %d)%s", p.PageSize, c.origin("phpipam.page_size")))
+	}
+	if time.Duration(p.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("phpipam.timeout deve ser positivo%s", c.origin("phpipam.timeout")))
+	}
+	return errs
+}
+
+func (p PHPIPAM) redacted() PHPIPAM {
+	p.Password = maskSecret(p.Password)
+	p.Token = maskSecret(p.Token)
+	return p
+}
+
+func (c Config) validateRangeSources() []error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, s := range c.RangeSources {
+		switch {
+		case s != rangeSourcePHPIPAM:
+			errs = append(errs, fmt.Errorf("fonte de ranges desconhecida: %q (use phpipam)%s", s, c.origin("range_sources")))
+		case seen[s]:
+			errs = append(errs, fmt.Errorf("fonte de ranges %s repetida%s", s, c.origin("range_sources")))
+		}
+		seen[s] = true
+	}
+	return errs
+}
+
+// Indica se os ranges também vêm da fonte.
+func (c Config) rangeSource(name string) bool {
+	for _, s := range c.RangeSources {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Subnet do phpIPAM que virou um range do run.
+type ipamRange struct {
+	Range       string `json:"range"`
+	Section     string `json:"section"`
+	Description string `json:"description,omitempty"`
+	Static      bool   `json:"static,omitempty"` // já estava em ranges
+	Reserved    int    `json:"reserved,omitempty"`
+}
+
+// Une os ranges estáticos aos do phpIPAM, na ordem das seções e das subnets;
+// uma subnet que já está em ranges não é repetida. Com exclude_reserved, os
+// endereços reservados vão para o Exclude do run.
+func (c Config) withRangeSources(ctx context.Context) (Config, []ipamRange, error) {
+	if !c.rangeSource(rangeSourcePHPIPAM) {
+		return c, nil, nil
+	}
+	p := c.PHPIPAM
+	client := phpipam.NewClient(p.URL, p.AppID, p.PageSize, time.Duration(p.Timeout))
+	if p.Token != "" {
+		client.AppToken(p.Token)
+	} else {
+		client.Login(p.Username, p.Password)
+	}
+	defer client.Logout(context.Background())
+
+	sections, err := client.Sections(ctx)
+	if err != nil {
+		return c, nil, err
+	}
+	selected, err := p.selectSections(sections)
+	if err != nil {
+		return c, nil, err
+	}
+	var subnets []phpipam.Subnet
+	sectionName := map[string]string{}
+	for _, s := range selected {
+		sectionName[string(s.ID)] = s.Name
+		found, err := client.Subnets(ctx, string(s.ID))
+		if err != nil {
+			return c, nil, fmt.Errorf("subnets da seção %s: %w", s.Name, err)
+		}
+		for _, sn := range found {
+			if p.wanted(sn) {
+				subnets = append(subnets, sn)
+			}
+		}
+	}
+	subnets = leafSubnets(subnets)
+
+	reservedTag := ""
+	if p.ExcludeReserved && len(subnets) > 0 {
+		tags, err := client.Tags(ctx)
+		if err != nil {
+			return c, nil, fmt.Errorf("tags de endereço: %w", err)
+		}
+		for _, t := range tags {
+			if strings.EqualFold(t.Type, "Reserved") {
+				reservedTag = string(t.ID)
+			}
+		}
+		if reservedTag == "" {
+			return c, nil, fmt.Errorf("tag de endereço Reserved não encontrada no phpIPAM")
+		}
+	}
+
+	static := map[string]bool{}
+	for _, r := range c.Ranges {
+		static[strings.TrimSpace(r)] = true
+	}
+	ranges := append([]string{}, c.Ranges...)
+	exclude := map[string]bool{}
+	var found []ipamRange
+	for _, sn := range subnets {
+		ir := ipamRange{Range: sn.CIDR(), Section: sectionName[sn.SectionID], Description: sn.Description, Static: static[sn.CIDR()]}
+		if reservedTag != "" {
+			addresses, err := client.Addresses(ctx, sn.ID)
+			if err != nil {
+				return c, nil, fmt.Errorf("endereços da subnet %s: %w", sn.CIDR(), err)
+			}
+			for _, a := range addresses {
+				if string(a.Tag) == reservedTag && !exclude[a.IP] {
+					exclude[a.IP] = true
+					ir.Reserved++
+				}
+			}
+		}
+		if !ir.Static {
+			ranges = append(ranges, ir.Range)
+			static[ir.Range] = true
+		}
+		found = append(found, ir)
+	}
+	c.Ranges = ranges
+	if len(exclude) > 0 {
+		c.excluded = exclude
+	}
+	return c, found, nil
+}
+
+// Seções configuradas, pelo nome ou id, na ordem de phpipam.sections; todas
+// sem nenhuma configurada.
+func (p PHPIPAM) selectSections(all []phpipam.Section) ([]phpipam.Section, error) {
+	if len(p.Sections) == 0 {
+		return all, nil
+	}
+	var selected []phpipam.Section
+	for _, want := range p.Sections {
+		want = strings.TrimSpace(want)
+		match := false
+		for _, s := range all {
+			if s.Name == want || string(s.ID) == want {
+				selected = append(selected, s)
+				match = true
+				break
+			}
+		}
+		if !match {
+			return nil, fmt.Errorf("seção %q não encontrada no phpIPAM", want)
+		}
+	}
+	return selected, nil
+}
+
+// Indica se a subnet entra no scan: IPv4, não é pasta e, com phpipam.tags,
+// tem uma das tags.
+func (p PHPIPAM) wanted(sn phpipam.Subnet) bool {
+	if sn.Folder {
+		return false
+	}
+	if ip := net.ParseIP(sn.Subnet); ip == nil || ip.To4() == nil {
+		return false
+	}
+	if _, _, err := net.ParseCIDR(sn.CIDR()); err != nil {
+		return false
+	}
+	if len(p.Tags) == 0 {
+		return true
+	}
+	for _, v := range strings.Split(sn.Custom[p.TagField], ",") {
+		for _, t := range p.Tags {
+			if strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(t)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Tira as subnets que contêm outras da lista (pelo masterSubnetId), mantendo
+// a ordem.
+func leafSubnets(subnets []phpipam.Subnet) []phpipam.Subnet {
+	parents := map[string]bool{}
+	for _, sn := range subnets {
+		parents[sn.MasterID] = true
+	}
+	var leaves []phpipam.Subnet
+	for _, sn := range subnets {
+		if !parents[sn.ID] {
+			leaves = append(leaves, sn)
+		}
+	}
+	return leaves
+}
+
+// Ranges do run a partir de range_sources. Se a fonte falhar, o run segue só
+// com os ranges estáticos, com um aviso; sem nenhum, é um erro.
+func (c Config) resolveRanges(ctx context.Context) (Config, error) {
+	if len(c.RangeSources) == 0 {
+		return c, nil
+	}
+	resolved, found, err := c.withRangeSources(ctx)
+	if err != nil {
+		if len(c.Ranges) == 0 {
+			return c, fmt.Errorf("ranges do phpIPAM indisponíveis: %w", err)
+		}
+		logWarn("phpipam.failed", c.PHPIPAM.URL, err, len(c.Ranges))
+		return c, nil
+	}
+	added, reserved := 0, 0
+	var sections []string
+	seen := map[string]bool{}
+	for _, r := range found {
+		if !r.Static {
+			added++
+		}
+		reserved += r.Reserved
+		if !seen[r.Section] {
+			seen[r.Section] = true
+			sections = append(sections, r.Section)
+		}
+	}
+	sort.Strings(sections)
+	logInfo("phpipam.ranges", added, strings.Join(sections, ", "), reserved)
+	return resolved, nil
+}
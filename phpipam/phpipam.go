@@ -0,0 +1,385 @@
+// Package phpipam implementa o cliente mínimo da API do phpIPAM usado para
+// ler as seções, as subnets e os endereços de onde saem os ranges do scan.
+package phpipam
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Antecedência com que um token de sessão é renovado antes de expirar.
+const refreshMargin = 30 * time.Second
+
+// HTTPError é uma resposta de erro da API, com a mensagem do phpIPAM (ou o
+// início do corpo, se não for JSON).
+type HTTPError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API do phpIPAM respondeu HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("API do phpIPAM respondeu HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Client é um cliente mínimo da API do phpIPAM. Com usuário e senha, o token
+// de sessão é obtido no primeiro pedido e renovado quando expira ou é
+// recusado; com o token de aplicação (segurança "SSL with App code token")
+// não há login.
+type Client struct {
+	url      string // até o app id: https://ipam.example/api/discovery
+	username string
+	password string
+	appToken string
+	pageSize int
+	http     *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time // zero: sem validade informada
+}
+
+// NewClient cria um cliente para a URL base do phpIPAM (sem o /api) e o app
+// id configurado em Administration > API. pageSize é o número de itens
+// pedidos por página nas listagens.
+func NewClient(baseURL, appID string, pageSize int, timeout time.Duration) *Client {
+	return &Client{
+		url:      strings.TrimRight(baseURL, "/") + "/api/" + url.PathEscape(appID),
+		pageSize: pageSize,
+		http:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Login define o usuário e a senha da sessão.
+func (c *Client) Login(username, password string) {
+	c.username, c.password = username, password
+}
+
+// AppToken define o token de aplicação, usado no lugar do login.
+func (c *Client) AppToken(token string) {
+	c.appToken = token
+}
+
+// Envelope de todas as respostas da API.
+type apiResponse struct {
+	Code    int             `json:"code"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Texto que o phpIPAM devolve ora como string, ora como número (ou null),
+// conforme a versão e o banco.
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = ""
+		return nil
+	}
+	var v string
+	if err := json.Unmarshal(data, &v); err == nil {
+		*s = flexString(v)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*s = flexString(n.String())
+	return nil
+}
+
+// Faz a chamada ao caminho (relativo ao app id) e decodifica o data da
+// resposta em result, que pode ser nil.
+func (c *Client) request(ctx context.Context, method, path, token string, basicAuth bool, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	if basicAuth {
+		req.SetBasicAuth(c.username, c.password)
+	} else {
+		req.Header.Set("token", token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var ar apiResponse
+	jsonErr := json.Unmarshal(data, &ar)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || (jsonErr == nil && !ar.Success) {
+		msg := ar.Message
+		if jsonErr != nil {
+			msg = strings.TrimSpace(string(data[:min(len(data), 512)]))
+		}
+		code := resp.StatusCode
+		if code >= 200 && code <= 299 && ar.Code != 0 {
+			code = ar.Code
+		}
+		return &HTTPError{StatusCode: code, Message: msg}
+	}
+	if jsonErr != nil {
+		return fmt.Errorf("resposta inválida da API do phpIPAM em %s %s: %w", method, path, jsonErr)
+	}
+	if result == nil || len(ar.Data) == 0 || string(ar.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(ar.Data, result); err != nil {
+		return fmt.Errorf("resposta inválida da API do phpIPAM em %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// Token da sessão, com login se ainda não houver um ou se estiver para
+// expirar.
+func (c *Client) sessionToken(ctx context.Context, renew bool) (string, error) {
+	if c.appToken != "" {
+		return c.appToken, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !renew && c.token != "" && (c.expires.IsZero() || time.Until(c.expires) > refreshMargin) {
+		return c.token, nil
+	}
+	var session struct {
+		Token   string     `json:"token"`
+		Expires flexString `json:"expires"`
+	}
+	if err := c.request(ctx, http.MethodPost, "/user/", "", true, &session); err != nil {
+		return "", fmt.Errorf("login no phpIPAM: %w", err)
+	}
+	if session.Token == "" {
+		return "", fmt.Errorf("login no phpIPAM: resposta sem token")
+	}
+	c.token = session.Token
+	// "2026-10-14 17:04:05", no fuso do servidor; sem fuso conhecido, conta
+	// como horário local
+	c.expires, _ = time.ParseInLocation("2006-01-02 15:04:05", string(session.Expires), time.Local)
+	return c.token, nil
+}
+
+// Chamada autenticada. Um token recusado (expirado antes do previsto ou
+// revogado) leva a um novo login e uma nova tentativa.
+func (c *Client) do(ctx context.Context, path string, result interface{}) error {
+	token, err := c.sessionToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = c.request(ctx, http.MethodGet, path, token, false, result)
+	var he *HTTPError
+	if c.appToken == "" && errors.As(err, &he) && (he.StatusCode == http.StatusUnauthorized || he.StatusCode == http.StatusForbidden) {
+		if token, err = c.sessionToken(ctx, true); err != nil {
+			return err
+		}
+		err = c.request(ctx, http.MethodGet, path, token, false, result)
+	}
+	return err
+}
+
+// Listagem completa de um caminho, página a página. Servidores que ignoram os
+// parâmetros de paginação devolvem tudo de uma vez: a leitura termina na
+// primeira página incompleta ou que não traga nenhum item novo. Um 404 ("No
+// subnets found") é uma lista vazia. Os itens, identificados pelo id, são
+// decodificados por decode.
+func (c *Client) list(ctx context.Context, path string, decode func(json.RawMessage) error) error {
+	seen := map[string]bool{}
+	for offset := 0; ; offset += c.pageSize {
+		var page []json.RawMessage
+		err := c.do(ctx, path+"?limit="+strconv.Itoa(c.pageSize)+"&offset="+strconv.Itoa(offset), &page)
+		var he *HTTPError
+		if errors.As(err, &he) && he.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		added := 0
+		for _, item := range page {
+			var key struct {
+				ID flexString `json:"id"`
+			}
+			if err := json.Unmarshal(item, &key); err != nil {
+				return fmt.Errorf("resposta inválida da API do phpIPAM em %s: %w", path, err)
+			}
+			if seen[string(key.ID)] {
+				continue
+			}
+			seen[string(key.ID)] = true
+			if err := decode(item); err != nil {
+				return fmt.Errorf("resposta inválida da API do phpIPAM em %s: %w", path, err)
+			}
+			added++
+		}
+		if added == 0 || len(page) < c.pageSize {
+			return nil
+		}
+	}
+}
+
+// Section é uma seção do phpIPAM.
+type Section struct {
+	ID   flexString `json:"id"`
+	Name string     `json:"name"`
+}
+
+// Sections lista as seções.
+func (c *Client) Sections(ctx context.Context) ([]Section, error) {
+	var sections []Section
+	err := c.list(ctx, "/sections/", func(item json.RawMessage) error {
+		var s Section
+		err := json.Unmarshal(item, &s)
+		sections = append(sections, s)
+		return err
+	})
+	return sections, err
+}
+
+// Subnet é uma subnet (ou pasta) de uma seção. Custom tem os campos
+// personalizados, pelo nome (custom_...).
+type Subnet struct {
+	ID          string
+	Subnet      string // endereço da rede
+	Mask        string
+	Description string
+	SectionID   string
+	MasterID    string // subnet que contém esta; "0" na raiz
+	Folder      bool
+	Custom      map[string]string
+}
+
+// CIDR da subnet, como em 10.0.0.0/24.
+func (s Subnet) CIDR() string {
+	return s.Subnet + "/" + s.Mask
+}
+
+func (s *Subnet) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ID          flexString `json:"id"`
+		Subnet      flexString `json:"subnet"`
+		Mask        flexString `json:"mask"`
+		Description flexString `json:"description"`
+		SectionID   flexString `json:"sectionId"`
+		MasterID    flexString `json:"masterSubnetId"`
+		IsFolder    flexString `json:"isFolder"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*s = Subnet{
+		ID:          string(raw.ID),
+		Subnet:      string(raw.Subnet),
+		Mask:        string(raw.Mask),
+		Description: string(raw.Description),
+		SectionID:   string(raw.SectionID),
+		MasterID:    string(raw.MasterID),
+		Folder:      raw.IsFolder == "1",
+	}
+	for name, v := range fields {
+		if !strings.HasPrefix(name, "custom_") {
+			continue
+		}
+		var value flexString
+		if json.Unmarshal(v, &value) == nil {
+			if s.Custom == nil {
+				s.Custom = map[string]string{}
+			}
+			s.Custom[name] = string(value)
+		}
+	}
+	return nil
+}
+
+// Subnets lista as subnets da seção, incluindo as pastas.
+func (c *Client) Subnets(ctx context.Context, sectionID string) ([]Subnet, error) {
+	var subnets []Subnet
+	err := c.list(ctx, "/sections/"+url.PathEscape(sectionID)+"/subnets/", func(item json.RawMessage) error {
+		var s Subnet
+		err := json.Unmarshal(item, &s)
+		subnets = append(subnets, s)
+		return err
+	})
+	return subnets, err
+}
+
+// Address é um endereço cadastrado numa subnet, com o id da sua tag (Used,
+// Reserved...).
+type Address struct {
+	ID  flexString `json:"id"`
+	IP  string     `json:"ip"`
+	Tag flexString `json:"tag"`
+}
+
+// Addresses lista os endereços cadastrados na subnet.
+func (c *Client) Addresses(ctx context.Context, subnetID string) ([]Address, error) {
+	var addresses []Address
+	err := c.list(ctx, "/subnets/"+url.PathEscape(subnetID)+"/addresses/", func(item json.RawMessage) error {
+		var a Address
+		err := json.Unmarshal(item, &a)
+		addresses = append(addresses, a)
+		return err
+	})
+	return addresses, err
+}
+
+// Tag é uma das tags de endereço (Offline, Used, Reserved, DHCP e as
+// criadas pelo administrador).
+type Tag struct {
+	ID   flexString `json:"id"`
+	Type string     `json:"type"`
+}
+
+// Tags lista as tags de endereço.
+func (c *Client) Tags(ctx context.Context) ([]Tag, error) {
+	var tags []Tag
+	err := c.list(ctx, "/addresses/tags/", func(item json.RawMessage) error {
+		var t Tag
+		err := json.Unmarshal(item, &t)
+		tags = append(tags, t)
+		return err
+	})
+	return tags, err
+}
+
+// Logout encerra a sessão, se houver uma; erros são ignorados, pois o token
+// expira de qualquer forma.
+func (c *Client) Logout(ctx context.Context) {
+	c.mu.Lock()
+	token := c.token
+	c.token = ""
+	c.mu.Unlock()
+	if token == "" {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url+"/user/", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("token", token)
+	if resp, err := c.http.Do(req); err == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
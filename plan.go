@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"discoveryhosts/iprange"
+)
+
+// Resultado do subcomando plan, também emitido como JSON com -output json.
+type planReport struct {
+	Config       string      `json:"config"`
+	Ranges       []planRange `json:"ranges"`
+	TotalTargets int         `json:"total_targets"`
+}
+
+type planRange struct {
+	Range    string   `json:"range"`
+	Targets  int      `json:"targets"`
+	Excluded int      `json:"excluded,omitempty"` // reservados no phpIPAM, fora do scan
+	Agent    string   `json:"agent,omitempty"`    // agente que faz o ping e o SNMP do range
+	Backends []string `json:"backends"`           // onde os hosts do range são cadastrados
+	IPs      []string `json:"ips,omitempty"`      // com -targets
+}
+
+// Backends de cadastro dos hosts do range, com o zabbix trocado pelos
+// servidores de zabbix_targets, como no run.
+func (c Config) planBackends(rng string) []string {
+	if names, ok := c.rangeBackends()[rng]; ok {
+		return names
+	}
+	backends := []string{}
+	for _, name := range c.registrationNames() {
+		if name != backendZabbix || len(c.ZabbixTargets) == 0 {
+			backends = append(backends, name)
+			continue
+		}
+		for _, t := range c.ZabbixTargets {
+			backends = append(backends, strings.TrimSpace(t.Name))
+		}
+	}
+	return backends
+}
+
+// Subcomando plan: expande os ranges da configuração (com os do phpIPAM) e
+// mostra, sem enviar nenhum pacote, quantos alvos cada um tem, quem faz o scan
+// e para quais backends os hosts vão. Retorna o código de saída (0 ou 1 com a
+// configuração inválida).
+func runPlan(args []string) int {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	lf := addLogFlags(fs)
+	output := fs.String("output", "text", "formato da saída: text ou json")
+	targets := fs.Bool("targets", false, "lista também cada IP dos ranges")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: discoveryhosts plan [-config arquivo] [-output text|json] [-targets]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "formato de saída inválido: %s\n", *output)
+		return 1
+	}
+	if err := lf.setup(logFormatText, false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	cfg, err := cf.load()
+	if err == nil {
+		if err = cfg.validate(); err != nil {
+			err = fmt.Errorf("configuração inválida: %w", err)
+		}
+	}
+	if err == nil {
+		cfg, err = cfg.resolveRanges(context.Background())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ERRO] %v\n", err)
+		return 1
+	}
+
+	report := planReport{Config: strings.Join(cf.files(), ","), Ranges: []planRange{}}
+	owners := cfg.rangeAgents()
+	for _, r := range cfg.Ranges {
+		r = strings.TrimSpace(r)
+		ips, err := iprange.Expand(r)
+		if err != nil {
+			continue
+		}
+		pr := planRange{Range: r, Agent: owners[r], Backends: cfg.planBackends(r)}
+		// Os ranges dos agentes vão inteiros, como no run
+		kept := ips
+		if pr.Agent == "" && len(cfg.excluded) > 0 {
+			kept = nil
+			for _, ip := range ips {
+				if cfg.excluded[ip] {
+					pr.Excluded++
+					continue
+				}
+				kept = append(kept, ip)
+			}
+		}
+		pr.Targets = len(kept)
+		if *targets {
+			pr.IPs = kept
+		}
+		report.Ranges = append(report.Ranges, pr)
+		report.TotalTargets += pr.Targets
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return 0
+	}
+	for _, r := range report.Ranges {
+		line := fmt.Sprintf("range %s: %d alvos", r.Range, r.Targets)
+		if r.Excluded > 0 {
+			line += fmt.Sprintf(" (%d reservados fora do scan)", r.Excluded)
+		}
+		if r.Agent != "" {
+			line += ", pelo agente " + r.Agent
+		}
+		if len(r.Backends) > 0 {
+			line += " -> " + strings.Join(r.Backends, ", ")
+		} else {
+			line += " -> nenhum backend de cadastro"
+		}
+		fmt.Println(line)
+		for _, ip := range r.IPs {
+			fmt.Printf("  %s\n", ip)
+		}
+	}
+	fmt.Printf("total de alvos: %d\n", report.TotalTargets)
+	return 0
+}
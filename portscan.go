@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+)
+
+// Limites da varredura de portas: uma lista pequena e timeouts curtos, para
+// que ela não vire um scanner de rede.
+const (
+	maxPortScanPorts   = 32
+	maxPortScanTimeout = 5 * time.Second
+)
+
+// PortScan configura a varredura TCP opcional dos hosts vivos. Só os ranges
+// listados em ranges são varridos; sem nenhum, a varredura fica desligada.
+type PortScan struct {
+	Ranges      []string `json:"ranges,omitempty" yaml:"ranges" toml:"ranges"`
+	Ports       []int    `json:"ports" yaml:"ports" toml:"ports"`
+	Timeout     Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+	Concurrency int      `json:"concurrency" yaml:"concurrency" toml:"concurrency"` // conexões simultâneas no run
+	Rate        int      `json:"rate" yaml:"rate" toml:"rate"`                      // conexões por segundo no run; 0 sem limite
+}
+
+func (p PortScan) validate(c Config) []error {
+	if len(p.Ranges) == 0 {
+		return nil
+	}
+	var errs []error
+	if len(p.Ports) == 0 || len(p.Ports) > maxPortScanPorts {
+		errs = append(errs, fmt.Errorf("port_scan.ports deve ter de 1 a %d portas (atual: %d)%s", maxPortScanPorts, len(p.Ports), c.origin("port_scan.ports")))
+	}
+	seen := map[int]bool{}
+	for _, port := range p.Ports {
+		switch {
+		case port < 1 || port > 65535:
+			errs = append(errs, fmt.Errorf("port_scan.ports: porta inválida: %d%s", port, c.origin("port_scan.ports")))
+		case seen[port]:
+			errs = append(errs, fmt.Errorf("port_scan.ports: porta %d repetida%s", port, c.origin("port_scan.ports")))
+		}
+		seen[port] = true
+	}
+	if t := time.Duration(p.Timeout); t <= 0 || t > maxPortScanTimeout {
+		errs = append(errs, fmt.Errorf("port_scan.timeout deve estar entre 0 e %s (atual: %s)%s", maxPortScanTimeout, p.Timeout, c.origin("port_scan.timeout")))
+	}
+	if p.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("port_scan.concurrency deve ser no mínimo 1 (atual: %d)%s", p.Concurrency, c.origin("port_scan.concurrency")))
+	}
+	if p.Rate < 0 {
+		errs = append(errs, fmt.Errorf("port_scan.rate não pode ser negativo (atual: %d)%s", p.Rate, c.origin("port_scan.rate")))
+	}
+	ranges := map[string]bool{}
+	for _, r := range c.Ranges {
+		ranges[strings.TrimSpace(r)] = true
+	}
+	owners := c.rangeAgents()
+	for i, r := range p.Ranges {
+		key := fmt.Sprintf("port_scan.ranges[%d]", i)
+		r = strings.TrimSpace(r)
+		if !ranges[r] {
+			errs = append(errs, fmt.Errorf("port_scan.ranges: o range %q não está em ranges%s", r, c.origin(key)))
+		}
+		// O ping desses ranges é feito pelo agente, que não varre portas
+		if agent, ok := owners[r]; ok {
+			errs = append(errs, fmt.Errorf("port_scan.ranges: o range %q é do agente %s e não pode ser varrido%s", r, agent, c.origin(key)))
+		}
+	}
+	return errs
+}
+
+// Tempo máximo da varredura num host, somado ao prazo por host.
+func (p PortScan) hostTime() time.Duration {
+	if len(p.Ranges) == 0 {
+		return 0
+	}
+	return time.Duration(len(p.Ports)) * time.Duration(p.Timeout)
+}
+
+// Configuração do pacote discovery; nil com a varredura desligada.
+func (p PortScan) discovery() *discovery.PortScan {
+	if len(p.Ranges) == 0 {
+		return nil
+	}
+	ranges := map[string]bool{}
+	for _, r := range p.Ranges {
+		ranges[strings.TrimSpace(r)] = true
+	}
+	return &discovery.PortScan{Ranges: ranges, Ports: p.Ports, Timeout: time.Duration(p.Timeout), Concurrency: p.Concurrency, Rate: p.Rate}
+}
+
+// Portas abertas como "22/ssh: 5, 443/https: 3", em ordem de porta.
+func openPortsText(open map[int]int) string {
+	ports := make([]int, 0, len(open))
+	for port := range open {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	parts := make([]string, len(ports))
+	for i, port := range ports {
+		parts[i] = fmt.Sprintf("%d/%s: %d", port, discovery.ServiceName(port), open[port])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Portas de um host separadas por sep, como "22,443".
+func joinPorts(ports []int, sep string) string {
+	parts := make([]string, len(ports))
+	for i, port := range ports {
+		parts[i] = strconv.Itoa(port)
+	}
+	return strings.Join(parts, sep)
+}
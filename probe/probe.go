@@ -0,0 +1,251 @@
+// Package probe verifica se um host responde, usando o ping do sistema.
+package probe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"discoveryhosts/hosttrace"
+)
+
+// ErrInvalidTarget indica um alvo que não é um endereço IP; o ping nem é
+// executado.
+var ErrInvalidTarget = errors.New("alvo inválido")
+
+// ErrNoReply indica um ping que saiu com sucesso sem um echo reply do host,
+// como o do Windows com um "host de destino inacessível" do roteador.
+var ErrNoReply = errors.New("sem resposta do host")
+
+// Motivos de falha do ping, classificados pela saída e pelo código de saída
+// do comando. Só ReasonUnreachable é um host que não respondeu; os demais
+// dizem que o ping nem chegou a testar o host. São códigos estáveis, usados
+// também como chaves nos arquivos de resultado.
+const (
+	ReasonUnreachable = "unreachable" // sem echo reply dentro do timeout
+	ReasonPermission  = "permission"  // sem permissão para o socket ICMP (CAP_NET_RAW)
+	ReasonResolution  = "resolution"  // o ping não resolveu o endereço
+	ReasonInvocation  = "invocation"  // o comando não executou ou recusou os argumentos
+	ReasonOther       = "other"
+)
+
+// Error é uma falha do ping com o motivo classificado e a saída do comando.
+type Error struct {
+	Reason string
+	Err    error
+	Output string // primeira linha da saída, se houver
+}
+
+func (e *Error) Error() string {
+	if e.Output == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Output
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Trechos da saída de cada motivo, nas mensagens das variantes (iputils,
+// BusyBox, BSD e Windows), em minúsculas.
+var reasonPatterns = []struct {
+	reason   string
+	patterns []string
+}{
+	{ReasonPermission, []string{"operation not permitted", "permission denied", "must be root", "are you root", "cap_net_raw"}},
+	{ReasonResolution, []string{"unknown host", "name or service not known", "cannot resolve", "temporary failure in name resolution", "could not find host", "bad address"}},
+	{ReasonInvocation, []string{"usage:", "invalid option", "unrecognized option", "illegal option", "invalid argument", "bad timeout", "bad linger", "bad number", "bad parameter", "bad option"}},
+}
+
+// Classifica a falha de um ping que executou e saiu com erro. Sem um trecho
+// conhecido na saída, vale o código de saída: no iputils o 1 é um host sem
+// resposta e o 2 um outro erro; no BSD o 64 é um uso inválido e o 68 um host
+// desconhecido. Os demais contam como sem resposta, que é o caso comum.
+func classify(flavor Flavor, out []byte, code int) string {
+	msg := strings.ToLower(string(out))
+	for _, rp := range reasonPatterns {
+		for _, p := range rp.patterns {
+			if strings.Contains(msg, p) {
+				return rp.reason
+			}
+		}
+	}
+	switch {
+	case (flavor == FlavorIputils || flavor == FlavorIputilsFractional) && code == 2:
+		return ReasonOther
+	case flavor == FlavorBSD && code == 64:
+		return ReasonInvocation
+	case flavor == FlavorBSD && code == 68:
+		return ReasonResolution
+	}
+	return ReasonUnreachable
+}
+
+// Primeira linha não vazia da saída, para a mensagem do erro.
+func firstLine(out []byte) string {
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// Flavor é a variante do ping do sistema. O -W muda de unidade entre elas: o
+// mesmo timeout em segundos viraria milissegundos no macOS.
+type Flavor string
+
+const (
+	FlavorIputils Flavor = "iputils" // Linux: -W em segundos inteiros
+	FlavorBusyBox Flavor = "busybox" // Alpine e imagens mínimas: -W em segundos inteiros
+	FlavorBSD     Flavor = "bsd"     // macOS e FreeBSD: -W em milissegundos
+	FlavorWindows Flavor = "windows" // -n 1 e -w em milissegundos
+
+	// iputils 20210202 ou mais novo: -W em segundos, com casas decimais
+	FlavorIputilsFractional Flavor = "iputils-fractional"
+
+	// Sem o ping no PATH; Ping falha com exec.ErrNotFound sem executar nada
+	FlavorNotFound Flavor = "not-found"
+)
+
+var (
+	detectMu sync.Mutex
+	detected Flavor
+)
+
+// DetectFlavor retorna a variante do ping do sistema, detectada no primeiro
+// uso. FlavorNotFound não fica guardado: um ping instalado depois é
+// detectado na próxima chamada.
+func DetectFlavor() Flavor {
+	detectMu.Lock()
+	defer detectMu.Unlock()
+	if detected != "" {
+		return detected
+	}
+	f := detectFlavor()
+	if f != FlavorNotFound {
+		detected = f
+	}
+	return f
+}
+
+func detectFlavor() Flavor {
+	switch runtime.GOOS {
+	case "windows":
+		return FlavorWindows
+	case "darwin", "freebsd", "dragonfly":
+		return FlavorBSD
+	}
+	// No BusyBox o ping é um link para o binário dele; se não for, o -V
+	// (versão no iputils) é uma opção desconhecida e o uso impresso começa
+	// com "BusyBox"
+	path, err := exec.LookPath("ping")
+	if err != nil {
+		return FlavorNotFound
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil && filepath.Base(real) == "busybox" {
+		return FlavorBusyBox
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, _ := exec.CommandContext(ctx, "ping", "-V").CombinedOutput()
+	if bytes.Contains(out, []byte("BusyBox")) {
+		return FlavorBusyBox
+	}
+	return iputilsFlavor(out)
+}
+
+// Primeira versão do iputils que aceita um -W com casas decimais; as
+// anteriores recusam "-W 1.5".
+const iputilsFractionalW = 20210202
+
+// Versão do iputils no -V: "ping from iputils 20240117" nas novas,
+// "ping utility, iputils-s20161105" nas antigas.
+var iputilsVersion = regexp.MustCompile(`iputils[- ]s?(\d{8})`)
+
+// Variante do iputils pela saída do -V; sem uma versão reconhecida, a de
+// segundos inteiros, que todas aceitam.
+func iputilsFlavor(out []byte) Flavor {
+	m := iputilsVersion.FindSubmatch(out)
+	if m == nil {
+		return FlavorIputils
+	}
+	if v, _ := strconv.Atoi(string(m[1])); v >= iputilsFractionalW {
+		return FlavorIputilsFractional
+	}
+	return FlavorIputils
+}
+
+// Args são os argumentos do ping de um único echo a ip, com o timeout na
+// unidade da variante. O -- antes do ip impede que ele vire uma opção; o ping
+// do Windows não o aceita, e lá o ip já foi conferido por ValidTarget.
+func (f Flavor) Args(ip string, timeout time.Duration) []string {
+	ms := strconv.FormatInt(max(timeout.Milliseconds(), 1), 10)
+	switch f {
+	case FlavorIputilsFractional:
+		secs := strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64)
+		return []string{"-c", "1", "-W", secs, "--", ip}
+	case FlavorBSD:
+		return []string{"-c", "1", "-W", ms, "--", ip}
+	case FlavorWindows:
+		return []string{"-n", "1", "-w", ms, ip}
+	}
+	// BusyBox e iputils antigo só aceitam segundos inteiros: arredonda para
+	// cima, com no mínimo 1
+	secs := max((timeout+time.Second-1)/time.Second, 1)
+	return []string{"-c", "1", "-W", strconv.FormatInt(int64(secs), 10), "--", ip}
+}
+
+// ValidTarget indica se s é um endereço IP, o único alvo que vai para o
+// comando do ping.
+func ValidTarget(s string) bool {
+	return net.ParseIP(s) != nil
+}
+
+// Ping envia um único echo ICMP a ip e retorna nil se houver resposta. O
+// timeout vai ao ping na unidade da variante do sistema (Flavor.Args). Com um
+// hosttrace no ctx, o comando e a saída dele vão para o rastro.
+//
+// As falhas são *Error, com o motivo: ReasonUnreachable para um host que não
+// respondeu, os demais quando o ping não pôde testar o host. Um ip que não é
+// um endereço (ValidTarget) retorna ErrInvalidTarget sem executar nada.
+func Ping(ctx context.Context, ip string, timeout time.Duration) error {
+	if !ValidTarget(ip) {
+		return fmt.Errorf("%w: %q", ErrInvalidTarget, ip)
+	}
+	flavor := DetectFlavor()
+	if flavor == FlavorNotFound {
+		return &Error{Reason: ReasonInvocation, Err: &exec.Error{Name: "ping", Err: exec.ErrNotFound}}
+	}
+	cmd := exec.CommandContext(ctx, "ping", flavor.Args(ip, timeout)...)
+	t := hosttrace.From(ctx)
+	t.Printf("ping: %s", strings.Join(cmd.Args, " "))
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	t.Printf("ping: saída em %s:\n%s", time.Since(start).Round(time.Microsecond), strings.TrimSpace(string(out)))
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil && flavor == FlavorWindows && !bytes.Contains(out, []byte("TTL=")):
+		// O do Windows sai com 0 também quando o roteador responde que o
+		// destino está inacessível; só uma linha com TTL= é um echo reply
+		err = &Error{Reason: ReasonUnreachable, Err: ErrNoReply, Output: firstLine(out)}
+	case errors.As(err, &exitErr):
+		err = &Error{Reason: classify(flavor, out, exitErr.ExitCode()), Err: err, Output: firstLine(out)}
+	case err != nil:
+		// O comando nem executou, como sem o ping no PATH
+		err = &Error{Reason: ReasonInvocation, Err: err}
+	}
+	if err != nil {
+		t.Printf("ping: %v", err)
+	}
+	return err
+}
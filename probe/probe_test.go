@@ -0,0 +1,127 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlavorArgs(t *testing.T) {
+	tests := []struct {
+		flavor  Flavor
+		timeout time.Duration
+		want    []string
+	}{
+		{FlavorIputils, 1500 * time.Millisecond, []string{"-c", "1", "-W", "2", "--", "10.0.0.1"}},
+		{FlavorIputils, 2 * time.Second, []string{"-c", "1", "-W", "2", "--", "10.0.0.1"}},
+		{FlavorIputils, 100 * time.Millisecond, []string{"-c", "1", "-W", "1", "--", "10.0.0.1"}},
+		{FlavorIputilsFractional, 1500 * time.Millisecond, []string{"-c", "1", "-W", "1.5", "--", "10.0.0.1"}},
+		{FlavorIputilsFractional, 2 * time.Second, []string{"-c", "1", "-W", "2", "--", "10.0.0.1"}},
+		{FlavorBusyBox, 1500 * time.Millisecond, []string{"-c", "1", "-W", "2", "--", "10.0.0.1"}},
+		{FlavorBusyBox, 0, []string{"-c", "1", "-W", "1", "--", "10.0.0.1"}},
+		{FlavorBSD, 1500 * time.Millisecond, []string{"-c", "1", "-W", "1500", "--", "10.0.0.1"}},
+		{FlavorBSD, 0, []string{"-c", "1", "-W", "1", "--", "10.0.0.1"}},
+		{FlavorWindows, 1500 * time.Millisecond, []string{"-n", "1", "-w", "1500", "10.0.0.1"}},
+	}
+	for _, tt := range tests {
+		if got := tt.flavor.Args("10.0.0.1", tt.timeout); !slices.Equal(got, tt.want) {
+			t.Errorf("%s.Args(%s) = %q, esperava %q", tt.flavor, tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func TestIputilsFlavor(t *testing.T) {
+	tests := []struct {
+		out  string
+		want Flavor
+	}{
+		{"ping from iputils 20240117\nlibcap: yes, IDN: yes", FlavorIputilsFractional},
+		{"ping from iputils 20210202", FlavorIputilsFractional},
+		{"ping from iputils s20200821", FlavorIputils},
+		{"ping utility, iputils-s20161105", FlavorIputils},
+		{"ping: invalid option -- 'V'", FlavorIputils},
+		{"", FlavorIputils},
+	}
+	for _, tt := range tests {
+		if got := iputilsFlavor([]byte(tt.out)); got != tt.want {
+			t.Errorf("iputilsFlavor(%q) = %s, esperava %s", tt.out, got, tt.want)
+		}
+	}
+}
+
+// Alvos que, se chegassem ao comando, virariam opções do ping ou lixo.
+var hostileTargets = []string{"", "-f", "--help", "-c 100000 10.0.0.1", "-W9999", "10.0.0.1 -f", "10.0.0.1\n-f", "10.0.0.1; reboot", "$(id)", "`id`", "localhost", "10.0.0.256", "::ffff:10.0.0.1 -s 65000"}
+
+func TestValidTarget(t *testing.T) {
+	for _, s := range hostileTargets {
+		if ValidTarget(s) {
+			t.Errorf("ValidTarget(%q) = true", s)
+		}
+	}
+	for _, s := range []string{"10.0.0.1", "192.168.255.254", "2001:db8::1"} {
+		if !ValidTarget(s) {
+			t.Errorf("ValidTarget(%q) = false", s)
+		}
+	}
+}
+
+func TestPingHostileNeverExecs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("o ping falso é um script sh")
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> '" + calls + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "ping"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	for _, s := range hostileTargets {
+		if err := Ping(context.Background(), s, time.Second); !errors.Is(err, ErrInvalidTarget) {
+			t.Errorf("Ping(%q): esperava ErrInvalidTarget, obteve %v", s, err)
+		}
+	}
+	if _, err := os.Stat(calls); !os.IsNotExist(err) {
+		data, _ := os.ReadFile(calls)
+		t.Fatalf("o ping foi executado com alvos inválidos:\n%s", data)
+	}
+
+	// O ping falso funciona: um IP válido chega a ele, depois do --
+	if err := Ping(context.Background(), "127.0.0.1", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if last := lines[len(lines)-1]; !strings.HasSuffix(last, "-- 127.0.0.1") {
+		t.Errorf("esperava o IP depois do --, obteve %q", last)
+	}
+}
+
+// Sem o ping no PATH, a variante é FlavorNotFound e o Ping falha com
+// exec.ErrNotFound, sem cair no iputils.
+func TestPingNotFound(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "freebsd", "dragonfly":
+		t.Skip("a variante vem do sistema operacional")
+	}
+	t.Setenv("PATH", t.TempDir())
+	if got := detectFlavor(); got != FlavorNotFound {
+		t.Errorf("esperava %s, obteve %s", FlavorNotFound, got)
+	}
+	err := Ping(context.Background(), "127.0.0.1", time.Second)
+	var perr *Error
+	if !errors.As(err, &perr) || perr.Reason != ReasonInvocation || !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("esperava ReasonInvocation com exec.ErrNotFound, obteve %v", err)
+	}
+}
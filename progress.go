@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/i18n"
+)
+
+// Como mostrar o progresso do run.
+type progressMode int
+
+const (
+	progressOff progressMode = iota
+	progressLog              // linha de log a cada intervalo
+	progressBar              // linha única atualizada no terminal
+	progressTUI              // painel do -tui na tela inteira do terminal
+)
+
+// Escolhe o modo de progresso: barra quando a saída padrão é um terminal,
+// linhas de log quando forçado com -progress fora de um terminal.
+func detectProgressMode(forced bool) progressMode {
+	if isTerminal(os.Stdout) {
+		return progressBar
+	}
+	if forced {
+		return progressLog
+	}
+	return progressOff
+}
+
+func isTerminal(f *os.File) bool {
+	// Só o modo de dispositivo não basta: o /dev/null também é um
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// Texto do progresso, calculado a partir dos mesmos contadores do resumo;
+// com color, os criados saem em verde e os erros em vermelho.
+func progressLine(s discovery.Summary, color bool) string {
+	elapsed := time.Since(s.Start)
+	line := fmt.Sprintf("%d/%d", s.Scanned, s.TargetsExpanded)
+	if s.TargetsExpanded > 0 {
+		line += fmt.Sprintf(" (%.1f%%)", float64(s.Scanned)*100/float64(s.TargetsExpanded))
+	}
+	created := strconv.Itoa(s.HostsCreated)
+	if s.HostsCreated > 0 {
+		created = paint(color, colorGreen, created)
+	}
+	line += i18n.T("progress.counts", s.Alive, created)
+	if s.ZabbixErrors > 0 {
+		line += paint(color, colorRed, i18n.T("progress.errors", s.ZabbixErrors))
+	}
+	for _, st := range s.Stages {
+		if st.Queued > 0 {
+			line += i18n.T("progress.queued", st.Queued, st.Stage)
+		}
+	}
+	if s.Scanned == 0 || elapsed <= 0 {
+		return line
+	}
+	rate := float64(s.Scanned) / elapsed.Seconds()
+	remaining := time.Duration(float64(s.TargetsExpanded-s.Scanned) / rate * float64(time.Second))
+	return line + fmt.Sprintf(", %.1f IPs/s, ETA %s", rate, remaining.Round(time.Second))
+}
+
+// Inicia o relatório de progresso e retorna a função que o encerra.
+func startProgress(mode progressMode, interval time.Duration, progress *discovery.Progress) func() {
+	switch mode {
+	case progressLog:
+		return runTicker(interval, func() { logInfo("run.progress", progressLine(progress.Snapshot(), false)) })
+	case progressTUI:
+		d := openDashboard()
+		if d == nil {
+			return startProgress(progressBar, interval, progress)
+		}
+		prev := logOutput
+		setLogOutput(&tuiLogWriter{d: d, file: logFile})
+		d.draw(progress.Snapshot())
+		stop := runTicker(time.Second, func() { d.draw(progress.Snapshot()) })
+		return func() {
+			stop()
+			d.close(prev != logFile)
+			setLogOutput(prev)
+		}
+	case progressBar:
+		bar := &terminalBar{w: os.Stdout}
+		prev := logOutput
+		setLogOutput(&barLogWriter{bar: bar, w: prev})
+		color := colorFor(bar.w)
+		stop := runTicker(time.Second, func() { bar.draw(progressLine(progress.Snapshot(), color)) })
+		return func() {
+			stop()
+			bar.clear()
+			setLogOutput(prev)
+		}
+	default:
+		return func() {}
+	}
+}
+
+// Máximo de IPs em andamento listados no snapshot do SIGUSR1.
+const snapshotMaxActive = 20
+
+// Registra no log o snapshot do progresso pedido com SIGUSR1: o total, os
+// contadores de cada etapa e os IPs em andamento, com o tempo de cada um.
+func logProgressSnapshot(progress *discovery.Progress) {
+	s := progress.Snapshot()
+	if s.Start.IsZero() {
+		logInfo("usr1.not_started")
+		return
+	}
+	logInfo("usr1.progress", progressLine(s, false), time.Since(s.Start).Round(time.Second))
+	for _, st := range s.Stages {
+		logInfo("usr1.stage", st.Stage, st.Processed, st.Errors, st.Queued)
+	}
+	active := progress.Active()
+	logInfo("usr1.active", len(active))
+	for i, a := range active {
+		if i == snapshotMaxActive {
+			logInfo("usr1.active_more", len(active)-i)
+			break
+		}
+		logInfo("usr1.active_host", a.IP, a.Stage, time.Since(a.Since).Round(time.Millisecond))
+	}
+}
+
+// Responde aos SIGUSR1 com logProgressSnapshot até a função retornada ser
+// chamada.
+func watchProgressSignal(progress *discovery.Progress) func() {
+	signals := make(chan os.Signal, 1)
+	notifyProgressSignal(signals)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+				logProgressSnapshot(progress)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// Executa fn a cada intervalo até a função retornada ser chamada.
+func runTicker(interval time.Duration, fn func()) func() {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// Linha de progresso redesenhada no lugar com \r.
+type terminalBar struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line string
+}
+
+func (b *terminalBar) draw(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.line = line
+	fmt.Fprintf(b.w, "\r\033[K%s", line)
+}
+
+func (b *terminalBar) clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.line != "" {
+		fmt.Fprint(b.w, "\r\033[K")
+		b.line = ""
+	}
+}
+
+// Saída de log que apaga a barra antes de cada linha e a redesenha depois,
+// para que as mensagens não se misturem com o progresso.
+type barLogWriter struct {
+	bar *terminalBar
+	w   io.Writer
+}
+
+func (l *barLogWriter) Write(p []byte) (int, error) {
+	l.bar.mu.Lock()
+	defer l.bar.mu.Unlock()
+	if l.bar.line != "" {
+		fmt.Fprint(l.bar.w, "\r\033[K")
+	}
+	n, err := l.w.Write(p)
+	if l.bar.line != "" {
+		fmt.Fprint(l.bar.w, l.bar.line)
+	}
+	return n, err
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Passa a entregar o SIGUSR1, que pede um snapshot do progresso, em c.
+func notifyProgressSignal(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
@@ -0,0 +1,8 @@
+//go:build windows || plan9
+
+package main
+
+import "os"
+
+// Sem SIGUSR1 nesta plataforma, o snapshot do progresso não é pedido.
+func notifyProgressSignal(chan<- os.Signal) {}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"discoveryhosts/discovery/discoverytest"
+	"discoveryhosts/snmpinfo"
+)
+
+// Valores que não podem aparecer em nenhuma linha de log nem nos rastros
+// do -debug-host.
+const (
+	secretCommunity = "comm-s3cr3t-4f1a"
+	secretPass      = "pass-s3cr3t-9b2c"
+	secretSession   = "sess-s3cr3t-77de"
+	secretAgent     = "agent-s3cr3t-0c3e"
+	secretAPI       = "api-s3cr3t-51aa"
+)
+
+// API JSON-RPC mínima do Zabbix: login, busca sem hosts e cadastro.
+func fakeZabbixAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			ID     int    `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result interface{}
+		switch req.Method {
+		case "apiinfo.version":
+			result = "6.0.0"
+		case "user.login":
+			result = secretSession
+		case "host.create":
+			result = map[string][]string{"hostids": {"10101"}}
+		default:
+			result = []interface{}{}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDebugScanHidesSecrets(t *testing.T) {
+	zbx := fakeZabbixAPI(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	conf := fmt.Sprintf(`{
+		"zabbix_url": %q,
+		"zabbix_user": "discovery",
+		"zabbix_pass": %q,
+		"zabbix_group_ids": ["2"],
+		"snmp_communities": ["public", %q],
+		"ranges": ["127.0.0.1-3"],
+		"include_self": true,
+		"agent": {"token": %q},
+		"api": {"token": %q}
+	}`, zbx.URL+"/api_jsonrpc.php", secretPass, secretCommunity, secretAgent, secretAPI)
+	if err := os.WriteFile(path, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := captureLogs(t)
+	if err := setupLogging(logFormatText, slog.LevelDebug); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig([]string{path}, loadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logInfo("config.loaded", cfg)
+	traces := filepath.Join(dir, "traces")
+	debug, err := parseDebugHosts([]string{"127.0.0.0/30"}, traces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Só a segunda community responde, para que ela passe pelo SNMP e pelo cadastro
+	d := []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}
+	snmp := &discoverytest.SNMP{Hosts: map[string]snmpinfo.Info{}, Communities: map[string]string{}}
+	for _, ip := range d {
+		snmp.Hosts[ip] = snmpinfo.Info{SysName: "sw-" + strings.ReplaceAll(ip, ".", "-")}
+		snmp.Communities[ip] = secretCommunity
+	}
+	pinger := &discoverytest.Pinger{Alive: map[string]bool{d[0]: true, d[1]: true, d[2]: true}}
+	summary, err := runDiscovery(context.Background(), cfg, RunOptions{
+		RunID:      "test",
+		DebugHosts: debug,
+		HostLogs:   true,
+		Pinger:     pinger,
+		SNMP:       snmp,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.HostsCreated != len(d) {
+		t.Fatalf("esperava %d hosts criados, obteve %d\n%s", len(d), summary.HostsCreated, logs.String())
+	}
+
+	out := logs.String()
+	files, _ := filepath.Glob(filepath.Join(traces, "*"))
+	if len(files) == 0 {
+		t.Fatal("esperava os rastros do -debug-host")
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out += string(data)
+	}
+	for _, secret := range []string{secretCommunity, secretPass, secretSession, secretAgent, secretAPI} {
+		if strings.Contains(out, secret) {
+			t.Errorf("o valor %q apareceu nos logs:\n%s", secret, out)
+		}
+	}
+}
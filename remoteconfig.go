@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Opções de busca de configuração via http(s)://.
+type remoteOptions struct {
+	Timeout  time.Duration
+	TokenEnv string // variável de ambiente com o bearer token, se definida
+	CAFile   string // CA adicional para validar o servidor
+	CacheDir string // diretório da última cópia obtida; vazio desativa o cache
+}
+
+// Metadados guardados junto da cópia em cache para requisições condicionais.
+type remoteCacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	ContentType  string    `json:"content_type,omitempty"`
+}
+
+func isConfigURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// Resolve um include relativo ao arquivo (ou URL) que o declarou.
+func resolveInclude(parent, inc string) string {
+	if isConfigURL(inc) || filepath.IsAbs(inc) {
+		return inc
+	}
+	if isConfigURL(parent) {
+		base, err := url.Parse(parent)
+		if err == nil {
+			if ref, err := url.Parse(inc); err == nil {
+				return base.ResolveReference(ref).String()
+			}
+		}
+		return inc
+	}
+	return filepath.Join(filepath.Dir(parent), inc)
+}
+
+// Detecta o formato de uma configuração remota pela extensão do caminho da
+// URL ou, sem extensão reconhecida, pelo Content-Type da resposta.
+func detectRemoteFormat(rawURL, contentType string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		switch strings.ToLower(path.Ext(u.Path)) {
+		case ".yaml", ".yml", ".toml", ".json", ".conf":
+			return detectConfigFormat(u.Path)
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.Contains(mediaType, "yaml"):
+		return formatYAML
+	case strings.Contains(mediaType, "toml"):
+		return formatTOML
+	default:
+		return formatJSON
+	}
+}
+
+// Lê o conteúdo de um arquivo local ou URL, retornando também o formato
+// detectado quando format estiver vazio.
+func readConfigSource(source, format string, opts remoteOptions) ([]byte, string, error) {
+	if !isConfigURL(source) {
+		if format == "" {
+			format = detectConfigFormat(source)
+		}
+		data, err := ioutil.ReadFile(source)
+		return data, format, err
+	}
+	data, contentType, err := fetchRemoteConfig(source, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	if format == "" {
+		format = detectRemoteFormat(source, contentType)
+	}
+	return data, format, nil
+}
+
+func (o remoteOptions) cachePaths(rawURL string) (string, string) {
+	sum := sha256.Sum256([]byte(rawURL))
+	name := hex.EncodeToString(sum[:8])
+	return filepath.Join(o.CacheDir, name+".conf"), filepath.Join(o.CacheDir, name+".meta.json")
+}
+
+func (o remoteOptions) httpClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.CAFile != "" {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao ler CA %s: %w", o.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("nenhum certificado válido em %s", o.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Timeout: o.Timeout, Transport: transport}, nil
+}
+
+// Resposta de uma busca de configuração remota.
+type remoteFetch struct {
+	data         []byte
+	contentType  string
+	etag         string
+	lastModified string
+	notModified  bool
+}
+
+// Busca a configuração remota. Com cache, envia If-None-Match/If-Modified-Since
+// para não baixar de novo um conteúdo inalterado e, se a busca falhar, usa a
+// última cópia obtida com sucesso.
+func fetchRemoteConfig(rawURL string, opts remoteOptions) ([]byte, string, error) {
+	var meta remoteCacheMeta
+	var cached []byte
+	var dataPath, metaPath string
+	if opts.CacheDir != "" {
+		dataPath, metaPath = opts.cachePaths(rawURL)
+		if raw, err := ioutil.ReadFile(metaPath); err == nil && json.Unmarshal(raw, &meta) == nil && meta.URL == rawURL {
+			cached, _ = ioutil.ReadFile(dataPath)
+		}
+	}
+
+	fetched, err := doFetch(rawURL, opts, meta, cached != nil)
+	switch {
+	case err == nil && fetched.notModified:
+		logInfo("config.remote_not_modified", rawURL, meta.FetchedAt.Format(time.RFC3339))
+		return cached, meta.ContentType, nil
+	case err == nil:
+		if opts.CacheDir != "" {
+			saveRemoteCache(rawURL, opts, fetched, dataPath, metaPath)
+		}
+		return fetched.data, fetched.contentType, nil
+	case cached != nil:
+		logWarn("config.remote_fallback", rawURL, err, meta.FetchedAt.Format(time.RFC3339))
+		return cached, meta.ContentType, nil
+	default:
+		return nil, "", fmt.Errorf("falha ao buscar configuração em %s: %w", rawURL, err)
+	}
+}
+
+func doFetch(rawURL string, opts remoteOptions, meta remoteCacheMeta, conditional bool) (remoteFetch, error) {
+	var fetched remoteFetch
+	client, err := opts.httpClient()
+	if err != nil {
+		return fetched, err
+	}
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fetched, err
+	}
+	if opts.TokenEnv != "" {
+		if token := os.Getenv(opts.TokenEnv); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	if conditional {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fetched, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		fetched.notModified = true
+		return fetched, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fetched, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	fetched.data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fetched, err
+	}
+	fetched.contentType = resp.Header.Get("Content-Type")
+	fetched.etag = resp.Header.Get("ETag")
+	fetched.lastModified = resp.Header.Get("Last-Modified")
+	return fetched, nil
+}
+
+// Grava a cópia obtida e seus metadados; falhas aqui só geram aviso.
+func saveRemoteCache(rawURL string, opts remoteOptions, fetched remoteFetch, dataPath, metaPath string) {
+	// A configuração contém credenciais, então o cache não é legível por outros
+	if err := os.MkdirAll(opts.CacheDir, 0o700); err != nil {
+		logWarn("config.cache_dir_failed", opts.CacheDir, err)
+		return
+	}
+	if err := writeFileAtomic(dataPath, fetched.data, 0o600); err != nil {
+		logWarn("config.cache_write_failed", err)
+		return
+	}
+	meta := remoteCacheMeta{
+		URL:          rawURL,
+		ETag:         fetched.etag,
+		LastModified: fetched.lastModified,
+		FetchedAt:    time.Now(),
+		ContentType:  fetched.contentType,
+	}
+	raw, _ := json.Marshal(meta)
+	if err := writeFileAtomic(metaPath, raw, 0o600); err != nil {
+		logWarn("config.cache_write_failed", err)
+	}
+}
+
+// Grava o arquivo num temporário no mesmo diretório e renomeia, para que
+// leitores nunca vejam um arquivo pela metade.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"slices"
+	"strings"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/zabbix"
+)
+
+// Valor de HostResult.Trigger e Summary.Trigger dos runs de -retry-from.
+const triggerRetry = "retry"
+
+// Resultados de um relatório que o -retry-from seleciona, e o critério padrão.
+var retryOutcomes = []string{"snmp_failed", "zabbix_failed", "timed_out", "limited", "dry_run"}
+
+const defaultRetryOutcomes = "snmp_failed,zabbix_failed"
+
+// Relatório do -output-json lido pelo -retry-from: os hosts a refazer e os
+// demais, que vão sem mudança para o novo relatório.
+type retryReport struct {
+	path  string
+	runID string
+	ips   []string
+	kept  []jsonHost
+}
+
+// Lê o relatório e separa os hosts cujo resultado está em outcomes (lista
+// separada por vírgulas de retryOutcomes).
+func loadRetryReport(path, outcomes string) (*retryReport, error) {
+	want := map[string]bool{}
+	for _, o := range strings.Split(outcomes, ",") {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		if !slices.Contains(retryOutcomes, o) {
+			return nil, fmt.Errorf("-retry-only desconhecido: %q (use %s)", o, strings.Join(retryOutcomes, ", "))
+		}
+		want[o] = true
+	}
+	if len(want) == 0 {
+		return nil, fmt.Errorf("-retry-only não pode ser vazio")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao ler o relatório do -retry-from: %w", err)
+	}
+	var doc struct {
+		SchemaVersion int        `json:"schema_version"`
+		Run           *jsonRun   `json:"run"`
+		Hosts         []jsonHost `json:"hosts"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("relatório %s inválido: %w", path, err)
+	}
+	switch {
+	case doc.SchemaVersion == 0 || doc.Run == nil || doc.Run.RunID == "":
+		return nil, fmt.Errorf("%s não é um relatório do -output-json (sem schema_version ou run.run_id)", path)
+	case doc.SchemaVersion > resultsSchemaVersion:
+		return nil, fmt.Errorf("relatório %s tem schema_version %d; esta versão lê até a %d", path, doc.SchemaVersion, resultsSchemaVersion)
+	}
+
+	rr := &retryReport{path: path, runID: doc.Run.RunID}
+	for i, h := range doc.Hosts {
+		ip := net.ParseIP(h.IP).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("relatório %s inválido: host %d com IP %q", path, i+1, h.IP)
+		}
+		if matchesOutcome(h, want) {
+			rr.ips = append(rr.ips, ip.String())
+		} else {
+			rr.kept = append(rr.kept, h)
+		}
+	}
+	return rr, nil
+}
+
+// Indica se o resultado do host no relatório está entre os escolhidos.
+func matchesOutcome(h jsonHost, want map[string]bool) bool {
+	action := ""
+	if h.Zabbix != nil {
+		action = h.Zabbix.Action
+	}
+	return want["snmp_failed"] && !h.SNMP.OK ||
+		want["zabbix_failed"] && (action == zabbix.Failed || action == discovery.ZabbixPartial) ||
+		want["timed_out"] && h.TimedOut ||
+		want["limited"] && action == discovery.ZabbixLimited ||
+		want["dry_run"] && action == discovery.ZabbixDryRun
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/probe"
+	"discoveryhosts/zabbix"
+)
+
+// Opções de um run que não fazem parte da configuração.
+type RunOptions struct {
+	RunID            string       // identificador do run nos logs e relatórios
+	DryRun           bool         // não cadastra nada no Zabbix
+	Sinks            []resultSink // destinos dos resultados por host (CSV etc.)
+	Progress         progressMode
+	ProgressInterval time.Duration       // intervalo das linhas de progresso no log
+	Live             *discovery.Progress // se definido, recebe o resumo em construção (contadores do -serve)
+	SignalSnapshot   bool                // registra o progresso no log a cada SIGUSR1; no -daemon, o loop responde
+
+	Cache      map[string]discovery.CachedHost // hosts do cache_file que só fazem o ping
+	Previous   []discovery.HostResult          // resultados do checkpoint retomado com -resume
+	Known      *knownHosts                     // hosts do known_hosts_file, que não são cadastrados
+	Checkpoint *checkpointWriter               // grava o checkpoint do -checkpoint, se definido
+
+	Only    map[string]bool // só estes IPs dos ranges (scan por trap do -daemon ou -target); nil para os ranges inteiros
+	Trigger string          // origem do run, como trap; vazia num run normal
+	RetryOf string          // run do relatório do -retry-from, com os IPs a refazer em Only
+
+	CreateLimit  int         // máximo de hosts criados no run (-limit); zero sem limite
+	Filter       *hostFilter // hosts identificados que não casam saem com ZabbixFiltered (-match-sysname, -match-sysdescr)
+	ShowFiltered bool        // os filtrados também vão para os sinks
+
+	DebugHosts *debugHosts // rastro detalhado das etapas destes hosts (-debug-host)
+	HostLogs   bool        // eventos de cada host num bloco só, quando ele termina (-group-host-logs)
+
+	Trace *hostTracer // recebe todos os hosts, mesmo os sem resposta ao ping (-verbose)
+
+	// Ping e SNMP no lugar dos do sistema, usados nos testes; nil usa o ping
+	// do sistema e o snmpinfo
+	Pinger discovery.Pinger
+	SNMP   discovery.SNMPQuerier
+	// Se definido, recebe os hosts a cadastrar depois do SNMP de todos e
+	// decide se o cadastro é feito (-confirm)
+	Confirm func(context.Context, []discovery.HostResult) bool
+}
+
+// Configuração do pacote discovery a partir da configuração carregada,
+// resolvendo o número automático de workers.
+func (c Config) discoveryConfig(opts RunOptions) discovery.Config {
+	workers := c.effectiveWorkers()
+	return discovery.Config{
+		Ranges:           c.Ranges,
+		Exclude:          c.excluded,
+		Self:             c.selfTargets(),
+		Workers:          workers,
+		PingWorkers:      c.PingWorkers,
+		SNMPWorkers:      c.SNMPWorkers,
+		ZabbixWorkers:    c.zabbixWorkers(workers),
+		ZabbixQueue:      c.ZabbixQueue,
+		PingTimeout:      time.Duration(c.PingTimeout),
+		SNMPTimeout:      time.Duration(c.SNMPTimeout),
+		Communities:      c.SNMPCommunities,
+		Zabbix:           c.hostCreator(),
+		GroupIDs:         c.ZabbixGroupIDs,
+		ProxyID:          c.ZabbixProxyID,
+		Targets:          c.zabbixTargets(),
+		Backends:         c.registrationBackends(),
+		RangeBackends:    c.rangeBackends(),
+		DryRun:           opts.DryRun,
+		SkipZabbix:       len(c.registrationNames()) == 0,
+		SkipZabbixRanges: c.LLD.rangeSet(),
+		Fallback:         c.NameFallback.discovery(),
+		PortScan:         c.PortScan.discovery(),
+		Interleave:       c.InterleaveRanges,
+		RangeWorkers:     c.localRangeWorkers(),
+		Remote:           c.remotes(opts.RunID),
+		HostTimeout:      c.hostTimeout(),
+		MaxDuration:      time.Duration(c.MaxRunDuration),
+		MaxRetries:       c.MaxRetries,
+		RetryDelay:       time.Duration(c.RetryDelay),
+		Adaptive:         c.AdaptiveWorkers.discovery(),
+		RunID:            opts.RunID,
+		Trigger:          opts.Trigger,
+		Only:             opts.Only,
+		RetryOf:          opts.RetryOf,
+		Cache:            opts.Cache,
+		Previous:         opts.Previous,
+		Known:            opts.Known.matcher(),
+		Filter:           opts.Filter.matcher(),
+		Trace:            opts.DebugHosts.matcher(),
+		HostLogBlock:     opts.hostLogBlock(),
+		CreateLimit:      opts.CreateLimit,
+		Pinger:           opts.Pinger,
+		SNMP:             opts.SNMP,
+	}
+}
+
+// Eventos guardados por host no -group-host-logs antes de o bloco ser
+// escrito mesmo sem o host ter terminado.
+const hostLogBlockEvents = 200
+
+func (o RunOptions) hostLogBlock() int {
+	if !o.HostLogs {
+		return 0
+	}
+	return hostLogBlockEvents
+}
+
+// Cadastro dos hosts identificados: o LibreNMS com o backend librenms, o
+// Icinga 2 com o icinga2 e o Zabbix nos demais casos; nil com mais de um
+// backend de cadastro, que vão em registrationBackends.
+func (c Config) hostCreator() discovery.HostCreator {
+	if c.multipleBackends() {
+		return nil
+	}
+	if c.backend(backendLibreNMS) {
+		return newLibreNMSCreator(c.LibreNMS)
+	}
+	if c.backend(backendIcinga2) {
+		return newIcinga2Creator(c.Icinga2)
+	}
+	return zabbix.NewClient(c.ZabbixURL, c.ZabbixUser, c.ZabbixPass, time.Duration(c.ZabbixTimeout))
+}
+
+// Executa o discovery com o progresso e os sinks do CLI: cada host que
+// respondeu vai para os sinks assim que concluído e, no fim, todos recebem o
+// resumo.
+func runDiscovery(ctx context.Context, cfg Config, opts RunOptions) (discovery.Summary, error) {
+	dc := cfg.discoveryConfig(opts)
+	dc.Progress = opts.Live
+	if dc.Progress == nil {
+		dc.Progress = &discovery.Progress{}
+	}
+	dc.OnResult = func(r discovery.HostResult) {
+		if opts.Checkpoint != nil {
+			opts.Checkpoint.add(r)
+		}
+		if opts.Trace != nil {
+			opts.Trace.trace(r)
+		}
+		if !r.Alive || r.ZabbixAction == discovery.ZabbixFiltered && !opts.ShowFiltered {
+			return
+		}
+		for _, sink := range opts.Sinks {
+			if err := sink.write(r); err != nil {
+				rootLog.With("ip", r.IP, "range", r.Range).WithErr(err).Errorf("report.result_write_failed", r.IP, err)
+			}
+		}
+	}
+
+	cfg.warnIgnoredZabbix()
+	if ps := dc.PortScan; ps != nil {
+		logInfo("portscan.enabled", len(ps.Ranges), joinPorts(ps.Ports, ","), ps.Concurrency, ps.Rate)
+	}
+	// Só o run que vai usar o ping do sistema executa o ping -V da detecção
+	if dc.Pinger == nil {
+		logInfo("ping.flavor", probe.DetectFlavor())
+	}
+	// Iniciado antes do logger do run, pois a barra troca a saída dos logs
+	stopProgress := sync.OnceFunc(startProgress(opts.Progress, opts.ProgressInterval, dc.Progress))
+	// Num panic, o terminal volta ao normal antes do stack trace
+	defer stopProgress()
+	if opts.Confirm != nil {
+		// A barra de progresso sai do terminal antes da pergunta
+		dc.Confirm = func(hosts []discovery.HostResult) bool {
+			stopProgress()
+			return opts.Confirm(ctx, hosts)
+		}
+	}
+	dc.Logger = rootLog.Slog()
+	if opts.SignalSnapshot {
+		defer watchProgressSignal(dc.Progress)()
+	}
+	report, err := discovery.Run(ctx, dc)
+	stopProgress()
+	opts.DebugHosts.close()
+	// Um run abortado (panics, erro fatal) segue como um run interrompido: os sinks
+	// recebem o resumo parcial e o código de saída indica a falha
+	if err != nil && ctx.Err() == nil && !report.Summary.Aborted {
+		abortSinks(opts.Sinks)
+		return discovery.Summary{}, err
+	}
+	if opts.Checkpoint != nil {
+		opts.Checkpoint.finish(report.Summary)
+	}
+	for _, sink := range opts.Sinks {
+		if err := sink.close(report.Summary); err != nil {
+			logError("report.close_failed", err)
+		}
+	}
+	return report.Summary, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/discovery/discoverytest"
+	"discoveryhosts/snmpinfo"
+	"discoveryhosts/zabbix"
+)
+
+func TestDiscoveryConfig(t *testing.T) {
+	base := defaultConfig()
+	base.ZabbixURL = "http://zabbix.example/api_jsonrpc.php"
+	base.ZabbixGroupIDs = []string{"2"}
+	base.SNMPCommunities = []string{"public"}
+	base.Ranges = []string{"10.0.0.0/30"}
+	base.Workers = 8
+
+	cfg := base
+	dc := cfg.discoveryConfig(RunOptions{RunID: "r1", DryRun: true, CreateLimit: 5})
+	if dc.Workers != 8 || dc.PingWorkers != 0 || dc.ZabbixWorkers != defaultZabbixWorkers {
+		t.Errorf("workers: esperava 8/0/%d, obteve %d/%d/%d", defaultZabbixWorkers, dc.Workers, dc.PingWorkers, dc.ZabbixWorkers)
+	}
+	if dc.PingTimeout != time.Second || dc.SNMPTimeout != 2*time.Second {
+		t.Errorf("timeouts: obteve %s e %s", dc.PingTimeout, dc.SNMPTimeout)
+	}
+	if len(dc.Ranges) != 1 || len(dc.Communities) != 1 || len(dc.GroupIDs) != 1 {
+		t.Errorf("ranges, communities ou grupos não repassados: %+v", dc)
+	}
+	if dc.RunID != "r1" || !dc.DryRun || dc.CreateLimit != 5 {
+		t.Errorf("opções do run não repassadas: %q %v %d", dc.RunID, dc.DryRun, dc.CreateLimit)
+	}
+	if _, ok := dc.Zabbix.(*zabbix.Client); !ok || dc.SkipZabbix || dc.Backends != nil {
+		t.Errorf("esperava o cliente do Zabbix como cadastro, obteve %T (skip %v, backends %d)", dc.Zabbix, dc.SkipZabbix, len(dc.Backends))
+	}
+	// Sem Pinger e SNMP, o discovery usa o ping do sistema e o snmpinfo
+	if dc.Pinger != nil || dc.SNMP != nil {
+		t.Errorf("esperava Pinger e SNMP nil, obteve %T e %T", dc.Pinger, dc.SNMP)
+	}
+	if dc.Self == nil {
+		t.Error("esperava o filtro dos endereços locais sem include_self")
+	}
+
+	cfg = base
+	cfg.ZabbixWorkers = 2
+	cfg.IncludeSelf = true
+	if dc := cfg.discoveryConfig(RunOptions{}); dc.ZabbixWorkers != 2 || dc.Self != nil {
+		t.Errorf("esperava zabbix_workers 2 e sem filtro local, obteve %d e %v", dc.ZabbixWorkers, dc.Self != nil)
+	}
+
+	cfg = base
+	cfg.Backends = nil
+	if dc := cfg.discoveryConfig(RunOptions{}); !dc.SkipZabbix {
+		t.Error("esperava SkipZabbix sem nenhum backend de cadastro")
+	}
+
+	cfg = base
+	cfg.Backends = []string{backendZabbix, backendLog}
+	if dc := cfg.discoveryConfig(RunOptions{}); dc.Zabbix != nil || len(dc.Backends) != 2 {
+		t.Errorf("esperava os dois backends na lista, obteve cliente %T e %d backends", dc.Zabbix, len(dc.Backends))
+	}
+}
+
+func TestHostCreator(t *testing.T) {
+	tests := []struct {
+		backends []string
+		want     string
+	}{
+		{[]string{backendZabbix}, "*zabbix.Client"},
+		{[]string{backendLibreNMS}, "main.librenmsCreator"},
+		{[]string{backendIcinga2}, "main.icinga2Creator"},
+		{[]string{backendZabbix, backendLibreNMS}, "<nil>"},
+	}
+	for _, tt := range tests {
+		cfg := defaultConfig()
+		cfg.Backends = tt.backends
+		if got := fmt.Sprintf("%T", cfg.hostCreator()); got != tt.want {
+			t.Errorf("backends %v: esperava %s, obteve %s", tt.backends, tt.want, got)
+		}
+	}
+}
+
+// workers: 0 na configuração usa o número automático e o run termina.
+func TestRunDiscoveryZeroWorkers(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.ZabbixURL = "http://zabbix.example/api_jsonrpc.php"
+	cfg.ZabbixGroupIDs = []string{"2"}
+	cfg.SNMPCommunities = []string{"public"}
+	cfg.Ranges = []string{"10.0.0.0/28"}
+	cfg.Workers = 0
+	captureLogs(t)
+
+	done := make(chan error, 1)
+	var sum discovery.Summary
+	go func() {
+		var err error
+		sum, err = runDiscovery(t.Context(), cfg, RunOptions{
+			DryRun: true,
+			Pinger: &discoverytest.Pinger{Alive: map[string]bool{"10.0.0.1": true, "10.0.0.2": true}},
+			SNMP:   &discoverytest.SNMP{Hosts: map[string]snmpinfo.Info{"10.0.0.1": {SysName: "sw1"}}},
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run com workers 0 não terminou")
+	}
+	if sum.Scanned != 14 || sum.Alive != 2 || sum.HostsDryRun != 1 {
+		t.Errorf("resumo inesperado: %d verificados, %d vivos, %d dry-run", sum.Scanned, sum.Alive, sum.HostsDryRun)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Agenda dos ciclos do -daemon.
+type schedule interface {
+	// Primeiro horário de execução depois de t.
+	next(t time.Time) time.Time
+	String() string
+}
+
+// Aceita um intervalo ("6h", "90m") ou uma expressão cron de 5 campos.
+func parseSchedule(s string) (schedule, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("-daemon: intervalo deve ser de pelo menos 1s: %s", s)
+		}
+		return intervalSchedule(d), nil
+	}
+	c, err := parseCron(s)
+	if err != nil {
+		return nil, fmt.Errorf("-daemon: %q não é um intervalo nem uma expressão cron válida: %w", s, err)
+	}
+	if c.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("-daemon: a expressão cron %q nunca coincide com uma data", s)
+	}
+	return c, nil
+}
+
+// Ciclos a cada intervalo fixo, contado do início do ciclo anterior.
+type intervalSchedule time.Duration
+
+func (i intervalSchedule) next(t time.Time) time.Time { return t.Add(time.Duration(i)) }
+
+func (i intervalSchedule) String() string { return time.Duration(i).String() }
+
+// Expressão cron "minuto hora dia-do-mês mês dia-da-semana", com *, listas,
+// intervalos e passos (*/15, 1-5, 0,30). Cada campo é um bitset dos valores
+// aceitos. Como no cron, se dia do mês e dia da semana forem restritos, basta
+// um dos dois coincidir.
+type cronSchedule struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// Limites de cada campo, na ordem da expressão.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minuto", 0, 59},
+	{"hora", 0, 23},
+	{"dia do mês", 1, 31},
+	{"mês", 1, 12},
+	{"dia da semana", 0, 7}, // 0 e 7 são domingo
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("esperados %d campos, encontrados %d", len(cronFields), len(fields))
+	}
+	sets := make([]uint64, len(fields))
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("campo %s: %w", cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+	c := &cronSchedule{
+		expr:   strings.Join(fields, " "),
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("passo inválido: %s", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("valor inválido: %s", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("valor inválido: %s", part)
+				}
+			} else if step > 1 {
+				hi = max // "5/15" vai de 5 até o fim
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("fora do intervalo %d-%d: %s", min, max, part)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Avança campo a campo, do mês ao minuto, até todos coincidirem. Expressões
+// impossíveis (31 de fevereiro) desistem após alguns anos.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) String() string { return c.expr }
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Versão atual do esquema da configuração. Arquivos sem config_version são
+// tratados como versão 1.
+const currentConfigVersion = 2
+
+// Campo renomeado numa versão do esquema. Os campos antigos eram escalares e
+// os novos são listas, então o valor antigo vira uma lista de um elemento.
+type schemaRename struct {
+	Version int
+	Old     string
+	New     string
+}
+
+var schemaRenames = []schemaRename{
+	{Version: 2, Old: "zabbix_group_id", New: "zabbix_group_ids"},
+	{Version: 2, Old: "snmp_community", New: "snmp_communities"},
+}
+
+// Indica se key é o nome antigo de um campo renomeado.
+func renamedKey(key string) bool {
+	for _, r := range schemaRenames {
+		if r.Old == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Versão declarada no arquivo, considerando 0 (ausente) como 1.
+func fileSchemaVersion(v int) int {
+	if v == 0 {
+		return 1
+	}
+	return v
+}
+
+// Converte os campos de versões antigas do esquema para os atuais, avisando
+// quais chaves devem ser atualizadas. Os perfis herdam a versão do arquivo.
+func (c *Config) migrateSchema(file string) error {
+	version := fileSchemaVersion(c.ConfigVersion)
+	if version > currentConfigVersion {
+		return fmt.Errorf("%s usa config_version %d, mas esta versão do discoveryhosts só conhece até a %d; atualize o binário", file, version, currentConfigVersion)
+	}
+	legacy, err := migrateConfigFields(c, version)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for name, p := range c.Profiles {
+		renamed, err := migrateConfigFields(&p, version)
+		if err != nil {
+			return fmt.Errorf("%s: perfil %s: %w", file, name, err)
+		}
+		for _, r := range renamed {
+			legacy = append(legacy, "profiles."+name+"."+r)
+		}
+		c.Profiles[name] = p
+	}
+	if len(legacy) > 0 {
+		logWarn("config.legacy_schema",
+			file, version, currentConfigVersion, strings.Join(legacy, ", "), file)
+	}
+	return nil
+}
+
+func migrateConfigFields(c *Config, version int) ([]string, error) {
+	var legacy []string
+	v := reflect.ValueOf(c).Elem()
+	for _, r := range schemaRenames {
+		old, err := lookupField(v, r.Old)
+		if err != nil || old.IsZero() {
+			continue
+		}
+		if version >= r.Version {
+			return nil, fmt.Errorf("%s foi renomeado para %s na versão %d do esquema", r.Old, r.New, r.Version)
+		}
+		renamed, err := lookupField(v, r.New)
+		if err != nil {
+			return nil, err
+		}
+		if renamed.Len() > 0 {
+			return nil, fmt.Errorf("%s e %s não podem ser usados juntos", r.Old, r.New)
+		}
+		renamed.Set(reflect.ValueOf([]string{old.String()}))
+		old.Set(reflect.Zero(old.Type()))
+		legacy = append(legacy, fmt.Sprintf("%s → %s", r.Old, r.New))
+	}
+	return legacy, nil
+}
+
+// Aplica as mesmas renomeações sobre a configuração decodificada de forma
+// genérica, preservando apenas as chaves presentes no arquivo.
+func migrateRawConfig(m map[string]interface{}, version int) ([]string, error) {
+	var changed []string
+	for _, r := range schemaRenames {
+		old, ok := m[r.Old]
+		if !ok || version >= r.Version {
+			continue
+		}
+		if _, exists := m[r.New]; exists {
+			return nil, fmt.Errorf("%s e %s não podem ser usados juntos", r.Old, r.New)
+		}
+		m[r.New] = []interface{}{old}
+		delete(m, r.Old)
+		changed = append(changed, fmt.Sprintf("%s → %s", r.Old, r.New))
+	}
+	if profiles, ok := m["profiles"].(map[string]interface{}); ok {
+		for name, p := range profiles {
+			if pm, ok := p.(map[string]interface{}); ok {
+				renamed, err := migrateRawConfig(pm, version)
+				if err != nil {
+					return nil, fmt.Errorf("perfil %s: %w", name, err)
+				}
+				for _, r := range renamed {
+					changed = append(changed, "profiles."+name+"."+r)
+				}
+			}
+		}
+	}
+	return changed, nil
+}
+
+// Codifica a configuração genérica no formato do arquivo original.
+func encodeRawConfig(m map[string]interface{}, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(m); err != nil {
+			return nil, err
+		}
+	case formatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(m); err != nil {
+			return nil, err
+		}
+	case formatTOML:
+		if err := toml.NewEncoder(&buf).Encode(m); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("formato de configuração desconhecido: %s", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// Subcomando migrate-config: reescreve um arquivo no esquema atual, guardando
+// o original em <arquivo>.bak.
+func runMigrateConfig(args []string) error {
+	fs := flag.NewFlagSet("migrate-config", flag.ExitOnError)
+	format := fs.String("config-format", "", "formato do arquivo (json, yaml, toml); detectado pela extensão se vazio")
+	dryRun := fs.Bool("dry-run", false, "mostra o resultado na saída padrão sem alterar o arquivo")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: discoveryhosts migrate-config [-config-format json|yaml|toml] [-dry-run] [arquivo]")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+	if len(positional) > 1 {
+		fs.Usage()
+		return fmt.Errorf("apenas um arquivo pode ser informado")
+	}
+	path := "discovery.conf"
+	if len(positional) == 1 {
+		path = positional[0]
+	}
+	if *format == "" {
+		*format = detectConfigFormat(path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := parseConfig(data, *format, &raw); err != nil {
+		return fmt.Errorf("falha ao parsear %s: %w", path, err)
+	}
+	version := 1
+	if v, ok := raw["config_version"]; ok {
+		n, ok := toInt(v)
+		if !ok {
+			return fmt.Errorf("%s: config_version inválido: %v", path, v)
+		}
+		version = fileSchemaVersion(n)
+	}
+	if version > currentConfigVersion {
+		return fmt.Errorf("%s usa config_version %d, mas esta versão do discoveryhosts só conhece até a %d", path, version, currentConfigVersion)
+	}
+	changed, err := migrateRawConfig(raw, version)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	raw["config_version"] = currentConfigVersion
+	out, err := encodeRawConfig(raw, *format)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		_, err := os.Stdout.Write(out)
+		return err
+	}
+	if version == currentConfigVersion && len(changed) == 0 {
+		logInfo("migrate.up_to_date", path, currentConfigVersion)
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".bak", data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("falha ao gravar backup: %w", err)
+	}
+	if err := writeFileAtomic(path, out, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if _, err := loadConfig([]string{path}, loadOptions{Format: *format}); err != nil {
+		return fmt.Errorf("arquivo migrado não carrega (original em %s.bak): %w", path, err)
+	}
+	logInfo("migrate.done",
+		path, version, currentConfigVersion, path, strings.Join(changed, ", "))
+	if hasComments(data, *format) {
+		logWarn("migrate.comments_lost", path)
+	}
+	// O arquivo é regravado a partir de um mapa, com as chaves ordenadas
+	logWarn("migrate.order_lost", path)
+	return nil
+}
+
+// Converte um número decodificado genericamente (int, int64 ou float64).
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), n == float64(int(n))
+	}
+	return 0, false
+}
+
+// Indica se o conteúdo original tinha comentários (que a migração descarta).
+func hasComments(data []byte, format string) bool {
+	if format == formatJSON {
+		stripped, err := stripJSONComments(data)
+		return err != nil || !bytes.Equal(stripped, data)
+	}
+	if format == formatYAML {
+		var doc yaml.Node
+		return yaml.Unmarshal(data, &doc) != nil || yamlHasComments(&doc)
+	}
+	return tomlHasComments(data)
+}
+
+// Indica se algum nó do documento YAML tem um comentário associado.
+func yamlHasComments(n *yaml.Node) bool {
+	if n.HeadComment != "" || n.LineComment != "" || n.FootComment != "" {
+		return true
+	}
+	for _, c := range n.Content {
+		if yamlHasComments(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Indica se o TOML tem um # fora das strings: básicas ("...", com escapes),
+// literais ('...') e as multilinha, entre três aspas de cada tipo.
+func tomlHasComments(data []byte) bool {
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '#':
+			return true
+		case '"', '\'':
+			delim := data[i : i+1]
+			if bytes.HasPrefix(data[i:], []byte{c, c, c}) {
+				delim = data[i : i+3]
+			}
+			i += len(delim)
+			for i < len(data) && !bytes.HasPrefix(data[i:], delim) {
+				if c == '"' && data[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i += len(delim) - 1
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A mesma configuração no esquema 1 (sem config_version) em cada formato.
+var schemaV1 = map[string]string{
+	"discovery.json": `{
+		"zabbix_url": "http://zabbix.example/api_jsonrpc.php",
+		"zabbix_group_id": "2",
+		"snmp_community": "public",
+		"ranges": ["10.0.0.0/30"],
+		"profiles": {"dc2": {"snmp_community": "dc2-ro"}}
+	}`,
+	"discovery.yaml": `
+zabbix_url: http://zabbix.example/api_jsonrpc.php
+zabbix_group_id: "2"
+snmp_community: public
+ranges: [10.0.0.0/30]
+profiles:
+  dc2:
+    snmp_community: dc2-ro
+`,
+	"discovery.toml": `
+zabbix_url = "http://zabbix.example/api_jsonrpc.php"
+zabbix_group_id = "2"
+snmp_community = "public"
+ranges = ["10.0.0.0/30"]
+
+[profiles.dc2]
+snmp_community = "dc2-ro"
+`,
+}
+
+// Carrega sem a origem dos campos, que muda entre os arquivos.
+func loadForCompare(t *testing.T, path string) Config {
+	t.Helper()
+	cfg, err := loadConfig([]string{path}, loadOptions{})
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	cfg.sources = nil
+	// As chaves escritas nos perfis mudam de nome entre as versões
+	for name, p := range cfg.Profiles {
+		p.present = nil
+		cfg.Profiles[name] = p
+	}
+	return cfg
+}
+
+func TestSchemaV1RoundTrip(t *testing.T) {
+	for name, content := range schemaV1 {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeConfig(t, dir, name, content)
+
+			legacy := loadForCompare(t, path)
+			if !reflect.DeepEqual(legacy.ZabbixGroupIDs, []string{"2"}) || !reflect.DeepEqual(legacy.SNMPCommunities, []string{"public"}) {
+				t.Fatalf("campos da versão 1 não convertidos: grupos %v, communities %v", legacy.ZabbixGroupIDs, legacy.SNMPCommunities)
+			}
+			if legacy.ZabbixGroupID != "" || legacy.SNMPCommunity != "" {
+				t.Errorf("campos antigos deveriam ficar vazios: %q %q", legacy.ZabbixGroupID, legacy.SNMPCommunity)
+			}
+			if got := legacy.Profiles["dc2"].SNMPCommunities; !reflect.DeepEqual(got, []string{"dc2-ro"}) {
+				t.Errorf("perfil não convertido: %v", got)
+			}
+
+			logs := captureLogs(t)
+			if err := runMigrateConfig([]string{path}); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(logs.String(), "ordem das chaves") {
+				t.Errorf("esperava o aviso da ordem das chaves:\n%s", logs)
+			}
+			if data, err := os.ReadFile(path + ".bak"); err != nil || string(data) != content {
+				t.Errorf("esperava o original em .bak: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var raw map[string]interface{}
+			if err := parseConfig(data, detectConfigFormat(path), &raw); err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range schemaRenames {
+				if _, ok := raw[r.Old]; ok {
+					t.Errorf("arquivo migrado ainda tem %s:\n%s", r.Old, data)
+				}
+			}
+			migrated := loadForCompare(t, path)
+			if migrated.ConfigVersion != currentConfigVersion {
+				t.Errorf("esperava config_version %d, obteve %d", currentConfigVersion, migrated.ConfigVersion)
+			}
+			if !reflect.DeepEqual(migrated, legacy) {
+				t.Errorf("configuração migrada difere da original:\n%+v\n%+v", migrated, legacy)
+			}
+
+			// Um arquivo já no esquema atual não é reescrito
+			os.Remove(path + ".bak")
+			if err := runMigrateConfig([]string{path}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+				t.Errorf("arquivo atual não deveria ser reescrito: %v", err)
+			}
+		})
+	}
+}
+
+func TestSchemaVersionErrors(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"versão futura", `{"config_version": 99, "ranges": ["10.0.0.0/30"]}`, "config_version 99"},
+		{"campo antigo na versão 2", `{"config_version": 2, "snmp_community": "public"}`, "snmp_community foi renomeado para snmp_communities"},
+		{"antigo e novo juntos", `{"zabbix_group_id": "2", "zabbix_group_ids": ["3"]}`, "não podem ser usados juntos"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := writeConfig(t, dir, "discovery.json", tt.content)
+		if _, err := loadConfig([]string{path}, loadOptions{}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: esperava erro com %q, obteve %v", tt.name, tt.want, err)
+		}
+	}
+	path := writeConfig(t, dir, "future.json", `{"config_version": 99}`)
+	if err := runMigrateConfig([]string{path}); err == nil || !strings.Contains(err.Error(), "config_version 99") {
+		t.Errorf("migrate-config deveria recusar versão futura, obteve %v", err)
+	}
+}
+
+func TestHasComments(t *testing.T) {
+	tests := []struct {
+		format, content string
+		want            bool
+	}{
+		{formatJSON, `{"snmp_communities": ["a#b"]}`, false},
+		{formatJSON, "{\"workers\": 4 // padrão\n}", true},
+		{formatYAML, "snmp_communities: [\"a#b\"]\nzabbix_pass: 'x#y'\nzabbix_url: http://zabbix.example/#/api\n", false},
+		{formatYAML, "# cabeçalho\nworkers: 4\n", true},
+		{formatYAML, "workers: 4 # padrão\n", true},
+		{formatYAML, "profiles:\n  dc2:\n    workers: 4\n  # fim dos perfis\n", true},
+		{formatTOML, "snmp_communities = [\"a#b\", 'c#d']\nzabbix_pass = \"x\\\"#\"\n", false},
+		{formatTOML, "zabbix_pass = \"\"\"\nlinha # dentro\n\"\"\"\nzabbix_user = '''a#b'''\n", false},
+		{formatTOML, "\"a#b\" = 1\n", false},
+		{formatTOML, "workers = 4 # padrão\n", true},
+		{formatTOML, "zabbix_pass = \"x\"\n# fim\n", true},
+	}
+	for _, tt := range tests {
+		if got := hasComments([]byte(tt.content), tt.format); got != tt.want {
+			t.Errorf("%s %q: esperava %v, obteve %v", tt.format, tt.content, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notificações ao systemd de uma unidade Type=notify (sd_notify): prontidão,
+// status, watchdog e parada. Nil fora do systemd, quando nenhum método envia
+// nada.
+type systemdNotifier struct {
+	addr     *net.UnixAddr
+	watchdog time.Duration // WatchdogSec da unidade, zero sem watchdog
+}
+
+// Notificador do NOTIFY_SOCKET do ambiente; nil sem ele.
+func newSystemdNotifier() *systemdNotifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Um @ no início indica um socket no namespace abstrato
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	n := &systemdNotifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}}
+	// WATCHDOG_PID, se definido, diz a qual processo o watchdog se aplica
+	if pid := os.Getenv("WATCHDOG_PID"); pid == "" || pid == strconv.Itoa(os.Getpid()) {
+		if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+			n.watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+	return n
+}
+
+// Envia as linhas de estado (READY=1, STATUS=..., ...) ao systemd. Uma falha
+// só é registrada em debug: o daemon não depende dela.
+func (n *systemdNotifier) notify(states ...string) {
+	if n == nil {
+		return
+	}
+	conn, err := net.DialUnix(n.addr.Net, nil, n.addr)
+	if err != nil {
+		logDebug("systemd.notify_failed", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		logDebug("systemd.notify_failed", err)
+	}
+}
+
+func (n *systemdNotifier) status(s string) {
+	n.notify("STATUS=" + s)
+}
+
+// Envia WATCHDOG=1 a cada metade do WatchdogSec, mas só depois que o loop do
+// daemon recebe de alive: com o loop travado, os pings param e o systemd
+// reinicia o serviço. Termina ao fechar stop.
+func (n *systemdNotifier) runWatchdog(alive chan<- struct{}, stop <-chan struct{}) {
+	if n == nil || n.watchdog <= 0 {
+		return
+	}
+	ticker := time.NewTicker(n.watchdog / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			select {
+			case alive <- struct{}{}:
+				n.notify("WATCHDOG=1")
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Prefixo de campos cujo valor vem da saída de um comando externo, ex.:
+// "cmd:///usr/local/bin/get-secret zabbix-pass".
+const secretCmdPrefix = "cmd://"
+
+// Tempo máximo de execução de um comando de segredo.
+const secretCmdTimeout = 10 * time.Second
+
+// Executa o comando de uma referência cmd:// e retorna a saída sem espaços nas
+// pontas. Valores sem o prefixo são retornados como estão.
+func resolveSecret(field, value string) (string, error) {
+	if !strings.HasPrefix(value, secretCmdPrefix) {
+		return value, nil
+	}
+	args, err := splitCommandLine(strings.TrimPrefix(value, secretCmdPrefix))
+	if err != nil {
+		return "", fmt.Errorf("%s: comando inválido: %w", field, err)
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("%s: comando vazio", field)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretCmdTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("%s: comando %s excedeu o timeout de %s", field, args[0], secretCmdTimeout)
+		}
+		// A saída padrão pode conter o segredo; só o stderr entra na mensagem
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: comando %s falhou: %v: %s", field, args[0], err, msg)
+		}
+		return "", fmt.Errorf("%s: comando %s falhou: %v", field, args[0], err)
+	}
+	secret := strings.TrimSpace(stdout.String())
+	if secret == "" {
+		return "", fmt.Errorf("%s: comando %s não retornou nenhum valor", field, args[0])
+	}
+	return secret, nil
+}
+
+// Resolve as referências cmd:// de todos os campos de credenciais.
+func resolveSecretRefs(cfg *Config) error {
+	type secretField struct {
+		name  string
+		value *string
+	}
+	fields := []secretField{
+		{"zabbix_user", &cfg.ZabbixUser},
+		{"zabbix_pass", &cfg.ZabbixPass},
+		{"smtp.username", &cfg.SMTP.Username},
+		{"smtp.password", &cfg.SMTP.Password},
+		{"agent.token", &cfg.Agent.Token},
+		{"api.token", &cfg.API.Token},
+		{"netbox.token", &cfg.NetBox.Token},
+		{"librenms.token", &cfg.LibreNMS.Token},
+		{"icinga2.username", &cfg.Icinga2.Username},
+		{"icinga2.password", &cfg.Icinga2.Password},
+		{"webhook.token", &cfg.Webhook.Token},
+		{"webhook.username", &cfg.Webhook.Username},
+		{"webhook.password", &cfg.Webhook.Password},
+		{"consul.token", &cfg.Consul.Token},
+		{"mqtt.username", &cfg.MQTT.Username},
+		{"mqtt.password", &cfg.MQTT.Password},
+		{"kafka.username", &cfg.Kafka.Username},
+		{"kafka.password", &cfg.Kafka.Password},
+		{"phpipam.username", &cfg.PHPIPAM.Username},
+		{"phpipam.password", &cfg.PHPIPAM.Password},
+		{"phpipam.token", &cfg.PHPIPAM.Token},
+		{"grafana.token", &cfg.Grafana.Token},
+	}
+	for i := range cfg.SNMPCommunities {
+		fields = append(fields, secretField{fmt.Sprintf("snmp_communities[%d]", i), &cfg.SNMPCommunities[i]})
+	}
+	for i := range cfg.SNMPTrap.Communities {
+		fields = append(fields, secretField{fmt.Sprintf("snmp_trap.communities[%d]", i), &cfg.SNMPTrap.Communities[i]})
+	}
+	for i := range cfg.SNMPTrap.Users {
+		u := &cfg.SNMPTrap.Users[i]
+		fields = append(fields,
+			secretField{fmt.Sprintf("snmp_trap.users[%d].auth_password", i), &u.AuthPassword},
+			secretField{fmt.Sprintf("snmp_trap.users[%d].priv_password", i), &u.PrivPassword})
+	}
+	for i := range cfg.ZabbixTargets {
+		t := &cfg.ZabbixTargets[i]
+		fields = append(fields,
+			secretField{fmt.Sprintf("zabbix_targets[%d].user", i), &t.User},
+			secretField{fmt.Sprintf("zabbix_targets[%d].pass", i), &t.Pass})
+	}
+	for _, f := range fields {
+		resolved, err := resolveSecret(f.name, *f.value)
+		if err != nil {
+			return err
+		}
+		*f.value = resolved
+	}
+	for name, e := range cfg.Agents {
+		token, err := resolveSecret("agents."+name+".token", e.Token)
+		if err != nil {
+			return err
+		}
+		e.Token = token
+		cfg.Agents[name] = e
+	}
+	for name, value := range cfg.Webhook.Headers {
+		resolved, err := resolveSecret("webhook.headers."+name, value)
+		if err != nil {
+			return err
+		}
+		cfg.Webhook.Headers[name] = resolved
+	}
+	return nil
+}
+
+// Divide uma linha de comando em argumentos, respeitando aspas simples e
+// duplas. Não há expansão de variáveis nem outros recursos de shell.
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("aspas não fechadas")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
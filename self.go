@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Config.Self do discovery: os endereços do próprio scanner saem dos ranges, a
+// menos que include_self esteja ligado. Sem isso, a VM do discovery dentro de
+// um range varrido se encontraria a cada run e seria cadastrada com o sysName
+// do snmpd local. Os IPs das interfaces são lidos a cada run (o -daemon
+// acompanha mudanças de endereço); os de loopback, 127.0.0.0/8 e ::1, valem
+// sempre.
+func (c Config) selfTargets() func(netip.Addr) bool {
+	if c.IncludeSelf {
+		return nil
+	}
+	local, err := localAddresses()
+	if err != nil {
+		logWarn("self.interfaces_failed", err)
+	}
+	if len(local) > 0 {
+		addrs := make([]string, 0, len(local))
+		for ip := range local {
+			addrs = append(addrs, ip)
+		}
+		sort.Strings(addrs)
+		logDebug("self.addresses", strings.Join(addrs, ", "))
+	}
+	return func(ip netip.Addr) bool {
+		return ip.IsLoopback() || local[ip.Unmap().String()]
+	}
+}
+
+// Endereços IP das interfaces locais, ligadas ou não. Com uma interface que
+// não pôde ser lida, retorna os das demais junto com o erro.
+func localAddresses() (map[string]bool, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	local := map[string]bool{}
+	var firstErr error
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok {
+				local[n.IP.String()] = true
+			}
+		}
+	}
+	return local, firstErr
+}
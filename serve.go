@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"discoveryhosts/discovery"
+)
+
+// API configura o modo servidor (-serve): uma API HTTP autenticada para
+// iniciar e acompanhar scans sob demanda.
+type API struct {
+	Token         string `json:"token,omitempty" yaml:"token" toml:"token"`
+	TLSCert       string `json:"tls_cert,omitempty" yaml:"tls_cert" toml:"tls_cert"`
+	TLSKey        string `json:"tls_key,omitempty" yaml:"tls_key" toml:"tls_key"`
+	MaxConcurrent int    `json:"max_concurrent" yaml:"max_concurrent" toml:"max_concurrent"`
+	KeepScans     int    `json:"keep_scans" yaml:"keep_scans" toml:"keep_scans"`
+}
+
+func (a API) validate(c Config) []error {
+	var errs []error
+	if (a.TLSCert == "") != (a.TLSKey == "") {
+		errs = append(errs, fmt.Errorf("api.tls_cert e api.tls_key devem ser definidos juntos%s", c.origin("api.tls_cert")))
+	}
+	if a.MaxConcurrent < 1 {
+		errs = append(errs, fmt.Errorf("api.max_concurrent deve ser no mínimo 1 (atual: %d)%s", a.MaxConcurrent, c.origin("api.max_concurrent")))
+	}
+	if a.KeepScans < 1 {
+		errs = append(errs, fmt.Errorf("api.keep_scans deve ser no mínimo 1 (atual: %d)%s", a.KeepScans, c.origin("api.keep_scans")))
+	}
+	return errs
+}
+
+// Chaves que um pedido de scan pode sobrescrever: só o ajuste do scan, nunca
+// credenciais, destinos ou arquivos.
+var apiOverridable = map[string]bool{
+	"ping_timeout":      true,
+	"snmp_timeout":      true,
+	"workers":           true,
+	"ping_workers":      true,
+	"snmp_workers":      true,
+	"zabbix_workers":    true,
+	"zabbix_queue":      true,
+	"range_workers":     true,
+	"interleave_ranges": true,
+	"max_run_duration":  true,
+	"max_retries":       true,
+	"retry_delay":       true,
+	"zabbix_group_ids":  true,
+	"zabbix_proxy_id":   true,
+}
+
+// Estados de um scan da API.
+const (
+	scanRunning   = "running"
+	scanDone      = "done"
+	scanCancelled = "cancelled"
+	scanFailed    = "failed"
+)
+
+// Corpo do POST /scans.
+type apiScanRequest struct {
+	Ranges    []string                   `json:"ranges"`
+	Overrides map[string]json.RawMessage `json:"overrides,omitempty"`
+	DryRun    bool                       `json:"dry_run,omitempty"`
+}
+
+// Estado e contadores de um scan, retornados pelo GET /scans/{id}.
+type apiScanStatus struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Ranges   []string   `json:"ranges"`
+	DryRun   bool       `json:"dry_run"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	ExitCode *int       `json:"exit_code,omitempty"`
+	Scanned  int        `json:"scanned"`
+	Totals   jsonTotals `json:"totals"`
+}
+
+// Scan iniciado pela API. Também é o sink do run: guarda os hosts que
+// responderam para o GET /scans/{id}/results, que acompanha o scan enquanto
+// ele roda.
+type apiScan struct {
+	id      string
+	cfg     Config
+	dryRun  bool
+	created time.Time
+	cancel  context.CancelFunc
+	live    *discovery.Progress
+
+	mu       sync.Mutex
+	changed  chan struct{} // fechado e trocado a cada host novo e no fim
+	hosts    []discovery.HostResult
+	status   string
+	finished time.Time
+	summary  discovery.Summary
+	err      error
+}
+
+func (s *apiScan) write(r discovery.HostResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts = append(s.hosts, r)
+	s.notify()
+	return nil
+}
+
+func (s *apiScan) close(sum discovery.Summary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = sum
+	return nil
+}
+
+// Chamado com s.mu travado.
+func (s *apiScan) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *apiScan) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finished, s.err = time.Now(), err
+	switch {
+	case err != nil:
+		s.status = scanFailed
+	case s.summary.Interrupted:
+		s.status = scanCancelled
+	default:
+		s.status = scanDone
+	}
+	s.notify()
+}
+
+func (s *apiScan) state() apiScanStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := apiScanStatus{ID: s.id, Status: s.status, Ranges: s.cfg.Ranges, DryRun: s.dryRun, Created: s.created}
+	sum := s.live.Snapshot()
+	if s.status != scanRunning {
+		finished := s.finished
+		st.Finished = &finished
+		if s.err != nil {
+			st.Error = s.err.Error()
+		} else {
+			sum = s.summary
+			code := exitCode(sum, false)
+			st.ExitCode = &code
+		}
+	}
+	st.Scanned = sum.Scanned
+	st.Totals = newJSONTotals(sum)
+	return st
+}
+
+// Servidor do -serve. Os scans ficam em memória; os concluídos mais antigos
+// são descartados além de api.keep_scans.
+type apiServer struct {
+	cfg  Config
+	ctx  context.Context // cancelado no encerramento do servidor
+	runs sync.WaitGroup
+
+	mu      sync.Mutex
+	scans   map[string]*apiScan
+	order   []string // IDs em ordem de criação
+	running int
+}
+
+func newAPIServer(ctx context.Context, cfg Config) *apiServer {
+	return &apiServer{cfg: cfg, ctx: ctx, scans: map[string]*apiScan{}}
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /scans", s.create)
+	mux.HandleFunc("GET /scans", s.list)
+	mux.HandleFunc("GET /scans/{id}", s.get)
+	mux.HandleFunc("GET /scans/{id}/results", s.results)
+	mux.HandleFunc("DELETE /scans/{id}", s.remove)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !bearerAuthorized(r, s.cfg.API.Token) {
+			logWarn("api.unauthorized", r.RemoteAddr, r.Method, r.URL.Path)
+			apiError(w, http.StatusUnauthorized, "token inválido")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func apiError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	apiJSON(w, code, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func apiJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Configuração de um scan da API: a do servidor com os ranges e overrides
+// do pedido, validada como a do CLI.
+func (s *apiServer) scanConfig(req apiScanRequest) (Config, error) {
+	if len(req.Ranges) == 0 {
+		return Config{}, fmt.Errorf("ranges é obrigatório")
+	}
+	cfg := s.cfg
+	cfg.sources = make(map[string]string, len(s.cfg.sources))
+	for k, v := range s.cfg.sources {
+		cfg.sources[k] = v
+	}
+	cfg.Ranges = req.Ranges
+	for i := range cfg.Ranges {
+		cfg.sources[fmt.Sprintf("ranges[%d]", i)] = "POST /scans"
+	}
+	keys := make([]string, 0, len(req.Overrides))
+	for key := range req.Overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	overrides := make([]string, len(keys))
+	for i, key := range keys {
+		if !apiOverridable[key] {
+			return Config{}, fmt.Errorf("overrides: a chave %s não pode ser alterada pela API", key)
+		}
+		overrides[i] = key + "=" + string(req.Overrides[key])
+	}
+	if err := applyOverrides(&cfg, overrides); err != nil {
+		return Config{}, err
+	}
+	// Reservas de workers e agentes só dos ranges do pedido
+	ranges := map[string]bool{}
+	for _, r := range cfg.Ranges {
+		ranges[strings.TrimSpace(r)] = true
+	}
+	if _, ok := req.Overrides["range_workers"]; !ok && cfg.RangeWorkers != nil {
+		rw := map[string]int{}
+		for r, n := range cfg.RangeWorkers {
+			if ranges[strings.TrimSpace(r)] {
+				rw[r] = n
+			}
+		}
+		cfg.RangeWorkers = rw
+	}
+	if cfg.AgentRanges != nil {
+		ar := map[string]string{}
+		for r, name := range cfg.AgentRanges {
+			if ranges[strings.TrimSpace(r)] {
+				ar[r] = name
+			}
+		}
+		cfg.AgentRanges = ar
+	}
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (s *apiServer) create(w http.ResponseWriter, r *http.Request) {
+	var req apiScanRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAgentRequest))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "pedido inválido: %v", err)
+		return
+	}
+	cfg, err := s.scanConfig(req)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if s.ctx.Err() != nil {
+		apiError(w, http.StatusServiceUnavailable, "servidor encerrando")
+		return
+	}
+	s.mu.Lock()
+	if s.running >= s.cfg.API.MaxConcurrent {
+		s.mu.Unlock()
+		apiError(w, http.StatusTooManyRequests, "limite de %d scans simultâneos atingido", s.cfg.API.MaxConcurrent)
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	scan := &apiScan{
+		id:      newRunID(),
+		cfg:     cfg,
+		dryRun:  req.DryRun,
+		created: time.Now(),
+		cancel:  cancel,
+		live:    &discovery.Progress{},
+		changed: make(chan struct{}),
+		status:  scanRunning,
+	}
+	s.scans[scan.id] = scan
+	s.order = append(s.order, scan.id)
+	s.running++
+	s.prune()
+	s.mu.Unlock()
+
+	logInfo("api.scan_start", scan.id, r.RemoteAddr, strings.Join(cfg.Ranges, ", "))
+	s.runs.Add(1)
+	go func() {
+		defer s.runs.Done()
+		defer cancel()
+		opts := RunOptions{RunID: scan.id, DryRun: req.DryRun, Sinks: []resultSink{scan}, Live: scan.live}
+		sum, err := runDiscovery(ctx, cfg, opts)
+		scan.finish(err)
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+		if err != nil {
+			logError("api.scan_failed", scan.id, err)
+			return
+		}
+		logInfo("api.scan_done", scan.id, sum.Scanned, sum.Alive, sum.HostsCreated, sum.Elapsed().Round(time.Millisecond))
+	}()
+	w.Header().Set("Location", "/scans/"+scan.id)
+	apiJSON(w, http.StatusAccepted, scan.state())
+}
+
+// Descarta os scans concluídos mais antigos além de keep_scans. Chamado com
+// s.mu travado.
+func (s *apiServer) prune() {
+	excess := len(s.order) - s.cfg.API.KeepScans
+	kept := s.order[:0]
+	for _, id := range s.order {
+		scan := s.scans[id]
+		if excess > 0 && scan.state().Status != scanRunning {
+			delete(s.scans, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.order = kept
+}
+
+func (s *apiServer) lookup(w http.ResponseWriter, r *http.Request) *apiScan {
+	s.mu.Lock()
+	scan := s.scans[r.PathValue("id")]
+	s.mu.Unlock()
+	if scan == nil {
+		apiError(w, http.StatusNotFound, "scan %s não encontrado", r.PathValue("id"))
+	}
+	return scan
+}
+
+func (s *apiServer) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	scans := make([]*apiScan, len(s.order))
+	for i, id := range s.order {
+		scans[i] = s.scans[id]
+	}
+	s.mu.Unlock()
+	states := make([]apiScanStatus, len(scans))
+	for i, scan := range scans {
+		states[i] = scan.state()
+	}
+	apiJSON(w, http.StatusOK, states)
+}
+
+func (s *apiServer) get(w http.ResponseWriter, r *http.Request) {
+	if scan := s.lookup(w, r); scan != nil {
+		apiJSON(w, http.StatusOK, scan.state())
+	}
+}
+
+// Cancela o scan pelo contexto: os hosts em andamento terminam e o scan fica
+// cancelled com o resumo parcial.
+func (s *apiServer) remove(w http.ResponseWriter, r *http.Request) {
+	scan := s.lookup(w, r)
+	if scan == nil {
+		return
+	}
+	if scan.state().Status == scanRunning {
+		logInfo("api.scan_cancel", scan.id, r.RemoteAddr)
+		scan.cancel()
+	}
+	apiJSON(w, http.StatusAccepted, scan.state())
+}
+
+// Envia em NDJSON os hosts que responderam, no mesmo formato do -output
+// ndjson, acompanhando o scan até o fim e terminando com a linha do resumo.
+func (s *apiServer) results(w http.ResponseWriter, r *http.Request) {
+	scan := s.lookup(w, r)
+	if scan == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	sent := 0
+	for {
+		scan.mu.Lock()
+		pending := scan.hosts[sent:]
+		changed, status, sum := scan.changed, scan.status, scan.summary
+		scan.mu.Unlock()
+		for _, h := range pending {
+			if err := enc.Encode(ndjsonHost{Type: "host", jsonHost: newJSONHost(h)}); err != nil {
+				return
+			}
+		}
+		sent += len(pending)
+		if status == scanFailed {
+			enc.Encode(map[string]string{"type": "error", "error": scan.state().Error})
+			return
+		}
+		if status != scanRunning {
+			enc.Encode(ndjsonSummary{Type: "summary", SchemaVersion: resultsSchemaVersion, jsonRun: newJSONRun(sum, scan.cfg, scan.dryRun)})
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Executa o modo servidor até um SIGINT/SIGTERM, que cancela os scans em
+// andamento e espera eles terminarem com o resumo parcial.
+func runServe(addr string, cfg Config) (int, error) {
+	if cfg.API.Token == "" {
+		return exitFatal, fmt.Errorf("-serve requer api.token na configuração")
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	api := newAPIServer(ctx, cfg)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           api.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	errc := make(chan error, 1)
+	go func() {
+		if cfg.API.TLSCert != "" {
+			logInfo("api.listening", addr, "https")
+			errc <- srv.ListenAndServeTLS(cfg.API.TLSCert, cfg.API.TLSKey)
+			return
+		}
+		logWarn("api.listening_plain", addr)
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return exitFatal, fmt.Errorf("modo servidor: %w", err)
+	case <-ctx.Done():
+	}
+	logInfo("api.stopping")
+	api.runs.Wait()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	return exitOK, nil
+}
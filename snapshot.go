@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/iprange"
+)
+
+// Versão do formato do snapshot_file. Um snapshot de outra versão é tratado
+// como ausente: o run seguinte apenas não mostra diferenças.
+const snapshotVersion = 1
+
+// Resultado compacto de um run, comparado com o run seguinte.
+type snapshot struct {
+	Version int            `json:"version"`
+	RunID   string         `json:"run_id"`
+	Time    time.Time      `json:"time"`
+	Hosts   []snapshotHost `json:"hosts"`
+}
+
+type snapshotHost struct {
+	IP      string `json:"ip"`
+	SysName string `json:"sysname,omitempty"`
+	SNMP    bool   `json:"snmp"`
+}
+
+// Diferenças entre o run anterior e o atual. Sem snapshot anterior utilizável,
+// Available é false e Reason explica o motivo.
+type snapshotDiff struct {
+	Available     bool       `json:"available"`
+	Reason        string     `json:"reason,omitempty"`
+	PreviousRunID string     `json:"previous_run_id,omitempty"`
+	PreviousTime  *time.Time `json:"previous_time,omitempty"`
+	RunID         string     `json:"run_id"`
+	New           []string   `json:"new"`
+	Missing       []string   `json:"missing"`
+	Renamed       []rename   `json:"renamed"`
+	SNMPStarted   []string   `json:"snmp_started"`
+	SNMPStopped   []string   `json:"snmp_stopped"`
+}
+
+func newSnapshotDiff(runID string) snapshotDiff {
+	return snapshotDiff{
+		RunID:       runID,
+		New:         []string{},
+		Missing:     []string{},
+		Renamed:     []rename{},
+		SNMPStarted: []string{},
+		SNMPStopped: []string{},
+	}
+}
+
+type rename struct {
+	IP   string `json:"ip"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (d snapshotDiff) empty() bool {
+	return len(d.New)+len(d.Missing)+len(d.Renamed)+len(d.SNMPStarted)+len(d.SNMPStopped) == 0
+}
+
+// Carrega o snapshot anterior. Arquivo ausente, corrompido ou de outra versão
+// retorna nil com o motivo, sem interromper o run.
+func loadSnapshot(path string) (*snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("snapshot %s corrompido: %w", path, err)
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot %s tem versão %d (suportada: %d)", path, s.Version, snapshotVersion)
+	}
+	return &s, nil
+}
+
+func diffSnapshots(prev, cur snapshot) snapshotDiff {
+	d := newSnapshotDiff(cur.RunID)
+	d.Available = true
+	d.PreviousRunID = prev.RunID
+	d.PreviousTime = &prev.Time
+	before := make(map[string]snapshotHost, len(prev.Hosts))
+	for _, h := range prev.Hosts {
+		before[h.IP] = h
+	}
+	seen := make(map[string]bool, len(cur.Hosts))
+	for _, h := range cur.Hosts {
+		seen[h.IP] = true
+		old, ok := before[h.IP]
+		switch {
+		case !ok:
+			d.New = append(d.New, h.IP)
+			continue
+		case !old.SNMP && h.SNMP:
+			d.SNMPStarted = append(d.SNMPStarted, h.IP)
+		case old.SNMP && !h.SNMP:
+			d.SNMPStopped = append(d.SNMPStopped, h.IP)
+		}
+		if old.SysName != "" && h.SysName != "" && old.SysName != h.SysName {
+			d.Renamed = append(d.Renamed, rename{IP: h.IP, From: old.SysName, To: h.SysName})
+		}
+	}
+	for _, h := range prev.Hosts {
+		if !seen[h.IP] {
+			d.Missing = append(d.Missing, h.IP)
+		}
+	}
+	return d
+}
+
+// Grava o snapshot do run e compara com o anterior no close. O diff é
+// escrito no log e, com -output-diff, também em um arquivo JSON.
+type snapshotSink struct {
+	path     string
+	diffPath string
+	hosts    []snapshotHost
+}
+
+func newSnapshotSink(path, diffPath string) *snapshotSink {
+	return &snapshotSink{path: path, diffPath: diffPath}
+}
+
+func (s *snapshotSink) write(r discovery.HostResult) error {
+	s.hosts = append(s.hosts, snapshotHost{IP: r.IP, SysName: r.SNMP.SysName, SNMP: r.SNMPErr == nil})
+	return nil
+}
+
+func (s *snapshotSink) close(sum discovery.Summary) error {
+	// Um run parcial faria os hosts não verificados aparecerem como sumidos
+	if sum.Partial() {
+		logWarn("diff.interrupted", s.path)
+		return nil
+	}
+	sort.Slice(s.hosts, func(i, j int) bool { return iprange.Less(s.hosts[i].IP, s.hosts[j].IP) })
+	cur := snapshot{Version: snapshotVersion, RunID: sum.RunID, Time: sum.Start, Hosts: s.hosts}
+	if cur.Hosts == nil {
+		cur.Hosts = []snapshotHost{}
+	}
+
+	d := newSnapshotDiff(cur.RunID)
+	prev, err := loadSnapshot(s.path)
+	switch {
+	case os.IsNotExist(err):
+		d.Reason = "no previous snapshot"
+		logInfo("diff.no_previous", s.path)
+	case err != nil:
+		d.Reason = err.Error()
+		logWarn("diff.unavailable", err)
+	default:
+		d = diffSnapshots(*prev, cur)
+		logDiff(d)
+	}
+	if s.diffPath != "" {
+		if err := writeJSONFile(s.diffPath, d); err != nil {
+			logError("report.close_failed", fmt.Errorf("falha ao gravar %s: %w", s.diffPath, err))
+		}
+	}
+
+	if err := writeJSONFile(s.path, cur); err != nil {
+		return fmt.Errorf("falha ao gravar snapshot %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0o644)
+}
+
+func logDiff(d snapshotDiff) {
+	if d.empty() {
+		rootLog.Summaryf("diff.none", d.PreviousRunID)
+		return
+	}
+	rootLog.Summaryf("diff.totals", d.PreviousRunID, len(d.New), len(d.Missing), len(d.Renamed), len(d.SNMPStarted), len(d.SNMPStopped))
+	for _, ip := range d.New {
+		logInfo("diff.new", ip)
+	}
+	for _, ip := range d.Missing {
+		logInfo("diff.missing", ip)
+	}
+	for _, r := range d.Renamed {
+		logInfo("diff.renamed", r.IP, r.From, r.To)
+	}
+	if len(d.SNMPStarted) > 0 {
+		logInfo("diff.snmp_started", strings.Join(d.SNMPStarted, ", "))
+	}
+	if len(d.SNMPStopped) > 0 {
+		logInfo("diff.snmp_stopped", strings.Join(d.SNMPStopped, ", "))
+	}
+}
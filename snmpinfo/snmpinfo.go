@@ -0,0 +1,190 @@
+// Package snmpinfo lê a identificação do sistema (sysName, sysDescr, sysLocation) de um
+// host via SNMP v2c.
+package snmpinfo
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+
+	"discoveryhosts/hosttrace"
+)
+
+// Motivos de falha SNMP contabilizados no resumo. São códigos estáveis, usados
+// também como chaves nos arquivos de resultado.
+const (
+	ReasonTimeout     = "timeout"
+	ReasonConnect     = "connect"
+	ReasonRefused     = "refused"
+	ReasonNoString    = "no_sysname"
+	ReasonNoCommunity = "no_community"
+	ReasonUnsupported = "unsupported_type"
+	ReasonOther       = "other"
+)
+
+// Error é uma falha de SNMP com o motivo classificado para o resumo.
+type Error struct {
+	Reason string
+	Err    error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ValueError é um valor do agente com um tipo que não vira texto, como o de
+// um agente que declara um tipo e envia outro.
+type ValueError struct {
+	OID   string
+	Type  gosnmp.Asn1BER // tipo declarado no PDU
+	Value interface{}
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("OID %s: tipo de valor não suportado (%s, %T)", e.OID, e.Type, e.Value)
+}
+
+// Texto do valor de um PDU pelo tipo do valor recebido, não pelo declarado.
+// Sem valor (Null, NoSuchObject...) retorna "", e os tipos que não viram
+// texto, um *ValueError.
+func decodeString(v gosnmp.SnmpPDU) (string, error) {
+	oid := strings.TrimPrefix(v.Name, ".")
+	switch value := v.Value.(type) {
+	case nil:
+		return "", nil
+	case []byte:
+		return strings.ToValidUTF8(string(value), "\uFFFD"), nil
+	case string:
+		return strings.ToValidUTF8(value, "\uFFFD"), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(value), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(value), 10), nil
+	case uint64:
+		return strconv.FormatUint(value, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case *big.Int:
+		if value == nil {
+			return "", nil
+		}
+		return value.String(), nil
+	case net.IP:
+		return value.String(), nil
+	default:
+		return "", &ValueError{OID: oid, Type: v.Type, Value: v.Value}
+	}
+}
+
+// Classifica um erro retornado pelo gosnmp.
+func classify(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "timeout"):
+		return ReasonTimeout
+	case strings.Contains(msg, "connection refused"):
+		return ReasonRefused
+	default:
+		return ReasonOther
+	}
+}
+
+// Info são os dados do sistema lidos via SNMP.
+type Info struct {
+	SysName     string
+	SysDescr    string
+	SysObjectID string // identifica o fabricante e o modelo, sem o ponto inicial
+	SysLocation string
+	Community   string
+	Version     string
+}
+
+// OIDs consultados em cada host
+const (
+	oidSysDescr    = "1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = "1.3.6.1.2.1.1.2.0"
+	oidSysName     = "1.3.6.1.2.1.1.5.0"
+	oidSysLocation = "1.3.6.1.2.1.1.6.0"
+)
+
+// Query consulta sysName, sysDescr, sysObjectID e sysLocation de ip com a community informada. Os erros
+// são sempre *Error: ReasonConnect se o socket não abrir, ReasonNoString se o
+// sysName não vier, ReasonUnsupported se ele vier num tipo que não vira texto
+// (com um *ValueError) e o motivo classificado nas demais falhas. Os demais
+// OIDs num tipo assim ficam vazios.
+func Query(ctx context.Context, ip, community string, timeout time.Duration) (Info, error) {
+	g := &gosnmp.GoSNMP{
+		Target:    ip,
+		Port:      161,
+		Community: community,
+		Version:   gosnmp.Version2c,
+		Timeout:   timeout,
+		Retries:   1,
+		Context:   ctx,
+	}
+	t := hosttrace.From(ctx)
+	if t != nil {
+		// Os PDUs enviados e recebidos, decodificados pelo gosnmp
+		t.Secret(community)
+		g.Logger = gosnmp.NewLogger(t)
+		t.Printf("snmp: get v2c %s:%d community %s, timeout %s", ip, g.Port, community, timeout)
+	}
+	if err := g.Connect(); err != nil {
+		return Info{}, &Error{Reason: ReasonConnect, Err: err}
+	}
+	defer g.Conn.Close()
+
+	result, err := g.Get([]string{oidSysName, oidSysDescr, oidSysObjectID, oidSysLocation})
+	if err == nil && result == nil {
+		err = fmt.Errorf("resposta SNMP vazia")
+	}
+	if err != nil {
+		t.Printf("snmp: %v", err)
+		return Info{}, &Error{Reason: classify(err), Err: err}
+	}
+	for _, variable := range result.Variables {
+		value := variable.Value
+		if b, ok := value.([]byte); ok {
+			value = strconv.Quote(string(b))
+		}
+		t.Printf("snmp: %s %s = %v", variable.Name, variable.Type, value)
+	}
+	info := Info{Community: community, Version: "2c"}
+	for _, variable := range result.Variables {
+		value, err := decodeString(variable)
+		oid := strings.TrimPrefix(variable.Name, ".")
+		if err != nil {
+			t.Printf("snmp: %v", err)
+			if oid == oidSysName {
+				return Info{}, &Error{Reason: ReasonUnsupported, Err: err}
+			}
+			continue
+		}
+		switch oid {
+		case oidSysName:
+			info.SysName = value
+		case oidSysDescr:
+			info.SysDescr = value
+		case oidSysObjectID:
+			info.SysObjectID = strings.TrimPrefix(value, ".")
+		case oidSysLocation:
+			info.SysLocation = value
+		}
+	}
+	if info.SysName == "" {
+		return Info{}, &Error{Reason: ReasonNoString, Err: fmt.Errorf("OID não retornou string")}
+	}
+	return info, nil
+}
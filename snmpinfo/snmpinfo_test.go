@@ -0,0 +1,111 @@
+package snmpinfo
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestDecodeString(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   gosnmp.Asn1BER
+		value interface{}
+		want  string
+	}{
+		{"nil", gosnmp.Null, nil, ""},
+		{"NoSuchObject", gosnmp.NoSuchObject, nil, ""},
+		{"[]byte", gosnmp.OctetString, []byte("sw-core-01"), "sw-core-01"},
+		{"[]byte vazio", gosnmp.OctetString, []byte{}, ""},
+		{"[]byte UTF-8 inválido", gosnmp.OctetString, []byte{'a', 0xff, 'b'}, "a�b"},
+		{"string", gosnmp.OctetString, "rtr-01", "rtr-01"},
+		{"int", gosnmp.Integer, 42, "42"},
+		{"int negativo", gosnmp.Integer, -7, "-7"},
+		{"int64", gosnmp.Integer, int64(1) << 40, "1099511627776"},
+		{"uint", gosnmp.Gauge32, uint(7), "7"},
+		{"uint32", gosnmp.Counter32, uint32(4294967295), "4294967295"},
+		{"uint64", gosnmp.Counter64, uint64(18446744073709551615), "18446744073709551615"},
+		{"float32", gosnmp.OpaqueFloat, float32(1.5), "1.5"},
+		{"float64", gosnmp.OpaqueDouble, 2.25, "2.25"},
+		{"*big.Int", gosnmp.Counter64, big.NewInt(123456789), "123456789"},
+		{"*big.Int nil", gosnmp.Counter64, (*big.Int)(nil), ""},
+		{"net.IP", gosnmp.IPAddress, net.IPv4(10, 0, 0, 1), "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeString(gosnmp.SnmpPDU{Name: "." + oidSysName, Type: tt.typ, Value: tt.value})
+			if err != nil {
+				t.Fatalf("erro %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("%q, esperava %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Os tipos que não viram texto retornam um *ValueError com o OID sem o ponto
+// inicial e o tipo declarado.
+func TestDecodeStringUnsupported(t *testing.T) {
+	for _, value := range []interface{}{
+		struct{}{},
+		[]int{1, 2},
+		map[string]string{},
+		true,
+		int8(1),
+		&struct{ X int }{},
+		gosnmp.SnmpPDU{},
+		[]string{"a"},
+	} {
+		_, err := decodeString(gosnmp.SnmpPDU{Name: "." + oidSysName, Type: gosnmp.OctetString, Value: value})
+		var ve *ValueError
+		if !errors.As(err, &ve) {
+			t.Errorf("%T: erro %v, esperava um *ValueError", value, err)
+			continue
+		}
+		if ve.OID != oidSysName || ve.Type != gosnmp.OctetString {
+			t.Errorf("%T: ValueError com OID %q e tipo %s", value, ve.OID, ve.Type)
+		}
+	}
+}
+
+// Nenhum valor do PDU, com qualquer tipo declarado, faz decodeString entrar
+// em panic; a saída é um texto ou um *ValueError.
+func FuzzDecodeString(f *testing.F) {
+	f.Add(byte(gosnmp.OctetString), 0, []byte("sw-core-01"), int64(0))
+	f.Add(byte(gosnmp.Integer), 1, []byte(nil), int64(-5))
+	f.Add(byte(gosnmp.Counter64), 2, []byte(nil), int64(1)<<62)
+	f.Add(byte(gosnmp.IPAddress), 3, []byte{10, 0, 0, 1}, int64(0))
+	f.Add(byte(gosnmp.Opaque), 4, []byte{0xff, 0xfe}, int64(0))
+	f.Add(byte(gosnmp.Null), 5, []byte(nil), int64(0))
+	f.Fuzz(func(t *testing.T, typ byte, kind int, data []byte, n int64) {
+		// kind escolhe o tipo Go do valor, como os que o gosnmp produz e
+		// alguns que ele não deveria produzir
+		values := []interface{}{
+			data,
+			string(data),
+			int(n),
+			n,
+			uint(n),
+			uint32(n),
+			uint64(n),
+			float32(n),
+			float64(n),
+			new(big.Int).SetBytes(data),
+			(*big.Int)(nil),
+			net.IP(data),
+			nil,
+			int16(n),
+			[]interface{}{data},
+		}
+		value := values[uint(kind)%uint(len(values))]
+		_, err := decodeString(gosnmp.SnmpPDU{Name: "." + oidSysName, Type: gosnmp.Asn1BER(typ), Value: value})
+		var ve *ValueError
+		if err != nil && !errors.As(err, &ve) {
+			t.Errorf("%T: erro %v, esperava nil ou um *ValueError", value, err)
+		}
+	})
+}
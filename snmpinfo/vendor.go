@@ -0,0 +1,45 @@
+package snmpinfo
+
+import "strings"
+
+// Prefixo dos sysObjectID atribuídos pela IANA a cada fabricante
+// (1.3.6.1.4.1.<enterprise>).
+const enterprisesOID = "1.3.6.1.4.1."
+
+// Fabricantes mais comuns por número de enterprise.
+var vendors = map[string]string{
+	"9":     "cisco",
+	"11":    "hp",
+	"43":    "3com",
+	"171":   "dlink",
+	"311":   "microsoft",
+	"1916":  "extreme",
+	"1991":  "brocade",
+	"2011":  "huawei",
+	"2636":  "juniper",
+	"3375":  "f5",
+	"4526":  "netgear",
+	"6486":  "alcatel",
+	"6527":  "nokia",
+	"6876":  "vmware",
+	"8072":  "net-snmp",
+	"12356": "fortinet",
+	"14823": "aruba",
+	"14988": "mikrotik",
+	"25053": "ruckus",
+	"25461": "paloalto",
+	"25506": "h3c",
+	"30065": "arista",
+	"41112": "ubiquiti",
+}
+
+// Vendor é o fabricante de um sysObjectID, ou vazio se o enterprise não for
+// conhecido.
+func Vendor(sysObjectID string) string {
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(sysObjectID, "."), enterprisesOID)
+	if !ok {
+		return ""
+	}
+	enterprise, _, _ := strings.Cut(rest, ".")
+	return vendors[enterprise]
+}
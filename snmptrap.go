@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"discoveryhosts/iprange"
+	"discoveryhosts/snmptrap"
+)
+
+// Valor de HostResult.Trigger e Summary.Trigger dos scans disparados por um
+// trap.
+const triggerTrap = "trap"
+
+// Traps aguardando o loop do daemon; com o canal cheio o trap é descartado.
+const trapQueue = 1000
+
+// SNMPTrap configura o receptor de traps do -daemon: um trap aceito de um IP
+// dos ranges locais (fora dos agent_ranges) coloca só esse IP num scan
+// dirigido, com o pipeline normal, em vez de esperar o próximo ciclo.
+type SNMPTrap struct {
+	Listen string `json:"listen,omitempty" yaml:"listen" toml:"listen"` // endereço UDP, como 0.0.0.0:162; vazio desliga
+	// Communities aceitas em v1 e v2c; sem nenhuma, só v3
+	Communities []string       `json:"communities,omitempty" yaml:"communities" toml:"communities"`
+	Users       []SNMPTrapUser `json:"users,omitempty" yaml:"users" toml:"users"` // usuários v3 aceitos
+	// Um IP já colocado num scan por trap é ignorado por esse tempo
+	DedupWindow Duration `json:"dedup_window" yaml:"dedup_window" toml:"dedup_window"`
+	// Traps aceitos por origem por minuto; 0 para nenhum limite
+	RateLimit int `json:"rate_limit" yaml:"rate_limit" toml:"rate_limit"`
+	// Espera após o primeiro trap para juntar os seguintes num só scan
+	BatchDelay Duration `json:"batch_delay" yaml:"batch_delay" toml:"batch_delay"`
+	// IPs por scan; os demais ficam para o scan seguinte
+	MaxBatch int `json:"max_batch" yaml:"max_batch" toml:"max_batch"`
+}
+
+// SNMPTrapUser é um usuário SNMPv3: sem auth_protocol é noAuthNoPriv, sem
+// priv_protocol é authNoPriv.
+type SNMPTrapUser struct {
+	User         string `json:"user" yaml:"user" toml:"user"`
+	AuthProtocol string `json:"auth_protocol,omitempty" yaml:"auth_protocol" toml:"auth_protocol"` // md5, sha, sha224, sha256, sha384 ou sha512
+	AuthPassword string `json:"auth_password,omitempty" yaml:"auth_password" toml:"auth_password"`
+	PrivProtocol string `json:"priv_protocol,omitempty" yaml:"priv_protocol" toml:"priv_protocol"` // des, aes, aes192, aes256, aes192c ou aes256c
+	PrivPassword string `json:"priv_password,omitempty" yaml:"priv_password" toml:"priv_password"`
+}
+
+func (t SNMPTrap) validate(c Config) []error {
+	if t.Listen == "" {
+		return nil
+	}
+	var errs []error
+	if _, _, err := net.SplitHostPort(t.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("snmp_trap.listen deve ser host:porta (atual: %q)%s", t.Listen, c.origin("snmp_trap.listen")))
+	}
+	if len(t.Communities) == 0 && len(t.Users) == 0 {
+		errs = append(errs, fmt.Errorf("snmp_trap: defina communities ou users para validar os traps%s", c.origin("snmp_trap")))
+	}
+	for i, community := range t.Communities {
+		if community == "" {
+			errs = append(errs, fmt.Errorf("snmp_trap.communities[%d] não pode ser vazia%s", i, c.origin("snmp_trap.communities")))
+		}
+	}
+	seen := map[string]bool{}
+	for i, u := range t.Users {
+		key := fmt.Sprintf("snmp_trap.users[%d]", i)
+		switch {
+		case strings.TrimSpace(u.User) == "":
+			errs = append(errs, fmt.Errorf("%s.user não pode ser vazio%s", key, c.origin(key)))
+		case seen[u.User]:
+			errs = append(errs, fmt.Errorf("snmp_trap.users: usuário %s repetido%s", u.User, c.origin(key)))
+		}
+		seen[u.User] = true
+		if u.AuthProtocol != "" && !snmptrap.ValidAuthProtocol(u.AuthProtocol) {
+			errs = append(errs, fmt.Errorf("%s.auth_protocol desconhecido: %q (use md5, sha, sha224, sha256, sha384 ou sha512)%s", key, u.AuthProtocol, c.origin(key)))
+		}
+		if u.PrivProtocol != "" && !snmptrap.ValidPrivProtocol(u.PrivProtocol) {
+			errs = append(errs, fmt.Errorf("%s.priv_protocol desconhecido: %q (use des, aes, aes192, aes256, aes192c ou aes256c)%s", key, u.PrivProtocol, c.origin(key)))
+		}
+		if (u.AuthProtocol == "") != (u.AuthPassword == "") {
+			errs = append(errs, fmt.Errorf("%s: auth_protocol e auth_password devem ser definidos juntos%s", key, c.origin(key)))
+		}
+		if (u.PrivProtocol == "") != (u.PrivPassword == "") {
+			errs = append(errs, fmt.Errorf("%s: priv_protocol e priv_password devem ser definidos juntos%s", key, c.origin(key)))
+		}
+		if u.PrivProtocol != "" && u.AuthProtocol == "" {
+			errs = append(errs, fmt.Errorf("%s: priv_protocol requer auth_protocol%s", key, c.origin(key)))
+		}
+		// Mínimo do RFC 3414 para a geração das chaves
+		for _, p := range []string{u.AuthPassword, u.PrivPassword} {
+			if p != "" && len(p) < 8 {
+				errs = append(errs, fmt.Errorf("%s: as senhas v3 devem ter no mínimo 8 caracteres%s", key, c.origin(key)))
+				break
+			}
+		}
+	}
+	if time.Duration(t.DedupWindow) < 0 {
+		errs = append(errs, fmt.Errorf("snmp_trap.dedup_window não pode ser negativo%s", c.origin("snmp_trap.dedup_window")))
+	}
+	if t.RateLimit < 0 {
+		errs = append(errs, fmt.Errorf("snmp_trap.rate_limit não pode ser negativo (atual: %d)%s", t.RateLimit, c.origin("snmp_trap.rate_limit")))
+	}
+	if time.Duration(t.BatchDelay) < 0 {
+		errs = append(errs, fmt.Errorf("snmp_trap.batch_delay não pode ser negativo%s", c.origin("snmp_trap.batch_delay")))
+	}
+	if t.MaxBatch < 1 {
+		errs = append(errs, fmt.Errorf("snmp_trap.max_batch deve ser no mínimo 1 (atual: %d)%s", t.MaxBatch, c.origin("snmp_trap.max_batch")))
+	}
+	return errs
+}
+
+func (t SNMPTrap) redacted() SNMPTrap {
+	if t.Communities != nil {
+		communities := make([]string, len(t.Communities))
+		for i, community := range t.Communities {
+			communities[i] = maskSecret(community)
+		}
+		t.Communities = communities
+	}
+	if t.Users != nil {
+		users := make([]SNMPTrapUser, len(t.Users))
+		for i, u := range t.Users {
+			u.AuthPassword = maskSecret(u.AuthPassword)
+			u.PrivPassword = maskSecret(u.PrivPassword)
+			users[i] = u
+		}
+		t.Users = users
+	}
+	return t
+}
+
+// Abre o receptor; os traps aceitos vão para traps, descartados com o canal
+// cheio.
+func (t SNMPTrap) listen(traps chan<- snmptrap.Trap) (*snmptrap.Listener, error) {
+	cfg := snmptrap.Config{
+		Addr:        t.Listen,
+		Communities: t.Communities,
+		RateLimit:   t.RateLimit,
+		OnTrap: func(trap snmptrap.Trap) {
+			select {
+			case traps <- trap:
+			default:
+				logWarn("trap.queue_full", trap.Addr, trapQueue)
+			}
+		},
+		OnReject: func(sender, reason string, first bool) {
+			if reason == snmptrap.RejectRate {
+				if first {
+					logWarn("trap.rate_limited", sender, t.RateLimit)
+				}
+				return
+			}
+			rootLog.With("ip", sender).With("stage", "trap").Debugf("trap.rejected", sender, reason)
+		},
+	}
+	for _, u := range t.Users {
+		cfg.Users = append(cfg.Users, snmptrap.User{
+			Name:         u.User,
+			AuthProtocol: u.AuthProtocol,
+			AuthPassword: u.AuthPassword,
+			PrivProtocol: u.PrivProtocol,
+			PrivPassword: u.PrivPassword,
+		})
+	}
+	return snmptrap.Listen(cfg)
+}
+
+// Traps do daemon: os IPs aguardando um scan e quando cada um entrou na fila,
+// para a janela de dedup. Alterado só pelo loop do daemon.
+type trapState struct {
+	cfg    SNMPTrap
+	ranges map[string]string // IP -> range local, dos ranges do último ciclo
+	queued []string
+	seen   map[string]time.Time
+}
+
+// Índice dos IPs dos ranges locais da configuração (traps e -target), sem os
+// de agent_ranges e os reservados no phpIPAM. Um range inválido fica de fora
+// (o ciclo vai reportar o erro).
+func localRangeIndex(cfg Config) map[string]string {
+	index := map[string]string{}
+	for _, r := range cfg.Ranges {
+		r = strings.TrimSpace(r)
+		if _, remote := cfg.AgentRanges[r]; remote {
+			continue
+		}
+		ips, err := iprange.Expand(r)
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			if _, dup := index[ip]; !dup && !cfg.excluded[ip] {
+				index[ip] = r
+			}
+		}
+	}
+	return index
+}
+
+// Coloca o IP do trap na fila do próximo scan, se ele estiver nos ranges e
+// não tiver entrado na fila dentro de dedup_window. Retorna se entrou.
+func (s *trapState) add(t snmptrap.Trap) bool {
+	hl := rootLog.With("ip", t.Addr).With("stage", "trap")
+	rng, ok := s.ranges[t.Addr]
+	if !ok {
+		hl.Debugf("trap.out_of_range", t.Addr, t.Sender, t.Version)
+		return false
+	}
+	now := time.Now()
+	if at, ok := s.seen[t.Addr]; ok && now.Sub(at) < time.Duration(s.cfg.DedupWindow) {
+		hl.Debugf("trap.duplicate", t.Addr, at.Format(time.RFC3339))
+		return false
+	}
+	s.seen[t.Addr] = now
+	s.queued = append(s.queued, t.Addr)
+	hl.Infof("trap.queued", t.Addr, rng, t.Version, t.OID)
+	return true
+}
+
+// Tira da fila até max_batch IPs para um scan, descartando da janela de
+// dedup os que já venceram.
+func (s *trapState) take() []string {
+	now := time.Now()
+	for ip, at := range s.seen {
+		if now.Sub(at) >= time.Duration(s.cfg.DedupWindow) {
+			delete(s.seen, ip)
+		}
+	}
+	n := min(len(s.queued), s.cfg.MaxBatch)
+	batch := s.queued[:n:n]
+	s.queued = s.queued[n:]
+	return batch
+}
@@ -0,0 +1,285 @@
+// Package snmptrap recebe traps SNMP (v1, v2c e v3) em UDP, valida a
+// community ou o usuário v3 e limita os traps aceitos por origem.
+package snmptrap
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// Janela do limite de traps por origem.
+const rateWindow = time.Minute
+
+// snmpTrapAddress.0: endereço do agente que gerou o trap, incluído pelos
+// relays que repassam traps v2c e v3.
+const oidTrapAddress = ".1.3.6.1.6.3.18.1.3.0"
+
+// snmpTrapOID.0: identificação do trap nas versões 2c e 3.
+const oidTrapOID = ".1.3.6.1.6.3.1.1.4.1.0"
+
+// Motivos de recusa de um trap, passados a Config.OnReject.
+const (
+	RejectCommunity = "community"   // v1/v2c com community desconhecida
+	RejectVersion   = "version"     // v3 sem usuários configurados
+	RejectSecurity  = "security"    // v3 com nível de segurança abaixo do configurado
+	RejectRate      = "rate_limit"  // origem acima de RateLimit
+	RejectAddress   = "bad_address" // sem um IPv4 de origem
+)
+
+// User é um usuário SNMPv3 aceito. Sem AuthProtocol o usuário é
+// noAuthNoPriv; sem PrivProtocol, authNoPriv.
+type User struct {
+	Name         string
+	AuthProtocol string // md5, sha, sha224, sha256, sha384 ou sha512
+	AuthPassword string
+	PrivProtocol string // des, aes, aes192, aes256, aes192c ou aes256c
+	PrivPassword string
+}
+
+var authProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"md5":    gosnmp.MD5,
+	"sha":    gosnmp.SHA,
+	"sha224": gosnmp.SHA224,
+	"sha256": gosnmp.SHA256,
+	"sha384": gosnmp.SHA384,
+	"sha512": gosnmp.SHA512,
+}
+
+var privProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"des":     gosnmp.DES,
+	"aes":     gosnmp.AES,
+	"aes192":  gosnmp.AES192,
+	"aes256":  gosnmp.AES256,
+	"aes192c": gosnmp.AES192C,
+	"aes256c": gosnmp.AES256C,
+}
+
+// ValidAuthProtocol indica se o protocolo de autenticação é aceito.
+func ValidAuthProtocol(p string) bool {
+	_, ok := authProtocols[strings.ToLower(p)]
+	return ok
+}
+
+// ValidPrivProtocol indica se o protocolo de privacidade é aceito.
+func ValidPrivProtocol(p string) bool {
+	_, ok := privProtocols[strings.ToLower(p)]
+	return ok
+}
+
+// Nível de segurança exigido do usuário.
+func (u User) flags() gosnmp.SnmpV3MsgFlags {
+	switch {
+	case u.PrivProtocol != "":
+		return gosnmp.AuthPriv
+	case u.AuthProtocol != "":
+		return gosnmp.AuthNoPriv
+	}
+	return gosnmp.NoAuthNoPriv
+}
+
+func (u User) params() *gosnmp.UsmSecurityParameters {
+	sp := &gosnmp.UsmSecurityParameters{UserName: u.Name, AuthenticationProtocol: gosnmp.NoAuth, PrivacyProtocol: gosnmp.NoPriv}
+	if u.AuthProtocol != "" {
+		sp.AuthenticationProtocol = authProtocols[strings.ToLower(u.AuthProtocol)]
+		sp.AuthenticationPassphrase = u.AuthPassword
+	}
+	if u.PrivProtocol != "" {
+		sp.PrivacyProtocol = privProtocols[strings.ToLower(u.PrivProtocol)]
+		sp.PrivacyPassphrase = u.PrivPassword
+	}
+	return sp
+}
+
+// Trap é um trap aceito.
+type Trap struct {
+	Addr    string // IPv4 do equipamento: o snmpTrapAddress ou o agent-addr do v1, se houver, senão Sender
+	Sender  string // IPv4 de onde veio o pacote
+	Version string // 1, 2c ou 3
+	OID     string // snmpTrapOID (ou o enterprise do v1), se houver
+}
+
+// Config configura o Listener.
+type Config struct {
+	Addr        string   // endereço UDP, como 0.0.0.0:162
+	Communities []string // aceitas em v1 e v2c; vazio recusa essas versões
+	Users       []User   // aceitos em v3; vazio recusa v3
+	// Traps aceitos por origem (Sender) por minuto; os demais são recusados
+	// com RejectRate até o fim da janela. Zero para nenhum limite.
+	RateLimit int
+
+	// OnTrap recebe os traps aceitos, e OnReject os recusados; first indica a
+	// primeira recusa por limite da origem na janela, para um único aviso.
+	// Chamados pelo goroutine do Listener.
+	OnTrap   func(Trap)
+	OnReject func(sender, reason string, first bool)
+}
+
+// Contagem da janela de uma origem.
+type window struct {
+	start time.Time
+	n     int
+}
+
+// Listener recebe traps até Close.
+type Listener struct {
+	cfg       Config
+	tl        *gosnmp.TrapListener
+	users     map[string]User
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastPurge time.Time
+}
+
+// Listen abre o endereço e começa a receber traps num goroutine próprio.
+func Listen(cfg Config) (*Listener, error) {
+	l := &Listener{cfg: cfg, users: map[string]User{}, windows: map[string]*window{}}
+	params := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Timeout: 2 * time.Second}
+	if len(cfg.Users) > 0 {
+		table := gosnmp.NewSnmpV3SecurityParametersTable(params.Logger)
+		for _, u := range cfg.Users {
+			if err := table.Add(u.Name, u.params()); err != nil {
+				return nil, fmt.Errorf("usuário v3 %s: %w", u.Name, err)
+			}
+			l.users[u.Name] = u
+		}
+		params.TrapSecurityParametersTable = table
+		// Sem a versão 3 a autenticação dos traps v3 falha; v1 e v2c seguem
+		// aceitos, pela versão do pacote
+		params.Version = gosnmp.Version3
+	}
+	l.tl = gosnmp.NewTrapListener()
+	l.tl.Params = params
+	l.tl.OnNewTrap = l.handle
+	errc := make(chan error, 1)
+	go func() { errc <- l.tl.Listen(cfg.Addr) }()
+	select {
+	case <-l.tl.Listening():
+		return l, nil
+	case err := <-errc:
+		if err == nil {
+			err = fmt.Errorf("listener encerrado")
+		}
+		return nil, err
+	}
+}
+
+// Close para de receber traps.
+func (l *Listener) Close() {
+	l.tl.Close()
+}
+
+func (l *Listener) reject(sender, reason string, first bool) {
+	if l.cfg.OnReject != nil {
+		l.cfg.OnReject(sender, reason, first)
+	}
+}
+
+func (l *Listener) handle(p *gosnmp.SnmpPacket, addr *net.UDPAddr) {
+	sender := ""
+	if addr != nil && addr.IP.To4() != nil {
+		sender = addr.IP.To4().String()
+	}
+	if sender == "" {
+		l.reject(addr.String(), RejectAddress, false)
+		return
+	}
+	t := Trap{Addr: sender, Sender: sender}
+	switch p.Version {
+	case gosnmp.Version1, gosnmp.Version2c:
+		if !l.community(p.Community) {
+			l.reject(sender, RejectCommunity, false)
+			return
+		}
+		t.Version = "2c"
+		if p.Version == gosnmp.Version1 {
+			t.Version = "1"
+			t.OID = p.Enterprise
+			if ip := net.ParseIP(p.AgentAddress).To4(); ip != nil && !ip.IsUnspecified() {
+				t.Addr = ip.String()
+			}
+		}
+	case gosnmp.Version3:
+		if len(l.users) == 0 {
+			l.reject(sender, RejectVersion, false)
+			return
+		}
+		// A tabela de usuários já recusou os usuários desconhecidos e as
+		// senhas erradas; falta o nível de segurança do usuário
+		sp, _ := p.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+		u, ok := User{}, false
+		if sp != nil {
+			u, ok = l.users[sp.UserName]
+		}
+		if !ok || p.MsgFlags&gosnmp.AuthPriv < u.flags() {
+			l.reject(sender, RejectSecurity, false)
+			return
+		}
+		t.Version = "3"
+	default:
+		l.reject(sender, RejectVersion, false)
+		return
+	}
+	for _, v := range p.Variables {
+		switch v.Name {
+		case oidTrapOID:
+			if s, ok := v.Value.(string); ok {
+				t.OID = s
+			}
+		case oidTrapAddress:
+			if s, ok := v.Value.(string); ok {
+				if ip := net.ParseIP(s).To4(); ip != nil && !ip.IsUnspecified() {
+					t.Addr = ip.String()
+				}
+			}
+		}
+	}
+	if ok, first := l.allow(sender); !ok {
+		l.reject(sender, RejectRate, first)
+		return
+	}
+	if l.cfg.OnTrap != nil {
+		l.cfg.OnTrap(t)
+	}
+}
+
+func (l *Listener) community(c string) bool {
+	for _, want := range l.cfg.Communities {
+		if c == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Conta o trap na janela da origem. Retorna se ele é aceito e, se não for,
+// se é a primeira recusa da janela.
+func (l *Listener) allow(sender string) (ok, first bool) {
+	if l.cfg.RateLimit <= 0 {
+		return true, false
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Janelas vencidas saem de tempos em tempos, para o mapa não crescer
+	// com as origens que pararam de mandar traps
+	if now.Sub(l.lastPurge) > rateWindow {
+		for s, w := range l.windows {
+			if now.Sub(w.start) > rateWindow {
+				delete(l.windows, s)
+			}
+		}
+		l.lastPurge = now
+	}
+	w := l.windows[sender]
+	if w == nil || now.Sub(w.start) > rateWindow {
+		w = &window{start: now}
+		l.windows[sender] = w
+	}
+	w.n++
+	return w.n <= l.cfg.RateLimit, w.n == l.cfg.RateLimit+1
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/zabbix"
+)
+
+// Formatos de -output, o que vai na saída padrão.
+const (
+	outputTable  = "table"  // tabela dos hosts e contadores do run, no fim
+	outputJSON   = "json"   // o documento do -output-json, no fim
+	outputCSV    = "csv"    // as linhas do -output-csv, no fim
+	outputNDJSON = "ndjson" // um host por linha ao ser concluído
+)
+
+// Largura mínima do sysDescr na tabela, mesmo num terminal estreito.
+const tableMinDescr = 20
+
+// Hosts em ordem de IP.
+func sortByIP(hosts []discovery.HostResult) []discovery.HostResult {
+	sorted := append([]discovery.HostResult(nil), hosts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(sorted[i].IP).To4(), net.ParseIP(sorted[j].IP).To4()) < 0
+	})
+	return sorted
+}
+
+// Escreve o resultado do run na saída padrão no close, no formato do -output
+// (table, json ou csv). Os hosts ficam em memória até lá.
+type stdoutSink struct {
+	format string
+	cfg    Config
+	dryRun bool
+	out    *os.File
+	hosts  []discovery.HostResult
+}
+
+func newStdoutSink(format string, cfg Config, dryRun bool) *stdoutSink {
+	return &stdoutSink{format: format, cfg: cfg, dryRun: dryRun, out: os.Stdout}
+}
+
+func (s *stdoutSink) write(r discovery.HostResult) error {
+	s.hosts = append(s.hosts, r)
+	return nil
+}
+
+func (s *stdoutSink) close(sum discovery.Summary) error {
+	w := bufio.NewWriter(s.out)
+	switch s.format {
+	case outputJSON:
+		hosts := make([]jsonHost, len(s.hosts))
+		for i, r := range s.hosts {
+			hosts[i] = newJSONHost(r)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			SchemaVersion int        `json:"schema_version"`
+			Run           jsonRun    `json:"run"`
+			Hosts         []jsonHost `json:"hosts"`
+		}{resultsSchemaVersion, newJSONRun(sum, s.cfg, s.dryRun), hosts}); err != nil {
+			return err
+		}
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for _, r := range s.hosts {
+			cw.Write(csvRecord(r))
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	default:
+		s.writeTable(w, sum)
+	}
+	return w.Flush()
+}
+
+// Tabela dos hosts em ordem de IP, seguida dos contadores. Num terminal as
+// colunas são alinhadas, o sysDescr é cortado na largura da tela e as falhas
+// e os criados ganham cor; fora dele, as colunas vão separadas por tab, sem
+// cortes nem cores.
+func (s *stdoutSink) writeTable(w *bufio.Writer, sum discovery.Summary) {
+	color := colorFor(s.out)
+	header := []string{"IP", "NOME", "RANGE", "SNMP", "ZABBIX", "TEMPO", "SYSDESCR"}
+	var rows [][]string
+	for _, r := range sortByIP(s.hosts) {
+		snmp := r.SNMP.Version
+		if r.SNMPErr != nil {
+			snmp = "falha:" + r.SNMPReason
+		}
+		rows = append(rows, []string{
+			r.IP,
+			dashIfEmpty(r.Name()),
+			r.Range,
+			dashIfEmpty(snmp),
+			dashIfEmpty(r.ZabbixAction),
+			r.Duration().Round(time.Millisecond).String(),
+			strings.Join(strings.Fields(r.SNMP.SysDescr), " "),
+		})
+	}
+
+	if !isTerminal(s.out) {
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+	} else {
+		last := len(header) - 1
+		widths := make([]int, len(header))
+		for _, row := range append([][]string{header}, rows...) {
+			for i, v := range row[:last] {
+				widths[i] = max(widths[i], utf8.RuneCountInString(v))
+			}
+		}
+		// O sysDescr fica com o que sobrar da linha
+		descr := 0
+		if cols := terminalWidth(s.out); cols > 0 {
+			descr = cols
+			for _, n := range widths[:last] {
+				descr -= n + 2
+			}
+			descr = max(descr, tableMinDescr)
+		}
+		line := func(row []string) {
+			for i, v := range row[:last] {
+				fmt.Fprintf(w, "%s%s  ", paint(color, cellColor(i, v), v), strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v)))
+			}
+			fmt.Fprintln(w, truncateRunes(row[last], descr))
+		}
+		line(header)
+		rule := make([]string, len(header))
+		for i := range rule {
+			rule[i] = strings.Repeat("-", max(widths[i], utf8.RuneCountInString(header[i])))
+		}
+		line(rule)
+		for _, row := range rows {
+			line(row)
+		}
+	}
+
+	fmt.Fprintf(w, "\nalvos: %d expandidos, %d verificados, %d responderam\n", sum.TargetsExpanded, sum.Scanned, sum.Alive)
+	fmt.Fprintf(w, "snmp: %d ok, %d falhas\n", sum.SNMPOK, sum.SNMPFailures())
+	created, errs := strconv.Itoa(sum.HostsCreated), fmt.Sprintf("%d erros", sum.ZabbixErrors)
+	if sum.HostsCreated > 0 {
+		created = paint(color, colorGreen, created)
+	}
+	if sum.ZabbixErrors > 0 {
+		errs = paint(color, colorRed, errs)
+	}
+	fmt.Fprintf(w, "cadastro: %s criados, %d já existentes, %s", created, sum.HostsExisting, errs)
+	if s.dryRun {
+		fmt.Fprintf(w, ", %d não cadastrados (dry-run)", sum.HostsDryRun)
+	}
+	if sum.HostsFiltered > 0 {
+		fmt.Fprintf(w, ", %d filtrados", sum.HostsFiltered)
+	}
+	if sum.HostsLimited > 0 {
+		fmt.Fprintf(w, ", %d não cadastrados (limite de %d atingido)", sum.HostsLimited, sum.CreateLimit)
+	}
+	fmt.Fprintf(w, "\ntempo: %s\n", sum.Elapsed().Round(time.Millisecond))
+}
+
+// Cor de uma célula da tabela no terminal: falhas do SNMP em amarelo, do
+// cadastro em vermelho e os hosts criados em verde.
+func cellColor(col int, v string) termColor {
+	switch {
+	case col == 3 && strings.HasPrefix(v, "falha:"):
+		return colorYellow
+	case col == 4 && (v == zabbix.Failed || v == discovery.ZabbixPartial):
+		return colorRed
+	case col == 4 && v == zabbix.Created:
+		return colorGreen
+	}
+	return ""
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Corta s em n caracteres, com reticências; n zero não corta.
+func truncateRunes(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/i18n"
+)
+
+// Linha do resumo: código do catálogo e argumentos.
+type summaryLine struct {
+	code string
+	args []interface{}
+}
+
+// Linhas do resumo final, escritas no log e usadas no corpo do e-mail.
+func summaryLines(s discovery.Summary) []summaryLine {
+	failed := i18n.T("summary.snmp_no_failures")
+	if len(s.SNMPFailed) > 0 {
+		reasons := make([]string, 0, len(s.SNMPFailed))
+		for reason, n := range s.SNMPFailed {
+			reasons = append(reasons, fmt.Sprintf("%s: %d", reason, n))
+		}
+		sort.Strings(reasons)
+		failed = i18n.T("summary.snmp_failures", s.SNMPFailures(), strings.Join(reasons, ", "))
+	}
+	pingFailed := make([]string, 0, len(s.PingFailed))
+	for reason, n := range s.PingFailed {
+		pingFailed = append(pingFailed, fmt.Sprintf("%s: %d", reason, n))
+	}
+	sort.Strings(pingFailed)
+	round := func(d time.Duration) time.Duration { return d.Round(time.Millisecond) }
+	line := func(code string, args ...interface{}) summaryLine { return summaryLine{code, args} }
+	var lines []summaryLine
+	if s.Trigger != "" {
+		lines = append(lines, line("summary.trigger", s.Trigger, s.TargetsExpanded))
+	}
+	if s.RetryOf != "" {
+		lines = append(lines, line("summary.recovered", s.RetryOf, s.HostsRecovered, s.Scanned))
+	}
+	if s.Interrupted {
+		lines = append(lines, line("summary.interrupted", s.Scanned, s.TargetsExpanded))
+	}
+	if s.Panics > 0 {
+		lines = append(lines, line("summary.panics", s.Panics))
+	}
+	if s.Aborted {
+		lines = append(lines, line("summary.aborted", s.AbortCause))
+	}
+	if s.DeadlineReached {
+		lines = append(lines, line("summary.deadline", s.NotScanned(), s.TargetsExpanded))
+	}
+	lines = append(lines,
+		line("summary.targets", s.TargetsExpanded, s.TargetsExcluded, s.Scanned),
+		line("summary.ping", s.Alive),
+	)
+	if len(pingFailed) > 0 {
+		lines = append(lines, line("summary.ping_failures", s.PingFailures(), strings.Join(pingFailed, ", ")))
+	}
+	lines = append(lines, line("summary.snmp", s.SNMPOK, failed))
+	if s.TargetsInvalid > 0 {
+		lines = append(lines, line("summary.invalid_targets", s.TargetsInvalid))
+	}
+	if s.TargetsSelf > 0 {
+		lines = append(lines, line("summary.self_targets", s.TargetsSelf))
+	}
+	if s.TargetsDuplicate > 0 {
+		lines = append(lines, line("summary.duplicate_targets", s.TargetsDuplicate))
+	}
+	switch {
+	case s.HostsDryRun > 0:
+		lines = append(lines, line("summary.zabbix_dry_run", s.HostsDryRun))
+	case len(s.Targets) > 0:
+		// Uma linha por servidor, logo abaixo
+	case s.HostsSkipped == 0 || s.HostsCreated+s.HostsExisting+s.ZabbixErrors > 0:
+		lines = append(lines, line("summary.zabbix", s.HostsCreated, s.HostsExisting, s.ZabbixErrors))
+	}
+	if s.HostsSkipped > 0 {
+		lines = append(lines, line("summary.zabbix_skipped", s.HostsSkipped))
+	}
+	if s.HostsKnown > 0 {
+		lines = append(lines, line("summary.known", s.HostsKnown))
+	}
+	if s.HostsLimited > 0 {
+		lines = append(lines, line("summary.limit_reached", s.CreateLimit, s.HostsLimited))
+	}
+	if s.HostsFiltered > 0 {
+		lines = append(lines, line("summary.filtered", s.HostsFiltered))
+	}
+	for _, t := range s.Targets {
+		if t.DryRun > 0 && t.Created+t.Existing+t.Upgraded+t.Errors == 0 {
+			lines = append(lines, line("summary.target_dry_run", t.Target, t.DryRun))
+			continue
+		}
+		lines = append(lines, line("summary.zabbix_target", t.Target, t.Created, t.Existing, t.Upgraded, t.Errors))
+	}
+	if s.HostsPartial > 0 {
+		lines = append(lines, line("summary.zabbix_partial", s.HostsPartial))
+	}
+	if s.HostsFallback > 0 || s.HostsUpgraded > 0 {
+		lines = append(lines, line("summary.fallback", s.HostsFallback, s.HostsUpgraded))
+	}
+	if s.PortScanned > 0 {
+		open := openPortsText(s.OpenPorts)
+		if open == "" {
+			open = i18n.T("summary.portscan_none")
+		}
+		lines = append(lines, line("summary.portscan", s.PortScanned, open))
+	}
+	if s.HostsCached > 0 {
+		lines = append(lines, line("summary.cached", s.HostsCached))
+	}
+	if s.HostsRetried > 0 {
+		lines = append(lines, line("summary.retries", s.HostsRetried, s.RetriesOK))
+	}
+	if s.HostsTimedOut > 0 {
+		lines = append(lines, line("summary.timed_out", s.HostsTimedOut))
+	}
+	lines = append(lines, line("summary.time",
+		round(s.Elapsed()), round(s.PingTime), round(s.SNMPTime), round(s.ZabbixTime)))
+	for _, st := range s.Stages {
+		lines = append(lines, line("summary.stage", st.Stage, st.Workers, st.Processed, st.Errors,
+			st.Throughput(s.Elapsed()), 100*st.Utilization(s.Elapsed())))
+		if st.QueueSize > 0 {
+			lines = append(lines, line("summary.stage_queue", st.Stage, st.QueuePeak, st.QueueSize))
+		}
+	}
+	if len(s.Ranges) > 1 {
+		for _, rc := range s.Ranges {
+			if rc.Order == 0 {
+				lines = append(lines, line("summary.range_unfinished", rc.Range, rc.Scanned, rc.Targets, rc.Alive))
+				continue
+			}
+			lines = append(lines, line("summary.range", rc.Range, rc.Scanned, rc.Targets, rc.Alive, round(rc.Duration), rc.Order))
+		}
+	}
+	for _, a := range s.Agents {
+		if a.Error != "" {
+			lines = append(lines, line("summary.agent_failed", a.Name, a.Scanned, a.Targets, a.Error))
+			continue
+		}
+		lines = append(lines, line("summary.agent", a.Name, a.Scanned, a.Targets, strings.Join(a.Ranges, ", ")))
+	}
+	lines = append(lines, concurrencyLines(s)...)
+	for _, stage := range []struct {
+		name  string
+		hosts []discovery.HostTiming
+	}{{"ping", s.SlowestPing}, {"SNMP", s.SlowestSNMP}, {"Zabbix", s.SlowestZabbix}} {
+		if len(stage.hosts) == 0 {
+			continue
+		}
+		hosts := make([]string, len(stage.hosts))
+		for i, h := range stage.hosts {
+			hosts[i] = fmt.Sprintf("%s (%s)", h.IP, round(h.Duration))
+		}
+		lines = append(lines, line("summary.slowest", stage.name, strings.Join(hosts, ", ")))
+	}
+	return lines
+}
+
+// Perfil dos workers ativos de cada etapa no modo adaptativo, uma linha por
+// etapa: "4 (0s) -> 5 (30s) -> 2 (1m30s)".
+func concurrencyLines(s discovery.Summary) []summaryLine {
+	var order []string
+	profile := map[string][]string{}
+	peak := map[string]int{}
+	for _, c := range s.Concurrency {
+		if _, ok := profile[c.Stage]; !ok {
+			order = append(order, c.Stage)
+		}
+		profile[c.Stage] = append(profile[c.Stage], fmt.Sprintf("%d (%s)", c.Workers, c.At.Round(time.Second)))
+		peak[c.Stage] = max(peak[c.Stage], c.Workers)
+	}
+	lines := make([]summaryLine, len(order))
+	for i, stage := range order {
+		lines[i] = summaryLine{"summary.concurrency", []interface{}{stage, strings.Join(profile[stage], " -> "), peak[stage]}}
+	}
+	return lines
+}
+
+// Escreve o resumo no log, uma linha por etapa.
+func logSummary(s discovery.Summary) {
+	for _, l := range summaryLines(s) {
+		rootLog.Summaryf(l.code, l.args...)
+	}
+}
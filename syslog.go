@@ -0,0 +1,104 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"net/url"
+	"strings"
+
+	"discoveryhosts/logx"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL,
+	"daemon": syslog.LOG_DAEMON, "auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG,
+	"authpriv": syslog.LOG_AUTHPRIV, "cron": syslog.LOG_CRON,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3, "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+func validSyslogFacility(name string) bool {
+	_, ok := syslogFacilities[strings.ToLower(name)]
+	return ok
+}
+
+// Conecta ao syslog: o daemon local (/dev/log) com address vazio, ou um
+// servidor remoto em udp://host:porta ou tcp://host:porta.
+func dialSyslog(address, facility string) (slog.Handler, error) {
+	priority, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("facility de syslog desconhecida: %s", facility)
+	}
+	network, raddr := "", ""
+	if address != "" {
+		u, err := url.Parse(address)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return nil, fmt.Errorf("syslog_address inválido: %s (use udp://host:porta ou tcp://host:porta)", address)
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+	w, err := syslog.Dial(network, raddr, priority|syslog.LOG_INFO, "discoveryhosts")
+	if err != nil {
+		return nil, fmt.Errorf("falha ao conectar ao syslog: %w", err)
+	}
+	return &syslogHandler{w: w, level: logLevel}, nil
+}
+
+// Handler que envia cada evento ao syslog com a severidade correspondente
+// ao nível, no mesmo texto "[TAG] mensagem" da saída padrão.
+type syslogHandler struct {
+	w     *syslog.Writer
+	level slog.Leveler
+	stage string
+	runID string
+}
+
+func (h *syslogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *syslogHandler) Handle(_ context.Context, r slog.Record) error {
+	stage := h.stage
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "stage" {
+			stage = a.Value.String()
+		}
+		return true
+	})
+	msg := textTag(r.Level, stage) + " " + r.Message
+	if h.runID != "" {
+		msg = h.runID + " " + msg
+	}
+	switch {
+	case r.Level >= logx.LevelSummary:
+		return h.w.Notice(msg)
+	case r.Level >= slog.LevelError:
+		return h.w.Err(msg)
+	case r.Level >= slog.LevelWarn:
+		return h.w.Warning(msg)
+	case r.Level >= slog.LevelInfo:
+		return h.w.Info(msg)
+	default:
+		return h.w.Debug(msg)
+	}
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	for _, a := range attrs {
+		switch a.Key {
+		case "stage":
+			c.stage = a.Value.String()
+		case "run_id":
+			c.runID = a.Value.String()
+		}
+	}
+	return &c
+}
+
+func (h *syslogHandler) WithGroup(string) slog.Handler { return h }
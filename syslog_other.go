@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+func validSyslogFacility(string) bool { return true }
+
+func dialSyslog(address, facility string) (slog.Handler, error) {
+	return nil, fmt.Errorf("syslog não é suportado neste sistema operacional")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"discoveryhosts/discovery"
+)
+
+// Valor de HostResult.Trigger e Summary.Trigger dos scans de -target.
+const triggerTarget = "target"
+
+// Confere os IPs de -target, normalizados.
+func parseTargets(targets []string) ([]string, error) {
+	var ips []string
+	for _, t := range targets {
+		ip := net.ParseIP(strings.TrimSpace(t)).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("-target deve ser um endereço IPv4 (atual: %q)", t)
+		}
+		ips = append(ips, ip.String())
+	}
+	return ips, nil
+}
+
+// Configuração do scan de -target: no lugar dos ranges ficam só os ranges
+// locais que contêm os alvos, para valerem as opções por range, e cada alvo
+// fora deles vira um range de um IP. Sem phpIPAM, agentes e snapshot_file,
+// que descreveriam o run inteiro.
+func (c Config) withTargets(targets []string) Config {
+	index := localRangeIndex(c)
+	var ranges []string
+	seen := map[string]bool{}
+	for _, ip := range targets {
+		r, ok := index[ip]
+		if !ok {
+			r = ip
+		}
+		if !seen[r] {
+			seen[r] = true
+			ranges = append(ranges, r)
+		}
+	}
+	c.Ranges = ranges
+	c.RangeSources = nil
+	c.AgentRanges = nil
+	c.SnapshotFile = ""
+	return c
+}
+
+// Escreve o rastro de cada host do run, etapa por etapa, com os tempos e os
+// valores SNMP recebidos, para o -verbose.
+type hostTracer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (t *hostTracer) trace(r discovery.HostResult) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (range %s)\n", r.IP, r.Range)
+	if r.Agent != "" {
+		fmt.Fprintf(&b, "  agente:  %s fez o ping e o SNMP\n", r.Agent)
+	}
+	switch {
+	case r.PingErr != nil:
+		fmt.Fprintf(&b, "  ping:    erro (%s) em %s: %v\n", r.PingReason, traceDuration(r.PingTime), r.PingErr)
+	case !r.Alive:
+		fmt.Fprintf(&b, "  ping:    sem resposta em %s\n", traceDuration(r.PingTime))
+	default:
+		fmt.Fprintf(&b, "  ping:    respondeu em %s\n", traceDuration(r.PingTime))
+	}
+	if r.PortScanned {
+		fmt.Fprintf(&b, "  portas:  [%s] abertas em %s\n", joinPorts(r.OpenPorts, ", "), traceDuration(r.ScanTime))
+	}
+	if r.Alive {
+		switch {
+		case r.SNMPErr != nil:
+			fmt.Fprintf(&b, "  snmp:    falha (%s) em %s, %d tentativa(s): %v\n", r.SNMPReason, traceDuration(r.SNMPTime), max(r.Attempts, 1), r.SNMPErr)
+		case r.SNMP.SysName != "" || r.SNMPTime > 0:
+			fmt.Fprintf(&b, "  snmp:    ok em %s, %d tentativa(s), versão %s, community %s\n", traceDuration(r.SNMPTime), max(r.Attempts, 1), r.SNMP.Version, maskSecret(r.SNMP.Community))
+			fmt.Fprintf(&b, "           sysName     %q\n", r.SNMP.SysName)
+			fmt.Fprintf(&b, "           sysDescr    %q\n", r.SNMP.SysDescr)
+			fmt.Fprintf(&b, "           sysObjectID %q\n", r.SNMP.SysObjectID)
+			fmt.Fprintf(&b, "           sysLocation %q\n", r.SNMP.SysLocation)
+		default:
+			fmt.Fprintln(&b, "  snmp:    não consultado")
+		}
+		if r.FallbackName != "" {
+			fmt.Fprintf(&b, "  nome:    %s, pelo DNS reverso\n", r.FallbackName)
+		}
+	}
+	if r.ZabbixAction != "" {
+		line := r.ZabbixAction
+		if r.HostID != "" {
+			line += " (hostid " + r.HostID + ")"
+		}
+		if r.Known != "" {
+			line += ", no known_hosts_file: " + r.Known
+		}
+		fmt.Fprintf(&b, "  zabbix:  %s em %s", line, traceDuration(r.ZabbixTime))
+		if r.ZabbixErr != nil {
+			fmt.Fprintf(&b, ": %v", r.ZabbixErr)
+		}
+		b.WriteString("\n")
+	}
+	for _, tr := range r.Targets {
+		fmt.Fprintf(&b, "  backend: %s %s", tr.Target, tr.Action)
+		if tr.HostID != "" {
+			fmt.Fprintf(&b, " (hostid %s)", tr.HostID)
+		}
+		fmt.Fprintf(&b, " em %s", traceDuration(tr.Time))
+		if tr.Err != nil {
+			fmt.Fprintf(&b, ": %v", tr.Err)
+		}
+		b.WriteString("\n")
+	}
+	if r.TimedOut {
+		fmt.Fprintln(&b, "  interrompido pelo prazo do host")
+	}
+	fmt.Fprintf(&b, "  total:   %s\n", traceDuration(r.Duration()))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	io.WriteString(t.out, b.String())
+}
+
+// Duração arredondada para o rastro.
+func traceDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
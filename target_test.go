@@ -0,0 +1,21 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTargets(t *testing.T) {
+	got, err := parseTargets([]string{"10.0.0.1", " 10.0.0.2 ", "::ffff:10.0.0.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}; !slices.Equal(got, want) {
+		t.Errorf("esperava %v, obteve %v", want, got)
+	}
+	for _, s := range []string{"", "-f", "--help", "10.0.0.1 -f", "10.0.0.1;reboot", "$(id)", "localhost", "2001:db8::1", "10.0.0.0/24"} {
+		if _, err := parseTargets([]string{"10.0.0.1", s}); err == nil {
+			t.Errorf("-target %q: esperava erro", s)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows || plan9
+
+package main
+
+import "os"
+
+// Largura do terminal em colunas; sem suporte nesta plataforma.
+func terminalWidth(*os.File) int {
+	return 0
+}
+
+// Altura do terminal em linhas; sem suporte nesta plataforma.
+func terminalHeight(*os.File) int {
+	return 0
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/i18n"
+)
+
+// Menor terminal em que o painel do -tui cabe; abaixo disso o progresso volta
+// à barra de uma linha.
+const (
+	tuiMinCols = 60
+	tuiMinRows = 20
+)
+
+// Avisos e erros guardados para o painel e repetidos na saída de erro ao fim.
+const tuiMaxWarnings = 100
+
+// Sequências do terminal: tela alternativa e cursor escondido enquanto o
+// painel estiver aberto.
+const (
+	tuiEnter = "\033[?1049h\033[?25l"
+	tuiLeave = "\033[?25h\033[?1049l"
+)
+
+// Painel do -tui: barras por range, contadores, vazão atual de cada etapa e
+// os últimos avisos, redesenhado no lugar a cada segundo. Os números vêm do
+// mesmo discovery.Progress do resumo e das métricas do -serve.
+type tuiDashboard struct {
+	out   *os.File
+	color bool
+
+	mu       sync.Mutex
+	warnings []string
+	hidden   int // avisos que já saíram de warnings
+
+	// Snapshot anterior, para a vazão desde o último desenho
+	prev   map[string]int
+	prevAt time.Time
+	rates  map[string]float64
+}
+
+// Abre o painel na saída padrão, se ela for um terminal com espaço para ele;
+// senão retorna nil e o chamador segue com a barra de sempre.
+func openDashboard() *tuiDashboard {
+	cols, rows := terminalWidth(os.Stdout), terminalHeight(os.Stdout)
+	if cols < tuiMinCols || rows < tuiMinRows {
+		logWarn("tui.too_small", cols, rows, tuiMinCols, tuiMinRows)
+		return nil
+	}
+	d := &tuiDashboard{out: os.Stdout, color: colorStdout, prev: map[string]int{}, rates: map[string]float64{}}
+	fmt.Fprint(d.out, tuiEnter)
+	return d
+}
+
+// Fecha o painel e devolve o terminal como estava, repetindo nele os avisos
+// que o painel mostrou se os logs iam para a saída de erro.
+func (d *tuiDashboard) close(replay bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprint(d.out, tuiLeave)
+	if !replay {
+		return
+	}
+	if d.hidden > 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("tui.warnings_hidden", d.hidden))
+	}
+	for _, w := range d.warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+}
+
+// Guarda uma linha de log de aviso ou erro para o painel.
+func (d *tuiDashboard) warn(line string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.warnings = append(d.warnings, line)
+	if len(d.warnings) > tuiMaxWarnings {
+		d.warnings = d.warnings[1:]
+		d.hidden++
+	}
+}
+
+// Redesenha o painel com o resumo atual.
+func (d *tuiDashboard) draw(s discovery.Summary) {
+	cols, rows := terminalWidth(d.out), terminalHeight(d.out)
+	if cols <= 0 || rows <= 0 {
+		cols, rows = tuiMinCols, tuiMinRows
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.updateRates(s)
+
+	var lines []string
+	add := func(l string) { lines = append(lines, l) }
+	var elapsed time.Duration
+	if !s.Start.IsZero() {
+		elapsed = time.Since(s.Start).Round(time.Second)
+	}
+	add(clip(i18n.T("tui.title", s.RunID, elapsed), cols))
+	add(d.totalLine(s, cols))
+	add(d.countsLine(s))
+	add("")
+
+	// Etapas e avisos têm um mínimo de linhas; os ranges ficam com o resto
+	stageRows := len(s.Stages) + 1
+	free := rows - len(lines) - 1 - (stageRows + 1) - 3
+	add(i18n.T("tui.ranges"))
+	shown := len(s.Ranges)
+	if shown > free {
+		shown = max(free-1, 0)
+	}
+	width := 0
+	for _, r := range s.Ranges[:shown] {
+		width = max(width, utf8.RuneCountInString(r.Range))
+	}
+	width = min(width, cols/3)
+	for _, r := range s.Ranges[:shown] {
+		counts := i18n.T("tui.range_counts", r.Scanned, r.Targets, r.Alive)
+		barWidth := cols - width - len(counts) - 7
+		add("  " + fmt.Sprintf("%-*s", width, clip(r.Range, width)) + " " + bar(r.Scanned, r.Targets, barWidth) + " " + counts)
+	}
+	if n := len(s.Ranges) - shown; n > 0 {
+		add("  " + i18n.T("tui.more_ranges", n))
+	}
+	add("")
+
+	add(fmt.Sprintf("%-10s %10s %10s %12s", i18n.T("tui.stage"), i18n.T("tui.rate"), i18n.T("tui.processed"), i18n.T("tui.queue")))
+	for _, st := range s.Stages {
+		queue := ""
+		if st.QueueSize > 0 {
+			queue = fmt.Sprintf("%d/%d", st.Queued, st.QueueSize)
+		}
+		add(fmt.Sprintf("  %-8s %10.1f %10d %12s", st.Stage, d.rates[st.Stage], st.Processed, queue))
+	}
+	add("")
+
+	add(i18n.T("tui.warnings"))
+	tail := d.warnings[max(len(d.warnings)-(rows-len(lines)), 0):]
+	if len(tail) == 0 {
+		add("  " + i18n.T("tui.no_warnings"))
+	}
+	for _, w := range tail {
+		c := colorYellow
+		if strings.Contains(w, textTag(slog.LevelError, "")) || strings.Contains(w, `"level":"error"`) {
+			c = colorRed
+		}
+		add(paint(d.color, c, clip("  "+w, cols)))
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for i, l := range lines {
+		if i >= rows {
+			break
+		}
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(l + "\033[K")
+	}
+	b.WriteString("\033[J")
+	io.WriteString(d.out, b.String())
+}
+
+// Total do run, com a barra geral, a vazão e o ETA como na barra de uma linha.
+func (d *tuiDashboard) totalLine(s discovery.Summary, cols int) string {
+	line := fmt.Sprintf(" %d/%d", s.Scanned, s.TargetsExpanded)
+	if s.TargetsExpanded > 0 {
+		line += fmt.Sprintf(" (%.1f%%)", float64(s.Scanned)*100/float64(s.TargetsExpanded))
+	}
+	if elapsed := time.Since(s.Start); s.Scanned > 0 && elapsed > 0 {
+		rate := float64(s.Scanned) / elapsed.Seconds()
+		remaining := time.Duration(float64(s.TargetsExpanded-s.Scanned) / rate * float64(time.Second))
+		line += fmt.Sprintf(", %.1f IPs/s, ETA %s", rate, remaining.Round(time.Second))
+	}
+	return bar(s.Scanned, s.TargetsExpanded, cols-utf8.RuneCountInString(line)-1) + line
+}
+
+// Contadores do run, com os criados em verde e os erros em vermelho.
+func (d *tuiDashboard) countsLine(s discovery.Summary) string {
+	created, errs := strconv.Itoa(s.HostsCreated), strconv.Itoa(s.ZabbixErrors)
+	if s.HostsCreated > 0 {
+		created = paint(d.color, colorGreen, created)
+	}
+	if s.ZabbixErrors > 0 {
+		errs = paint(d.color, colorRed, errs)
+	}
+	return i18n.T("tui.counts", s.Alive, s.SNMPOK, created, errs)
+}
+
+// Hosts por segundo de cada etapa desde o desenho anterior.
+func (d *tuiDashboard) updateRates(s discovery.Summary) {
+	now := time.Now()
+	if secs := now.Sub(d.prevAt).Seconds(); !d.prevAt.IsZero() && secs > 0 {
+		for _, st := range s.Stages {
+			d.rates[st.Stage] = float64(st.Processed-d.prev[st.Stage]) / secs
+		}
+	}
+	for _, st := range s.Stages {
+		d.prev[st.Stage] = st.Processed
+	}
+	d.prevAt = now
+}
+
+// Barra [####----] de width colunas com done de total.
+func bar(done, total, width int) string {
+	inner := width - 2
+	if inner < 1 {
+		return ""
+	}
+	filled := 0
+	if total > 0 {
+		filled = min(done*inner/total, inner)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", inner-filled) + "]"
+}
+
+// Corta s em width colunas.
+func clip(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:max(width, 0)])
+}
+
+// Saída dos logs com o painel aberto: as linhas seguem só para o -log-file e
+// os avisos e erros vão também para o painel.
+type tuiLogWriter struct {
+	d    *tuiDashboard
+	file io.Writer
+}
+
+func (l *tuiLogWriter) Write(p []byte) (int, error) {
+	if l.file != nil {
+		l.file.Write(p)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if isWarningLine(line) {
+			l.d.warn(line)
+		}
+	}
+	return len(p), nil
+}
+
+// Indica se a linha de log, em texto ou JSON, é de um aviso ou erro.
+func isWarningLine(line string) bool {
+	for _, tag := range []string{textTag(slog.LevelWarn, ""), textTag(slog.LevelError, ""), `"level":"warn"`, `"level":"error"`} {
+		if strings.Contains(line, tag) {
+			return true
+		}
+	}
+	return false
+}
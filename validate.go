@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"discoveryhosts/iprange"
+	"discoveryhosts/librenms"
+	"discoveryhosts/zabbix"
+)
+
+// Resultado do subcomando validate, também emitido como JSON com -output json.
+type validationReport struct {
+	Config       string        `json:"config"`
+	Valid        bool          `json:"valid"`
+	Problems     []string      `json:"problems"`
+	Ranges       []rangeReport `json:"ranges,omitempty"`
+	TotalTargets int           `json:"total_targets"`
+	ZabbixAPI    string        `json:"zabbix_api_version,omitempty"`
+	// Versão da API de cada servidor de zabbix_targets
+	TargetsAPI map[string]string `json:"zabbix_targets_api_version,omitempty"`
+	LibreNMS   string            `json:"librenms_version,omitempty"`
+	Icinga2    string            `json:"icinga2_version,omitempty"`
+	Consul     string            `json:"consul_leader,omitempty"`
+}
+
+type rangeReport struct {
+	Range   string `json:"range"`
+	Targets int    `json:"targets"`
+	// Com range_sources: config (ranges) ou phpipam, com a seção e a
+	// descrição da subnet
+	Source      string `json:"source,omitempty"`
+	Section     string `json:"section,omitempty"`
+	Description string `json:"description,omitempty"`
+	Excluded    int    `json:"excluded,omitempty"` // reservados no phpIPAM, fora do scan
+}
+
+// Separa um erro agregado (errors.Join) em mensagens individuais.
+func problemList(err error) []string {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var problems []string
+		for _, e := range joined.Unwrap() {
+			problems = append(problems, problemList(e)...)
+		}
+		return problems
+	}
+	return []string{err.Error()}
+}
+
+// Subcomando validate: carrega e valida a configuração sem enviar nenhum
+// pacote, retornando o código de saída (0 válida, 1 com problemas).
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	lf := addLogFlags(fs)
+	output := fs.String("output", "text", "formato da saída: text ou json")
+	checkConnectivity := fs.Bool("check-connectivity", false, "também verifica se a API do Zabbix (ou do LibreNMS, do Icinga2 e do Consul) responde")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: discoveryhosts validate [-config arquivo] [-output text|json] [-check-connectivity]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "formato de saída inválido: %s\n", *output)
+		return 1
+	}
+	if err := lf.setup(logFormatText, false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	report := validationReport{Config: strings.Join(cf.files(), ","), Problems: []string{}}
+	cfg, err := cf.load()
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+	} else {
+		report.Problems = append(report.Problems, problemList(cfg.validate())...)
+		if cfg.KnownHostsFile != "" && len(cfg.validateKnownHosts()) == 0 {
+			_, problems, err := loadKnownHosts(cfg)
+			if err != nil {
+				report.Problems = append(report.Problems, err.Error())
+			}
+			for _, p := range problems {
+				report.Problems = append(report.Problems, fmt.Sprintf("known_hosts_file %s: %v", cfg.KnownHostsFile, p))
+			}
+		}
+		resolved := cfg
+		ipam := map[string]ipamRange{}
+		if cfg.rangeSource(rangeSourcePHPIPAM) && len(cfg.PHPIPAM.validate(cfg)) == 0 {
+			var found []ipamRange
+			resolved, found, err = cfg.withRangeSources(context.Background())
+			if err != nil {
+				report.Problems = append(report.Problems, fmt.Sprintf("phpIPAM inacessível em %s: %v", cfg.PHPIPAM.URL, err))
+			}
+			for _, r := range found {
+				ipam[r.Range] = r
+			}
+		}
+		owners := resolved.rangeAgents()
+		for _, r := range resolved.Ranges {
+			r = strings.TrimSpace(r)
+			ips, err := iprange.Expand(r)
+			if err != nil {
+				continue
+			}
+			rr := rangeReport{Range: r}
+			// Como no run: os ranges dos agentes vão inteiros
+			if _, remote := owners[r]; !remote {
+				for _, ip := range ips {
+					if resolved.excluded[ip] {
+						rr.Excluded++
+					}
+				}
+			}
+			rr.Targets = len(ips) - rr.Excluded
+			if len(cfg.RangeSources) > 0 {
+				rr.Source = "config"
+				if ir, ok := ipam[r]; ok && !ir.Static {
+					rr.Source, rr.Section, rr.Description = rangeSourcePHPIPAM, ir.Section, ir.Description
+				}
+			}
+			report.Ranges = append(report.Ranges, rr)
+			report.TotalTargets += rr.Targets
+		}
+		// O run terminaria com nenhum alvo (código 3) sem enviar um pacote
+		if len(report.Ranges) > 0 && report.TotalTargets == 0 {
+			report.Problems = append(report.Problems, "nenhum alvo a verificar: todos os IPs dos ranges estão excluídos")
+		}
+		if *checkConnectivity && cfg.backend(backendLibreNMS) {
+			version, err := librenms.NewClient(cfg.LibreNMS.URL, cfg.LibreNMS.Token, time.Duration(cfg.LibreNMS.Timeout)).Version(context.Background())
+			if err != nil {
+				report.Problems = append(report.Problems, fmt.Sprintf("API do LibreNMS inacessível em %s: %v", cfg.LibreNMS.URL, err))
+			}
+			report.LibreNMS = version
+		}
+		if *checkConnectivity && cfg.backend(backendIcinga2) {
+			// Com login: a API do Icinga2 não responde sem autenticação
+			creator := newIcinga2Creator(cfg.Icinga2)
+			version, err := creator.client.Version(context.Background())
+			if err != nil {
+				report.Problems = append(report.Problems, fmt.Sprintf("API do Icinga2 inacessível em %s: %v", cfg.Icinga2.URL, err))
+			}
+			report.Icinga2 = version
+		}
+		if *checkConnectivity && cfg.backend(backendConsul) {
+			leader, err := cfg.Consul.client().Leader(context.Background())
+			if err != nil {
+				report.Problems = append(report.Problems, fmt.Sprintf("API do Consul inacessível em %s: %v", cfg.Consul.Address, err))
+			}
+			report.Consul = leader
+		}
+		if *checkConnectivity && cfg.backend(backendZabbix) && len(cfg.ZabbixTargets) > 0 {
+			report.TargetsAPI = map[string]string{}
+			for _, t := range cfg.ZabbixTargets {
+				version, err := zabbix.NewClient(t.URL, "", "", time.Duration(cfg.ZabbixTimeout)).APIVersion(context.Background())
+				if err != nil {
+					report.Problems = append(report.Problems, fmt.Sprintf("API do Zabbix %s inacessível em %s: %v", t.Name, t.URL, err))
+					continue
+				}
+				report.TargetsAPI[t.Name] = version
+			}
+		} else if *checkConnectivity && cfg.backend(backendZabbix) {
+			version, err := zabbix.NewClient(cfg.ZabbixURL, "", "", time.Duration(cfg.ZabbixTimeout)).APIVersion(context.Background())
+			if err != nil {
+				report.Problems = append(report.Problems, fmt.Sprintf("API do Zabbix inacessível em %s: %v", cfg.ZabbixURL, err))
+			}
+			report.ZabbixAPI = version
+		}
+	}
+	report.Valid = len(report.Problems) == 0
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		for _, r := range report.Ranges {
+			switch {
+			case r.Source == rangeSourcePHPIPAM:
+				origin := "phpIPAM, seção " + r.Section
+				if r.Description != "" {
+					origin += ": " + r.Description
+				}
+				if r.Excluded > 0 {
+					origin += fmt.Sprintf("; %d reservados fora do scan", r.Excluded)
+				}
+				fmt.Printf("range %s: %d alvos (%s)\n", r.Range, r.Targets, origin)
+			case r.Source != "":
+				fmt.Printf("range %s: %d alvos (configuração)\n", r.Range, r.Targets)
+			default:
+				fmt.Printf("range %s: %d alvos\n", r.Range, r.Targets)
+			}
+		}
+		fmt.Printf("total de alvos: %d\n", report.TotalTargets)
+		if report.ZabbixAPI != "" {
+			fmt.Printf("API do Zabbix: versão %s\n", report.ZabbixAPI)
+		}
+		if report.LibreNMS != "" {
+			fmt.Printf("LibreNMS: versão %s\n", report.LibreNMS)
+		}
+		if report.Icinga2 != "" {
+			fmt.Printf("Icinga2: versão %s\n", report.Icinga2)
+		}
+		if report.Consul != "" {
+			fmt.Printf("Consul: líder %s\n", report.Consul)
+		}
+		for _, t := range cfg.ZabbixTargets {
+			if v, ok := report.TargetsAPI[t.Name]; ok {
+				fmt.Printf("API do Zabbix %s: versão %s\n", t.Name, v)
+			}
+		}
+		for _, p := range report.Problems {
+			fmt.Printf("problema: %s\n", p)
+		}
+		if report.Valid {
+			fmt.Printf("%s: configuração válida\n", report.Config)
+		} else {
+			fmt.Printf("%s: %d problema(s) encontrado(s)\n", report.Config, len(report.Problems))
+		}
+	}
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Informações do build, definidas com -ldflags:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Sem elas a versão é dev e o commit vem do VCS registrado pelo go build, se
+// houver.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// Build do binário, mostrado pelo subcomando version e no início dos logs.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"` // GOOS/GOARCH
+}
+
+func currentBuild() buildInfo {
+	b := buildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if b.Commit == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			modified := false
+			for _, s := range info.Settings {
+				switch s.Key {
+				case "vcs.revision":
+					b.Commit = s.Value[:min(len(s.Value), 12)]
+				case "vcs.modified":
+					modified = s.Value == "true"
+				}
+			}
+			if b.Commit != "" && modified {
+				b.Commit += "-dirty"
+			}
+		}
+	}
+	if b.Commit == "" {
+		b.Commit = "unknown"
+	}
+	if b.BuildDate == "" {
+		b.BuildDate = "unknown"
+	}
+	return b
+}
+
+func (b buildInfo) String() string {
+	return fmt.Sprintf("discoveryhosts %s (commit %s, build %s, %s, %s)", b.Version, b.Commit, b.BuildDate, b.GoVersion, b.Platform)
+}
+
+// Subcomando version (também -version/--version no lugar do subcomando).
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	output := fs.String("output", "text", "formato da saída: text ou json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: discoveryhosts version [-output text|json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	b := currentBuild()
+	switch *output {
+	case "text":
+		fmt.Println(b)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(b)
+	default:
+		return fmt.Errorf("formato de saída inválido: %s", *output)
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"discoveryhosts/discovery"
+)
+
+// Destino do cadastro que envia cada host identificado a uma API qualquer.
+const backendWebhook = "webhook"
+
+// Lotes aguardando o envio ao webhook; com a fila cheia o lote é descartado
+// (e contado), como no NetBox.
+const webhookQueue = 100
+
+// Quanto da resposta de um envio com falha entra no log.
+const webhookBodyLimit = 512
+
+// Webhook configura o envio dos hosts identificados, um documento JSON por
+// host, a uma API HTTP (um CMDB, por exemplo), com webhook em backends. Pode
+// ser usado junto com o zabbix ou o librenms: o documento leva o resultado do
+// cadastro.
+type Webhook struct {
+	URL     string            `json:"url,omitempty" yaml:"url" toml:"url"`
+	Method  string            `json:"method" yaml:"method" toml:"method"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers" toml:"headers"`
+	// Authorization: Bearer; ou username e password para Basic
+	Token    string `json:"token,omitempty" yaml:"token" toml:"token"`
+	Username string `json:"username,omitempty" yaml:"username" toml:"username"`
+	Password string `json:"password,omitempty" yaml:"password" toml:"password"`
+	// text/template do documento de cada host, com os campos de webhookHost;
+	// vazio para o JSON do -output-json
+	Template string `json:"template,omitempty" yaml:"template" toml:"template"`
+	// Hosts por requisição; acima de 1 o corpo é a lista dos documentos, ou
+	// um objeto com a lista em batch_key
+	BatchSize  int      `json:"batch_size" yaml:"batch_size" toml:"batch_size"`
+	BatchKey   string   `json:"batch_key,omitempty" yaml:"batch_key" toml:"batch_key"`
+	Timeout    Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+	Retries    int      `json:"retries" yaml:"retries" toml:"retries"`
+	RetryDelay Duration `json:"retry_delay" yaml:"retry_delay" toml:"retry_delay"`
+	Workers    int      `json:"workers" yaml:"workers" toml:"workers"`
+}
+
+func (w Webhook) validate(c Config) []error {
+	if !c.backend(backendWebhook) {
+		return nil
+	}
+	var errs []error
+	if !isConfigURL(w.URL) {
+		errs = append(errs, fmt.Errorf("webhook.url deve ser uma URL http(s):// com o backend webhook%s", c.origin("webhook.url")))
+	}
+	if w.Method != http.MethodPost && w.Method != http.MethodPut && w.Method != http.MethodPatch {
+		errs = append(errs, fmt.Errorf("webhook.method inválido: %q (use POST, PUT ou PATCH)%s", w.Method, c.origin("webhook.method")))
+	}
+	for name := range w.Headers {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\r\n") {
+			errs = append(errs, fmt.Errorf("webhook.headers: nome de header inválido: %q%s", name, c.origin("webhook.headers")))
+		}
+	}
+	if w.Token != "" && (w.Username != "" || w.Password != "") {
+		errs = append(errs, fmt.Errorf("use webhook.token ou webhook.username e webhook.password, não os dois%s", c.origin("webhook.token")))
+	}
+	if _, err := w.template(); err != nil {
+		errs = append(errs, fmt.Errorf("webhook.template: %w%s", err, c.origin("webhook.template")))
+	}
+	if w.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("webhook.batch_size deve ser no mínimo 1 (atual: %d)%s", w.BatchSize, c.origin("webhook.batch_size")))
+	}
+	if w.BatchKey != "" && w.BatchSize == 1 {
+		errs = append(errs, fmt.Errorf("webhook.batch_key só vale com webhook.batch_size acima de 1%s", c.origin("webhook.batch_key")))
+	}
+	if time.Duration(w.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("webhook.timeout deve ser positivo%s", c.origin("webhook.timeout")))
+	}
+	if w.Retries < 0 {
+		errs = append(errs, fmt.Errorf("webhook.retries não pode ser negativo (atual: %d)%s", w.Retries, c.origin("webhook.retries")))
+	}
+	if time.Duration(w.RetryDelay) < 0 {
+		errs = append(errs, fmt.Errorf("webhook.retry_delay não pode ser negativo%s", c.origin("webhook.retry_delay")))
+	}
+	if w.Workers < 1 {
+		errs = append(errs, fmt.Errorf("webhook.workers deve ser no mínimo 1 (atual: %d)%s", w.Workers, c.origin("webhook.workers")))
+	}
+	return errs
+}
+
+func (w Webhook) redacted() Webhook {
+	w.Token = maskSecret(w.Token)
+	w.Password = maskSecret(w.Password)
+	if w.Headers != nil {
+		headers := make(map[string]string, len(w.Headers))
+		for name, value := range w.Headers {
+			headers[name] = maskSecret(value)
+		}
+		w.Headers = headers
+	}
+	return w
+}
+
+// Campos de um host disponíveis no webhook.template, como {{json .Name}}.
+type webhookHost struct {
+	RunID       string
+	IP          string
+	Range       string
+	Name        string // sysName, ou o nome DNS de um host cadastrado sem SNMP
+	SysName     string
+	SysDescr    string
+	SysObjectID string
+	SNMPVersion string
+	Fallback    bool   // cadastrado sem SNMP (name_fallback)
+	Action      string // resultado do cadastro: created, existing, failed...
+	HostID      string
+	Error       string
+	Agent       string
+	OpenPorts   []int
+}
+
+func newWebhookHost(r discovery.HostResult, runID string) webhookHost {
+	h := webhookHost{
+		RunID:       runID,
+		IP:          r.IP,
+		Range:       r.Range,
+		Name:        r.Name(),
+		SysName:     r.SNMP.SysName,
+		SysDescr:    r.SNMP.SysDescr,
+		SysObjectID: r.SNMP.SysObjectID,
+		SNMPVersion: r.SNMP.Version,
+		Fallback:    r.FallbackName != "",
+		Action:      r.ZabbixAction,
+		HostID:      r.HostID,
+		Agent:       r.Agent,
+		OpenPorts:   r.OpenPorts,
+	}
+	if r.ZabbixErr != nil {
+		h.Error = r.ZabbixErr.Error()
+	}
+	return h
+}
+
+// Funções do webhook.template: json escreve qualquer campo como valor JSON
+// (com as aspas e os escapes), e lower e upper mudam a caixa de um texto.
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// Template do documento; nil sem webhook.template. O template é testado com
+// um host de exemplo, para que campos inexistentes e documentos que não são
+// JSON apareçam já na validação.
+func (w Webhook) template() (*template.Template, error) {
+	if w.Template == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("webhook").Funcs(webhookFuncs).Parse(w.Template)
+	if err != nil {
+		return nil, err
+	}
+	sample := webhookHost{
+		RunID: "exemplo", IP: "192.0.2.1", Range: "192.0.2.0/24", Name: "sw-exemplo", SysName: "sw-exemplo",
+		SysDescr: "Exemplo", SysObjectID: "1.3.6.1.4.1.9.1.2066", SNMPVersion: "2c", Action: "created", HostID: "1",
+		OpenPorts: []int{22},
+	}
+	if _, err := renderWebhook(tmpl, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Documento do host pelo template, que precisa gerar JSON válido.
+func renderWebhook(tmpl *template.Template, h webhookHost) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, h); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		doc := buf.String()
+		if len(doc) > webhookBodyLimit {
+			doc = doc[:webhookBodyLimit] + "..."
+		}
+		return nil, fmt.Errorf("o documento gerado não é JSON válido: %s", doc)
+	}
+	return buf.Bytes(), nil
+}
+
+// Documento de um host no lote.
+type webhookDoc struct {
+	ip   string
+	body json.RawMessage
+}
+
+// Contadores dos envios ao webhook de um run; requests conta as tentativas.
+type webhookStats struct {
+	sent, failed, requests, dropped int
+}
+
+// Envia ao webhook os hosts identificados (SNMP ok ou cadastrados pelo nome
+// DNS), em lotes de webhook.batch_size, por webhook.workers goroutines. Uma
+// resposta 2xx é sucesso; outras respostas e erros de conexão são repetidos
+// até webhook.retries vezes e, no fim, contam como falha de cada host do
+// lote. Falhas só geram log e contadores; não mudam o resultado dos hosts.
+type webhookSink struct {
+	cfg    Webhook
+	runID  string
+	tmpl   *template.Template
+	client *http.Client
+
+	pending []webhookDoc // só alterado pelo coletor
+	queue   chan []webhookDoc
+	workers sync.WaitGroup
+	mu      sync.Mutex
+	stats   webhookStats
+}
+
+func newWebhookSink(cfg Webhook, runID string) (*webhookSink, error) {
+	tmpl, err := cfg.template()
+	if err != nil {
+		return nil, fmt.Errorf("webhook.template: %w", err)
+	}
+	s := &webhookSink{
+		cfg:    cfg,
+		runID:  runID,
+		tmpl:   tmpl,
+		client: &http.Client{Timeout: time.Duration(cfg.Timeout)},
+		queue:  make(chan []webhookDoc, webhookQueue),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			for batch := range s.queue {
+				s.send(batch)
+			}
+		}()
+	}
+	return s, nil
+}
+
+func (s *webhookSink) write(r discovery.HostResult) error {
+	if r.Name() == "" || (r.SNMPErr != nil && r.FallbackName == "") {
+		return nil
+	}
+	body, err := s.document(r)
+	if err != nil {
+		s.count(func(st *webhookStats) { st.failed++ })
+		rootLog.With("ip", r.IP, "range", r.Range).With("stage", backendWebhook).WithErr(err).Errorf("webhook.document_failed", r.IP, err)
+		return nil
+	}
+	s.pending = append(s.pending, webhookDoc{ip: r.IP, body: body})
+	if len(s.pending) >= s.cfg.BatchSize {
+		s.flush()
+	}
+	return nil
+}
+
+func (s *webhookSink) close(discovery.Summary) error {
+	if len(s.pending) > 0 {
+		s.flush()
+	}
+	close(s.queue)
+	s.workers.Wait()
+	st := s.stats
+	rootLog.Summaryf("summary.webhook", st.sent, st.failed, st.requests)
+	if st.dropped > 0 {
+		logWarn("webhook.dropped", st.dropped)
+	}
+	return nil
+}
+
+// Documento JSON do host: o do template ou, sem ele, o do -output-json.
+func (s *webhookSink) document(r discovery.HostResult) ([]byte, error) {
+	if s.tmpl == nil {
+		return json.Marshal(newJSONHost(r))
+	}
+	return renderWebhook(s.tmpl, newWebhookHost(r, s.runID))
+}
+
+// Passa o lote pendente aos workers.
+func (s *webhookSink) flush() {
+	batch := s.pending
+	s.pending = nil
+	select {
+	case s.queue <- batch:
+	default:
+		var first bool
+		s.count(func(st *webhookStats) {
+			first = st.dropped == 0
+			st.dropped += len(batch)
+		})
+		if first {
+			logWarn("webhook.queue_full", webhookQueue)
+		}
+	}
+}
+
+func (s *webhookSink) count(f func(*webhookStats)) {
+	s.mu.Lock()
+	f(&s.stats)
+	s.mu.Unlock()
+}
+
+// Envia o lote, repetindo as falhas, e registra o resultado de cada host.
+func (s *webhookSink) send(batch []webhookDoc) {
+	body, err := s.body(batch)
+	if err == nil {
+		for attempt := 0; ; attempt++ {
+			s.count(func(st *webhookStats) { st.requests++ })
+			if err = s.post(body); err == nil || attempt == s.cfg.Retries {
+				break
+			}
+			rootLog.Debugf("webhook.retry", len(batch), attempt+1, s.cfg.Retries, err)
+			time.Sleep(time.Duration(s.cfg.RetryDelay))
+		}
+	}
+	if err != nil {
+		s.count(func(st *webhookStats) { st.failed += len(batch) })
+		for _, doc := range batch {
+			rootLog.With("ip", doc.ip).With("stage", backendWebhook).WithErr(err).Errorf("webhook.failed", doc.ip, err)
+		}
+		return
+	}
+	s.count(func(st *webhookStats) { st.sent += len(batch) })
+	for _, doc := range batch {
+		rootLog.With("ip", doc.ip).With("stage", backendWebhook).Debugf("webhook.sent", doc.ip)
+	}
+}
+
+// Corpo da requisição: o documento do host, com batch_size 1, ou a lista dos
+// documentos do lote (dentro de batch_key, se configurado).
+func (s *webhookSink) body(batch []webhookDoc) ([]byte, error) {
+	if s.cfg.BatchSize == 1 {
+		return batch[0].body, nil
+	}
+	docs := make([]json.RawMessage, len(batch))
+	for i, doc := range batch {
+		docs[i] = doc.body
+	}
+	if s.cfg.BatchKey != "" {
+		return json.Marshal(map[string]interface{}{s.cfg.BatchKey: docs})
+	}
+	return json.Marshal(docs)
+}
+
+// Faz uma requisição ao webhook; só uma resposta 2xx é sucesso.
+func (s *webhookSink) post(body []byte) error {
+	req, err := http.NewRequest(s.cfg.Method, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	switch {
+	case s.cfg.Token != "":
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	case s.cfg.Username != "" || s.cfg.Password != "":
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, webhookBodyLimit))
+		if msg := strings.TrimSpace(string(data)); msg != "" {
+			return fmt.Errorf("o webhook respondeu %s: %s", resp.Status, msg)
+		}
+		return fmt.Errorf("o webhook respondeu %s", resp.Status)
+	}
+	return nil
+}
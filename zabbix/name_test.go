@@ -0,0 +1,96 @@
+package zabbix
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestTechnicalName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"sw-core-01", "sw-core-01"},
+		{"Core Switch.lab", "Core Switch.lab"},
+		{"  padded  ", "padded"},
+		{"rtr/01", "rtr_01"},
+		{"a/_b", "a_b"},
+		{"a_/b", "a_b"},
+		{"a  b", "a b"},
+		{"a /b", "a b"},
+		{"a/ b", "a b"},
+		{"a//\\b", "a_b"},
+		{"switch Ação", "switch A_o"},
+		{"日本", ""},
+		{"---", ""},
+		{"", ""},
+		{strings.Repeat("x", 200), strings.Repeat("x", maxNameLen)},
+	}
+	for _, tt := range tests {
+		if got := TechnicalName(tt.name); got != tt.want {
+			t.Errorf("TechnicalName(%q) = %q, esperava %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Regras do nome técnico na documentação do Zabbix: só letras e dígitos
+// ASCII, espaço, ponto, hífen e sublinhado, até 128 caracteres.
+func validTechnicalName(s string) bool {
+	if len(s) > maxNameLen {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == ' ' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Há uma letra ou dígito ASCII nos primeiros maxNameLen caracteres: cada
+// caractere da entrada vira no máximo um da saída, então ele sobrevive ao
+// corte.
+func hasASCIIAlnum(s string) bool {
+	r := []rune(strings.TrimSpace(s))
+	for _, c := range r[:min(len(r), maxNameLen)] {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTechnicalName(t *testing.T, name string) {
+	got := TechnicalName(name)
+	if !validTechnicalName(got) {
+		t.Errorf("TechnicalName(%q) = %q: nome técnico inválido", name, got)
+	}
+	if again := TechnicalName(got); again != got {
+		t.Errorf("TechnicalName(%q) = %q, mas TechnicalName(%q) = %q", name, got, got, again)
+	}
+	if hasASCIIAlnum(name) && got == "" {
+		t.Errorf("TechnicalName(%q) vazio", name)
+	}
+	for _, sep := range []string{"  ", "..", "--", "__"} {
+		if strings.Contains(got, sep) {
+			t.Errorf("TechnicalName(%q) = %q: separador repetido %q", name, got, sep)
+		}
+	}
+}
+
+func TestTechnicalNameProperties(t *testing.T) {
+	f := func(name string) bool {
+		checkTechnicalName(t, name)
+		return !t.Failed()
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func FuzzTechnicalName(f *testing.F) {
+	for _, seed := range []string{"sw-core-01", "a/_b", "a  b", "switch Ação", "日本", " . - _ ", strings.Repeat(". ", 100) + "a"} {
+		f.Add(seed)
+	}
+	f.Fuzz(checkTechnicalName)
+}
@@ -0,0 +1,84 @@
+package zabbix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Limite da resposta do trapper, que é só um resumo do processamento.
+const maxSenderResponse = 1 << 20
+
+// SenderItem é o valor de um item trapper.
+type SenderItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+type senderResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// Send envia os itens ao trapper em addr no protocolo do zabbix_sender:
+// cabeçalho "ZBXD\x01", tamanho em 8 bytes little-endian e o JSON "sender
+// data". Retorna o info da resposta.
+func Send(addr string, timeout time.Duration, items []SenderItem) (string, error) {
+	body, err := json.Marshal(struct {
+		Request string       `json:"request"`
+		Data    []SenderItem `json:"data"`
+		Clock   int64        `json:"clock"`
+	}{"sender data", items, time.Now().Unix()})
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var packet bytes.Buffer
+	packet.WriteString("ZBXD\x01")
+	binary.Write(&packet, binary.LittleEndian, uint64(len(body)))
+	packet.Write(body)
+	if _, err := conn.Write(packet.Bytes()); err != nil {
+		return "", err
+	}
+
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", fmt.Errorf("resposta inválida do trapper: %w", err)
+	}
+	if string(header[:4]) != "ZBXD" {
+		return "", fmt.Errorf("resposta inválida do trapper: cabeçalho %q", header[:4])
+	}
+	size := binary.LittleEndian.Uint64(header[5:])
+	if size > maxSenderResponse {
+		return "", fmt.Errorf("resposta do trapper muito grande (%d bytes)", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return "", fmt.Errorf("resposta inválida do trapper: %w", err)
+	}
+	var resp senderResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", fmt.Errorf("resposta inválida do trapper: %w", err)
+	}
+	if resp.Response != "success" {
+		return "", fmt.Errorf("trapper respondeu %q: %s", resp.Response, resp.Info)
+	}
+	// "processed: 3; failed: 1; ..." indica itens ou host inexistentes
+	if strings.Contains(resp.Info, "failed: ") && !strings.Contains(resp.Info, "failed: 0;") {
+		return "", fmt.Errorf("itens recusados pelo Zabbix (confira host e chaves trapper): %s", resp.Info)
+	}
+	return resp.Info, nil
+}
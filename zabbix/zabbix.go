@@ -0,0 +1,527 @@
+// Package zabbix implementa o cliente mínimo da API JSON-RPC do Zabbix usado
+// no cadastro dos hosts e o envio de itens trapper (protocolo do
+// zabbix_sender).
+package zabbix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"discoveryhosts/hosttrace"
+)
+
+// Resultado de Ensure
+const (
+	Created  = "created"
+	Existing = "existing"
+	Upgraded = "upgraded" // cadastrado antes sem SNMP, atualizado
+	Failed   = "failed"
+)
+
+// Requisição e resposta JSON-RPC da API do Zabbix.
+type zabbixRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+	Auth    string      `json:"auth,omitempty"`
+	ID      int         `json:"id"`
+}
+
+type zabbixResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *APIError       `json:"error"`
+}
+
+// APIError é um erro retornado pela API do Zabbix.
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("erro da API do Zabbix %d: %s %s", e.Code, e.Message, e.Data)
+}
+
+// HTTPError é uma resposta HTTP diferente de 200 da API.
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("API do Zabbix respondeu HTTP %d", e.StatusCode)
+}
+
+// Transient indica se a falha parece passageira e vale uma nova tentativa:
+// timeouts, falhas de rede e respostas HTTP 5xx ou 429. Erros retornados pela
+// própria API (parâmetros, permissão) e o cancelamento não são.
+func Transient(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500 || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// ErrAuth envolve as falhas do login na API. Todas as chamadas seguintes
+// falhariam do mesmo jeito.
+var ErrAuth = errors.New("falha no login do Zabbix")
+
+// Client é um cliente mínimo da API JSON-RPC do Zabbix. O login é feito na
+// primeira chamada autenticada e a sessão é compartilhada entre os workers.
+type Client struct {
+	url  string
+	user string
+	pass string
+	http *http.Client
+
+	mu      sync.Mutex
+	version int // major*100 + minor, ex.: 604 para 6.4
+	token   string
+}
+
+// NewClient cria um cliente para a URL da API; o login só acontece na
+// primeira chamada que precisa de sessão.
+func NewClient(url, user, pass string, timeout time.Duration) *Client {
+	return &Client{url: url, user: user, pass: pass, http: &http.Client{Timeout: timeout}}
+}
+
+// Faz uma chamada JSON-RPC; com auth, envia o token da sessão no formato
+// esperado pela versão do servidor. Com um hosttrace no ctx, o pedido e a
+// resposta vão para o rastro, sem a senha e o token.
+func (z *Client) call(ctx context.Context, method string, params interface{}, auth string, result interface{}) error {
+	req := zabbixRequest{JSONRPC: "2.0", Method: method, Params: params, ID: 1}
+	useHeader := auth != "" && z.version >= 604
+	if auth != "" && !useHeader {
+		req.Auth = auth
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, z.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json-rpc")
+	if useHeader {
+		httpReq.Header.Set("Authorization", "Bearer "+auth)
+	}
+	t := hosttrace.From(ctx)
+	if t != nil {
+		shown := req
+		if shown.Auth != "" {
+			shown.Auth = "***"
+		}
+		if method == "user.login" {
+			shown.Params = "***"
+		}
+		traced, _ := json.Marshal(shown)
+		if useHeader {
+			t.Printf("zabbix: POST %s (Authorization: Bearer ***) %s", z.url, traced)
+		} else {
+			t.Printf("zabbix: POST %s %s", z.url, traced)
+		}
+	}
+	start := time.Now()
+	resp, err := z.http.Do(httpReq)
+	if err != nil {
+		t.Printf("zabbix: %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+	var respBody io.Reader = resp.Body
+	if t != nil {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		shown := bytes.TrimSpace(data)
+		if method == "user.login" {
+			// O resultado é o token da sessão
+			shown = []byte("(resposta do login omitida)")
+		}
+		t.Printf("zabbix: HTTP %d em %s: %s", resp.StatusCode, time.Since(start).Round(time.Millisecond), shown)
+		respBody = bytes.NewReader(data)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{StatusCode: resp.StatusCode}
+	}
+	var zr zabbixResponse
+	if err := json.NewDecoder(respBody).Decode(&zr); err != nil {
+		return fmt.Errorf("resposta inválida da API do Zabbix: %w", err)
+	}
+	if zr.Error != nil {
+		return zr.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(zr.Result, result); err != nil {
+		return fmt.Errorf("resposta inválida da API do Zabbix em %s: %w", method, err)
+	}
+	return nil
+}
+
+// APIVersion consulta a versão da API (apiinfo.version), que não exige
+// autenticação.
+func (z *Client) APIVersion(ctx context.Context) (string, error) {
+	var version string
+	if err := z.call(ctx, "apiinfo.version", []string{}, "", &version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// ParseVersion converte "6.4.12" em 604.
+func ParseVersion(v string) int {
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return 0
+	}
+	major, _ := strconv.Atoi(parts[0])
+	minor, _ := strconv.Atoi(parts[1])
+	return major*100 + minor
+}
+
+// Retorna o token da sessão, autenticando na primeira chamada.
+func (z *Client) session(ctx context.Context) (string, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.token != "" {
+		return z.token, nil
+	}
+	if z.url == "" {
+		return "", fmt.Errorf("zabbix_url não configurado")
+	}
+	version, err := z.APIVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	z.version = ParseVersion(version)
+
+	// A partir do 5.4 o parâmetro "user" virou "username"
+	params := map[string]string{"username": z.user, "password": z.pass}
+	if z.version < 504 {
+		params = map[string]string{"user": z.user, "password": z.pass}
+	}
+	var token string
+	if err := z.call(ctx, "user.login", params, "", &token); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrAuth, err)
+	}
+	z.token = token
+	return token, nil
+}
+
+// HostSpec descreve um host a ser criado no Zabbix.
+type HostSpec struct {
+	Name      string
+	IP        string
+	GroupIDs  []string
+	ProxyID   string
+	Community string
+
+	// Interface do host: InterfaceSNMP (vazio) para os hosts identificados
+	// por SNMP, InterfaceAgent ou InterfaceICMP para os cadastrados sem SNMP.
+	Interface string
+	// Tag dos hosts cadastrados sem SNMP, com o IP como valor. Um host SNMP
+	// cujo IP tenha um host com essa tag atualiza esse host (nome, interface
+	// e macro) em vez de criar outro.
+	FallbackTag string
+	// Tags do host criado, como service:ssh
+	Tags []Tag
+	// Templates vinculados ao host criado; a atualização de um host
+	// cadastrado sem SNMP não muda os templates dele
+	TemplateIDs []string
+
+	// Dados do host usados pelos outros backends (o cadastro no Zabbix não
+	// os usa)
+	Range       string
+	Description string // sysDescr
+	Location    string // sysLocation
+}
+
+// Tag é uma tag de host do Zabbix.
+type Tag struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// Interfaces de HostSpec.Interface.
+const (
+	InterfaceSNMP  = "snmp"
+	InterfaceAgent = "agent"
+	InterfaceICMP  = "icmp" // sem interface: só simple checks (ICMP ping)
+)
+
+// Tamanho máximo do nome técnico (host) e do nome visível (name).
+const maxNameLen = 128
+
+// TechnicalName converte o nome do host (o sysName) para o alfabeto que a API
+// aceita no nome técnico: letras e dígitos ASCII, espaço, ponto, hífen e
+// sublinhado. Os outros caracteres viram "_", e os separadores repetidos
+// depois disso ficam um só: "a/_b" e "a  b" viram "a_b" e "a b". Um "_" de
+// um caractere trocado ao lado de um separador some nele ("a /b" vira
+// "a b"). O resultado é cortado em 128 caracteres. Um nome válido sem
+// separadores repetidos volta igual, para que host.get continue encontrando
+// os hosts já cadastrados; vazio se não sobrar nenhuma letra ou dígito.
+func TechnicalName(name string) string {
+	out := make([]byte, 0, len(name))
+	mapped := false // o último caractere de out é um "_" de um caractere trocado
+	for _, c := range strings.TrimSpace(name) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			out = append(out, byte(c))
+			mapped = false
+		case c == ' ', c == '.', c == '-', c == '_':
+			n := len(out)
+			switch {
+			case n > 0 && mapped:
+				out[n-1] = byte(c)
+			case n > 0 && out[n-1] == byte(c):
+			default:
+				out = append(out, byte(c))
+			}
+			mapped = false
+		case len(out) > 0 && isSeparator(out[len(out)-1]):
+		default:
+			out = append(out, '_')
+			mapped = true
+		}
+	}
+	host := string(out)
+	if len(host) > maxNameLen {
+		host = host[:maxNameLen]
+	}
+	// Um caractere trocado no fim some no espaço antes dele
+	host = strings.TrimSpace(host)
+	if strings.Trim(host, " ._-") == "" {
+		return ""
+	}
+	return host
+}
+
+func isSeparator(c byte) bool {
+	return c == ' ' || c == '.' || c == '-' || c == '_'
+}
+
+// Nome visível do host: o nome original, cortado no limite da API.
+func visibleName(name string) string {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) <= maxNameLen {
+		return name
+	}
+	return string([]rune(name)[:maxNameLen])
+}
+
+func (spec HostSpec) snmp() bool {
+	return spec.Interface == "" || spec.Interface == InterfaceSNMP
+}
+
+// Ensure garante que o host exista: retorna Existing com o hostid atual
+// se ele já estiver cadastrado, ou cria e retorna Created. Com FallbackTag,
+// um host SNMP que antes foi cadastrado sem SNMP é atualizado e retorna
+// Upgraded.
+func (z *Client) Ensure(ctx context.Context, spec HostSpec) (string, string, error) {
+	// A community vai na macro do host.create e do host.update; no rastro
+	// aparece mascarada mesmo quando o host não passou pelo SNMP (cache)
+	hosttrace.From(ctx).Secret(spec.Community)
+	token, err := z.session(ctx)
+	if err != nil {
+		return Failed, "", err
+	}
+	host := TechnicalName(spec.Name)
+	if host == "" {
+		return Failed, "", fmt.Errorf("nome %q sem nenhum caractere válido para o nome técnico do host", spec.Name)
+	}
+
+	// Sem SNMP o nome pode mudar entre os runs (PTR); o IP na tag não
+	if !spec.snmp() && spec.FallbackTag != "" {
+		tagged, err := z.taggedHost(ctx, token, spec)
+		if err != nil {
+			return Failed, "", err
+		}
+		if tagged != nil {
+			return Existing, tagged.HostID, nil
+		}
+	}
+
+	var existing []struct {
+		HostID string `json:"hostid"`
+	}
+	get := map[string]interface{}{
+		"output": []string{"hostid"},
+		"filter": map[string]interface{}{"host": []string{host}},
+	}
+	if err := z.call(ctx, "host.get", get, token, &existing); err != nil {
+		return Failed, "", err
+	}
+	if len(existing) > 0 {
+		return Existing, existing[0].HostID, nil
+	}
+
+	if spec.snmp() && spec.FallbackTag != "" {
+		tagged, err := z.taggedHost(ctx, token, spec)
+		if err != nil {
+			return Failed, "", err
+		}
+		if tagged != nil {
+			if err := z.upgradeHost(ctx, token, spec, host, tagged); err != nil {
+				return Failed, "", err
+			}
+			return Upgraded, tagged.HostID, nil
+		}
+	}
+
+	groups := make([]map[string]string, len(spec.GroupIDs))
+	for i, id := range spec.GroupIDs {
+		groups[i] = map[string]string{"groupid": id}
+	}
+	create := map[string]interface{}{
+		"host":       host,
+		"groups":     groups,
+		"interfaces": hostInterfaces(spec),
+	}
+	// O nome original fica visível e na descrição do host
+	if host != spec.Name {
+		create["name"] = visibleName(spec.Name)
+		create["description"] = "sysName: " + spec.Name
+	}
+	if len(spec.TemplateIDs) > 0 {
+		templates := make([]map[string]string, len(spec.TemplateIDs))
+		for i, id := range spec.TemplateIDs {
+			templates[i] = map[string]string{"templateid": id}
+		}
+		create["templates"] = templates
+	}
+	tags := append([]Tag{}, spec.Tags...)
+	if spec.snmp() {
+		create["macros"] = hostMacros(spec)
+	} else if spec.FallbackTag != "" {
+		tags = append(tags, Tag{Tag: spec.FallbackTag, Value: spec.IP})
+	}
+	if len(tags) > 0 {
+		create["tags"] = tags
+	}
+	if spec.ProxyID != "" && spec.ProxyID != "0" {
+		// No 7.0 proxy_hostid foi substituído por monitored_by + proxyid
+		if z.version >= 700 {
+			create["monitored_by"] = 1
+			create["proxyid"] = spec.ProxyID
+		} else {
+			create["proxy_hostid"] = spec.ProxyID
+		}
+	}
+	var created struct {
+		HostIDs []string `json:"hostids"`
+	}
+	if err := z.call(ctx, "host.create", create, token, &created); err != nil {
+		return Failed, "", err
+	}
+	if len(created.HostIDs) == 0 {
+		return Failed, "", fmt.Errorf("host.create não retornou hostid")
+	}
+	return Created, created.HostIDs[0], nil
+}
+
+type taggedHost struct {
+	HostID string `json:"hostid"`
+	Tags   []Tag  `json:"tags"`
+}
+
+// Host cadastrado sem SNMP para o IP do spec, ou nil se não houver.
+func (z *Client) taggedHost(ctx context.Context, token string, spec HostSpec) (*taggedHost, error) {
+	var hosts []taggedHost
+	get := map[string]interface{}{
+		"output":     []string{"hostid"},
+		"selectTags": []string{"tag", "value"},
+		"tags":       []map[string]interface{}{{"tag": spec.FallbackTag, "value": spec.IP, "operator": 1}},
+	}
+	if err := z.call(ctx, "host.get", get, token, &hosts); err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	return &hosts[0], nil
+}
+
+// Troca o nome (host, o técnico) e a interface de um host cadastrado sem SNMP
+// pelos do spec e remove a tag do fallback, mantendo as demais e
+// acrescentando as do spec.
+func (z *Client) upgradeHost(ctx context.Context, token string, spec HostSpec, host string, h *taggedHost) error {
+	tags := []Tag{}
+	seen := map[Tag]bool{}
+	for _, t := range append(h.Tags, spec.Tags...) {
+		if t.Tag != spec.FallbackTag && !seen[t] {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	update := map[string]interface{}{
+		"hostid":     h.HostID,
+		"host":       host,
+		"name":       visibleName(spec.Name),
+		"interfaces": hostInterfaces(spec),
+		"macros":     hostMacros(spec),
+		"tags":       tags,
+	}
+	var updated struct {
+		HostIDs []string `json:"hostids"`
+	}
+	return z.call(ctx, "host.update", update, token, &updated)
+}
+
+func hostInterfaces(spec HostSpec) []map[string]interface{} {
+	switch spec.Interface {
+	case InterfaceICMP:
+		return []map[string]interface{}{}
+	case InterfaceAgent:
+		return []map[string]interface{}{{
+			"type":  1,
+			"main":  1,
+			"useip": 1,
+			"ip":    spec.IP,
+			"dns":   "",
+			"port":  "10050",
+		}}
+	}
+	return []map[string]interface{}{{
+		"type":  2,
+		"main":  1,
+		"useip": 1,
+		"ip":    spec.IP,
+		"dns":   "",
+		"port":  "161",
+		"details": map[string]interface{}{
+			"version":   2,
+			"bulk":      1,
+			"community": "{$SNMP_COMMUNITY}",
+		},
+	}}
+}
+
+// A community usada na descoberta fica numa macro secreta do host
+func hostMacros(spec HostSpec) []map[string]interface{} {
+	return []map[string]interface{}{{
+		"macro": "{$SNMP_COMMUNITY}",
+		"value": spec.Community,
+		"type":  1,
+	}}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/zabbix"
+)
+
+// Porta padrão do trapper do Zabbix server/proxy
+const zabbixSenderPort = "10051"
+
+// ZabbixSender configura o envio das estatísticas do run a itens trapper do
+// Zabbix, no mesmo protocolo do zabbix_sender.
+type ZabbixSender struct {
+	Server    string   `json:"server,omitempty" yaml:"server" toml:"server"`
+	Host      string   `json:"host,omitempty" yaml:"host" toml:"host"`
+	KeyPrefix string   `json:"key_prefix" yaml:"key_prefix" toml:"key_prefix"`
+	Timeout   Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+func (z ZabbixSender) validate(c Config) []error {
+	if z.Server == "" {
+		return nil
+	}
+	var errs []error
+	if z.Host == "" {
+		errs = append(errs, fmt.Errorf("zabbix_sender.host é obrigatório quando zabbix_sender.server está definido%s", c.origin("zabbix_sender.server")))
+	}
+	if strings.TrimSpace(z.KeyPrefix) == "" {
+		errs = append(errs, fmt.Errorf("zabbix_sender.key_prefix não pode ser vazio%s", c.origin("zabbix_sender.key_prefix")))
+	}
+	if time.Duration(z.Timeout) <= 0 {
+		errs = append(errs, fmt.Errorf("zabbix_sender.timeout deve ser positivo%s", c.origin("zabbix_sender.timeout")))
+	}
+	return errs
+}
+
+// Endereço do trapper, com a porta padrão se omitida.
+func (z ZabbixSender) address() string {
+	if _, _, err := net.SplitHostPort(z.Server); err == nil {
+		return z.Server
+	}
+	return net.JoinHostPort(z.Server, zabbixSenderPort)
+}
+
+// Envia as estatísticas do run ao trapper no close. Falhas de entrega só
+// geram log.
+type senderSink struct {
+	cfg ZabbixSender
+}
+
+func newSenderSink(cfg ZabbixSender) *senderSink {
+	return &senderSink{cfg: cfg}
+}
+
+func (s *senderSink) write(discovery.HostResult) error { return nil }
+
+func (s *senderSink) close(sum discovery.Summary) error {
+	clock := sum.End.Unix()
+	item := func(key, value string) zabbix.SenderItem {
+		return zabbix.SenderItem{Host: s.cfg.Host, Key: s.cfg.KeyPrefix + "." + key, Value: value, Clock: clock}
+	}
+	items := []zabbix.SenderItem{
+		item("hosts_alive", strconv.Itoa(sum.Alive)),
+		item("hosts_created", strconv.Itoa(sum.HostsCreated)),
+		item("errors", strconv.Itoa(sum.ZabbixErrors+sum.SNMPFailures())),
+		item("duration", strconv.FormatFloat(sum.Elapsed().Seconds(), 'f', 3, 64)),
+	}
+	info, err := zabbix.Send(s.cfg.address(), time.Duration(s.cfg.Timeout), items)
+	if err != nil {
+		logError("sender.failed", s.cfg.address(), err)
+		return nil
+	}
+	logInfo("sender.sent", s.cfg.address(), info)
+	return nil
+}
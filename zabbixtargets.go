@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"discoveryhosts/discovery"
+	"discoveryhosts/zabbix"
+)
+
+// ZabbixTarget é um dos servidores de zabbix_targets. Com a lista, cada host
+// é cadastrado em todos eles (durante uma migração, por exemplo), no lugar de
+// zabbix_url, zabbix_user, zabbix_pass, zabbix_group_ids e zabbix_proxy_id.
+// Cada servidor tem o seu login e a sua versão da API; zabbix_timeout vale
+// para todos.
+type ZabbixTarget struct {
+	Name        string   `json:"name" yaml:"name" toml:"name"`
+	URL         string   `json:"url" yaml:"url" toml:"url"`
+	User        string   `json:"user" yaml:"user" toml:"user"`
+	Pass        string   `json:"pass,omitempty" yaml:"pass" toml:"pass"`
+	GroupIDs    []string `json:"group_ids" yaml:"group_ids" toml:"group_ids"`
+	ProxyID     string   `json:"proxy_id,omitempty" yaml:"proxy_id" toml:"proxy_id"`
+	TemplateIDs []string `json:"template_ids,omitempty" yaml:"template_ids" toml:"template_ids"`
+}
+
+func (t ZabbixTarget) redacted() ZabbixTarget {
+	t.Pass = maskSecret(t.Pass)
+	return t
+}
+
+// Confere os servidores de zabbix_targets: nomes únicos, URL obrigatória e
+// nenhum zabbix_url junto.
+func (c Config) validateZabbixTargets() []error {
+	if len(c.ZabbixTargets) == 0 {
+		return nil
+	}
+	var errs []error
+	if c.ZabbixURL != "" {
+		errs = append(errs, fmt.Errorf("use zabbix_url ou zabbix_targets, não os dois%s", c.origin("zabbix_url")))
+	}
+	seen := map[string]bool{}
+	for i, t := range c.ZabbixTargets {
+		key := fmt.Sprintf("zabbix_targets[%d]", i)
+		name := strings.TrimSpace(t.Name)
+		switch {
+		case name == "":
+			errs = append(errs, fmt.Errorf("%s.name não pode ser vazio%s", key, c.origin(key)))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("zabbix_targets: o nome %s está repetido%s", name, c.origin(key)))
+		}
+		seen[name] = true
+		if t.URL == "" {
+			errs = append(errs, fmt.Errorf("zabbix_targets: o servidor %s não tem url%s", name, c.origin(key)))
+		}
+	}
+	return errs
+}
+
+// Servidores do cadastro no formato do discovery; nil sem zabbix_targets, sem
+// o backend zabbix ou com mais de um backend de cadastro, em que os
+// servidores entram na lista de backends.
+func (c Config) zabbixTargets() []discovery.ZabbixTarget {
+	if !c.backend(backendZabbix) || c.multipleBackends() {
+		return nil
+	}
+	return c.zabbixServers()
+}
+
+// Servidores de zabbix_targets no formato do discovery.
+func (c Config) zabbixServers() []discovery.ZabbixTarget {
+	var targets []discovery.ZabbixTarget
+	for _, t := range c.ZabbixTargets {
+		targets = append(targets, discovery.ZabbixTarget{
+			Name:        strings.TrimSpace(t.Name),
+			Zabbix:      zabbix.NewClient(t.URL, t.User, t.Pass, time.Duration(c.ZabbixTimeout)),
+			GroupIDs:    t.GroupIDs,
+			ProxyID:     t.ProxyID,
+			TemplateIDs: t.TemplateIDs,
+		})
+	}
+	return targets
+}
+
+// Cadastro do host em cada servidor, como "antigo=created;novo=failed".
+func targetActions(r discovery.HostResult) string {
+	parts := make([]string, len(r.Targets))
+	for i, tr := range r.Targets {
+		parts[i] = tr.Target + "=" + tr.Action
+	}
+	return strings.Join(parts, ";")
+}